@@ -0,0 +1,423 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/storage"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// BatchOptions configures QueryBatch.
+type BatchOptions struct {
+	// Options configure every query of the batch (nil uses defaults).
+	Options *types.ClaudeAgentOptions
+
+	// Concurrency is how many prompts run at once (0 means 1).
+	Concurrency int
+
+	// Checkpoint is the path of a file recording the completed prompts, one
+	// JSON line with the prompt's index and result digest each, appended as
+	// each prompt completes, or the name of the batch in CheckpointStore.
+	// Empty means no checkpoint. The file is replaced when the batch starts
+	// unless Resume is set.
+	Checkpoint string
+
+	// CheckpointStore, if set, keeps the checkpoint in the store instead of
+	// a file, so that a batch can resume on another machine sharing it.
+	// Checkpoint then names the batch: each completed prompt is the entry
+	// Checkpoint + "/" + its index, holding its result digest. The entries
+	// are deleted when the batch starts unless Resume is set.
+	CheckpointStore storage.Store
+
+	// Resume skips the prompts recorded in Checkpoint by an earlier run of
+	// the same batch, which must have the same prompts in the same order. A
+	// missing checkpoint resumes nothing.
+	Resume bool
+
+	// Retry is how each prompt is retried when it fails.
+	Retry BatchRetryPolicy
+
+	// OnItem, if set, is called with the outcome of each prompt as it
+	// finishes, including prompts skipped by Resume. Calls are serialized.
+	OnItem func(BatchItem)
+}
+
+// BatchRetryPolicy is how QueryBatch retries a prompt. The zero value makes
+// one attempt with no time limit beyond the batch's context.
+type BatchRetryPolicy struct {
+	// MaxAttempts is how many times a prompt is tried (0 means 1).
+	MaxAttempts int
+
+	// Backoff is the wait before the second attempt, doubled before each
+	// further attempt.
+	Backoff time.Duration
+
+	// AttemptTimeout limits each attempt, so that a stuck query is retried
+	// rather than holding up the batch until its context is done. Zero
+	// means no limit.
+	AttemptTimeout time.Duration
+}
+
+// BatchItem is the outcome of one prompt of a batch.
+type BatchItem struct {
+	// Index is the prompt's position in the batch.
+	Index int
+
+	// Turn is the outcome of the last attempt, or nil if the prompt was
+	// skipped or its query could not start.
+	Turn *types.TurnResult
+
+	// Digest is the SHA-256 of the turn's assistant text, in hex, as written
+	// to the checkpoint. It is set for completed prompts, including those
+	// skipped by Resume.
+	Digest string
+
+	// Attempts is how many times the prompt was tried: zero if it was
+	// skipped or the batch stopped before reaching it.
+	Attempts int
+
+	// Skipped reports that the prompt was completed by an earlier run and
+	// recorded in the checkpoint.
+	Skipped bool
+
+	// Err is why the last attempt failed, or nil if the prompt completed.
+	Err error
+}
+
+// Completed reports whether the prompt completed, in this run or an earlier one.
+func (i BatchItem) Completed() bool {
+	return i.Err == nil && i.Digest != ""
+}
+
+// QueryBatch runs each of prompts as a separate Query and returns their
+// outcomes, indexed like prompts. A prompt that fails is retried according
+// to opts.Retry; if every attempt fails, its error is recorded in its
+// BatchItem and the batch goes on. A prompt fails when its query cannot
+// start, its stream fails, or it ends without a result or with an error
+// result.
+//
+// With opts.Checkpoint set, each completed prompt is recorded as it
+// completes, in a file or in opts.CheckpointStore, so a batch stopped part
+// way, by a cancelled context or a crash, can be run again with opts.Resume
+// to skip the prompts already done. A final checkpoint line cut short by a
+// crash is ignored.
+//
+// The returned error is ctx.Err() when ctx is done before every prompt has
+// run, or an error reading or writing the checkpoint; the outcomes so far
+// are returned with it.
+//
+// Example:
+//
+//	items, err := claude.QueryBatch(ctx, prompts, &claude.BatchOptions{
+//	    Concurrency: 4,
+//	    Checkpoint:  "batch.checkpoint",
+//	    Resume:      true,
+//	    Retry:       claude.BatchRetryPolicy{MaxAttempts: 3, Backoff: time.Second},
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, item := range items {
+//	    if item.Err != nil {
+//	        log.Printf("prompt %d failed: %v", item.Index, item.Err)
+//	    }
+//	}
+func QueryBatch(ctx context.Context, prompts []string, opts *BatchOptions) ([]BatchItem, error) {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	items := make([]BatchItem, len(prompts))
+	for i := range items {
+		items[i].Index = i
+	}
+
+	var done map[int]string
+	var record func(BatchItem) error
+	switch {
+	case opts.Checkpoint == "":
+	case opts.CheckpointStore != nil:
+		var err error
+		done, err = openStoreCheckpoint(ctx, opts.CheckpointStore, opts.Checkpoint, opts.Resume, len(prompts))
+		if err != nil {
+			return items, err
+		}
+		record = func(item BatchItem) error {
+			// Record prompts that completed as the batch was stopped
+			return putCheckpoint(context.WithoutCancel(ctx), opts.CheckpointStore, opts.Checkpoint, item)
+		}
+	default:
+		var checkpoint *os.File
+		var err error
+		done, checkpoint, err = openCheckpoint(opts.Checkpoint, opts.Resume, len(prompts))
+		if err != nil {
+			return items, err
+		}
+		defer checkpoint.Close()
+		record = func(item BatchItem) error {
+			return appendCheckpoint(checkpoint, item)
+		}
+	}
+
+	var mu sync.Mutex // guards checkpoint writes, OnItem calls and writeErr
+	var writeErr error
+	finish := func(item BatchItem) {
+		mu.Lock()
+		defer mu.Unlock()
+		if record != nil && item.Completed() && !item.Skipped && writeErr == nil {
+			writeErr = record(item)
+		}
+		if opts.OnItem != nil {
+			opts.OnItem(item)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				items[i] = runBatchItem(ctx, i, prompts[i], opts)
+				finish(items[i])
+			}
+		}()
+	}
+
+dispatch:
+	for i := range prompts {
+		if digest, ok := done[i]; ok {
+			items[i].Digest = digest
+			items[i].Skipped = true
+			finish(items[i])
+			continue
+		}
+		mu.Lock()
+		failed := writeErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	if writeErr != nil {
+		return items, writeErr
+	}
+	return items, ctx.Err()
+}
+
+// runBatchItem runs one prompt of a batch, retrying it as opts.Retry allows.
+func runBatchItem(ctx context.Context, index int, prompt string, opts *BatchOptions) BatchItem {
+	item := BatchItem{Index: index}
+	attempts := opts.Retry.MaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	backoff := opts.Retry.Backoff
+
+	for item.Attempts < attempts {
+		if item.Attempts > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return item
+			}
+			backoff *= 2
+		}
+		item.Attempts++
+
+		item.Turn, item.Err = runBatchAttempt(ctx, prompt, opts)
+		if item.Err == nil {
+			item.Digest = turnDigest(item.Turn)
+			return item
+		}
+		if ctx.Err() != nil {
+			// The batch is stopping; attempts cut short by it are not retried
+			return item
+		}
+	}
+	return item
+}
+
+// runBatchAttempt makes one attempt at a prompt of a batch.
+func runBatchAttempt(ctx context.Context, prompt string, opts *BatchOptions) (*types.TurnResult, error) {
+	if opts.Retry.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Retry.AttemptTimeout)
+		defer cancel()
+	}
+
+	messages, err := Query(ctx, prompt, opts.Options)
+	if err != nil {
+		return nil, err
+	}
+	turn, err := collectTurn(ctx, messages)
+	if err == nil && turn.IsError() {
+		err = fmt.Errorf("query ended with an error result: %s", turn.Result.Subtype)
+	}
+	return turn, err
+}
+
+// turnDigest returns the digest of a turn recorded in a batch checkpoint.
+func turnDigest(turn *types.TurnResult) string {
+	sum := sha256.Sum256([]byte(turn.Text))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkpointLine is one line of a batch checkpoint.
+type checkpointLine struct {
+	Index  int    `json:"index"`
+	Digest string `json:"digest"`
+}
+
+// openCheckpoint opens the checkpoint file of a batch of n prompts for
+// appending. When resuming, it returns the digests of the prompts the file
+// records by index and drops a final line left incomplete by a crash, so
+// that new lines start on a line of their own.
+func openCheckpoint(path string, resume bool, n int) (map[int]string, *os.File, error) {
+	if !resume {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create checkpoint: %w", err)
+		}
+		return nil, f, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	done, size, err := readCheckpoint(f, n)
+	if err == nil {
+		// Cut off a partial final line and append after the last whole one
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return done, f, nil
+}
+
+// readCheckpoint reads the lines of a checkpoint of n prompts, returning the
+// recorded digests by index and the size of the valid lines. The last line
+// may be incomplete, without a newline or cut inside its JSON, and is then
+// left out; any other invalid line is an error.
+func readCheckpoint(r io.Reader, n int) (map[int]string, int64, error) {
+	done := make(map[int]string)
+	var size int64
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without its newline was being written when the batch stopped
+			return done, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var line checkpointLine
+		if jsonErr := json.Unmarshal(bytes.TrimSpace(data), &line); jsonErr != nil || line.Digest == "" {
+			if _, err := reader.Peek(1); err == io.EOF {
+				return done, size, nil
+			}
+			return nil, 0, fmt.Errorf("line %d is invalid: %q", lineNum, data)
+		}
+		if line.Index < 0 || line.Index >= n {
+			return nil, 0, fmt.Errorf("line %d records prompt %d of a batch of %d", lineNum, line.Index, n)
+		}
+		done[line.Index] = line.Digest
+		size += int64(len(data))
+	}
+}
+
+// openStoreCheckpoint opens the checkpoint of a batch of n prompts kept in
+// store under name. When resuming, it returns the digests of the prompts
+// recorded by index; otherwise it deletes the entries of an earlier run.
+func openStoreCheckpoint(ctx context.Context, store storage.Store, name string, resume bool, n int) (map[int]string, error) {
+	prefix := name + "/"
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+
+	done := make(map[int]string)
+	for _, key := range keys {
+		if !resume {
+			if err := store.Delete(ctx, key); err != nil {
+				return nil, fmt.Errorf("failed to create checkpoint: %w", err)
+			}
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(key, prefix))
+		if err != nil || index < 0 || index >= n {
+			return nil, fmt.Errorf("checkpoint %s: entry %q is not a prompt of a batch of %d", name, key, n)
+		}
+		digest, err := store.Get(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %s: %w", name, err)
+		}
+		done[index] = string(digest)
+	}
+	return done, nil
+}
+
+// putCheckpoint records a completed prompt in the checkpoint kept in store
+// under name.
+func putCheckpoint(ctx context.Context, store storage.Store, name string, item BatchItem) error {
+	key := name + "/" + strconv.Itoa(item.Index)
+	if err := store.Put(ctx, key, []byte(item.Digest), 0); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// appendCheckpoint records a completed prompt, syncing the file so that the
+// record survives a crash.
+func appendCheckpoint(f *os.File, item BatchItem) error {
+	data, err := json.Marshal(checkpointLine{Index: item.Index, Digest: item.Digest})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
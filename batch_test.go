@@ -0,0 +1,308 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/storage"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// receivedPrompts counts the prompts mock CLI cli has received across runs.
+func receivedPrompts(cli *mockcli.CLI) int {
+	n := 0
+	for _, line := range cli.Received() {
+		if strings.Contains(line, `"type":"user"`) {
+			n++
+		}
+	}
+	return n
+}
+
+// loadCheckpoint reads a batch checkpoint of n prompts.
+func loadCheckpoint(t *testing.T, path string, n int) map[int]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	done, _, err := readCheckpoint(f, n)
+	if err != nil {
+		t.Fatalf("readCheckpoint failed: %v", err)
+	}
+	return done
+}
+
+// TestQueryBatch_ResumeAfterCancel tests that a batch stopped part way, with
+// its checkpoint's last line cut short, resumes with the prompts not yet done.
+func TestQueryBatch_ResumeAfterCancel(t *testing.T) {
+	cli := echoCLI(t, "")
+	prompts := []string{"one", "two", "three", "four", "five"}
+	checkpoint := filepath.Join(t.TempDir(), "batch.checkpoint")
+	opts := &BatchOptions{
+		Options:    types.NewClaudeAgentOptions().WithCLIPath(cli.Path),
+		Checkpoint: checkpoint,
+	}
+
+	// The first run stops once two prompts are done, as a crash would
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts.OnItem = func(item BatchItem) {
+		if item.Index == 1 {
+			cancel()
+		}
+	}
+	items, err := QueryBatch(ctx, prompts, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("QueryBatch error = %v, want context.Canceled", err)
+	}
+	if !items[0].Completed() || !items[1].Completed() || items[2].Completed() {
+		t.Fatalf("completed = %v %v %v, want only the first two", items[0].Completed(), items[1].Completed(), items[2].Completed())
+	}
+	if done := loadCheckpoint(t, checkpoint, len(prompts)); len(done) != 2 || done[0] != items[0].Digest || done[1] != items[1].Digest {
+		t.Fatalf("checkpoint = %v, want prompts 0 and 1", done)
+	}
+	runs := receivedPrompts(cli)
+
+	// The crash cut the next record short
+	f, err := os.OpenFile(checkpoint, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"index":2,"dig`)
+	f.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var seen []int
+	opts.Resume = true
+	opts.OnItem = func(item BatchItem) { seen = append(seen, item.Index) }
+	items, err = QueryBatch(ctx, prompts, opts)
+	if err != nil {
+		t.Fatalf("resumed QueryBatch failed: %v", err)
+	}
+
+	want := turnDigest(&types.TurnResult{Text: "ok"})
+	for i, item := range items {
+		if !item.Completed() || item.Digest != want {
+			t.Errorf("item %d = %+v, want completed with digest %s", i, item, want)
+		}
+		if skipped := i < 2; item.Skipped != skipped || (item.Turn == nil) != skipped {
+			t.Errorf("item %d skipped = %v with turn %v", i, item.Skipped, item.Turn)
+		}
+	}
+	if len(seen) != len(prompts) {
+		t.Errorf("OnItem saw %v, want every prompt", seen)
+	}
+	if got := receivedPrompts(cli) - runs; got != 3 {
+		t.Errorf("resumed batch sent %d prompts, want 3", got)
+	}
+
+	data, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"); len(lines) != 5 {
+		t.Errorf("checkpoint =\n%s\nwant 5 whole lines", data)
+	}
+	if done := loadCheckpoint(t, checkpoint, len(prompts)); len(done) != 5 {
+		t.Errorf("checkpoint records %v, want every prompt", done)
+	}
+}
+
+// TestQueryBatch_CheckpointStore tests that a batch stopped part way resumes
+// from a checkpoint kept in a store, and that a new run starts afresh.
+func TestQueryBatch_CheckpointStore(t *testing.T) {
+	for name, store := range cacheStores(t) {
+		t.Run(name, func(t *testing.T) {
+			cli := echoCLI(t, "")
+			prompts := []string{"one", "two", "three", "four"}
+			opts := &BatchOptions{
+				Options:         types.NewClaudeAgentOptions().WithCLIPath(cli.Path),
+				Checkpoint:      "batches/nightly",
+				CheckpointStore: store,
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			opts.OnItem = func(item BatchItem) {
+				if item.Index == 1 {
+					cancel()
+				}
+			}
+			if _, err := QueryBatch(ctx, prompts, opts); !errors.Is(err, context.Canceled) {
+				t.Fatalf("QueryBatch error = %v, want context.Canceled", err)
+			}
+			keys, err := store.List(context.Background(), "batches/nightly/")
+			if err != nil || !reflect.DeepEqual(keys, []string{"batches/nightly/0", "batches/nightly/1"}) {
+				t.Fatalf("checkpoint keys = %v, %v; want prompts 0 and 1", keys, err)
+			}
+			runs := receivedPrompts(cli)
+
+			ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			opts.Resume = true
+			opts.OnItem = nil
+			items, err := QueryBatch(ctx, prompts, opts)
+			if err != nil {
+				t.Fatalf("resumed QueryBatch failed: %v", err)
+			}
+			want := turnDigest(&types.TurnResult{Text: "ok"})
+			for i, item := range items {
+				if !item.Completed() || item.Digest != want || item.Skipped != (i < 2) {
+					t.Errorf("item %d = %+v, want completed with digest %s", i, item, want)
+				}
+			}
+			if got := receivedPrompts(cli) - runs; got != 2 {
+				t.Errorf("resumed batch sent %d prompts, want 2", got)
+			}
+
+			// Without Resume the recorded prompts run again
+			runs = receivedPrompts(cli)
+			opts.Resume = false
+			if _, err := QueryBatch(ctx, prompts[:1], opts); err != nil {
+				t.Fatalf("QueryBatch failed: %v", err)
+			}
+			if got := receivedPrompts(cli) - runs; got != 1 {
+				t.Errorf("new batch sent %d prompts, want 1", got)
+			}
+			if keys, _ := store.List(context.Background(), "batches/nightly/"); len(keys) != 1 {
+				t.Errorf("checkpoint keys = %v, want only the new run's", keys)
+			}
+		})
+	}
+}
+
+// TestQueryBatch_CheckpointStoreInvalid tests that a stored checkpoint with
+// an entry outside the batch fails to resume.
+func TestQueryBatch_CheckpointStoreInvalid(t *testing.T) {
+	store := storage.NewMemoryStore()
+	if err := store.Put(context.Background(), "batch/7", []byte("digest"), 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err := QueryBatch(context.Background(), []string{"one"}, &BatchOptions{
+		Checkpoint:      "batch",
+		CheckpointStore: store,
+		Resume:          true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "not a prompt") {
+		t.Errorf("QueryBatch error = %v, want an invalid checkpoint", err)
+	}
+}
+
+// TestQueryBatch_Retry tests that a failed prompt is retried up to the
+// policy's limit, and that the batch goes on past a prompt that fails.
+func TestQueryBatch_Retry(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		wantFirst   bool // whether the first prompt completes
+		wantRuns    int
+	}{
+		{"retried", 2, true, 3},
+		{"no retries", 1, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// The CLI fails to start once, then answers every prompt
+			cli := mockcli.New(t, mockcli.Scenario{FailRuns: 1, EachPrompt: echoAnswer})
+			checkpoint := filepath.Join(t.TempDir(), "batch.checkpoint")
+			items, err := QueryBatch(ctx, []string{"one", "two"}, &BatchOptions{
+				Options:    types.NewClaudeAgentOptions().WithCLIPath(cli.Path),
+				Checkpoint: checkpoint,
+				Retry:      BatchRetryPolicy{MaxAttempts: tt.maxAttempts, Backoff: 10 * time.Millisecond},
+			})
+			if err != nil {
+				t.Fatalf("QueryBatch failed: %v", err)
+			}
+
+			first := items[0]
+			if first.Completed() != tt.wantFirst || first.Attempts != tt.maxAttempts {
+				t.Errorf("first item = completed %v after %d attempts (%v)", first.Completed(), first.Attempts, first.Err)
+			}
+			if !tt.wantFirst && first.Err == nil {
+				t.Error("failed item has no error")
+			}
+			if !items[1].Completed() || items[1].Attempts != 1 {
+				t.Errorf("second item = %+v, want completed at once", items[1])
+			}
+			if got := cli.Runs(); got != tt.wantRuns {
+				t.Errorf("CLI ran %d times, want %d", got, tt.wantRuns)
+			}
+
+			done := loadCheckpoint(t, checkpoint, 2)
+			if _, ok := done[0]; ok != tt.wantFirst || done[1] == "" {
+				t.Errorf("checkpoint = %v, want the completed prompts", done)
+			}
+		})
+	}
+}
+
+// TestQueryBatch_AttemptTimeout tests that an attempt that hangs is given up
+// and retried while the batch's context is still live.
+func TestQueryBatch_AttemptTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{mockcli.AwaitPrompt(), mockcli.Hang()}})
+	items, err := QueryBatch(ctx, []string{"one"}, &BatchOptions{
+		Options: types.NewClaudeAgentOptions().WithCLIPath(cli.Path),
+		Retry:   BatchRetryPolicy{MaxAttempts: 2, AttemptTimeout: 200 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("QueryBatch failed: %v", err)
+	}
+	if item := items[0]; item.Completed() || item.Attempts != 2 || !errors.Is(item.Err, context.DeadlineExceeded) {
+		t.Errorf("item = completed %v after %d attempts (%v), want 2 timed out attempts", item.Completed(), item.Attempts, item.Err)
+	}
+}
+
+func TestReadCheckpoint(t *testing.T) {
+	const (
+		line0 = `{"index":0,"digest":"aa"}` + "\n"
+		line1 = `{"index":1,"digest":"bb"}` + "\n"
+	)
+	tests := []struct {
+		name     string
+		data     string
+		wantDone int
+		wantSize int
+		wantErr  string
+	}{
+		{"empty", "", 0, 0, ""},
+		{"whole lines", line0 + line1, 2, len(line0 + line1), ""},
+		{"final line without newline", line0 + `{"index":1,"digest":"bb"}`, 1, len(line0), ""},
+		{"final line cut inside", line0 + `{"index":1,"di`, 1, len(line0), ""},
+		{"final line invalid", line0 + "{\"index\":1\n", 1, len(line0), ""},
+		{"invalid line before others", "{\"index\":1\n" + line1, 0, 0, "line 1 is invalid"},
+		{"index out of range", `{"index":7,"digest":"aa"}` + "\n", 0, 0, "prompt 7 of a batch of 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done, size, err := readCheckpoint(strings.NewReader(tt.data), 3)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readCheckpoint error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readCheckpoint failed: %v", err)
+			}
+			if len(done) != tt.wantDone || size != int64(tt.wantSize) {
+				t.Errorf("readCheckpoint = %v, size %d; want %d prompts, size %d", done, size, tt.wantDone, tt.wantSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package claude
+
+import (
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// costBudget tracks session cost against the limit set with WithMaxCostUSD.
+//
+// The CLI reports TotalCostUSD as the running total for its session, but only
+// in the ResultMessage that ends a turn. While a turn runs, the cost of each
+// AssistantMessage's usage is estimated with types.EstimateCostUSD and added
+// to the last reported total, so that a turn running over the limit is
+// stopped before it ends. The messages of one API response repeat its usage
+// under the same MessageID, so each response counts once, at its latest
+// usage. The highest total, reported or estimated, is the amount spent.
+// Results without a cost and messages of unpriced models are ignored.
+type costBudget struct {
+	limit    float64
+	spent    float64
+	reported float64            // TotalCostUSD of the last result
+	turn     map[string]float64 // Estimated cost of this turn's responses, by message ID
+	unnamed  float64            // Estimated cost of this turn's responses without an ID
+	exceeded bool
+}
+
+// newCostBudget returns a budget for the options, or nil if no limit is set.
+func newCostBudget(options *types.ClaudeAgentOptions) *costBudget {
+	if options == nil || options.MaxCostUSD == nil {
+		return nil
+	}
+	return &costBudget{limit: *options.MaxCostUSD}
+}
+
+// observe records the cost of a message and reports whether it pushed the
+// session over the limit. It returns false once the budget was already
+// exceeded so callers act on the crossing only once.
+func (b *costBudget) observe(msg types.Message) bool {
+	if b == nil {
+		return false
+	}
+
+	switch m := msg.(type) {
+	case *types.AssistantMessage:
+		cost, ok := types.EstimateCostUSD(m.Model, m.Usage)
+		if !ok {
+			return false
+		}
+		if m.MessageID == "" {
+			b.unnamed += cost
+		} else {
+			if b.turn == nil {
+				b.turn = make(map[string]float64)
+			}
+			b.turn[m.MessageID] = cost
+		}
+		estimate := b.reported + b.unnamed
+		for _, c := range b.turn {
+			estimate += c
+		}
+		b.spend(estimate)
+	case *types.ResultMessage:
+		if m == nil || m.TotalCostUSD == nil {
+			return false
+		}
+		if *m.TotalCostUSD > b.reported {
+			b.reported = *m.TotalCostUSD
+		}
+		b.turn, b.unnamed = nil, 0
+		b.spend(b.reported)
+	default:
+		return false
+	}
+
+	if b.exceeded || b.spent <= b.limit {
+		return false
+	}
+	b.exceeded = true
+	return true
+}
+
+// spend raises the amount spent to total if it is higher.
+func (b *costBudget) spend(total float64) {
+	if total > b.spent {
+		b.spent = total
+	}
+}
+
+// err returns a BudgetExceededError if the budget was exceeded, or nil.
+func (b *costBudget) err() error {
+	if b == nil || !b.exceeded {
+		return nil
+	}
+	return types.NewBudgetExceededError(b.limit, b.spent)
+}
+
+// message returns the SystemMessage emitted when the budget is exceeded.
+func (b *costBudget) message() *types.SystemMessage {
+	return &types.SystemMessage{
+		Type:    types.MessageTypeSystem,
+		Subtype: "budget_exceeded",
+		Data: map[string]interface{}{
+			"limit_usd": b.limit,
+			"spent_usd": b.spent,
+		},
+		Err: b.err(),
+	}
+}
@@ -0,0 +1,267 @@
+package claude
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func resultWithCost(cost *float64) *types.ResultMessage {
+	return &types.ResultMessage{Type: "result", Subtype: "success", TotalCostUSD: cost}
+}
+
+func costPtr(v float64) *float64 {
+	return &v
+}
+
+func TestCostBudget_NoLimit(t *testing.T) {
+	budget := newCostBudget(types.NewClaudeAgentOptions())
+	if budget != nil {
+		t.Fatalf("expected nil budget without a limit, got %+v", budget)
+	}
+	if budget.observe(resultWithCost(costPtr(100))) {
+		t.Error("nil budget should never be exceeded")
+	}
+	if budget.err() != nil {
+		t.Error("nil budget should not return an error")
+	}
+}
+
+func TestCostBudget_Observe(t *testing.T) {
+	tests := []struct {
+		name         string
+		limit        float64
+		costs        []*float64
+		wantCrossing int // index of the result that crosses the limit, -1 for none
+	}{
+		{
+			name:         "nil cost ignored",
+			limit:        0.10,
+			costs:        []*float64{nil, nil},
+			wantCrossing: -1,
+		},
+		{
+			name:         "exactly at limit",
+			limit:        0.10,
+			costs:        []*float64{costPtr(0.05), costPtr(0.10)},
+			wantCrossing: -1,
+		},
+		{
+			name:         "multiple turns",
+			limit:        1.00,
+			costs:        []*float64{costPtr(0.30), nil, costPtr(0.60), costPtr(1.10), costPtr(1.50)},
+			wantCrossing: 3,
+		},
+		{
+			name:         "first turn over limit",
+			limit:        0.01,
+			costs:        []*float64{costPtr(0.02)},
+			wantCrossing: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := newCostBudget(types.NewClaudeAgentOptions().WithMaxCostUSD(tt.limit))
+
+			crossing := -1
+			for i, cost := range tt.costs {
+				if budget.observe(resultWithCost(cost)) {
+					if crossing != -1 {
+						t.Fatalf("budget crossed twice (at %d and %d)", crossing, i)
+					}
+					crossing = i
+				}
+			}
+
+			if crossing != tt.wantCrossing {
+				t.Errorf("crossing at %d, want %d", crossing, tt.wantCrossing)
+			}
+
+			err := budget.err()
+			if tt.wantCrossing == -1 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !types.IsBudgetExceededError(err) {
+				t.Fatalf("expected BudgetExceededError, got %v", err)
+			}
+			if be := err.(*types.BudgetExceededError); be.LimitUSD != tt.limit {
+				t.Errorf("LimitUSD = %v, want %v", be.LimitUSD, tt.limit)
+			}
+		})
+	}
+}
+
+func TestClient_BudgetExceeded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cliPath := writeScriptedCLI(t,
+		`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Done"}]}}`,
+		`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":1,"session_id":"s1","total_cost_usd":0.06}`,
+	)
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cliPath).WithMaxCostUSD(0.05)
+
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if err := client.Query(ctx, "expensive task"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	var msgs []types.Message
+	for msg := range client.ReceiveResponse(ctx) {
+		msgs = append(msgs, msg)
+	}
+
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages, got %d: %v", len(msgs), msgs)
+	}
+	if _, ok := msgs[1].(*types.ResultMessage); !ok {
+		t.Errorf("expected result message before budget notice, got %T", msgs[1])
+	}
+	notice, ok := msgs[2].(*types.SystemMessage)
+	if !ok || notice.Subtype != "budget_exceeded" {
+		t.Fatalf("expected budget_exceeded system message, got %+v", msgs[2])
+	}
+	if notice.Data["spent_usd"] != 0.06 || notice.Data["limit_usd"] != 0.05 {
+		t.Errorf("unexpected notice data: %v", notice.Data)
+	}
+
+	err = client.Query(ctx, "one more")
+	if !types.IsBudgetExceededError(err) {
+		t.Errorf("expected BudgetExceededError after exceeding budget, got %v", err)
+	}
+}
+
+func assistantWithUsage(id string, input, output int) *types.AssistantMessage {
+	return &types.AssistantMessage{
+		Type:      "assistant",
+		Model:     "claude-sonnet-4-5",
+		MessageID: id,
+		Usage:     &types.Usage{InputTokens: input, OutputTokens: output},
+	}
+}
+
+func TestCostBudget_ObserveAssistantUsage(t *testing.T) {
+	// claude-sonnet-4-5 costs $3 per million input tokens and $15 per million output
+	budget := newCostBudget(types.NewClaudeAgentOptions().WithMaxCostUSD(0.50))
+
+	if budget.observe(resultWithCost(costPtr(0.20))) {
+		t.Fatal("crossed at 0.20")
+	}
+	// One response repeated per content block counts once, at its latest usage
+	for _, output := range []int{1000, 10000} {
+		if budget.observe(assistantWithUsage("msg_1", 10000, output)) {
+			t.Fatalf("crossed at %d output tokens of msg_1", output)
+		}
+	}
+	if want := 0.20 + 0.03 + 0.15; math.Abs(budget.spent-want) > 1e-9 {
+		t.Errorf("spent = %v, want %v", budget.spent, want)
+	}
+	if !budget.observe(assistantWithUsage("msg_2", 0, 10000)) {
+		t.Fatal("estimate over the limit did not cross it")
+	}
+	if !types.IsBudgetExceededError(budget.err()) {
+		t.Errorf("err() = %v, want BudgetExceededError", budget.err())
+	}
+
+	// Unpriced models are ignored
+	unpriced := newCostBudget(types.NewClaudeAgentOptions().WithMaxCostUSD(0.01))
+	msg := assistantWithUsage("msg_1", 1e6, 1e6)
+	msg.Model = "some-other-model"
+	if unpriced.observe(msg) || unpriced.spent != 0 {
+		t.Errorf("unpriced model counted: spent = %v", unpriced.spent)
+	}
+}
+
+func TestCostBudget_ResultReplacesEstimate(t *testing.T) {
+	budget := newCostBudget(types.NewClaudeAgentOptions().WithMaxCostUSD(1.00))
+
+	budget.observe(assistantWithUsage("msg_1", 0, 20000)) // Estimated at 0.30
+	budget.observe(resultWithCost(costPtr(0.25)))
+	// The next turn's estimate builds on the reported total, not on the estimate
+	budget.observe(assistantWithUsage("msg_2", 0, 20000))
+	if want := 0.55; math.Abs(budget.spent-want) > 1e-9 {
+		t.Errorf("spent = %v, want %v", budget.spent, want)
+	}
+}
+
+// expensiveTurn is an assistant message whose usage is estimated at $0.33.
+const expensiveTurn = `{"type":"assistant","message":{"id":"msg_1","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Working"}],"usage":{"input_tokens":10000,"output_tokens":20000}}}`
+
+// budgetCLI returns a mock CLI whose turn runs over a $0.10 budget and ends
+// only once the SDK interrupts it.
+func budgetCLI(t *testing.T) *mockcli.CLI {
+	t.Helper()
+	return mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(expensiveTurn),
+		mockcli.AwaitRequest("interrupt"),
+		mockcli.Send(`{"type":"result","subtype":"error_during_execution","duration_ms":10,"duration_api_ms":8,"is_error":true,"num_turns":1,"session_id":"s1","total_cost_usd":0.33}`),
+	}})
+}
+
+// assertInterruptedMidTurn checks that the budget notice follows the
+// assistant message and comes before the result.
+func assertInterruptedMidTurn(t *testing.T, msgs []types.Message) {
+	t.Helper()
+	if got := describeMessages(msgs); got != "assistant,system:budget_exceeded,result" {
+		t.Fatalf("got %s, want the notice between the assistant message and the result", got)
+	}
+	notice := msgs[1].(*types.SystemMessage)
+	if !types.IsBudgetExceededError(notice.Err) {
+		t.Errorf("notice Err = %v, want BudgetExceededError", notice.Err)
+	}
+}
+
+func TestClient_BudgetInterruptsTurn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := budgetCLI(t)
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithMaxCostUSD(0.10))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "expensive task"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	// The CLI sends the result only after the interrupt
+	assertInterruptedMidTurn(t, collect(t, ctx, client.ReceiveResponse(ctx)))
+	if err := client.Query(ctx, "one more"); !types.IsBudgetExceededError(err) {
+		t.Errorf("Query after the budget = %v, want BudgetExceededError", err)
+	}
+}
+
+func TestQuery_BudgetInterruptsTurn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := budgetCLI(t)
+	messages, err := Query(ctx, "expensive task", types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithMaxCostUSD(0.10))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	assertInterruptedMidTurn(t, collect(t, ctx, messages))
+}
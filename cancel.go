@@ -0,0 +1,60 @@
+package claude
+
+import (
+	"context"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// cancelTimeout returns the timeout configured with WithCancelTimeout, or 0
+// when a cancelled Query kills the CLI at once.
+func cancelTimeout(options *types.ClaudeAgentOptions) time.Duration {
+	if options.CancelTimeout == nil {
+		return types.DefaultCancelTimeout
+	}
+	if *options.CancelTimeout <= 0 {
+		return 0
+	}
+	return *options.CancelTimeout
+}
+
+// interruptCancelled interrupts the turn of a Query whose context was
+// cancelled and waits up to timeout for its ResultMessage, passing every
+// message read from messages to record. It reports whether the turn ended,
+// in which case the CLI can be left to exit rather than killed.
+func interruptCancelled(queryHandler *internal.Query, messages <-chan types.Message, timeout time.Duration, record func(types.Message)) bool {
+	if timeout <= 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Keep reading while the interrupt is acknowledged, so that messages
+	// already in flight cannot hold up its response
+	interrupted := make(chan error, 1)
+	go func() {
+		interrupted <- queryHandler.Interrupt(ctx)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case err := <-interrupted:
+			if err != nil {
+				return false
+			}
+			interrupted = nil
+		case msg, ok := <-messages:
+			if !ok {
+				return false
+			}
+			record(msg)
+			if _, isResult := msg.(*types.ResultMessage); isResult {
+				return true
+			}
+		}
+	}
+}
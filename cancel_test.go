@@ -0,0 +1,112 @@
+package claude
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// cancelMidTurn runs a Query with a permission callback, so that it uses the
+// control protocol, against a CLI playing steps, and cancels its context
+// once the first message has arrived. It returns the CLI and the transport,
+// whose process has exited once the Query's channel has closed.
+func cancelMidTurn(t *testing.T, opts *types.ClaudeAgentOptions, steps ...mockcli.Step) (*mockcli.CLI, *transport.SubprocessCLITransport) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: steps})
+	opts = opts.
+		WithCLIPath(cli.Path).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return &types.PermissionResultAllow{}, nil
+		})
+	transportInst, err := newSubprocessTransport(opts.Clone())
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := QueryWithTransport(ctx, "count to a million", opts, transportInst)
+	if err != nil {
+		t.Fatalf("QueryWithTransport failed: %v", err)
+	}
+
+	select {
+	case <-messages:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no message before cancelling")
+	}
+	cancel()
+
+	closed := time.After(10 * time.Second)
+	for {
+		select {
+		case _, ok := <-messages:
+			if !ok {
+				return cli, transportInst
+			}
+		case <-closed:
+			t.Fatal("channel did not close after cancelling")
+		}
+	}
+}
+
+func TestQuery_CancelInterruptsTurn(t *testing.T) {
+	cli, transportInst := cancelMidTurn(t, types.NewClaudeAgentOptions(),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(streamAssistant),
+		mockcli.AwaitRequest("interrupt"),
+		mockcli.Send(streamResult),
+	)
+
+	// The CLI ended the turn and exited on its own
+	if state := transportInst.ProcessState(); state.Status != types.ProcessExited || state.ExitCode != 0 {
+		t.Errorf("process state = %+v, want exited with status 0", state)
+	}
+	var interrupted bool
+	for _, line := range cli.Received() {
+		interrupted = interrupted || strings.Contains(line, `"subtype":"interrupt"`)
+	}
+	if !interrupted {
+		t.Errorf("CLI received %q, want an interrupt request", cli.Received())
+	}
+}
+
+func TestQuery_CancelKillsUnresponsiveCLI(t *testing.T) {
+	start := time.Now()
+	_, transportInst := cancelMidTurn(t, types.NewClaudeAgentOptions().WithCancelTimeout(200*time.Millisecond),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(streamAssistant),
+		mockcli.Hang(),
+	)
+
+	// The interrupt is acknowledged but no result follows
+	if state := transportInst.ProcessState(); state.Status != types.ProcessExited || state.ExitCode == 0 {
+		t.Errorf("process state = %+v, want killed", state)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancelled Query took %v, want the CLI killed after the cancel timeout", elapsed)
+	}
+}
+
+func TestQuery_CancelTimeoutDisabled(t *testing.T) {
+	cli, transportInst := cancelMidTurn(t, types.NewClaudeAgentOptions().WithCancelTimeout(0),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(streamAssistant),
+		mockcli.AwaitRequest("interrupt"),
+		mockcli.Send(streamResult),
+	)
+
+	if state := transportInst.ProcessState(); state.Status != types.ProcessExited || state.ExitCode == 0 {
+		t.Errorf("process state = %+v, want killed at once", state)
+	}
+	for _, line := range cli.Received() {
+		if strings.Contains(line, `"subtype":"interrupt"`) {
+			t.Errorf("CLI received %s, want no interrupt", line)
+		}
+	}
+}
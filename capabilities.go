@@ -0,0 +1,56 @@
+package claude
+
+import (
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// parseCapabilities extracts the capabilities from an initialize response,
+// or nil if the CLI reported none or they cannot be decoded.
+func parseCapabilities(initResult map[string]interface{}) *types.Capabilities {
+	if initResult == nil {
+		return nil
+	}
+	info, err := types.ParseServerInfo(initResult)
+	if err != nil {
+		return nil
+	}
+	return info.Capabilities
+}
+
+// checkOptionCapabilities reports the first configured option that needs a
+// capability the CLI lacks.
+func checkOptionCapabilities(caps *types.Capabilities, options *types.ClaudeAgentOptions) error {
+	if options.IncludePartialMessages {
+		if err := caps.Require("WithIncludePartialMessages", types.CapabilityPartialMessages); err != nil {
+			return err
+		}
+	}
+	if hasSdkMcpServers(options.McpServers) {
+		if err := caps.Require("SDK MCP servers", types.CapabilityMcpSdkServers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasSdkMcpServers reports whether servers configures an in-process ("sdk")
+// MCP server.
+func hasSdkMcpServers(servers interface{}) bool {
+	configs, ok := servers.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, config := range configs {
+		switch c := config.(type) {
+		case types.McpSdkServerConfig:
+			return true
+		case *types.McpSdkServerConfig:
+			return c != nil
+		case map[string]interface{}:
+			if c["type"] == "sdk" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// capabilitiesInit builds an initialize response reporting the given
+// capabilities; with none it omits the capabilities object entirely.
+func capabilitiesInit(caps ...types.Capability) string {
+	if caps == nil {
+		return `{"output_style":"default"}`
+	}
+	fields := []string{`"protocolVersion":"2"`}
+	for _, c := range caps {
+		fields = append(fields, `"`+string(c)+`":true`)
+	}
+	return `{"output_style":"default","capabilities":{` + strings.Join(fields, ",") + `}}`
+}
+
+func assertUnsupportedFeature(t *testing.T, err error, capability types.Capability) {
+	t.Helper()
+
+	var ufe *types.UnsupportedFeatureError
+	if !errors.As(err, &ufe) {
+		t.Fatalf("expected UnsupportedFeatureError, got %T: %v", err, err)
+	}
+	if ufe.Capability != capability || !strings.Contains(err.Error(), string(capability)) {
+		t.Errorf("error names %q, want %q: %v", ufe.Capability, capability, err)
+	}
+}
+
+func TestClient_CapabilityGatedMethods(t *testing.T) {
+	methods := []struct {
+		name       string
+		capability types.Capability
+		call       func(ctx context.Context, c *Client) error
+	}{
+		{"Interrupt", types.CapabilityInterrupt, func(ctx context.Context, c *Client) error {
+			return c.Interrupt(ctx)
+		}},
+		{"SetPermissionMode", types.CapabilitySetPermissionMode, func(ctx context.Context, c *Client) error {
+			return c.SetPermissionMode(ctx, types.PermissionModeAcceptEdits)
+		}},
+		{"SetModel", types.CapabilitySetModel, func(ctx context.Context, c *Client) error {
+			return c.SetModel(ctx, "claude-opus-4-1")
+		}},
+	}
+
+	for _, m := range methods {
+		t.Run(m.name, func(t *testing.T) {
+			cases := []struct {
+				name        string
+				init        string
+				unsupported bool
+			}{
+				{"enabled", capabilitiesInit(m.capability), false},
+				{"disabled", capabilitiesInit(types.CapabilityPartialMessages), true},
+				{"not reported", capabilitiesInit(), false},
+			}
+
+			for _, tc := range cases {
+				t.Run(tc.name, func(t *testing.T) {
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+
+					client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(writeEchoCLIWithInit(t, tc.init)))
+					if err != nil {
+						t.Fatalf("NewClient failed: %v", err)
+					}
+					defer client.Close(context.Background())
+					if err := client.Connect(ctx); err != nil {
+						t.Fatalf("Connect failed: %v", err)
+					}
+
+					// A missing capability fails immediately rather than at the deadline
+					callCtx, callCancel := context.WithTimeout(ctx, 2*time.Second)
+					defer callCancel()
+					err = m.call(callCtx, client)
+					if tc.unsupported {
+						assertUnsupportedFeature(t, err, m.capability)
+					} else if err != nil {
+						t.Errorf("%s failed: %v", m.name, err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestClient_CapabilityGatedOptions(t *testing.T) {
+	options := []struct {
+		name       string
+		capability types.Capability
+		configure  func(*types.ClaudeAgentOptions)
+	}{
+		{"partial messages", types.CapabilityPartialMessages, func(o *types.ClaudeAgentOptions) {
+			o.WithIncludePartialMessages(true)
+		}},
+		{"sdk mcp servers", types.CapabilityMcpSdkServers, func(o *types.ClaudeAgentOptions) {
+			o.WithMcpServers(map[string]interface{}{
+				"calc": types.McpSdkServerConfig{Type: "sdk", Name: "calc"},
+			})
+		}},
+	}
+
+	for _, opt := range options {
+		t.Run(opt.name, func(t *testing.T) {
+			cases := []struct {
+				name        string
+				init        string
+				unsupported bool
+			}{
+				{"enabled", capabilitiesInit(opt.capability), false},
+				{"disabled", capabilitiesInit(types.CapabilityInterrupt), true},
+				{"not reported", capabilitiesInit(), false},
+			}
+
+			for _, tc := range cases {
+				t.Run(tc.name, func(t *testing.T) {
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+
+					o := types.NewClaudeAgentOptions().WithCLIPath(writeEchoCLIWithInit(t, tc.init))
+					opt.configure(o)
+					client, err := NewClient(ctx, o)
+					if err != nil {
+						t.Fatalf("NewClient failed: %v", err)
+					}
+					defer client.Close(context.Background())
+
+					err = client.Connect(ctx)
+					if !tc.unsupported {
+						if err != nil {
+							t.Errorf("Connect failed: %v", err)
+						}
+						return
+					}
+					assertUnsupportedFeature(t, err, opt.capability)
+					if client.IsConnected() {
+						t.Error("client connected despite unsupported option")
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestClient_GetServerInfoCapabilities(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	init := `{"capabilities":{"protocolVersion":"2","supportsInterrupt":true,"supportsFutureThing":true}}`
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(writeEchoCLIWithInit(t, init)))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	info, err := client.GetServerInfo()
+	if err != nil {
+		t.Fatalf("GetServerInfo failed: %v", err)
+	}
+	caps := info.Capabilities
+	if caps == nil || caps.ProtocolVersion != "2" || !caps.SupportsInterrupt || caps.SupportsSetPermissionMode {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+	if !caps.Supports("supportsFutureThing") {
+		t.Error("unknown capability flag not kept")
+	}
+}
@@ -0,0 +1,239 @@
+package claude
+
+import (
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ChangeSummary is the net effect of one turn's file-editing tool calls on a
+// single file, as computed by TurnChanges.
+type ChangeSummary struct {
+	// Path is the file_path the tools were given.
+	Path string
+
+	// Tool is the tool that made the file's first change in the turn:
+	// "Write", "Edit" or "MultiEdit".
+	Tool string
+
+	// LinesAdded and LinesRemoved count changed lines, summed over every
+	// change to the file in the turn.
+	LinesAdded   int
+	LinesRemoved int
+
+	// Created reports whether the turn created the file: its first change was
+	// a Write the CLI reported as creating a new file.
+	Created bool
+}
+
+// maxDiffCells bounds the work of one line diff. Larger inputs are counted as
+// replacing every line that is not part of a common prefix or suffix.
+const maxDiffCells = 1 << 20
+
+// TurnChanges summarizes the files changed by the Write, Edit and MultiEdit
+// tool calls in messages, the messages of one turn as received from
+// ReceiveResponse, without reading the files. Summaries are in the order each
+// file was first changed, with every change to a file aggregated into one.
+//
+// A tool call counts only once its tool result arrives without an error;
+// calls that were denied by the permission system, failed, or never
+// completed are excluded. Files moved or deleted by other tools, such as mv
+// through Bash, are not tracked.
+//
+// Line counts come from a line diff of each edit's old_string and new_string,
+// and from counting the lines of each Write. Once the turn has written a file,
+// later changes to it are diffed against the content the turn produced;
+// until then a Write counts every line as added, since the content it
+// replaced is unknown, and a replace_all edit counts as one replacement.
+//
+// Example:
+//
+//	var turn []types.Message
+//	for msg := range client.ReceiveResponse(ctx) {
+//	    turn = append(turn, msg)
+//	}
+//	for _, c := range claude.TurnChanges(turn) {
+//	    fmt.Printf("%s +%d -%d\n", c.Path, c.LinesAdded, c.LinesRemoved)
+//	}
+func TurnChanges(messages []types.Message) []ChangeSummary {
+	var calls []*types.ToolUseBlock
+	results := make(map[string]*types.ToolResultBlock)
+	denied := make(map[string]bool)
+
+	for _, msg := range messages {
+		switch m := msg.(type) {
+		case *types.AssistantMessage:
+			for _, block := range m.Content {
+				if tu, ok := block.(*types.ToolUseBlock); ok && isFileEditTool(tu.Name) {
+					calls = append(calls, tu)
+				}
+			}
+		case *types.UserMessage:
+			blocks, _ := m.Content.([]types.ContentBlock)
+			for _, block := range blocks {
+				if tr, ok := block.(*types.ToolResultBlock); ok {
+					results[tr.ToolUseID] = tr
+				}
+			}
+		case *types.ResultMessage:
+			for _, d := range m.PermissionDenials {
+				denied[d.ToolUseID] = true
+			}
+		}
+	}
+
+	var order []string
+	files := make(map[string]*fileChanges)
+	for _, call := range calls {
+		result := results[call.ID]
+		if result == nil || denied[call.ID] || (result.IsError != nil && *result.IsError) {
+			continue
+		}
+		path, ok := stringInput(call.Input, "file_path")
+		if !ok || path == "" {
+			continue
+		}
+
+		f := files[path]
+		if f == nil {
+			f = &fileChanges{summary: ChangeSummary{Path: path, Tool: call.Name}}
+			files[path] = f
+			order = append(order, path)
+		}
+
+		switch call.Name {
+		case "Write":
+			content, _ := stringInput(call.Input, "content")
+			text, _ := result.Text()
+			f.write(content, strings.HasPrefix(text, "File created successfully"))
+		case "Edit":
+			f.edit(editInput(call.Input))
+		case "MultiEdit":
+			edits, _ := call.Input["edits"].([]interface{})
+			for _, e := range edits {
+				if input, ok := e.(map[string]interface{}); ok {
+					f.edit(editInput(input))
+				}
+			}
+		}
+		f.changed = true
+	}
+
+	summaries := make([]ChangeSummary, 0, len(order))
+	for _, path := range order {
+		summaries = append(summaries, files[path].summary)
+	}
+	return summaries
+}
+
+// isFileEditTool reports whether TurnChanges tracks the named tool.
+func isFileEditTool(name string) bool {
+	return name == "Write" || name == "Edit" || name == "MultiEdit"
+}
+
+// fileChanges accumulates the changes to one file.
+type fileChanges struct {
+	summary ChangeSummary
+	changed bool // Whether a change has been applied yet
+
+	// content is the file's content as of the last change, known once the
+	// turn has written the whole file
+	content *string
+}
+
+// write applies a Write of content. created reports whether the CLI said
+// the file was new.
+func (f *fileChanges) write(content string, created bool) {
+	if !f.changed && created {
+		f.summary.Created = true
+	}
+	if f.content != nil {
+		f.count(diffLines(splitLines(*f.content), splitLines(content)))
+	} else {
+		f.summary.LinesAdded += len(splitLines(content))
+	}
+	f.content = &content
+}
+
+// edit applies one replacement of oldString with newString, or of every
+// occurrence when replaceAll is set.
+func (f *fileChanges) edit(oldString, newString string, replaceAll bool) {
+	n := 1
+	if f.content != nil {
+		switch occurrences := strings.Count(*f.content, oldString); {
+		case oldString == "" || occurrences == 0:
+			// The tracked content no longer matches what the tool edited
+			f.content = nil
+		case replaceAll:
+			n = occurrences
+			updated := strings.ReplaceAll(*f.content, oldString, newString)
+			f.content = &updated
+		default:
+			updated := strings.Replace(*f.content, oldString, newString, 1)
+			f.content = &updated
+		}
+	}
+
+	added, removed := diffLines(splitLines(oldString), splitLines(newString))
+	f.count(n*added, n*removed)
+}
+
+func (f *fileChanges) count(added, removed int) {
+	f.summary.LinesAdded += added
+	f.summary.LinesRemoved += removed
+}
+
+// editInput extracts the arguments of one Edit, or of one entry of a
+// MultiEdit's edits.
+func editInput(input map[string]interface{}) (oldString, newString string, replaceAll bool) {
+	oldString, _ = stringInput(input, "old_string")
+	newString, _ = stringInput(input, "new_string")
+	replaceAll, _ = input["replace_all"].(bool)
+	return oldString, newString, replaceAll
+}
+
+func stringInput(input map[string]interface{}, key string) (string, bool) {
+	s, ok := input[key].(string)
+	return s, ok
+}
+
+// splitLines splits s into lines. A trailing newline does not start another
+// line, and an empty string has none.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines counts the lines added and removed going from a to b, using the
+// longest common subsequence of lines.
+func diffLines(a, b []string) (added, removed int) {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	if len(a) == 0 || len(b) == 0 || len(a)*len(b) > maxDiffCells {
+		return len(b), len(a)
+	}
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				curr[j+1] = prev[j] + 1
+			case prev[j+1] >= curr[j]:
+				curr[j+1] = prev[j+1]
+			default:
+				curr[j+1] = curr[j]
+			}
+		}
+		prev, curr = curr, prev
+	}
+	common := prev[len(b)]
+	return len(b) - common, len(a) - common
+}
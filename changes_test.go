@@ -0,0 +1,226 @@
+package claude
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// changeTurn builds the messages of a turn from tool calls and their results.
+type changeTurn struct {
+	messages []types.Message
+}
+
+// call adds an assistant tool call and, unless result is "", its result.
+func (tt *changeTurn) call(id, tool string, input map[string]interface{}, result string, isError bool) *changeTurn {
+	tt.messages = append(tt.messages, &types.AssistantMessage{
+		Type:    "assistant",
+		Content: []types.ContentBlock{&types.ToolUseBlock{Type: "tool_use", ID: id, Name: tool, Input: input}},
+	})
+	if result != "" {
+		tt.messages = append(tt.messages, &types.UserMessage{
+			Type:    "user",
+			Content: []types.ContentBlock{&types.ToolResultBlock{Type: "tool_result", ToolUseID: id, Content: result, IsError: &isError}},
+		})
+	}
+	return tt
+}
+
+func (tt *changeTurn) write(id, path, content, result string) *changeTurn {
+	return tt.call(id, "Write", map[string]interface{}{"file_path": path, "content": content}, result, false)
+}
+
+func (tt *changeTurn) edit(id, path, oldString, newString string) *changeTurn {
+	return tt.call(id, "Edit", map[string]interface{}{"file_path": path, "old_string": oldString, "new_string": newString},
+		"The file "+path+" has been updated.", false)
+}
+
+func created(path string) string { return "File created successfully at: " + path }
+func updated(path string) string { return "The file " + path + " has been updated." }
+
+func TestTurnChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		turn *changeTurn
+		want []ChangeSummary
+	}{
+		{
+			name: "no edits",
+			turn: (&changeTurn{}).call("t1", "Read", map[string]interface{}{"file_path": "/a.go"}, "package a", false),
+			want: []ChangeSummary{},
+		},
+		{
+			name: "new file",
+			turn: (&changeTurn{}).write("t1", "/new.go", "package a\n\nfunc A() {}\n", created("/new.go")),
+			want: []ChangeSummary{{Path: "/new.go", Tool: "Write", LinesAdded: 3, Created: true}},
+		},
+		{
+			name: "overwrite of an existing file",
+			turn: (&changeTurn{}).write("t1", "/a.go", "one\ntwo", updated("/a.go")),
+			want: []ChangeSummary{{Path: "/a.go", Tool: "Write", LinesAdded: 2}},
+		},
+		{
+			name: "single line edit",
+			turn: (&changeTurn{}).edit("t1", "/a.go", "x := 1", "x := 2"),
+			want: []ChangeSummary{{Path: "/a.go", Tool: "Edit", LinesAdded: 1, LinesRemoved: 1}},
+		},
+		{
+			name: "edit inserting lines",
+			turn: (&changeTurn{}).edit("t1", "/a.go", "func A() {\n}", "func A() {\n\tb()\n\tc()\n}"),
+			want: []ChangeSummary{{Path: "/a.go", Tool: "Edit", LinesAdded: 2}},
+		},
+		{
+			name: "edit deleting lines",
+			turn: (&changeTurn{}).edit("t1", "/a.go", "a\nb\nc\nd", "a\nd"),
+			want: []ChangeSummary{{Path: "/a.go", Tool: "Edit", LinesRemoved: 2}},
+		},
+		{
+			name: "multiple edits to one file are aggregated",
+			turn: (&changeTurn{}).
+				edit("t1", "/a.go", "a", "a\nb").
+				edit("t2", "/b.go", "x", "y").
+				edit("t3", "/a.go", "c\nd", "e"),
+			want: []ChangeSummary{
+				{Path: "/a.go", Tool: "Edit", LinesAdded: 2, LinesRemoved: 2},
+				{Path: "/b.go", Tool: "Edit", LinesAdded: 1, LinesRemoved: 1},
+			},
+		},
+		{
+			name: "edits after a write are diffed against the written content",
+			turn: (&changeTurn{}).
+				write("t1", "/new.go", "a\nb\nc\n", created("/new.go")).
+				call("t2", "Edit", map[string]interface{}{
+					"file_path": "/new.go", "old_string": "b", "new_string": "B", "replace_all": false,
+				}, updated("/new.go"), false).
+				write("t3", "/new.go", "a\nB\nc\nd\n", updated("/new.go")),
+			want: []ChangeSummary{{Path: "/new.go", Tool: "Write", LinesAdded: 5, LinesRemoved: 1, Created: true}},
+		},
+		{
+			name: "replace_all counts each occurrence once the content is known",
+			turn: (&changeTurn{}).
+				write("t1", "/a.txt", "x\ny\nx\n", created("/a.txt")).
+				call("t2", "Edit", map[string]interface{}{
+					"file_path": "/a.txt", "old_string": "x", "new_string": "z", "replace_all": true,
+				}, updated("/a.txt"), false),
+			want: []ChangeSummary{{Path: "/a.txt", Tool: "Write", LinesAdded: 5, LinesRemoved: 2, Created: true}},
+		},
+		{
+			name: "replace_all on unknown content counts one replacement",
+			turn: (&changeTurn{}).call("t1", "Edit", map[string]interface{}{
+				"file_path": "/a.txt", "old_string": "x", "new_string": "z", "replace_all": true,
+			}, updated("/a.txt"), false),
+			want: []ChangeSummary{{Path: "/a.txt", Tool: "Edit", LinesAdded: 1, LinesRemoved: 1}},
+		},
+		{
+			name: "MultiEdit",
+			turn: (&changeTurn{}).call("t1", "MultiEdit", map[string]interface{}{
+				"file_path": "/a.go",
+				"edits": []interface{}{
+					map[string]interface{}{"old_string": "a", "new_string": "b"},
+					map[string]interface{}{"old_string": "c\nd", "new_string": "c"},
+				},
+			}, updated("/a.go"), false),
+			want: []ChangeSummary{{Path: "/a.go", Tool: "MultiEdit", LinesAdded: 1, LinesRemoved: 2}},
+		},
+		{
+			name: "failed edit is excluded",
+			turn: (&changeTurn{}).
+				call("t1", "Edit", map[string]interface{}{"file_path": "/a.go", "old_string": "a", "new_string": "b"},
+					"String to replace not found in file.", true).
+				edit("t2", "/b.go", "a", "b"),
+			want: []ChangeSummary{{Path: "/b.go", Tool: "Edit", LinesAdded: 1, LinesRemoved: 1}},
+		},
+		{
+			name: "edit without a result is excluded",
+			turn: (&changeTurn{}).call("t1", "Write", map[string]interface{}{"file_path": "/a.go", "content": "a"}, "", false),
+			want: []ChangeSummary{},
+		},
+		{
+			name: "Bash renames are not tracked",
+			turn: (&changeTurn{}).
+				write("t1", "/old.go", "a\n", created("/old.go")).
+				call("t2", "Bash", map[string]interface{}{"command": "mv /old.go /new.go"}, "(no output)", false),
+			want: []ChangeSummary{{Path: "/old.go", Tool: "Write", LinesAdded: 1, Created: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TurnChanges(tt.turn.messages)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TurnChanges() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestTurnChanges_Denied tests that tool calls listed as permission denials
+// are excluded, even when their result is not flagged as an error.
+func TestTurnChanges_Denied(t *testing.T) {
+	turn := (&changeTurn{}).
+		call("t1", "Write", map[string]interface{}{"file_path": "/secret", "content": "x"},
+			"Permission to use Write has been denied.", false).
+		edit("t2", "/a.go", "a", "b")
+	messages := append(turn.messages, &types.ResultMessage{
+		Type:              "result",
+		Subtype:           "success",
+		PermissionDenials: []types.PermissionDenial{{ToolName: "Write", ToolUseID: "t1"}},
+	})
+
+	want := []ChangeSummary{{Path: "/a.go", Tool: "Edit", LinesAdded: 1, LinesRemoved: 1}}
+	if got := TurnChanges(messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("TurnChanges() = %+v, want %+v", got, want)
+	}
+}
+
+// TestTurnChanges_Parsed tests a turn decoded from CLI output.
+func TestTurnChanges_Parsed(t *testing.T) {
+	lines := []string{
+		`{"type":"assistant","message":{"model":"m","content":[{"type":"tool_use","id":"toolu_1","name":"Edit","input":{"file_path":"/src/main.go","old_string":"fmt.Println(\"hi\")","new_string":"fmt.Println(\"hello\")\nfmt.Println(\"world\")"}}]}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"The file /src/main.go has been updated."}]}}`,
+		streamResult,
+	}
+	var messages []types.Message
+	for _, line := range lines {
+		msg, err := internal.ParseMessage([]byte(line))
+		if err != nil {
+			t.Fatalf("parse %s: %v", line, err)
+		}
+		messages = append(messages, msg)
+	}
+
+	want := []ChangeSummary{{Path: "/src/main.go", Tool: "Edit", LinesAdded: 2, LinesRemoved: 1}}
+	if got := TurnChanges(messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("TurnChanges() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b           string
+		added, removed int
+	}{
+		{"", "", 0, 0},
+		{"", "a\nb\n", 2, 0},
+		{"a\nb", "", 0, 2},
+		{"a\nb\nc", "a\nb\nc", 0, 0},
+		{"a\nb\nc", "a\nx\nc", 1, 1},
+		{"a\nb\nc\nd", "b\nd\ne", 1, 2},
+		{"a\nb", "b\na", 1, 1},
+	}
+	for _, tt := range tests {
+		added, removed := diffLines(splitLines(tt.a), splitLines(tt.b))
+		if added != tt.added || removed != tt.removed {
+			t.Errorf("diffLines(%q, %q) = +%d -%d, want +%d -%d", tt.a, tt.b, added, removed, tt.added, tt.removed)
+		}
+	}
+
+	// Inputs too large to diff count every differing line
+	big := strings.Repeat("x\n", 2000)
+	if added, removed := diffLines(splitLines("a\n"+big), splitLines("b\n"+strings.Repeat("y\n", 2000))); added != 2001 || removed != 2001 {
+		t.Errorf("large diff = +%d -%d, want +2001 -2001", added, removed)
+	}
+}
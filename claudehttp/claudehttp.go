@@ -0,0 +1,133 @@
+// Package claudehttp serves Claude queries over HTTP, streaming each response
+// as Server-Sent Events:
+//
+//	http.Handle("/query", claudehttp.NewQueryHandler(func(r *http.Request) *types.ClaudeAgentOptions {
+//	    return types.NewClaudeAgentOptions().WithModel("claude-sonnet-4-5")
+//	}))
+//
+// A client POSTs a JSON body such as {"prompt": "What is 2+2?"} and reads one
+// event per message, named after the message type, with the message's JSON
+// as its data:
+//
+//	event: assistant
+//	data: {"type":"assistant","content":[{"type":"text","text":"4"}],...}
+//
+//	event: result
+//	data: {"type":"result","subtype":"success",...}
+//
+// The stream ends after the result event. A client that disconnects
+// cancels the query.
+package claudehttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// MaxRequestBytes is the largest request body a query handler accepts.
+const MaxRequestBytes = 10 << 20
+
+// Request is the JSON body of a query request.
+type Request struct {
+	Prompt string `json:"prompt"`
+}
+
+// queryHandler runs a Query for each request.
+type queryHandler struct {
+	options func(*http.Request) *types.ClaudeAgentOptions
+}
+
+// NewQueryHandler returns a handler that runs a Query for each POSTed
+// Request and streams its messages as Server-Sent Events, flushing after
+// each. optsFactory returns the options of the request's query; it may be
+// nil, and may return nil, for the defaults, and the handler never modifies
+// what it returns.
+//
+// A malformed request gets 400 Bad Request, and a request other than POST
+// 405 Method Not Allowed. A Query that fails to start gets 413 Request Entity
+// Too Large for a prompt over WithMaxPromptTokens and 502 Bad Gateway
+// otherwise, with the error as a plain-text body. Once streaming has begun
+// the status is 200, and failures arrive as system events, such as a
+// "transport_failed" SystemMessage.
+func NewQueryHandler(optsFactory func(*http.Request) *types.ClaudeAgentOptions) http.Handler {
+	return &queryHandler{options: optsFactory}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *queryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxRequestBytes)).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Prompt == "" {
+		http.Error(w, "prompt is required", http.StatusBadRequest)
+		return
+	}
+
+	var opts *types.ClaudeAgentOptions
+	if h.options != nil {
+		opts = h.options(r)
+	}
+
+	// The request's context is cancelled when the client disconnects; a
+	// failed write cancels the query as well
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	messages, err := claude.Query(ctx, req.Prompt, opts)
+	if err != nil {
+		status := http.StatusBadGateway
+		if types.IsPromptTooLargeError(err) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no") // Keep proxies such as nginx from buffering events
+	w.WriteHeader(http.StatusOK)
+
+	flusher := http.NewResponseController(w)
+	for msg := range messages {
+		if err := writeEvent(w, msg); err != nil {
+			return
+		}
+		if err := flusher.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return
+		}
+		if _, ok := msg.(*types.ResultMessage); ok {
+			// The channel closes once the CLI has finished; let it exit
+			// rather than cancelling it
+			for range messages {
+			}
+			return
+		}
+	}
+}
+
+// writeEvent writes msg as a Server-Sent Event named after its type. The
+// JSON encoding has no newlines, so it fits on one data line.
+func writeEvent(w http.ResponseWriter, msg types.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"type": msg.GetMessageType(), "error": err.Error()})
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.GetMessageType(), data)
+	return err
+}
@@ -0,0 +1,196 @@
+package claudehttp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+const (
+	assistantLine = `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"4"}]}}`
+	resultLine    = `{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s"}`
+)
+
+// newServer serves a query handler running cli.
+func newServer(t *testing.T, cli *mockcli.CLI) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(NewQueryHandler(func(*http.Request) *types.ClaudeAgentOptions {
+		return types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestQueryHandler_Events(t *testing.T) {
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(assistantLine, resultLine),
+		// Never sent: the stream ends with the result
+		mockcli.Send(assistantLine),
+	}})
+	server := newServer(t, cli)
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"prompt":"What is 2+2?"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	want := "event: assistant\n" +
+		`data: {"type":"assistant","content":[{"type":"text","text":"4"}],"model":"claude-sonnet-4-5"}` + "\n\n" +
+		"event: result\n" +
+		`data: {"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s"}` + "\n\n"
+	if string(body) != want {
+		t.Errorf("body =\n%s\nwant\n%s", body, want)
+	}
+	if received := cli.Received(); len(received) != 1 || !strings.Contains(received[0], `"What is 2+2?"`) {
+		t.Errorf("CLI received %q, want the prompt", received)
+	}
+}
+
+func TestQueryHandler_Flushes(t *testing.T) {
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(assistantLine),
+		mockcli.AwaitInputClosed(),
+	}})
+	server := newServer(t, cli)
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"prompt":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// The first event arrives while the turn is still running
+	events := bufio.NewReader(resp.Body)
+	read := make(chan string, 1)
+	go func() {
+		line, _ := events.ReadString('\n')
+		read <- line
+	}()
+	select {
+	case line := <-read:
+		if line != "event: assistant\n" {
+			t.Errorf("first line = %q, want the assistant event", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first event not flushed")
+	}
+}
+
+func TestQueryHandler_Disconnect(t *testing.T) {
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(assistantLine),
+		mockcli.Hang(),
+	}})
+	done := make(chan struct{})
+	handler := NewQueryHandler(func(*http.Request) *types.ClaudeAgentOptions {
+		return types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, strings.NewReader(`{"prompt":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "event: assistant\n" {
+		t.Fatalf("first line = %q, %v, want the assistant event", line, err)
+	}
+	pid := cli.PID()
+
+	// Disconnecting cancels the query, which stops the CLI
+	cancel()
+	resp.Body.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still running after the client disconnected")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("CLI %d still running after the client disconnected", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueryHandler_BadRequests(t *testing.T) {
+	server := httptest.NewServer(NewQueryHandler(nil))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"GET", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"malformed JSON", http.MethodPost, `{"prompt":`, http.StatusBadRequest},
+		{"no prompt", http.MethodPost, `{}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryHandler_QueryFails(t *testing.T) {
+	server := httptest.NewServer(NewQueryHandler(func(*http.Request) *types.ClaudeAgentOptions {
+		return types.NewClaudeAgentOptions().WithCLIPath("/nonexistent/claude")
+	}))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"prompt":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", resp.StatusCode)
+	}
+}
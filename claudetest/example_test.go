@@ -0,0 +1,65 @@
+package claudetest_test
+
+import (
+	"context"
+	"fmt"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// answer is application code that depends on claude.Querier rather than *claude.Client.
+func answer(ctx context.Context, q claude.Querier, question string) (string, float64, error) {
+	if err := q.Query(ctx, question); err != nil {
+		return "", 0, err
+	}
+
+	var text string
+	var cost float64
+	for msg := range q.ReceiveResponse(ctx) {
+		if result, ok := msg.(*types.ResultMessage); ok {
+			if result.Result != nil {
+				text = *result.Result
+			}
+			if result.TotalCostUSD != nil {
+				cost = *result.TotalCostUSD
+			}
+		}
+	}
+	return text, cost, nil
+}
+
+func ExampleFakeClaude() {
+	fake := claudetest.NewFakeClaude()
+	fake.OnPromptContaining("refund").
+		ReplyText("Your refund has been issued.").
+		WithToolUse("Bash", map[string]interface{}{"command": "refund --order 42"}).
+		WithCost(0.002)
+	fake.OnAnyPrompt().ReplyText("I can only help with refunds.")
+
+	ctx := context.Background()
+	for _, question := range []string{"I want a refund for order 42", "What's the weather?"} {
+		text, cost, err := answer(ctx, fake, question)
+		if err != nil {
+			fmt.Println("error:", err)
+			continue
+		}
+		fmt.Printf("%s ($%.3f)\n", text, cost)
+	}
+
+	// Output:
+	// Your refund has been issued. ($0.002)
+	// I can only help with refunds. ($0.000)
+}
+
+func ExampleStub_FailWith() {
+	fake := claudetest.NewFakeClaude()
+	fake.OnAnyPrompt().FailWith(fmt.Errorf("CLI unavailable"))
+
+	_, _, err := answer(context.Background(), fake, "hello")
+	fmt.Println(err)
+
+	// Output:
+	// CLI unavailable
+}
@@ -0,0 +1,353 @@
+package claudetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// FakeSessionID is the session ID reported in results from FakeClaude.
+const FakeSessionID = "fake-session"
+
+// FakeModel is the model reported in assistant messages from FakeClaude.
+const FakeModel = "fake-claude"
+
+// FakeClaude is an in-process stand-in for claude.Client whose responses are
+// programmed with stubs. It implements claude.Querier and never starts the CLI.
+//
+// Stubs are matched against each prompt in the order they were registered; the
+// first stub that matches and has uses left answers it. A prompt no stub
+// matches makes Query fail.
+//
+//	fake := claudetest.NewFakeClaude()
+//	fake.OnPromptContaining("refund").
+//	    ReplyText("Refund issued.").
+//	    WithToolUse("Bash", map[string]interface{}{"command": "refund --order 42"}).
+//	    WithCost(0.002)
+//	fake.OnAnyPrompt().ReplyText("I can only help with refunds.")
+//
+//	app := NewSupportApp(fake) // accepts a claude.Querier
+//
+// FakeClaude is safe for concurrent use.
+type FakeClaude struct {
+	mu      sync.Mutex
+	stubs   []*Stub
+	pending [][]types.Message
+	delays  []time.Duration
+	prompts []string
+	closed  bool
+	nextID  int
+}
+
+// Verify FakeClaude implements the Querier interface
+var _ claude.Querier = (*FakeClaude)(nil)
+
+// NewFakeClaude returns a FakeClaude with no stubs.
+func NewFakeClaude() *FakeClaude {
+	return &FakeClaude{}
+}
+
+// Stub is a programmed response, created by one of the FakeClaude.On methods
+// and configured with its fluent methods.
+type Stub struct {
+	fake        *FakeClaude
+	description string
+	match       func(prompt string) bool
+
+	blocks   []types.ContentBlock
+	extra    []types.Message
+	cost     *float64
+	usage    *types.Usage
+	isError  bool
+	errorMsg string
+	queryErr error
+	delay    time.Duration
+	times    int  // Remaining uses when limited
+	limited  bool // Set by Times
+	calls    int
+}
+
+// OnPromptContaining registers a stub for prompts containing substr.
+func (f *FakeClaude) OnPromptContaining(substr string) *Stub {
+	return f.on(fmt.Sprintf("prompt containing %q", substr), func(p string) bool {
+		return strings.Contains(p, substr)
+	})
+}
+
+// OnPrompt registers a stub for prompts equal to prompt.
+func (f *FakeClaude) OnPrompt(prompt string) *Stub {
+	return f.on(fmt.Sprintf("prompt %q", prompt), func(p string) bool {
+		return p == prompt
+	})
+}
+
+// OnPromptMatching registers a stub for prompts matching re.
+func (f *FakeClaude) OnPromptMatching(re *regexp.Regexp) *Stub {
+	return f.on(fmt.Sprintf("prompt matching %s", re), re.MatchString)
+}
+
+// OnPromptFunc registers a stub for prompts accepted by match.
+func (f *FakeClaude) OnPromptFunc(match func(prompt string) bool) *Stub {
+	return f.on("prompt accepted by func", match)
+}
+
+// OnAnyPrompt registers a stub matching every prompt. Register it last to use
+// it as a fallback.
+func (f *FakeClaude) OnAnyPrompt() *Stub {
+	return f.on("any prompt", func(string) bool { return true })
+}
+
+func (f *FakeClaude) on(description string, match func(string) bool) *Stub {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := &Stub{fake: f, description: description, match: match}
+	f.stubs = append(f.stubs, s)
+	return s
+}
+
+// ReplyText adds a text block to the stub's assistant message.
+func (s *Stub) ReplyText(text string) *Stub {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	s.blocks = append(s.blocks, types.NewTextBlock(text))
+	return s
+}
+
+// WithToolUse adds a tool_use block to the stub's assistant message.
+func (s *Stub) WithToolUse(name string, input map[string]interface{}) *Stub {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	s.fake.nextID++
+	s.blocks = append(s.blocks, types.NewToolUseBlock(fmt.Sprintf("toolu_fake_%d", s.fake.nextID), name, input))
+	return s
+}
+
+// WithMessages adds messages sent after the assistant message and before the result.
+func (s *Stub) WithMessages(msgs ...types.Message) *Stub {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	s.extra = append(s.extra, msgs...)
+	return s
+}
+
+// WithCost sets the total cost reported in the result.
+func (s *Stub) WithCost(usd float64) *Stub {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	s.cost = &usd
+	return s
+}
+
+// WithUsage sets the token usage reported in the result.
+func (s *Stub) WithUsage(usage types.Usage) *Stub {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	s.usage = &usage
+	return s
+}
+
+// ReplyError makes the turn end with an error result carrying message, as when
+// the CLI fails during execution.
+func (s *Stub) ReplyError(message string) *Stub {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	s.isError = true
+	s.errorMsg = message
+	return s
+}
+
+// FailWith makes Query return err instead of producing a response.
+func (s *Stub) FailWith(err error) *Stub {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	s.queryErr = err
+	return s
+}
+
+// WithDelay delays delivery of the response by d, to simulate latency.
+func (s *Stub) WithDelay(d time.Duration) *Stub {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	s.delay = d
+	return s
+}
+
+// Times limits the stub to answering n prompts. Once used up, later prompts
+// fall through to the next matching stub.
+func (s *Stub) Times(n int) *Stub {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	s.times = n
+	s.limited = true
+	return s
+}
+
+// Calls returns the number of prompts the stub has answered.
+func (s *Stub) Calls() int {
+	s.fake.mu.Lock()
+	defer s.fake.mu.Unlock()
+
+	return s.calls
+}
+
+// String describes what the stub matches.
+func (s *Stub) String() string {
+	return s.description
+}
+
+// Query records prompt and queues the response of the first matching stub.
+func (f *FakeClaude) Query(ctx context.Context, prompt string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.prompts = append(f.prompts, prompt)
+
+	for _, s := range f.stubs {
+		if (s.limited && s.times <= 0) || !s.match(prompt) {
+			continue
+		}
+
+		s.calls++
+		if s.limited {
+			s.times--
+		}
+		if s.queryErr != nil {
+			return s.queryErr
+		}
+
+		f.pending = append(f.pending, s.response())
+		f.delays = append(f.delays, s.delay)
+		return nil
+	}
+
+	return fmt.Errorf("claudetest: no stub matches prompt %q", prompt)
+}
+
+// response builds the messages for one answered prompt. The caller must hold f.mu.
+func (s *Stub) response() []types.Message {
+	var msgs []types.Message
+	var text []string
+
+	if len(s.blocks) > 0 {
+		blocks := make([]types.ContentBlock, len(s.blocks))
+		copy(blocks, s.blocks)
+		msgs = append(msgs, &types.AssistantMessage{Type: types.MessageTypeAssistant, Content: blocks, Model: FakeModel})
+
+		for _, b := range blocks {
+			if tb, ok := b.(*types.TextBlock); ok {
+				text = append(text, tb.Text)
+			}
+		}
+	}
+	msgs = append(msgs, s.extra...)
+
+	result := &types.ResultMessage{
+		Type:      types.MessageTypeResult,
+		Subtype:   "success",
+		NumTurns:  1,
+		SessionID: FakeSessionID,
+	}
+	resultText := strings.Join(text, "\n")
+	if s.isError {
+		result.Subtype = "error_during_execution"
+		result.IsError = true
+		resultText = s.errorMsg
+	}
+	result.Result = &resultText
+	if s.cost != nil {
+		cost := *s.cost
+		result.TotalCostUSD = &cost
+	}
+	if s.usage != nil {
+		result.Usage = usageMap(*s.usage)
+	}
+
+	return append(msgs, result)
+}
+
+// usageMap converts typed usage to the raw map carried by ResultMessage.
+func usageMap(u types.Usage) map[string]interface{} {
+	data, _ := json.Marshal(u)
+	var m map[string]interface{}
+	_ = json.Unmarshal(data, &m)
+	return m
+}
+
+// ReceiveResponse returns the response to the oldest prompt not yet received.
+// The channel is closed after the ResultMessage, or immediately if there is
+// no pending response.
+func (f *FakeClaude) ReceiveResponse(ctx context.Context) <-chan types.Message {
+	f.mu.Lock()
+	var msgs []types.Message
+	var delay time.Duration
+	if len(f.pending) > 0 {
+		msgs, delay = f.pending[0], f.delays[0]
+		f.pending, f.delays = f.pending[1:], f.delays[1:]
+	}
+	f.mu.Unlock()
+
+	out := make(chan types.Message, len(msgs))
+	go func() {
+		defer close(out)
+
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for _, msg := range msgs {
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Close marks the fake closed; later queries fail like on a closed Client.
+func (f *FakeClaude) Close(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	f.pending = nil
+	f.delays = nil
+	return nil
+}
+
+// Prompts returns every prompt sent to the fake, including unmatched ones.
+func (f *FakeClaude) Prompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.prompts...)
+}
@@ -0,0 +1,276 @@
+package claudetest_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ask sends a prompt and returns the received messages.
+func ask(t *testing.T, q claude.Querier, prompt string) []types.Message {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := q.Query(ctx, prompt); err != nil {
+		t.Fatalf("Query(%q) failed: %v", prompt, err)
+	}
+
+	var msgs []types.Message
+	for msg := range q.ReceiveResponse(ctx) {
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// resultOf returns the final result message, failing if there is none.
+func resultOf(t *testing.T, msgs []types.Message) *types.ResultMessage {
+	t.Helper()
+
+	if len(msgs) == 0 {
+		t.Fatal("no messages received")
+	}
+	result, ok := msgs[len(msgs)-1].(*types.ResultMessage)
+	if !ok {
+		t.Fatalf("last message is %T, want *types.ResultMessage", msgs[len(msgs)-1])
+	}
+	return result
+}
+
+func TestFakeClaude_ReplyTextAndToolUse(t *testing.T) {
+	fake := claudetest.NewFakeClaude()
+	fake.OnPromptContaining("refund").
+		ReplyText("Refund issued.").
+		WithToolUse("Bash", map[string]interface{}{"command": "refund 42"}).
+		WithCost(0.25).
+		WithUsage(types.Usage{InputTokens: 10, OutputTokens: 5, CacheReadInputTokens: 30})
+
+	msgs := ask(t, fake, "Please refund order 42")
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want assistant + result", len(msgs))
+	}
+
+	assistant, ok := msgs[0].(*types.AssistantMessage)
+	if !ok {
+		t.Fatalf("first message is %T, want *types.AssistantMessage", msgs[0])
+	}
+	if len(assistant.Content) != 2 {
+		t.Fatalf("got %d blocks, want 2", len(assistant.Content))
+	}
+	if tb, ok := assistant.Content[0].(*types.TextBlock); !ok || tb.Text != "Refund issued." {
+		t.Errorf("unexpected text block: %+v", assistant.Content[0])
+	}
+	tool, ok := assistant.Content[1].(*types.ToolUseBlock)
+	if !ok || tool.Name != "Bash" || tool.Input["command"] != "refund 42" || tool.ID == "" {
+		t.Errorf("unexpected tool_use block: %+v", assistant.Content[1])
+	}
+
+	result := resultOf(t, msgs)
+	if result.IsError || result.SessionID != claudetest.FakeSessionID {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if result.Result == nil || *result.Result != "Refund issued." {
+		t.Errorf("result text = %v", result.Result)
+	}
+	if result.TotalCostUSD == nil || *result.TotalCostUSD != 0.25 {
+		t.Errorf("cost = %v, want 0.25", result.TotalCostUSD)
+	}
+	usage, err := result.ParseUsage()
+	if err != nil || usage == nil || usage.CacheReadInputTokens != 30 {
+		t.Errorf("usage = %+v, %v", usage, err)
+	}
+}
+
+func TestFakeClaude_Matching(t *testing.T) {
+	fake := claudetest.NewFakeClaude()
+	exact := fake.OnPrompt("hello").ReplyText("exact")
+	re := fake.OnPromptMatching(regexp.MustCompile(`^order \d+$`)).ReplyText("regexp")
+	fn := fake.OnPromptFunc(func(p string) bool { return len(p) > 20 }).ReplyText("func")
+	contains := fake.OnPromptContaining("hello").ReplyText("contains")
+	fallback := fake.OnAnyPrompt().ReplyText("fallback")
+
+	tests := []struct {
+		prompt string
+		want   string
+	}{
+		{"hello", "exact"},
+		{"order 42", "regexp"},
+		{"a prompt that is quite long", "func"},
+		{"hello there", "contains"},
+		{"order 42 please", "fallback"},
+		{"anything", "fallback"},
+	}
+	for _, tt := range tests {
+		result := resultOf(t, ask(t, fake, tt.prompt))
+		if got := *result.Result; got != tt.want {
+			t.Errorf("prompt %q answered by %q, want %q", tt.prompt, got, tt.want)
+		}
+	}
+
+	for stub, want := range map[*claudetest.Stub]int{exact: 1, re: 1, fn: 1, contains: 1, fallback: 2} {
+		if got := stub.Calls(); got != want {
+			t.Errorf("%s answered %d prompts, want %d", stub, got, want)
+		}
+	}
+}
+
+func TestFakeClaude_FirstRegisteredWins(t *testing.T) {
+	fake := claudetest.NewFakeClaude()
+	fake.OnPromptContaining("refund").ReplyText("first")
+	second := fake.OnPromptContaining("refund").ReplyText("second")
+
+	if got := *resultOf(t, ask(t, fake, "refund")).Result; got != "first" {
+		t.Errorf("answered by %q, want first", got)
+	}
+	if second.Calls() != 0 {
+		t.Error("shadowed stub was used")
+	}
+}
+
+func TestFakeClaude_Times(t *testing.T) {
+	fake := claudetest.NewFakeClaude()
+	once := fake.OnAnyPrompt().ReplyText("once").Times(1)
+	fake.OnAnyPrompt().ReplyText("after")
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		got = append(got, *resultOf(t, ask(t, fake, "hi")).Result)
+	}
+	if got[0] != "once" || got[1] != "after" || got[2] != "after" {
+		t.Errorf("answers = %v, want [once after after]", got)
+	}
+	if once.Calls() != 1 {
+		t.Errorf("limited stub answered %d prompts, want 1", once.Calls())
+	}
+}
+
+func TestFakeClaude_Unmatched(t *testing.T) {
+	fake := claudetest.NewFakeClaude()
+	fake.OnPrompt("known").ReplyText("ok")
+
+	err := fake.Query(context.Background(), "unknown")
+	if err == nil {
+		t.Fatal("expected error for unmatched prompt")
+	}
+	if got := fake.Prompts(); len(got) != 1 || got[0] != "unknown" {
+		t.Errorf("Prompts() = %v", got)
+	}
+
+	// Nothing is pending, so the response channel is closed immediately
+	if _, ok := <-fake.ReceiveResponse(context.Background()); ok {
+		t.Error("expected closed channel with no pending response")
+	}
+}
+
+func TestFakeClaude_Errors(t *testing.T) {
+	errRateLimited := errors.New("rate limited")
+
+	fake := claudetest.NewFakeClaude()
+	fake.OnPromptContaining("fail").FailWith(errRateLimited)
+	fake.OnPromptContaining("crash").ReplyError("tool execution failed").WithCost(0.01)
+
+	if err := fake.Query(context.Background(), "fail please"); !errors.Is(err, errRateLimited) {
+		t.Errorf("Query error = %v, want %v", err, errRateLimited)
+	}
+
+	result := resultOf(t, ask(t, fake, "crash now"))
+	if !result.IsError || result.Subtype != "error_during_execution" {
+		t.Errorf("expected error result, got %+v", result)
+	}
+	if *result.Result != "tool execution failed" || *result.TotalCostUSD != 0.01 {
+		t.Errorf("unexpected error result fields: %v, %v", *result.Result, *result.TotalCostUSD)
+	}
+}
+
+func TestFakeClaude_WithMessagesAndOrdering(t *testing.T) {
+	parent := "toolu_1"
+	fake := claudetest.NewFakeClaude()
+	fake.OnPrompt("one").
+		ReplyText("1").
+		WithMessages(&types.UserMessage{Type: "user", Content: "tool output", ParentToolUseID: &parent})
+	fake.OnPrompt("two").ReplyText("2")
+
+	ctx := context.Background()
+	if err := fake.Query(ctx, "one"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.Query(ctx, "two"); err != nil {
+		t.Fatal(err)
+	}
+
+	var first []types.Message
+	for msg := range fake.ReceiveResponse(ctx) {
+		first = append(first, msg)
+	}
+	if len(first) != 3 || first[1].GetMessageType() != "user" {
+		t.Errorf("first response = %v, want assistant, user, result", first)
+	}
+	if got := *resultOf(t, first).Result; got != "1" {
+		t.Errorf("first response answered %q", got)
+	}
+
+	var second []types.Message
+	for msg := range fake.ReceiveResponse(ctx) {
+		second = append(second, msg)
+	}
+	if got := *resultOf(t, second).Result; got != "2" {
+		t.Errorf("second response answered %q", got)
+	}
+}
+
+func TestFakeClaude_Close(t *testing.T) {
+	fake := claudetest.NewFakeClaude()
+	fake.OnAnyPrompt().ReplyText("hi")
+
+	if err := fake.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.Query(context.Background(), "hi"); !types.IsCLIConnectionError(err) {
+		t.Errorf("Query after Close = %v, want CLIConnectionError", err)
+	}
+}
+
+func TestFakeClaude_DelayRespectsContext(t *testing.T) {
+	fake := claudetest.NewFakeClaude()
+	fake.OnAnyPrompt().ReplyText("slow").WithDelay(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := fake.Query(ctx, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	for msg := range fake.ReceiveResponse(ctx) {
+		t.Errorf("unexpected message before deadline: %v", msg)
+	}
+	if ctx.Err() == nil {
+		t.Error("response channel closed before the context expired")
+	}
+}
+
+func TestFakeClaude_Concurrent(t *testing.T) {
+	fake := claudetest.NewFakeClaude()
+	stub := fake.OnAnyPrompt().ReplyText("ok")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = fake.Query(context.Background(), "hi")
+			for range fake.ReceiveResponse(context.Background()) {
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stub.Calls() != 20 || len(fake.Prompts()) != 20 {
+		t.Errorf("calls = %d, prompts = %d, want 20", stub.Calls(), len(fake.Prompts()))
+	}
+}
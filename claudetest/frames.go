@@ -0,0 +1,207 @@
+// Package claudetest provides fakes and transports for hermetic tests of code
+// built on the Claude Agent SDK.
+//
+// FakeClaude is an in-process implementation of claude.Querier with programmed
+// responses, for testing application code that depends on the interface
+// rather than on *claude.Client.
+//
+// A RecordingTransport wraps a real transport and writes every frame exchanged
+// with the CLI to a JSONL file of event records in the format of package
+// schema. A ReplayTransport plays such a file back without the CLI or network
+// access:
+//
+//	replay, err := claudetest.LoadReplay("testdata/session.jsonl")
+//	if err != nil {
+//	    t.Fatal(err)
+//	}
+//	client, err := claude.NewClientWithTransport(ctx, opts, replay)
+//
+// Recording a session:
+//
+//	f, _ := os.Create("testdata/session.jsonl")
+//	defer f.Close()
+//	rec := claudetest.NewRecordingTransport(realTransport, f)
+//	client, err := claude.NewClientWithTransport(ctx, opts, rec)
+//
+// Passing rec.Logger() to WithLogger also records the SDK's state transitions
+// in the same file; tools/tracefmt -timeline renders the merged trace.
+//
+// ScriptedCLI starts a mock CLI that plays a Scenario, for end-to-end tests
+// that keep the subprocess: canned messages, answers to control requests,
+// delays, and exits mid-stream.
+package claudetest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/schema"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Direction identifies which side sent a frame.
+type Direction string
+
+const (
+	// DirectionOut is a line written by the SDK to the CLI's stdin.
+	DirectionOut Direction = "out"
+	// DirectionIn is a message read by the SDK from the CLI's stdout.
+	DirectionIn Direction = "in"
+	// DirectionState is an SDK state transition recorded through
+	// RecordingTransport.Logger; its Data is a StateEvent. Replay ignores it.
+	DirectionState Direction = "state"
+)
+
+// Frame is one recorded line of a CLI session.
+//
+// A frame is written as a schema.Record of the current version: a message or
+// control record holding Data for a line in either direction, or a state
+// record holding the StateEvent for a state frame.
+type Frame struct {
+	Time      time.Time       `json:"time"`
+	Offset    time.Duration   `json:"offset_ns,omitempty"` // Since the recording started, from the monotonic clock
+	Direction Direction       `json:"direction"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// MarshalJSON encodes the frame as a schema.Record.
+func (f Frame) MarshalJSON() ([]byte, error) {
+	record := schema.Record{
+		Schema: schema.Current,
+		Time:   f.Time,
+		Offset: f.Offset,
+	}
+	if f.Direction == DirectionState {
+		var state schema.State
+		if err := json.Unmarshal(f.Data, &state); err != nil {
+			return nil, fmt.Errorf("claudetest: invalid state frame: %w", err)
+		}
+		record.Kind = schema.KindState
+		record.State = &state
+	} else {
+		record.Kind = schema.KindOf(f.Data)
+		record.Direction = schema.Direction(f.Direction)
+		record.Message = f.Data
+	}
+	return json.Marshal(record)
+}
+
+// UnmarshalJSON decodes a frame from a schema.Record, or from the frame
+// format of earlier releases, which had no "schema" field and held the line
+// in "data".
+func (f *Frame) UnmarshalJSON(data []byte) error {
+	var head struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	if head.Schema == "" {
+		type legacy Frame
+		return json.Unmarshal(data, (*legacy)(f))
+	}
+	if err := schema.Validate(data); err != nil {
+		return err
+	}
+
+	var record schema.Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	*f = Frame{Time: record.Time, Offset: record.Offset}
+	switch record.Kind {
+	case schema.KindMessage, schema.KindControl:
+		f.Direction = Direction(record.Direction)
+		f.Data = record.Message
+	case schema.KindState:
+		state, err := json.Marshal(record.State)
+		if err != nil {
+			return err
+		}
+		f.Direction = DirectionState
+		f.Data = state
+	default:
+		return fmt.Errorf("%s records are not frames", record.Kind)
+	}
+	return nil
+}
+
+// ReadFrames reads JSONL frames from r: event records of a schema version
+// this package knows, or frames written by earlier releases. Blank lines are
+// skipped.
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	var frames []Frame
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var frame Frame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return nil, fmt.Errorf("claudetest: line %d: %w", line, err)
+		}
+		if frame.Direction != DirectionIn && frame.Direction != DirectionOut && frame.Direction != DirectionState {
+			return nil, fmt.Errorf("claudetest: line %d: invalid direction %q", line, frame.Direction)
+		}
+		frames = append(frames, frame)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("claudetest: %w", err)
+	}
+	return frames, nil
+}
+
+// ReadFramesFile reads JSONL frames from the file at path.
+func ReadFramesFile(path string) ([]Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("claudetest: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	return ReadFrames(f)
+}
+
+// frameKey returns the loose identity of a frame used for replay matching:
+// the message type plus the control subtype or message subtype, if any.
+func frameKey(data []byte) string {
+	var msg struct {
+		Type    string `json:"type"`
+		Subtype string `json:"subtype"`
+		Request struct {
+			Subtype string `json:"subtype"`
+		} `json:"request"`
+		Response struct {
+			Subtype string `json:"subtype"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return ""
+	}
+
+	switch msg.Type {
+	case types.MessageTypeControlRequest:
+		return msg.Type + "/" + msg.Request.Subtype
+	case types.MessageTypeControlResponse:
+		return msg.Type + "/" + msg.Response.Subtype
+	case "":
+		return ""
+	}
+	if msg.Subtype != "" {
+		return msg.Type + "/" + msg.Subtype
+	}
+	return msg.Type
+}
@@ -0,0 +1,11 @@
+package claudetest_test
+
+import (
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+)
+
+func TestMain(m *testing.M) {
+	mockcli.Main(m)
+}
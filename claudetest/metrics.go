@@ -0,0 +1,127 @@
+package claudetest
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// MetricsRecorder is an in-memory types.MetricsSink for asserting on the
+// metrics a session reports. Series are keyed by name and labels, so a
+// counter with labels {"type": "result"} is separate from the same counter
+// with {"type": "assistant"}. It is safe for concurrent use.
+//
+//	metrics := claudetest.NewMetricsRecorder()
+//	opts := types.NewClaudeAgentOptions().WithMetricsSink(metrics)
+//	// ... run a session ...
+//	if n := metrics.Counter(types.MetricQueries, nil); n != 1 {
+//	    t.Errorf("queries = %v, want 1", n)
+//	}
+type MetricsRecorder struct {
+	mu        sync.Mutex
+	counters  map[string]float64
+	gauges    map[string]float64
+	durations map[string][]time.Duration
+}
+
+var _ types.MetricsSink = (*MetricsRecorder)(nil)
+
+// NewMetricsRecorder creates an empty MetricsRecorder.
+func NewMetricsRecorder() *MetricsRecorder {
+	return &MetricsRecorder{
+		counters:  make(map[string]float64),
+		gauges:    make(map[string]float64),
+		durations: make(map[string][]time.Duration),
+	}
+}
+
+// IncCounter implements types.MetricsSink.
+func (r *MetricsRecorder) IncCounter(name string, delta float64, labels map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[seriesKey(name, labels)] += delta
+}
+
+// ObserveDuration implements types.MetricsSink.
+func (r *MetricsRecorder) ObserveDuration(name string, d time.Duration, labels map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := seriesKey(name, labels)
+	r.durations[key] = append(r.durations[key], d)
+}
+
+// AddGauge implements types.MetricsSink.
+func (r *MetricsRecorder) AddGauge(name string, delta float64, labels map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[seriesKey(name, labels)] += delta
+}
+
+// Counter returns the value of the counter with exactly these labels.
+func (r *MetricsRecorder) Counter(name string, labels map[string]string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counters[seriesKey(name, labels)]
+}
+
+// Gauge returns the value of the gauge with exactly these labels.
+func (r *MetricsRecorder) Gauge(name string, labels map[string]string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.gauges[seriesKey(name, labels)]
+}
+
+// Durations returns the observations recorded for the series with exactly
+// these labels, in order.
+func (r *MetricsRecorder) Durations(name string, labels map[string]string) []time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]time.Duration(nil), r.durations[seriesKey(name, labels)]...)
+}
+
+// Series returns the keys of every series recorded, sorted, in Prometheus
+// notation such as claude_messages_total{type="result"}.
+func (r *MetricsRecorder) Series() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var keys []string
+	for key := range r.counters {
+		keys = append(keys, key)
+	}
+	for key := range r.gauges {
+		keys = append(keys, key)
+	}
+	for key := range r.durations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// seriesKey formats name and labels as name{k="v",...} with sorted label names.
+func seriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k + `="` + labels[k] + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
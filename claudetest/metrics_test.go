@@ -0,0 +1,185 @@
+package claudetest_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestMetricsRecorder(t *testing.T) {
+	r := claudetest.NewMetricsRecorder()
+	r.IncCounter("requests_total", 1, map[string]string{"b": "2", "a": "1"})
+	r.IncCounter("requests_total", 2, map[string]string{"a": "1", "b": "2"})
+	r.IncCounter("requests_total", 5, nil)
+	r.AddGauge("in_flight", 3, nil)
+	r.AddGauge("in_flight", -1, nil)
+	r.ObserveDuration("latency_seconds", time.Second, nil)
+	r.ObserveDuration("latency_seconds", 2*time.Second, nil)
+
+	if got := r.Counter("requests_total", map[string]string{"a": "1", "b": "2"}); got != 3 {
+		t.Errorf("labelled counter = %v, want 3", got)
+	}
+	if got := r.Counter("requests_total", nil); got != 5 {
+		t.Errorf("unlabelled counter = %v, want 5", got)
+	}
+	if got := r.Gauge("in_flight", nil); got != 2 {
+		t.Errorf("gauge = %v, want 2", got)
+	}
+	if got := r.Durations("latency_seconds", nil); len(got) != 2 || got[1] != 2*time.Second {
+		t.Errorf("durations = %v, want [1s 2s]", got)
+	}
+
+	want := []string{"in_flight", "latency_seconds", "requests_total", `requests_total{a="1",b="2"}`}
+	if got := r.Series(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Series() = %v, want %v", got, want)
+	}
+}
+
+// writeMetricsCLI writes a mock CLI that replies to each of two user
+// messages with an assistant message and a result. Each turn costs $0.01,
+// reported as the session total the CLI sends, and uses 10 uncached input
+// tokens, 90 read from the cache and 5 output tokens.
+func writeMetricsCLI(t *testing.T) string {
+	t.Helper()
+	var steps []claudetest.Step
+	for n := 1; n <= 2; n++ {
+		steps = append(steps,
+			claudetest.AwaitPrompt(),
+			claudetest.Send(
+				`{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"ok"}]}}`,
+				fmt.Sprintf(`{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":%d,"session_id":"s","total_cost_usd":0.0%d,"usage":{"input_tokens":10,"cache_read_input_tokens":90,"output_tokens":5}}`, n, n),
+			),
+		)
+	}
+	return claudetest.ScriptedCLI(t, claudetest.Scenario{Steps: steps}).Path
+}
+
+func TestMetricsRecorder_ScriptedSession(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	metrics := claudetest.NewMetricsRecorder()
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMetricsCLI(t)).
+		WithMetricsSink(metrics)
+	client, err := claude.NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if got := metrics.Gauge(types.MetricClientsConnected, nil); got != 1 {
+		t.Errorf("clients connected = %v, want 1", got)
+	}
+	if got := metrics.Gauge(types.MetricSubprocesses, nil); got != 1 {
+		t.Errorf("subprocesses = %v, want 1", got)
+	}
+
+	for _, prompt := range []string{"first", "second"} {
+		if err := client.Query(ctx, prompt); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		for range client.ReceiveResponse(ctx) {
+		}
+	}
+	_ = client.Close(ctx)
+
+	counters := []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{types.MetricQueries, nil, 2},
+		{types.MetricMessages, map[string]string{"type": "assistant"}, 2},
+		{types.MetricMessages, map[string]string{"type": "result"}, 2},
+		{types.MetricSubprocessStarts, nil, 1},
+		{types.MetricInputTokens, nil, 20},
+		{types.MetricCacheReadTokens, nil, 180},
+		{types.MetricCacheCreationTokens, nil, 0},
+		{types.MetricOutputTokens, nil, 10},
+	}
+	for _, c := range counters {
+		if got := metrics.Counter(c.name, c.labels); got != c.want {
+			t.Errorf("%s%v = %v, want %v", c.name, c.labels, got, c.want)
+		}
+	}
+	if got := metrics.Counter(types.MetricCostUSD, nil); got < 0.0199 || got > 0.0201 {
+		t.Errorf("cost = %v, want 0.02, the session total", got)
+	}
+	if got := metrics.Counter(types.MetricBytesWritten, nil); got < float64(len("first")+len("second")) {
+		t.Errorf("bytes written = %v, want at least the prompts", got)
+	}
+	if got := metrics.Counter(types.MetricBytesRead, nil); got < 4*80 {
+		t.Errorf("bytes read = %v, want at least the four replies", got)
+	}
+
+	if got := metrics.Durations(types.MetricConnectDuration, map[string]string{"outcome": "success"}); len(got) != 1 {
+		t.Errorf("connect durations = %v, want one", got)
+	}
+	if got := metrics.Durations(types.MetricResponseDuration, nil); len(got) != 2 {
+		t.Errorf("response durations = %v, want two", got)
+	}
+
+	// Close reaps the subprocess and disconnects the client
+	if got := metrics.Gauge(types.MetricClientsConnected, nil); got != 0 {
+		t.Errorf("clients connected after Close = %v, want 0", got)
+	}
+	if got := metrics.Gauge(types.MetricSubprocesses, nil); got != 0 {
+		t.Errorf("subprocesses after Close = %v, want 0", got)
+	}
+}
+
+func TestMetricsRecorder_Query(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	metrics := claudetest.NewMetricsRecorder()
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeMetricsCLI(t)).
+		WithMetricsSink(metrics)
+	messages, err := claude.Query(ctx, "hi", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range messages {
+	}
+
+	if got := metrics.Counter(types.MetricQueries, nil); got != 1 {
+		t.Errorf("queries = %v, want 1", got)
+	}
+	if got := metrics.Counter(types.MetricMessages, map[string]string{"type": "result"}); got != 1 {
+		t.Errorf("result messages = %v, want 1", got)
+	}
+	if got := metrics.Durations(types.MetricConnectDuration, map[string]string{"outcome": "success"}); len(got) != 0 {
+		t.Errorf("one-shot Query observed connect durations %v, want none", got)
+	}
+}
+
+func TestMetricsRecorder_ConnectError(t *testing.T) {
+	metrics := claudetest.NewMetricsRecorder()
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(filepath.Join(t.TempDir(), "missing")).
+		WithMetricsSink(metrics)
+	client, err := claude.NewClient(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(context.Background()); err == nil {
+		t.Fatal("Connect succeeded for a missing CLI")
+	}
+
+	if got := metrics.Durations(types.MetricConnectDuration, map[string]string{"outcome": "error"}); len(got) != 1 {
+		t.Errorf("failed connect durations = %v, want one", got)
+	}
+	if got := metrics.Gauge(types.MetricClientsConnected, nil); got != 0 {
+		t.Errorf("clients connected = %v, want 0", got)
+	}
+}
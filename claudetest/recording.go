@@ -0,0 +1,156 @@
+package claudetest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// RecordingTransport wraps another transport and records every frame written
+// to and read from it as timestamped JSONL.
+//
+// Incoming messages are recorded byte-for-byte when the wrapped transport
+// captures raw JSON (see WithRawMessages); otherwise they are re-encoded from
+// their parsed form.
+type RecordingTransport struct {
+	inner transport.Transport
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error // First error writing the recording
+
+	readOnce sync.Once
+	messages chan types.Message
+
+	now   func() time.Time
+	start time.Time // Offsets are measured from here
+}
+
+// Verify RecordingTransport implements the transport interface
+var _ transport.Transport = (*RecordingTransport)(nil)
+
+// NewRecordingTransport returns a transport that delegates to inner and writes
+// frames to w. The caller owns w and must close it after closing the transport.
+func NewRecordingTransport(inner transport.Transport, w io.Writer) *RecordingTransport {
+	return &RecordingTransport{
+		inner: inner,
+		enc:   json.NewEncoder(w),
+		now:   time.Now,
+		start: time.Now(),
+	}
+}
+
+// Err returns the first error encountered while writing the recording.
+func (r *RecordingTransport) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// record appends a frame to the recording.
+func (r *RecordingTransport) record(dir Direction, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+	now := r.now()
+	frame := Frame{Time: now.UTC(), Offset: now.Sub(r.start), Direction: dir, Data: json.RawMessage(data)}
+	if err := r.enc.Encode(frame); err != nil {
+		r.err = err
+	}
+}
+
+// Connect connects the wrapped transport.
+func (r *RecordingTransport) Connect(ctx context.Context) error {
+	return r.inner.Connect(ctx)
+}
+
+// Close closes the wrapped transport.
+func (r *RecordingTransport) Close(ctx context.Context) error {
+	return r.inner.Close(ctx)
+}
+
+// Write records and forwards a line to the wrapped transport.
+func (r *RecordingTransport) Write(ctx context.Context, data string) error {
+	if json.Valid([]byte(data)) {
+		r.record(DirectionOut, []byte(data))
+	}
+	return r.inner.Write(ctx, data)
+}
+
+// WriteBatch records and forwards several lines to the wrapped transport.
+func (r *RecordingTransport) WriteBatch(ctx context.Context, lines []string) error {
+	for _, line := range lines {
+		if json.Valid([]byte(line)) {
+			r.record(DirectionOut, []byte(line))
+		}
+	}
+	return r.inner.WriteBatch(ctx, lines)
+}
+
+// Flush flushes the wrapped transport.
+func (r *RecordingTransport) Flush(ctx context.Context) error {
+	return r.inner.Flush(ctx)
+}
+
+// EndInput closes the wrapped transport's input.
+func (r *RecordingTransport) EndInput(ctx context.Context) error {
+	return r.inner.EndInput(ctx)
+}
+
+// ReadMessages returns the wrapped transport's messages, recording each one.
+func (r *RecordingTransport) ReadMessages(ctx context.Context) <-chan types.Message {
+	r.readOnce.Do(func() {
+		in := r.inner.ReadMessages(ctx)
+		r.messages = make(chan types.Message, cap(in))
+
+		go func() {
+			defer close(r.messages)
+			for msg := range in {
+				if data, err := encodeMessage(msg); err == nil {
+					r.record(DirectionIn, data)
+				}
+				r.messages <- msg
+			}
+		}()
+	})
+	return r.messages
+}
+
+// OnError forwards an error to the wrapped transport.
+func (r *RecordingTransport) OnError(err error) {
+	r.inner.OnError(err)
+}
+
+// IsReady reports whether the wrapped transport is ready.
+func (r *RecordingTransport) IsReady() bool {
+	return r.inner.IsReady()
+}
+
+// GetError returns the wrapped transport's error.
+func (r *RecordingTransport) GetError() error {
+	return r.inner.GetError()
+}
+
+// encodeMessage converts a parsed message back to its CLI wire form, using the
+// original JSON when raw capture is enabled. Control messages carry their full
+// payload in SystemMessage.Data.
+func encodeMessage(msg types.Message) ([]byte, error) {
+	if raw := msg.GetRaw(); raw != nil {
+		return raw, nil
+	}
+	if sys, ok := msg.(*types.SystemMessage); ok {
+		switch sys.Type {
+		case types.MessageTypeControlRequest, types.MessageTypeControlResponse:
+			return json.Marshal(sys.Data)
+		}
+	}
+	return json.Marshal(msg)
+}
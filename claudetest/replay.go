@@ -0,0 +1,251 @@
+package claudetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ReplayTransport plays back a recorded session without a CLI subprocess.
+//
+// Writes are matched loosely against the next recorded outgoing frame: only the
+// message type and control subtype must agree, so prompts and request IDs may
+// differ between recording and replay. After each matched write the recorded
+// incoming frames that followed it are delivered. Control responses are
+// rewritten to carry the request ID the SDK actually sent.
+type ReplayTransport struct {
+	mu       sync.Mutex
+	frames   []Frame
+	pos      int
+	ids      map[string]string // Recorded request_id -> live request_id
+	messages chan types.Message
+	ready    bool
+	closed   bool
+	err      error
+}
+
+// Verify ReplayTransport implements the transport interface
+var _ transport.Transport = (*ReplayTransport)(nil)
+
+// NewReplayTransport returns a transport that replays frames. State frames
+// are skipped.
+func NewReplayTransport(frames []Frame) *ReplayTransport {
+	protocol := make([]Frame, 0, len(frames))
+	for _, f := range frames {
+		if f.Direction != DirectionState {
+			protocol = append(protocol, f)
+		}
+	}
+	return &ReplayTransport{
+		frames: protocol,
+		ids:    make(map[string]string),
+	}
+}
+
+// LoadReplay reads a recording from path and returns a transport replaying it.
+func LoadReplay(path string) (*ReplayTransport, error) {
+	frames, err := ReadFramesFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayTransport(frames), nil
+}
+
+// Connect starts the replay and delivers any incoming frames recorded before
+// the first write.
+func (r *ReplayTransport) Connect(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.messages != nil {
+		return nil
+	}
+	r.messages = make(chan types.Message, len(r.frames)+1)
+	r.ready = true
+	return r.deliverLocked()
+}
+
+// Close stops the replay.
+func (r *ReplayTransport) Close(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ready = false
+	r.closeLocked()
+	return nil
+}
+
+// Write matches data against the next recorded outgoing frame.
+func (r *ReplayTransport) Write(ctx context.Context, data string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.writeLocked(data)
+}
+
+// WriteBatch matches each line in order against the recording.
+func (r *ReplayTransport) WriteBatch(ctx context.Context, lines []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, line := range lines {
+		if err := r.writeLocked(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush is a no-op; replayed writes are never buffered.
+func (r *ReplayTransport) Flush(ctx context.Context) error {
+	return nil
+}
+
+// EndInput is a no-op.
+func (r *ReplayTransport) EndInput(ctx context.Context) error {
+	return nil
+}
+
+// ReadMessages returns the channel of replayed messages.
+func (r *ReplayTransport) ReadMessages(ctx context.Context) <-chan types.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.messages == nil {
+		r.messages = make(chan types.Message, len(r.frames)+1)
+	}
+	return r.messages
+}
+
+// OnError records an error.
+func (r *ReplayTransport) OnError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.err = err
+}
+
+// IsReady reports whether the replay is connected.
+func (r *ReplayTransport) IsReady() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.ready
+}
+
+// GetError returns the first replay mismatch or recorded error, if any.
+func (r *ReplayTransport) GetError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// Remaining returns the number of recorded frames not yet replayed.
+func (r *ReplayTransport) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.frames) - r.pos
+}
+
+// writeLocked matches one outgoing line and delivers the frames that follow it.
+func (r *ReplayTransport) writeLocked(data string) error {
+	if !r.ready {
+		return fmt.Errorf("claudetest: write on replay transport that is not connected")
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if r.pos >= len(r.frames) || r.frames[r.pos].Direction != DirectionOut {
+		r.err = fmt.Errorf("claudetest: unexpected write %s; recording expects no write here", frameKey([]byte(data)))
+		return r.err
+	}
+
+	expected := r.frames[r.pos]
+	if got, want := frameKey([]byte(data)), frameKey(expected.Data); got != want {
+		r.err = fmt.Errorf("claudetest: write %s does not match recorded %s at frame %d", got, want, r.pos+1)
+		return r.err
+	}
+	r.mapRequestID(expected.Data, []byte(data))
+	r.pos++
+
+	return r.deliverLocked()
+}
+
+// mapRequestID remembers the live request ID for a recorded control request.
+func (r *ReplayTransport) mapRequestID(recorded, live []byte) {
+	var rec, cur struct {
+		Type      string `json:"type"`
+		RequestID string `json:"request_id"`
+	}
+	if json.Unmarshal(recorded, &rec) != nil || json.Unmarshal(live, &cur) != nil {
+		return
+	}
+	if rec.Type == types.MessageTypeControlRequest && rec.RequestID != "" {
+		r.ids[rec.RequestID] = cur.RequestID
+	}
+}
+
+// deliverLocked sends incoming frames up to the next outgoing frame and closes
+// the channel once the recording is exhausted.
+func (r *ReplayTransport) deliverLocked() error {
+	for r.pos < len(r.frames) && r.frames[r.pos].Direction == DirectionIn {
+		data, err := r.rewriteResponse(r.frames[r.pos].Data)
+		if err != nil {
+			r.err = err
+			return err
+		}
+		msg, err := types.UnmarshalMessageWithRaw(data)
+		if err != nil {
+			r.err = fmt.Errorf("claudetest: frame %d: %w", r.pos+1, err)
+			return r.err
+		}
+		if !r.closed {
+			r.messages <- msg
+		}
+		r.pos++
+	}
+
+	if r.pos >= len(r.frames) {
+		r.closeLocked()
+	}
+	return nil
+}
+
+// rewriteResponse replaces the recorded request ID of a control response with
+// the ID the SDK sent during replay.
+func (r *ReplayTransport) rewriteResponse(data json.RawMessage) ([]byte, error) {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("claudetest: frame %d: %w", r.pos+1, err)
+	}
+	if msg["type"] != types.MessageTypeControlResponse {
+		return data, nil
+	}
+
+	response, ok := msg["response"].(map[string]interface{})
+	if !ok {
+		return data, nil
+	}
+	recorded, _ := response["request_id"].(string)
+	live, ok := r.ids[recorded]
+	if !ok {
+		return data, nil
+	}
+	response["request_id"] = live
+	return json.Marshal(msg)
+}
+
+// closeLocked closes the message channel once.
+func (r *ReplayTransport) closeLocked() {
+	if r.closed || r.messages == nil {
+		return
+	}
+	r.closed = true
+	close(r.messages)
+}
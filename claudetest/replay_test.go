@@ -0,0 +1,172 @@
+package claudetest_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// runPermissionSession drives the permission_session fixture through a client
+// and returns the text of the final assistant message.
+func runPermissionSession(t *testing.T, ctx context.Context, tr claude.Transport) (string, int32) {
+	t.Helper()
+
+	var permissionCalls int32
+	opts := types.NewClaudeAgentOptions().
+		WithStrictProtocol(true).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			atomic.AddInt32(&permissionCalls, 1)
+			if toolName != "Bash" {
+				t.Errorf("toolName = %q, want Bash", toolName)
+			}
+			return types.PermissionResultAllow{Behavior: "allow"}, nil
+		})
+
+	client, err := claude.NewClientWithTransport(ctx, opts, tr)
+	if err != nil {
+		t.Fatalf("NewClientWithTransport failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+
+	if err := client.Query(ctx, "List the files in the current directory"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	var text string
+	var result *types.ResultMessage
+	for msg := range client.ReceiveResponse(ctx) {
+		switch m := msg.(type) {
+		case *types.AssistantMessage:
+			for _, block := range m.Content {
+				if tb, ok := block.(*types.TextBlock); ok {
+					text = tb.Text
+				}
+			}
+		case *types.ResultMessage:
+			result = m
+		}
+	}
+
+	if result == nil {
+		t.Fatal("no result message received")
+	}
+	return text, atomic.LoadInt32(&permissionCalls)
+}
+
+// TestReplayClientWithPermissionCallback tests that a recorded session including
+// a permission prompt replays through a client without the CLI.
+func TestReplayClientWithPermissionCallback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	replay, err := claudetest.LoadReplay("testdata/permission_session.jsonl")
+	if err != nil {
+		t.Fatalf("LoadReplay failed: %v", err)
+	}
+
+	text, calls := runPermissionSession(t, ctx, replay)
+	if calls != 1 {
+		t.Errorf("permission callback called %d times, want 1", calls)
+	}
+	if text != "The directory contains go.mod and main.go." {
+		t.Errorf("unexpected final text %q", text)
+	}
+	if err := replay.GetError(); err != nil {
+		t.Errorf("replay error: %v", err)
+	}
+	if n := replay.Remaining(); n != 0 {
+		t.Errorf("%d frames not replayed", n)
+	}
+}
+
+// TestReplayQuery tests that a one-shot query replays from a recording.
+func TestReplayQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	replay, err := claudetest.LoadReplay("testdata/query_session.jsonl")
+	if err != nil {
+		t.Fatalf("LoadReplay failed: %v", err)
+	}
+
+	msgs, err := claude.QueryWithTransport(ctx, "What is 2 + 2?", nil, replay)
+	if err != nil {
+		t.Fatalf("QueryWithTransport failed: %v", err)
+	}
+
+	var kinds []string
+	for msg := range msgs {
+		kinds = append(kinds, msg.GetMessageType())
+	}
+	if got := strings.Join(kinds, ","); got != "assistant,result" {
+		t.Errorf("message types = %s, want assistant,result", got)
+	}
+}
+
+// TestRecordReplayRoundTrip tests that a recording of a replayed session can
+// itself be replayed.
+func TestRecordReplayRoundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	replay, err := claudetest.LoadReplay("testdata/permission_session.jsonl")
+	if err != nil {
+		t.Fatalf("LoadReplay failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rec := claudetest.NewRecordingTransport(replay, &buf)
+	wantText, _ := runPermissionSession(t, ctx, rec)
+	if err := rec.Err(); err != nil {
+		t.Fatalf("recording error: %v", err)
+	}
+
+	frames, err := claudetest.ReadFrames(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrames failed: %v", err)
+	}
+	if len(frames) != 8 {
+		t.Fatalf("recorded %d frames, want 8", len(frames))
+	}
+
+	text, calls := runPermissionSession(t, ctx, claudetest.NewReplayTransport(frames))
+	if text != wantText || calls != 1 {
+		t.Errorf("round trip got text %q and %d permission calls", text, calls)
+	}
+}
+
+// TestReplayMismatch tests that a write that diverges from the recording fails.
+func TestReplayMismatch(t *testing.T) {
+	ctx := context.Background()
+
+	replay, err := claudetest.LoadReplay("testdata/query_session.jsonl")
+	if err != nil {
+		t.Fatalf("LoadReplay failed: %v", err)
+	}
+	if err := replay.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	err = replay.Write(ctx, `{"type":"control_request","request_id":"req_1","request":{"subtype":"interrupt"}}`)
+	if err == nil {
+		t.Fatal("expected mismatch error")
+	}
+	if !strings.Contains(err.Error(), "does not match recorded user") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if replay.GetError() == nil {
+		t.Error("expected GetError to report the mismatch")
+	}
+}
@@ -0,0 +1,111 @@
+package claudetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+)
+
+// Scenario scripts the mock CLI started by ScriptedCLI.
+//
+// The CLI answers every control request the SDK sends, such as initialize
+// and set_model, with the payload from ControlResponses or the error from
+// ControlErrors for its subtype, and an empty success payload otherwise.
+// Meanwhile it plays Steps in order. Once they are done it answers each
+// further prompt with EachPrompt, if set, and exits when its input closes.
+type Scenario = mockcli.Scenario
+
+// Step is one action of a Scenario: Send, Stderr, AwaitPrompt,
+// AwaitResponse, AwaitRequest, AwaitInputClosed, Delay, Exit, CloseOutput or
+// Hang.
+type Step = mockcli.Step
+
+// MockCLI is a mock CLI created by ScriptedCLI. Pass its Path to
+// WithCLIPath; Received returns the lines the SDK wrote to it, and Args and
+// PID the arguments and process ID it was started with.
+type MockCLI = mockcli.CLI
+
+// DefaultCLIVersion is what a mock CLI prints for --version when its
+// scenario sets no Version.
+const DefaultCLIVersion = mockcli.DefaultVersion
+
+// ScriptedCLI returns a mock CLI playing script, for tests that exercise the
+// SDK end to end, subprocess included, without the real CLI.
+//
+// The mock CLI is the test binary itself, started under another name, so it
+// runs on every platform the tests build for and needs no shell. Importing
+// claudetest is all it takes: the package recognizes when it was started as
+// a mock CLI and plays the scenario instead of running the tests.
+//
+//	cli := claudetest.ScriptedCLI(t, claudetest.Scenario{
+//	    Steps: []claudetest.Step{
+//	        claudetest.AwaitPrompt(),
+//	        claudetest.Send(
+//	            `{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"hi"}]}}`,
+//	            `{"type":"result","subtype":"success","is_error":false,"num_turns":1,"session_id":"s"}`,
+//	        ),
+//	    },
+//	})
+//	client, err := claude.NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+func ScriptedCLI(t testing.TB, script Scenario) *MockCLI {
+	t.Helper()
+	return mockcli.New(t, script)
+}
+
+// Send writes lines, one JSON message each, to the CLI's output.
+func Send(lines ...string) Step {
+	return mockcli.Send(lines...)
+}
+
+// Stderr writes lines to the CLI's standard error.
+func Stderr(lines ...string) Step {
+	return mockcli.Stderr(lines...)
+}
+
+// AwaitPrompt waits for the next user message from the SDK. The CLI exits
+// with status 0 if its input closes first, as the real CLI does.
+func AwaitPrompt() Step {
+	return mockcli.AwaitPrompt()
+}
+
+// AwaitResponse waits for the SDK to answer the control request the CLI
+// sent with requestID, such as a can_use_tool or hook_callback request. The
+// CLI exits with status 0 if its input closes first.
+func AwaitResponse(requestID string) Step {
+	return mockcli.AwaitResponse(requestID)
+}
+
+// AwaitRequest waits until the CLI has answered a control request of the
+// given subtype from the SDK, such as "interrupt". Each request satisfies one
+// AwaitRequest. The CLI exits with status 0 if its input closes first.
+func AwaitRequest(subtype string) Step {
+	return mockcli.AwaitRequest(subtype)
+}
+
+// AwaitInputClosed waits until the SDK closes the CLI's input, as Close and
+// EndInput do, so that later steps run during shutdown.
+func AwaitInputClosed() Step {
+	return mockcli.AwaitInputClosed()
+}
+
+// Delay pauses the scenario for d.
+func Delay(d time.Duration) Step {
+	return mockcli.Delay(d)
+}
+
+// Exit ends the CLI at once with the given status, even mid-stream.
+func Exit(code int) Step {
+	return mockcli.Exit(code)
+}
+
+// CloseOutput closes the CLI's output while it keeps running.
+func CloseOutput() Step {
+	return mockcli.CloseOutput()
+}
+
+// Hang keeps the CLI running, ignoring the end of its input, until it is
+// killed.
+func Hang() Step {
+	return mockcli.Hang()
+}
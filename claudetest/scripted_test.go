@@ -0,0 +1,91 @@
+package claudetest_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestScriptedCLI_Client(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := claudetest.ScriptedCLI(t, claudetest.Scenario{
+		ControlResponses: map[string]json.RawMessage{
+			"initialize": json.RawMessage(`{"commands":[{"name":"review","description":"Review code","argumentHint":""}]}`),
+		},
+		ControlErrors: map[string]string{"set_model": "Invalid model: nope"},
+		Steps: []claudetest.Step{
+			claudetest.AwaitPrompt(),
+			claudetest.Stderr("warming up"),
+			claudetest.Send(`{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"hi"}]}}`),
+			claudetest.Delay(20 * time.Millisecond),
+			claudetest.Send(`{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s"}`),
+		},
+		EachPrompt: []string{
+			`{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":2,"session_id":"s"}`,
+		},
+	})
+	client, err := claude.NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() { _ = client.Close(context.Background()) }()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if got := client.CLIVersion(); got != "2.1.0" {
+		t.Errorf("CLIVersion() = %q, want the mock's version", got)
+	}
+	if err := client.SetModel(ctx, "nope"); err == nil || !strings.Contains(err.Error(), "Invalid model: nope") {
+		t.Errorf("SetModel = %v, want the scripted refusal", err)
+	}
+
+	for i, want := range []int{2, 1} {
+		turn, err := client.RunTurn(ctx, "hello")
+		if err != nil {
+			t.Fatalf("turn %d failed: %v", i+1, err)
+		}
+		if len(turn.Messages) != want {
+			t.Errorf("turn %d got %d messages, want %d", i+1, len(turn.Messages), want)
+		}
+	}
+	if tail := client.StderrTail(); len(tail) == 0 || tail[0] != "warming up" {
+		t.Errorf("StderrTail() = %q, want the scripted line", tail)
+	}
+
+	// initialize, set_model and two prompts
+	if received := cli.Received(); len(received) != 4 {
+		t.Errorf("CLI received %d lines, want 4: %q", len(received), received)
+	}
+}
+
+func TestScriptedCLI_Hang(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := claudetest.ScriptedCLI(t, claudetest.Scenario{
+		Steps: []claudetest.Step{claudetest.Hang()},
+	})
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithCloseTimeout(100 * time.Millisecond)
+	client, err := claude.NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// The CLI ignores the end of its input, so Close has to kill it
+	if err := client.Close(ctx); !types.IsProcessError(err) {
+		t.Errorf("Close = %v, want a ProcessError for the killed CLI", err)
+	}
+}
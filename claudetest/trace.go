@@ -0,0 +1,131 @@
+package claudetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/schema"
+)
+
+// StateEvent is the data of a DirectionState frame: one log record from the
+// SDK, such as "connect started" or "control request to CLI", with its
+// attributes. It is recorded as the state of a schema.KindState record.
+type StateEvent = schema.State
+
+// Logger returns a logger that records the SDK's log records as state frames
+// interleaved with the protocol frames, so a trace shows what the SDK was
+// doing between lines: connecting, which turn it sent, which control requests
+// were pending and when they were answered, and when Close began. Pass it to
+// the client with WithLogger:
+//
+//	rec := claudetest.NewRecordingTransport(realTransport, f)
+//	opts := types.NewClaudeAgentOptions().WithLogger(rec.Logger())
+//	client, err := claude.NewClientWithTransport(ctx, opts, rec)
+//
+// The per-line debug records ("wrote line", "received message") are left
+// out, since the frames record those lines themselves. Render the result with
+// tools/tracefmt -timeline.
+func (r *RecordingTransport) Logger() *slog.Logger {
+	return slog.New(&stateHandler{rec: r})
+}
+
+// stateHandler is the slog.Handler behind RecordingTransport.Logger.
+type stateHandler struct {
+	rec    *RecordingTransport
+	attrs  []slog.Attr
+	prefix string // Group prefix for attribute keys, such as "group."
+}
+
+// perLineRecords are left out of traces; the frames already record them.
+var perLineRecords = map[string]bool{
+	"claude: wrote line":       true,
+	"claude: received message": true,
+}
+
+func (h *stateHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *stateHandler) Handle(_ context.Context, record slog.Record) error {
+	if perLineRecords[record.Message] {
+		return nil
+	}
+
+	event := StateEvent{
+		Event: strings.TrimPrefix(record.Message, "claude: "),
+		Level: record.Level.String(),
+	}
+	add := func(key string, v slog.Value) {
+		if event.Attrs == nil {
+			event.Attrs = make(map[string]interface{})
+		}
+		event.Attrs[key] = stateValue(v)
+	}
+	for _, a := range h.attrs {
+		add(a.Key, a.Value)
+	}
+	record.Attrs(func(a slog.Attr) bool {
+		add(h.prefix+a.Key, a.Value)
+		return true
+	})
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	h.rec.record(DirectionState, data)
+	return nil
+}
+
+func (h *stateHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		c.attrs = append(c.attrs, slog.Attr{Key: h.prefix + a.Key, Value: a.Value})
+	}
+	return &c
+}
+
+func (h *stateHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.prefix = h.prefix + name + "."
+	return &c
+}
+
+// stateValue converts a log attribute to a JSON value. Durations and errors
+// are recorded as their string forms.
+func stateValue(v slog.Value) interface{} {
+	v = v.Resolve()
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case slog.KindGroup:
+		m := make(map[string]interface{})
+		for _, a := range v.Group() {
+			m[a.Key] = stateValue(a.Value)
+		}
+		return m
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return x.Error()
+		case fmt.Stringer:
+			return x.String()
+		}
+		if _, err := json.Marshal(v.Any()); err != nil {
+			return fmt.Sprint(v.Any())
+		}
+		return v.Any()
+	default:
+		return v.Any()
+	}
+}
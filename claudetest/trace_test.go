@@ -0,0 +1,146 @@
+package claudetest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"github.com/schlunsen/claude-agent-sdk-go/schema"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestRecordingTransportLogger tests that SDK state transitions are recorded
+// between the protocol frames they relate to, and that replay skips them.
+func TestRecordingTransportLogger(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	replay, err := claudetest.LoadReplay("testdata/permission_session.jsonl")
+	if err != nil {
+		t.Fatalf("LoadReplay failed: %v", err)
+	}
+	var buf bytes.Buffer
+	rec := claudetest.NewRecordingTransport(replay, &buf)
+
+	opts := types.NewClaudeAgentOptions().
+		WithLogger(rec.Logger()).
+		WithStrictProtocol(true).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return types.PermissionResultAllow{Behavior: "allow"}, nil
+		})
+	client, err := claude.NewClientWithTransport(ctx, opts, rec)
+	if err != nil {
+		t.Fatalf("NewClientWithTransport failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "List the files in the current directory"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range client.ReceiveResponse(ctx) {
+	}
+	_ = client.Close(ctx)
+
+	// Every line is a valid event record
+	for i, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if err := schema.Validate(line); err != nil {
+			t.Errorf("line %d: %v: %s", i+1, err, line)
+		}
+	}
+
+	frames, err := claudetest.ReadFrames(&buf)
+	if err != nil {
+		t.Fatalf("ReadFrames failed: %v", err)
+	}
+
+	// Render the trace as "dir event" lines to check the interleaving
+	var lines []string
+	var last time.Duration
+	for _, f := range frames {
+		if f.Offset < last {
+			t.Errorf("offset %v went backwards from %v", f.Offset, last)
+		}
+		last = f.Offset
+
+		if f.Direction != claudetest.DirectionState {
+			var msg struct {
+				Type string `json:"type"`
+			}
+			_ = json.Unmarshal(f.Data, &msg)
+			lines = append(lines, string(f.Direction)+" "+msg.Type)
+			continue
+		}
+		var event claudetest.StateEvent
+		if err := json.Unmarshal(f.Data, &event); err != nil {
+			t.Fatal(err)
+		}
+		line := "state " + event.Event
+		if turn, ok := event.Attrs["turn"]; ok {
+			line += " turn=" + strings.TrimSpace(jsonString(turn))
+		}
+		lines = append(lines, line)
+	}
+	got := strings.Join(lines, "\n")
+
+	for _, want := range []string{
+		"state connect started\nstate control request to CLI\nout control_request\nin control_response\nstate control response from CLI\nstate connect finished",
+		"out user\nstate query sent turn=1",
+		"in control_request\nstate control request from CLI handled\nout control_response",
+		"state close initiated",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("trace missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "wrote line") || strings.Contains(got, "received message") {
+		t.Errorf("per-line debug records were recorded:\n%s", got)
+	}
+
+	// The trace still replays; state frames are skipped
+	text, calls := runPermissionSession(t, ctx, claudetest.NewReplayTransport(frames))
+	if text == "" || calls != 1 {
+		t.Errorf("replay of trace got text %q and %d permission calls", text, calls)
+	}
+}
+
+func jsonString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// TestRecordingTransportLoggerAttrs tests how attributes are recorded.
+func TestRecordingTransportLoggerAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	rec := claudetest.NewRecordingTransport(claudetest.NewReplayTransport(nil), &buf)
+
+	logger := rec.Logger().With("client", 7).WithGroup("req")
+	logger.Info("claude: control request to CLI failed", "duration", 1500*time.Millisecond, "error", types.NewControlProtocolError("boom"))
+	logger.Debug("claude: wrote line", "bytes", 10)
+
+	frames, err := claudetest.ReadFrames(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0].Direction != claudetest.DirectionState {
+		t.Fatalf("got %d frames, want one state frame", len(frames))
+	}
+	var event claudetest.StateEvent
+	if err := json.Unmarshal(frames[0].Data, &event); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"client": float64(7), "req.duration": "1.5s", "req.error": "boom"}
+	if event.Event != "control request to CLI failed" || event.Level != "INFO" {
+		t.Errorf("event = %q at %s", event.Event, event.Level)
+	}
+	for k, v := range want {
+		if event.Attrs[k] != v {
+			t.Errorf("attrs[%q] = %v, want %v", k, event.Attrs[k], v)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package claudetest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// RecordedSpan is a span recorded by a TraceRecorder.
+type RecordedSpan struct {
+	Name   string
+	Parent string                 // Name of the parent span, empty for a root span
+	Attrs  map[string]interface{} // Attributes from Start and SetAttributes
+	Ended  bool
+	Err    error // Error passed to End
+}
+
+// TraceRecorder is an in-memory types.Tracer for asserting on the spans a
+// session creates. It is safe for concurrent use.
+//
+//	tracer := claudetest.NewTraceRecorder()
+//	opts := types.NewClaudeAgentOptions().WithTracer(tracer)
+//	// ... run a session ...
+//	if turns := tracer.Named(types.SpanTurn); len(turns) != 1 {
+//	    t.Errorf("recorded %d turns, want 1", len(turns))
+//	}
+type TraceRecorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+var _ types.Tracer = (*TraceRecorder)(nil)
+
+// NewTraceRecorder creates an empty TraceRecorder.
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{}
+}
+
+// recordedSpanKey is the context key of the span started by a TraceRecorder.
+type recordedSpanKey struct{}
+
+// Start implements types.Tracer.
+func (r *TraceRecorder) Start(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, types.Span) {
+	span := &RecordedSpan{Name: name, Attrs: make(map[string]interface{}, len(attrs))}
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*RecordedSpan); ok {
+		span.Parent = parent.Name
+	}
+	for k, v := range attrs {
+		span.Attrs[k] = v
+	}
+
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return context.WithValue(ctx, recordedSpanKey{}, span), &recorderSpan{recorder: r, span: span}
+}
+
+// Spans returns copies of the spans started so far, in order.
+func (r *TraceRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]RecordedSpan, len(r.spans))
+	for i, s := range r.spans {
+		spans[i] = *s
+		spans[i].Attrs = make(map[string]interface{}, len(s.Attrs))
+		for k, v := range s.Attrs {
+			spans[i].Attrs[k] = v
+		}
+	}
+	return spans
+}
+
+// Named returns copies of the spans with the given name, in order.
+func (r *TraceRecorder) Named(name string) []RecordedSpan {
+	var named []RecordedSpan
+	for _, s := range r.Spans() {
+		if s.Name == name {
+			named = append(named, s)
+		}
+	}
+	return named
+}
+
+// recorderSpan is the types.Span of a RecordedSpan.
+type recorderSpan struct {
+	recorder *TraceRecorder
+	span     *RecordedSpan
+}
+
+// SetAttributes implements types.Span.
+func (s *recorderSpan) SetAttributes(attrs map[string]interface{}) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	for k, v := range attrs {
+		s.span.Attrs[k] = v
+	}
+}
+
+// End implements types.Span.
+func (s *recorderSpan) End(err error) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.span.Ended = true
+	s.span.Err = err
+}
@@ -0,0 +1,138 @@
+package claudetest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// writeTracingCLI writes a mock CLI that runs one turn on the first user
+// message: it asks permission for Bash and finishes once the permission
+// request is answered. Later user messages are ignored.
+func writeTracingCLI(t *testing.T) string {
+	t.Helper()
+	return claudetest.ScriptedCLI(t, claudetest.Scenario{Steps: []claudetest.Step{
+		claudetest.AwaitPrompt(),
+		claudetest.Send(
+			`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"ls"}}]}}`,
+			`{"type":"control_request","request_id":"req_perm_1","request":{"subtype":"can_use_tool","tool_name":"Bash","tool_use_id":"toolu_1","input":{"command":"ls"}}}`,
+		),
+		claudetest.AwaitResponse("req_perm_1"),
+		claudetest.Send(`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":2,"session_id":"s1","total_cost_usd":0.02,"usage":{"input_tokens":10,"cache_read_input_tokens":90,"output_tokens":7}}`),
+	}}).Path
+}
+
+func TestTraceRecorderClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tracer := claudetest.NewTraceRecorder()
+	opts := types.NewClaudeAgentOptions().
+		WithModel("sonnet").
+		WithTracer(tracer).
+		WithStrictProtocol(true).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return &types.PermissionResultDeny{Behavior: "deny", Message: "no"}, nil
+		}).
+		WithCLIPath(writeTracingCLI(t))
+	client, err := claude.NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// The caller's span is the parent of the turn
+	parentCtx, parent := tracer.Start(ctx, "request", nil)
+	if _, err := client.RunTurn(parentCtx, "List the files"); err != nil {
+		t.Fatalf("RunTurn failed: %v", err)
+	}
+	parent.End(nil)
+	if err := client.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	var names []string
+	for _, s := range tracer.Spans() {
+		names = append(names, s.Name)
+		if !s.Ended {
+			t.Errorf("span %s was not ended", s.Name)
+		}
+	}
+	want := []string{types.SpanConnect, types.SpanInitialize, "request", types.SpanTurn, types.SpanPermission, types.SpanClose}
+	if len(names) != len(want) {
+		t.Fatalf("spans = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("spans = %v, want %v", names, want)
+		}
+	}
+
+	connect := tracer.Named(types.SpanConnect)[0]
+	if connect.Attrs[types.AttrModel] != "sonnet" || connect.Attrs[types.AttrCLIVersion] != client.CLIVersion() || connect.Err != nil {
+		t.Errorf("connect span = %+v", connect)
+	}
+	if init := tracer.Named(types.SpanInitialize)[0]; init.Parent != types.SpanConnect {
+		t.Errorf("initialize span parent = %q, want %q", init.Parent, types.SpanConnect)
+	}
+
+	turn := tracer.Named(types.SpanTurn)[0]
+	if turn.Parent != "request" || turn.Err != nil {
+		t.Errorf("turn span = %+v, want a child of request without error", turn)
+	}
+	wantAttrs := map[string]interface{}{
+		types.AttrModel:         "claude-sonnet-4-5",
+		types.AttrSessionID:     "s1",
+		types.AttrNumTurns:      2,
+		types.AttrCostUSD:       0.02,
+		types.AttrInputTokens:   100,
+		types.AttrOutputTokens:  7,
+		types.AttrResultSubtype: "success",
+		types.AttrIsError:       false,
+	}
+	for k, v := range wantAttrs {
+		if turn.Attrs[k] != v {
+			t.Errorf("turn attribute %s = %v, want %v", k, turn.Attrs[k], v)
+		}
+	}
+
+	perm := tracer.Named(types.SpanPermission)[0]
+	if perm.Parent != types.SpanTurn {
+		t.Errorf("permission span parent = %q, want %q", perm.Parent, types.SpanTurn)
+	}
+	if perm.Attrs[types.AttrToolName] != "Bash" || perm.Attrs[types.AttrToolUseID] != "toolu_1" || perm.Attrs[types.AttrPermissionResult] != "deny" {
+		t.Errorf("permission span attributes = %v", perm.Attrs)
+	}
+}
+
+func TestTraceRecorderClosePendingTurn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tracer := claudetest.NewTraceRecorder()
+	opts := types.NewClaudeAgentOptions().
+		WithTracer(tracer).
+		WithCLIPath(writeTracingCLI(t))
+	client, err := claude.NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "Never answered"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	_ = client.Close(ctx)
+
+	turns := tracer.Named(types.SpanTurn)
+	if len(turns) != 1 || !turns[0].Ended || turns[0].Err == nil {
+		t.Errorf("turn spans = %+v, want one ended with an error", turns)
+	}
+}
@@ -2,12 +2,15 @@ package claude
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"runtime/pprof"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/schlunsen/claude-agent-sdk-go/internal"
-	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
@@ -63,17 +66,64 @@ import (
 //
 // Thread Safety:
 //
-// Client is not thread-safe. All methods should be called from the same goroutine,
-// or you must provide your own synchronization.
+// Client is safe for concurrent use. A typical server calls Query from one
+// goroutine while another drains ReceiveResponse:
+//
+//   - Connection state is guarded by a mutex; Connect and Close hold it for
+//     the whole handshake or shutdown, so other calls wait for them.
+//   - Writes to the CLI (prompts, EndInput, control responses) are serialized,
+//     so concurrent Query calls never interleave partial lines.
+//   - Close may run while ReceiveResponse is being drained: the channel is
+//     closed and pending Interrupt calls return an error.
+//
+// Messages from the CLI are shared by all ReceiveResponse channels, so only
+// one goroutine should drain responses at a time; with several, each
+// message is delivered to just one of them.
 type Client struct {
 	options   *types.ClaudeAgentOptions
-	transport transport.Transport
+	transport Transport
+	conn      *lockedTransport // transport with writes serialized
 	query     *internal.Query
 
-	mu        sync.Mutex
-	connected bool
-	ctx       context.Context
-	cancel    context.CancelFunc
+	// newTransport starts over after a failed Connect attempt; nil for
+	// clients over a caller's transport, which are not retried
+	newTransport func() (Transport, error)
+
+	mu             sync.Mutex
+	connected      bool
+	closed         bool // set by Close; a closed client cannot connect again
+	paused         bool // set by Pause until Resume has sent the held prompts
+	heldPrompts    []heldPrompt
+	resumeMu       sync.Mutex // serializes Resume, apart from mu so it can write
+	cliVersion     string
+	transcriptPath string          // kept from the last query so it survives Close
+	drained        []types.Message // read by Close during the WithDrainOnClose window
+	initResult     map[string]interface{}
+	capabilities   *types.Capabilities // nil when the CLI reports none
+	budget         *costBudget
+	governor       *Governor // set by Governor.Attach
+	tools          toolCatalog
+	usage          sessionUsage      // token usage of the results received
+	history        messageHistory    // segments and messages kept per WithMessageHistory
+	subscribers    *subscribers      // subscriptions to the current connection's messages
+	costs          costMeter         // session cost reported to the MetricsSink
+	transcript     *TranscriptWriter // nil unless WithTranscript is set
+	screening      screeningFlags
+	intercepted    interceptedResults
+	interceptors   []ClientInterceptor
+	streaming      bool                 // whether partial messages are delivered, per SetStreaming
+	dropStreaming  atomic.Bool          // ReceiveResponse drops StreamEvents; SetStreaming without CLI support
+	permissionMode types.PermissionMode // current mode, per SetPermissionMode
+	turn           *turnOverride        // settings to restore when a QueryWithOptions turn ends
+	traceMu        sync.Mutex           // guards traceTurns, apart from mu so spans never wait for Close
+	traceTurns     []*tracedTurn        // turns awaiting their result when tracing, oldest first
+	turns          atomic.Int64         // prompts written to the CLI, numbering "query sent" logs
+	ctx            context.Context
+	cancel         context.CancelFunc
+
+	// Registry ID and the pprof labels its goroutines carry
+	id     uint64
+	labels pprof.LabelSet
 }
 
 // NewClient creates a new interactive client with the given options.
@@ -82,67 +132,114 @@ type Client struct {
 //
 // Parameters:
 //   - ctx: Parent context for the client lifecycle
-//   - options: Configuration options (nil uses defaults)
+//   - options: Configuration options (nil uses defaults); copied on entry and never modified
 //
 // Returns:
 //   - A new Client instance
 //   - An error if the CLI cannot be found or options are invalid
+//     (including a WorkingDirectoryError for an unusable CWD)
 func NewClient(ctx context.Context, options *types.ClaudeAgentOptions) (*Client, error) {
 	// Use default options if not provided
 	if options == nil {
 		options = types.NewClaudeAgentOptions()
+	} else {
+		// Copy on entry so the caller's options can be shared across goroutines
+		options = options.Clone()
 	}
 
-	// Validate permission callback configuration
-	if options.CanUseTool != nil && options.PermissionPromptToolName != nil {
-		return nil, fmt.Errorf("can_use_tool callback cannot be used with permission_prompt_tool_name")
+	if err := preparePermissionOptions(options); err != nil {
+		return nil, err
 	}
 
-	// If CanUseTool is provided, automatically set PermissionPromptToolName to "stdio"
-	if options.CanUseTool != nil && options.PermissionPromptToolName == nil {
-		stdio := "stdio"
-		options.PermissionPromptToolName = &stdio
+	// Create subprocess transport
+	transportInst, err := newSubprocessTransport(options)
+	if err != nil {
+		return nil, err
 	}
 
-	// Find CLI path
-	cliPath := ""
-	if options.CLIPath != nil {
-		cliPath = *options.CLIPath
+	c := newClient(ctx, options, transportInst)
+	c.newTransport = func() (Transport, error) {
+		return newSubprocessTransport(options.Clone())
+	}
+	return c, nil
+}
+
+// NewClientWithTransport is like NewClient but communicates over the given
+// transport instead of spawning the CLI. CLI discovery and working directory
+// options are ignored. It is mainly useful with the record/replay transports in claudetest.
+func NewClientWithTransport(ctx context.Context, options *types.ClaudeAgentOptions, t Transport) (*Client, error) {
+	if options == nil {
+		options = types.NewClaudeAgentOptions()
 	} else {
-		var err error
-		cliPath, err = transport.FindCLI()
-		if err != nil {
-			return nil, err
-		}
+		options = options.Clone()
+	}
+
+	if t == nil {
+		return nil, fmt.Errorf("transport cannot be nil")
 	}
 
-	// Determine working directory
-	cwd := ""
-	if options.CWD != nil {
-		cwd = *options.CWD
+	if err := preparePermissionOptions(options); err != nil {
+		return nil, err
 	}
 
-	// Prepare environment
-	env := make(map[string]string)
-	if options.Env != nil {
-		for k, v := range options.Env {
-			env[k] = v
+	return newClient(ctx, options, t), nil
+}
+
+// preparePermissionOptions validates the permission callback configuration,
+// installs the permission policy as CanUseTool, and when CanUseTool is set
+// routes permission prompts over stdio.
+func preparePermissionOptions(options *types.ClaudeAgentOptions) error {
+	if options.PermissionPolicy != nil {
+		if err := installPermissionPolicy(options); err != nil {
+			return err
 		}
 	}
+	if _, err := abandonedPolicy(options); err != nil {
+		return err
+	}
 
-	// Create subprocess transport
-	transportInst := transport.NewSubprocessCLITransport(cliPath, cwd, env)
+	if options.CanUseTool != nil && options.PermissionPromptToolName != nil {
+		return fmt.Errorf("can_use_tool callback cannot be used with permission_prompt_tool_name")
+	}
+
+	switch options.PermissionPrecedence {
+	case "", types.PermissionPrecedenceHook, types.PermissionPrecedenceCallback:
+	default:
+		return fmt.Errorf("unknown permission precedence %q", options.PermissionPrecedence)
+	}
+
+	if options.CanUseTool != nil && options.PermissionPromptToolName == nil {
+		stdio := "stdio"
+		options.PermissionPromptToolName = &stdio
+	}
+
+	return nil
+}
+
+// newClient creates a disconnected client over the given transport.
+func newClient(ctx context.Context, options *types.ClaudeAgentOptions, transportInst Transport) *Client {
+	logDeprecations(options.Logger)
 
 	// Create client context
 	clientCtx, cancel := context.WithCancel(ctx)
 
-	return &Client{
+	c := &Client{
 		options:   options,
 		transport: transportInst,
+		conn:      &lockedTransport{Transport: transportInst},
 		connected: false,
+		budget:    newCostBudget(options),
+		streaming: options.IncludePartialMessages,
 		ctx:       clientCtx,
 		cancel:    cancel,
-	}, nil
+	}
+	c.history.limit = options.MessageHistory
+	c.permissionMode = types.PermissionModeDefault
+	if options.PermissionMode != nil {
+		c.permissionMode = *options.PermissionMode
+	}
+	registerClient(c)
+	return c
 }
 
 // Connect establishes a connection to Claude Code CLI in streaming mode.
@@ -151,10 +248,23 @@ func NewClient(ctx context.Context, options *types.ClaudeAgentOptions) (*Client,
 // which enables full control protocol support including permissions, hooks, and
 // bidirectional communication.
 //
+// Starting the CLI and the initialize handshake are bounded by
+// WithConnectTimeout (DefaultConnectTimeout unless configured), independent of
+// any deadline on ctx. The CLI subprocess itself still lives until ctx is done
+// or Close is called.
+//
+// With WithRetry, a transient failure to start the CLI or complete the
+// handshake is retried with a new CLI process; the connect timeout applies
+// to each attempt.
+//
 // Returns an error if:
-//   - Already connected
+//   - Already connected, or closed
+//   - The CLI is older than the WithMinCLIVersion minimum (UnsupportedCLIVersionError)
 //   - CLI subprocess fails to start
+//   - The connect timeout expires (CLIConnectionError naming the phase)
 //   - Initialization fails
+//   - The CLI's reported capabilities lack one that an option needs, such as
+//     WithIncludePartialMessages (UnsupportedFeatureError)
 //
 // Example:
 //
@@ -164,39 +274,151 @@ func NewClient(ctx context.Context, options *types.ClaudeAgentOptions) (*Client,
 //	    }
 //	    log.Fatal(err)
 //	}
-func (c *Client) Connect(ctx context.Context) error {
+func (c *Client) Connect(ctx context.Context) (err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.connected {
 		return types.NewControlProtocolError("client already connected")
 	}
+	if c.closed {
+		return types.NewCLIConnectionError("client is closed")
+	}
+
+	// Goroutines started while connecting carry the client's pprof labels
+	start := time.Now()
+	logState(c.options, "connect started")
+	ctx, span := startSpan(c.options, ctx, types.SpanConnect, connectAttrs(c.options))
+	pprof.Do(ctx, c.labels, func(ctx context.Context) {
+		retry := newRetrier(c.options)
+		for {
+			err = c.connectLocked(ctx)
+			if err == nil || c.newTransport == nil || !retry.wait(ctx, "connect", err) {
+				return
+			}
+			if err = c.resetTransport(); err != nil {
+				return
+			}
+		}
+	})
+	endSpan(span, map[string]interface{}{types.AttrCLIVersion: c.cliVersion}, err)
+	recordConnect(c.options, start, err)
+	if err != nil {
+		logState(c.options, "connect finished", "duration", time.Since(start), "error", err)
+	} else {
+		logState(c.options, "connect finished", "duration", time.Since(start))
+	}
+	return err
+}
+
+// connectLocked starts the transport and initializes the control protocol.
+// c.mu must be held.
+func (c *Client) connectLocked(ctx context.Context) error {
+	// Bound the whole handshake independently of the caller's context
+	timeout := connectTimeout(c.options)
+	connectCtx, cancelConnect := withConnectTimeout(ctx, timeout)
+	defer cancelConnect()
+
+	// Detect the CLI version before starting a session it may not support
+	version, err := detectCLIVersion(connectCtx, c.transport, c.options)
+	c.cliVersion = version
+	if err != nil {
+		return err
+	}
+	if err := connectTimeoutError(ctx, connectCtx, timeout, connectPhaseVersion); err != nil {
+		return err
+	}
 
 	// Connect transport
-	if err := c.transport.Connect(ctx); err != nil {
+	if err := connectTransport(ctx, connectCtx, c.transport); err != nil {
+		if terr := connectTimeoutError(ctx, connectCtx, timeout, connectPhaseStart); terr != nil {
+			return terr
+		}
 		return types.NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", err)
 	}
 
 	// Create query handler in streaming mode
-	c.query = internal.NewQuery(ctx, c.transport, c.options, true)
+	c.query = internal.NewQuery(ctx, c.conn, c.options, true)
+	if evaluate, err := abandonedPolicy(c.options); err == nil && evaluate != nil {
+		c.query.SetAbandonedPolicy(evaluate)
+	}
+	c.startTranscript()
+	c.subscribers = &subscribers{}
+	c.query.AddMessageObserver(c.subscribers.publish)
+	if c.options.Tracer != nil {
+		c.query.SetTracer(c.options.Tracer, c.traceParent)
+	}
+	if c.options.ToolResultScreener != nil {
+		c.query.AddHook(types.HookEventPostToolUse, screeningHook(c.options, &c.screening))
+	}
+	for _, matcher := range interceptorHooks(c.options, &c.intercepted) {
+		c.query.AddHook(types.HookEventPreToolUse, matcher)
+	}
 
 	// Start message processing
-	if err := c.query.Start(ctx); err != nil {
-		_ = c.transport.Close(ctx)
+	if err := startQuery(c.query, ctx); err != nil {
+		c.abortConnect()
 		return err
 	}
+	go c.subscribers.endWhenDone(c.query.Done())
 
 	// Initialize control protocol
-	if _, err := c.query.Initialize(ctx); err != nil {
-		_ = c.query.Stop(ctx)
-		_ = c.transport.Close(ctx)
+	_, initSpan := startSpan(c.options, connectCtx, types.SpanInitialize, nil)
+	initResult, err := c.query.Initialize(connectCtx)
+	endSpan(initSpan, nil, err)
+	if err != nil {
+		c.abortConnect()
+		if terr := connectTimeoutError(ctx, connectCtx, timeout, connectPhaseInitialize); terr != nil {
+			return terr
+		}
 		return types.NewControlProtocolErrorWithCause("failed to initialize control protocol", err)
 	}
 
+	// Refuse options the CLI has said it cannot honour
+	caps := parseCapabilities(initResult)
+	if err := checkOptionCapabilities(caps, c.options); err != nil {
+		c.abortConnect()
+		return err
+	}
+
+	// Tool names as reported now; the init message of each turn updates them
+	names, _ := toolNames(initResult["tools"])
+	c.tools.setNames(names)
+	mcpTools, err := c.query.ListMCPTools()
+	if err != nil {
+		logState(c.options, "listing MCP tools failed", "error", err)
+	}
+	c.tools.setMCP(mcpTools)
+
+	c.initResult = initResult
+	c.capabilities = caps
 	c.connected = true
 	return nil
 }
 
+// GetServerInfo returns what the CLI reported about the session when Connect
+// initialized it: available slash commands, output styles, models, and
+// account details, plus the complete response in ServerInfo.Raw for fields
+// this SDK version does not decode. CLIVersion is the version detected by
+// Connect.
+//
+// Returns a CLIConnectionError if the client is not connected.
+func (c *Client) GetServerInfo() (*types.ServerInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return nil, types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+
+	info, err := types.ParseServerInfo(c.initResult)
+	if err != nil {
+		return nil, err
+	}
+	info.CLIVersion = c.cliVersion
+	return info, nil
+}
+
 // Query sends a prompt to Claude in the current session.
 //
 // This returns immediately after sending the prompt. Use ReceiveResponse() to
@@ -211,6 +433,10 @@ func (c *Client) Connect(ctx context.Context) error {
 //
 // Returns an error if:
 //   - Not connected (call Connect() first)
+//   - The CLI stopped producing output (TransportBrokenError)
+//   - The WithMaxCostUSD budget, or that of the client's Governor, was
+//     exceeded (BudgetExceededError)
+//   - The prompt's estimated size exceeds WithMaxPromptTokens (PromptTooLargeError)
 //   - Write to CLI fails
 //   - Context is cancelled
 //
@@ -225,42 +451,293 @@ func (c *Client) Connect(ctx context.Context) error {
 //	    // Process messages
 //	}
 func (c *Client) Query(ctx context.Context, prompt string) error {
+	return c.sendUserMessage(ctx, types.NewUserMessage(prompt))
+}
+
+// QueryWithContent is like Query but sends a prompt made of content blocks,
+// such as text alongside an image. Blocks are sent under message.content in
+// the order given.
+//
+// Example:
+//
+//	img, err := os.ReadFile("screenshot.png")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = client.QueryWithContent(ctx, []types.ContentBlock{
+//	    types.NewTextBlock("What is wrong with this page?"),
+//	    types.NewImageBlock("image/png", img),
+//	})
+func (c *Client) QueryWithContent(ctx context.Context, blocks []types.ContentBlock) error {
+	return c.sendUserMessage(ctx, types.NewUserMessage(blocks))
+}
+
+// QueryWithMessage is like Query but sends a complete user message, such as
+// one built with types.NewUserMessage. Its Content is a string or
+// []types.ContentBlock, and ParentToolUseID and SessionID are passed
+// through, for example to answer within a subagent's conversation.
+func (c *Client) QueryWithMessage(ctx context.Context, msg *types.UserMessage) error {
+	if msg == nil {
+		return fmt.Errorf("message cannot be nil")
+	}
+	m := *msg // Interceptors may change the message; leave the caller's alone
+	return c.sendUserMessage(ctx, &m)
+}
+
+// sendUserMessage runs a user message through the client's interceptors
+// and writes it to the CLI.
+func (c *Client) sendUserMessage(ctx context.Context, msg *types.UserMessage) error {
+	c.mu.Lock()
+	send := ChainInterceptors(c.interceptors...)(c.writeUserMessage)
+	c.mu.Unlock()
+
+	return send(ctx, msg)
+}
+
+// writeUserMessage validates msg and writes it to the CLI. It is the last
+// step of the interceptor chain.
+func (c *Client) writeUserMessage(ctx context.Context, msg *types.UserMessage) error {
 	c.mu.Lock()
 	if !c.connected {
 		c.mu.Unlock()
 		return types.NewCLIConnectionError("not connected - call Connect() first")
 	}
+	if err := c.brokenErr(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if err := c.budget.err(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if err := c.governor.err(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if c.turn != nil && ctx.Value(turnPromptKey{}) != c.turn {
+		c.mu.Unlock()
+		return types.NewTurnInProgressError("cannot send a prompt while a QueryWithOptions turn is in progress")
+	}
 	c.mu.Unlock()
 
-	// Validate prompt
-	if prompt == "" {
-		return fmt.Errorf("prompt cannot be empty")
+	// Validate and build the message
+	line, err := userMessageLine(msg, "default")
+	if err != nil {
+		return err
+	}
+	if err := checkPromptSize(c.options, promptText(msg.Content)); err != nil {
+		return err
 	}
 
-	// Build query message
-	queryMsg := map[string]interface{}{
-		"type": "user",
-		"message": map[string]interface{}{
-			"role":    "user",
-			"content": prompt,
-		},
-		"parent_tool_use_id": nil,
-		"session_id":         "default",
+	// Hold the prompt while paused; Resume sends it
+	topLevel := msg.ParentToolUseID == nil
+	if !c.queueWhilePaused(line, topLevel) {
+		if err := c.writePrompt(ctx, line, topLevel); err != nil {
+			return err
+		}
 	}
+	c.history.observe(msg)
+	return nil
+}
 
-	// Marshal and send
-	data, err := json.Marshal(queryMsg)
-	if err != nil {
-		return types.NewControlProtocolErrorWithCause("failed to marshal query", err)
+// writePrompt writes an encoded user message to the CLI. A top-level prompt
+// starts a turn.
+func (c *Client) writePrompt(ctx context.Context, line string, topLevel bool) error {
+	if err := c.conn.Write(ctx, line); err != nil {
+		return err
+	}
+	if topLevel {
+		c.startTurnSpan(ctx)
+	}
+	recordQuery(c.options)
+	logState(c.options, "query sent", "turn", c.turns.Add(1))
+	return nil
+}
+
+// EndInput signals the CLI that no more input will be sent by closing its stdin.
+//
+// Messages already in flight keep arriving through ReceiveResponse until the CLI
+// finishes and closes its output. After EndInput, Query returns an InputClosedError.
+// Since control responses are written to stdin as well, permission callbacks and
+// hooks can no longer be answered once input is closed.
+//
+// Calling EndInput more than once is a no-op.
+//
+// Example:
+//
+//	if err := client.Query(ctx, "Summarize the repository"); err != nil {
+//	    log.Fatal(err)
+//	}
+//	if err := client.EndInput(ctx); err != nil {
+//	    log.Fatal(err)
+//	}
+//	for msg := range client.ReceiveResponse(ctx) {
+//	    // Process messages
+//	}
+func (c *Client) EndInput(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+
+	return c.conn.EndInput(ctx)
+}
+
+// Interrupt asks Claude to stop the current turn.
+//
+// The CLI still finishes the turn with a ResultMessage, so ReceiveResponse
+// should be drained as usual. Interrupt blocks until the CLI acknowledges the
+// request or ctx is done.
+//
+// Returns an UnsupportedFeatureError if the CLI reported capabilities without
+// supportsInterrupt.
+func (c *Client) Interrupt(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return types.NewCLIConnectionError("not connected - call Connect() first")
 	}
+	if err := c.capabilities.Require("Interrupt", types.CapabilityInterrupt); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	query := c.query
+	c.mu.Unlock()
 
-	if err := c.transport.Write(ctx, string(data)); err != nil {
+	return query.Interrupt(ctx)
+}
+
+// SetPermissionMode changes the permission mode of the running session, for
+// example to types.PermissionModeAcceptEdits once the user trusts the plan.
+// It blocks until the CLI acknowledges the change or ctx is done.
+//
+// Returns an UnsupportedFeatureError if the CLI reported capabilities without
+// supportsSetPermissionMode.
+func (c *Client) SetPermissionMode(ctx context.Context, mode types.PermissionMode) error {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+	if err := c.capabilities.Require("SetPermissionMode", types.CapabilitySetPermissionMode); err != nil {
+		c.mu.Unlock()
 		return err
 	}
+	query := c.query
+	c.mu.Unlock()
 
+	if err := query.SetPermissionMode(ctx, string(mode)); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.permissionMode = mode
+	c.mu.Unlock()
 	return nil
 }
 
+// SetModel switches the model used for the following turns of the session,
+// for example to escalate a hard question from a cheaper model. An empty
+// model switches back to the CLI's default. It blocks until the CLI
+// acknowledges the change or ctx is done; call it between turns.
+//
+// Returns an UnsupportedFeatureError if the CLI reported capabilities without
+// supportsSetModel, or if a CLI that reports none answers that it does not
+// know the request. Any other refusal, such as an unknown model name, is
+// returned as a ControlProtocolError carrying the CLI's message.
+//
+// Example:
+//
+//	if err := client.SetModel(ctx, "claude-opus-4-1"); err != nil {
+//	    log.Fatal(err)
+//	}
+//	client.Query(ctx, "Now prove it")
+func (c *Client) SetModel(ctx context.Context, model string) error {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+	if err := c.capabilities.Require("SetModel", types.CapabilitySetModel); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	query := c.query
+	c.mu.Unlock()
+
+	err := query.SetModel(ctx, model)
+	if isUnsupportedRequest(err, "set_model") {
+		return types.NewUnsupportedFeatureError("SetModel", types.CapabilitySetModel)
+	}
+	return err
+}
+
+// SetStreaming turns delivery of partial messages (StreamEvents) on or off
+// for the following turns, for example to stream an interactive turn but not
+// the background turns of the same session. It blocks until the change takes
+// effect or ctx is done; call it between turns.
+//
+// When the CLI reports supportsSetPartialMessages, or reports no capabilities
+// and accepts the request, the CLI itself stops or starts producing partial
+// messages. Otherwise the SDK drops them before ReceiveResponse delivers
+// them, which only works for a session connected with
+// WithIncludePartialMessages: enabling streaming for any other session then
+// returns an UnsupportedFeatureError.
+func (c *Client) SetStreaming(ctx context.Context, enabled bool) error {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+	query := c.query
+	viaCLI := c.capabilities.Supports(types.CapabilitySetPartialMessages)
+	c.mu.Unlock()
+
+	if viaCLI {
+		err := query.SetIncludePartialMessages(ctx, enabled)
+		if err == nil {
+			c.mu.Lock()
+			c.streaming = enabled
+			c.dropStreaming.Store(false)
+			c.mu.Unlock()
+			return nil
+		}
+		if !isUnsupportedRequest(err, "set_include_partial_messages") {
+			return err
+		}
+	}
+
+	if enabled && !c.options.IncludePartialMessages {
+		return types.NewUnsupportedFeatureError("SetStreaming", types.CapabilitySetPartialMessages)
+	}
+	c.mu.Lock()
+	c.streaming = enabled
+	c.dropStreaming.Store(!enabled)
+	c.mu.Unlock()
+	return nil
+}
+
+// isStreaming reports whether partial messages are currently delivered.
+func (c *Client) isStreaming() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streaming
+}
+
+// isUnsupportedRequest reports whether err is the CLI's answer that it does
+// not handle control requests of the given subtype, such as "Unsupported
+// control request subtype: set_model".
+func isUnsupportedRequest(err error, subtype string) bool {
+	var cpe *types.ControlProtocolError
+	if !errors.As(err, &cpe) {
+		return false
+	}
+	msg := strings.ToLower(cpe.Message)
+	return strings.Contains(msg, subtype) &&
+		(strings.Contains(msg, "unsupported") || strings.Contains(msg, "unknown"))
+}
+
 // ReceiveResponse returns a channel of response messages from Claude.
 //
 // This should be called after Query() to receive the response. The channel will
@@ -277,16 +754,30 @@ func (c *Client) Query(ctx context.Context, prompt string) error {
 //   - An error occurs
 //   - The context is cancelled
 //
+// If a message pushes the session over the WithMaxCostUSD limit, the session
+// is interrupted and a SystemMessage with subtype "budget_exceeded" follows
+// that message. Crossed by the estimated cost of an AssistantMessage, the
+// turn is stopped while it runs, and its ResultMessage still ends the
+// channel.
+//
+// Errors are delivered in-band as SystemMessages whose Err field holds the
+// typed error:
+//   - "parse_error" for a line that could not be parsed; the stream continues
+//   - "transport_failed" when the transport fails, after which the channel
+//     closes and Err returns the same error. If the CLI closed its output
+//     while still running, subsequent Query calls fail with a
+//     TransportBrokenError.
+//
+// With WithSyntheticResults, a turn abandoned without a ResultMessage, after
+// "transport_failed", "idle_timeout" or the end of the CLI's output, still
+// ends with one: see ResultMessage.IsSynthetic.
+//
 // Example:
 //
 //	for msg := range client.ReceiveResponse(ctx) {
 //	    switch m := msg.(type) {
 //	    case *types.AssistantMessage:
-//	        for _, block := range m.Content {
-//	            if tb, ok := block.(*types.TextBlock); ok {
-//	                fmt.Println("Claude:", tb.Text)
-//	            }
-//	        }
+//	        fmt.Println("Claude:", m.Text())
 //	    case *types.ResultMessage:
 //	        fmt.Printf("Done. Cost: $%.4f\n", *m.TotalCostUSD)
 //	    }
@@ -294,7 +785,7 @@ func (c *Client) Query(ctx context.Context, prompt string) error {
 func (c *Client) ReceiveResponse(ctx context.Context) <-chan types.Message {
 	outputChan := make(chan types.Message, 10)
 
-	go func() {
+	c.goLabeled(func() {
 		defer close(outputChan)
 
 		c.mu.Lock()
@@ -305,21 +796,86 @@ func (c *Client) ReceiveResponse(ctx context.Context) <-chan types.Message {
 		messagesChan := c.query.GetMessages(ctx)
 		c.mu.Unlock()
 
+		start := time.Now()
+		idle := newIdleTimer(c.options)
+		defer idle.Stop()
+		turn := newTurnTracker(c.options, start)
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case <-idle.C():
+				err := idle.Err()
+				if c.stopIdle(ctx, err, outputChan) {
+					sendResult(ctx, outputChan, turn.abandoned(err))
+				}
+				return
 			case msg, ok := <-messagesChan:
 				if !ok {
-					// Messages channel closed
+					// Messages channel closed - report why, if the transport failed
+					err := c.transport.GetError()
+					if err != nil {
+						select {
+						case outputChan <- transportFailedMessage(err):
+						case <-ctx.Done():
+							return
+						}
+					}
+					sendResult(ctx, outputChan, turn.abandoned(err))
 					return
 				}
 
+				idle.Reset()
+				turn.observe(msg)
+				c.intercepted.apply(msg)
+				recordMessage(c.options, &c.costs, msg, start)
+				c.tools.observe(msg)
+				c.usage.observe(msg)
+				c.history.observe(msg)
+				c.traceMessage(msg)
+				c.mu.Lock()
+				governor := c.governor
+				c.mu.Unlock()
+				governor.charge(c, msg)
+				if _, ok := msg.(*types.StreamEvent); ok && c.dropStreaming.Load() {
+					continue
+				}
+
+				// Report flagged tool results just before the results themselves
+				for _, flag := range c.screening.take(msg) {
+					select {
+					case outputChan <- flag:
+					case <-ctx.Done():
+						return
+					}
+				}
+
+				// The turn is over: put back what QueryWithOptions changed
+				// before the caller can start the next one
+				_, isResult := msg.(*types.ResultMessage)
+				var restoreErr error
+				if isResult {
+					restoreErr = c.endTurn(ctx)
+				}
+
 				// Forward message to output
 				select {
 				case outputChan <- msg:
+					c.checkBudget(ctx, msg, outputChan)
+					// The CLI reported an error instead of ending the turn
+					if result := turn.failed(msg); result != nil {
+						sendResult(ctx, outputChan, result)
+						return
+					}
 					// Check if this is a result message (end of response)
-					if _, isResult := msg.(*types.ResultMessage); isResult {
+					if isResult {
+						if restoreErr != nil {
+							select {
+							case outputChan <- turnRestoreFailedMessage(restoreErr):
+							case <-ctx.Done():
+							}
+						}
 						return
 					}
 				case <-ctx.Done():
@@ -327,11 +883,70 @@ func (c *Client) ReceiveResponse(ctx context.Context) <-chan types.Message {
 				}
 			}
 		}
-	}()
+	})
 
 	return outputChan
 }
 
+// stopIdle records an idle timeout, stops the silent CLI, and emits an
+// idle_timeout SystemMessage, reporting whether it was delivered. Later
+// queries fail with the timeout error.
+func (c *Client) stopIdle(ctx context.Context, err *types.IdleTimeoutError, outputChan chan<- types.Message) bool {
+	c.transport.OnError(err)
+
+	// Closing the transport kills the process; Close still tears down the rest
+	closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	_ = c.transport.Close(closeCtx)
+	cancel()
+
+	select {
+	case outputChan <- idleTimeoutMessage(err):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// transportFailedMessage builds the SystemMessage emitted when the transport breaks.
+func transportFailedMessage(err error) *types.SystemMessage {
+	return &types.SystemMessage{
+		Type:    types.MessageTypeSystem,
+		Subtype: "transport_failed",
+		Data: map[string]interface{}{
+			"error": err.Error(),
+		},
+		Err: err,
+	}
+}
+
+// checkBudget records the cost of a message and, if it crosses the budget,
+// interrupts the session and emits a budget_exceeded SystemMessage. Crossed
+// by an AssistantMessage, the interrupt stops the turn that is running.
+func (c *Client) checkBudget(ctx context.Context, msg types.Message, outputChan chan<- types.Message) {
+	c.mu.Lock()
+	if !c.budget.observe(msg) {
+		c.mu.Unlock()
+		return
+	}
+	notice := c.budget.message()
+	query := c.query
+	clientCtx := c.ctx
+	c.mu.Unlock()
+
+	if query != nil {
+		go func() {
+			interruptCtx, cancel := context.WithTimeout(clientCtx, 5*time.Second)
+			defer cancel()
+			_ = query.Interrupt(interruptCtx)
+		}()
+	}
+
+	select {
+	case outputChan <- notice:
+	case <-ctx.Done():
+	}
+}
+
 // Close gracefully terminates the Claude session and cleans up resources.
 //
 // This should be called when you're done with the client, typically using defer:
@@ -342,16 +957,31 @@ func (c *Client) ReceiveResponse(ctx context.Context) <-chan types.Message {
 //	}
 //	defer client.Close(ctx)
 //
-// After Close() is called, the client cannot be reused. Create a new client if needed.
+// After Close() is called, the client cannot be reused: Connect returns a
+// CLIConnectionError. Create a new client if needed. The CLI is given the
+// WithCloseTimeout grace period to finish and exit even if ctx is already
+// cancelled; a live ctx can only shorten it. Close also removes the client
+// from ActiveClients, even if it never connected. With WithDrainOnClose,
+// Close first reads what the CLI still sends; see DrainedMessages.
 //
 // Returns an error if cleanup fails, but the client is marked as disconnected regardless.
-func (c *Client) Close(ctx context.Context) error {
+func (c *Client) Close(ctx context.Context) (err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	untrackClient(c)
+	c.closed = true
+	defer c.governor.remove(c) // Once drained results are charged
+
 	if !c.connected {
 		return nil
 	}
+	recordDisconnect(c.options)
+	logState(c.options, "close initiated")
+	_, span := startSpan(c.options, ctx, types.SpanClose, nil)
+	defer func() { endSpan(span, nil, err) }()
+	c.drainOnClose(ctx)
+	c.endTurnSpans(types.NewCLIConnectionError("client closed before the turn's result"))
 
 	var errs []error
 
@@ -360,8 +990,12 @@ func (c *Client) Close(ctx context.Context) error {
 		if err := c.query.Stop(ctx); err != nil {
 			errs = append(errs, err)
 		}
+		c.transcriptPath = c.query.TranscriptPath()
 		c.query = nil
 	}
+	c.turn = nil
+	c.paused = false
+	c.heldPrompts = nil
 
 	// Close transport
 	if c.transport != nil {
@@ -370,6 +1004,10 @@ func (c *Client) Close(ctx context.Context) error {
 		}
 	}
 
+	if err := c.closeTranscript(); err != nil {
+		errs = append(errs, err)
+	}
+
 	// Cancel context
 	if c.cancel != nil {
 		c.cancel()
@@ -386,12 +1024,110 @@ func (c *Client) Close(ctx context.Context) error {
 	return nil
 }
 
+// CLIVersion returns the version of the Claude Code CLI detected by Connect,
+// such as "1.0.100". It is empty before Connect, or if the transport cannot
+// report a version. Versions in an unrecognized format are returned as reported.
+func (c *Client) CLIVersion() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cliVersion
+}
+
+// TranscriptPath returns the path of the CLI's transcript file for this
+// session, so applications can log it alongside their own request IDs.
+//
+// The CLI reports the path in hook inputs, so it is captured from the first
+// hook callback (or the init message, if it includes one). It is empty until
+// then; use WithCaptureTranscriptPath when no hooks are configured. The last
+// known path remains available after Close.
+func (c *Client) TranscriptPath() string {
+	c.mu.Lock()
+	query, path := c.query, c.transcriptPath
+	c.mu.Unlock()
+
+	if query == nil {
+		return path
+	}
+	return query.TranscriptPath()
+}
+
+// PID returns the process ID of the CLI subprocess and true while it is
+// running, for correlating the client with system metrics or stopping a
+// runaway CLI externally. It returns false before Connect, after the process
+// has exited, and for transports that do not implement ProcessReporter.
+// It is safe to call concurrently with Close.
+func (c *Client) PID() (int, bool) {
+	if p, ok := c.transport.(ProcessReporter); ok {
+		return p.PID()
+	}
+	return 0, false
+}
+
+// ProcessState returns whether the CLI subprocess is running or has exited,
+// with its exit code once known. Transports that do not implement
+// ProcessReporter report ProcessNotStarted. It is safe to call concurrently
+// with Close.
+func (c *Client) ProcessState() types.ProcessState {
+	if p, ok := c.transport.(ProcessReporter); ok {
+		return p.ProcessState()
+	}
+	return types.ProcessState{Status: types.ProcessNotStarted}
+}
+
+// StderrTail returns the last lines the CLI wrote to stderr, oldest first,
+// for diagnosing a CLI that failed. They remain available after Close. It
+// returns nil for transports that do not capture stderr.
+func (c *Client) StderrTail() []string {
+	if p, ok := c.transport.(interface{ StderrTail() []string }); ok {
+		return p.StderrTail()
+	}
+	return nil
+}
+
 // IsConnected returns true if the client is currently connected to Claude.
 //
 // This can be used to check connection state before calling methods that require
-// an active connection.
+// an active connection. It returns false once the transport is broken, even if
+// Close has not been called yet.
 func (c *Client) IsConnected() bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.connected
+	return c.connected && c.brokenErr() == nil
+}
+
+// Err returns the error that ended the client's message stream, or nil.
+//
+// When the transport fails, for example because the CLI wrote a line that
+// could not be read, ReceiveResponse emits a transport_failed SystemMessage
+// carrying the error and closes its channel; Err returns the same error
+// afterwards. Lines that could not be parsed do not end the stream and are
+// reported as parse_error SystemMessages instead.
+//
+// Example:
+//
+//	for msg := range client.ReceiveResponse(ctx) {
+//	    // Process messages
+//	}
+//	if err := client.Err(); err != nil {
+//	    log.Printf("stream ended early: %v", err)
+//	}
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.transport == nil {
+		return nil
+	}
+	return c.transport.GetError()
+}
+
+// brokenErr returns the transport's TransportBrokenError or IdleTimeoutError, if any.
+func (c *Client) brokenErr() error {
+	if c.transport == nil {
+		return nil
+	}
+	if err := c.transport.GetError(); types.IsTransportBrokenError(err) || types.IsIdleTimeoutError(err) {
+		return err
+	}
+	return nil
 }
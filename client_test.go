@@ -2,12 +2,24 @@ package claude
 
 import (
 	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
+// idleCLI returns a mock CLI that answers control requests and exits when
+// its input closes, for tests that never get as far as a response.
+func idleCLI(t testing.TB) string {
+	t.Helper()
+	return mockcli.New(t, mockcli.Scenario{}).Path
+}
+
 func TestNewClient_NilOptions(t *testing.T) {
 	ctx := context.Background()
 
@@ -45,14 +57,14 @@ func TestNewClient_ConflictingPermissionOptions(t *testing.T) {
 	ctx := context.Background()
 
 	// Create a dummy callback
-	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
 		return types.PermissionResultAllow{Behavior: "allow"}, nil
 	}
 
 	// This should fail because both are set
 	promptTool := "cli"
 	opts := types.NewClaudeAgentOptions().
-		WithCLIPath("/bin/echo").
+		WithCLIPath(idleCLI(t)).
 		WithCanUseTool(canUseTool).
 		WithPermissionPromptToolName(promptTool)
 
@@ -66,9 +78,46 @@ func TestNewClient_ConflictingPermissionOptions(t *testing.T) {
 	}
 }
 
+func TestNewClient_InvalidPermissionPrecedence(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(idleCLI(t)).
+		WithPermissionPrecedence("strictest")
+
+	_, err := NewClient(context.Background(), opts)
+	if err == nil || err.Error() != `unknown permission precedence "strictest"` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewClient_MissingCWD(t *testing.T) {
+	ctx := context.Background()
+	missing := filepath.Join(t.TempDir(), "does-not-exist")
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(idleCLI(t)).
+		WithCWD(missing)
+
+	_, err := NewClient(ctx, opts)
+	if !types.IsWorkingDirectoryError(err) {
+		t.Fatalf("expected WorkingDirectoryError, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), missing) {
+		t.Errorf("error %q does not name missing path", err)
+	}
+
+	client, err := NewClient(ctx, opts.WithCreateCWD(true))
+	if err != nil {
+		t.Fatalf("expected directory to be created, got: %v", err)
+	}
+	_ = client.Close(ctx)
+
+	if info, err := os.Stat(missing); err != nil || !info.IsDir() {
+		t.Errorf("expected %s to be created", missing)
+	}
+}
+
 func TestClient_ConnectBeforeQuery(t *testing.T) {
 	ctx := context.Background()
-	opts := types.NewClaudeAgentOptions().WithCLIPath("/bin/echo")
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t))
 
 	client, err := NewClient(ctx, opts)
 	if err != nil {
@@ -91,7 +140,7 @@ func TestClient_ConnectBeforeQuery(t *testing.T) {
 
 func TestClient_EmptyPrompt(t *testing.T) {
 	ctx := context.Background()
-	opts := types.NewClaudeAgentOptions().WithCLIPath("/bin/echo")
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t))
 
 	client, err := NewClient(ctx, opts)
 	if err != nil {
@@ -113,9 +162,42 @@ func TestClient_EmptyPrompt(t *testing.T) {
 	}
 }
 
+func TestClient_EndInputBeforeConnect(t *testing.T) {
+	ctx := context.Background()
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t))
+
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Skip("Could not create client")
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+
+	err = client.EndInput(ctx)
+	if !types.IsCLIConnectionError(err) {
+		t.Errorf("expected CLIConnectionError, got: %T - %v", err, err)
+	}
+}
+
+func TestClient_InterruptBeforeConnect(t *testing.T) {
+	ctx := context.Background()
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t))
+
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Skip("Could not create client")
+	}
+
+	err = client.Interrupt(ctx)
+	if !types.IsCLIConnectionError(err) {
+		t.Errorf("expected CLIConnectionError, got: %T - %v", err, err)
+	}
+}
+
 func TestClient_IsConnected(t *testing.T) {
 	ctx := context.Background()
-	opts := types.NewClaudeAgentOptions().WithCLIPath("/bin/echo")
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t))
 
 	client, err := NewClient(ctx, opts)
 	if err != nil {
@@ -137,11 +219,36 @@ func TestClient_IsConnected(t *testing.T) {
 	}
 }
 
+// TestClient_ConnectAfterClose tests that a closed client stays closed.
+func TestClient_ConnectAfterClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t)))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	_ = client.Close(ctx)
+
+	if err := client.Connect(ctx); !types.IsCLIConnectionError(err) {
+		t.Errorf("Connect after Close = %v, want CLIConnectionError", err)
+	}
+	clients.mu.Lock()
+	_, tracked := clients.byID[client.id]
+	clients.mu.Unlock()
+	if tracked {
+		t.Error("closed client is counted by ActiveClients")
+	}
+}
+
 func TestClient_DoubleConnect(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	opts := types.NewClaudeAgentOptions().WithCLIPath("/bin/echo")
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t))
 
 	client, err := NewClient(ctx, opts)
 	if err != nil {
@@ -151,7 +258,7 @@ func TestClient_DoubleConnect(t *testing.T) {
 		_ = client.Close(ctx)
 	}()
 
-	// First connect attempt (will likely fail with /bin/echo)
+	// First connect attempt
 	err1 := client.Connect(ctx)
 
 	// Second connect attempt
@@ -173,7 +280,7 @@ func TestClient_DoubleConnect(t *testing.T) {
 
 func TestClient_CloseIdempotent(t *testing.T) {
 	ctx := context.Background()
-	opts := types.NewClaudeAgentOptions().WithCLIPath("/bin/echo")
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t))
 
 	client, err := NewClient(ctx, opts)
 	if err != nil {
@@ -191,9 +298,40 @@ func TestClient_CloseIdempotent(t *testing.T) {
 	_ = err3
 }
 
+func TestClient_CloseCancelledContext(t *testing.T) {
+	// The CLI exits on its own once its input closes, as the real one does
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.AwaitInputClosed(),
+		mockcli.Delay(200 * time.Millisecond),
+		mockcli.Exit(0),
+	}})
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+	client, err := NewClient(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(context.Background(), "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	// As in a defer after the caller's deadline passed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.Close(ctx); err != nil {
+		t.Errorf("Close with a cancelled context = %v, want nil", err)
+	}
+	if state := client.ProcessState(); state.Status != types.ProcessExited || state.ExitCode != 0 {
+		t.Errorf("ProcessState = %+v, want a clean exit", state)
+	}
+}
+
 func TestClient_ContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
-	opts := types.NewClaudeAgentOptions().WithCLIPath("/bin/echo")
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t))
 
 	client, err := NewClient(ctx, opts)
 	if err != nil {
@@ -348,7 +486,7 @@ func TestClient_MultipleQueries(t *testing.T) {
 // BenchmarkClient benchmarks the Client type
 func BenchmarkClient_Create(b *testing.B) {
 	ctx := context.Background()
-	opts := types.NewClaudeAgentOptions().WithCLIPath("/bin/echo")
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(b))
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -358,3 +496,360 @@ func BenchmarkClient_Create(b *testing.B) {
 		}
 	}
 }
+
+func TestClient_StdoutClosedWhileRunning(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Print one message, close stdout, and keep the process alive
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"partial"}]}}`),
+		mockcli.CloseOutput(),
+		mockcli.Hang(),
+	}})
+
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if err := client.Query(ctx, "hello"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	var msgs []types.Message
+	for msg := range client.ReceiveResponse(ctx) {
+		msgs = append(msgs, msg)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("ReceiveResponse did not finish before the deadline")
+	}
+
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d: %v", len(msgs), msgs)
+	}
+	failed, ok := msgs[1].(*types.SystemMessage)
+	if !ok || failed.Subtype != "transport_failed" {
+		t.Errorf("expected transport_failed system message, got %+v", msgs[1])
+	}
+
+	if client.IsConnected() {
+		t.Error("IsConnected() = true after transport broke")
+	}
+	if err := client.Query(ctx, "again"); !types.IsTransportBrokenError(err) {
+		t.Errorf("expected TransportBrokenError, got %v", err)
+	}
+}
+
+func TestClient_RawMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assistant := `{"type":"assistant", "message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"hi"}]},"unknown_field":{"kept":true}}`
+	result := `{"type":"result","subtype":"success","session_id":"s1","total_cost_usd":0.5}`
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+			mockcli.AwaitPrompt(),
+			mockcli.Send(assistant, result),
+		}}).Path).
+		WithRawMessages(true)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+
+	if err := client.Query(ctx, "hello"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	var raws []string
+	for msg := range client.ReceiveResponse(ctx) {
+		raws = append(raws, string(msg.GetRaw()))
+	}
+	if len(raws) != 2 || raws[0] != assistant || raws[1] != result {
+		t.Errorf("raw messages = %q, want exact CLI lines", raws)
+	}
+}
+
+func TestClient_SetModel(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		refusal   string // error the CLI answers set_model with, if any
+		wantModel interface{}
+		check     func(t *testing.T, err error)
+	}{
+		{
+			name:      "acknowledged",
+			model:     "claude-opus-4-1",
+			wantModel: "claude-opus-4-1",
+			check: func(t *testing.T, err error) {
+				if err != nil {
+					t.Errorf("SetModel failed: %v", err)
+				}
+			},
+		},
+		{
+			name:      "default model",
+			wantModel: nil,
+			check: func(t *testing.T, err error) {
+				if err != nil {
+					t.Errorf("SetModel failed: %v", err)
+				}
+			},
+		},
+		{
+			name:      "refused",
+			model:     "claude-nope",
+			refusal:   "Invalid model: claude-nope",
+			wantModel: "claude-nope",
+			check: func(t *testing.T, err error) {
+				if !types.IsControlProtocolError(err) || !strings.Contains(err.Error(), "Invalid model: claude-nope") {
+					t.Errorf("expected ControlProtocolError with the CLI's message, got %T: %v", err, err)
+				}
+			},
+		},
+		{
+			name:      "unknown to the CLI",
+			model:     "claude-opus-4-1",
+			refusal:   "Unsupported control request subtype: set_model",
+			wantModel: "claude-opus-4-1",
+			check: func(t *testing.T, err error) {
+				assertUnsupportedFeature(t, err, types.CapabilitySetModel)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			scenario := mockcli.Scenario{}
+			if tt.refusal != "" {
+				scenario.ControlErrors = map[string]string{"set_model": tt.refusal}
+			}
+			cli := mockcli.New(t, scenario)
+			opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+			client, err := NewClient(ctx, opts)
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			defer client.Close(context.Background())
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+
+			tt.check(t, client.SetModel(ctx, tt.model))
+
+			// The frame the CLI read after initialize
+			received := cli.Received()
+			if len(received) != 2 {
+				t.Fatalf("CLI received %q, want initialize and set_model", received)
+			}
+			data := []byte(received[1])
+			var frame struct {
+				Type      string                 `json:"type"`
+				RequestID string                 `json:"request_id"`
+				Request   map[string]interface{} `json:"request"`
+			}
+			if err := json.Unmarshal(data, &frame); err != nil {
+				t.Fatalf("invalid frame %s: %v", data, err)
+			}
+			if frame.Type != "control_request" || frame.RequestID == "" || frame.Request["subtype"] != "set_model" {
+				t.Errorf("unexpected frame: %s", data)
+			}
+			if model, ok := frame.Request["model"]; !ok || model != tt.wantModel {
+				t.Errorf("frame model = %v (present %v), want %v: %s", model, ok, tt.wantModel, data)
+			}
+		})
+	}
+}
+
+// streamingCLI returns a mock CLI that answers initialize with initResponse
+// and each prompt with an assistant message and a result, preceded by a
+// stream event on the turns where partial is set. With refuse, it answers
+// set_include_partial_messages requests that it does not know them.
+func streamingCLI(t *testing.T, initResponse string, refuse bool, partial ...bool) *mockcli.CLI {
+	t.Helper()
+
+	scenario := mockcli.Scenario{
+		ControlResponses: map[string]json.RawMessage{"initialize": json.RawMessage(initResponse)},
+	}
+	if refuse {
+		scenario.ControlErrors = map[string]string{
+			"set_include_partial_messages": "Unsupported control request subtype: set_include_partial_messages",
+		}
+	}
+	for _, stream := range partial {
+		var lines []string
+		if stream {
+			lines = append(lines, `{"type":"stream_event","uuid":"u","session_id":"s","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"ok"}}}`)
+		}
+		lines = append(lines,
+			`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"ok"}]}}`,
+			streamResult,
+		)
+		scenario.Steps = append(scenario.Steps, mockcli.AwaitPrompt(), mockcli.Send(lines...))
+	}
+	return mockcli.New(t, scenario)
+}
+
+// streamEvents counts the StreamEvents among messages.
+func streamEvents(messages []types.Message) int {
+	n := 0
+	for _, msg := range messages {
+		if _, ok := msg.(*types.StreamEvent); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func TestClient_SetStreaming(t *testing.T) {
+	tests := []struct {
+		name     string
+		init     string
+		refuse   bool
+		wantSent bool // whether the CLI is asked to stop streaming
+	}{
+		{"cli supports toggling", capabilitiesInit(types.CapabilityPartialMessages, types.CapabilitySetPartialMessages), false, true},
+		{"cli cannot toggle", capabilitiesInit(types.CapabilityPartialMessages), false, false},
+		{"cli refuses the request", capabilitiesInit(), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// The CLI only stops streaming if it is asked to and agrees
+			turns := []bool{true, false, true}
+			partial := make([]bool, len(turns))
+			for i, enabled := range turns {
+				partial[i] = enabled || !tt.wantSent || tt.refuse
+			}
+			cli := streamingCLI(t, tt.init, tt.refuse, partial...)
+			opts := types.NewClaudeAgentOptions().
+				WithCLIPath(cli.Path).
+				WithIncludePartialMessages(true)
+			client, err := NewClient(ctx, opts)
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			defer client.Close(context.Background())
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+
+			for i, enabled := range turns {
+				if i > 0 {
+					if err := client.SetStreaming(ctx, enabled); err != nil {
+						t.Fatalf("SetStreaming(%v) failed: %v", enabled, err)
+					}
+				}
+				turn, err := client.RunTurn(ctx, "hello")
+				if err != nil {
+					t.Fatalf("RunTurn failed: %v", err)
+				}
+				if got, want := streamEvents(turn.Messages) > 0, enabled; got != want {
+					t.Errorf("turn %d: stream events delivered = %v, want %v", i+1, got, want)
+				}
+			}
+
+			frames := strings.Join(cli.Received(), "\n")
+			if sent := strings.Contains(frames, `"include_partial_messages":false`); sent != tt.wantSent {
+				t.Errorf("set_include_partial_messages sent = %v, want %v: %s", sent, tt.wantSent, frames)
+			}
+		})
+	}
+}
+
+func TestClient_SetStreamingWithoutPartialMessages(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := streamingCLI(t, capabilitiesInit(types.CapabilityPartialMessages), false)
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// The SDK can hide partial messages but not produce ones the CLI never sends
+	assertUnsupportedFeature(t, client.SetStreaming(ctx, true), types.CapabilitySetPartialMessages)
+	if err := client.SetStreaming(ctx, false); err != nil {
+		t.Errorf("SetStreaming(false) failed: %v", err)
+	}
+}
+
+func TestClient_RunTurnWithOptionsStreaming(t *testing.T) {
+	for _, caps := range [][]types.Capability{
+		{types.CapabilityPartialMessages, types.CapabilitySetPartialMessages},
+		{types.CapabilityPartialMessages},
+	} {
+		t.Run(string(caps[len(caps)-1]), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// Only a CLI that can toggle streaming stops for the first turn
+			toggles := caps[len(caps)-1] == types.CapabilitySetPartialMessages
+			opts := types.NewClaudeAgentOptions().
+				WithCLIPath(streamingCLI(t, capabilitiesInit(caps...), false, !toggles, true).Path).
+				WithIncludePartialMessages(true)
+			client, err := NewClient(ctx, opts)
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			defer client.Close(context.Background())
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+
+			quiet := false
+			turn, err := client.RunTurnWithOptions(ctx, "in the background", &types.TurnOptions{Streaming: &quiet})
+			if err != nil {
+				t.Fatalf("RunTurnWithOptions failed: %v", err)
+			}
+			if n := streamEvents(turn.Messages); n != 0 {
+				t.Errorf("background turn delivered %d stream events, want none", n)
+			}
+
+			// The override ends with the turn
+			turn, err = client.RunTurn(ctx, "interactive")
+			if err != nil {
+				t.Fatalf("RunTurn failed: %v", err)
+			}
+			if n := streamEvents(turn.Messages); n == 0 {
+				t.Error("expected stream events once the override ended")
+			}
+		})
+	}
+}
+
+func TestClient_SetModelNotConnected(t *testing.T) {
+	client, err := NewClient(context.Background(), types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t)))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.SetModel(context.Background(), "claude-opus-4-1"); !types.IsCLIConnectionError(err) {
+		t.Errorf("expected CLIConnectionError, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// echoAnswer is what echo CLIs send for every prompt.
+var echoAnswer = []string{
+	`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"ok"}]}}`,
+	`{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s"}`,
+}
+
+// echoCLI returns a mock CLI that answers every control request with an
+// empty success response, except initialize, which it answers with
+// initResponse if set, and every user message with an assistant message and
+// a result, until stdin is closed.
+func echoCLI(t *testing.T, initResponse string) *mockcli.CLI {
+	t.Helper()
+
+	scenario := mockcli.Scenario{EachPrompt: echoAnswer}
+	if initResponse != "" {
+		scenario.ControlResponses = map[string]json.RawMessage{"initialize": json.RawMessage(initResponse)}
+	}
+	return mockcli.New(t, scenario)
+}
+
+// writeEchoCLI returns the path of an echo CLI; see echoCLI.
+func writeEchoCLI(t *testing.T) string {
+	t.Helper()
+	return echoCLI(t, "").Path
+}
+
+// writeEchoCLIWithInit is like writeEchoCLI but answers the initialize
+// request with initResponse.
+func writeEchoCLIWithInit(t *testing.T, initResponse string) string {
+	t.Helper()
+	return echoCLI(t, initResponse).Path
+}
+
+func connectEcho(t *testing.T, ctx context.Context) *Client {
+	t.Helper()
+
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(writeEchoCLI(t)))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	return client
+}
+
+func TestClient_ConcurrentQueryAndReceive(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client := connectEcho(t, ctx)
+
+	const senders, perSender = 4, 20
+	var results atomic.Int64
+	received := make(chan struct{})
+
+	// One consumer drains responses while others send
+	go func() {
+		defer close(received)
+		for results.Load() < senders*perSender && ctx.Err() == nil {
+			for msg := range client.ReceiveResponse(ctx) {
+				if _, ok := msg.(*types.ResultMessage); ok {
+					results.Add(1)
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perSender; j++ {
+				if err := client.Query(ctx, "hello"); err != nil {
+					t.Errorf("Query failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	stop := make(chan struct{})
+	var pollers sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		pollers.Add(1)
+		go func() {
+			defer pollers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if !client.IsConnected() {
+					t.Error("client reported disconnected while in use")
+					return
+				}
+				_ = client.CLIVersion()
+				_ = client.TranscriptPath()
+			}
+		}()
+	}
+	pollers.Add(1)
+	go func() {
+		defer pollers.Done()
+		for i := 0; i < 5; i++ {
+			if err := client.Interrupt(ctx); err != nil {
+				t.Errorf("Interrupt failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	<-received
+	close(stop)
+	pollers.Wait()
+
+	if got := results.Load(); got != senders*perSender {
+		t.Errorf("received %d results, want %d", got, senders*perSender)
+	}
+}
+
+func TestClient_CloseDuringReceive(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		client := connectEcho(t, ctx)
+
+		var wg sync.WaitGroup
+
+		// Receivers block waiting for a response that Close cuts off
+		for j := 0; j < 3; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range client.ReceiveResponse(ctx) {
+				}
+			}()
+		}
+
+		// Senders and pollers race with Close; errors are expected, panics are not
+		for j := 0; j < 3; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < 10; k++ {
+					_ = client.Query(ctx, "hello")
+					_ = client.IsConnected()
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = client.Interrupt(ctx)
+		}()
+
+		if err := client.Close(context.Background()); err != nil && !types.IsProcessError(err) {
+			t.Errorf("Close failed: %v", err)
+		}
+		_ = client.Close(context.Background())
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("goroutines still blocked after Close")
+		}
+
+		if client.IsConnected() {
+			t.Error("client connected after Close")
+		}
+		if err := client.Query(ctx, "hello"); !types.IsCLIConnectionError(err) {
+			t.Errorf("Query after Close = %v, want CLIConnectionError", err)
+		}
+		cancel()
+	}
+}
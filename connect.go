@@ -0,0 +1,109 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Connect phases named in timeout errors.
+const (
+	connectPhaseVersion    = "detecting CLI version"
+	connectPhaseStart      = "starting CLI"
+	connectPhaseInitialize = "initializing control protocol"
+)
+
+// connectCleanupTimeout bounds how long a failed Connect waits for the CLI to
+// exit before killing it. A CLI that failed to connect may be hung, so it does
+// not get the full close timeout.
+var connectCleanupTimeout = time.Second
+
+// connectTimeout returns the Connect deadline configured in options, or
+// zero if the timeout is disabled.
+func connectTimeout(options *types.ClaudeAgentOptions) time.Duration {
+	if options.ConnectTimeout == nil {
+		return types.DefaultConnectTimeout
+	}
+	if *options.ConnectTimeout <= 0 {
+		return 0
+	}
+	return *options.ConnectTimeout
+}
+
+// withConnectTimeout derives the context that bounds the Connect phases.
+// It never outlives parent, so caller cancellation still applies.
+func withConnectTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// connectTimeoutError reports whether connectCtx expired on its own deadline
+// rather than through the parent, and if so describes the phase that was
+// running. It returns nil when the connect timeout is not to blame.
+func connectTimeoutError(parent, connectCtx context.Context, timeout time.Duration, phase string) error {
+	if parent.Err() != nil || !errors.Is(connectCtx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	return types.NewCLIConnectionErrorWithCause(
+		fmt.Sprintf("connect timed out after %s while %s", timeout, phase),
+		context.DeadlineExceeded,
+	)
+}
+
+// connectTransport starts t, giving up once connectCtx is done. The transport
+// is connected with parent because it binds the subprocess lifetime to the
+// context it is given; if it finishes connecting after the deadline it is
+// closed in the background, within connectCleanupTimeout.
+func connectTransport(parent, connectCtx context.Context, t Transport) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- t.Connect(parent)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-connectCtx.Done():
+		go func() {
+			if err := <-done; err == nil {
+				ctx, cancel := context.WithTimeout(context.Background(), connectCleanupTimeout)
+				defer cancel()
+				_ = t.Close(ctx)
+			}
+		}()
+		return connectCtx.Err()
+	}
+}
+
+// startQuery starts a query's message loop. Tests replace it to make Connect
+// fail once the transport is up.
+var startQuery = (*internal.Query).Start
+
+// abortConnect undoes a Connect that failed after the transport connected:
+// it stops the query and closes the transport, reaping the CLI, so no
+// goroutine or subprocess outlives the failed call. It does not use the
+// caller's context, which may be the reason Connect failed; a CLI that has
+// not exited within connectCleanupTimeout is killed. c.mu must be held.
+func (c *Client) abortConnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), connectCleanupTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if c.query != nil {
+		_ = c.query.Stop(ctx)
+		c.query = nil
+	}
+	err := c.transport.Close(ctx)
+	_ = c.closeTranscript()
+	if err != nil {
+		logState(c.options, "connect cleanup finished", "duration", time.Since(start), "error", err)
+	} else {
+		logState(c.options, "connect cleanup finished", "duration", time.Since(start))
+	}
+}
@@ -0,0 +1,300 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// writeSlowCLI writes a CLI that takes versionDelay to answer --version and
+// never replies to the initialize request.
+func writeSlowCLI(t *testing.T, versionDelay time.Duration) string {
+	t.Helper()
+	return mockcli.New(t, mockcli.Scenario{
+		VersionDelay: versionDelay,
+		Unanswered:   []string{"initialize"},
+		Steps:        []mockcli.Step{mockcli.Hang()},
+	}).Path
+}
+
+// blockingTransport is a Transport whose Connect blocks until release is closed.
+type blockingTransport struct {
+	Transport
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (b *blockingTransport) Connect(ctx context.Context) error {
+	<-b.release
+	return nil
+}
+
+func (b *blockingTransport) Close(ctx context.Context) error {
+	close(b.closed)
+	return nil
+}
+
+func assertConnectTimeout(t *testing.T, err error, phase string, elapsed time.Duration) {
+	t.Helper()
+
+	if !types.IsCLIConnectionError(err) {
+		t.Fatalf("expected CLIConnectionError, got %T: %v", err, err)
+	}
+	if !strings.Contains(err.Error(), phase) {
+		t.Errorf("expected error to name phase %q, got %q", phase, err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("Connect took %s, expected it to stop at the connect timeout", elapsed)
+	}
+}
+
+func TestClient_ConnectTimeoutInitialize(t *testing.T) {
+	cliPath := writeSlowCLI(t, 0)
+	// Seed the version cache so that Connect does not probe the CLI, leaving
+	// the whole timeout to the initialize request
+	if _, err := transport.CachedCLIVersion(context.Background(), cliPath); err != nil {
+		t.Fatalf("CachedCLIVersion failed: %v", err)
+	}
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cliPath).
+		WithConnectTimeout(200 * time.Millisecond)
+	client, err := NewClient(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+
+	// The parent context has no deadline; only the connect timeout can fire
+	start := time.Now()
+	err = client.Connect(context.Background())
+	assertConnectTimeout(t, err, "initializing control protocol", time.Since(start))
+}
+
+func TestClient_ConnectTimeoutVersionProbe(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeSlowCLI(t, 30*time.Second)).
+		WithConnectTimeout(200 * time.Millisecond)
+	client, err := NewClient(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+
+	start := time.Now()
+	err = client.Connect(context.Background())
+	assertConnectTimeout(t, err, "detecting CLI version", time.Since(start))
+}
+
+func TestClient_ConnectTimeoutStart(t *testing.T) {
+	bt := &blockingTransport{release: make(chan struct{}), closed: make(chan struct{})}
+	opts := types.NewClaudeAgentOptions().WithConnectTimeout(100 * time.Millisecond)
+	client, err := NewClientWithTransport(context.Background(), opts, bt)
+	if err != nil {
+		t.Fatalf("NewClientWithTransport failed: %v", err)
+	}
+
+	start := time.Now()
+	err = client.Connect(context.Background())
+	assertConnectTimeout(t, err, "starting CLI", time.Since(start))
+
+	// A transport that finishes connecting late is closed rather than leaked
+	close(bt.release)
+	select {
+	case <-bt.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("late transport connection was not closed")
+	}
+}
+
+func TestClient_ConnectParentDeadline(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeSlowCLI(t, 0)).
+		WithConnectTimeout(0)
+	client, err := NewClient(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// The caller's deadline is not reported as a connect timeout
+	err = client.Connect(ctx)
+	if err == nil {
+		t.Fatal("expected Connect to fail")
+	}
+	if strings.Contains(err.Error(), "connect timed out") {
+		t.Errorf("parent deadline reported as connect timeout: %v", err)
+	}
+	if !types.IsControlProtocolError(err) {
+		t.Errorf("expected ControlProtocolError, got %T: %v", err, err)
+	}
+}
+
+func TestClient_ConnectWithinTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeScriptedCLI(t)).
+		WithConnectTimeout(5 * time.Second)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+}
+
+func TestConnectTimeoutDefault(t *testing.T) {
+	if got := connectTimeout(types.NewClaudeAgentOptions()); got != types.DefaultConnectTimeout {
+		t.Errorf("default timeout = %s, want %s", got, types.DefaultConnectTimeout)
+	}
+	if got := connectTimeout(types.NewClaudeAgentOptions().WithConnectTimeout(-1)); got != 0 {
+		t.Errorf("negative timeout = %s, want disabled", got)
+	}
+}
+
+// TestClient_ConnectFailureCleanup tests that a Connect failing after the CLI
+// started leaves no goroutine of the client running and no subprocess
+// unreaped, at each point where it can fail. The CLIs that ignore end of
+// input must be killed by the cleanup.
+func TestClient_ConnectFailureCleanup(t *testing.T) {
+	tests := []struct {
+		name      string
+		scenario  mockcli.Scenario
+		configure func(*types.ClaudeAgentOptions)
+		startErr  error         // injected Query start failure
+		cancel    time.Duration // cancel the caller's context this long after the CLI starts
+	}{
+		{
+			name:     "query start fails",
+			scenario: mockcli.Scenario{Unanswered: []string{"initialize"}, Steps: []mockcli.Step{mockcli.Hang()}},
+			startErr: types.NewControlProtocolError("injected start failure"),
+		},
+		{
+			name: "initialize refused",
+			scenario: mockcli.Scenario{
+				ControlErrors: map[string]string{"initialize": "boom"},
+				Steps:         []mockcli.Step{mockcli.Hang()},
+			},
+		},
+		{
+			name: "CLI exits during initialize",
+			scenario: mockcli.Scenario{
+				Unanswered: []string{"initialize"},
+				Steps:      []mockcli.Step{mockcli.AwaitRequest("initialize"), mockcli.Exit(1)},
+			},
+		},
+		{
+			name:     "connect timeout during initialize",
+			scenario: mockcli.Scenario{Unanswered: []string{"initialize"}, Steps: []mockcli.Step{mockcli.Hang()}},
+			configure: func(o *types.ClaudeAgentOptions) {
+				o.WithConnectTimeout(200 * time.Millisecond)
+			},
+		},
+		{
+			name:     "caller cancels during initialize",
+			scenario: mockcli.Scenario{Unanswered: []string{"initialize"}, Steps: []mockcli.Step{mockcli.Hang()}},
+			cancel:   200 * time.Millisecond,
+		},
+		{
+			name: "missing capability",
+			scenario: mockcli.Scenario{
+				ControlResponses: map[string]json.RawMessage{
+					"initialize": json.RawMessage(`{"capabilities":{"protocolVersion":"2"}}`),
+				},
+				Steps: []mockcli.Step{mockcli.Hang()},
+			},
+			configure: func(o *types.ClaudeAgentOptions) {
+				o.WithIncludePartialMessages(true)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := mockcli.New(t, tt.scenario)
+			if tt.startErr != nil {
+				orig := startQuery
+				startQuery = func(q *internal.Query, ctx context.Context) error {
+					if err := orig(q, ctx); err != nil {
+						return err
+					}
+					// Fail only once the CLI has recorded its PID
+					waitFor(t, "CLI to start", func() bool {
+						return cli.PID() != 0
+					})
+					return tt.startErr
+				}
+				defer func() { startQuery = orig }()
+			}
+
+			opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+			if tt.configure != nil {
+				tt.configure(opts)
+			}
+			client, err := NewClient(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			defer client.Close(context.Background())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if tt.cancel > 0 {
+				go func() {
+					for cli.PID() == 0 && ctx.Err() == nil {
+						time.Sleep(10 * time.Millisecond)
+					}
+					time.Sleep(tt.cancel)
+					cancel()
+				}()
+			}
+
+			start := time.Now()
+			if err := client.Connect(ctx); err == nil {
+				t.Fatal("Connect succeeded, want an error")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("failed Connect took %s", elapsed)
+			}
+
+			pid := cli.PID()
+			if pid == 0 {
+				t.Fatal("CLI did not start")
+			}
+
+			// The subprocess is reaped before Connect returns
+			if slices.Contains(ActiveSubprocesses(), pid) {
+				t.Errorf("CLI %d not reaped after failed Connect", pid)
+			}
+			if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+				t.Errorf("CLI %d still exists after failed Connect: %v", pid, err)
+			}
+			waitFor(t, "client goroutines to exit", func() bool {
+				return client.goroutineCount() == 0
+			})
+			if client.IsConnected() {
+				t.Error("IsConnected() = true after failed Connect")
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package claude
+
+import (
+	"context"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// queryCloseTimeout bounds how long a finished Query waits for the CLI to
+// exit before killing it.
+const queryCloseTimeout = 5 * time.Second
+
+// consumerTimeout returns the timeout configured with WithConsumerTimeout,
+// or 0 when it is disabled.
+func consumerTimeout(options *types.ClaudeAgentOptions) time.Duration {
+	if options.ConsumerTimeout == nil {
+		return types.DefaultConsumerTimeout
+	}
+	if *options.ConsumerTimeout <= 0 {
+		return 0
+	}
+	return *options.ConsumerTimeout
+}
+
+// forwarder delivers messages to the caller of Query. A send gives up when
+// ctx is done or when the caller has not received the message within the
+// consumer timeout, in which case the channel is considered abandoned.
+type forwarder struct {
+	ctx       context.Context
+	out       chan<- types.Message
+	timeout   time.Duration
+	timer     *time.Timer
+	abandoned bool
+}
+
+// newForwarder creates a forwarder sending to out.
+func newForwarder(ctx context.Context, out chan<- types.Message, options *types.ClaudeAgentOptions) *forwarder {
+	return &forwarder{ctx: ctx, out: out, timeout: consumerTimeout(options)}
+}
+
+// send delivers msg and reports whether the caller received it.
+func (f *forwarder) send(msg types.Message) bool {
+	if f.abandoned {
+		return false
+	}
+
+	// Most sends fit in the channel's buffer; only start the timer when blocked
+	select {
+	case f.out <- msg:
+		return true
+	default:
+	}
+
+	var expired <-chan time.Time
+	if f.timeout > 0 {
+		if f.timer == nil {
+			f.timer = time.NewTimer(f.timeout)
+		} else {
+			f.timer.Reset(f.timeout)
+		}
+		defer f.timer.Stop()
+		expired = f.timer.C
+	}
+
+	select {
+	case f.out <- msg:
+		return true
+	case <-f.ctx.Done():
+		return false
+	case <-expired:
+		f.abandoned = true
+		return false
+	}
+}
@@ -0,0 +1,135 @@
+package claude
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// writeFloodCLI writes a CLI for one-shot queries that prints more assistant
+// messages than the Query channel buffers and then stays alive until killed
+// or its stdin closes.
+func writeFloodCLI(t *testing.T) string {
+	t.Helper()
+	flood := make([]string, 40)
+	for i := range flood {
+		flood[i] = streamAssistant
+	}
+	return writeScriptedCLI(t, flood...)
+}
+
+func TestConsumerTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  *time.Duration
+		want time.Duration
+	}{
+		{"default", nil, types.DefaultConsumerTimeout},
+		{"set", durationPtr(time.Second), time.Second},
+		{"disabled", durationPtr(0), 0},
+		{"negative", durationPtr(-time.Second), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := types.NewClaudeAgentOptions()
+			opts.ConsumerTimeout = tt.opt
+			if got := consumerTimeout(opts); got != tt.want {
+				t.Errorf("consumerTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestQuery_AbandonedChannelStopsCLI(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeFloodCLI(t)).
+		WithConsumerTimeout(50 * time.Millisecond)
+	messages, err := Query(ctx, "hi", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	<-messages
+
+	// Stop reading without cancelling ctx
+	waitFor(t, "the abandoned query's CLI to exit", func() bool {
+		return len(ActiveSubprocesses()) == 0
+	})
+
+	// What was buffered can still be read, then the channel closes
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-messages:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("channel was not closed after the consumer timeout")
+		}
+	}
+}
+
+func TestQuery_CancelStopsCLI(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The consumer timeout is disabled; cancelling ctx alone must clean up
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeFloodCLI(t)).
+		WithConsumerTimeout(0)
+	messages, err := Query(ctx, "hi", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	<-messages
+	cancel()
+
+	waitFor(t, "the cancelled query's CLI to exit", func() bool {
+		return len(ActiveSubprocesses()) == 0
+	})
+	waitFor(t, "the channel to close", func() bool {
+		for {
+			select {
+			case _, ok := <-messages:
+				if !ok {
+					return true
+				}
+			default:
+				return false
+			}
+		}
+	})
+}
+
+func TestQuery_SlowConsumerWithinTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lines := make([]string, 0, 16)
+	for i := 0; i < 15; i++ {
+		lines = append(lines, streamAssistant)
+	}
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeScriptedCLI(t, append(lines, streamResult)...)).
+		WithConsumerTimeout(time.Second)
+	messages, err := Query(ctx, "hi", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	// A consumer that pauses for less than the timeout loses nothing
+	time.Sleep(100 * time.Millisecond)
+	kinds, _ := systemSubtypes(messages)
+	if len(kinds) != 16 || kinds[15] != "result" {
+		t.Errorf("got %d messages ending in %v, want 15 assistant messages and the result", len(kinds), kinds[len(kinds)-1:])
+	}
+}
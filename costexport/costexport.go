@@ -0,0 +1,325 @@
+// Package costexport allocates the cost of Claude sessions to the values of a
+// tag, such as a tenant or team, and exports the totals as CSV or JSON for
+// billing and finance.
+//
+// The application records a Summary for each session it runs, built from the
+// session's final ResultMessage with FromResult, and either appends it to an
+// Aggregator directly or writes it to a summary file for later export:
+//
+//	summary := costexport.FromResult(result, map[string]string{"tenant": tenantID}, time.Now())
+//	if err := agg.Append(summary); err != nil {
+//	    log.Printf("cost summary: %v", err)
+//	}
+//
+// At the end of the month, the totals per tenant:
+//
+//	agg := costexport.NewAggregator()
+//	if err := agg.LoadDir("/var/lib/myapp/summaries"); err != nil {
+//	    log.Fatal(err)
+//	}
+//	report, err := agg.Report("tenant", costexport.Month(2026, time.September, time.UTC))
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	report.WriteCSV(os.Stdout)
+//
+// Costs are summed exactly, to the micro-dollar, and each group's cost is
+// rounded to the cent once, half away from zero. The total is the sum of the
+// rounded group costs, so the rows of an export always add up to its total.
+package costexport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Summary is the cost record of one session. In a summary file it is one
+// JSON object, in the form written by encoding/json.
+type Summary struct {
+	SessionID    string            `json:"session_id"`
+	EndedAt      time.Time         `json:"ended_at"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	CostUSD      float64           `json:"total_cost_usd"`
+	NumTurns     int               `json:"num_turns"`
+	InputTokens  int64             `json:"input_tokens"` // Including cache reads and writes
+	OutputTokens int64             `json:"output_tokens"`
+
+	// Parts of InputTokens read from and written to the prompt cache
+	CacheReadTokens     int64 `json:"cache_read_tokens,omitempty"`
+	CacheCreationTokens int64 `json:"cache_creation_tokens,omitempty"`
+}
+
+// FromResult builds the Summary of a session from its final ResultMessage,
+// with the application's tags for the session. A result without a cost
+// counts as free.
+func FromResult(result *types.ResultMessage, tags map[string]string, endedAt time.Time) Summary {
+	s := Summary{
+		SessionID: result.SessionID,
+		EndedAt:   endedAt,
+		NumTurns:  result.NumTurns,
+	}
+	if len(tags) > 0 {
+		s.Tags = make(map[string]string, len(tags))
+		for k, v := range tags {
+			s.Tags[k] = v
+		}
+	}
+	if result.TotalCostUSD != nil {
+		s.CostUSD = *result.TotalCostUSD
+	}
+	if usage, err := result.ParseUsage(); err == nil && usage != nil {
+		s.InputTokens = int64(usage.TotalInputTokens())
+		s.OutputTokens = int64(usage.OutputTokens)
+		s.CacheReadTokens = int64(usage.CacheReadInputTokens)
+		s.CacheCreationTokens = int64(usage.CacheCreationInputTokens)
+	}
+	return s
+}
+
+// Validate reports whether the summary can be aggregated: it needs a session
+// ID and a finite, non-negative cost.
+func (s Summary) Validate() error {
+	if s.SessionID == "" {
+		return fmt.Errorf("session_id is required")
+	}
+	if math.IsNaN(s.CostUSD) || math.IsInf(s.CostUSD, 0) || s.CostUSD < 0 {
+		return fmt.Errorf("session %s: invalid total_cost_usd %v", s.SessionID, s.CostUSD)
+	}
+	if s.NumTurns < 0 || s.InputTokens < 0 || s.OutputTokens < 0 || s.CacheReadTokens < 0 || s.CacheCreationTokens < 0 {
+		return fmt.Errorf("session %s: negative turn or token count", s.SessionID)
+	}
+	if s.CacheReadTokens+s.CacheCreationTokens > s.InputTokens {
+		return fmt.Errorf("session %s: more cache tokens than input tokens", s.SessionID)
+	}
+	return nil
+}
+
+// Aggregator collects session summaries for reports. Summaries sharing a
+// SessionID describe the same session at different points, so only the one
+// with the latest EndedAt is kept. It is safe for concurrent use.
+type Aggregator struct {
+	mu       sync.Mutex
+	sessions map[string]Summary
+}
+
+// NewAggregator returns an empty Aggregator.
+func NewAggregator() *Aggregator {
+	return &Aggregator{sessions: make(map[string]Summary)}
+}
+
+// Append adds a session summary, replacing an earlier summary of the same
+// session.
+func (a *Aggregator) Append(s Summary) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if prev, ok := a.sessions[s.SessionID]; ok && prev.EndedAt.After(s.EndedAt) {
+		return nil
+	}
+	a.sessions[s.SessionID] = s
+	return nil
+}
+
+// LoadDir appends the summaries in the files of dir, in name order: a .json
+// file holds one Summary and a .jsonl file one per line. Other files and
+// subdirectories are ignored. Summaries read before an error remain appended.
+func (a *Aggregator) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("costexport: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		switch filepath.Ext(entry.Name()) {
+		case ".json":
+			err = a.loadJSON(path)
+		case ".jsonl":
+			err = a.loadJSONL(path)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Aggregator) loadJSON(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("costexport: %w", err)
+	}
+	var s Summary
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("costexport: %s: %w", path, err)
+	}
+	if err := a.Append(s); err != nil {
+		return fmt.Errorf("costexport: %s: %w", path, err)
+	}
+	return nil
+}
+
+func (a *Aggregator) loadJSONL(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("costexport: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var s Summary
+		if err := json.Unmarshal(data, &s); err != nil {
+			return fmt.Errorf("costexport: %s line %d: %w", path, line, err)
+		}
+		if err := a.Append(s); err != nil {
+			return fmt.Errorf("costexport: %s line %d: %w", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("costexport: %s: %w", path, err)
+	}
+	return nil
+}
+
+// Period selects the sessions that ended at or after From and before To. A
+// zero From or To leaves that side unbounded.
+type Period struct {
+	From time.Time
+	To   time.Time
+}
+
+// Month returns the Period of a calendar month in loc.
+func Month(year int, month time.Month, loc *time.Location) Period {
+	from := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	return Period{From: from, To: from.AddDate(0, 1, 0)}
+}
+
+// Contains reports whether t falls within the period.
+func (p Period) Contains(t time.Time) bool {
+	return (p.From.IsZero() || !t.Before(p.From)) && (p.To.IsZero() || t.Before(p.To))
+}
+
+// Untagged is the group key of sessions without the grouping tag.
+const Untagged = "(untagged)"
+
+// Report groups the summaries of sessions that ended within period by their
+// value of the tag groupBy. Groups are sorted by key, with Untagged last.
+func (a *Aggregator) Report(groupBy string, period Period) (*Report, error) {
+	if groupBy == "" {
+		return nil, fmt.Errorf("costexport: group-by tag is required")
+	}
+
+	a.mu.Lock()
+	groups := make(map[string]*groupTotal)
+	for _, s := range a.sessions {
+		if !period.Contains(s.EndedAt) {
+			continue
+		}
+		key, ok := s.Tags[groupBy]
+		if !ok || key == "" {
+			key = Untagged
+		}
+		g := groups[key]
+		if g == nil {
+			g = &groupTotal{}
+			groups[key] = g
+		}
+		g.add(s)
+	}
+	a.mu.Unlock()
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == Untagged) != (keys[j] == Untagged) {
+			return keys[j] == Untagged
+		}
+		return keys[i] < keys[j]
+	})
+
+	report := &Report{GroupBy: groupBy, Period: period, Groups: make([]Group, 0, len(keys))}
+	report.Total.Key = "(total)"
+	for _, key := range keys {
+		g := groups[key].group(key)
+		report.Groups = append(report.Groups, g)
+		report.Total.Sessions += g.Sessions
+		report.Total.Turns += g.Turns
+		report.Total.InputTokens += g.InputTokens
+		report.Total.OutputTokens += g.OutputTokens
+		report.Total.CacheReadTokens += g.CacheReadTokens
+		report.Total.CacheCreationTokens += g.CacheCreationTokens
+		report.Total.CostCents += g.CostCents
+	}
+	return report, nil
+}
+
+// groupTotal accumulates a group's sessions, with cost in micro-dollars so
+// that summing is exact.
+type groupTotal struct {
+	sessions      int
+	turns         int
+	inputTokens   int64
+	outputTokens  int64
+	cacheRead     int64
+	cacheCreation int64
+	costMicros    int64
+}
+
+func (g *groupTotal) add(s Summary) {
+	g.sessions++
+	g.turns += s.NumTurns
+	g.inputTokens += s.InputTokens
+	g.outputTokens += s.OutputTokens
+	g.cacheRead += s.CacheReadTokens
+	g.cacheCreation += s.CacheCreationTokens
+	g.costMicros += int64(math.Round(s.CostUSD * 1e6))
+}
+
+func (g *groupTotal) group(key string) Group {
+	return Group{
+		Key:          key,
+		Sessions:     g.sessions,
+		Turns:        g.turns,
+		InputTokens:  g.inputTokens,
+		OutputTokens: g.outputTokens,
+		CostCents:    roundMicrosToCents(g.costMicros),
+
+		CacheReadTokens:     g.cacheRead,
+		CacheCreationTokens: g.cacheCreation,
+	}
+}
+
+// roundMicrosToCents rounds micro-dollars to cents, half away from zero.
+func roundMicrosToCents(micros int64) int64 {
+	cents, rem := micros/10000, micros%10000
+	if rem >= 5000 {
+		cents++
+	}
+	return cents
+}
@@ -0,0 +1,370 @@
+package costexport
+
+import (
+	"bytes"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// TestReportGolden tests the September export of the summaries in testdata,
+// grouped by tenant, against golden files. The summaries cover a superseded
+// session summary, sessions just outside the month, an untagged session and a
+// tenant value that a spreadsheet would read as a formula.
+func TestReportGolden(t *testing.T) {
+	agg := NewAggregator()
+	if err := agg.LoadDir(filepath.Join("testdata", "summaries")); err != nil {
+		t.Fatal(err)
+	}
+	report, err := agg.Report("tenant", Month(2026, time.September, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		golden string
+		write  func(*Report, *bytes.Buffer) error
+	}{
+		{"report.csv.golden", func(r *Report, b *bytes.Buffer) error { return r.WriteCSV(b) }},
+		{"report.json.golden", func(r *Report, b *bytes.Buffer) error { return r.WriteJSON(b) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := tt.write(report, &out); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != string(want) {
+				t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+			}
+		})
+	}
+}
+
+// TestReportRounding tests that costs are summed exactly and rounded once per
+// group, half away from zero, and that the total adds up the rounded groups.
+func TestReportRounding(t *testing.T) {
+	agg := NewAggregator()
+	summaries := []Summary{
+		// 0.004 + 0.001 = 0.005 exactly, which rounds up; summed in float64
+		// it would be 0.0049999... and round down.
+		{SessionID: "a1", Tags: map[string]string{"tenant": "a"}, CostUSD: 0.004},
+		{SessionID: "a2", Tags: map[string]string{"tenant": "a"}, CostUSD: 0.001},
+		// Each 0.333333 alone would round to 0.33; together they are 1.00.
+		{SessionID: "b1", Tags: map[string]string{"tenant": "b"}, CostUSD: 0.333333},
+		{SessionID: "b2", Tags: map[string]string{"tenant": "b"}, CostUSD: 0.333333},
+		{SessionID: "b3", Tags: map[string]string{"tenant": "b"}, CostUSD: 0.333334},
+		{SessionID: "c1", Tags: map[string]string{"tenant": "c"}, CostUSD: 0.004999},
+		// Costs are kept to the micro-dollar, so this is 0.015000.
+		{SessionID: "d1", Tags: map[string]string{"tenant": "d"}, CostUSD: 0.0149999999},
+	}
+	for _, s := range summaries {
+		if err := agg.Append(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := agg.Report("tenant", Period{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"a": "0.01", "b": "1.00", "c": "0.00", "d": "0.02"}
+	for _, g := range report.Groups {
+		if g.CostUSD() != want[g.Key] {
+			t.Errorf("group %s cost = %s, want %s", g.Key, g.CostUSD(), want[g.Key])
+		}
+	}
+	if got := report.Total.CostUSD(); got != "1.03" {
+		t.Errorf("total cost = %s, want 1.03", got)
+	}
+}
+
+func TestRoundMicrosToCents(t *testing.T) {
+	tests := []struct {
+		micros int64
+		want   int64
+	}{
+		{0, 0},
+		{4999, 0},
+		{5000, 1},
+		{14999, 1},
+		{15000, 2},
+		{1234567, 123},
+		{1235000, 124},
+	}
+	for _, tt := range tests {
+		if got := roundMicrosToCents(tt.micros); got != tt.want {
+			t.Errorf("roundMicrosToCents(%d) = %d, want %d", tt.micros, got, tt.want)
+		}
+	}
+}
+
+// TestReportPeriod tests that a period includes its start and excludes its
+// end, and that an empty period includes everything.
+func TestReportPeriod(t *testing.T) {
+	agg := NewAggregator()
+	times := map[string]time.Time{
+		"before": time.Date(2026, time.August, 31, 23, 59, 59, 0, time.UTC),
+		"start":  time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC),
+		"last":   time.Date(2026, time.September, 30, 23, 59, 59, 999999999, time.UTC),
+		"end":    time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for id, endedAt := range times {
+		if err := agg.Append(Summary{SessionID: id, EndedAt: endedAt, Tags: map[string]string{"tenant": id}, CostUSD: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := agg.Report("tenant", Month(2026, time.September, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := groupKeys(report); keys != "last,start" {
+		t.Errorf("September groups = %s, want last,start", keys)
+	}
+
+	// September in UTC+2 starts and ends two hours earlier in UTC
+	report, err = agg.Report("tenant", Month(2026, time.September, time.FixedZone("UTC+2", 2*60*60)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := groupKeys(report); keys != "before,start" {
+		t.Errorf("September in UTC+2 groups = %s, want before,start", keys)
+	}
+
+	report, err = agg.Report("tenant", Period{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Sessions != len(times) {
+		t.Errorf("unbounded total sessions = %d, want %d", report.Total.Sessions, len(times))
+	}
+}
+
+// TestReportGrouping tests that groups are sorted with sessions lacking the
+// tag, or having it empty, collected last.
+func TestReportGrouping(t *testing.T) {
+	agg := NewAggregator()
+	summaries := []Summary{
+		{SessionID: "1", Tags: map[string]string{"team": "zeta"}},
+		{SessionID: "2", Tags: map[string]string{"team": ""}},
+		{SessionID: "3"},
+		{SessionID: "4", Tags: map[string]string{"team": "alpha"}},
+		{SessionID: "5", Tags: map[string]string{"team": "(zzz)"}},
+	}
+	for _, s := range summaries {
+		if err := agg.Append(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := agg.Report("team", Period{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := groupKeys(report); keys != "(zzz),alpha,zeta,"+Untagged {
+		t.Errorf("groups = %s", keys)
+	}
+	if last := report.Groups[len(report.Groups)-1]; last.Sessions != 2 {
+		t.Errorf("untagged sessions = %d, want 2", last.Sessions)
+	}
+
+	if _, err := agg.Report("", Period{}); err == nil {
+		t.Error("Report with an empty group-by tag succeeded")
+	}
+}
+
+// TestAppendSupersedes tests that the latest summary of a session wins,
+// whatever the order of appending.
+func TestAppendSupersedes(t *testing.T) {
+	early := time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)
+	agg := NewAggregator()
+	for _, s := range []Summary{
+		{SessionID: "s", EndedAt: early.Add(time.Hour), CostUSD: 2, NumTurns: 4},
+		{SessionID: "s", EndedAt: early, CostUSD: 1, NumTurns: 2},
+	} {
+		if err := agg.Append(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := agg.Report("tenant", Period{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Sessions != 1 || report.Total.Turns != 4 || report.Total.CostUSD() != "2.00" {
+		t.Errorf("total = %+v, want the later summary", report.Total)
+	}
+}
+
+func TestAppendInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		summary Summary
+	}{
+		{"no session", Summary{CostUSD: 1}},
+		{"negative cost", Summary{SessionID: "s", CostUSD: -0.01}},
+		{"NaN cost", Summary{SessionID: "s", CostUSD: math.NaN()}},
+		{"infinite cost", Summary{SessionID: "s", CostUSD: math.Inf(1)}},
+		{"negative tokens", Summary{SessionID: "s", InputTokens: -1}},
+		{"more cache than input", Summary{SessionID: "s", InputTokens: 10, CacheReadTokens: 8, CacheCreationTokens: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewAggregator().Append(tt.summary); err == nil {
+				t.Error("Append succeeded")
+			}
+		})
+	}
+}
+
+func TestAppendConcurrent(t *testing.T) {
+	agg := NewAggregator()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = agg.Append(Summary{SessionID: string(rune('a' + i%26)), CostUSD: 0.01})
+		}(i)
+	}
+	wg.Wait()
+	report, err := agg.Report("tenant", Period{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Sessions != 26 {
+		t.Errorf("sessions = %d, want 26", report.Total.Sessions)
+	}
+}
+
+// TestLoadDirErrors tests that malformed summary files are reported with the
+// file and line.
+func TestLoadDirErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"malformed line", "a.jsonl", `{"session_id":"s1","total_cost_usd":1}` + "\nnot json\n", "a.jsonl line 2: "},
+		{"invalid line", "a.jsonl", "\n" + `{"session_id":"s1","total_cost_usd":-1}` + "\n", "a.jsonl line 2: session s1: invalid total_cost_usd"},
+		{"malformed file", "b.json", `{"session_id":`, "b.json: "},
+		{"missing session", "b.json", `{"total_cost_usd":1}`, "b.json: session_id is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := NewAggregator().LoadDir(dir)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadDir error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if err := NewAggregator().LoadDir(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadDir of a missing directory succeeded")
+	}
+}
+
+func TestFromResult(t *testing.T) {
+	cost := 0.42
+	result := &types.ResultMessage{
+		SessionID:    "sess-1",
+		NumTurns:     3,
+		TotalCostUSD: &cost,
+		Usage: map[string]interface{}{
+			"input_tokens":                100,
+			"cache_read_input_tokens":     900,
+			"cache_creation_input_tokens": 50,
+			"output_tokens":               70,
+		},
+	}
+	tags := map[string]string{"tenant": "acme"}
+	endedAt := time.Date(2026, time.September, 5, 12, 0, 0, 0, time.UTC)
+
+	s := FromResult(result, tags, endedAt)
+	tags["tenant"] = "changed"
+
+	want := Summary{
+		SessionID:    "sess-1",
+		EndedAt:      endedAt,
+		Tags:         map[string]string{"tenant": "acme"},
+		CostUSD:      0.42,
+		NumTurns:     3,
+		InputTokens:  1050,
+		OutputTokens: 70,
+
+		CacheReadTokens:     900,
+		CacheCreationTokens: 50,
+	}
+	if s.SessionID != want.SessionID || !s.EndedAt.Equal(want.EndedAt) || s.Tags["tenant"] != "acme" ||
+		s.CostUSD != want.CostUSD || s.NumTurns != want.NumTurns ||
+		s.InputTokens != want.InputTokens || s.OutputTokens != want.OutputTokens ||
+		s.CacheReadTokens != want.CacheReadTokens || s.CacheCreationTokens != want.CacheCreationTokens {
+		t.Errorf("FromResult = %+v, want %+v", s, want)
+	}
+
+	if s := FromResult(&types.ResultMessage{SessionID: "free"}, nil, endedAt); s.CostUSD != 0 || s.Tags != nil {
+		t.Errorf("FromResult without cost = %+v", s)
+	}
+}
+
+func TestGroupCacheHitRate(t *testing.T) {
+	if got := (Group{}).CacheHitRate(); got != 0 {
+		t.Errorf("CacheHitRate without input = %v, want 0", got)
+	}
+	if got := (Group{InputTokens: 1000, CacheReadTokens: 250}).CacheHitRate(); got != 0.25 {
+		t.Errorf("CacheHitRate = %v, want 0.25", got)
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := map[string]string{
+		"acme":        "acme",
+		"":            "",
+		"=SUM(A1)":    "'=SUM(A1)",
+		"+1":          "'+1",
+		"-1":          "'-1",
+		"@cmd":        "'@cmd",
+		"team-a":      "team-a",
+		"\tindented":  "'\tindented",
+		"a=b":         "a=b",
+		"(untagged)":  "(untagged)",
+		"multi\nline": "multi\nline",
+	}
+	for in, want := range tests {
+		if got := csvCell(in); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func groupKeys(r *Report) string {
+	keys := make([]string, len(r.Groups))
+	for i, g := range r.Groups {
+		keys[i] = g.Key
+	}
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,166 @@
+package costexport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report is the cost of the sessions in a period, grouped by a tag.
+type Report struct {
+	GroupBy string
+	Period  Period
+	Groups  []Group
+	Total   Group // Key is "(total)"; CostCents is the sum of the groups' rounded costs
+}
+
+// Group is the aggregate of the sessions sharing a tag value.
+type Group struct {
+	Key          string
+	Sessions     int
+	Turns        int
+	InputTokens  int64
+	OutputTokens int64
+	CostCents    int64 // Rounded to the cent, half away from zero
+
+	// Parts of InputTokens read from and written to the prompt cache
+	CacheReadTokens     int64
+	CacheCreationTokens int64
+}
+
+// CostUSD returns the group's rounded cost in dollars, such as "12.05".
+func (g Group) CostUSD() string {
+	return formatCents(g.CostCents)
+}
+
+// CacheHitRate returns the fraction of the group's input tokens that were
+// read from the prompt cache, in the range [0, 1]. It returns 0 when the
+// group has no input tokens.
+func (g Group) CacheHitRate() float64 {
+	if g.InputTokens == 0 {
+		return 0
+	}
+	return float64(g.CacheReadTokens) / float64(g.InputTokens)
+}
+
+// cacheHitRate formats the group's cache hit rate with four decimals.
+func (g Group) cacheHitRate() string {
+	return strconv.FormatFloat(g.CacheHitRate(), 'f', 4, 64)
+}
+
+// WriteCSV writes the report as CSV: a header naming the tag, one row per
+// group and a final "(total)" row. Tag values that a spreadsheet would read as
+// a formula are prefixed with a single quote.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{csvCell(r.GroupBy), "sessions", "turns", "input_tokens", "cache_read_tokens",
+		"cache_creation_tokens", "cache_hit_rate", "output_tokens", "cost_usd"}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	rows := append(append([]Group(nil), r.Groups...), r.Total)
+	for _, g := range rows {
+		row := []string{
+			csvCell(g.Key),
+			strconv.Itoa(g.Sessions),
+			strconv.Itoa(g.Turns),
+			strconv.FormatInt(g.InputTokens, 10),
+			strconv.FormatInt(g.CacheReadTokens, 10),
+			strconv.FormatInt(g.CacheCreationTokens, 10),
+			g.cacheHitRate(),
+			strconv.FormatInt(g.OutputTokens, 10),
+			g.CostUSD(),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// jsonReport is the JSON form of a Report.
+type jsonReport struct {
+	GroupBy string      `json:"group_by"`
+	From    *time.Time  `json:"from,omitempty"`
+	To      *time.Time  `json:"to,omitempty"`
+	Groups  []jsonGroup `json:"groups"`
+	Total   jsonGroup   `json:"total"`
+}
+
+// jsonGroup is the JSON form of a Group. The cost and cache hit rate are
+// numbers with exactly two and four decimals, so that they read the same as
+// in the CSV.
+type jsonGroup struct {
+	Key                 string      `json:"key,omitempty"`
+	Sessions            int         `json:"sessions"`
+	Turns               int         `json:"turns"`
+	InputTokens         int64       `json:"input_tokens"`
+	CacheReadTokens     int64       `json:"cache_read_tokens"`
+	CacheCreationTokens int64       `json:"cache_creation_tokens"`
+	CacheHitRate        json.Number `json:"cache_hit_rate"`
+	OutputTokens        int64       `json:"output_tokens"`
+	CostUSD             json.Number `json:"cost_usd"`
+}
+
+func newJSONGroup(g Group) jsonGroup {
+	return jsonGroup{
+		Key:                 g.Key,
+		Sessions:            g.Sessions,
+		Turns:               g.Turns,
+		InputTokens:         g.InputTokens,
+		CacheReadTokens:     g.CacheReadTokens,
+		CacheCreationTokens: g.CacheCreationTokens,
+		CacheHitRate:        json.Number(g.cacheHitRate()),
+		OutputTokens:        g.OutputTokens,
+		CostUSD:             json.Number(g.CostUSD()),
+	}
+}
+
+// WriteJSON writes the report as an indented JSON object with the group-by
+// tag, the period bounds that are set, the groups and the total.
+func (r *Report) WriteJSON(w io.Writer) error {
+	out := jsonReport{
+		GroupBy: r.GroupBy,
+		Groups:  make([]jsonGroup, 0, len(r.Groups)),
+		Total:   newJSONGroup(r.Total),
+	}
+	out.Total.Key = ""
+	if !r.Period.From.IsZero() {
+		out.From = &r.Period.From
+	}
+	if !r.Period.To.IsZero() {
+		out.To = &r.Period.To
+	}
+	for _, g := range r.Groups {
+		out.Groups = append(out.Groups, newJSONGroup(g))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return fmt.Errorf("costexport: %w", err)
+	}
+	return nil
+}
+
+// formatCents formats cents as dollars with two decimals, such as "12.05".
+func formatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// csvFormulaPrefixes start cells that spreadsheets evaluate as formulas.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCell neutralizes a tag value that a spreadsheet would evaluate as a
+// formula by prefixing it with a single quote.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -12,11 +12,7 @@
 //	}
 //	for msg := range messages {
 //	    if assistantMsg, ok := msg.(*types.AssistantMessage); ok {
-//	        for _, block := range assistantMsg.Content {
-//	            if textBlock, ok := block.(*types.TextBlock); ok {
-//	                fmt.Println(textBlock.Text)
-//	            }
-//	        }
+//	        fmt.Println(assistantMsg.Text())
 //	    }
 //	}
 //
@@ -46,6 +42,21 @@
 //	    }
 //	}
 //
+// Client.Process runs the same loop for you, calling a handler for each text,
+// thinking, tool use, tool result, and system message, and returns the result:
+//
+//	result, err := client.Process(ctx, "Hello, Claude!", claude.Handlers{
+//	    OnText: func(text string) error {
+//	        fmt.Print(text)
+//	        return nil
+//	    },
+//	})
+//
+// Client.SplitResponse delivers the answer text and the thinking of a turn on
+// separate channels, for UIs that render them apart.
+// CollectAssistantText joins the text of the assistant messages in a slice of
+// messages, such as a turn collected from ReceiveResponse.
+//
 // Query vs Client:
 //
 // Use Query when:
@@ -74,6 +85,11 @@
 //	    log.Fatal("Unexpected error:", err)
 //	}
 //
+// Errors that occur while a response streams arrive in-band as SystemMessages
+// whose Err field holds the typed error ("parse_error" for an unreadable line,
+// "transport_failed" when the stream ends early); Client.Err returns the error
+// that ended the stream.
+//
 // Configuration:
 //
 // Use ClaudeAgentOptions to configure the SDK:
@@ -89,7 +105,7 @@
 // Control tool execution with permission callbacks:
 //
 //	opts := types.NewClaudeAgentOptions().
-//	    WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+//	    WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
 //	        // Allow safe tools automatically
 //	        if toolName == "Read" {
 //	            return types.PermissionResultAllow{
@@ -134,5 +150,18 @@
 //	    }
 //	}
 //
+// Middleware:
+//
+// Wrap Query with Middleware to add retries, caching, or rate limiting, and
+// Client sends with a ClientInterceptor:
+//
+//	query := Chain(
+//	    RateLimit(time.Second, 5),
+//	    Retry(3, 500*time.Millisecond),
+//	    Cache(10*time.Minute),
+//	)(Query)
+//
+//	messages, err := query(ctx, "What is 2+2?", opts)
+//
 // For more examples and detailed usage, see the examples/ directory.
 package claude
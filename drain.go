@@ -0,0 +1,69 @@
+package claude
+
+import (
+	"context"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// drainOnClose closes the CLI's input and reads the messages it still sends
+// for up to the WithDrainOnClose window, recording them as ReceiveResponse
+// does and keeping them for DrainedMessages. It returns early once the CLI
+// closes its output. The caller holds c.mu.
+func (c *Client) drainOnClose(ctx context.Context) {
+	if c.options.DrainOnClose == nil || *c.options.DrainOnClose <= 0 || c.query == nil {
+		return
+	}
+	if err := c.conn.EndInput(ctx); err != nil {
+		logState(c.options, "drain skipped", "error", err)
+		return
+	}
+
+	timer := time.NewTimer(*c.options.DrainOnClose)
+	defer timer.Stop()
+	// As with the close timeout, a cancelled ctx does not cut the window short
+	var ctxDone <-chan struct{}
+	if ctx.Err() == nil {
+		ctxDone = ctx.Done()
+	}
+
+	start := time.Now()
+	messages := c.query.GetMessages(ctx)
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				logState(c.options, "drain finished", "messages", len(c.drained))
+				return
+			}
+			c.intercepted.apply(msg)
+			recordMessage(c.options, &c.costs, msg, start)
+			c.tools.observe(msg)
+			c.usage.observe(msg)
+			c.history.observe(msg)
+			c.traceMessage(msg)
+			c.governor.charge(c, msg)
+			c.drained = append(c.drained, msg)
+		case <-timer.C:
+			logState(c.options, "drain window expired", "messages", len(c.drained))
+			return
+		case <-ctxDone:
+			logState(c.options, "drain cancelled", "messages", len(c.drained))
+			return
+		}
+	}
+}
+
+// DrainedMessages returns the messages Close read from the CLI during the
+// WithDrainOnClose window, oldest first, such as a final ResultMessage the
+// CLI flushed after its input closed. They count towards CacheMetrics and
+// the MetricsSink like messages received through ReceiveResponse. Messages
+// that a ReceiveResponse still running during Close received are delivered
+// there instead and are not repeated here. It returns nil before Close or
+// without WithDrainOnClose.
+func (c *Client) DrainedMessages() []types.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]types.Message(nil), c.drained...)
+}
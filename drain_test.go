@@ -0,0 +1,107 @@
+package claude
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// drainResult is a result with usage, which the drain CLI only sends once
+// its input is closed.
+const drainResult = `{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s","total_cost_usd":0.01,"usage":{"input_tokens":10,"cache_read_input_tokens":90,"output_tokens":5}}`
+
+// TestClient_DrainOnClose tests that Close records the result a CLI flushes
+// after its input closes, and drops it without WithDrainOnClose.
+func TestClient_DrainOnClose(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		drain time.Duration
+		want  int
+	}{
+		{"drain", 5 * time.Second, 1},
+		{"no drain", 0, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+				mockcli.AwaitPrompt(),
+				mockcli.AwaitInputClosed(),
+				mockcli.Send(drainResult),
+			}})
+			opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithDrainOnClose(tt.drain)
+			client, err := NewClient(ctx, opts)
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+			if err := client.Query(ctx, "hi"); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+
+			start := time.Now()
+			if err := client.Close(ctx); err != nil {
+				t.Errorf("Close = %v, want nil", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Close took %v, want it to end when the CLI exits", elapsed)
+			}
+
+			drained := client.DrainedMessages()
+			if len(drained) != tt.want {
+				t.Fatalf("DrainedMessages() = %v, want %d messages", drained, tt.want)
+			}
+			if tt.want == 0 {
+				return
+			}
+			if _, ok := drained[0].(*types.ResultMessage); !ok {
+				t.Errorf("drained %T, want the ResultMessage", drained[0])
+			}
+			if got := client.CacheMetrics().CacheReadTokens; got != 90 {
+				t.Errorf("CacheMetrics().CacheReadTokens = %d, want 90 from the drained result", got)
+			}
+		})
+	}
+}
+
+// TestClient_DrainOnCloseKill tests that a CLI still running after the drain
+// window is killed once the close timeout has also passed.
+func TestClient_DrainOnCloseKill(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{mockcli.AwaitPrompt(), mockcli.Hang()}})
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithDrainOnClose(200 * time.Millisecond).
+		WithCloseTimeout(200 * time.Millisecond)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	start := time.Now()
+	err = client.Close(ctx)
+	elapsed := time.Since(start)
+	if !types.IsProcessError(err) {
+		t.Errorf("Close = %v, want a ProcessError for the killed CLI", err)
+	}
+	if elapsed < 400*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Close took %v, want the drain window plus the close timeout", elapsed)
+	}
+	if got := client.DrainedMessages(); len(got) != 0 {
+		t.Errorf("DrainedMessages() = %v, want none", got)
+	}
+}
@@ -0,0 +1,166 @@
+package claude
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadEnvFile reads and parses the dotenv file at path.
+func loadEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("env file: %w", err)
+	}
+	env, err := parseEnvFile(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("env file %s: %w", path, err)
+	}
+	return env, nil
+}
+
+// parseEnvFile parses dotenv syntax: one KEY=VALUE per line, with blank lines
+// and lines starting with # ignored and an optional "export " prefix.
+//
+// Unquoted values are trimmed and end at a # preceded by whitespace.
+// Single-quoted values are taken literally. Double-quoted values understand
+// the escapes \n, \r, \t, \", \\ and \$. Quoted values may span lines.
+// Variables are not expanded. A later assignment to a key replaces an earlier one.
+func parseEnvFile(data string) (map[string]string, error) {
+	data = strings.TrimPrefix(data, "\ufeff")
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	lines := strings.Split(data, "\n")
+
+	env := make(map[string]string)
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimLeft(lines[i], " \t")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if rest, ok := cutExport(line); ok {
+			line = rest
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !validEnvKey(key) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", lineNo, key)
+		}
+
+		raw := line[eq+1:]
+		value := strings.TrimLeft(raw, " \t")
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			env[key] = unquotedEnvValue(raw)
+			continue
+		}
+
+		// A quoted value runs to its closing quote, on this line or a later one
+		quote := value[0]
+		body := value[1:]
+		for {
+			end := closingQuote(body, quote)
+			if end >= 0 {
+				if rest := strings.TrimSpace(body[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+					return nil, fmt.Errorf("line %d: unexpected %q after closing quote", i+1, rest)
+				}
+				body = body[:end]
+				break
+			}
+			i++
+			if i >= len(lines) {
+				return nil, fmt.Errorf("line %d: unterminated quoted value for %s", lineNo, key)
+			}
+			body += "\n" + lines[i]
+		}
+		if quote == '"' {
+			body = unescapeEnvValue(body)
+		}
+		env[key] = body
+	}
+	return env, nil
+}
+
+// cutExport strips a leading "export" keyword followed by whitespace.
+func cutExport(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "export")
+	if !ok || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+		return line, false
+	}
+	return strings.TrimLeft(rest, " \t"), true
+}
+
+// validEnvKey reports whether key is a portable variable name: letters,
+// digits and underscores, not starting with a digit.
+func validEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// unquotedEnvValue trims an unquoted value and drops a trailing comment.
+func unquotedEnvValue(raw string) string {
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i > 0 && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+			raw = raw[:i]
+			break
+		}
+	}
+	return strings.TrimSpace(raw)
+}
+
+// closingQuote returns the index of the quote ending s, or -1. Within double
+// quotes a backslash escapes the next character.
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeEnvValue resolves the escapes of a double-quoted value. Unknown
+// escapes are kept as they are.
+func unescapeEnvValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\', '$':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,229 @@
+package claude
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"simple", "A=1\nB=two", map[string]string{"A": "1", "B": "two"}},
+		{"comments and blank lines", "# setup\n\n  # indented\nA=1\n", map[string]string{"A": "1"}},
+		{"export prefix", "export A=1\nexport\tB=2", map[string]string{"A": "1", "B": "2"}},
+		{"key named export", "export=1", map[string]string{"export": "1"}},
+		{"spaces around equals", "A = 1 \n  B=  2", map[string]string{"A": "1", "B": "2"}},
+		{"empty value", "A=\nB=''\nC=\"\"", map[string]string{"A": "", "B": "", "C": ""}},
+		{"inline comment", "A=1 # the first\nB=2\t#tab", map[string]string{"A": "1", "B": "2"}},
+		{"comment after empty value", "A= # unset for now", map[string]string{"A": ""}},
+		{"hash without space", "A=a#b\nCOLOR=#fff", map[string]string{"A": "a#b", "COLOR": "#fff"}},
+		{"equals in value", "URL=https://x.example/?a=1&b=2", map[string]string{"URL": "https://x.example/?a=1&b=2"}},
+		{"single quotes are literal", `A='$HOME \n # not a comment'`, map[string]string{"A": `$HOME \n # not a comment`}},
+		{"double quote escapes", `A="line1\nline2\t\"q\" \\ \$X \z"`, map[string]string{"A": "line1\nline2\t\"q\" \\ $X \\z"}},
+		{"no expansion", "A=1\nB=${A}", map[string]string{"A": "1", "B": "${A}"}},
+		{"quoted value with comment", `A="x # y" # comment`, map[string]string{"A": "x # y"}},
+		{"quoted value keeps spaces", `A="  padded  "`, map[string]string{"A": "  padded  "}},
+		{
+			"multiline double quotes",
+			"KEY=\"-----BEGIN KEY-----\nabc\n-----END KEY-----\"\nNEXT=1",
+			map[string]string{"KEY": "-----BEGIN KEY-----\nabc\n-----END KEY-----", "NEXT": "1"},
+		},
+		{"multiline single quotes", "A='one\n  two '\nB=2", map[string]string{"A": "one\n  two ", "B": "2"}},
+		{"CRLF line endings", "A=1\r\nB=\"x\"\r\n", map[string]string{"A": "1", "B": "x"}},
+		{"byte order mark", "\ufeffA=1", map[string]string{"A": "1"}},
+		{"later assignment wins", "A=1\nA=2", map[string]string{"A": "2"}},
+		{"underscores and digits", "_A1=x\nb_2=y", map[string]string{"_A1": "x", "b_2": "y"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnvFile(tt.data)
+			if err != nil {
+				t.Fatalf("parseEnvFile() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEnvFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEnvFile_Malformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"missing equals", "A=1\nJUSTAKEY", "line 2: expected KEY=VALUE"},
+		{"export without assignment", "export A", "line 1: expected KEY=VALUE"},
+		{"empty key", "=value", `line 1: invalid variable name ""`},
+		{"key with space", "MY KEY=1", `invalid variable name "MY KEY"`},
+		{"key starting with digit", "1A=1", `invalid variable name "1A"`},
+		{"key with dash", "A-B=1", `invalid variable name "A-B"`},
+		{"unterminated double quote", "A=1\nB=\"open\nstill open", "line 2: unterminated quoted value for B"},
+		{"unterminated single quote", "A='open", "line 1: unterminated quoted value for A"},
+		{"escaped closing quote", `A="open\"`, "unterminated quoted value"},
+		{"text after closing quote", `A="x"y`, `line 1: unexpected "y" after closing quote`},
+		{"text after multiline value", "A='x\ny' z", `line 2: unexpected "z" after closing quote`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseEnvFile(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseEnvFile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeEnvFile writes data to a .env file in a new temporary directory.
+func writeEnvFile(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// recordedCLIEnv connects a client to a CLI that records the named
+// environment variables and returns their values, in order.
+func recordedCLIEnv(t *testing.T, opts *types.ClaudeAgentOptions, names ...string) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env")
+	cliPath := filepath.Join(dir, "claude")
+	var vars []string
+	for _, name := range names {
+		vars = append(vars, `"$`+name+`"`)
+	}
+	// The version probe runs the script too, without the options' environment
+	script := "#!/bin/sh\n[ \"$1\" = --version ] && { echo '2.0.0 (Claude Code)'; exit 0; }\n" +
+		"printf '%s\\n' " + strings.Join(vars, " ") + " > " + envFile + "\ncat >/dev/null\n"
+	if err := os.WriteFile(cliPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(context.Background(), opts.Clone().WithCLIPath(cliPath))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+
+	// The script never answers initialize, so Connect is abandoned once the
+	// environment has been recorded
+	ctx, cancel := context.WithCancel(context.Background())
+	connected := make(chan struct{})
+	go func() {
+		defer close(connected)
+		_ = client.Connect(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-connected
+	}()
+
+	var data []byte
+	waitFor(t, "the CLI to record its environment", func() bool {
+		data, err = os.ReadFile(envFile)
+		return err == nil && len(data) > 0
+	})
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// TestWithEnvFile_Precedence tests that explicit variables override the env
+// file, which overrides the inherited environment, and that the parent
+// process environment is left alone.
+func TestWithEnvFile_Precedence(t *testing.T) {
+	t.Setenv("SDK_ENV_INHERITED", "parent")
+	t.Setenv("SDK_ENV_FROM_FILE", "parent")
+	t.Setenv("SDK_ENV_EXPLICIT", "parent")
+
+	path := writeEnvFile(t, "SDK_ENV_FROM_FILE=file\nexport SDK_ENV_EXPLICIT=file\nSDK_ENV_ONLY_FILE=\"multi\nline\"\n")
+	opts := types.NewClaudeAgentOptions().
+		WithEnvFile(path).
+		WithEnvVar("SDK_ENV_EXPLICIT", "explicit")
+
+	got := recordedCLIEnv(t, opts, "SDK_ENV_INHERITED", "SDK_ENV_FROM_FILE", "SDK_ENV_EXPLICIT", "SDK_ENV_ONLY_FILE")
+	want := []string{"parent", "file", "explicit", "multi", "line"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CLI environment = %q, want %q", got, want)
+	}
+
+	if v := os.Getenv("SDK_ENV_FROM_FILE"); v != "parent" {
+		t.Errorf("parent SDK_ENV_FROM_FILE = %q, want it unchanged", v)
+	}
+	if _, ok := os.LookupEnv("SDK_ENV_ONLY_FILE"); ok {
+		t.Error("SDK_ENV_ONLY_FILE leaked into the parent environment")
+	}
+	if len(opts.Env) != 1 {
+		t.Errorf("caller's Env = %v, want it unchanged", opts.Env)
+	}
+}
+
+// TestWithDeterministicEnv tests that the deterministic variables override
+// the inherited environment and are overridden by the env file and explicit
+// variables.
+func TestWithDeterministicEnv(t *testing.T) {
+	t.Setenv("LC_ALL", "de_DE.UTF-8")
+	t.Setenv("TZ", "Europe/Berlin")
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	names := []string{"LC_ALL", "TZ", "SOURCE_DATE_EPOCH"}
+
+	got := recordedCLIEnv(t, types.NewClaudeAgentOptions(), names...)
+	if want := []string{"de_DE.UTF-8", "Europe/Berlin", "1700000000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CLI environment without WithDeterministicEnv = %q, want the inherited %q", got, want)
+	}
+
+	got = recordedCLIEnv(t, types.NewClaudeAgentOptions().WithDeterministicEnv(true), names...)
+	if want := []string{"C", "UTC", "0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CLI environment = %q, want %q", got, want)
+	}
+
+	opts := types.NewClaudeAgentOptions().
+		WithDeterministicEnv(true).
+		WithEnvFile(writeEnvFile(t, "TZ=America/New_York\n")).
+		WithEnvVar("SOURCE_DATE_EPOCH", "1234567890")
+	got = recordedCLIEnv(t, opts, names...)
+	if want := []string{"C", "America/New_York", "1234567890"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("CLI environment with overrides = %q, want %q", got, want)
+	}
+	if len(opts.Env) != 1 {
+		t.Errorf("caller's Env = %v, want it unchanged", opts.Env)
+	}
+}
+
+func TestWithEnvFile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.env"), "env file: open"},
+		{"malformed file", writeEnvFile(t, "A=1\nB='unterminated\n"), "line 2: unterminated quoted value for B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := types.NewClaudeAgentOptions().WithCLIPath(writeEchoCLI(t)).WithEnvFile(tt.path)
+			if _, err := NewClient(context.Background(), opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewClient error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := Query(context.Background(), "hi", opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Query error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -6,24 +6,40 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	claude "github.com/schlunsen/claude-agent-sdk-go"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 	"golang.org/x/net/websocket"
 )
 
-// QueryRequest represents a query message from the WebSocket client
-type QueryRequest struct {
-	Prompt string `json:"prompt"`
+// ClientFrame represents a message from the WebSocket client: a prompt, or
+// the reply to a permission request
+type ClientFrame struct {
+	Type      string `json:"type,omitempty"` // "" or "query" for a prompt, "permission_response" for a reply
+	Prompt    string `json:"prompt,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Behavior  string `json:"behavior,omitempty"` // "allow" or "deny"
+	Message   string `json:"message,omitempty"`  // Reason shown to Claude on deny
 }
 
-// ResponseMessage represents a response message sent to the WebSocket client
+// ResponseMessage represents a response message sent to the WebSocket client.
+// Raw carries the untouched CLI frame so clients can forward it to other systems.
 type ResponseMessage struct {
-	Type    string      `json:"type"`
-	Content interface{} `json:"content"`
-	Error   string      `json:"error,omitempty"`
+	Type    string          `json:"type"`
+	Content interface{}     `json:"content"`
+	Raw     json.RawMessage `json:"raw,omitempty"`
+	Error   string          `json:"error,omitempty"`
 }
 
+// maxQueuedPrompts is how many prompts a connection may send while a query
+// is still running
+const maxQueuedPrompts = 8
+
+// disconnectGrace is how long a query may keep running after its client
+// disconnects, so the CLI can act on the interrupt before it is closed
+const disconnectGrace = 5 * time.Second
+
 // AgentHandler manages WebSocket connections and Claude Agent SDK integration
 type AgentHandler struct {
 	config *Config
@@ -39,11 +55,36 @@ func NewAgentHandler(config *Config) *AgentHandler {
 	}
 }
 
+// wsConn serializes writes to a WebSocket, which the response stream and
+// permission requests share
+type wsConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *wsConn) send(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return websocket.JSON.Send(c.Conn, v)
+}
+
+// session is one WebSocket connection and the Claude client serving it
+type session struct {
+	ws      *wsConn
+	timeout time.Duration // How long to wait for a permission reply
+	done    chan struct{} // Closed when the WebSocket client disconnects
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[string]chan ClientFrame // Permission requests awaiting a reply, by request ID
+}
+
 // HandleWebSocket handles WebSocket connections for Claude queries
-func (h *AgentHandler) HandleWebSocket(ws *websocket.Conn) {
+func (h *AgentHandler) HandleWebSocket(conn *websocket.Conn) {
 	defer func() {
-		_ = ws.Close()
+		_ = conn.Close()
 	}()
+	ws := &wsConn{Conn: conn}
 
 	// Check concurrent session limit
 	h.mu.Lock()
@@ -61,64 +102,214 @@ func (h *AgentHandler) HandleWebSocket(ws *websocket.Conn) {
 		h.mu.Unlock()
 	}()
 
-	log.Printf("WebSocket connection established from %s", ws.Request().RemoteAddr)
+	log.Printf("WebSocket connection established from %s", conn.Request().RemoteAddr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := &session{
+		ws:      ws,
+		timeout: h.config.PermissionTimeout,
+		done:    make(chan struct{}),
+		pending: make(map[string]chan ClientFrame),
+	}
+
+	client, err := h.newClient(ctx, s)
+	if err != nil {
+		log.Printf("Error starting Claude: %v", err)
+		h.sendError(ws, fmt.Sprintf("failed to start Claude: %v", err))
+		return
+	}
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	// Read frames in the background, so permission replies arrive while a
+	// query is streaming. Once the client is gone, pending permission
+	// requests interrupt the turn and the query gets a grace period to end.
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	defer cancelStream()
+	prompts := make(chan string, maxQueuedPrompts)
+	go func() {
+		h.readFrames(s, prompts)
+		close(s.done)
+		time.AfterFunc(disconnectGrace, cancelStream)
+		close(prompts)
+	}()
 
 	// Main message loop
+	for prompt := range prompts {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		log.Printf("Received query: %s", prompt)
+
+		// Process the query
+		if err := h.processQuery(streamCtx, client, ws, prompt); err != nil {
+			log.Printf("Error processing query: %v", err)
+			h.sendError(ws, fmt.Sprintf("query failed: %v", err))
+		}
+	}
+}
+
+// newClient connects a Claude client whose permission prompts are forwarded
+// to the session's WebSocket client
+func (h *AgentHandler) newClient(ctx context.Context, s *session) (*claude.Client, error) {
+	opts := types.NewClaudeAgentOptions().
+		WithModel(h.config.Model).
+		WithCanUseTool(s.canUseTool).
+		WithRawMessages(true)
+	if h.config.CLIPath != "" {
+		opts.WithCLIPath(h.config.CLIPath)
+	}
+
+	client, err := claude.NewClient(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// readFrames reads frames from the WebSocket client until it disconnects,
+// queueing prompts and delivering permission replies
+func (h *AgentHandler) readFrames(s *session, prompts chan<- string) {
 	for {
-		var req QueryRequest
-		if err := websocket.JSON.Receive(ws, &req); err != nil {
+		var frame ClientFrame
+		if err := websocket.JSON.Receive(s.ws.Conn, &frame); err != nil {
 			if err.Error() != "EOF" {
 				log.Printf("Error receiving message: %v", err)
 			}
 			return
 		}
 
-		if req.Prompt == "" {
-			h.sendError(ws, "prompt cannot be empty")
-			continue
+		switch frame.Type {
+		case "", "query":
+			if frame.Prompt == "" {
+				h.sendError(s.ws, "prompt cannot be empty")
+				continue
+			}
+			select {
+			case prompts <- frame.Prompt:
+			default:
+				h.sendError(s.ws, "too many queued prompts")
+			}
+
+		case "permission_response":
+			if !s.resolve(frame) {
+				h.sendError(s.ws, fmt.Sprintf("no pending permission request %q", frame.RequestID))
+			}
+
+		default:
+			h.sendError(s.ws, fmt.Sprintf("unknown frame type %q", frame.Type))
 		}
+	}
+}
 
-		log.Printf("Received query: %s", req.Prompt)
+// canUseTool forwards a permission prompt to the WebSocket client as a
+// permission_request frame and waits for its permission_response. Requests
+// that time out are denied; if the client disconnects, the request is denied
+// and the turn interrupted.
+func (s *session) canUseTool(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+	s.mu.Lock()
+	s.nextID++
+	requestID := fmt.Sprintf("perm_%d", s.nextID)
+	reply := make(chan ClientFrame, 1)
+	s.pending[requestID] = reply
+	s.mu.Unlock()
 
-		// Process the query
-		if err := h.processQuery(ws, req.Prompt); err != nil {
-			log.Printf("Error processing query: %v", err)
-			h.sendError(ws, fmt.Sprintf("query failed: %v", err))
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, requestID)
+		s.mu.Unlock()
+	}()
+
+	request := ResponseMessage{
+		Type: "permission_request",
+		Content: map[string]interface{}{
+			"request_id": requestID,
+			"tool_name":  toolName,
+			"input":      input,
+		},
+	}
+	if err := s.ws.send(request); err != nil {
+		return interruptDeny("client disconnected"), nil
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case frame := <-reply:
+		if frame.Behavior == "allow" {
+			return &types.PermissionResultAllow{Behavior: "allow"}, nil
+		}
+		message := frame.Message
+		if message == "" {
+			message = "denied by user"
 		}
+		return &types.PermissionResultDeny{Behavior: "deny", Message: message}, nil
+	case <-timer.C:
+		return &types.PermissionResultDeny{Behavior: "deny", Message: "permission request timed out"}, nil
+	case <-s.done:
+		return interruptDeny("client disconnected"), nil
+	case <-ctx.Done():
+		return interruptDeny("session closed"), nil
 	}
 }
 
-// processQuery executes a Claude query and streams responses back
-func (h *AgentHandler) processQuery(ws *websocket.Conn, prompt string) error {
-	ctx := context.Background()
+// resolve delivers a permission reply, reporting whether its request is pending
+func (s *session) resolve(frame ClientFrame) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Create SDK options
-	opts := types.NewClaudeAgentOptions().
-		WithModel(h.config.Model).
-		WithPermissionMode(types.PermissionModeBypassPermissions)
+	reply, ok := s.pending[frame.RequestID]
+	if !ok {
+		return false
+	}
+	delete(s.pending, frame.RequestID)
+	reply <- frame
+	return true
+}
 
-	// Execute query
-	messages, err := claude.Query(ctx, prompt, opts)
-	if err != nil {
-		return fmt.Errorf("failed to create query: %w", err)
+// interruptDeny denies a tool use and stops the turn, for when nobody is
+// left to answer
+func interruptDeny(message string) *types.PermissionResultDeny {
+	return &types.PermissionResultDeny{Behavior: "deny", Message: message, Interrupt: true}
+}
+
+// processQuery sends a prompt and streams the responses back
+func (h *AgentHandler) processQuery(ctx context.Context, client *claude.Client, ws *wsConn, prompt string) error {
+	if err := client.Query(ctx, prompt); err != nil {
+		return fmt.Errorf("failed to send query: %w", err)
 	}
 
-	// Stream responses back to client
-	for msg := range messages {
+	// Stream responses back to client. If it has gone away, keep draining
+	// until the turn ends so the CLI is not closed mid-turn.
+	var sendErr error
+	for msg := range client.ReceiveResponse(ctx) {
+		if sendErr != nil {
+			continue
+		}
 		if err := h.sendMessage(ws, msg); err != nil {
-			return fmt.Errorf("failed to send message: %w", err)
+			sendErr = fmt.Errorf("failed to send message: %w", err)
 		}
 	}
 
-	return nil
+	return sendErr
 }
 
 // sendMessage sends a Claude message to the WebSocket client
-func (h *AgentHandler) sendMessage(ws *websocket.Conn, msg types.Message) error {
+func (h *AgentHandler) sendMessage(ws *wsConn, msg types.Message) error {
 	msgType := msg.GetMessageType()
 
 	var resp ResponseMessage
 	resp.Type = msgType
+	resp.Raw = msg.GetRaw()
 
 	switch msgType {
 	case "assistant":
@@ -168,21 +359,19 @@ func (h *AgentHandler) sendMessage(ws *websocket.Conn, msg types.Message) error
 		}
 
 	default:
-		resp.Content = map[string]interface{}{
-			"raw": msg,
-		}
+		// Unknown types are forwarded as the raw frame only
 	}
 
-	return websocket.JSON.Send(ws, resp)
+	return ws.send(resp)
 }
 
 // sendError sends an error message to the WebSocket client
-func (h *AgentHandler) sendError(ws *websocket.Conn, errMsg string) {
+func (h *AgentHandler) sendError(ws *wsConn, errMsg string) {
 	resp := ResponseMessage{
 		Type:  "error",
 		Error: errMsg,
 	}
-	if err := websocket.JSON.Send(ws, resp); err != nil {
+	if err := ws.send(resp); err != nil {
 		log.Printf("Failed to send error message: %v", err)
 	}
 }
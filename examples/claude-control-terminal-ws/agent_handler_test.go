@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+	"golang.org/x/net/websocket"
+)
+
+// permissionCLI returns a mock Claude CLI that asks permission to run a Bash
+// command for the first prompt and finishes the turn once it is answered.
+func permissionCLI(t *testing.T) *claudetest.MockCLI {
+	t.Helper()
+	return claudetest.ScriptedCLI(t, claudetest.Scenario{Steps: []claudetest.Step{
+		claudetest.AwaitPrompt(),
+		claudetest.Send(`{"type":"control_request","request_id":"req_perm_1","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"}}}`),
+		claudetest.AwaitResponse("req_perm_1"),
+		claudetest.Send(
+			`{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"done"}]}}`,
+			`{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s"}`,
+		),
+	}})
+}
+
+// dialHandler serves a handler for the fake CLI over an in-process WebSocket
+// server and connects to it.
+func dialHandler(t *testing.T, permissionTimeout time.Duration) (*websocket.Conn, *claudetest.MockCLI) {
+	t.Helper()
+
+	cli := permissionCLI(t)
+	config := &Config{
+		MaxConcurrentSessions: 1,
+		PermissionTimeout:     permissionTimeout,
+		CLIPath:               cli.Path,
+	}
+	server := httptest.NewServer(websocket.Handler(NewAgentHandler(config).HandleWebSocket))
+	t.Cleanup(server.Close)
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = ws.Close()
+	})
+	return ws, cli
+}
+
+// receive reads the next frame, failing the test after a timeout.
+func receive(t *testing.T, ws *websocket.Conn) ResponseMessage {
+	t.Helper()
+
+	if err := ws.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var resp ResponseMessage
+	if err := websocket.JSON.Receive(ws, &resp); err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	return resp
+}
+
+// receivePermissionRequest sends a prompt and returns the ID of the
+// permission request it triggers.
+func receivePermissionRequest(t *testing.T, ws *websocket.Conn) string {
+	t.Helper()
+
+	if err := websocket.JSON.Send(ws, ClientFrame{Prompt: "list files"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	resp := receive(t, ws)
+	content, _ := resp.Content.(map[string]interface{})
+	if resp.Type != "permission_request" || content["tool_name"] != "Bash" {
+		t.Fatalf("got %+v, want a permission_request for Bash", resp)
+	}
+	if input, _ := content["input"].(map[string]interface{}); input["command"] != "ls" {
+		t.Errorf("input = %v", content["input"])
+	}
+	requestID, _ := content["request_id"].(string)
+	return requestID
+}
+
+// awaitResult reads frames up to the result of the turn.
+func awaitResult(t *testing.T, ws *websocket.Conn) {
+	t.Helper()
+
+	for {
+		resp := receive(t, ws)
+		switch resp.Type {
+		case "result":
+			return
+		case "error":
+			t.Fatalf("error frame: %s", resp.Error)
+		}
+	}
+}
+
+// readReply returns the permission response the mock CLI received.
+func readReply(t *testing.T, cli *claudetest.MockCLI) map[string]interface{} {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		for _, line := range cli.Received() {
+			if !strings.Contains(line, `"type":"control_response"`) || !strings.Contains(line, `"req_perm_1"`) {
+				continue
+			}
+			var frame struct {
+				Response struct {
+					Response map[string]interface{} `json:"response"`
+				} `json:"response"`
+			}
+			if err := json.Unmarshal([]byte(line), &frame); err != nil {
+				t.Fatalf("decode %s: %v", line, err)
+			}
+			return frame.Response.Response
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the CLI received no permission response")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleWebSocket_PermissionAllowed(t *testing.T) {
+	ws, cli := dialHandler(t, 10*time.Second)
+
+	requestID := receivePermissionRequest(t, ws)
+	if err := websocket.JSON.Send(ws, ClientFrame{Type: "permission_response", RequestID: requestID, Behavior: "allow"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	awaitResult(t, ws)
+	if reply := readReply(t, cli); reply["behavior"] != "allow" {
+		t.Errorf("reply = %v", reply)
+	}
+}
+
+func TestHandleWebSocket_PermissionDenied(t *testing.T) {
+	ws, cli := dialHandler(t, 10*time.Second)
+
+	requestID := receivePermissionRequest(t, ws)
+
+	// A reply to an unknown request is rejected without resolving the real one
+	if err := websocket.JSON.Send(ws, ClientFrame{Type: "permission_response", RequestID: "perm_99", Behavior: "allow"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if resp := receive(t, ws); resp.Type != "error" || !strings.Contains(resp.Error, "perm_99") {
+		t.Errorf("got %+v, want an error for the unknown request", resp)
+	}
+
+	if err := websocket.JSON.Send(ws, ClientFrame{Type: "permission_response", RequestID: requestID, Behavior: "deny", Message: "not here"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	awaitResult(t, ws)
+	reply := readReply(t, cli)
+	if reply["behavior"] != "deny" || reply["message"] != "not here" || reply["interrupt"] == true {
+		t.Errorf("reply = %v, want a deny without interrupt", reply)
+	}
+}
+
+func TestHandleWebSocket_PermissionTimeout(t *testing.T) {
+	ws, cli := dialHandler(t, 100*time.Millisecond)
+
+	receivePermissionRequest(t, ws)
+	awaitResult(t, ws)
+	if reply := readReply(t, cli); reply["message"] != "permission request timed out" {
+		t.Errorf("reply = %v", reply)
+	}
+}
+
+func TestHandleWebSocket_DisconnectDuringPermission(t *testing.T) {
+	ws, cli := dialHandler(t, 10*time.Second)
+
+	receivePermissionRequest(t, ws)
+	_ = ws.Close()
+
+	reply := readReply(t, cli)
+	if reply["behavior"] != "deny" || reply["interrupt"] != true {
+		t.Errorf("reply = %v, want a deny that interrupts", reply)
+	}
+}
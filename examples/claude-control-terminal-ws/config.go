@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 )
 
 // Config holds configuration for the WebSocket agent server
@@ -14,6 +15,8 @@ type Config struct {
 	Model                 string
 	APIKey                string
 	MaxConcurrentSessions int
+	PermissionTimeout     time.Duration // How long a tool waits for the client to allow or deny it
+	CLIPath               string        // Claude CLI to run; found automatically when empty
 	ServerDir             string
 	PIDFile               string
 	LogFile               string
@@ -35,6 +38,8 @@ func DefaultConfig() *Config {
 		Model:                 getEnvOrDefault("AGENT_WS_MODEL", "claude-3-5-sonnet-latest"),
 		APIKey:                getEnvOrDefault("CLAUDE_API_KEY", ""),
 		MaxConcurrentSessions: getEnvIntOrDefault("AGENT_WS_MAX_CONCURRENT_SESSIONS", 10),
+		PermissionTimeout:     time.Duration(getEnvIntOrDefault("AGENT_WS_PERMISSION_TIMEOUT", 60)) * time.Second,
+		CLIPath:               getEnvOrDefault("AGENT_WS_CLI_PATH", ""),
 		ServerDir:             serverDir,
 		PIDFile:               filepath.Join(serverDir, ".pid"),
 		LogFile:               filepath.Join(serverDir, "server.log"),
@@ -159,6 +159,8 @@ ENVIRONMENT VARIABLES:
     AGENT_WS_MODEL                    Claude model (default: claude-3-5-sonnet-latest)
     AGENT_WS_LOG_LEVEL                Log level (default: INFO)
     AGENT_WS_MAX_CONCURRENT_SESSIONS  Max concurrent sessions (default: 10)
+    AGENT_WS_PERMISSION_TIMEOUT       Seconds to wait for a permission reply (default: 60)
+    AGENT_WS_CLI_PATH                 Path to the Claude CLI (default: found on PATH)
 
 EXAMPLES:
     # Start server with defaults
@@ -193,5 +195,18 @@ WEBSOCKET PROTOCOL:
         "content": {"text": ["Response text"]},
         "error": ""
     }
+
+    Tool permission prompts arrive as:
+    {
+        "type": "permission_request",
+        "content": {"request_id": "perm_1", "tool_name": "Bash", "input": {...}}
+    }
+
+    Answer with:
+    {
+        "type": "permission_response",
+        "request_id": "perm_1",
+        "behavior": "allow"
+    }
 `)
 }
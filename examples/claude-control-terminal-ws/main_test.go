@@ -0,0 +1,11 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+)
+
+func TestMain(m *testing.M) {
+	mockcli.Main(m)
+}
@@ -76,11 +76,7 @@ func main() {
 					foundResponse = true
 				}
 				if assistantMsg, ok := msg.(*types.AssistantMessage); ok {
-					for _, block := range assistantMsg.Content {
-						if textBlock, ok := block.(*types.TextBlock); ok {
-							fmt.Print(textBlock.Text)
-						}
-					}
+					fmt.Print(assistantMsg.Text())
 				}
 			case "result":
 				fmt.Println()
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// logging is a custom middleware that reports how long each query takes to start.
+func logging(next claude.QueryFunc) claude.QueryFunc {
+	return func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		start := time.Now()
+		messages, err := next(ctx, prompt, opts)
+		log.Printf("query %q started in %v (err=%v)", prompt, time.Since(start), err)
+		return messages, err
+	}
+}
+
+// Middleware demonstrates composing Query middleware.
+// The second identical query is answered from the cache without starting the CLI.
+func main() {
+	ctx := context.Background()
+
+	opts := types.NewClaudeAgentOptions().
+		WithModel("claude-3-5-sonnet-latest")
+
+	// Middlewares run in the order given: logging sees every call,
+	// the cache sits in front of the rate limiter and retries.
+	query := claude.Chain(
+		logging,
+		claude.Cache(10*time.Minute),
+		claude.RateLimit(time.Second, 2),
+		claude.Retry(3, 500*time.Millisecond),
+	)(claude.Query)
+
+	for i := 0; i < 2; i++ {
+		messages, err := query(ctx, "What is 2 + 2?", opts)
+		if err != nil {
+			log.Fatalf("Query failed: %v", err)
+		}
+
+		for msg := range messages {
+			if assistantMsg, ok := msg.(*types.AssistantMessage); ok {
+				fmt.Printf("Claude: %s\n", assistantMsg.Text())
+			}
+		}
+	}
+}
@@ -34,11 +34,7 @@ func main() {
 		switch msgType {
 		case "assistant":
 			if assistantMsg, ok := msg.(*types.AssistantMessage); ok {
-				for _, block := range assistantMsg.Content {
-					if textBlock, ok := block.(*types.TextBlock); ok {
-						fmt.Printf("Claude: %s\n", textBlock.Text)
-					}
-				}
+				fmt.Printf("Claude: %s\n", assistantMsg.Text())
 			}
 		case "result":
 			fmt.Println("---")
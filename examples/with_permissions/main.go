@@ -59,7 +59,7 @@ func main() {
 
 // permissionHandler is called whenever Claude wants to use a tool.
 // It receives the tool name, input parameters, and permission context.
-func permissionHandler(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+func permissionHandler(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
 	fmt.Printf("\n[Permission Request] Tool: %s\n", toolName)
 
 	// Pretty print the input
@@ -0,0 +1,356 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ErrorCode identifies the kind of failure an Explanation describes. Codes
+// are stable, so they can key a message catalog or a support article.
+type ErrorCode string
+
+// Codes returned in Explanation.Code.
+const (
+	CodeAuthFailed         ErrorCode = "auth_failed"
+	CodeCLINotFound        ErrorCode = "cli_not_found"
+	CodeCLIConnection      ErrorCode = "cli_connection"
+	CodeCLIVersion         ErrorCode = "cli_version"
+	CodeCLIOutput          ErrorCode = "cli_output"
+	CodeProcessFailed      ErrorCode = "process_failed"
+	CodeTransportBroken    ErrorCode = "transport_broken"
+	CodeIdleTimeout        ErrorCode = "idle_timeout"
+	CodeBudgetExceeded     ErrorCode = "budget_exceeded"
+	CodeContextOverflow    ErrorCode = "context_overflow"
+	CodeRefused            ErrorCode = "refused"
+	CodeWorkingDirectory   ErrorCode = "working_directory"
+	CodeUnsafeDirectory    ErrorCode = "unsafe_directory"
+	CodeTooManyProcesses   ErrorCode = "too_many_processes"
+	CodeUnsupportedFeature ErrorCode = "unsupported_feature"
+	CodeSubagentFailed     ErrorCode = "subagent_failed"
+	CodeWarmupFailed       ErrorCode = "warmup_failed"
+	CodeBusy               ErrorCode = "busy"
+	CodeAlreadyAnswered    ErrorCode = "already_answered"
+	CodeInputClosed        ErrorCode = "input_closed"
+	CodeOutboundTooLarge   ErrorCode = "outbound_too_large"
+	CodeControlProtocol    ErrorCode = "control_protocol"
+	CodeTimeout            ErrorCode = "timeout"
+	CodeCanceled           ErrorCode = "canceled"
+	CodeUnknown            ErrorCode = "unknown"
+)
+
+// Explanation describes an error in words for the people using an
+// application rather than the developers writing it.
+type Explanation struct {
+	Code        ErrorCode
+	Title       string // Short summary, such as a dialog title
+	Detail      string // What happened, in a sentence or two
+	Remediation string // What to do about it
+}
+
+// MessageCatalog localizes explanations. It is called with the English
+// explanation of err and returns the one to show; the typed error err carries
+// the figures, such as the budget, that the English text quotes. Returning
+// the explanation unchanged keeps the English, which suits codes the catalog
+// has no translation for.
+type MessageCatalog func(english Explanation, err error) Explanation
+
+// ExplainError describes err for end users: a title, what happened and what
+// to do about it, in English. It recognizes the SDK's typed errors anywhere in
+// err's chain, preferring the one closest to the cause, as well as a CLI that
+// is not signed in and context cancellation. Other errors get CodeUnknown with
+// their message as the detail. A nil err gets the zero Explanation.
+func ExplainError(err error) Explanation {
+	return ExplainErrorWith(err, nil)
+}
+
+// ExplainErrorWith is ExplainError with the explanation passed through
+// catalog, if it is not nil, for translation.
+func ExplainErrorWith(err error, catalog MessageCatalog) Explanation {
+	if err == nil {
+		return Explanation{}
+	}
+	e := explain(err)
+	if catalog != nil {
+		e = catalog(e, err)
+	}
+	return e
+}
+
+// authMarkers are phrases the CLI prints, to stdout or stderr, when it has
+// no valid credentials.
+var authMarkers = []string{
+	"invalid api key",
+	"/login",
+	"not logged in",
+	"authentication",
+	"unauthorized",
+	"oauth token",
+}
+
+// contextMarkers are phrases the CLI prints when the conversation no longer
+// fits the model's context window.
+var contextMarkers = []string{
+	"prompt is too long",
+	"context window",
+	"context length",
+}
+
+func containsAny(s string, markers []string) bool {
+	s = strings.ToLower(s)
+	for _, marker := range markers {
+		if strings.Contains(s, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// explain maps err to its English explanation. Errors that wrap others, such
+// as WarmupError and SubagentError, are checked after the ones they may wrap.
+func explain(err error) Explanation {
+	var (
+		handshakeErr   *types.HandshakeError
+		processErr     *types.ProcessError
+		notFoundErr    *types.CLINotFoundError
+		versionErr     *types.UnsupportedCLIVersionError
+		featureErr     *types.UnsupportedFeatureError
+		budgetErr      *types.BudgetExceededError
+		promptErr      *types.PromptTooLargeError
+		outboundErr    *types.OutboundTooLargeError
+		deniedErr      *types.PermissionDeniedError
+		unsafeDirErr   *types.UnsafeWorkingDirectoryError
+		dirErr         *types.WorkingDirectoryError
+		processesErr   *types.TooManyProcessesError
+		idleErr        *types.IdleTimeoutError
+		brokenErr      *types.TransportBrokenError
+		limitErr       *types.MessageLimitError
+		decodeErr      *types.JSONDecodeError
+		parseErr       *types.MessageParseError
+		turnErr        *types.TurnInProgressError
+		notPendingErr  *types.PermissionNotPendingError
+		inputClosedErr *types.InputClosedError
+		protocolErr    *types.ControlProtocolError
+		connErr        *types.CLIConnectionError
+		subagentErr    *types.SubagentError
+		warmupErr      *types.WarmupError
+	)
+
+	switch {
+	case errors.As(err, &handshakeErr) && containsAny(handshakeErr.FirstLine, authMarkers),
+		errors.As(err, &processErr) && containsAny(processErr.Stderr, authMarkers):
+		return Explanation{
+			Code:        CodeAuthFailed,
+			Title:       "Claude could not sign in",
+			Detail:      "Claude Code is not signed in, or its API key was rejected.",
+			Remediation: "Run \"claude /login\" on this machine, or set ANTHROPIC_API_KEY to a valid key, then try again.",
+		}
+
+	case errors.As(err, &processErr) && containsAny(processErr.Stderr, contextMarkers):
+		return Explanation{
+			Code:        CodeContextOverflow,
+			Title:       "The conversation is too long",
+			Detail:      "The conversation no longer fits in what Claude can read at once.",
+			Remediation: "Start a new conversation, or shorten the message and any attached files, then try again.",
+		}
+
+	case errors.As(err, &notFoundErr):
+		return Explanation{
+			Code:        CodeCLINotFound,
+			Title:       "Claude Code is not installed",
+			Detail:      "The Claude Code program this application runs could not be found.",
+			Remediation: "Install it with \"npm install -g @anthropic-ai/claude-code\", or point the application at it with WithCLIPath.",
+		}
+
+	case errors.As(err, &versionErr):
+		return Explanation{
+			Code:        CodeCLIVersion,
+			Title:       "Claude Code needs updating",
+			Detail:      fmt.Sprintf("Claude Code %s is installed, but this application needs %s or newer.", versionErr.Version, versionErr.MinVersion),
+			Remediation: "Update it with \"npm install -g @anthropic-ai/claude-code@latest\", then try again.",
+		}
+
+	case errors.As(err, &featureErr):
+		return Explanation{
+			Code:        CodeUnsupportedFeature,
+			Title:       "Claude Code needs updating",
+			Detail:      fmt.Sprintf("The installed Claude Code does not support %s.", featureErr.Feature),
+			Remediation: "Update it with \"npm install -g @anthropic-ai/claude-code@latest\", or turn the feature off.",
+		}
+
+	case errors.As(err, &budgetErr):
+		return Explanation{
+			Code:        CodeBudgetExceeded,
+			Title:       "Spending limit reached",
+			Detail:      fmt.Sprintf("This session has cost $%.2f, over its limit of $%.2f, so it was stopped.", budgetErr.SpentUSD, budgetErr.LimitUSD),
+			Remediation: "Start a new session, or ask an administrator to raise the limit.",
+		}
+
+	case errors.As(err, &promptErr):
+		return Explanation{
+			Code:        CodeContextOverflow,
+			Title:       "The message is too long",
+			Detail:      fmt.Sprintf("The message is about %d tokens, more than the limit of %d.", promptErr.EstimatedTokens, promptErr.MaxTokens),
+			Remediation: "Shorten the message or attach fewer or smaller files, then try again.",
+		}
+
+	case errors.As(err, &outboundErr):
+		return Explanation{
+			Code:        CodeOutboundTooLarge,
+			Title:       "A reply to Claude is too large",
+			Detail:      fmt.Sprintf("A message of %d bytes for Claude Code is over the limit of %d bytes, so it was not sent.", outboundErr.Size, outboundErr.Max),
+			Remediation: "Return less from the tool that produced it, for example one page of results at a time or the path of a file holding them.",
+		}
+
+	case errors.As(err, &deniedErr):
+		detail := "Claude was not allowed to take an action it needed."
+		if deniedErr.ToolName != "" {
+			detail = fmt.Sprintf("Claude was not allowed to use %s.", deniedErr.ToolName)
+		}
+		return Explanation{
+			Code:        CodeRefused,
+			Title:       "Action not allowed",
+			Detail:      detail,
+			Remediation: "Allow the action when asked, or ask an administrator to change the permission settings.",
+		}
+
+	case errors.As(err, &unsafeDirErr):
+		return Explanation{
+			Code:        CodeUnsafeDirectory,
+			Title:       "Folder not allowed",
+			Detail:      fmt.Sprintf("The folder %s is outside the folders Claude may work in.", unsafeDirErr.Path),
+			Remediation: "Choose a folder inside " + strings.Join(unsafeDirErr.AllowedRoots, ", ") + ".",
+		}
+
+	case errors.As(err, &dirErr):
+		return Explanation{
+			Code:        CodeWorkingDirectory,
+			Title:       "Folder not found",
+			Detail:      fmt.Sprintf("The folder %s does not exist or cannot be opened.", dirErr.Path),
+			Remediation: "Check the folder's name and permissions, or choose another folder.",
+		}
+
+	case errors.As(err, &processesErr):
+		return Explanation{
+			Code:        CodeTooManyProcesses,
+			Title:       "Too busy",
+			Detail:      "Too many Claude sessions are running at once.",
+			Remediation: "Wait for another session to finish, then try again.",
+		}
+
+	case errors.As(err, &turnErr):
+		return Explanation{
+			Code:        CodeBusy,
+			Title:       "Claude is still working",
+			Detail:      "Claude has not finished answering the previous message.",
+			Remediation: "Wait for the answer, or stop it, before sending another message.",
+		}
+
+	case errors.As(err, &notPendingErr):
+		return Explanation{
+			Code:        CodeAlreadyAnswered,
+			Title:       "Already answered",
+			Detail:      "This permission request was already answered, or was withdrawn.",
+			Remediation: "No action is needed; Claude has gone on with the earlier answer.",
+		}
+
+	case errors.As(err, &idleErr):
+		return Explanation{
+			Code:        CodeIdleTimeout,
+			Title:       "Claude stopped responding",
+			Detail:      fmt.Sprintf("Claude sent nothing for %v, so the session was stopped.", idleErr.Timeout),
+			Remediation: "Try again. If it keeps happening, check the network connection.",
+		}
+
+	case errors.As(err, &brokenErr):
+		return Explanation{
+			Code:        CodeTransportBroken,
+			Title:       "Connection to Claude lost",
+			Detail:      "Claude Code stopped sending output in the middle of the session.",
+			Remediation: "Start a new session and try again.",
+		}
+
+	case errors.As(err, &handshakeErr), errors.As(err, &limitErr),
+		errors.As(err, &decodeErr), errors.As(err, &parseErr):
+		return Explanation{
+			Code:        CodeCLIOutput,
+			Title:       "Unexpected reply from Claude Code",
+			Detail:      "Claude Code sent output this application could not read.",
+			Remediation: "Update Claude Code and this application to their latest versions, then try again.",
+		}
+
+	case errors.As(err, &inputClosedErr):
+		return Explanation{
+			Code:        CodeInputClosed,
+			Title:       "Session closed for new messages",
+			Detail:      "This session no longer accepts messages.",
+			Remediation: "Start a new session to send another message.",
+		}
+
+	case errors.As(err, &protocolErr):
+		return Explanation{
+			Code:        CodeControlProtocol,
+			Title:       "Claude Code did not answer",
+			Detail:      "Claude Code did not answer a request from this application in time.",
+			Remediation: "Try again. If it keeps happening, update Claude Code.",
+		}
+
+	case errors.As(err, &processErr):
+		return Explanation{
+			Code:        CodeProcessFailed,
+			Title:       "Claude Code stopped unexpectedly",
+			Detail:      "The Claude Code program exited before it finished.",
+			Remediation: "Try again. If it keeps happening, run \"claude\" in a terminal to check that it works.",
+		}
+
+	case errors.As(err, &connErr):
+		return Explanation{
+			Code:        CodeCLIConnection,
+			Title:       "Could not start Claude Code",
+			Detail:      "This application could not start or talk to Claude Code.",
+			Remediation: "Try again. If it keeps happening, run \"claude\" in a terminal to check that it works.",
+		}
+
+	case errors.As(err, &subagentErr):
+		return Explanation{
+			Code:        CodeSubagentFailed,
+			Title:       "A helper task failed",
+			Detail:      fmt.Sprintf("The %q helper did not finish its task.", subagentErr.AgentName),
+			Remediation: "Try again, or rephrase the request.",
+		}
+
+	case errors.As(err, &warmupErr):
+		return Explanation{
+			Code:        CodeWarmupFailed,
+			Title:       "Could not prepare Claude",
+			Detail:      "Setting up a new Claude session failed.",
+			Remediation: "Try again in a moment.",
+		}
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return Explanation{
+			Code:        CodeTimeout,
+			Title:       "Took too long",
+			Detail:      "Claude did not finish in the time allowed.",
+			Remediation: "Try again, or ask for a smaller piece of work.",
+		}
+
+	case errors.Is(err, context.Canceled):
+		return Explanation{
+			Code:        CodeCanceled,
+			Title:       "Stopped",
+			Detail:      "The request was stopped before it finished.",
+			Remediation: "Send it again when you are ready.",
+		}
+	}
+
+	return Explanation{
+		Code:        CodeUnknown,
+		Title:       "Something went wrong",
+		Detail:      err.Error(),
+		Remediation: "Try again. If it keeps happening, contact support with this message.",
+	}
+}
@@ -0,0 +1,182 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// errorSamples holds a value of every exported error type in package types
+// and this package, keyed by type name, with the code ExplainError gives it.
+// A new error type fails TestExplainError_CoversEveryErrorType until it is
+// added here and explained.
+var errorSamples = map[string]struct {
+	err  error
+	code ErrorCode
+}{
+	"CLINotFoundError":            {types.NewCLINotFoundError("claude not found"), CodeCLINotFound},
+	"CLIConnectionError":          {types.NewCLIConnectionError("failed to start"), CodeCLIConnection},
+	"ProcessError":                {types.NewProcessErrorWithCode("CLI exited", 1), CodeProcessFailed},
+	"JSONDecodeError":             {types.NewJSONDecodeErrorWithRaw("bad json", "{"), CodeCLIOutput},
+	"MessageParseError":           {types.NewMessageParseErrorWithType("bad message", "assistant"), CodeCLIOutput},
+	"MessageLimitError":           {types.NewMessageLimitError(types.MessageLimitSize, 10, "0123456789abc"), CodeCLIOutput},
+	"ControlProtocolError":        {types.NewControlProtocolError("initialize timed out"), CodeControlProtocol},
+	"PermissionDeniedError":       {types.NewPermissionDeniedErrorWithTool("denied", "Bash"), CodeRefused},
+	"WorkingDirectoryError":       {types.NewWorkingDirectoryError("missing", "/no/such/dir"), CodeWorkingDirectory},
+	"InputClosedError":            {types.NewInputClosedError("input closed"), CodeInputClosed},
+	"TurnInProgressError":         {types.NewTurnInProgressError("turn in progress"), CodeBusy},
+	"PermissionNotPendingError":   {types.NewPermissionNotPendingError("perm_1"), CodeAlreadyAnswered},
+	"SubagentError":               {types.NewSubagentError("not invoked", "reviewer"), CodeSubagentFailed},
+	"BudgetExceededError":         {types.NewBudgetExceededError(1, 1.25), CodeBudgetExceeded},
+	"TransportBrokenError":        {types.NewTransportBrokenError("stdout closed"), CodeTransportBroken},
+	"UnsupportedCLIVersionError":  {types.NewUnsupportedCLIVersionError("1.0.0", "2.0.0"), CodeCLIVersion},
+	"PromptTooLargeError":         {types.NewPromptTooLargeError(300000, 200000), CodeContextOverflow},
+	"UnsupportedFeatureError":     {types.NewUnsupportedFeatureError("Interrupt", types.CapabilityInterrupt), CodeUnsupportedFeature},
+	"IdleTimeoutError":            {types.NewIdleTimeoutError(time.Minute), CodeIdleTimeout},
+	"TooManyProcessesError":       {types.NewTooManyProcessesError(4), CodeTooManyProcesses},
+	"WarmupError":                 {types.NewWarmupError(errors.New("warmup prompt failed")), CodeWarmupFailed},
+	"UnsafeWorkingDirectoryError": {types.NewUnsafeWorkingDirectoryError("unsafe", "/etc", []string{"/work"}), CodeUnsafeDirectory},
+	"HandshakeError":              {types.NewHandshakeError("Welcome to Claude Code"), CodeCLIOutput},
+	"OutboundTooLargeError":       {types.NewOutboundTooLargeError(strings.Repeat("x", 11), 10), CodeOutboundTooLarge},
+}
+
+// exportedErrorTypes returns the exported types in package types, and in this
+// package, that have an Error method.
+func exportedErrorTypes(t *testing.T) []string {
+	t.Helper()
+	fset := token.NewFileSet()
+	var names []string
+	for _, dir := range []string{".", "types"} {
+		pkgs, err := parser.ParseDir(fset, dir, func(fi fs.FileInfo) bool {
+			return !strings.HasSuffix(fi.Name(), "_test.go")
+		}, 0)
+		if err != nil {
+			t.Fatalf("parse package in %s: %v", dir, err)
+		}
+		names = append(names, errorTypeNames(pkgs)...)
+	}
+	if len(names) == 0 {
+		t.Fatal("found no error types in package types")
+	}
+	return names
+}
+
+func errorTypeNames(pkgs map[string]*ast.Package) []string {
+	var names []string
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Recv == nil || fn.Name.Name != "Error" {
+					continue
+				}
+				recv := fn.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				if ident, ok := recv.(*ast.Ident); ok && ident.IsExported() {
+					names = append(names, ident.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+func TestExplainError_CoversEveryErrorType(t *testing.T) {
+	for _, name := range exportedErrorTypes(t) {
+		sample, ok := errorSamples[name]
+		if !ok {
+			t.Errorf("%s has no entry in errorSamples; add one and explain it in ExplainError", name)
+			continue
+		}
+		e := ExplainError(sample.err)
+		if e.Code == CodeUnknown {
+			t.Errorf("ExplainError(%s) is not mapped", name)
+		}
+		if e.Title == "" || e.Detail == "" || e.Remediation == "" {
+			t.Errorf("ExplainError(%s) = %+v, want a title, detail and remediation", name, e)
+		}
+	}
+}
+
+func TestExplainError(t *testing.T) {
+	for name, sample := range errorSamples {
+		if got := ExplainError(sample.err).Code; got != sample.code {
+			t.Errorf("ExplainError(%s).Code = %q, want %q", name, got, sample.code)
+		}
+	}
+
+	authStderr := types.NewProcessErrorWithCode("CLI exited", 1)
+	authStderr.Stderr = "Error: Invalid API key · Please run /login"
+	overflow := types.NewProcessErrorWithCode("CLI exited", 1)
+	overflow.Stderr = "API Error: 400 prompt is too long: 210000 tokens > 200000 maximum"
+
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   ErrorCode
+		wantDetail string // substring, if set
+	}{
+		{"auth in first line", types.NewHandshakeError("Invalid API key · Please run /login"), CodeAuthFailed, ""},
+		{"auth in stderr", authStderr, CodeAuthFailed, ""},
+		{"context overflow in stderr", overflow, CodeContextOverflow, ""},
+		{"wrapped", fmt.Errorf("run agent: %w", types.NewBudgetExceededError(1, 1.25)), CodeBudgetExceeded, "$1.25"},
+		{"cause preferred to wrapper", types.NewWarmupError(types.NewCLINotFoundError("claude not found")), CodeCLINotFound, ""},
+		{"tool named", types.NewPermissionDeniedErrorWithTool("denied", "Bash"), CodeRefused, "Bash"},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), CodeTimeout, ""},
+		{"canceled", context.Canceled, CodeCanceled, ""},
+		{"unknown", errors.New("disk full"), CodeUnknown, "disk full"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := ExplainError(tt.err)
+			if e.Code != tt.wantCode {
+				t.Errorf("Code = %q, want %q", e.Code, tt.wantCode)
+			}
+			if !strings.Contains(e.Detail, tt.wantDetail) {
+				t.Errorf("Detail = %q, want it to contain %q", e.Detail, tt.wantDetail)
+			}
+		})
+	}
+
+	if e := ExplainError(nil); e != (Explanation{}) {
+		t.Errorf("ExplainError(nil) = %+v, want the zero Explanation", e)
+	}
+}
+
+func TestExplainErrorWith(t *testing.T) {
+	catalog := func(english Explanation, err error) Explanation {
+		var budgetErr *types.BudgetExceededError
+		if english.Code == CodeBudgetExceeded && errors.As(err, &budgetErr) {
+			english.Title = "Limite de dépenses atteinte"
+			english.Detail = fmt.Sprintf("Cette session a coûté %.2f $.", budgetErr.SpentUSD)
+		}
+		return english
+	}
+
+	e := ExplainErrorWith(types.NewBudgetExceededError(1, 1.25), catalog)
+	if e.Title != "Limite de dépenses atteinte" || e.Detail != "Cette session a coûté 1.25 $." {
+		t.Errorf("translated explanation = %+v", e)
+	}
+	if e.Code != CodeBudgetExceeded {
+		t.Errorf("Code = %q, want %q", e.Code, CodeBudgetExceeded)
+	}
+
+	e = ExplainErrorWith(types.NewCLINotFoundError("claude not found"), catalog)
+	if e != ExplainError(types.NewCLINotFoundError("claude not found")) {
+		t.Errorf("untranslated explanation = %+v, want the English one", e)
+	}
+	if e := ExplainErrorWith(nil, catalog); e != (Explanation{}) {
+		t.Errorf("ExplainErrorWith(nil) = %+v, want the zero Explanation", e)
+	}
+}
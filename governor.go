@@ -0,0 +1,246 @@
+package claude
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// GovernorEventType identifies what a GovernorEvent reports.
+type GovernorEventType string
+
+const (
+	// GovernorThreshold reports spend reaching a fraction of the budget set
+	// with Notify.
+	GovernorThreshold GovernorEventType = "threshold"
+
+	// GovernorExhausted reports spend going over the budget.
+	GovernorExhausted GovernorEventType = "exhausted"
+)
+
+// GovernorEvent is passed to the function set with Governor.Notify.
+type GovernorEvent struct {
+	Type      GovernorEventType
+	Threshold float64 // Fraction of the budget reached, for GovernorThreshold
+	BudgetUSD float64
+	SpentUSD  float64
+}
+
+// Governor enforces one cost budget across many clients, where
+// WithMaxCostUSD caps each session on its own. It is safe for concurrent use.
+//
+// The cost of every ResultMessage an attached client receives is charged to
+// the budget. Once spend goes over it, the governor interrupts the turns of
+// all attached clients, and their Query calls fail with a
+// BudgetExceededError until Refill. A turn already running when the budget
+// runs out still reports its cost, so spend can exceed the budget by at most
+// one turn per client.
+//
+// Example:
+//
+//	governor := claude.NewGovernor(50)
+//	governor.Notify(func(e claude.GovernorEvent) {
+//	    log.Printf("claude spend %s: $%.2f of $%.2f", e.Type, e.SpentUSD, e.BudgetUSD)
+//	}, 0.5, 0.9)
+//
+//	for _, client := range clients {
+//	    governor.Attach(client)
+//	}
+type Governor struct {
+	mu         sync.Mutex
+	budget     float64
+	spent      float64
+	exhausted  bool
+	sessions   map[*Client]*costMeter // What each attached client has been charged
+	thresholds []float64              // ascending fractions of the budget
+	notified   int                    // thresholds already reported since the last Refill
+	notify     func(GovernorEvent)
+}
+
+// NewGovernor returns a governor with a budget of budgetUSD dollars.
+func NewGovernor(budgetUSD float64) *Governor {
+	return &Governor{
+		budget:   budgetUSD,
+		sessions: make(map[*Client]*costMeter),
+	}
+}
+
+// Attach charges the costs c reports from now on to the budget. A client can
+// be attached to one governor at a time; attaching it to another detaches it
+// from the first. Close detaches the client.
+//
+// The CLI reports each session's cost as a running total, so a result is
+// charged what it adds to the session's previous total, as in Stats. A
+// client attached mid-session is charged only for what its session spends
+// after Attach.
+func (g *Governor) Attach(c *Client) {
+	c.mu.Lock()
+	previous := c.governor
+	c.governor = g
+	c.mu.Unlock()
+
+	if previous != nil && previous != g {
+		previous.remove(c)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.sessions[c]; !ok {
+		g.sessions[c] = c.usage.costs.clone()
+	}
+}
+
+// Detach stops charging c's costs to the budget. Spend already charged is
+// kept.
+func (g *Governor) Detach(c *Client) {
+	c.mu.Lock()
+	if c.governor == g {
+		c.governor = nil
+	}
+	c.mu.Unlock()
+
+	g.remove(c)
+}
+
+// remove forgets c without touching the client, for callers holding c.mu.
+func (g *Governor) remove(c *Client) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.sessions, c)
+}
+
+// Notify sets fn to be called when spend reaches each of thresholds, given
+// as fractions of the budget such as 0.5 and 0.9, and when spend goes over
+// the budget. Each is reported once until Refill. fn is called from the
+// goroutine delivering the client's result and must not block. A nil fn
+// stops notifications.
+func (g *Governor) Notify(fn func(GovernorEvent), thresholds ...float64) {
+	sorted := append([]float64(nil), thresholds...)
+	sort.Float64s(sorted)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.notify = fn
+	g.thresholds = sorted
+	g.notified = 0
+	for g.notified < len(g.thresholds) && g.spent >= g.thresholds[g.notified]*g.budget {
+		g.notified++
+	}
+}
+
+// Refill starts over with a budget of budgetUSD dollars and nothing spent,
+// so that attached clients can send prompts again.
+func (g *Governor) Refill(budgetUSD float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.budget = budgetUSD
+	g.spent = 0
+	g.exhausted = false
+	g.notified = 0
+}
+
+// SpentUSD returns the cost charged to the budget since the last Refill.
+func (g *Governor) SpentUSD() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.spent
+}
+
+// RemainingUSD returns what is left of the budget, or zero once it has run
+// out.
+func (g *Governor) RemainingUSD() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.spent >= g.budget {
+		return 0
+	}
+	return g.budget - g.spent
+}
+
+// err returns a BudgetExceededError once the budget has run out, or nil.
+func (g *Governor) err() error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.exhausted {
+		return nil
+	}
+	return types.NewBudgetExceededError(g.budget, g.spent)
+}
+
+// charge records the cost of a result c received. If it runs the budget
+// out, the turns of all attached clients are interrupted.
+func (g *Governor) charge(c *Client, msg types.Message) {
+	result, ok := msg.(*types.ResultMessage)
+	if g == nil || !ok || result.TotalCostUSD == nil {
+		return
+	}
+
+	g.mu.Lock()
+	costs, attached := g.sessions[c]
+	if !attached {
+		g.mu.Unlock()
+		return
+	}
+	cost := costs.add(result)
+	if cost <= 0 {
+		g.mu.Unlock()
+		return
+	}
+	g.spent += cost
+
+	var events []GovernorEvent
+	for g.notified < len(g.thresholds) && g.spent >= g.thresholds[g.notified]*g.budget {
+		events = append(events, g.event(GovernorThreshold, g.thresholds[g.notified]))
+		g.notified++
+	}
+	var interrupt []*Client
+	if !g.exhausted && g.spent > g.budget {
+		g.exhausted = true
+		events = append(events, g.event(GovernorExhausted, 0))
+		for client := range g.sessions {
+			interrupt = append(interrupt, client)
+		}
+	}
+	notify := g.notify
+	g.mu.Unlock()
+
+	for _, client := range interrupt {
+		client.interruptInBackground()
+	}
+	if notify != nil {
+		for _, event := range events {
+			notify(event)
+		}
+	}
+}
+
+// event builds a GovernorEvent. The caller holds g.mu.
+func (g *Governor) event(eventType GovernorEventType, threshold float64) GovernorEvent {
+	return GovernorEvent{Type: eventType, Threshold: threshold, BudgetUSD: g.budget, SpentUSD: g.spent}
+}
+
+// interruptInBackground asks the CLI to stop the current turn without
+// waiting for it to answer. It does nothing if c is not connected.
+func (c *Client) interruptInBackground() {
+	go func() {
+		c.mu.Lock()
+		query := c.query
+		clientCtx := c.ctx
+		c.mu.Unlock()
+		if query == nil {
+			return
+		}
+
+		interruptCtx, cancel := context.WithTimeout(clientCtx, 5*time.Second)
+		defer cancel()
+		_ = query.Interrupt(interruptCtx)
+	}()
+}
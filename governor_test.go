@@ -0,0 +1,236 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func sessionResult(sessionID string, cost float64) *types.ResultMessage {
+	return &types.ResultMessage{Type: "result", Subtype: "success", SessionID: sessionID, TotalCostUSD: &cost}
+}
+
+// governedClient returns an unconnected client attached to g.
+func governedClient(t *testing.T, g *Governor) *Client {
+	t.Helper()
+	cli := mockcli.New(t, mockcli.Scenario{})
+	client, err := NewClient(context.Background(), types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	g.Attach(client)
+	return client
+}
+
+func TestGovernor_Charge(t *testing.T) {
+	g := NewGovernor(1.0)
+	var events []GovernorEvent
+	g.Notify(func(e GovernorEvent) { events = append(events, e) }, 0.9, 0.5)
+
+	a, b := governedClient(t, g), governedClient(t, g)
+
+	// Running totals are charged by what each result adds
+	g.charge(a, sessionResult("sa", 0.3))
+	g.charge(a, sessionResult("sa", 0.4))
+	g.charge(b, sessionResult("sb", 0.2))
+	if spent := g.SpentUSD(); spent < 0.599 || spent > 0.601 {
+		t.Fatalf("SpentUSD() = %v, want 0.6", spent)
+	}
+	if len(events) != 1 || events[0].Type != GovernorThreshold || events[0].Threshold != 0.5 {
+		t.Fatalf("events = %+v, want the 0.5 threshold", events)
+	}
+
+	// A new session starts its running total over
+	g.charge(a, sessionResult("sa2", 0.35))
+	if g.err() != nil {
+		t.Fatal("budget exhausted at 0.95")
+	}
+	if len(events) != 2 || events[1].Threshold != 0.9 {
+		t.Fatalf("events = %+v, want the 0.9 threshold next", events)
+	}
+
+	g.charge(b, sessionResult("sb", 0.3))
+	if !types.IsBudgetExceededError(g.err()) {
+		t.Fatalf("err() = %v, want BudgetExceededError", g.err())
+	}
+	if len(events) != 3 || events[2].Type != GovernorExhausted {
+		t.Fatalf("events = %+v, want exhausted last", events)
+	}
+	if remaining := g.RemainingUSD(); remaining != 0 {
+		t.Errorf("RemainingUSD() = %v, want 0", remaining)
+	}
+
+	// A detached client is no longer charged
+	g.Detach(b)
+	g.charge(b, sessionResult("sb", 0.9))
+	if spent := g.SpentUSD(); spent > 1.051 {
+		t.Errorf("SpentUSD() = %v after charging a detached client", spent)
+	}
+
+	g.Refill(2.0)
+	if g.err() != nil || g.SpentUSD() != 0 {
+		t.Errorf("after Refill: err() = %v, SpentUSD() = %v, want nil and 0", g.err(), g.SpentUSD())
+	}
+	g.charge(a, sessionResult("sa2", 1.35))
+	if len(events) != 4 || events[3].Threshold != 0.5 {
+		t.Errorf("events = %+v, want the 0.5 threshold again after Refill", events)
+	}
+}
+
+func TestGovernor_QueryFailsWhenExhausted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"result","subtype":"success","session_id":"s1","total_cost_usd":0.5}`),
+		mockcli.AwaitRequest("interrupt"),
+	}})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	g := NewGovernor(0.25)
+	g.Attach(client)
+	if _, err := client.RunTurn(ctx, "hi"); err != nil {
+		t.Fatalf("RunTurn failed: %v", err)
+	}
+
+	if err := client.Query(ctx, "again"); !types.IsBudgetExceededError(err) {
+		t.Fatalf("Query() = %v, want BudgetExceededError", err)
+	}
+	waitFor(t, "the interrupt", func() bool {
+		for _, line := range cli.Received() {
+			if strings.Contains(line, `"subtype":"interrupt"`) {
+				return true
+			}
+		}
+		return false
+	})
+
+	g.Refill(1.0)
+	if err := client.Query(ctx, "again"); types.IsBudgetExceededError(err) {
+		t.Errorf("Query() after Refill = %v", err)
+	}
+}
+
+func TestGovernor_AttachMidSession(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"result","subtype":"success","session_id":"s1","total_cost_usd":0.4}`),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"result","subtype":"success","session_id":"s1","total_cost_usd":0.5}`),
+	}})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if _, err := client.RunTurn(ctx, "first"); err != nil {
+		t.Fatalf("RunTurn failed: %v", err)
+	}
+
+	// Only what the session spends after Attach is charged
+	g := NewGovernor(1.0)
+	g.Attach(client)
+	if _, err := client.RunTurn(ctx, "second"); err != nil {
+		t.Fatalf("RunTurn failed: %v", err)
+	}
+	if spent := g.SpentUSD(); spent < 0.099 || spent > 0.101 {
+		t.Errorf("SpentUSD() = %v, want the second turn's 0.1", spent)
+	}
+}
+
+func TestGovernor_ChargesLikeStats(t *testing.T) {
+	g := NewGovernor(10)
+	client := governedClient(t, g)
+
+	// A total below the previous one, as after a CLI restart, counts afresh
+	results := []*types.ResultMessage{sessionResult("s1", 0.3), sessionResult("s1", 0.1), sessionResult("s1", 0.25)}
+	for _, result := range results {
+		client.usage.observe(result)
+		g.charge(client, result)
+	}
+	if spent, stats := g.SpentUSD(), client.Stats().TotalCostUSD; spent < 0.549 || spent > 0.551 || spent != stats {
+		t.Errorf("SpentUSD() = %v, Stats().TotalCostUSD = %v, want both 0.55", spent, stats)
+	}
+}
+
+// TestGovernor_ConcurrentClients tests that clients charging costs at the
+// same time never overspend by more than one turn each.
+func TestGovernor_ConcurrentClients(t *testing.T) {
+	const (
+		clients  = 16
+		turns    = 10
+		turnCost = 0.1
+		budget   = 0.85 // less than one client's turns, so every client is stopped
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	g := NewGovernor(budget)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		var steps []mockcli.Step
+		for turn := 1; turn <= turns; turn++ {
+			steps = append(steps, mockcli.AwaitPrompt(), mockcli.Send(fmt.Sprintf(
+				`{"type":"result","subtype":"success","session_id":"s%d","total_cost_usd":%.1f}`, i, float64(turn)*turnCost)))
+		}
+		cli := mockcli.New(t, mockcli.Scenario{Steps: steps})
+
+		client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+		defer client.Close(ctx)
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+		g.Attach(client)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			for turn := 0; turn < turns; turn++ {
+				if _, err := client.RunTurn(ctx, "work"); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if !types.IsBudgetExceededError(err) {
+			t.Errorf("client stopped with %v, want BudgetExceededError", err)
+		}
+	}
+	spent := g.SpentUSD()
+	if spent <= budget || spent > budget+clients*turnCost+1e-9 {
+		t.Errorf("SpentUSD() = %v, want over %v by at most one turn per client", spent, budget)
+	}
+}
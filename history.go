@@ -0,0 +1,78 @@
+package claude
+
+import (
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// AllSegments passed to Client.History returns the messages of every
+// segment.
+const AllSegments = -1
+
+// messageHistory counts the compact boundaries of a client's conversation
+// and keeps its most recent messages, up to limit, with their segments. It
+// has its own lock so that reading it never waits for Connect or Close.
+type messageHistory struct {
+	mu      sync.Mutex
+	limit   int // messages kept; 0 keeps none
+	segment int
+	entries []types.HistoryEntry
+}
+
+// observe records a message sent or received. A compact boundary starts the
+// next segment; stream events are not kept.
+func (h *messageHistory) observe(msg types.Message) {
+	if _, ok := msg.(*types.StreamEvent); ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if types.IsCompactBoundary(msg) {
+		h.segment++
+	}
+	if h.limit <= 0 {
+		return
+	}
+	if len(h.entries) == h.limit {
+		h.entries[0] = types.HistoryEntry{}
+		h.entries = h.entries[1:]
+	}
+	h.entries = append(h.entries, types.HistoryEntry{Segment: h.segment, Message: msg})
+}
+
+// Segment returns the segment of the conversation the client is in: 0 until
+// the CLI compacts the conversation, and one more for each compact_boundary
+// SystemMessage received since. A message from ReceiveResponse belongs to
+// the segment Segment returns once the message is received, so calling it
+// then labels the message. It is safe to call concurrently with
+// ReceiveResponse.
+func (c *Client) Segment() int {
+	c.history.mu.Lock()
+	defer c.history.mu.Unlock()
+	return c.history.segment
+}
+
+// History returns the kept messages of a segment, oldest first, or those of
+// every segment for AllSegments. Messages are kept only with
+// WithMessageHistory: the prompts sent and the messages received, through
+// ReceiveResponse or while draining on Close, except stream events. After a
+// compaction the latest segment is the context the model works from; earlier
+// segments are what the compaction summarized. A prompt is kept when it is
+// sent, so the one the CLI was answering when it compacted, such as
+// "/compact", is in the segment before the boundary. The oldest messages may
+// have been dropped to stay within the limit. It is safe to call
+// concurrently with ReceiveResponse.
+func (c *Client) History(segment int) []types.HistoryEntry {
+	c.history.mu.Lock()
+	defer c.history.mu.Unlock()
+
+	var entries []types.HistoryEntry
+	for _, entry := range c.history.entries {
+		if segment == AllSegments || entry.Segment == segment {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
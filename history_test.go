@@ -0,0 +1,145 @@
+package claude
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// compactBoundary is the system message the CLI sends when it compacts the
+// conversation.
+const compactBoundary = `{"type":"system","subtype":"compact_boundary","session_id":"s","compact_metadata":{"trigger":"manual","pre_tokens":120000}}`
+
+// runCompactedSession runs three turns against a CLI that compacts the
+// conversation after the first, returning the client and, for each message
+// received, the segment Segment reported on receiving it.
+func runCompactedSession(t *testing.T, opts *types.ClaudeAgentOptions) (*Client, []int) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(streamAssistant, streamResult),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(compactBoundary, streamResult),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(streamAssistant, streamResult),
+	}})
+	client, err := NewClient(ctx, opts.WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	var segments []int
+	for _, prompt := range []string{"first", "/compact", "after"} {
+		if err := client.Query(ctx, prompt); err != nil {
+			t.Fatalf("Query(%q) failed: %v", prompt, err)
+		}
+		for range client.ReceiveResponse(ctx) {
+			segments = append(segments, client.Segment())
+		}
+	}
+	return client, segments
+}
+
+// describeHistory returns a short label for each history entry.
+func describeHistory(entries []types.HistoryEntry) []string {
+	var labels []string
+	for _, entry := range entries {
+		label := entry.Message.GetMessageType()
+		switch msg := entry.Message.(type) {
+		case *types.UserMessage:
+			label += ":" + msg.Content.(string)
+		case *types.SystemMessage:
+			label += ":" + msg.Subtype
+		}
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+func TestClient_History(t *testing.T) {
+	client, segments := runCompactedSession(t, types.NewClaudeAgentOptions().WithMessageHistory(100))
+
+	wantSegments := []int{0, 0, 1, 1, 1, 1}
+	if len(segments) != len(wantSegments) {
+		t.Fatalf("segments on receipt = %v, want %v", segments, wantSegments)
+	}
+	for i := range wantSegments {
+		if segments[i] != wantSegments[i] {
+			t.Errorf("segments on receipt = %v, want %v", segments, wantSegments)
+			break
+		}
+	}
+	if got := client.Segment(); got != 1 {
+		t.Errorf("Segment() = %d, want 1", got)
+	}
+
+	tests := []struct {
+		segment int
+		want    []string
+	}{
+		{0, []string{"user:first", "assistant", "result", "user:/compact"}},
+		{1, []string{"system:compact_boundary", "result", "user:after", "assistant", "result"}},
+		{2, nil},
+		{AllSegments, []string{"user:first", "assistant", "result", "user:/compact", "system:compact_boundary", "result", "user:after", "assistant", "result"}},
+	}
+	for _, tt := range tests {
+		entries := client.History(tt.segment)
+		got := describeHistory(entries)
+		if len(got) != len(tt.want) {
+			t.Errorf("History(%d) = %v, want %v", tt.segment, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("History(%d) = %v, want %v", tt.segment, got, tt.want)
+				break
+			}
+		}
+		for _, entry := range entries {
+			if tt.segment != AllSegments && entry.Segment != tt.segment {
+				t.Errorf("History(%d) has an entry of segment %d", tt.segment, entry.Segment)
+			}
+		}
+	}
+}
+
+func TestClient_HistoryLimit(t *testing.T) {
+	client, _ := runCompactedSession(t, types.NewClaudeAgentOptions().WithMessageHistory(4))
+
+	got := describeHistory(client.History(AllSegments))
+	want := []string{"result", "user:after", "assistant", "result"}
+	if len(got) != len(want) {
+		t.Fatalf("History(AllSegments) = %v, want the last %d messages %v", got, len(want), want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("History(AllSegments) = %v, want %v", got, want)
+		}
+	}
+	if entries := client.History(0); len(entries) != 0 {
+		t.Errorf("History(0) = %v, want its messages dropped", describeHistory(entries))
+	}
+}
+
+func TestClient_SegmentWithoutHistory(t *testing.T) {
+	client, _ := runCompactedSession(t, types.NewClaudeAgentOptions())
+
+	if got := client.Segment(); got != 1 {
+		t.Errorf("Segment() = %d, want 1", got)
+	}
+	if entries := client.History(AllSegments); len(entries) != 0 {
+		t.Errorf("History(AllSegments) = %v, want none kept", describeHistory(entries))
+	}
+}
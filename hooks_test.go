@@ -0,0 +1,127 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// preToolUseCLI returns a mock CLI that runs the PreToolUse hook for a Bash
+// call and then asks for permission to run it, as the CLI does when the hook
+// returns no decision it can act on alone.
+func preToolUseCLI(t *testing.T) *mockcli.CLI {
+	t.Helper()
+	return mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(interceptedToolUse, interceptedHookCall),
+		mockcli.AwaitResponse("req_hook_1"),
+		mockcli.Send(`{"type":"control_request","request_id":"req_perm_1","request":{"subtype":"can_use_tool","tool_name":"Bash","tool_use_id":"toolu_1","input":{"command":"ls /srv"}}}`),
+		mockcli.AwaitResponse("req_perm_1"),
+		mockcli.Send(streamResult),
+	}})
+}
+
+// runPreToolUseHook runs a turn with hook as the PreToolUse hook for Bash
+// and a permission callback allowing everything, returning the mock CLI.
+func runPreToolUseHook(t *testing.T, hook types.HookCallbackFunc) *mockcli.CLI {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := preToolUseCLI(t)
+	bash := "Bash"
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithStrictProtocol(true).
+		WithHook(types.HookEventPreToolUse, types.HookMatcher{Matcher: &bash, Hooks: []types.HookCallbackFunc{hook}}).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return &types.PermissionResultAllow{}, nil
+		})
+
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "list /srv"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range client.ReceiveResponse(ctx) {
+	}
+	return cli
+}
+
+// permissionAnswer decodes the SDK's answer to req_perm_1.
+func permissionAnswer(t *testing.T, cli *mockcli.CLI) map[string]interface{} {
+	t.Helper()
+	data := receivedResponse(t, cli, "req_perm_1")
+	var frame struct {
+		Response struct {
+			Response map[string]interface{} `json:"response"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		t.Fatalf("decode permission response %s: %v", data, err)
+	}
+	return frame.Response.Response
+}
+
+func TestClient_PreToolUseHookUpdatedInput(t *testing.T) {
+	cli := runPreToolUseHook(t, func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		allow := "allow"
+		updated := map[string]interface{}{
+			"command": "ls -la /srv",
+			"env":     map[string]interface{}{"LC_ALL": "C"},
+		}
+		return &types.SyncHookJSONOutput{
+			HookSpecificOutput: &types.PreToolUseHookSpecificOutput{
+				PermissionDecision: &allow,
+				UpdatedInput:       &updated,
+			},
+		}, nil
+	})
+
+	want := `{"response":{"request_id":"req_hook_1","response":{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"allow","updatedInput":{"command":"ls -la /srv","env":{"LC_ALL":"C"}}}},"subtype":"success"},"type":"control_response"}`
+	if got := string(receivedResponse(t, cli, "req_hook_1")); got != want {
+		t.Errorf("hook response frame =\n%s\nwant\n%s", got, want)
+	}
+
+	answer := permissionAnswer(t, cli)
+	input, _ := answer["updatedInput"].(map[string]interface{})
+	if answer["behavior"] != "allow" || input["command"] != "ls -la /srv" {
+		t.Errorf("permission answer = %v, want allow with the hook's updated input", answer)
+	}
+}
+
+func TestClient_PreToolUseHookDeny(t *testing.T) {
+	cli := runPreToolUseHook(t, func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		deny := "deny"
+		reason := "no listing of /srv"
+		return types.SyncHookJSONOutput{
+			HookSpecificOutput: types.PreToolUseHookSpecificOutput{
+				PermissionDecision:       &deny,
+				PermissionDecisionReason: &reason,
+			},
+		}, nil
+	})
+
+	want := `{"response":{"request_id":"req_hook_1","response":{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"deny","permissionDecisionReason":"no listing of /srv"}},"subtype":"success"},"type":"control_response"}`
+	if got := string(receivedResponse(t, cli, "req_hook_1")); got != want {
+		t.Errorf("hook response frame =\n%s\nwant\n%s", got, want)
+	}
+
+	// The permission callback allows everything, but the hook decided first
+	answer := permissionAnswer(t, cli)
+	if answer["behavior"] != "deny" || answer["message"] != "no listing of /srv" {
+		t.Errorf("permission answer = %v, want the hook's deny", answer)
+	}
+}
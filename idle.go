@@ -0,0 +1,69 @@
+package claude
+
+import (
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// idleTimer fires when no message has arrived for the configured idle
+// timeout. A disabled idleTimer never fires.
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// newIdleTimer starts the idle timer configured with WithIdleTimeout.
+func newIdleTimer(options *types.ClaudeAgentOptions) *idleTimer {
+	if options == nil || options.IdleTimeout == nil || *options.IdleTimeout <= 0 {
+		return &idleTimer{}
+	}
+	timeout := *options.IdleTimeout
+	return &idleTimer{timeout: timeout, timer: time.NewTimer(timeout)}
+}
+
+// C returns the channel the timer fires on, or nil when it is disabled.
+func (t *idleTimer) C() <-chan time.Time {
+	if t.timer == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+// Reset restarts the timer after a message arrived.
+func (t *idleTimer) Reset() {
+	if t.timer == nil {
+		return
+	}
+	if !t.timer.Stop() {
+		select {
+		case <-t.timer.C:
+		default:
+		}
+	}
+	t.timer.Reset(t.timeout)
+}
+
+// Stop releases the timer.
+func (t *idleTimer) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+
+// Err returns the error reported when the timer fires.
+func (t *idleTimer) Err() *types.IdleTimeoutError {
+	return types.NewIdleTimeoutError(t.timeout)
+}
+
+// idleTimeoutMessage builds the SystemMessage emitted when the CLI goes idle.
+func idleTimeoutMessage(err error) *types.SystemMessage {
+	return &types.SystemMessage{
+		Type:    types.MessageTypeSystem,
+		Subtype: "idle_timeout",
+		Data: map[string]interface{}{
+			"error": err.Error(),
+		},
+		Err: err,
+	}
+}
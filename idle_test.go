@@ -0,0 +1,136 @@
+package claude
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+const idleStreamEvent = `{"type":"stream_event","uuid":"u1","session_id":"s","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}}`
+
+// slowStreamCLI returns a mock CLI that answers a prompt with a stream event
+// at once and then every 300ms, four in all, and then hangs without output.
+func slowStreamCLI(t *testing.T) string {
+	t.Helper()
+	steps := []mockcli.Step{mockcli.AwaitPrompt(), mockcli.Send(idleStreamEvent)}
+	for i := 0; i < 3; i++ {
+		steps = append(steps, mockcli.Delay(300*time.Millisecond), mockcli.Send(idleStreamEvent))
+	}
+	return mockcli.New(t, mockcli.Scenario{Steps: append(steps, mockcli.Hang())}).Path
+}
+
+// collectIdle drains messages, counting stream events and returning the
+// idle_timeout SystemMessage, if any.
+func collectIdle(messages <-chan types.Message) (events int, idle *types.SystemMessage) {
+	for msg := range messages {
+		switch m := msg.(type) {
+		case *types.StreamEvent:
+			events++
+		case *types.SystemMessage:
+			if m.Subtype == "idle_timeout" {
+				idle = m
+			}
+		}
+	}
+	return events, idle
+}
+
+func TestClient_IdleTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(slowStreamCLI(t)).
+		WithIdleTimeout(500 * time.Millisecond)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	start := time.Now()
+	events, idle := collectIdle(client.ReceiveResponse(ctx))
+	elapsed := time.Since(start)
+
+	// The timer restarts on each event, so all four arrive before it fires
+	if events != 4 {
+		t.Errorf("got %d stream events, want 4", events)
+	}
+	if idle == nil {
+		t.Fatal("expected an idle_timeout SystemMessage")
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("idle timeout took %v, want well under the context deadline", elapsed)
+	}
+
+	if err := client.Query(ctx, "again"); !types.IsIdleTimeoutError(err) {
+		t.Errorf("Query after idle timeout = %v, want IdleTimeoutError", err)
+	}
+}
+
+func TestClient_IdleTimeoutNotReached(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(idleStreamEvent),
+		mockcli.Delay(300 * time.Millisecond),
+		mockcli.Send(streamResult),
+	}})
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithIdleTimeout(2 * time.Second)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if _, idle := collectIdle(client.ReceiveResponse(ctx)); idle != nil {
+		t.Errorf("unexpected idle timeout: %v", idle.Data)
+	}
+	if err := client.Query(ctx, "again"); err != nil {
+		t.Errorf("Query after a normal response failed: %v", err)
+	}
+}
+
+func TestQuery_IdleTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(slowStreamCLI(t)).
+		WithIdleTimeout(500 * time.Millisecond)
+	messages, err := Query(ctx, "hi", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	start := time.Now()
+	events, idle := collectIdle(messages)
+	if events != 4 {
+		t.Errorf("got %d stream events, want 4", events)
+	}
+	if idle == nil {
+		t.Fatal("expected an idle_timeout SystemMessage")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("idle timeout took %v, want well under the context deadline", elapsed)
+	}
+}
@@ -0,0 +1,136 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// interceptorHooks returns the PreToolUse hooks running the tools set with
+// WithToolInterceptor, one per tool, recording each result in results.
+func interceptorHooks(options *types.ClaudeAgentOptions, results *interceptedResults) []types.HookMatcher {
+	names := make([]string, 0, len(options.ToolInterceptors))
+	for name := range options.ToolInterceptors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	matchers := make([]types.HookMatcher, 0, len(names))
+	for _, name := range names {
+		name, fn := name, options.ToolInterceptors[name]
+		intercept := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+			return interceptToolCall(ctx, options, results, name, fn, input, toolUseID), nil
+		}
+		matcher := name
+		matchers = append(matchers, types.HookMatcher{
+			Matcher:  &matcher,
+			Hooks:    []types.HookCallbackFunc{intercept},
+			Enforced: true,
+		})
+	}
+	return matchers
+}
+
+// interceptToolCall runs one tool call with its interceptor and returns the
+// hook output denying the call to the CLI, with the result as the reason.
+func interceptToolCall(ctx context.Context, options *types.ClaudeAgentOptions, results *interceptedResults, toolName string, fn types.ToolInterceptorFunc, input interface{}, toolUseID *string) interface{} {
+	fields, _ := input.(map[string]interface{})
+	if name, _ := fields["tool_name"].(string); name != toolName {
+		// The CLI matched another tool whose name contains this one
+		return map[string]interface{}{}
+	}
+	toolInput, _ := fields["tool_input"].(map[string]interface{})
+	id, _ := fields["tool_use_id"].(string)
+	if toolUseID != nil {
+		id = *toolUseID
+	}
+
+	content, isError, err := fn(ctx, toolInput)
+	if err != nil {
+		content, isError = err.Error(), true
+	}
+	block := types.NewToolResultBlock(id, content, isError)
+	block.Substituted = true
+	results.add(block)
+	logState(options, "tool call intercepted", "tool", toolName, "tool_use_id", id, "is_error", isError)
+
+	return map[string]interface{}{
+		"hookSpecificOutput": map[string]interface{}{
+			"hookEventName":            string(types.HookEventPreToolUse),
+			"permissionDecision":       string(types.PermissionBehaviorDeny),
+			"permissionDecisionReason": interceptedText(content),
+		},
+	}
+}
+
+// interceptedText returns the text of an interceptor's result as the model
+// is given it: a string as is, the text of result parts, and anything else
+// as JSON.
+func interceptedText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []types.ToolResultPart:
+		var texts []string
+		for _, part := range c {
+			if part.Type == types.BlockTypeText {
+				texts = append(texts, part.Text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// interceptedResults holds the results of intercepted tool calls until the
+// response stream reaches the CLI's tool results for them, which they
+// replace. Results are recorded from the hook callback, before the CLI
+// sends its own.
+type interceptedResults struct {
+	mu      sync.Mutex
+	pending map[string]*types.ToolResultBlock // by tool use ID
+}
+
+func (r *interceptedResults) add(block *types.ToolResultBlock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[string]*types.ToolResultBlock)
+	}
+	r.pending[block.ToolUseID] = block
+}
+
+// apply replaces the tool results in msg that answer intercepted calls with
+// the interceptors' results, which are marked Substituted: the CLI's own
+// result for such a call is its denial.
+func (r *interceptedResults) apply(msg types.Message) {
+	user, ok := msg.(*types.UserMessage)
+	if !ok {
+		return
+	}
+	blocks, _ := user.Content.([]types.ContentBlock)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) == 0 {
+		return
+	}
+	for i, block := range blocks {
+		result, ok := block.(*types.ToolResultBlock)
+		if !ok {
+			continue
+		}
+		if intercepted, ok := r.pending[result.ToolUseID]; ok {
+			blocks[i] = intercepted
+			delete(r.pending, result.ToolUseID)
+		}
+	}
+}
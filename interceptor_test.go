@@ -0,0 +1,247 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+const (
+	interceptedToolUse  = `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"ls /srv"}}]}}`
+	interceptedHookCall = `{"type":"control_request","request_id":"req_hook_1","request":{"subtype":"hook_callback","callback_id":"hook_1","tool_use_id":"toolu_1","input":{"session_id":"s1","transcript_path":"/t.jsonl","cwd":"/app","hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls /srv"}}}}`
+	// The CLI reports the denied call with the hook's reason as its result
+	interceptedCLIResult = `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"app.go","is_error":true}]}}`
+	interceptedAnswer    = `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"/srv holds app.go"}]}}`
+)
+
+// interceptorCLI returns a mock CLI that calls Bash, runs the PreToolUse
+// hook for the call, and answers once it has the tool's result.
+func interceptorCLI(t *testing.T) *mockcli.CLI {
+	t.Helper()
+	return mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(interceptedToolUse, interceptedHookCall),
+		mockcli.AwaitResponse("req_hook_1"),
+		mockcli.Send(interceptedCLIResult, interceptedAnswer, streamResult),
+	}})
+}
+
+// hookDecision decodes the PreToolUse decision the SDK sent for req_hook_1.
+func hookDecision(t *testing.T, cli *mockcli.CLI) (decision, reason string) {
+	t.Helper()
+	data := receivedResponse(t, cli, "req_hook_1")
+	var frame struct {
+		Response struct {
+			Response struct {
+				HookSpecificOutput struct {
+					PermissionDecision       string `json:"permissionDecision"`
+					PermissionDecisionReason string `json:"permissionDecisionReason"`
+				} `json:"hookSpecificOutput"`
+			} `json:"response"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		t.Fatalf("decode hook response %s: %v", data, err)
+	}
+	out := frame.Response.Response.HookSpecificOutput
+	return out.PermissionDecision, out.PermissionDecisionReason
+}
+
+// deliveredToolResult returns the result for toolu_1 among messages.
+func deliveredToolResult(t *testing.T, messages []types.Message) *types.ToolResultBlock {
+	t.Helper()
+	for _, msg := range messages {
+		if user, ok := msg.(*types.UserMessage); ok {
+			if tr := findToolResult(user, "toolu_1"); tr != nil {
+				return tr
+			}
+		}
+	}
+	t.Fatal("no tool result for toolu_1 was delivered")
+	return nil
+}
+
+func TestClient_ToolInterceptor(t *testing.T) {
+	tests := []struct {
+		name       string
+		fn         types.ToolInterceptorFunc
+		wantReason string
+		wantError  bool
+	}{
+		{
+			name: "result",
+			fn: func(ctx context.Context, input map[string]interface{}) (interface{}, bool, error) {
+				if input["command"] != "ls /srv" {
+					return nil, false, errors.New("unexpected input")
+				}
+				return "app.go", false, nil
+			},
+			wantReason: "app.go",
+		},
+		{
+			name: "error result",
+			fn: func(ctx context.Context, input map[string]interface{}) (interface{}, bool, error) {
+				return []types.ToolResultPart{{Type: types.BlockTypeText, Text: "ls: permission denied"}}, true, nil
+			},
+			wantReason: "ls: permission denied",
+			wantError:  true,
+		},
+		{
+			name: "interceptor fails",
+			fn: func(ctx context.Context, input map[string]interface{}) (interface{}, bool, error) {
+				return nil, false, errors.New("sandbox unavailable")
+			},
+			wantReason: "sandbox unavailable",
+			wantError:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cli := interceptorCLI(t)
+			client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithToolInterceptor("Bash", tt.fn))
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			defer client.Close(ctx)
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+
+			turn, err := client.RunTurn(ctx, "what is in /srv?")
+			if err != nil {
+				t.Fatalf("RunTurn failed: %v", err)
+			}
+			if turn.Text != "/srv holds app.go" {
+				t.Errorf("turn text = %q, want the answer after the tool result", turn.Text)
+			}
+
+			// The CLI was told not to run the tool, with the result as the reason
+			if decision, reason := hookDecision(t, cli); decision != "deny" || reason != tt.wantReason {
+				t.Errorf("hook decision = %s %q, want deny %q", decision, reason, tt.wantReason)
+			}
+
+			// The caller sees the interceptor's result, not the denial
+			tr := deliveredToolResult(t, turn.Messages)
+			if text, _ := tr.Text(); text != tt.wantReason {
+				t.Errorf("delivered result text = %q, want %q", text, tt.wantReason)
+			}
+			if isError := tr.IsError != nil && *tr.IsError; isError != tt.wantError {
+				t.Errorf("delivered result is_error = %v, want %v", isError, tt.wantError)
+			}
+			if !tr.Substituted {
+				t.Error("delivered result not marked Substituted")
+			}
+		})
+	}
+}
+
+func TestQuery_ToolInterceptor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var calls int
+	cli := interceptorCLI(t)
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path).
+		WithToolInterceptor("Bash", func(ctx context.Context, input map[string]interface{}) (interface{}, bool, error) {
+			calls++
+			return "app.go", false, nil
+		})
+	messages, err := Query(ctx, "what is in /srv?", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var all []types.Message
+	for msg := range messages {
+		all = append(all, msg)
+	}
+
+	if calls != 1 {
+		t.Errorf("interceptor called %d times, want 1", calls)
+	}
+	if tr := deliveredToolResult(t, all); tr.IsError != nil {
+		t.Errorf("delivered result is_error = %v, want unset", *tr.IsError)
+	}
+	if _, ok := all[len(all)-1].(*types.ResultMessage); !ok {
+		t.Errorf("last message = %T, want the ResultMessage", all[len(all)-1])
+	}
+}
+
+// TestQuery_ToolInterceptorCallbackPrecedence tests that the interceptor's
+// denial reaches the CLI when a CanUseTool callback that would allow the
+// call has precedence, so the CLI does not run the tool a second time.
+func TestQuery_ToolInterceptorCallbackPrecedence(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var calls int
+	cli := interceptorCLI(t)
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path).
+		WithPermissionPrecedence(types.PermissionPrecedenceCallback).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return &types.PermissionResultAllow{}, nil
+		}).
+		WithToolInterceptor("Bash", func(ctx context.Context, input map[string]interface{}) (interface{}, bool, error) {
+			calls++
+			return "app.go", false, nil
+		})
+	messages, err := Query(ctx, "what is in /srv?", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range messages {
+	}
+
+	if calls != 1 {
+		t.Errorf("interceptor called %d times, want 1", calls)
+	}
+	if decision, reason := hookDecision(t, cli); decision != "deny" || reason != "app.go" {
+		t.Errorf("hook decision = %s %q, want deny %q", decision, reason, "app.go")
+	}
+}
+
+// TestInterceptToolCall_OtherTool tests that a hook call for another tool
+// the CLI's matcher let through is left alone.
+func TestInterceptToolCall_OtherTool(t *testing.T) {
+	var results interceptedResults
+	fn := func(ctx context.Context, input map[string]interface{}) (interface{}, bool, error) {
+		t.Error("interceptor called for another tool")
+		return "", false, nil
+	}
+	input := map[string]interface{}{"tool_name": "BashOutput", "tool_use_id": "toolu_2", "tool_input": map[string]interface{}{}}
+	out := interceptToolCall(context.Background(), types.NewClaudeAgentOptions(), &results, "Bash", fn, input, nil)
+	if len(out.(map[string]interface{})) != 0 {
+		t.Errorf("hook output = %v, want none", out)
+	}
+}
+
+func TestInterceptedText(t *testing.T) {
+	tests := []struct {
+		name    string
+		content interface{}
+		want    string
+	}{
+		{"string", "done", "done"},
+		{"parts", []types.ToolResultPart{
+			{Type: types.BlockTypeText, Text: "line 1"},
+			{Type: types.BlockTypeImage},
+			{Type: types.BlockTypeText, Text: "line 2"},
+		}, "line 1\nline 2"},
+		{"other", map[string]interface{}{"exit_code": 0}, `{"exit_code":0}`},
+		{"nil", nil, "null"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interceptedText(tt.content); got != tt.want {
+				t.Errorf("interceptedText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/schlunsen/claude-agent-sdk-go/internal/strutil"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
+// maxRawPreview is the number of bytes of a message kept in parse errors.
+const maxRawPreview = 200
+
 // ParseMessage parses a JSON byte slice into a typed Message.
 // Returns the appropriate message type based on the "type" field discriminator.
 // Handles: user, assistant, system, result, stream_event
@@ -87,7 +91,7 @@ func parseUserMessage(data []byte) (*types.UserMessage, error) {
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return nil, types.NewJSONDecodeErrorWithCause(
 			"failed to unmarshal user message",
-			truncateString(string(data), 200),
+			strutil.TruncateJSON(string(data), maxRawPreview),
 			err,
 		)
 	}
@@ -101,7 +105,7 @@ func parseAssistantMessage(data []byte) (*types.AssistantMessage, error) {
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return nil, types.NewJSONDecodeErrorWithCause(
 			"failed to unmarshal assistant message",
-			truncateString(string(data), 200),
+			strutil.TruncateJSON(string(data), maxRawPreview),
 			err,
 		)
 	}
@@ -115,7 +119,7 @@ func parseSystemMessage(data []byte) (*types.SystemMessage, error) {
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return nil, types.NewJSONDecodeErrorWithCause(
 			"failed to unmarshal system message",
-			truncateString(string(data), 200),
+			strutil.TruncateJSON(string(data), maxRawPreview),
 			err,
 		)
 	}
@@ -129,7 +133,7 @@ func parseResultMessage(data []byte) (*types.ResultMessage, error) {
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return nil, types.NewJSONDecodeErrorWithCause(
 			"failed to unmarshal result message",
-			truncateString(string(data), 200),
+			strutil.TruncateJSON(string(data), maxRawPreview),
 			err,
 		)
 	}
@@ -143,7 +147,7 @@ func parseStreamEvent(data []byte) (*types.StreamEvent, error) {
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return nil, types.NewJSONDecodeErrorWithCause(
 			"failed to unmarshal stream event",
-			truncateString(string(data), 200),
+			strutil.TruncateJSON(string(data), maxRawPreview),
 			err,
 		)
 	}
@@ -157,7 +161,7 @@ func parseTextBlock(data []byte) (*types.TextBlock, error) {
 	if err := json.Unmarshal(data, &block); err != nil {
 		return nil, types.NewJSONDecodeErrorWithCause(
 			"failed to unmarshal text block",
-			truncateString(string(data), 200),
+			strutil.TruncateJSON(string(data), maxRawPreview),
 			err,
 		)
 	}
@@ -171,7 +175,7 @@ func parseToolUseBlock(data []byte) (*types.ToolUseBlock, error) {
 	if err := json.Unmarshal(data, &block); err != nil {
 		return nil, types.NewJSONDecodeErrorWithCause(
 			"failed to unmarshal tool_use block",
-			truncateString(string(data), 200),
+			strutil.TruncateJSON(string(data), maxRawPreview),
 			err,
 		)
 	}
@@ -185,7 +189,7 @@ func parseToolResultBlock(data []byte) (*types.ToolResultBlock, error) {
 	if err := json.Unmarshal(data, &block); err != nil {
 		return nil, types.NewJSONDecodeErrorWithCause(
 			"failed to unmarshal tool_result block",
-			truncateString(string(data), 200),
+			strutil.TruncateJSON(string(data), maxRawPreview),
 			err,
 		)
 	}
@@ -199,7 +203,7 @@ func parseThinkingBlock(data []byte) (*types.ThinkingBlock, error) {
 	if err := json.Unmarshal(data, &block); err != nil {
 		return nil, types.NewJSONDecodeErrorWithCause(
 			"failed to unmarshal thinking block",
-			truncateString(string(data), 200),
+			strutil.TruncateJSON(string(data), maxRawPreview),
 			err,
 		)
 	}
@@ -209,29 +213,20 @@ func parseThinkingBlock(data []byte) (*types.ThinkingBlock, error) {
 // extractType extracts the "type" field value from raw JSON.
 // Returns empty string if type field is missing or invalid.
 func extractType(data []byte) (string, error) {
-	var m map[string]interface{}
-	if err := json.Unmarshal(data, &m); err != nil {
+	var typeCheck struct {
+		Type json.RawMessage `json:"type"`
+	}
+	if err := json.Unmarshal(data, &typeCheck); err != nil {
 		return "", fmt.Errorf("failed to unmarshal JSON for type extraction: %w", err)
 	}
-
-	typeVal, ok := m["type"]
-	if !ok {
+	if typeCheck.Type == nil {
 		return "", fmt.Errorf("missing type field")
 	}
 
-	typeStr, ok := typeVal.(string)
-	if !ok {
+	var typeStr string
+	if typeCheck.Type[0] != '"' || json.Unmarshal(typeCheck.Type, &typeStr) != nil {
 		return "", fmt.Errorf("type field is not a string")
 	}
 
 	return typeStr, nil
 }
-
-// truncateString truncates a string to maxLen characters for logging.
-// Adds "..." suffix if truncated.
-func truncateString(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
-	}
-	return s[:maxLen] + "..."
-}
@@ -111,6 +111,24 @@ var (
 		"model": "claude-sonnet-4-5-20250929"
 	}`)
 
+	// A subagent's tool use, which the CLI then asks permission for
+	assistantMessageSubagentToolUse = []byte(`{
+		"type": "assistant",
+		"content": [
+			{
+				"type": "tool_use",
+				"id": "toolu_write_7",
+				"name": "Write",
+				"input": {
+					"file_path": "/etc/hosts",
+					"content": "127.0.0.1 example"
+				}
+			}
+		],
+		"model": "claude-sonnet-4-5-20250929",
+		"parent_tool_use_id": "toolu_task_3"
+	}`)
+
 	// System messages
 	systemMessageMetadata = []byte(`{
 		"type": "system",
@@ -131,6 +149,19 @@ var (
 		}
 	}`)
 
+	// Sent between turns when the CLI compacts the conversation, with its
+	// fields beside type and subtype
+	systemMessageCompactBoundary = []byte(`{
+		"type": "system",
+		"subtype": "compact_boundary",
+		"session_id": "sess_abc123",
+		"uuid": "7f0e1c2a-compact",
+		"compact_metadata": {
+			"trigger": "auto",
+			"pre_tokens": 154210
+		}
+	}`)
+
 	// Result messages
 	resultMessageSuccess = []byte(`{
 		"type": "result",
@@ -161,6 +192,63 @@ var (
 		"result": "An error occurred during processing"
 	}`)
 
+	resultMessageCacheHit = []byte(`{
+		"type": "result",
+		"subtype": "success",
+		"duration_ms": 2100,
+		"duration_api_ms": 1800,
+		"is_error": false,
+		"num_turns": 2,
+		"session_id": "sess_cache_789",
+		"total_cost_usd": 0.0012,
+		"usage": {
+			"input_tokens": 100,
+			"output_tokens": 50,
+			"cache_creation_input_tokens": 200,
+			"cache_read_input_tokens": 700
+		},
+		"result": "Served mostly from cache"
+	}`)
+
+	resultMessageWithDenials = []byte(`{
+		"type": "result",
+		"subtype": "success",
+		"duration_ms": 3100,
+		"duration_api_ms": 2500,
+		"is_error": false,
+		"num_turns": 4,
+		"session_id": "sess_denied_345",
+		"total_cost_usd": 0.0031,
+		"result": "Could not delete the files",
+		"permission_denials": [
+			{
+				"tool_name": "Bash",
+				"tool_use_id": "toolu_denied_1",
+				"tool_input": {"command": "rm -rf build"}
+			},
+			{
+				"tool_name": "Write",
+				"tool_use_id": "toolu_denied_2",
+				"tool_input": {"file_path": "/etc/hosts", "content": "x"}
+			}
+		]
+	}`)
+
+	resultMessageNoCacheFields = []byte(`{
+		"type": "result",
+		"subtype": "success",
+		"duration_ms": 800,
+		"duration_api_ms": 650,
+		"is_error": false,
+		"num_turns": 1,
+		"session_id": "sess_nocache_012",
+		"usage": {
+			"input_tokens": 40,
+			"output_tokens": 10
+		},
+		"result": "Done"
+	}`)
+
 	// Stream events
 	streamEventMessageStart = []byte(`{
 		"type": "stream_event",
@@ -173,7 +261,11 @@ var (
 				"type": "message",
 				"role": "assistant",
 				"content": [],
-				"model": "claude-sonnet-4-5-20250929"
+				"model": "claude-sonnet-4-5-20250929",
+				"usage": {
+					"input_tokens": 12,
+					"output_tokens": 1
+				}
 			}
 		}
 	}`)
@@ -209,6 +301,78 @@ var (
 		}
 	}`)
 
+	streamEventContentBlockStart = []byte(`{
+		"type": "stream_event",
+		"uuid": "evt_uuid_201",
+		"session_id": "sess_stream_789",
+		"event": {
+			"type": "content_block_start",
+			"index": 1,
+			"content_block": {
+				"type": "tool_use",
+				"id": "toolu_stream_1",
+				"name": "Read",
+				"input": {}
+			}
+		}
+	}`)
+
+	streamEventInputJSONDelta = []byte(`{
+		"type": "stream_event",
+		"uuid": "evt_uuid_202",
+		"session_id": "sess_stream_789",
+		"event": {
+			"type": "content_block_delta",
+			"index": 1,
+			"delta": {
+				"type": "input_json_delta",
+				"partial_json": "{\"file_path\": \"/tmp/"
+			}
+		}
+	}`)
+
+	streamEventThinkingDelta = []byte(`{
+		"type": "stream_event",
+		"uuid": "evt_uuid_203",
+		"session_id": "sess_stream_789",
+		"event": {
+			"type": "content_block_delta",
+			"index": 0,
+			"delta": {
+				"type": "thinking_delta",
+				"thinking": "First, consider"
+			}
+		}
+	}`)
+
+	streamEventContentBlockStop = []byte(`{
+		"type": "stream_event",
+		"uuid": "evt_uuid_204",
+		"session_id": "sess_stream_789",
+		"event": {
+			"type": "content_block_stop",
+			"index": 1
+		}
+	}`)
+
+	streamEventMessageStop = []byte(`{
+		"type": "stream_event",
+		"uuid": "evt_uuid_205",
+		"session_id": "sess_stream_789",
+		"event": {
+			"type": "message_stop"
+		}
+	}`)
+
+	streamEventUnknown = []byte(`{
+		"type": "stream_event",
+		"uuid": "evt_uuid_206",
+		"session_id": "sess_stream_789",
+		"event": {
+			"type": "ping"
+		}
+	}`)
+
 	// Individual content blocks
 	textBlockJSON = []byte(`{
 		"type": "text",
@@ -257,6 +421,46 @@ var (
 		"is_error": false
 	}`)
 
+	toolResultBlockJSONMixed = []byte(`{
+		"type": "tool_result",
+		"tool_use_id": "toolu_mixed_321",
+		"content": [
+			{
+				"type": "text",
+				"text": "Screenshot taken"
+			},
+			{
+				"type": "image",
+				"source": {
+					"type": "base64",
+					"media_type": "image/png",
+					"data": "iVBORw0KGgo="
+				}
+			},
+			{
+				"type": "text",
+				"text": "Page title: Home",
+				"cache_control": {"type": "ephemeral"}
+			}
+		],
+		"is_error": true
+	}`)
+
+	toolResultBlockJSONImageOnly = []byte(`{
+		"type": "tool_result",
+		"tool_use_id": "toolu_image_654",
+		"content": [
+			{
+				"type": "image",
+				"source": {
+					"type": "base64",
+					"media_type": "image/jpeg",
+					"data": "/9j/4AAQ"
+				}
+			}
+		]
+	}`)
+
 	// Invalid/malformed messages for error testing
 	invalidJSONMalformed = []byte(`{
 		"type": "user",
@@ -372,4 +576,55 @@ var (
 		],
 		"model": "claude-sonnet-4-5-20250929"
 	}`)
+
+	// Hook callback requests for lifecycle events, as the CLI sends them
+	hookCallbackNotification = []byte(`{
+		"subtype": "hook_callback",
+		"callback_id": "hook_0",
+		"input": {
+			"session_id": "session_hooks",
+			"transcript_path": "/home/user/.claude/projects/app/session_hooks.jsonl",
+			"cwd": "/home/user/app",
+			"hook_event_name": "Notification",
+			"message": "Claude needs your permission to use Bash",
+			"title": "Claude Code"
+		}
+	}`)
+
+	hookCallbackSessionStart = []byte(`{
+		"subtype": "hook_callback",
+		"callback_id": "hook_0",
+		"input": {
+			"session_id": "session_hooks",
+			"transcript_path": "/home/user/.claude/projects/app/session_hooks.jsonl",
+			"cwd": "/home/user/app",
+			"hook_event_name": "SessionStart",
+			"source": "resume"
+		}
+	}`)
+
+	hookCallbackSessionEnd = []byte(`{
+		"subtype": "hook_callback",
+		"callback_id": "hook_0",
+		"input": {
+			"session_id": "session_hooks",
+			"transcript_path": "/home/user/.claude/projects/app/session_hooks.jsonl",
+			"cwd": "/home/user/app",
+			"hookEventName": "SessionEnd",
+			"reason": "prompt_input_exit"
+		}
+	}`)
+
+	// A hook event newer than the SDK
+	hookCallbackUnknownEvent = []byte(`{
+		"subtype": "hook_callback",
+		"callback_id": "hook_0",
+		"input": {
+			"session_id": "session_hooks",
+			"transcript_path": "/home/user/.claude/projects/app/session_hooks.jsonl",
+			"cwd": "/home/user/app",
+			"hook_event_name": "PostCompact",
+			"summary_tokens": 1200
+		}
+	}`)
 )
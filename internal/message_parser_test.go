@@ -2,6 +2,7 @@ package internal
 
 import (
 	"encoding/json"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -300,6 +301,76 @@ func TestParseMessage_AssistantMessage(t *testing.T) {
 	}
 }
 
+// TestAssistantMessageAccessors tests Text, ToolUses, Thinking and
+// HasToolUse over the assistant message fixtures.
+func TestAssistantMessageAccessors(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        []byte
+		wantText     string
+		wantTools    []string
+		wantThinking []string
+	}{
+		{"text", assistantMessageText, "Hi there! How can I help you today?", nil, nil},
+		{"tool use", assistantMessageToolUse, "I'll calculate that for you.", []string{"calculator"}, nil},
+		{"thinking", assistantMessageThinking, "Based on my analysis...", nil, []string{"Let me analyze this problem step by step..."}},
+		{"mixed", assistantMessageMixed, "Running command...", []string{"bash"}, []string{"I need to use the bash tool"}},
+		{"all blocks", assistantMessageAllBlocks, "I'll help with that", []string{"bash"}, []string{"Analyzing request"}},
+		{"extra fields", assistantMessageExtraFields, "Response", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseMessage(tt.input)
+			if err != nil {
+				t.Fatalf("ParseMessage failed: %v", err)
+			}
+			m := msg.(*types.AssistantMessage)
+
+			if got := m.Text(); got != tt.wantText {
+				t.Errorf("Text() = %q, want %q", got, tt.wantText)
+			}
+
+			var tools []string
+			for _, tu := range m.ToolUses() {
+				tools = append(tools, tu.Name)
+			}
+			if !reflect.DeepEqual(tools, tt.wantTools) {
+				t.Errorf("ToolUses() names = %v, want %v", tools, tt.wantTools)
+			}
+			for _, name := range tt.wantTools {
+				if !m.HasToolUse(name) {
+					t.Errorf("HasToolUse(%q) = false, want true", name)
+				}
+			}
+			if m.HasToolUse("Write") {
+				t.Error("HasToolUse(\"Write\") = true, want false")
+			}
+
+			var thinking []string
+			for _, tb := range m.Thinking() {
+				thinking = append(thinking, tb.Thinking)
+			}
+			if !reflect.DeepEqual(thinking, tt.wantThinking) {
+				t.Errorf("Thinking() = %v, want %v", thinking, tt.wantThinking)
+			}
+		})
+	}
+}
+
+// TestAssistantMessageTextJoinsBlocks tests that Text joins several text
+// blocks with newlines.
+func TestAssistantMessageTextJoinsBlocks(t *testing.T) {
+	m := &types.AssistantMessage{Content: []types.ContentBlock{
+		types.NewTextBlock("first"),
+		types.NewToolUseBlock("toolu_1", "Read", nil),
+		types.NewTextBlock("second"),
+	}}
+	if got := m.Text(); got != "first\nsecond" {
+		t.Errorf("Text() = %q, want %q", got, "first\nsecond")
+	}
+}
+
 // TestParseMessage_SystemMessage tests parsing of system messages.
 func TestParseMessage_SystemMessage(t *testing.T) {
 	tests := []struct {
@@ -320,6 +391,12 @@ func TestParseMessage_SystemMessage(t *testing.T) {
 			wantErr:     false,
 			wantSubtype: "warning",
 		},
+		{
+			name:        "compact boundary",
+			input:       systemMessageCompactBoundary,
+			wantErr:     false,
+			wantSubtype: "compact_boundary",
+		},
 	}
 
 	for _, tt := range tests {
@@ -343,6 +420,35 @@ func TestParseMessage_SystemMessage(t *testing.T) {
 	}
 }
 
+// TestParseMessage_CompactBoundary tests that a compact boundary keeps the
+// fields the CLI sends beside type and subtype.
+func TestParseMessage_CompactBoundary(t *testing.T) {
+	msg, err := ParseMessage(systemMessageCompactBoundary)
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	sys, ok := msg.(*types.SystemMessage)
+	if !ok {
+		t.Fatalf("expected *types.SystemMessage, got %T", msg)
+	}
+	boundary := sys.CompactBoundary()
+	if boundary == nil || boundary.Trigger != "auto" || boundary.PreTokens != 154210 {
+		t.Errorf("CompactBoundary() = %+v, want an auto compaction of 154210 tokens", boundary)
+	}
+	if sys.Data["session_id"] != "sess_abc123" {
+		t.Errorf("Data = %v, want the session ID", sys.Data)
+	}
+
+	// Messages with a data object keep it as is
+	msg, err = ParseMessage(systemMessageMetadata)
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	if sys := msg.(*types.SystemMessage); sys.CompactBoundary() != nil || sys.Data["version"] != "1.0.0" {
+		t.Errorf("metadata message = %+v", sys)
+	}
+}
+
 // TestParseMessage_ResultMessage tests parsing of result messages.
 func TestParseMessage_ResultMessage(t *testing.T) {
 	tests := []struct {
@@ -395,6 +501,114 @@ func TestParseMessage_ResultMessage(t *testing.T) {
 	}
 }
 
+// TestParseMessage_ResultPermissionDenials tests parsing of denied tool invocations.
+func TestParseMessage_ResultPermissionDenials(t *testing.T) {
+	msg, err := ParseMessage(resultMessageWithDenials)
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	resultMsg := msg.(*types.ResultMessage)
+
+	if len(resultMsg.PermissionDenials) != 2 {
+		t.Fatalf("expected 2 permission denials, got %d", len(resultMsg.PermissionDenials))
+	}
+	first := resultMsg.PermissionDenials[0]
+	if first.ToolName != "Bash" || first.ToolUseID != "toolu_denied_1" {
+		t.Errorf("unexpected first denial: %+v", first)
+	}
+	if first.ToolInput["command"] != "rm -rf build" {
+		t.Errorf("expected tool input command, got %v", first.ToolInput)
+	}
+	if resultMsg.PermissionDenials[1].ToolInput["file_path"] != "/etc/hosts" {
+		t.Errorf("unexpected second denial: %+v", resultMsg.PermissionDenials[1])
+	}
+
+	// Results without denials leave the field empty
+	msg, err = ParseMessage(resultMessageSuccess)
+	if err != nil {
+		t.Fatalf("ParseMessage() error = %v", err)
+	}
+	if denials := msg.(*types.ResultMessage).PermissionDenials; denials != nil {
+		t.Errorf("expected no permission denials, got %v", denials)
+	}
+}
+
+// TestParseMessage_ResultUsageCacheMetrics tests typed usage and cache metrics from result messages.
+func TestParseMessage_ResultUsageCacheMetrics(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        []byte
+		wantUsage    bool
+		wantRead     int
+		wantCreation int
+		wantHitRate  float64
+	}{
+		{
+			name:        "zero cache fields",
+			input:       resultMessageSuccess,
+			wantUsage:   true,
+			wantHitRate: 0,
+		},
+		{
+			name:         "cache hit",
+			input:        resultMessageCacheHit,
+			wantUsage:    true,
+			wantRead:     700,
+			wantCreation: 200,
+			wantHitRate:  0.7,
+		},
+		{
+			name:        "no cache fields",
+			input:       resultMessageNoCacheFields,
+			wantUsage:   true,
+			wantHitRate: 0,
+		},
+		{
+			name:      "no usage",
+			input:     resultMessageError,
+			wantUsage: false,
+		},
+	}
+
+	var cumulative types.CacheMetrics
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseMessage(tt.input)
+			if err != nil {
+				t.Fatalf("ParseMessage() error = %v", err)
+			}
+			usage, err := msg.(*types.ResultMessage).ParseUsage()
+			if err != nil {
+				t.Fatalf("ParseUsage() error = %v", err)
+			}
+			if (usage != nil) != tt.wantUsage {
+				t.Fatalf("expected usage present = %v, got %+v", tt.wantUsage, usage)
+			}
+			cumulative.Add(usage)
+			if usage == nil {
+				return
+			}
+			if usage.CacheReadInputTokens != tt.wantRead {
+				t.Errorf("expected cache read tokens %d, got %d", tt.wantRead, usage.CacheReadInputTokens)
+			}
+			if usage.CacheCreationInputTokens != tt.wantCreation {
+				t.Errorf("expected cache creation tokens %d, got %d", tt.wantCreation, usage.CacheCreationInputTokens)
+			}
+			if got := usage.CacheHitRate(); got != tt.wantHitRate {
+				t.Errorf("expected hit rate %v, got %v", tt.wantHitRate, got)
+			}
+		})
+	}
+
+	if cumulative.Turns != 3 {
+		t.Errorf("expected 3 turns with usage, got %d", cumulative.Turns)
+	}
+	// 700 cache reads out of 150 + 1000 + 40 total input tokens.
+	if got, want := cumulative.HitRate(), 700.0/1190.0; got != want {
+		t.Errorf("expected cumulative hit rate %v, got %v", want, got)
+	}
+}
+
 // TestParseMessage_StreamEvent tests parsing of stream events.
 func TestParseMessage_StreamEvent(t *testing.T) {
 	tests := []struct {
@@ -449,6 +663,142 @@ func TestParseMessage_StreamEvent(t *testing.T) {
 	}
 }
 
+// TestStreamEvent_Decode tests decoding stream events into typed payloads.
+func TestStreamEvent_Decode(t *testing.T) {
+	decode := func(t *testing.T, input []byte) types.StreamEventPayload {
+		t.Helper()
+		msg, err := ParseMessage(input)
+		if err != nil {
+			t.Fatalf("ParseMessage() error = %v", err)
+		}
+		payload, err := msg.(*types.StreamEvent).Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		return payload
+	}
+
+	t.Run("message_start", func(t *testing.T) {
+		e, ok := decode(t, streamEventMessageStart).(*types.MessageStartEvent)
+		if !ok {
+			t.Fatal("expected *types.MessageStartEvent")
+		}
+		if e.EventType() != "message_start" || e.Message.ID != "msg_abc" || e.Message.Role != "assistant" ||
+			e.Message.Model != "claude-sonnet-4-5-20250929" || len(e.Message.Content) != 0 {
+			t.Errorf("unexpected message: %+v", e.Message)
+		}
+		if e.Message.Usage == nil || e.Message.Usage.InputTokens != 12 || e.Message.Usage.OutputTokens != 1 {
+			t.Errorf("unexpected usage: %+v", e.Message.Usage)
+		}
+	})
+
+	t.Run("content_block_start", func(t *testing.T) {
+		e, ok := decode(t, streamEventContentBlockStart).(*types.ContentBlockStartEvent)
+		if !ok {
+			t.Fatal("expected *types.ContentBlockStartEvent")
+		}
+		if e.Index != 1 {
+			t.Errorf("expected index 1, got %d", e.Index)
+		}
+		block, ok := e.ContentBlock.(*types.ToolUseBlock)
+		if !ok || block.ID != "toolu_stream_1" || block.Name != "Read" {
+			t.Errorf("unexpected content block: %#v", e.ContentBlock)
+		}
+		if len(e.RawContentBlock) == 0 {
+			t.Error("expected raw content block")
+		}
+	})
+
+	t.Run("text_delta", func(t *testing.T) {
+		e, ok := decode(t, streamEventContentBlockDelta).(*types.ContentBlockDeltaEvent)
+		if !ok {
+			t.Fatal("expected *types.ContentBlockDeltaEvent")
+		}
+		delta, ok := e.Delta.(*types.TextDelta)
+		if !ok || e.Index != 0 || delta.Text != "Hello" || delta.DeltaType() != "text_delta" {
+			t.Errorf("unexpected delta at %d: %#v", e.Index, e.Delta)
+		}
+	})
+
+	t.Run("input_json_delta", func(t *testing.T) {
+		e, ok := decode(t, streamEventInputJSONDelta).(*types.ContentBlockDeltaEvent)
+		if !ok {
+			t.Fatal("expected *types.ContentBlockDeltaEvent")
+		}
+		delta, ok := e.Delta.(*types.InputJSONDelta)
+		if !ok || e.Index != 1 || delta.PartialJSON != `{"file_path": "/tmp/` {
+			t.Errorf("unexpected delta at %d: %#v", e.Index, e.Delta)
+		}
+	})
+
+	t.Run("thinking_delta", func(t *testing.T) {
+		e, ok := decode(t, streamEventThinkingDelta).(*types.ContentBlockDeltaEvent)
+		if !ok {
+			t.Fatal("expected *types.ContentBlockDeltaEvent")
+		}
+		delta, ok := e.Delta.(*types.ThinkingDelta)
+		if !ok || delta.Thinking != "First, consider" {
+			t.Errorf("unexpected delta: %#v", e.Delta)
+		}
+	})
+
+	t.Run("content_block_stop", func(t *testing.T) {
+		e, ok := decode(t, streamEventContentBlockStop).(*types.ContentBlockStopEvent)
+		if !ok || e.Index != 1 {
+			t.Errorf("unexpected payload: %#v", e)
+		}
+	})
+
+	t.Run("message_delta", func(t *testing.T) {
+		e, ok := decode(t, streamEventMessageDelta).(*types.MessageDeltaEvent)
+		if !ok {
+			t.Fatal("expected *types.MessageDeltaEvent")
+		}
+		if e.Delta.StopReason == nil || *e.Delta.StopReason != "end_turn" || e.Delta.StopSequence != nil {
+			t.Errorf("unexpected delta: %+v", e.Delta)
+		}
+		if e.Usage == nil || e.Usage.OutputTokens != 42 {
+			t.Errorf("unexpected usage: %+v", e.Usage)
+		}
+	})
+
+	t.Run("message_stop", func(t *testing.T) {
+		if _, ok := decode(t, streamEventMessageStop).(*types.MessageStopEvent); !ok {
+			t.Error("expected *types.MessageStopEvent")
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		e, ok := decode(t, streamEventUnknown).(*types.RawEvent)
+		if !ok || e.EventType() != "ping" || e.Data["type"] != "ping" {
+			t.Errorf("unexpected payload: %#v", e)
+		}
+	})
+
+	t.Run("unknown delta", func(t *testing.T) {
+		event := &types.StreamEvent{Event: map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": 2,
+			"delta": map[string]interface{}{"type": "citations_delta", "citation": "x"},
+		}}
+		payload, err := event.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		delta, ok := payload.(*types.ContentBlockDeltaEvent).Delta.(*types.RawDelta)
+		if !ok || delta.Type != "citations_delta" || delta.Data["citation"] != "x" {
+			t.Errorf("unexpected delta: %#v", delta)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		event := &types.StreamEvent{Event: map[string]interface{}{"type": "content_block_stop", "index": "one"}}
+		if _, err := event.Decode(); !types.IsMessageParseError(err) {
+			t.Errorf("expected MessageParseError, got %v", err)
+		}
+	})
+}
+
 // TestParseMessage_InvalidJSON tests error handling for invalid JSON.
 func TestParseMessage_InvalidJSON(t *testing.T) {
 	tests := []struct {
@@ -554,24 +904,53 @@ func TestParseContentBlock_ToolResultBlock(t *testing.T) {
 		input       []byte
 		wantErr     bool
 		wantIsError *bool
+		wantText    string
+		wantHasText bool
+		wantParts   []string // Part types
 	}{
 		{
 			name:        "simple result",
 			input:       toolResultBlockJSON,
 			wantErr:     false,
 			wantIsError: nil,
+			wantText:    "The result is 30",
+			wantHasText: true,
+			wantParts:   []string{"text"},
 		},
 		{
 			name:        "error result",
 			input:       toolResultBlockJSONWithError,
 			wantErr:     false,
 			wantIsError: boolPtr(true),
+			wantText:    "Command failed with exit code 1",
+			wantHasText: true,
+			wantParts:   []string{"text"},
 		},
 		{
 			name:        "complex content",
 			input:       toolResultBlockJSONComplex,
 			wantErr:     false,
 			wantIsError: boolPtr(false),
+			wantText:    "Multi-part result",
+			wantHasText: true,
+			wantParts:   []string{"text"},
+		},
+		{
+			name:        "mixed text and image error",
+			input:       toolResultBlockJSONMixed,
+			wantErr:     false,
+			wantIsError: boolPtr(true),
+			wantText:    "Screenshot taken\nPage title: Home",
+			wantHasText: true,
+			wantParts:   []string{"text", "image", "text"},
+		},
+		{
+			name:        "image only",
+			input:       toolResultBlockJSONImageOnly,
+			wantErr:     false,
+			wantIsError: nil,
+			wantHasText: false,
+			wantParts:   []string{"image"},
 		},
 	}
 
@@ -597,6 +976,37 @@ func TestParseContentBlock_ToolResultBlock(t *testing.T) {
 					} else if *toolResultBlock.IsError != *tt.wantIsError {
 						t.Errorf("expected is_error %v, got %v", *tt.wantIsError, *toolResultBlock.IsError)
 					}
+				} else if toolResultBlock.IsError != nil {
+					t.Errorf("expected is_error to be unset, got %v", *toolResultBlock.IsError)
+				}
+
+				text, hasText := toolResultBlock.Text()
+				if text != tt.wantText || hasText != tt.wantHasText {
+					t.Errorf("Text() = %q, %v; want %q, %v", text, hasText, tt.wantText, tt.wantHasText)
+				}
+				parts := toolResultBlock.Parts()
+				var partTypes []string
+				for _, p := range parts {
+					partTypes = append(partTypes, p.Type)
+				}
+				if !reflect.DeepEqual(partTypes, tt.wantParts) {
+					t.Errorf("Parts() types = %v, want %v", partTypes, tt.wantParts)
+				}
+
+				// Marshaling gives back what the CLI sent
+				data, err := json.Marshal(toolResultBlock)
+				if err != nil {
+					t.Fatalf("Marshal failed: %v", err)
+				}
+				var got, want interface{}
+				if err := json.Unmarshal(data, &got); err != nil {
+					t.Fatal(err)
+				}
+				if err := json.Unmarshal(tt.input, &want); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("round trip changed the block:\ngot  %s\nwant %s", data, tt.input)
 				}
 			}
 		})
@@ -781,50 +1191,6 @@ func TestExtractType(t *testing.T) {
 	}
 }
 
-// TestTruncateString tests the string truncation helper.
-func TestTruncateString(t *testing.T) {
-	tests := []struct {
-		name   string
-		input  string
-		maxLen int
-		want   string
-	}{
-		{
-			name:   "no truncation needed",
-			input:  "short",
-			maxLen: 10,
-			want:   "short",
-		},
-		{
-			name:   "exact length",
-			input:  "exact",
-			maxLen: 5,
-			want:   "exact",
-		},
-		{
-			name:   "truncation needed",
-			input:  "this is a very long string",
-			maxLen: 10,
-			want:   "this is a ...",
-		},
-		{
-			name:   "empty string",
-			input:  "",
-			maxLen: 10,
-			want:   "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := truncateString(tt.input, tt.maxLen)
-			if got != tt.want {
-				t.Errorf("truncateString() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 // BenchmarkParseMessage_User benchmarks parsing a user message.
 func BenchmarkParseMessage_User(b *testing.B) {
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,30 @@
+package mockcli
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// versionCacheDirEnv is transport.VersionCacheDirEnv. This package cannot
+// import transport, whose own tests use it.
+const versionCacheDirEnv = "CLAUDE_AGENT_SDK_VERSION_CACHE_DIR"
+
+// Main runs the tests of a package with the CLI version cache in a temporary
+// directory, so that the version probes of the mock CLIs they start stay out
+// of the user's cache. Call it as the package's TestMain:
+//
+//	func TestMain(m *testing.M) {
+//	    mockcli.Main(m)
+//	}
+func Main(m *testing.M) {
+	dir, err := os.MkdirTemp("", "claude-version-cache")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv(versionCacheDirEnv, dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,260 @@
+// Package mockcli runs scripted stand-ins for the Claude Code CLI in tests.
+//
+// The mock CLI is the test binary itself, so it works wherever the tests
+// build. New links the running binary into a temporary directory next to a
+// file describing the scenario; when the binary starts under that name, this
+// package's init function plays the scenario instead of running the tests.
+// Any test binary that imports the package, directly or through claudetest,
+// can therefore serve as a mock CLI. Packages whose tests start mock CLIs
+// call Main from their TestMain to keep the SDK's version probes of them out
+// of the user's CLI version cache.
+package mockcli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// DefaultVersion is what a mock CLI prints for --version when the scenario
+// sets no Version.
+const DefaultVersion = "2.1.0 (Claude Code)"
+
+// scenarioSuffix names the scenario file written next to the linked binary.
+const scenarioSuffix = ".scenario.json"
+
+// Scenario scripts a mock CLI.
+//
+// The CLI answers every control request the SDK sends while the scenario
+// runs, with the payload from ControlResponses or the error from
+// ControlErrors for its subtype, and an empty success payload otherwise.
+// Meanwhile it plays Steps in order. Once they are done it answers each
+// further prompt with EachPrompt, if set, and exits when its input closes.
+type Scenario struct {
+	// Version is printed for --version (DefaultVersion if empty)
+	Version string
+
+	// VersionDelay holds up the answer to --version, as a slow CLI would
+	VersionDelay time.Duration
+
+	// ControlResponses holds success payloads by control request subtype,
+	// such as the response to "initialize"
+	ControlResponses map[string]json.RawMessage
+
+	// ControlErrors makes the CLI refuse control requests of the given
+	// subtypes with the given error message
+	ControlErrors map[string]string
+
+	// Unanswered lists control request subtypes the CLI never answers
+	Unanswered []string
+
+	// FailRuns makes the first FailRuns runs of the CLI, other than
+	// --version probes, exit with status 1 before reading their input, as a
+	// CLI that fails to start would
+	FailRuns int
+
+	// Steps are played in order once the CLI starts
+	Steps []Step
+
+	// EachPrompt holds the lines sent in answer to every prompt received
+	// after Steps are done
+	EachPrompt []string
+}
+
+// Step is one action of a Scenario, created with the functions below.
+type Step struct {
+	Action string        `json:"action"`
+	Lines  []string      `json:"lines,omitempty"`
+	Delay  time.Duration `json:"delay,omitempty"`
+	Code   int           `json:"code,omitempty"`
+	ID     string        `json:"id,omitempty"` // Request ID or subtype
+}
+
+const (
+	actionSend             = "send"
+	actionStderr           = "stderr"
+	actionAwaitPrompt      = "await_prompt"
+	actionAwaitResponse    = "await_response"
+	actionAwaitRequest     = "await_request"
+	actionAwaitInputClosed = "await_input_closed"
+	actionDelay            = "delay"
+	actionExit             = "exit"
+	actionCloseOutput      = "close_output"
+	actionHang             = "hang"
+)
+
+// Send writes lines, one JSON message each, to the CLI's output.
+func Send(lines ...string) Step {
+	return Step{Action: actionSend, Lines: lines}
+}
+
+// Stderr writes lines to the CLI's standard error.
+func Stderr(lines ...string) Step {
+	return Step{Action: actionStderr, Lines: lines}
+}
+
+// AwaitPrompt waits for the next user message from the SDK. The CLI exits
+// with status 0 if its input closes first, as the real CLI does.
+func AwaitPrompt() Step {
+	return Step{Action: actionAwaitPrompt}
+}
+
+// AwaitResponse waits for the SDK to answer the control request the CLI
+// sent with requestID. The CLI exits with status 0 if its input closes first.
+func AwaitResponse(requestID string) Step {
+	return Step{Action: actionAwaitResponse, ID: requestID}
+}
+
+// AwaitRequest waits until the CLI has answered a control request of the
+// given subtype from the SDK, such as "interrupt". Each request satisfies one
+// AwaitRequest. The CLI exits with status 0 if its input closes first.
+func AwaitRequest(subtype string) Step {
+	return Step{Action: actionAwaitRequest, ID: subtype}
+}
+
+// AwaitInputClosed waits until the SDK closes the CLI's input, as Close and
+// EndInput do, so that later steps run during shutdown.
+func AwaitInputClosed() Step {
+	return Step{Action: actionAwaitInputClosed}
+}
+
+// Delay pauses the scenario for d.
+func Delay(d time.Duration) Step {
+	return Step{Action: actionDelay, Delay: d}
+}
+
+// Exit ends the CLI at once with the given status, even mid-stream.
+func Exit(code int) Step {
+	return Step{Action: actionExit, Code: code}
+}
+
+// CloseOutput closes the CLI's output while it keeps running.
+func CloseOutput() Step {
+	return Step{Action: actionCloseOutput}
+}
+
+// Hang keeps the CLI running, ignoring the end of its input, until it is
+// killed.
+func Hang() Step {
+	return Step{Action: actionHang}
+}
+
+// CLI is a mock CLI created by New.
+type CLI struct {
+	// Path is the executable to pass to WithCLIPath
+	Path string
+
+	received string
+	args     string
+	pid      string
+	runs     string
+}
+
+// New writes a mock CLI playing scenario and returns it. Its files are
+// removed when the test ends.
+func New(t testing.TB, scenario Scenario) *CLI {
+	t.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("mockcli: locating the test binary: %v", err)
+	}
+	dir := t.TempDir()
+	name := "claude"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	cli := &CLI{
+		Path:     filepath.Join(dir, name),
+		received: filepath.Join(dir, "received.jsonl"),
+		args:     filepath.Join(dir, "args.json"),
+		pid:      filepath.Join(dir, "pid"),
+		runs:     filepath.Join(dir, "runs"),
+	}
+	if err := linkBinary(exe, cli.Path); err != nil {
+		t.Fatalf("mockcli: linking the test binary: %v", err)
+	}
+
+	if scenario.Version == "" {
+		scenario.Version = DefaultVersion
+	}
+	data, err := json.Marshal(script{Scenario: scenario, Received: cli.received, Args: cli.args, PID: cli.pid, Runs: cli.runs})
+	if err != nil {
+		t.Fatalf("mockcli: encoding the scenario: %v", err)
+	}
+	if err := os.WriteFile(cli.Path+scenarioSuffix, data, 0600); err != nil {
+		t.Fatalf("mockcli: writing the scenario: %v", err)
+	}
+	return cli
+}
+
+// Received returns the lines the CLI has read from the SDK so far, oldest
+// first, across every run of the CLI.
+func (c *CLI) Received() []string {
+	data, err := os.ReadFile(c.received)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// Args returns the command-line arguments of the CLI's latest run, other
+// than --version probes, or nil if it has not run.
+func (c *CLI) Args() []string {
+	data, err := os.ReadFile(c.args)
+	if err != nil {
+		return nil
+	}
+	var args []string
+	_ = json.Unmarshal(data, &args)
+	return args
+}
+
+// PID returns the process ID of the CLI's latest run, other than --version
+// probes, or 0 if it has not run.
+func (c *CLI) PID() int {
+	data, err := os.ReadFile(c.pid)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(string(data))
+	return pid
+}
+
+// Runs returns how many times the CLI has run, other than --version probes.
+func (c *CLI) Runs() int {
+	info, err := os.Stat(c.runs)
+	if err != nil {
+		return 0
+	}
+	return int(info.Size())
+}
+
+// script is the scenario file.
+type script struct {
+	Scenario
+	Received string // file the CLI appends its input to
+	Args     string // file the CLI writes its arguments to
+	PID      string // file the CLI writes its process ID to
+	Runs     string // file the CLI appends a byte to for each run
+}
+
+// linkBinary makes the test binary available at path: as a hard link where
+// possible and as a copy where not. A symbolic link would not do, since the
+// SDK caches CLI versions by the binary a path resolves to, and every mock
+// CLI would then share the version of the first.
+func linkBinary(exe, path string) error {
+	if err := os.Link(exe, path); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(exe)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0755)
+}
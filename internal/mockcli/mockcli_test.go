@@ -0,0 +1,110 @@
+package mockcli
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestNew_Version(t *testing.T) {
+	for _, tt := range []struct {
+		version string
+		want    string
+	}{
+		{"", DefaultVersion},
+		{"1.0.0 (Claude Code)", "1.0.0 (Claude Code)"},
+	} {
+		cli := New(t, Scenario{Version: tt.version})
+		out, err := exec.Command(cli.Path, "--version").Output()
+		if err != nil {
+			t.Fatalf("--version failed: %v", err)
+		}
+		if got := strings.TrimSpace(string(out)); got != tt.want {
+			t.Errorf("--version = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestNew_Steps(t *testing.T) {
+	cli := New(t, Scenario{
+		ControlResponses: map[string]json.RawMessage{"initialize": json.RawMessage(`{"ok":true}`)},
+		ControlErrors:    map[string]string{"interrupt": "nothing to interrupt"},
+		Unanswered:       []string{"set_model"},
+		Steps: []Step{
+			AwaitPrompt(),
+			Send(`{"type":"control_request","request_id":"perm_1","request":{"subtype":"can_use_tool"}}`),
+			AwaitResponse("perm_1"),
+			Send(`{"type":"result"}`),
+			Exit(3),
+		},
+	})
+
+	cmd := exec.Command(cli.Path)
+	cmd.Stdin = strings.NewReader(strings.Join([]string{
+		`{"type":"control_request","request_id":"req_1","request":{"subtype":"initialize"}}`,
+		`{"type":"control_request","request_id":"req_2","request":{"subtype":"set_model"}}`,
+		`{"type":"control_request","request_id":"req_3","request":{"subtype":"interrupt"}}`,
+		`{"type":"user","message":{"role":"user","content":"hi"}}`,
+		`{"type":"control_response","response":{"subtype":"success","request_id":"perm_1","response":{}}}`,
+	}, "\n") + "\n")
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("exit = %v, want status 3", err)
+	}
+
+	want := []string{
+		`{"response":{"request_id":"req_1","response":{"ok":true},"subtype":"success"},"type":"control_response"}`,
+		`{"response":{"error":"nothing to interrupt","request_id":"req_3","subtype":"error"},"type":"control_response"}`,
+		`{"type":"control_request","request_id":"perm_1","request":{"subtype":"can_use_tool"}}`,
+		`{"type":"result"}`,
+	}
+	if got := strings.Split(strings.TrimSpace(string(out)), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("output =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := cli.Received(); len(got) != 5 {
+		t.Errorf("Received() = %q, want all 5 lines", got)
+	}
+}
+
+func TestNew_ArgsAndPID(t *testing.T) {
+	cli := New(t, Scenario{})
+	if cli.Args() != nil || cli.PID() != 0 {
+		t.Fatalf("Args() = %q, PID() = %d before the CLI ran", cli.Args(), cli.PID())
+	}
+	if err := exec.Command(cli.Path, "--version").Run(); err != nil {
+		t.Fatalf("--version failed: %v", err)
+	}
+	if cli.Args() != nil {
+		t.Errorf("Args() = %q after a version probe, want nil", cli.Args())
+	}
+
+	cmd := exec.Command(cli.Path, "--model", "m", "--print")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if got := strings.Join(cli.Args(), " "); got != "--model m --print" {
+		t.Errorf("Args() = %q", got)
+	}
+	if got := cli.PID(); got != cmd.Process.Pid {
+		t.Errorf("PID() = %d, want %d", got, cmd.Process.Pid)
+	}
+}
+
+func TestNew_FailRuns(t *testing.T) {
+	cli := New(t, Scenario{FailRuns: 2})
+	if err := exec.Command(cli.Path, "--version").Run(); err != nil {
+		t.Fatalf("--version failed: %v", err)
+	}
+	for run := 1; run <= 3; run++ {
+		err := exec.Command(cli.Path, "--print").Run()
+		if failed := err != nil; failed != (run <= 2) {
+			t.Errorf("run %d error = %v", run, err)
+		}
+	}
+	if got := cli.Runs(); got != 3 {
+		t.Errorf("Runs() = %d, want 3", got)
+	}
+}
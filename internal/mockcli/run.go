@@ -0,0 +1,310 @@
+package mockcli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func init() {
+	if len(os.Args) == 0 {
+		return
+	}
+	data, err := os.ReadFile(os.Args[0] + scenarioSuffix)
+	if err != nil {
+		return // Not started as a mock CLI
+	}
+	var s script
+	if err := json.Unmarshal(data, &s); err != nil {
+		fmt.Fprintf(os.Stderr, "mockcli: invalid scenario: %v\n", err)
+		exit(2)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "--version" {
+		time.Sleep(s.VersionDelay)
+		fmt.Println(s.Version)
+		exit(0)
+	}
+	if s.Args != "" {
+		data, _ := json.Marshal(os.Args[1:])
+		_ = os.WriteFile(s.Args, data, 0600)
+	}
+	if s.PID != "" {
+		// Written last, so that a test seeing the PID also sees the arguments
+		_ = os.WriteFile(s.PID, []byte(strconv.Itoa(os.Getpid())), 0600)
+	}
+	if s.Runs != "" && countRun(s.Runs) <= s.FailRuns {
+		fmt.Fprintln(os.Stderr, "mockcli: failing this run as scripted")
+		exit(1)
+	}
+	exit(newPlayer(s).run())
+}
+
+// countRun records a run of the CLI in path and returns how many runs it
+// records, this one included.
+func countRun(path string) int {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	_, _ = f.Write([]byte{'.'})
+	info, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	return int(info.Size())
+}
+
+// exit ends the CLI at once. Unlike os.Exit it skips the race detector's
+// report at exit, which in race-enabled test binaries waits a second and
+// would make every mock CLI that slow to finish.
+func exit(code int) {
+	syscall.Exit(code)
+}
+
+// player plays a scenario as the CLI process.
+type player struct {
+	script
+	unanswered map[string]bool
+
+	outMu sync.Mutex // serializes writes to stdout
+	out   *os.File
+
+	prompts   chan string
+	responses chan string   // request IDs of control responses from the SDK
+	eof       chan struct{} // closed when stdin ends
+	answered  map[string]bool
+
+	requestMu sync.Mutex
+	requested map[string]int // answered requests by subtype, not yet awaited
+	requestCh chan struct{}  // signalled when requested grows
+}
+
+func newPlayer(s script) *player {
+	p := &player{
+		script:     s,
+		unanswered: make(map[string]bool),
+		out:        os.Stdout,
+		prompts:    make(chan string, 1024),
+		responses:  make(chan string, 1024),
+		eof:        make(chan struct{}),
+		answered:   make(map[string]bool),
+		requested:  make(map[string]int),
+		requestCh:  make(chan struct{}, 1),
+	}
+	for _, subtype := range s.Unanswered {
+		p.unanswered[subtype] = true
+	}
+	return p
+}
+
+// run reads stdin in the background and plays the steps, returning the
+// exit status.
+func (p *player) run() int {
+	go p.read()
+
+	for _, step := range p.Steps {
+		switch step.Action {
+		case actionSend:
+			p.send(step.Lines...)
+		case actionStderr:
+			for _, line := range step.Lines {
+				fmt.Fprintln(os.Stderr, line)
+			}
+		case actionAwaitPrompt:
+			if !p.awaitPrompt() {
+				return 0
+			}
+		case actionAwaitResponse:
+			if !p.awaitResponse(step.ID) {
+				return 0
+			}
+		case actionAwaitRequest:
+			if !p.awaitRequest(step.ID) {
+				return 0
+			}
+		case actionAwaitInputClosed:
+			<-p.eof
+		case actionDelay:
+			time.Sleep(step.Delay)
+		case actionExit:
+			return step.Code
+		case actionCloseOutput:
+			p.outMu.Lock()
+			_ = p.out.Close()
+			p.outMu.Unlock()
+		case actionHang:
+			// Sleep rather than block forever, which the runtime would
+			// report as a deadlock once stdin has ended
+			for {
+				time.Sleep(time.Hour)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "mockcli: unknown step %q\n", step.Action)
+			return 2
+		}
+	}
+
+	for p.awaitPrompt() {
+		p.send(p.EachPrompt...)
+	}
+	return 0
+}
+
+// awaitPrompt waits for the next prompt. It returns false once stdin has
+// ended and every prompt read before that has been taken.
+func (p *player) awaitPrompt() bool {
+	select {
+	case <-p.prompts:
+		return true
+	case <-p.eof:
+	}
+	select {
+	case <-p.prompts:
+		return true
+	default:
+		return false
+	}
+}
+
+// awaitResponse waits for the control response to requestID, remembering
+// the others for later steps. It returns false if stdin ends first.
+func (p *player) awaitResponse(requestID string) bool {
+	for !p.answered[requestID] {
+		select {
+		case id := <-p.responses:
+			p.answered[id] = true
+		case <-p.eof:
+			// Take the responses read before stdin ended
+			for {
+				select {
+				case id := <-p.responses:
+					p.answered[id] = true
+				default:
+					return p.answered[requestID]
+				}
+			}
+		}
+	}
+	return true
+}
+
+// awaitRequest waits until a control request of the given subtype has been
+// answered and takes it. It returns false if stdin ends first.
+func (p *player) awaitRequest(subtype string) bool {
+	for {
+		if p.takeRequest(subtype) {
+			return true
+		}
+		select {
+		case <-p.requestCh:
+		case <-p.eof:
+			// The request may have been read just before stdin ended
+			return p.takeRequest(subtype)
+		}
+	}
+}
+
+// takeRequest takes an answered request of the given subtype, if any.
+func (p *player) takeRequest(subtype string) bool {
+	p.requestMu.Lock()
+	defer p.requestMu.Unlock()
+
+	if p.requested[subtype] == 0 {
+		return false
+	}
+	p.requested[subtype]--
+	return true
+}
+
+// read records each line from the SDK, answers control requests, and
+// queues prompts and control responses for the steps.
+func (p *player) read() {
+	defer close(p.eof)
+
+	var received *os.File
+	if p.Received != "" {
+		received, _ = os.OpenFile(p.Received, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if received != nil {
+			defer received.Close()
+		}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if received != nil {
+			_, _ = received.WriteString(line + "\n")
+		}
+
+		var msg struct {
+			Type      string `json:"type"`
+			RequestID string `json:"request_id"`
+			Request   struct {
+				Subtype string `json:"subtype"`
+			} `json:"request"`
+			Response struct {
+				RequestID string `json:"request_id"`
+			} `json:"response"`
+		}
+		_ = json.Unmarshal([]byte(line), &msg)
+		switch msg.Type {
+		case "control_request":
+			p.answer(msg.RequestID, msg.Request.Subtype)
+			p.requestMu.Lock()
+			p.requested[msg.Request.Subtype]++
+			p.requestMu.Unlock()
+			select {
+			case p.requestCh <- struct{}{}:
+			default:
+			}
+		case "control_response":
+			p.responses <- msg.Response.RequestID
+		default:
+			p.prompts <- line
+		}
+	}
+}
+
+// answer sends the scenario's response to a control request from the SDK.
+func (p *player) answer(requestID, subtype string) {
+	if p.unanswered[subtype] {
+		return
+	}
+	response := map[string]interface{}{
+		"subtype":    "success",
+		"request_id": requestID,
+	}
+	if message, ok := p.ControlErrors[subtype]; ok {
+		response["subtype"] = "error"
+		response["error"] = message
+	} else if payload, ok := p.ControlResponses[subtype]; ok {
+		response["response"] = payload
+	} else {
+		response["response"] = map[string]interface{}{}
+	}
+	line, _ := json.Marshal(map[string]interface{}{
+		"type":     "control_response",
+		"response": response,
+	})
+	p.send(string(line))
+}
+
+// send writes lines to stdout, keeping each whole.
+func (p *player) send(lines ...string) {
+	p.outMu.Lock()
+	defer p.outMu.Unlock()
+
+	for _, line := range lines {
+		_, _ = p.out.WriteString(line + "\n")
+	}
+}
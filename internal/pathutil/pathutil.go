@@ -0,0 +1,59 @@
+// Package pathutil decides whether file paths lie inside a directory, the
+// containment check shared by PermissionPolicy.DenyPathsOutsideCWD and
+// WithAllowedRoots.
+package pathutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// FoldCase reports whether paths are compared case-insensitively, as the
+// default filesystems on macOS and Windows do.
+var FoldCase = runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+
+// EvalSymlinksExisting resolves the symlinks in the longest prefix of the
+// absolute path that exists and appends the rest, which cannot contain any.
+// The path is not cleaned first, so ".." after a symlink climbs out of the
+// link's target like the filesystem does.
+func EvalSymlinksExisting(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	for i := len(path) - 1; i > 0; i-- {
+		if !os.IsPathSeparator(path[i]) {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(path[:i]); err == nil {
+			return filepath.Join(resolved, path[i+1:])
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// Within reports whether path is root or lies beneath it. Both must be
+// clean absolute paths; fold compares them case-insensitively.
+func Within(path, root string, fold bool) bool {
+	if fold {
+		path, root = strings.ToLower(path), strings.ToLower(root)
+	}
+	if path == root {
+		return true
+	}
+	if !strings.HasSuffix(root, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, root)
+}
+
+// Contains reports whether path, joined to the absolute directory dir if
+// relative, is dir itself or inside it once the symlinks of both are
+// resolved, so a link inside dir pointing elsewhere is outside.
+func Contains(dir, path string) bool {
+	if !filepath.IsAbs(path) {
+		path = dir + string(filepath.Separator) + path
+	}
+	return Within(EvalSymlinksExisting(path), EvalSymlinksExisting(dir), FoldCase)
+}
@@ -0,0 +1,66 @@
+package pathutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWithin tests containment, including the root itself and case folding.
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		root string
+		fold bool
+		want bool
+	}{
+		{"root itself", "/srv/app", "/srv/app", false, true},
+		{"child", "/srv/app/src/main.go", "/srv/app", false, true},
+		{"sibling with common prefix", "/srv/application", "/srv/app", false, false},
+		{"parent", "/srv", "/srv/app", false, false},
+		{"filesystem root", "/etc", "/", false, true},
+		{"case differs, case-sensitive", "/SRV/App/src", "/srv/app", false, false},
+		{"case differs, case-insensitive", "/SRV/App/src", "/srv/app", true, true},
+		{"case-insensitive sibling", "/SRV/Application", "/srv/app", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.FromSlash(tt.path)
+			root := filepath.FromSlash(tt.root)
+			if got := Within(path, root, tt.fold); got != tt.want {
+				t.Errorf("Within(%q, %q, %v) = %v, want %v", path, root, tt.fold, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalSymlinksExisting(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "target", "nested")
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name, path, want string
+	}{
+		{"existing", "link", target},
+		{"missing tail", "link/new/file.go", filepath.Join(target, "new", "file.go")},
+		{"dot-dot after link", "link/../x", filepath.Join(root, "target", "x")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := root + string(filepath.Separator) + filepath.FromSlash(tt.path)
+			if got := EvalSymlinksExisting(path); got != tt.want {
+				t.Errorf("EvalSymlinksExisting(%q) = %q, want %q", path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultPausedHookDeadline is how long a hook callback is held before it is
+// answered as async, inside the CLI's default hook timeout of 60 seconds.
+const defaultPausedHookDeadline = 50 * time.Second
+
+// pauseGate holds permission and hook requests from the CLI while the
+// session is paused.
+type pauseGate struct {
+	mu     sync.Mutex
+	paused bool
+	held   []*heldRequest // in arrival order
+
+	// How long a hook callback is held before it is answered as async
+	// (0 uses defaultPausedHookDeadline)
+	hookDeadline time.Duration
+}
+
+// heldRequest is a request waiting for Resume. Resume closes release and
+// waits for done, which the handler closes once it has answered. Both
+// flags are guarded by pauseGate.mu.
+type heldRequest struct {
+	release  chan struct{}
+	done     chan struct{}
+	released bool // the handler has taken the request back
+	async    bool // answered as async before it was released
+}
+
+// Pause holds can_use_tool and hook_callback requests that arrive from now
+// on, without answering them, until Resume. Requests already being handled
+// are answered as usual. Other control requests, such as MCP messages, are
+// not held.
+//
+// The CLI gives up on a hook callback that goes unanswered for its hook
+// timeout, so a hook callback still held after the pause's hook deadline is
+// answered {"async": true}: the CLI goes on without its output, and the
+// callback runs on Resume with its output dropped. Permission requests have
+// no such timeout and stay held.
+func (q *Query) Pause() {
+	q.pause.mu.Lock()
+	defer q.pause.mu.Unlock()
+	q.pause.paused = true
+}
+
+// Resume stops holding new requests and releases the held ones one at a
+// time in the order they arrived, each once the previous one is answered,
+// so that the CLI gets the answers in order. It returns when all are
+// answered or the query stops. If ctx is done first, the remaining requests
+// are released at once and ctx's error is returned.
+func (q *Query) Resume(ctx context.Context) error {
+	q.pause.mu.Lock()
+	held := q.pause.held
+	q.pause.held = nil
+	q.pause.paused = false
+	q.pause.mu.Unlock()
+
+	for i, h := range held {
+		close(h.release)
+		select {
+		case <-h.done:
+			continue
+		case <-q.stopChan:
+		case <-ctx.Done():
+		}
+		for _, rest := range held[i+1:] {
+			close(rest.release)
+		}
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Paused reports whether the query is holding requests.
+func (q *Query) Paused() bool {
+	q.pause.mu.Lock()
+	defer q.pause.mu.Unlock()
+	return q.pause.paused
+}
+
+// pausable reports whether requests of subtype wait while paused: those
+// that ask the SDK for a decision.
+func pausable(subtype string) bool {
+	return subtype == "can_use_tool" || subtype == "hook_callback"
+}
+
+// awaitResume blocks while the query is paused. It returns false if the
+// query stops first, in which case the request is not answered. Otherwise
+// the caller must call the returned function once it has handled the
+// request, and must not answer it if async is true: it was answered as
+// async while held.
+func (q *Query) awaitResume(subtype, requestID string) (answered func(), async bool, ok bool) {
+	q.pause.mu.Lock()
+	if !q.pause.paused {
+		q.pause.mu.Unlock()
+		return func() {}, false, true
+	}
+	h := &heldRequest{release: make(chan struct{}), done: make(chan struct{})}
+	q.pause.held = append(q.pause.held, h)
+	deadline := q.pause.hookDeadline
+	if deadline <= 0 {
+		deadline = defaultPausedHookDeadline
+	}
+	q.pause.mu.Unlock()
+
+	q.logger.Info("claude: control request from CLI held while paused", "subtype", subtype, "request_id", requestID)
+	if subtype == "hook_callback" {
+		timer := time.AfterFunc(deadline, func() { q.answerHeldAsync(h, requestID) })
+		defer timer.Stop()
+	}
+
+	select {
+	case <-h.release:
+	case <-q.stopChan:
+		return nil, false, false
+	}
+
+	q.pause.mu.Lock()
+	h.released = true
+	async = h.async
+	q.pause.mu.Unlock()
+	return func() { close(h.done) }, async, true
+}
+
+// answerHeldAsync answers a hook callback that is still held with
+// {"async": true}, before the CLI's hook timeout gives up on it.
+func (q *Query) answerHeldAsync(h *heldRequest, requestID string) {
+	q.pause.mu.Lock()
+	if h.released {
+		q.pause.mu.Unlock()
+		return
+	}
+	h.async = true
+	q.pause.mu.Unlock()
+
+	q.logger.Info("claude: hook callback held while paused answered as async", "request_id", requestID)
+	q.sendSuccessResponse(requestID, map[string]interface{}{"async": true})
+}
+
+// heldRequests returns how many requests are waiting for Resume.
+func (q *Query) heldRequests() int {
+	q.pause.mu.Lock()
+	defer q.pause.mu.Unlock()
+	return len(q.pause.held)
+}
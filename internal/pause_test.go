@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestPause_HookAnsweredAsyncAtDeadline tests that a hook callback held past
+// the hook deadline is answered async exactly once, and that its callback
+// still runs on Resume without a second answer.
+func TestPause_HookAnsweredAsyncAtDeadline(t *testing.T) {
+	transport := newMockTransport()
+	q := newTestQuery(context.Background(), transport, nil, true)
+	q.pause.hookDeadline = 20 * time.Millisecond
+
+	var calls atomic.Int32
+	callbackID := q.registerHookCallback(func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		calls.Add(1)
+		return map[string]interface{}{}, nil
+	})
+
+	q.Pause()
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		q.handleControlRequest(&types.SystemMessage{
+			Type: "control_request",
+			Data: map[string]interface{}{"request_id": "req_hook", "request": map[string]interface{}{
+				"subtype":     "hook_callback",
+				"callback_id": callbackID,
+				"input":       map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Bash"},
+			}},
+		})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(transport.getWrittenData()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("held hook callback was not answered at the deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if calls.Load() != 0 {
+		t.Fatal("hook callback ran while paused")
+	}
+
+	var envelope struct {
+		Response wireResponse `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(transport.getWrittenData()[0]), &envelope); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if envelope.Response.Subtype != "success" || envelope.Response.Response["async"] != true {
+		t.Errorf("expected an async success response, got %+v", envelope.Response)
+	}
+
+	if err := q.Resume(context.Background()); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	<-handled
+	if calls.Load() != 1 {
+		t.Errorf("expected the hook callback to run once on Resume, ran %d times", calls.Load())
+	}
+	if written := transport.getWrittenData(); len(written) != 1 {
+		t.Errorf("expected a single answer, got %d: %v", len(written), written)
+	}
+}
+
+// TestPause_PermissionNotAnsweredAtDeadline tests that permission requests
+// stay held past the hook deadline.
+func TestPause_PermissionNotAnsweredAtDeadline(t *testing.T) {
+	transport := newMockTransport()
+	opts := types.NewClaudeAgentOptions().WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+		return types.PermissionResultAllow{}, nil
+	})
+	q := newTestQuery(context.Background(), transport, opts, true)
+	q.pause.hookDeadline = 10 * time.Millisecond
+
+	q.Pause()
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		q.handleControlRequest(&types.SystemMessage{
+			Type: "control_request",
+			Data: map[string]interface{}{"request_id": "req_perm", "request": map[string]interface{}{
+				"subtype":   "can_use_tool",
+				"tool_name": "Bash",
+				"input":     map[string]interface{}{"command": "ls"},
+			}},
+		})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if written := transport.getWrittenData(); len(written) != 0 {
+		t.Fatalf("permission request answered while paused: %v", written)
+	}
+	if err := q.Resume(context.Background()); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	<-handled
+	if written := transport.getWrittenData(); len(written) != 1 {
+		t.Errorf("expected one answer after Resume, got %d", len(written))
+	}
+}
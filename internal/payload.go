@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"encoding/json"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// callbackInput decodes the input of a hook or permission request for its
+// callback. The transport leaves an input over the limit undecoded, as a
+// json.RawMessage (see types.DecodeOptions.MaxControlInput): each of its
+// top-level fields within the limit is decoded as usual, and each larger one
+// is truncated or left raw as the policy says. An input already decoded is
+// returned unchanged.
+func (q *Query) callbackInput(input interface{}) (interface{}, error) {
+	raw, ok := input.(json.RawMessage)
+	if !ok {
+		return input, nil
+	}
+	if q.maxCallbackPayload <= 0 || len(raw) <= q.maxCallbackPayload {
+		var decoded interface{}
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return nil, types.NewControlProtocolErrorWithCause("cannot decode callback input", err)
+		}
+		return decoded, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+		return q.limitField(raw), nil
+	}
+	decoded := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if len(value) <= q.maxCallbackPayload {
+			var v interface{}
+			if err := json.Unmarshal(value, &v); err != nil {
+				return nil, types.NewControlProtocolErrorWithCause("cannot decode callback input", err)
+			}
+			decoded[key] = v
+			continue
+		}
+		decoded[key] = q.limitField(value)
+	}
+	return decoded, nil
+}
+
+// limitField returns an oversized input field as the callback payload
+// policy says: undecoded, or truncated to about the limit.
+func (q *Query) limitField(raw json.RawMessage) interface{} {
+	if q.callbackPayloadPolicy == types.CallbackPayloadRaw {
+		return raw
+	}
+	budget := q.maxCallbackPayload
+	return truncateJSON(raw, &budget)
+}
+
+// hasRawFields reports whether the policy left a field of input undecoded.
+func hasRawFields(input interface{}) bool {
+	fields, _ := input.(map[string]interface{})
+	for _, value := range fields {
+		if _, ok := value.(json.RawMessage); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateJSON decodes raw, spending budget on the bytes of its strings and
+// scalars in order, object members by key. Once budget is spent, strings are
+// cut short and arrays cut off, ending in types.TruncatedMarker.
+func truncateJSON(raw json.RawMessage, budget *int) interface{} {
+	switch firstByte(raw) {
+	case '{':
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(raw, &fields) != nil {
+			return nil
+		}
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		object := make(map[string]interface{}, len(fields))
+		for _, key := range keys {
+			object[key] = truncateJSON(fields[key], budget)
+		}
+		return object
+	case '[':
+		var elements []json.RawMessage
+		if json.Unmarshal(raw, &elements) != nil {
+			return nil
+		}
+		array := make([]interface{}, 0, len(elements))
+		for _, element := range elements {
+			if *budget <= 0 {
+				return append(array, types.TruncatedMarker)
+			}
+			array = append(array, truncateJSON(element, budget))
+		}
+		return array
+	case '"':
+		var s string
+		if json.Unmarshal(raw, &s) != nil {
+			return nil
+		}
+		if len(s) <= *budget {
+			*budget -= len(s)
+			return s
+		}
+		cut := max(*budget, 0)
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		*budget = 0
+		return s[:cut] + types.TruncatedMarker // A new string, so s can be freed
+	default:
+		var value interface{}
+		if json.Unmarshal(raw, &value) != nil {
+			return nil
+		}
+		*budget -= len(raw)
+		return value
+	}
+}
+
+// firstByte returns the first byte of raw that is not whitespace.
+func firstByte(raw json.RawMessage) byte {
+	for _, b := range raw {
+		switch b {
+		case ' ', '\t', '\n', '\r':
+		default:
+			return b
+		}
+	}
+	return 0
+}
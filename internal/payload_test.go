@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+const payloadLimit = 1024
+
+// oversizedResponse is the tool_response of a Bash call whose stdout is far
+// over payloadLimit.
+var oversizedResponse = fmt.Sprintf(`{"stdout":%q,"stderr":"","interrupted":false}`,
+	strings.Repeat("line of build output\n", 5000))
+
+// decodeControlRequest decodes line as the transport does under
+// payloadLimit and returns its request.
+func decodeControlRequest(t *testing.T, line string) map[string]interface{} {
+	t.Helper()
+	msg, err := types.UnmarshalMessageWithOptions([]byte(line), types.DecodeOptions{MaxControlInput: payloadLimit})
+	if err != nil {
+		t.Fatalf("UnmarshalMessageWithOptions failed: %v", err)
+	}
+	request, _ := msg.(*types.SystemMessage).Data["request"].(map[string]interface{})
+	if _, ok := request["input"].(json.RawMessage); !ok {
+		t.Fatalf("input = %T, want it left undecoded", request["input"])
+	}
+	return request
+}
+
+// runPostToolUseHook answers a PostToolUse hook_callback request carrying
+// oversizedResponse, returning the input and context the hook received.
+func runPostToolUseHook(t *testing.T, opts *types.ClaudeAgentOptions) (map[string]interface{}, types.HookContext) {
+	t.Helper()
+	query := newTestQuery(context.Background(), newMockTransport(), opts, true)
+
+	var input map[string]interface{}
+	var hookCtx types.HookContext
+	id := query.registerHookCallback(func(ctx context.Context, in interface{}, toolUseID *string, c types.HookContext) (interface{}, error) {
+		input, _ = in.(map[string]interface{})
+		hookCtx = c
+		return map[string]interface{}{}, nil
+	})
+
+	request := decodeControlRequest(t, fmt.Sprintf(`{"type":"control_request","request_id":"req_1","request":`+
+		`{"subtype":"hook_callback","callback_id":%q,"tool_use_id":"toolu_1","input":`+
+		`{"hook_event_name":"PostToolUse","session_id":"s","tool_name":"Bash","tool_input":{"command":"make"},"tool_response":%s}}}`,
+		id, oversizedResponse))
+	if _, err := query.handleHookCallback(request); err != nil {
+		t.Fatalf("handleHookCallback failed: %v", err)
+	}
+	if input == nil {
+		t.Fatal("hook not called with a map input")
+	}
+	return input, hookCtx
+}
+
+func TestCallbackPayloadTruncated(t *testing.T) {
+	input, hookCtx := runPostToolUseHook(t, types.NewClaudeAgentOptions().WithMaxCallbackPayloadBytes(payloadLimit))
+
+	// Small fields arrive whole
+	if input["hook_event_name"] != "PostToolUse" || input["tool_name"] != "Bash" {
+		t.Errorf("input = %v, want the event and tool name", input)
+	}
+	if command, _ := input["tool_input"].(map[string]interface{})["command"]; command != "make" {
+		t.Errorf("tool_input = %v, want it whole", input["tool_input"])
+	}
+
+	// The tool response keeps its shape, with stdout cut short
+	response, ok := input["tool_response"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("tool_response = %T, want a map", input["tool_response"])
+	}
+	if response["interrupted"] != false || response["stderr"] != "" {
+		t.Errorf("tool_response = %v, want interrupted and stderr kept", response)
+	}
+	stdout, _ := response["stdout"].(string)
+	if !strings.HasSuffix(stdout, types.TruncatedMarker) {
+		t.Fatalf("stdout ends %q, want the truncation marker", stdout[max(len(stdout)-40, 0):])
+	}
+	if len(stdout) > payloadLimit+len(types.TruncatedMarker) || !strings.HasPrefix(stdout, "line of build output\n") {
+		t.Errorf("stdout is %d bytes, want its first %d at most", len(stdout), payloadLimit)
+	}
+
+	post, ok := hookCtx.Input.(*types.PostToolUseHookInput)
+	if !ok {
+		t.Fatalf("HookContext.Input = %T, want *types.PostToolUseHookInput", hookCtx.Input)
+	}
+	if post.ToolName != "Bash" {
+		t.Errorf("HookContext.Input.ToolName = %q, want Bash", post.ToolName)
+	}
+}
+
+func TestCallbackPayloadRaw(t *testing.T) {
+	input, hookCtx := runPostToolUseHook(t, types.NewClaudeAgentOptions().
+		WithMaxCallbackPayloadBytes(payloadLimit).
+		WithCallbackPayloadPolicy(types.CallbackPayloadRaw))
+
+	if input["hook_event_name"] != "PostToolUse" {
+		t.Errorf("hook_event_name = %v, want PostToolUse", input["hook_event_name"])
+	}
+	raw, ok := input["tool_response"].(json.RawMessage)
+	if !ok {
+		t.Fatalf("tool_response = %T, want json.RawMessage", input["tool_response"])
+	}
+	if string(raw) != oversizedResponse {
+		t.Error("tool_response differs from what the CLI sent")
+	}
+	if hookCtx.Input != nil {
+		t.Errorf("HookContext.Input = %T, want nil for an input with raw fields", hookCtx.Input)
+	}
+}
+
+func TestCallbackPayloadUnlimited(t *testing.T) {
+	input, _ := runPostToolUseHook(t, types.NewClaudeAgentOptions())
+
+	response, _ := input["tool_response"].(map[string]interface{})
+	if stdout, _ := response["stdout"].(string); strings.Contains(stdout, types.TruncatedMarker) || len(stdout) != 5000*len("line of build output\n") {
+		t.Errorf("stdout is %d bytes, want it whole", len(stdout))
+	}
+}
+
+func TestCallbackPayloadPermissionEcho(t *testing.T) {
+	content := strings.Repeat("x", 4*payloadLimit)
+	var got map[string]interface{}
+	opts := types.NewClaudeAgentOptions().
+		WithMaxCallbackPayloadBytes(payloadLimit).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			got = input
+			return &types.PermissionResultAllow{Behavior: "allow"}, nil
+		})
+	query := newTestQuery(context.Background(), newMockTransport(), opts, true)
+
+	input := fmt.Sprintf(`{"file_path":"/tmp/out.txt","content":%q}`, content)
+	request := decodeControlRequest(t, `{"type":"control_request","request_id":"req_1","request":`+
+		`{"subtype":"can_use_tool","tool_name":"Write","tool_use_id":"toolu_1","input":`+input+`}}`)
+	response, err := query.handlePermissionRequest(request)
+	if err != nil {
+		t.Fatalf("handlePermissionRequest failed: %v", err)
+	}
+
+	// The callback sees the content truncated
+	if got["file_path"] != "/tmp/out.txt" {
+		t.Errorf("file_path = %v, want it whole", got["file_path"])
+	}
+	if s, _ := got["content"].(string); !strings.HasSuffix(s, types.TruncatedMarker) {
+		t.Errorf("content = %.40q..., want it truncated", s)
+	}
+
+	// The CLI gets its input back unchanged
+	echoed, err := json.Marshal(response["updatedInput"])
+	if err != nil {
+		t.Fatalf("cannot encode updatedInput: %v", err)
+	}
+	if string(echoed) != input {
+		t.Errorf("updatedInput = %.80s..., want the input as sent", echoed)
+	}
+}
+
+func TestTruncateJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		budget int
+		want   string
+	}{
+		{"string within budget", `"hello"`, 5, `"hello"`},
+		{"string cut", `"hello world"`, 5, `"hello` + types.TruncatedMarker + `"`},
+		{"rune kept whole", `"héllo"`, 2, `"h` + types.TruncatedMarker + `"`},
+		{"array cut off", `["ab","cd","ef"]`, 4, `["ab","cd","` + types.TruncatedMarker + `"]`},
+		{"members in key order", `{"b":"later","a":"first"}`, 7, `{"a":"first","b":"la` + types.TruncatedMarker + `"}`},
+		{"scalars", `[1,true,null]`, 100, `[1,true,null]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := tt.budget
+			got, err := json.Marshal(truncateJSON(json.RawMessage(tt.raw), &budget))
+			if err != nil {
+				t.Fatalf("cannot encode result: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("truncateJSON(%s, %d) = %s, want %s", tt.raw, tt.budget, got, tt.want)
+			}
+		})
+	}
+}
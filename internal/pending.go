@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// abandonedPermissionMessage is the denial sent for an abandoned request.
+const abandonedPermissionMessage = "permission request abandoned by the application"
+
+// pendingPermission is a permission request waiting for its answer, from
+// the CanUseTool callback or from ResolvePermission or AbandonPermission,
+// whichever comes first.
+type pendingPermission struct {
+	seq      int
+	id       string
+	toolName string
+	input    map[string]interface{}
+	permCtx  types.ToolPermissionContext
+	received time.Time
+
+	// cancel cancels the callback's context once the request is answered
+	cancel context.CancelFunc
+
+	// answer receives the one answer; buffered so settling never blocks
+	answer chan permissionAnswer
+}
+
+// permissionAnswer is the result of a permission request, or the error to
+// answer it with.
+type permissionAnswer struct {
+	result types.PermissionResult
+	err    error
+}
+
+// decidePermission asks canUseTool about a tool use and waits for the
+// answer. The request is pending meanwhile: ResolvePermission and
+// AbandonPermission may answer it, and the first answer wins. A callback
+// returning types.ErrPermissionDeferred leaves the answer to them; the
+// context of a callback still running when they answer is cancelled, and
+// what it returns is ignored.
+func (q *Query) decidePermission(canUseTool types.CanUseToolFunc, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+	callbackCtx, cancel := context.WithCancel(q.ctx)
+	p := &pendingPermission{
+		toolName: toolName,
+		input:    input,
+		permCtx:  permCtx,
+		received: time.Now(),
+		cancel:   cancel,
+		answer:   make(chan permissionAnswer, 1),
+	}
+	q.addPendingPermission(p)
+
+	go func() {
+		result, err := canUseTool(callbackCtx, toolName, input, permCtx)
+		if errors.Is(err, types.ErrPermissionDeferred) {
+			q.logger.Info("claude: permission decision deferred", "permission_id", p.id, "tool_name", toolName)
+			return
+		}
+		q.settlePermission(p.id, permissionAnswer{result: result, err: err})
+	}()
+
+	select {
+	case a := <-p.answer:
+		return a.result, a.err
+	case <-q.stopChan:
+		q.settlePermission(p.id, permissionAnswer{})
+		return nil, types.NewControlProtocolError("query stopped before the permission request was answered")
+	}
+}
+
+// addPendingPermission gives p an ID and records it as pending.
+func (q *Query) addPendingPermission(p *pendingPermission) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextPermissionID++
+	p.seq = q.nextPermissionID
+	p.id = "perm_" + strconv.Itoa(p.seq)
+	if q.pendingPermissions == nil {
+		q.pendingPermissions = make(map[string]*pendingPermission)
+	}
+	q.pendingPermissions[p.id] = p
+}
+
+// settlePermission answers the pending request id with a, unless it has
+// been answered already. It reports whether a was the answer.
+func (q *Query) settlePermission(id string, a permissionAnswer) bool {
+	q.mu.Lock()
+	p, ok := q.pendingPermissions[id]
+	delete(q.pendingPermissions, id)
+	q.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	p.answer <- a
+	p.cancel()
+	return true
+}
+
+// PendingPermissions returns the permission requests waiting for an answer,
+// oldest first.
+func (q *Query) PendingPermissions() []types.PendingPermission {
+	q.mu.Lock()
+	pending := make([]*pendingPermission, 0, len(q.pendingPermissions))
+	for _, p := range q.pendingPermissions {
+		pending = append(pending, p)
+	}
+	q.mu.Unlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].seq < pending[j].seq })
+
+	now := time.Now()
+	out := make([]types.PendingPermission, 0, len(pending))
+	for _, p := range pending {
+		out = append(out, types.PendingPermission{
+			ID:       p.id,
+			ToolName: p.toolName,
+			Input:    p.input,
+			Context:  p.permCtx,
+			Received: p.received,
+			Age:      now.Sub(p.received),
+		})
+	}
+	return out
+}
+
+// ResolvePermission answers the pending permission request id with result,
+// in place of its callback. It reports false if the request is not pending:
+// it was answered already, by the callback or otherwise, or never existed.
+func (q *Query) ResolvePermission(id string, result types.PermissionResult) bool {
+	return q.settlePermission(id, permissionAnswer{result: result})
+}
+
+// SetAbandonedPolicy sets the policy that answers requests withdrawn with
+// AbandonPermission, in place of the permission mode.
+func (q *Query) SetAbandonedPolicy(evaluate func(toolName string, input map[string]interface{}) types.PermissionResult) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.abandonedPolicy = evaluate
+}
+
+// AbandonPermission withdraws the pending permission request id, answering
+// it with the abandoned policy if one is set, and otherwise as the current
+// permission mode would without a callback. It reports false if the request
+// is not pending.
+func (q *Query) AbandonPermission(id string) bool {
+	q.mu.Lock()
+	p, ok := q.pendingPermissions[id]
+	evaluate := q.abandonedPolicy
+	mode := q.permissionMode
+	q.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	var result types.PermissionResult
+	if evaluate != nil {
+		result = evaluate(p.toolName, p.input)
+	} else {
+		result = modeDecision(mode, p.toolName)
+	}
+	return q.settlePermission(id, permissionAnswer{result: result})
+}
+
+// modeDecision answers a tool use as permission mode does when no callback
+// decides: bypassPermissions allows everything and acceptEdits file edits;
+// the CLI would otherwise ask, and with no one to ask, the tool use is denied.
+func modeDecision(mode types.PermissionMode, toolName string) types.PermissionResult {
+	switch {
+	case mode == types.PermissionModeBypassPermissions:
+		return &types.PermissionResultAllow{}
+	case mode == types.PermissionModeAcceptEdits && editTools[toolName]:
+		return &types.PermissionResultAllow{}
+	default:
+		return &types.PermissionResultDeny{Message: abandonedPermissionMessage}
+	}
+}
+
+// editTools are the tools acceptEdits allows without asking.
+var editTools = map[string]bool{"Edit": true, "MultiEdit": true, "Write": true, "NotebookEdit": true}
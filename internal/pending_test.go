@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// permissionRequest is a can_use_tool request for Bash.
+func permissionRequest() map[string]interface{} {
+	return map[string]interface{}{
+		"subtype":     "can_use_tool",
+		"tool_name":   "Bash",
+		"tool_use_id": "toolu_1",
+		"input":       map[string]interface{}{"command": "rm -rf build"},
+	}
+}
+
+// answered is the outcome of a permission request handled in the background.
+type answered struct {
+	response map[string]interface{}
+	err      error
+}
+
+// handleInBackground handles a permission request on query without waiting
+// for the answer.
+func handleInBackground(query *Query) <-chan answered {
+	done := make(chan answered, 1)
+	go func() {
+		response, err := query.handlePermissionRequest(permissionRequest())
+		done <- answered{response, err}
+	}()
+	return done
+}
+
+// onePending waits for query to have a single pending permission request
+// and returns it.
+func onePending(t *testing.T, query *Query) types.PendingPermission {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if pending := query.PendingPermissions(); len(pending) == 1 {
+			return pending[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending = %+v, want one request", query.PendingPermissions())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// deferringOpts defers every permission decision.
+func deferringOpts() *types.ClaudeAgentOptions {
+	return types.NewClaudeAgentOptions().WithCanUseTool(
+		func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return nil, types.ErrPermissionDeferred
+		})
+}
+
+func TestPendingPermissionResolved(t *testing.T) {
+	query := newTestQuery(context.Background(), newMockTransport(), deferringOpts(), true)
+	done := handleInBackground(query)
+
+	pending := onePending(t, query)
+	if pending.ID == "" || pending.ToolName != "Bash" || pending.Input["command"] != "rm -rf build" {
+		t.Errorf("pending = %+v, want the Bash request", pending)
+	}
+	if pending.Context.ToolUseID != "toolu_1" || pending.Received.IsZero() || pending.Age < 0 {
+		t.Errorf("pending = %+v, want its context and arrival time", pending)
+	}
+
+	if !query.ResolvePermission(pending.ID, &types.PermissionResultAllow{}) {
+		t.Fatal("ResolvePermission = false for a pending request")
+	}
+	got := <-done
+	if got.err != nil || got.response["behavior"] != "allow" {
+		t.Fatalf("answer = %v, %v, want allow", got.response, got.err)
+	}
+	if got.response["updatedInput"] == nil {
+		t.Error("allow does not echo the input")
+	}
+
+	// Answered once only
+	if query.ResolvePermission(pending.ID, &types.PermissionResultDeny{}) || query.AbandonPermission(pending.ID) {
+		t.Error("answered request still pending")
+	}
+	if n := len(query.PendingPermissions()); n != 0 {
+		t.Errorf("%d requests pending, want none", n)
+	}
+}
+
+func TestPendingPermissionAbandoned(t *testing.T) {
+	query := newTestQuery(context.Background(), newMockTransport(), deferringOpts(), true)
+	done := handleInBackground(query)
+
+	if !query.AbandonPermission(onePending(t, query).ID) {
+		t.Fatal("AbandonPermission = false for a pending request")
+	}
+	got := <-done
+	if got.err != nil || got.response["behavior"] != "deny" || got.response["message"] != abandonedPermissionMessage {
+		t.Errorf("answer = %v, %v, want a denial saying it was abandoned", got.response, got.err)
+	}
+}
+
+func TestPendingPermissionAbandonedByMode(t *testing.T) {
+	tests := []struct {
+		mode types.PermissionMode
+		want string
+	}{
+		{types.PermissionModeBypassPermissions, "allow"},
+		{types.PermissionModeAcceptEdits, "deny"}, // Bash is not a file edit
+		{types.PermissionModePlan, "deny"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			query := newTestQuery(context.Background(), newMockTransport(), deferringOpts().WithPermissionMode(tt.mode), true)
+			done := handleInBackground(query)
+
+			if !query.AbandonPermission(onePending(t, query).ID) {
+				t.Fatal("AbandonPermission = false for a pending request")
+			}
+			got := <-done
+			if got.err != nil || got.response["behavior"] != tt.want {
+				t.Fatalf("answer = %v, %v, want %s", got.response, got.err, tt.want)
+			}
+			if tt.want == "allow" && got.response["updatedInput"] == nil {
+				t.Error("allow does not echo the input")
+			}
+		})
+	}
+}
+
+func TestPendingPermissionAbandonedByPolicy(t *testing.T) {
+	query := newTestQuery(context.Background(), newMockTransport(), deferringOpts(), true)
+	var gotTool string
+	query.SetAbandonedPolicy(func(toolName string, input map[string]interface{}) types.PermissionResult {
+		gotTool = toolName
+		return &types.PermissionResultAllow{}
+	})
+	done := handleInBackground(query)
+
+	if !query.AbandonPermission(onePending(t, query).ID) {
+		t.Fatal("AbandonPermission = false for a pending request")
+	}
+	if got := <-done; got.err != nil || got.response["behavior"] != "allow" {
+		t.Errorf("answer = %v, %v, want the policy's allow", got.response, got.err)
+	}
+	if gotTool != "Bash" {
+		t.Errorf("policy evaluated %q, want Bash", gotTool)
+	}
+}
+
+func TestPendingPermissionResolvedWhileCallbackRuns(t *testing.T) {
+	cancelled := make(chan struct{})
+	opts := types.NewClaudeAgentOptions().WithCanUseTool(
+		func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			<-ctx.Done()
+			close(cancelled)
+			// Too late: the out-of-band answer won
+			return &types.PermissionResultAllow{}, nil
+		})
+	query := newTestQuery(context.Background(), newMockTransport(), opts, true)
+	done := handleInBackground(query)
+
+	if !query.ResolvePermission(onePending(t, query).ID, &types.PermissionResultDeny{Message: "user said no"}) {
+		t.Fatal("ResolvePermission = false while the callback runs")
+	}
+	got := <-done
+	if got.err != nil || got.response["behavior"] != "deny" {
+		t.Errorf("answer = %v, %v, want the out-of-band denial", got.response, got.err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback context not cancelled")
+	}
+}
+
+func TestPendingPermissionCallbackFirst(t *testing.T) {
+	query := newTestQuery(context.Background(), newMockTransport(), types.NewClaudeAgentOptions().WithCanUseTool(
+		func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return &types.PermissionResultAllow{}, nil
+		}), true)
+
+	got := <-handleInBackground(query)
+	if got.err != nil || got.response["behavior"] != "allow" {
+		t.Fatalf("answer = %v, %v, want the callback's allow", got.response, got.err)
+	}
+	if query.ResolvePermission("perm_1", &types.PermissionResultDeny{}) {
+		t.Error("ResolvePermission = true after the callback answered")
+	}
+}
+
+// TestPendingPermissionRace races the callback's answer against
+// ResolvePermission: exactly one wins, and the CLI gets the winner's.
+func TestPendingPermissionRace(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		release := make(chan struct{})
+		query := newTestQuery(context.Background(), newMockTransport(), types.NewClaudeAgentOptions().WithCanUseTool(
+			func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+				<-release
+				return &types.PermissionResultAllow{}, nil
+			}), true)
+		done := handleInBackground(query)
+		id := onePending(t, query).ID
+
+		var resolved bool
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resolved = query.ResolvePermission(id, &types.PermissionResultDeny{Message: "out of band"})
+		}()
+		close(release)
+		wg.Wait()
+
+		got := <-done
+		if got.err != nil {
+			t.Fatalf("round %d: handlePermissionRequest failed: %v", i, got.err)
+		}
+		want := "allow"
+		if resolved {
+			want = "deny"
+		}
+		if got.response["behavior"] != want {
+			t.Fatalf("round %d: ResolvePermission = %v but the CLI got %v", i, resolved, got.response["behavior"])
+		}
+	}
+}
+
+func TestPendingPermissionQueryStopped(t *testing.T) {
+	query := newTestQuery(context.Background(), newMockTransport(), deferringOpts(), true)
+	if err := query.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	done := handleInBackground(query)
+	onePending(t, query)
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := query.Stop(stopCtx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	select {
+	case got := <-done:
+		if got.err == nil {
+			t.Errorf("answer = %v, want an error once the query stopped", got.response)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("permission request still waiting after Stop")
+	}
+	if n := len(query.PendingPermissions()); n != 0 {
+		t.Errorf("%d requests pending after Stop, want none", n)
+	}
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"encoding/json"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// maxPendingHookDecisions bounds the hook decisions kept for permission
+// requests that may never arrive because the CLI honored the hook directly.
+const maxPendingHookDecisions = 128
+
+// hookDecision is an allow or deny returned by a PreToolUse hook, kept so a
+// later permission request for the same tool use gets the same answer.
+type hookDecision struct {
+	behavior     string
+	reason       string
+	updatedInput map[string]interface{}
+	keys         []string
+}
+
+// toolUseKeys returns the keys identifying a tool use: its ID when known,
+// and its name and input, since permission requests may lack the ID.
+func toolUseKeys(toolUseID, toolName string, input map[string]interface{}) []string {
+	var keys []string
+	if toolUseID != "" {
+		keys = append(keys, "id:"+toolUseID)
+	}
+	if toolName != "" {
+		data, _ := json.Marshal(input) // map keys are sorted, so this is canonical
+		keys = append(keys, "tool:"+toolName+":"+string(data))
+	}
+	return keys
+}
+
+// hookSpecificOutput returns the hookSpecificOutput of a hook response as a
+// map, converting typed outputs such as PreToolUseHookSpecificOutput.
+func hookSpecificOutput(response map[string]interface{}) map[string]interface{} {
+	switch out := response["hookSpecificOutput"].(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return out
+	default:
+		data, err := json.Marshal(out)
+		if err != nil {
+			return nil
+		}
+		var m map[string]interface{}
+		if json.Unmarshal(data, &m) != nil {
+			return nil
+		}
+		return m
+	}
+}
+
+// applyHookPermissionDecision enforces the permission precedence for a
+// PreToolUse hook response, returning the response to send to the CLI. The
+// decision of an enforced hook is kept whatever the precedence.
+func (q *Query) applyHookPermissionDecision(requestData map[string]interface{}, input interface{}, response map[string]interface{}, enforced bool) map[string]interface{} {
+	output := hookSpecificOutput(response)
+	if output == nil || output["hookEventName"] != string(types.HookEventPreToolUse) {
+		return response
+	}
+	decision, _ := output["permissionDecision"].(string)
+	if decision != string(types.PermissionBehaviorAllow) && decision != string(types.PermissionBehaviorDeny) {
+		return response
+	}
+
+	// The callback decides: drop the hook's decision so the CLI asks for permission
+	if !enforced && q.permissionPrecedence == types.PermissionPrecedenceCallback && q.permissionCallback() != nil {
+		stripped := make(map[string]interface{}, len(response))
+		for k, v := range response {
+			stripped[k] = v
+		}
+		out := make(map[string]interface{}, len(output))
+		for k, v := range output {
+			if k != "permissionDecision" && k != "permissionDecisionReason" {
+				out[k] = v
+			}
+		}
+		stripped["hookSpecificOutput"] = out
+		return stripped
+	}
+
+	// The hook decides: remember the decision for a permission request that may follow
+	fields, _ := input.(map[string]interface{})
+	toolUseID, _ := requestData["tool_use_id"].(string)
+	if toolUseID == "" {
+		toolUseID, _ = fields["tool_use_id"].(string)
+	}
+	toolName, _ := fields["tool_name"].(string)
+	toolInput, _ := fields["tool_input"].(map[string]interface{})
+
+	d := &hookDecision{behavior: decision, keys: toolUseKeys(toolUseID, toolName, toolInput)}
+	d.reason, _ = output["permissionDecisionReason"].(string)
+	d.updatedInput, _ = output["updatedInput"].(map[string]interface{})
+	q.storeHookDecision(d)
+
+	return response
+}
+
+// storeHookDecision records d under each of its keys, evicting the oldest
+// decision once maxPendingHookDecisions are pending.
+func (q *Query) storeHookDecision(d *hookDecision) {
+	if len(d.keys) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.hookDecisions == nil {
+		q.hookDecisions = make(map[string]*hookDecision)
+	}
+	if len(q.hookDecisionOrder) >= maxPendingHookDecisions {
+		q.dropHookDecisionLocked(q.hookDecisionOrder[0])
+	}
+	for _, key := range d.keys {
+		q.hookDecisions[key] = d
+	}
+	q.hookDecisionOrder = append(q.hookDecisionOrder, d)
+}
+
+// takeHookDecision returns and forgets the hook decision for a tool use, if any.
+func (q *Query) takeHookDecision(toolUseID, toolName string, input map[string]interface{}) *hookDecision {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, key := range toolUseKeys(toolUseID, toolName, input) {
+		if d, ok := q.hookDecisions[key]; ok {
+			q.dropHookDecisionLocked(d)
+			return d
+		}
+	}
+	return nil
+}
+
+// dropHookDecisionLocked removes d. The caller must hold q.mu.
+func (q *Query) dropHookDecisionLocked(d *hookDecision) {
+	for _, key := range d.keys {
+		if q.hookDecisions[key] == d {
+			delete(q.hookDecisions, key)
+		}
+	}
+	for i, pending := range q.hookDecisionOrder {
+		if pending == d {
+			q.hookDecisionOrder = append(q.hookDecisionOrder[:i], q.hookDecisionOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// result converts the hook decision into the permission result sent to the
+// CLI. An allow without an updatedInput echoes the request's input.
+func (d *hookDecision) result() types.PermissionResult {
+	if d.behavior == string(types.PermissionBehaviorDeny) {
+		message := d.reason
+		if message == "" {
+			message = "denied by PreToolUse hook"
+		}
+		return &types.PermissionResultDeny{Message: message}
+	}
+
+	allow := &types.PermissionResultAllow{}
+	if d.updatedInput != nil {
+		allow.UpdatedInput = &d.updatedInput
+	}
+	return allow
+}
@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// wireResponse is a control response the SDK wrote to the CLI.
+type wireResponse struct {
+	Subtype  string                 `json:"subtype"`
+	Error    string                 `json:"error"`
+	Response map[string]interface{} `json:"response"`
+}
+
+// sendControlRequestFromCLI routes a control request through the query as if
+// the CLI sent it, and returns the response written back.
+func sendControlRequestFromCLI(t *testing.T, q *Query, transport *mockTransport, requestID string, request map[string]interface{}) wireResponse {
+	t.Helper()
+
+	before := len(transport.getWrittenData())
+	q.handleControlRequest(&types.SystemMessage{
+		Type: "control_request",
+		Data: map[string]interface{}{"request_id": requestID, "request": request},
+	})
+
+	written := transport.getWrittenData()
+	if len(written) != before+1 {
+		t.Fatalf("expected one response to %s, got %d", requestID, len(written)-before)
+	}
+	var envelope struct {
+		Response wireResponse `json:"response"`
+	}
+	if err := json.Unmarshal([]byte(written[before]), &envelope); err != nil {
+		t.Fatalf("invalid response %q: %v", written[before], err)
+	}
+	return envelope.Response
+}
+
+func TestPermissionPrecedenceMatrix(t *testing.T) {
+	toolInput := map[string]interface{}{"command": "rm -rf build"}
+
+	tests := []struct {
+		precedence types.PermissionPrecedence
+		hook       string // permissionDecision returned by the PreToolUse hook
+		callback   string // CanUseTool result; "" means no callback configured
+		want       string // Effective outcome: allow, deny, or error (the CLI falls back to asking)
+		wantCalls  int    // CanUseTool invocations
+	}{
+		{types.PermissionPrecedenceHook, "allow", "allow", "allow", 0},
+		{types.PermissionPrecedenceHook, "allow", "deny", "allow", 0},
+		{types.PermissionPrecedenceHook, "allow", "", "allow", 0},
+		{types.PermissionPrecedenceHook, "deny", "allow", "deny", 0},
+		{types.PermissionPrecedenceHook, "deny", "deny", "deny", 0},
+		{types.PermissionPrecedenceHook, "deny", "", "deny", 0},
+		{types.PermissionPrecedenceHook, "ask", "allow", "allow", 1},
+		{types.PermissionPrecedenceHook, "ask", "deny", "deny", 1},
+		{types.PermissionPrecedenceHook, "ask", "", "error", 0},
+
+		{types.PermissionPrecedenceCallback, "allow", "allow", "allow", 1},
+		{types.PermissionPrecedenceCallback, "allow", "deny", "deny", 1},
+		{types.PermissionPrecedenceCallback, "allow", "", "allow", 0},
+		{types.PermissionPrecedenceCallback, "deny", "allow", "allow", 1},
+		{types.PermissionPrecedenceCallback, "deny", "deny", "deny", 1},
+		{types.PermissionPrecedenceCallback, "deny", "", "deny", 0},
+		{types.PermissionPrecedenceCallback, "ask", "allow", "allow", 1},
+		{types.PermissionPrecedenceCallback, "ask", "deny", "deny", 1},
+		{types.PermissionPrecedenceCallback, "ask", "", "error", 0},
+	}
+
+	for _, tt := range tests {
+		callbackName := tt.callback
+		if callbackName == "" {
+			callbackName = "none"
+		}
+		t.Run(fmt.Sprintf("%s/hook_%s/callback_%s", tt.precedence, tt.hook, callbackName), func(t *testing.T) {
+			transport := newMockTransport()
+			opts := types.NewClaudeAgentOptions().WithPermissionPrecedence(tt.precedence)
+
+			calls := 0
+			if tt.callback != "" {
+				opts.WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+					calls++
+					if tt.callback == "deny" {
+						return types.PermissionResultDeny{Message: "callback says no"}, nil
+					}
+					return types.PermissionResultAllow{}, nil
+				})
+			}
+
+			q := newTestQuery(context.Background(), transport, opts, true)
+			reason := "hook reason"
+			callbackID := q.registerHookCallback(func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+				return map[string]interface{}{
+					"hookSpecificOutput": &types.PreToolUseHookSpecificOutput{
+						HookEventName:            "PreToolUse",
+						PermissionDecision:       &tt.hook,
+						PermissionDecisionReason: &reason,
+					},
+				}, nil
+			})
+
+			hookResp := sendControlRequestFromCLI(t, q, transport, "req_hook", map[string]interface{}{
+				"subtype":     "hook_callback",
+				"callback_id": callbackID,
+				"tool_use_id": "toolu_1",
+				"input": map[string]interface{}{
+					"hook_event_name": "PreToolUse",
+					"tool_name":       "Bash",
+					"tool_input":      toolInput,
+				},
+			})
+			if hookResp.Subtype != "success" {
+				t.Fatalf("hook response failed: %s", hookResp.Error)
+			}
+			hookDecision := ""
+			if out, ok := hookResp.Response["hookSpecificOutput"].(map[string]interface{}); ok {
+				hookDecision, _ = out["permissionDecision"].(string)
+			}
+
+			// The CLI may still ask for permission; the answer must not contradict the hook
+			permResp := sendControlRequestFromCLI(t, q, transport, "req_perm", map[string]interface{}{
+				"subtype":     "can_use_tool",
+				"tool_name":   "Bash",
+				"tool_use_id": "toolu_1",
+				"input":       toolInput,
+			})
+			permDecision := "error"
+			if permResp.Subtype == "success" {
+				permDecision, _ = permResp.Response["behavior"].(string)
+			}
+
+			if hookDecision == "allow" || hookDecision == "deny" {
+				if permDecision != hookDecision {
+					t.Errorf("conflicting decisions on the wire: hook %q, permission %q", hookDecision, permDecision)
+				}
+			}
+			if permDecision != tt.want {
+				t.Errorf("effective decision = %q, want %q", permDecision, tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("CanUseTool called %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.precedence == types.PermissionPrecedenceCallback && tt.callback != "" && hookDecision != "" && hookDecision != "ask" {
+				t.Errorf("hook decision %q sent to the CLI although the callback has precedence", hookDecision)
+			}
+		})
+	}
+}
+
+// TestEnforcedHookDecisionKept tests that PermissionPrecedenceCallback
+// leaves the decision of an enforced hook in place.
+func TestEnforcedHookDecisionKept(t *testing.T) {
+	transport := newMockTransport()
+	opts := types.NewClaudeAgentOptions().
+		WithPermissionPrecedence(types.PermissionPrecedenceCallback).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return types.PermissionResultAllow{}, nil
+		})
+	q := newTestQuery(context.Background(), transport, opts, true)
+	deny := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return map[string]interface{}{
+			"hookSpecificOutput": map[string]interface{}{
+				"hookEventName":      "PreToolUse",
+				"permissionDecision": "deny",
+			},
+		}, nil
+	}
+	plain := q.registerHookCallback(deny)
+	enforced := q.registerHookCallback(deny)
+	q.markHookEnforced(enforced)
+
+	for id, want := range map[string]interface{}{plain: nil, enforced: "deny"} {
+		resp := sendControlRequestFromCLI(t, q, transport, "req_"+id, map[string]interface{}{
+			"subtype":     "hook_callback",
+			"callback_id": id,
+			"input": map[string]interface{}{
+				"hook_event_name": "PreToolUse",
+				"tool_name":       "Bash",
+				"tool_input":      map[string]interface{}{"command": "ls"},
+			},
+		})
+		output, _ := resp.Response["hookSpecificOutput"].(map[string]interface{})
+		if got := output["permissionDecision"]; got != want {
+			t.Errorf("%s permissionDecision = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestHookDecisionMatchedWithoutToolUseID(t *testing.T) {
+	transport := newMockTransport()
+	opts := types.NewClaudeAgentOptions().WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+		t.Error("CanUseTool called for a tool use the hook already denied")
+		return types.PermissionResultAllow{}, nil
+	})
+	q := newTestQuery(context.Background(), transport, opts, true)
+
+	callbackID := q.registerHookCallback(func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return map[string]interface{}{
+			"hookSpecificOutput": map[string]interface{}{
+				"hookEventName":      "PreToolUse",
+				"permissionDecision": "deny",
+			},
+		}, nil
+	})
+
+	input := map[string]interface{}{"file_path": "/etc/passwd"}
+	sendControlRequestFromCLI(t, q, transport, "req_hook", map[string]interface{}{
+		"subtype":     "hook_callback",
+		"callback_id": callbackID,
+		"input":       map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Read", "tool_input": input},
+	})
+	resp := sendControlRequestFromCLI(t, q, transport, "req_perm", map[string]interface{}{
+		"subtype":   "can_use_tool",
+		"tool_name": "Read",
+		"input":     map[string]interface{}{"file_path": "/etc/passwd"},
+	})
+	if resp.Response["behavior"] != "deny" || resp.Response["message"] != "denied by PreToolUse hook" {
+		t.Errorf("permission response = %v", resp.Response)
+	}
+
+	// The decision is used once; a later request for the same input asks the callback
+	if d := q.takeHookDecision("", "Read", input); d != nil {
+		t.Error("hook decision was not consumed")
+	}
+}
+
+func TestHookDecisionsBounded(t *testing.T) {
+	q := newTestQuery(context.Background(), newMockTransport(), nil, true)
+	for i := 0; i < maxPendingHookDecisions+10; i++ {
+		q.storeHookDecision(&hookDecision{behavior: "allow", keys: toolUseKeys(fmt.Sprintf("toolu_%d", i), "", nil)})
+	}
+
+	q.mu.Lock()
+	pending, keys := len(q.hookDecisionOrder), len(q.hookDecisions)
+	q.mu.Unlock()
+	if pending != maxPendingHookDecisions || keys != maxPendingHookDecisions {
+		t.Errorf("pending decisions = %d (%d keys), want %d", pending, keys, maxPendingHookDecisions)
+	}
+	if d := q.takeHookDecision("toolu_0", "", nil); d != nil {
+		t.Error("oldest decision was not evicted")
+	}
+	if d := q.takeHookDecision(fmt.Sprintf("toolu_%d", maxPendingHookDecisions+9), "", nil); d == nil {
+		t.Error("newest decision missing")
+	}
+}
@@ -0,0 +1,338 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// responseValidators check the payload of a success control response, keyed
+// by the subtype of the request it answers. Subtypes without a validator
+// (interrupt, set_permission_mode) are answered with an empty object.
+var responseValidators = map[string]func(request, response map[string]interface{}) error{
+	"can_use_tool":  validatePermissionResponse,
+	"hook_callback": validateHookResponse,
+	"mcp_message":   validateMCPResponse,
+}
+
+// validateControlResponse checks response, the payload answering a control
+// request with the given subtype, against the shape the CLI accepts. The
+// error is a ControlProtocolError whose Field names the offending field.
+func validateControlResponse(subtype string, request, response map[string]interface{}) error {
+	validate, ok := responseValidators[subtype]
+	if !ok {
+		return nil
+	}
+
+	// Validate what the CLI will receive, not the Go values the callback returned
+	data, err := json.Marshal(response)
+	if err != nil {
+		return types.NewControlProtocolErrorWithCause("invalid "+subtype+" response", err)
+	}
+	var wire map[string]interface{}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return types.NewControlProtocolErrorWithCause("invalid "+subtype+" response", err)
+	}
+	if wire == nil {
+		wire = map[string]interface{}{}
+	}
+
+	if err := validate(request, wire); err != nil {
+		if e, ok := err.(*types.ControlProtocolError); ok {
+			e.Message = "invalid " + subtype + " response: " + e.Message
+		}
+		return err
+	}
+	return nil
+}
+
+// fieldError reports a problem with one field of a control response.
+func fieldError(field, format string, args ...interface{}) *types.ControlProtocolError {
+	return &types.ControlProtocolError{
+		Message: field + ": " + fmt.Sprintf(format, args...),
+		Field:   field,
+	}
+}
+
+// fieldSpec describes one field of a response object.
+type fieldSpec struct {
+	kind     string   // JSON type: "string", "bool", "number", "object" or "array"
+	oneOf    []string // allowed values of a string field, if restricted
+	required bool
+}
+
+// checkObject checks obj against specs. Fields not in specs are rejected,
+// naming the expected spelling when only the casing or separators differ.
+func checkObject(prefix string, obj map[string]interface{}, specs map[string]fieldSpec) error {
+	for _, name := range sortedKeys(obj) {
+		if _, ok := specs[name]; ok {
+			continue
+		}
+		for known := range specs {
+			if fieldKey(known) == fieldKey(name) {
+				return fieldError(prefix+name, "unknown field, did you mean %q", known)
+			}
+		}
+		return fieldError(prefix+name, "unknown field")
+	}
+
+	for _, name := range sortedSpecKeys(specs) {
+		spec := specs[name]
+		value, ok := obj[name]
+		if !ok {
+			if spec.required {
+				return fieldError(prefix+name, "required field is missing")
+			}
+			continue
+		}
+		if got := jsonKind(value); got != spec.kind {
+			return fieldError(prefix+name, "must be a %s, got %s", spec.kind, got)
+		}
+		if spec.oneOf != nil {
+			s := value.(string)
+			if !contains(spec.oneOf, s) {
+				return fieldError(prefix+name, "must be one of %s, got %q", strings.Join(spec.oneOf, ", "), s)
+			}
+		}
+	}
+	return nil
+}
+
+// fieldKey folds a field name so permissionDecision, permission_decision and
+// PermissionDecision compare equal.
+func fieldKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// jsonKind returns the JSON type of a decoded value.
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedSpecKeys(m map[string]fieldSpec) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Permission responses
+
+var permissionUpdateTypes = []string{"addRules", "replaceRules", "removeRules", "setMode", "addDirectories", "removeDirectories"}
+
+var (
+	allowResponseFields = map[string]fieldSpec{
+		"behavior":           {kind: "string", required: true},
+		"updatedInput":       {kind: "object", required: true},
+		"updatedPermissions": {kind: "array"},
+	}
+	denyResponseFields = map[string]fieldSpec{
+		"behavior":  {kind: "string", required: true},
+		"message":   {kind: "string"},
+		"interrupt": {kind: "bool"},
+	}
+	permissionUpdateFields = map[string]fieldSpec{
+		"type":        {kind: "string", oneOf: permissionUpdateTypes, required: true},
+		"rules":       {kind: "array"},
+		"behavior":    {kind: "string", oneOf: []string{"allow", "deny", "ask"}},
+		"mode":        {kind: "string", oneOf: []string{"default", "acceptEdits", "plan", "bypassPermissions"}},
+		"directories": {kind: "array"},
+		"destination": {kind: "string", oneOf: []string{"userSettings", "projectSettings", "localSettings", "session"}},
+	}
+)
+
+// validatePermissionResponse checks the answer to a can_use_tool request.
+func validatePermissionResponse(_, response map[string]interface{}) error {
+	behavior, ok := response["behavior"]
+	if !ok {
+		return fieldError("behavior", "required field is missing")
+	}
+	switch behavior {
+	case "allow":
+		if err := checkObject("", response, allowResponseFields); err != nil {
+			return err
+		}
+	case "deny":
+		if err := checkObject("", response, denyResponseFields); err != nil {
+			return err
+		}
+	default:
+		return fieldError("behavior", "must be one of allow, deny, got %v", describe(behavior))
+	}
+
+	updates, _ := response["updatedPermissions"].([]interface{})
+	for i, u := range updates {
+		prefix := fmt.Sprintf("updatedPermissions[%d]", i)
+		update, ok := u.(map[string]interface{})
+		if !ok {
+			return fieldError(prefix, "must be an object, got %s", jsonKind(u))
+		}
+		if err := checkObject(prefix+".", update, permissionUpdateFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hook responses
+
+var (
+	hookResponseFields = map[string]fieldSpec{
+		"continue":           {kind: "bool"},
+		"suppressOutput":     {kind: "bool"},
+		"stopReason":         {kind: "string"},
+		"decision":           {kind: "string", oneOf: []string{"block"}},
+		"systemMessage":      {kind: "string"},
+		"reason":             {kind: "string"},
+		"hookSpecificOutput": {kind: "object"},
+		"async":              {kind: "bool"},
+		"asyncTimeout":       {kind: "number"},
+	}
+
+	// hookSpecificFields lists the hookSpecificOutput fields each event
+	// accepts besides hookEventName.
+	hookSpecificFields = map[types.HookEvent]map[string]fieldSpec{
+		types.HookEventPreToolUse: {
+			"permissionDecision":       {kind: "string", oneOf: []string{"allow", "deny", "ask"}},
+			"permissionDecisionReason": {kind: "string"},
+			"updatedInput":             {kind: "object"},
+		},
+		types.HookEventPostToolUse: {
+			"additionalContext": {kind: "string"},
+		},
+		types.HookEventUserPromptSubmit: {
+			"additionalContext": {kind: "string"},
+		},
+		types.HookEventStop:         {},
+		types.HookEventSubagentStop: {},
+		types.HookEventPreCompact:   {},
+		types.HookEventNotification: {},
+		types.HookEventSessionStart: {
+			"additionalContext": {kind: "string"},
+		},
+		types.HookEventSessionEnd: {},
+	}
+)
+
+// validateHookResponse checks the answer to a hook_callback request. The
+// hookEventName of hookSpecificOutput must match the event that fired.
+func validateHookResponse(request, response map[string]interface{}) error {
+	if err := checkObject("", response, hookResponseFields); err != nil {
+		return err
+	}
+
+	output, ok := response["hookSpecificOutput"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	name, ok := output["hookEventName"]
+	if !ok {
+		return fieldError("hookSpecificOutput.hookEventName", "required field is missing")
+	}
+	event, _ := name.(string)
+	var fired string
+	if input, ok := request["input"].(map[string]interface{}); ok {
+		fired, _ = input["hook_event_name"].(string)
+	}
+	fields, known := hookSpecificFields[types.HookEvent(event)]
+	if !known {
+		if event != "" && event == fired {
+			// An event newer than the SDK; its fields are the CLI's to check
+			return nil
+		}
+		return fieldError("hookSpecificOutput.hookEventName", "unknown hook event %v", describe(name))
+	}
+	if fired != "" && fired != event {
+		return fieldError("hookSpecificOutput.hookEventName", "is %q but the hook fired for %q", event, fired)
+	}
+
+	specs := map[string]fieldSpec{"hookEventName": {kind: "string", required: true}}
+	for k, v := range fields {
+		specs[k] = v
+	}
+	return checkObject("hookSpecificOutput.", output, specs)
+}
+
+// MCP responses
+
+// validateMCPResponse checks the answer to an mcp_message request, which
+// wraps a JSON-RPC 2.0 response.
+func validateMCPResponse(_, response map[string]interface{}) error {
+	if err := checkObject("", response, map[string]fieldSpec{
+		"mcp_response": {kind: "object", required: true},
+	}); err != nil {
+		return err
+	}
+
+	msg := response["mcp_response"].(map[string]interface{})
+	if v, ok := msg["jsonrpc"]; !ok {
+		return fieldError("mcp_response.jsonrpc", "required field is missing")
+	} else if v != "2.0" {
+		return fieldError("mcp_response.jsonrpc", "must be \"2.0\", got %v", describe(v))
+	}
+	_, hasResult := msg["result"]
+	rpcErr, hasError := msg["error"]
+	switch {
+	case hasResult && hasError:
+		return fieldError("mcp_response", "must not have both result and error")
+	case !hasResult && !hasError:
+		return fieldError("mcp_response", "must have a result or an error")
+	case hasError:
+		errObj, ok := rpcErr.(map[string]interface{})
+		if !ok {
+			return fieldError("mcp_response.error", "must be an object, got %s", jsonKind(rpcErr))
+		}
+		return checkObject("mcp_response.error.", errObj, map[string]fieldSpec{
+			"code":    {kind: "number", required: true},
+			"message": {kind: "string", required: true},
+			"data":    {kind: jsonKind(errObj["data"])},
+		})
+	}
+	return nil
+}
+
+// describe formats a decoded value for an error message.
+func describe(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return jsonKind(v)
+}
@@ -0,0 +1,358 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestValidateControlResponse(t *testing.T) {
+	preToolUse := map[string]interface{}{
+		"input": map[string]interface{}{"hook_event_name": "PreToolUse"},
+	}
+	allow := "allow"
+
+	tests := []struct {
+		name     string
+		subtype  string
+		request  map[string]interface{}
+		response map[string]interface{}
+		field    string // empty when the response is valid
+	}{
+		// Valid responses
+		{
+			name:     "allow with updated input",
+			subtype:  "can_use_tool",
+			response: map[string]interface{}{"behavior": "allow", "updatedInput": map[string]interface{}{"command": "ls"}},
+		},
+		{
+			name:     "deny with message",
+			subtype:  "can_use_tool",
+			response: map[string]interface{}{"behavior": "deny", "message": "no", "interrupt": true},
+		},
+		{
+			name:    "allow with permission update",
+			subtype: "can_use_tool",
+			response: map[string]interface{}{
+				"behavior":     "allow",
+				"updatedInput": map[string]interface{}{},
+				"updatedPermissions": []interface{}{
+					map[string]interface{}{"type": "setMode", "mode": "acceptEdits", "destination": "session"},
+				},
+			},
+		},
+		{
+			name:     "empty hook output",
+			subtype:  "hook_callback",
+			response: map[string]interface{}{},
+		},
+		{
+			name:    "SessionStart additional context",
+			subtype: "hook_callback",
+			request: map[string]interface{}{"input": map[string]interface{}{"hook_event_name": "SessionStart"}},
+			response: map[string]interface{}{"hookSpecificOutput": &types.SessionStartHookSpecificOutput{
+				HookEventName: "SessionStart", AdditionalContext: &allow,
+			}},
+		},
+		{
+			name:    "output for an event the SDK does not know",
+			subtype: "hook_callback",
+			request: map[string]interface{}{"input": map[string]interface{}{"hook_event_name": "PostCompact"}},
+			response: map[string]interface{}{"hookSpecificOutput": map[string]interface{}{
+				"hookEventName": "PostCompact", "summary": "kept",
+			}},
+		},
+		{
+			name:    "typed PreToolUse output",
+			subtype: "hook_callback",
+			request: preToolUse,
+			response: map[string]interface{}{
+				"continue": true,
+				"hookSpecificOutput": &types.PreToolUseHookSpecificOutput{
+					HookEventName:      "PreToolUse",
+					PermissionDecision: &allow,
+				},
+			},
+		},
+		{
+			name:     "async hook",
+			subtype:  "hook_callback",
+			response: map[string]interface{}{"async": true, "asyncTimeout": 30},
+		},
+		{
+			name:     "MCP result",
+			subtype:  "mcp_message",
+			response: map[string]interface{}{"mcp_response": map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": map[string]interface{}{}}},
+		},
+		{
+			name:    "MCP error",
+			subtype: "mcp_message",
+			response: map[string]interface{}{"mcp_response": map[string]interface{}{
+				"jsonrpc": "2.0", "id": 1, "error": map[string]interface{}{"code": -32601, "message": "not found"},
+			}},
+		},
+		{
+			name:     "interrupt is not validated",
+			subtype:  "interrupt",
+			response: map[string]interface{}{},
+		},
+
+		// Permission mistakes
+		{
+			name:     "missing behavior",
+			subtype:  "can_use_tool",
+			response: map[string]interface{}{"updatedInput": map[string]interface{}{}},
+			field:    "behavior",
+		},
+		{
+			name:     "capitalized behavior",
+			subtype:  "can_use_tool",
+			response: map[string]interface{}{"behavior": "Allow", "updatedInput": map[string]interface{}{}},
+			field:    "behavior",
+		},
+		{
+			name:     "approve instead of allow",
+			subtype:  "can_use_tool",
+			response: map[string]interface{}{"behavior": "approve"},
+			field:    "behavior",
+		},
+		{
+			name:     "allow without updated input",
+			subtype:  "can_use_tool",
+			response: map[string]interface{}{"behavior": "allow"},
+			field:    "updatedInput",
+		},
+		{
+			name:     "snake_case updated input",
+			subtype:  "can_use_tool",
+			response: map[string]interface{}{"behavior": "allow", "updatedInput": map[string]interface{}{}, "updated_input": map[string]interface{}{}},
+			field:    "updated_input",
+		},
+		{
+			name:     "updated input is a string",
+			subtype:  "can_use_tool",
+			response: map[string]interface{}{"behavior": "allow", "updatedInput": `{"command":"ls"}`},
+			field:    "updatedInput",
+		},
+		{
+			name:     "deny with reason instead of message",
+			subtype:  "can_use_tool",
+			response: map[string]interface{}{"behavior": "deny", "reason": "no"},
+			field:    "reason",
+		},
+		{
+			name:    "unknown permission update type",
+			subtype: "can_use_tool",
+			response: map[string]interface{}{
+				"behavior":           "allow",
+				"updatedInput":       map[string]interface{}{},
+				"updatedPermissions": []interface{}{map[string]interface{}{"type": "addRule"}},
+			},
+			field: "updatedPermissions[0].type",
+		},
+
+		// Hook mistakes
+		{
+			name:     "snake_case hook field",
+			subtype:  "hook_callback",
+			response: map[string]interface{}{"suppress_output": true},
+			field:    "suppress_output",
+		},
+		{
+			name:     "approve decision",
+			subtype:  "hook_callback",
+			response: map[string]interface{}{"decision": "approve"},
+			field:    "decision",
+		},
+		{
+			name:     "continue as string",
+			subtype:  "hook_callback",
+			response: map[string]interface{}{"continue": "true"},
+			field:    "continue",
+		},
+		{
+			name:     "null field",
+			subtype:  "hook_callback",
+			response: map[string]interface{}{"systemMessage": nil},
+			field:    "systemMessage",
+		},
+		{
+			name:     "missing hookEventName",
+			subtype:  "hook_callback",
+			request:  preToolUse,
+			response: map[string]interface{}{"hookSpecificOutput": map[string]interface{}{"permissionDecision": "deny"}},
+			field:    "hookSpecificOutput.hookEventName",
+		},
+		{
+			name:     "hookEventName for another event",
+			subtype:  "hook_callback",
+			request:  preToolUse,
+			response: map[string]interface{}{"hookSpecificOutput": map[string]interface{}{"hookEventName": "PostToolUse"}},
+			field:    "hookSpecificOutput.hookEventName",
+		},
+		{
+			name:     "unknown hook event",
+			subtype:  "hook_callback",
+			response: map[string]interface{}{"hookSpecificOutput": map[string]interface{}{"hookEventName": "preToolUse"}},
+			field:    "hookSpecificOutput.hookEventName",
+		},
+		{
+			name:    "capitalized permissionDecision",
+			subtype: "hook_callback",
+			request: preToolUse,
+			response: map[string]interface{}{"hookSpecificOutput": map[string]interface{}{
+				"hookEventName": "PreToolUse", "permissionDecision": "Allow",
+			}},
+			field: "hookSpecificOutput.permissionDecision",
+		},
+		{
+			name:    "snake_case permission_decision",
+			subtype: "hook_callback",
+			request: preToolUse,
+			response: map[string]interface{}{"hookSpecificOutput": map[string]interface{}{
+				"hookEventName": "PreToolUse", "permission_decision": "allow",
+			}},
+			field: "hookSpecificOutput.permission_decision",
+		},
+		{
+			name:    "permissionDecision on PostToolUse",
+			subtype: "hook_callback",
+			response: map[string]interface{}{"hookSpecificOutput": map[string]interface{}{
+				"hookEventName": "PostToolUse", "permissionDecision": "allow",
+			}},
+			field: "hookSpecificOutput.permissionDecision",
+		},
+		{
+			name:     "hookSpecificOutput at the top level",
+			subtype:  "hook_callback",
+			response: map[string]interface{}{"hookEventName": "PreToolUse", "permissionDecision": "deny"},
+			field:    "hookEventName",
+		},
+
+		// MCP mistakes
+		{
+			name:     "bare JSON-RPC message",
+			subtype:  "mcp_message",
+			response: map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": map[string]interface{}{}},
+			field:    "id",
+		},
+		{
+			name:     "missing jsonrpc version",
+			subtype:  "mcp_message",
+			response: map[string]interface{}{"mcp_response": map[string]interface{}{"id": 1, "result": map[string]interface{}{}}},
+			field:    "mcp_response.jsonrpc",
+		},
+		{
+			name:     "neither result nor error",
+			subtype:  "mcp_message",
+			response: map[string]interface{}{"mcp_response": map[string]interface{}{"jsonrpc": "2.0", "id": 1}},
+			field:    "mcp_response",
+		},
+		{
+			name:    "error code as string",
+			subtype: "mcp_message",
+			response: map[string]interface{}{"mcp_response": map[string]interface{}{
+				"jsonrpc": "2.0", "id": 1, "error": map[string]interface{}{"code": "-32601", "message": "not found"},
+			}},
+			field: "mcp_response.error.code",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateControlResponse(tt.subtype, tt.request, tt.response)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error naming %s", tt.field)
+			}
+			e, ok := err.(*types.ControlProtocolError)
+			if !ok {
+				t.Fatalf("expected ControlProtocolError, got %T", err)
+			}
+			if e.Field != tt.field {
+				t.Errorf("Field = %q, want %q (error: %v)", e.Field, tt.field, err)
+			}
+			if !strings.HasPrefix(err.Error(), "invalid "+tt.subtype+" response: "+tt.field) {
+				t.Errorf("error %q does not name the subtype and field", err)
+			}
+		})
+	}
+}
+
+func TestValidateControlResponseSuggestsSpelling(t *testing.T) {
+	err := validateControlResponse("hook_callback", nil, map[string]interface{}{"system_message": "hi"})
+	if err == nil || !strings.Contains(err.Error(), `did you mean "systemMessage"`) {
+		t.Errorf("error = %v, want a suggestion of systemMessage", err)
+	}
+}
+
+// TestStrictProtocolRejectsResponse tests that an invalid hook output is
+// answered with an error response instead of being written to the CLI.
+func TestStrictProtocolRejectsResponse(t *testing.T) {
+	hook := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return map[string]interface{}{
+			"hookSpecificOutput": map[string]interface{}{"hookEventName": "PreToolUse", "permissionDecision": "Allow"},
+		}, nil
+	}
+	request := func(q *Query) *types.SystemMessage {
+		return &types.SystemMessage{
+			Type: "control_request",
+			Data: map[string]interface{}{
+				"request_id": "req_cli_1",
+				"request": map[string]interface{}{
+					"subtype":     "hook_callback",
+					"callback_id": q.registerHookCallback(hook),
+					"input":       map[string]interface{}{"hook_event_name": "PreToolUse"},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		strict  *bool
+		subtype string
+	}{
+		{"default", nil, "success"},
+		{"enabled", boolPtr(true), "error"},
+		{"disabled", boolPtr(false), "success"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newMockTransport()
+			opts := types.NewClaudeAgentOptions()
+			opts.StrictProtocol = tt.strict
+			q := NewQuery(context.Background(), transport, opts, true)
+
+			q.handleControlRequest(request(q))
+
+			written := transport.getWrittenData()
+			if len(written) != 1 {
+				t.Fatalf("wrote %d lines, want 1", len(written))
+			}
+			var msg struct {
+				Response struct {
+					Subtype string `json:"subtype"`
+					Error   string `json:"error"`
+				} `json:"response"`
+			}
+			if err := json.Unmarshal([]byte(written[0]), &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Response.Subtype != tt.subtype {
+				t.Fatalf("response subtype = %q, want %q: %s", msg.Response.Subtype, tt.subtype, written[0])
+			}
+			if tt.subtype == "error" && !strings.Contains(msg.Response.Error, "hookSpecificOutput.permissionDecision") {
+				t.Errorf("error %q does not name the offending field", msg.Response.Error)
+			}
+		})
+	}
+}
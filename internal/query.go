@@ -3,10 +3,14 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
@@ -26,21 +30,64 @@ type Query struct {
 	requestMap         map[string]chan responseResult
 	nextRequestID      int64
 	hookCallbacks      map[string]types.HookCallbackFunc
+	enforcedHooks      map[string]bool // Callback IDs whose permissionDecision is never stripped
 	nextHookCallbackID int64
+	nextMCPListID      int64 // Numbers the tools/list messages sent to mcpServers
 
 	// Callbacks
 	canUseTool types.CanUseToolFunc
 	hooks      map[types.HookEvent][]types.HookMatcher
 	mcpServers map[string]types.MCPServer
 
+	// Callbacks of the current turn, and the events its hooks may use
+	turn           turnCallbacks
+	turnHookEvents map[types.HookEvent]bool
+
 	// Message handling
 	messagesChan     chan types.Message
 	stopChan         chan struct{}
+	stopOnce         sync.Once
 	readLoopDone     chan struct{}
 	started          bool
 	initialized      bool
 	initializeResult map[string]interface{}
 	isStreamingMode  bool
+
+	// Validate outgoing control responses (see ClaudeAgentOptions.WithStrictProtocol)
+	strictProtocol bool
+
+	// Transcript path reported by the CLI, captured once
+	transcriptPath string
+
+	// Control protocol logging; never nil
+	logger *slog.Logger
+
+	// Called with each message read from the transport, before it is routed
+	observers []func(types.Message)
+
+	// Traces permission round trips (nil disables), under traceParent()
+	tracer      types.Tracer
+	traceParent func() context.Context
+
+	// PreToolUse hook decisions awaiting a matching permission request
+	permissionPrecedence types.PermissionPrecedence
+	hookDecisions        map[string]*hookDecision
+	hookDecisionOrder    []*hookDecision
+
+	// Permission and hook requests held by Pause
+	pause pauseGate
+
+	// Permission requests awaiting their callback or ResolvePermission, by ID
+	pendingPermissions map[string]*pendingPermission
+	nextPermissionID   int
+
+	// How AbandonPermission answers: the policy if set, else the mode
+	abandonedPolicy func(toolName string, input map[string]interface{}) types.PermissionResult
+	permissionMode  types.PermissionMode
+
+	// Inputs with larger fields reach callbacks per the policy (0 passes them whole)
+	maxCallbackPayload    int
+	callbackPayloadPolicy types.CallbackPayloadPolicy
 }
 
 // responseResult wraps the response or error from a control request.
@@ -64,16 +111,72 @@ func NewQuery(ctx context.Context, transport transport.Transport, opts *types.Cl
 		readLoopDone:    make(chan struct{}),
 		isStreamingMode: isStreamingMode,
 		mcpServers:      make(map[string]types.MCPServer),
+		logger:          slog.New(slog.DiscardHandler),
 	}
 
 	if opts != nil {
 		q.canUseTool = opts.CanUseTool
 		q.hooks = opts.Hooks
+		q.permissionPrecedence = opts.PermissionPrecedence
+		if opts.PermissionMode != nil {
+			q.permissionMode = *opts.PermissionMode
+		}
+		q.maxCallbackPayload = opts.MaxCallbackPayloadBytes
+		q.callbackPayloadPolicy = opts.CallbackPayloadPolicy
+		if opts.CaptureTranscriptPath {
+			q.hooks = withTranscriptHook(q.hooks)
+		}
+		q.hooks = q.withTurnHooks(q.hooks, opts.TurnHookEvents)
+		if opts.Logger != nil {
+			q.logger = opts.Logger
+		}
+		if opts.StrictProtocol != nil {
+			q.strictProtocol = *opts.StrictProtocol
+		}
+		q.addSdkMCPServers(opts.McpServers)
 	}
 
 	return q
 }
 
+// addSdkMCPServers registers the in-process ("sdk") MCP servers configured
+// in servers whose Instance implements types.MCPServer, under their
+// configuration keys, which the CLI names them by in mcp_message requests.
+func (q *Query) addSdkMCPServers(servers interface{}) {
+	configs, ok := servers.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for name, config := range configs {
+		var instance interface{}
+		switch c := config.(type) {
+		case types.McpSdkServerConfig:
+			instance = c.Instance
+		case *types.McpSdkServerConfig:
+			if c != nil {
+				instance = c.Instance
+			}
+		}
+		if server, ok := instance.(types.MCPServer); ok {
+			q.mcpServers[name] = server
+		}
+	}
+}
+
+// AddMessageObserver adds a function called from the read loop with every
+// message read from the transport, control messages included, before the
+// message is routed. Observers are called in the order they were added. They
+// must not block, and must be added before Start.
+func (q *Query) AddMessageObserver(observer func(types.Message)) {
+	q.observers = append(q.observers, observer)
+}
+
+// Done returns a channel closed once the read loop has ended, because the
+// query was stopped or the transport's output ended.
+func (q *Query) Done() <-chan struct{} {
+	return q.readLoopDone
+}
+
 // Initialize sends initialization control request if in streaming mode.
 func (q *Query) Initialize(ctx context.Context) (map[string]interface{}, error) {
 	if !q.isStreamingMode {
@@ -98,6 +201,9 @@ func (q *Query) Initialize(ctx context.Context) (map[string]interface{}, error)
 				for _, callback := range matcher.Hooks {
 					callbackID := q.registerHookCallback(callback)
 					callbackIDs = append(callbackIDs, callbackID)
+					if matcher.Enforced {
+						q.markHookEnforced(callbackID)
+					}
 				}
 
 				hookConfig := map[string]interface{}{
@@ -130,6 +236,54 @@ func (q *Query) Initialize(ctx context.Context) (map[string]interface{}, error)
 	return result, nil
 }
 
+// Interrupt asks the CLI to stop the current turn.
+func (q *Query) Interrupt(ctx context.Context) error {
+	_, err := q.sendControlRequest(ctx, map[string]interface{}{
+		"subtype": "interrupt",
+	})
+	return err
+}
+
+// SetPermissionMode sends a set_permission_mode control request and waits for the CLI to acknowledge it.
+func (q *Query) SetPermissionMode(ctx context.Context, mode string) error {
+	_, err := q.sendControlRequest(ctx, map[string]interface{}{
+		"subtype": "set_permission_mode",
+		"mode":    mode,
+	})
+	if err == nil {
+		q.mu.Lock()
+		q.permissionMode = types.PermissionMode(mode)
+		q.mu.Unlock()
+	}
+	return err
+}
+
+// SetModel sends a set_model control request and waits for the CLI to
+// acknowledge it. An empty model is sent as null, selecting the default model.
+func (q *Query) SetModel(ctx context.Context, model string) error {
+	request := map[string]interface{}{
+		"subtype": "set_model",
+		"model":   nil,
+	}
+	if model != "" {
+		request["model"] = model
+	}
+	_, err := q.sendControlRequest(ctx, request)
+	return err
+}
+
+// SetIncludePartialMessages sends a set_include_partial_messages control
+// request, turning the CLI's partial message streaming on or off for the
+// following turns, and waits for the CLI to acknowledge it.
+func (q *Query) SetIncludePartialMessages(ctx context.Context, enabled bool) error {
+	request := map[string]interface{}{
+		"subtype":                  "set_include_partial_messages",
+		"include_partial_messages": enabled,
+	}
+	_, err := q.sendControlRequest(ctx, request)
+	return err
+}
+
 // Start begins the control message handling loop.
 func (q *Query) Start(ctx context.Context) error {
 	q.mu.Lock()
@@ -148,39 +302,70 @@ func (q *Query) Start(ctx context.Context) error {
 
 // Stop gracefully stops the query handler.
 func (q *Query) Stop(ctx context.Context) error {
-	// Signal stop
-	select {
-	case <-q.stopChan:
-		// Already stopped
-		return nil
-	default:
+	// Signal stop; concurrent and repeated calls are no-ops
+	stopped := false
+	q.stopOnce.Do(func() {
 		close(q.stopChan)
+		stopped = true
+	})
+	if !stopped {
+		return nil
 	}
 
-	// Cancel context to stop all operations
+	// Cancel context to stop all operations, including pending control requests
 	q.cancel()
 
-	// Wait for read loop to complete
+	// Wait for read loop to complete. It returns promptly once cancelled, so
+	// a ctx that is already done, as when Close is deferred after a timeout,
+	// is not reported as a failure.
+	var ctxDone <-chan struct{}
+	if ctx.Err() == nil {
+		ctxDone = ctx.Done()
+	}
 	select {
 	case <-q.readLoopDone:
-	case <-ctx.Done():
+	case <-ctxDone:
 		return ctx.Err()
 	}
 
-	// Close message channel
-	close(q.messagesChan)
-
 	return nil
 }
 
 // GetMessages returns a channel for consuming normal (non-control) messages.
+// The channel is closed when the query is stopped or the transport's output ends.
 func (q *Query) GetMessages(ctx context.Context) <-chan types.Message {
 	return q.messagesChan
 }
 
+// Stats is a snapshot of a Query's in-flight work.
+type Stats struct {
+	PendingControlRequests int // Control requests sent to the CLI awaiting a response
+	QueuedMessages         int // Messages buffered for the consumer
+	QueueCapacity          int // Size of the message buffer
+	PendingHookDecisions   int // PreToolUse decisions awaiting a permission request
+	Paused                 bool
+	HeldControlRequests    int // Permission and hook requests held until Resume
+}
+
+// Stats returns a snapshot of the query's pending requests and queue depth.
+func (q *Query) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Stats{
+		PendingControlRequests: len(q.requestMap),
+		QueuedMessages:         len(q.messagesChan),
+		QueueCapacity:          cap(q.messagesChan),
+		PendingHookDecisions:   len(q.hookDecisionOrder),
+		Paused:                 q.Paused(),
+		HeldControlRequests:    q.heldRequests(),
+	}
+}
+
 // messageLoop reads messages from transport and routes them.
 func (q *Query) messageLoop() {
 	defer close(q.readLoopDone)
+	defer close(q.messagesChan)
 
 	messages := q.transport.ReadMessages(q.ctx)
 
@@ -196,6 +381,10 @@ func (q *Query) messageLoop() {
 				return
 			}
 
+			for _, observer := range q.observers {
+				observer(msg)
+			}
+
 			// Route message based on type
 			if err := q.routeMessage(msg); err != nil {
 				// Log error but continue processing
@@ -212,7 +401,7 @@ func (q *Query) routeMessage(msg types.Message) error {
 	msgType := msg.GetMessageType()
 
 	// Handle control responses
-	if msgType == "control_response" {
+	if msgType == types.MessageTypeControlResponse {
 		if sysMsg, ok := msg.(*types.SystemMessage); ok {
 			return q.handleControlResponse(sysMsg)
 		}
@@ -220,7 +409,7 @@ func (q *Query) routeMessage(msg types.Message) error {
 	}
 
 	// Handle control requests
-	if msgType == "control_request" {
+	if msgType == types.MessageTypeControlRequest {
 		if sysMsg, ok := msg.(*types.SystemMessage); ok {
 			go q.handleControlRequest(sysMsg)
 			return nil
@@ -228,6 +417,11 @@ func (q *Query) routeMessage(msg types.Message) error {
 		return types.NewControlProtocolError("invalid control_request message type")
 	}
 
+	// The init message may carry the transcript path before any hook fires
+	if sysMsg, ok := msg.(*types.SystemMessage); ok && sysMsg.Subtype == "init" {
+		q.captureTranscriptPath(sysMsg.Data)
+	}
+
 	// Regular message - send to consumer
 	select {
 	case q.messagesChan <- msg:
@@ -298,6 +492,19 @@ func (q *Query) handleControlRequest(msg *types.SystemMessage) {
 	}
 
 	subtype, _ := requestData["subtype"].(string)
+	if pausable(subtype) {
+		answered, async, ok := q.awaitResume(subtype, requestID)
+		if !ok {
+			return
+		}
+		defer answered()
+		if async {
+			// The CLI already went on without the output
+			_, err := q.handleHookCallback(requestData)
+			q.logger.Info("claude: hook callback output dropped after async answer", "request_id", requestID, "error", err)
+			return
+		}
+	}
 
 	var response map[string]interface{}
 	var err error
@@ -320,22 +527,67 @@ func (q *Query) handleControlRequest(msg *types.SystemMessage) {
 	}
 
 	if err != nil {
+		q.logger.Info("claude: control request from CLI failed", "subtype", subtype, "request_id", requestID, "error", err)
 		q.sendErrorResponse(requestID, err.Error())
 		return
 	}
 
+	if q.strictProtocol {
+		if err := validateControlResponse(subtype, requestData, response); err != nil {
+			q.logger.Warn("claude: rejected invalid control response", "subtype", subtype, "request_id", requestID, "error", err)
+			q.sendErrorResponse(requestID, err.Error())
+			return
+		}
+	}
+
+	q.logger.Info("claude: control request from CLI handled", "subtype", subtype, "request_id", requestID)
 	q.sendSuccessResponse(requestID, response)
 }
 
-// handlePermissionRequest handles a permission request for tool use.
+// handlePermissionRequest handles a permission request for tool use,
+// tracing it when a tracer is set.
 func (q *Query) handlePermissionRequest(requestData map[string]interface{}) (map[string]interface{}, error) {
-	if q.canUseTool == nil {
-		return nil, types.NewControlProtocolError("canUseTool callback is not provided")
+	toolName, _ := requestData["tool_name"].(string)
+	toolUseID, _ := requestData["tool_use_id"].(string)
+	span := q.startPermissionSpan(toolName, toolUseID)
+
+	response, err := q.answerPermissionRequest(requestData)
+	if span != nil {
+		if behavior, ok := response["behavior"].(string); ok {
+			span.SetAttributes(map[string]interface{}{types.AttrPermissionResult: behavior})
+		}
+		span.End(err)
 	}
+	return response, err
+}
 
+// answerPermissionRequest answers a permission request for tool use.
+func (q *Query) answerPermissionRequest(requestData map[string]interface{}) (map[string]interface{}, error) {
 	toolName, _ := requestData["tool_name"].(string)
-	input, _ := requestData["input"].(map[string]interface{})
 	suggestions, _ := requestData["permission_suggestions"].([]interface{})
+	toolUseID, _ := requestData["tool_use_id"].(string)
+
+	// An allow without an updated input echoes the input as the CLI sent it,
+	// not as limited for the callback
+	echo := requestData["input"]
+	decoded, err := q.callbackInput(echo)
+	if err != nil {
+		return nil, err
+	}
+	input, _ := decoded.(map[string]interface{})
+	if _, ok := echo.(json.RawMessage); !ok {
+		echo = input
+	}
+
+	// A PreToolUse hook already decided this tool use; give the CLI the same answer
+	if d := q.takeHookDecision(toolUseID, toolName, input); d != nil {
+		return permissionResultToResponse(d.result(), echo)
+	}
+
+	canUseTool := q.permissionCallback()
+	if canUseTool == nil {
+		return nil, types.NewControlProtocolError("canUseTool callback is not provided")
+	}
 
 	if toolName == "" || input == nil {
 		return nil, types.NewControlProtocolError("missing tool_name or input in permission request")
@@ -355,62 +607,55 @@ func (q *Query) handlePermissionRequest(requestData map[string]interface{}) (map
 		}
 	}
 
+	parentToolUseID, _ := requestData["parent_tool_use_id"].(string)
+	blockedPath, _ := requestData["blocked_path"].(string)
 	ctx := types.ToolPermissionContext{
-		Suggestions: permissionUpdates,
+		Suggestions:     permissionUpdates,
+		ToolUseID:       toolUseID,
+		ParentToolUseID: parentToolUseID,
+		BlockedPath:     blockedPath,
 	}
 
-	// Call permission callback
-	result, err := q.canUseTool(q.ctx, toolName, input, ctx)
+	// Call permission callback, or wait for ResolvePermission if it defers
+	result, err := q.decidePermission(canUseTool, toolName, input, ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// Convert result to response format
-	response := make(map[string]interface{})
+	return permissionResultToResponse(result, echo)
+}
 
+// permissionResultToResponse converts a permission result into the control
+// response payload. Allow results without an updated input echo the original input,
+// matching what the CLI expects.
+func permissionResultToResponse(result types.PermissionResult, input interface{}) (map[string]interface{}, error) {
 	switch r := result.(type) {
-	case types.PermissionResultAllow:
-		response["behavior"] = "allow"
-		if r.UpdatedInput != nil {
-			response["updatedInput"] = *r.UpdatedInput
-		} else {
-			response["updatedInput"] = input
-		}
-		if len(r.UpdatedPermissions) > 0 {
-			response["updatedPermissions"] = r.UpdatedPermissions
-		}
-
+	case nil:
+		return nil, types.NewControlProtocolError("permission callback returned nil result")
 	case *types.PermissionResultAllow:
-		response["behavior"] = "allow"
-		if r.UpdatedInput != nil {
-			response["updatedInput"] = *r.UpdatedInput
-		} else {
-			response["updatedInput"] = input
+		if r == nil {
+			return nil, types.NewControlProtocolError("permission callback returned nil result")
 		}
-		if len(r.UpdatedPermissions) > 0 {
-			response["updatedPermissions"] = r.UpdatedPermissions
+	case *types.PermissionResultDeny:
+		if r == nil {
+			return nil, types.NewControlProtocolError("permission callback returned nil result")
 		}
+	}
 
-	case types.PermissionResultDeny:
-		response["behavior"] = "deny"
-		if r.Message != "" {
-			response["message"] = r.Message
-		}
-		if r.Interrupt {
-			response["interrupt"] = r.Interrupt
-		}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, types.NewControlProtocolErrorWithCause("failed to marshal permission result", err)
+	}
 
-	case *types.PermissionResultDeny:
-		response["behavior"] = "deny"
-		if r.Message != "" {
-			response["message"] = r.Message
-		}
-		if r.Interrupt {
-			response["interrupt"] = r.Interrupt
-		}
+	var response map[string]interface{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, types.NewControlProtocolErrorWithCause("failed to marshal permission result", err)
+	}
 
-	default:
-		return nil, types.NewControlProtocolError("permission callback returned invalid type")
+	if result.GetBehavior() == string(types.PermissionBehaviorAllow) {
+		if _, ok := response["updatedInput"]; !ok {
+			response["updatedInput"] = input
+		}
 	}
 
 	return response, nil
@@ -418,9 +663,23 @@ func (q *Query) handlePermissionRequest(requestData map[string]interface{}) (map
 
 // handleHookCallback handles a hook callback request.
 func (q *Query) handleHookCallback(requestData map[string]interface{}) (map[string]interface{}, error) {
+	// Accept either casing for fields that have drifted between CLI versions
+	requestData = types.NormalizeHookFields(requestData)
+	decoded, err := q.callbackInput(requestData["input"])
+	if err != nil {
+		return nil, err
+	}
+	requestData["input"] = decoded
+	if fields, ok := requestData["input"].(map[string]interface{}); ok {
+		requestData["input"] = types.NormalizeHookFields(fields)
+	}
+
 	callbackID, _ := requestData["callback_id"].(string)
 	input := requestData["input"]
-	toolUseID, _ := requestData["tool_use_id"].(*string)
+	var toolUseID *string
+	if id, ok := requestData["tool_use_id"].(string); ok {
+		toolUseID = &id
+	}
 
 	if callbackID == "" {
 		return nil, types.NewControlProtocolError("missing callback_id in hook callback request")
@@ -429,14 +688,24 @@ func (q *Query) handleHookCallback(requestData map[string]interface{}) (map[stri
 	// Find callback
 	q.mu.Lock()
 	callback, exists := q.hookCallbacks[callbackID]
+	enforced := q.enforcedHooks[callbackID]
 	q.mu.Unlock()
 
 	if !exists {
 		return nil, types.NewControlProtocolError("no hook callback found for ID: " + callbackID)
 	}
 
-	// Build hook context
+	q.captureTranscriptPath(input)
+
+	// Build hook context, with the input typed by its event; events the SDK
+	// has no type for get a generic input. Typing an input with fields left
+	// raw would decode them, so it gets none.
 	hookCtx := types.HookContext{}
+	if !hasRawFields(input) {
+		if typed, err := types.ParseHookInputWithOptions(input, types.DecodeOptions{Logger: q.logger}); err == nil {
+			hookCtx.Input = typed
+		}
+	}
 
 	// Call hook callback
 	hookOutput, err := callback(q.ctx, input, toolUseID, hookCtx)
@@ -444,14 +713,69 @@ func (q *Query) handleHookCallback(requestData map[string]interface{}) (map[stri
 		return nil, err
 	}
 
-	// Convert hook output to response
-	// The callback should return a map[string]interface{} representing the hook output
-	response, ok := hookOutput.(map[string]interface{})
+	fields, _ := input.(map[string]interface{})
+	event, _ := fields["hook_event_name"].(string)
+	response, err := hookResponse(hookOutput, event)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.applyHookPermissionDecision(requestData, input, response, enforced), nil
+}
+
+// hookResponse converts a hook callback's output into the response sent to
+// the CLI. The output is a map or a struct such as SyncHookJSONOutput, which
+// is sent as its JSON form. hookSpecificOutput, which may hold a typed output
+// such as PreToolUseHookSpecificOutput, is likewise converted to its JSON
+// form, so its camelCase keys and nested updatedInput reach the CLI as they
+// marshal, and its hookEventName defaults to event, the event that fired,
+// since the CLI ignores output naming no event. The output itself is not
+// modified.
+func hookResponse(output interface{}, event string) (map[string]interface{}, error) {
+	response, ok := output.(map[string]interface{})
 	if !ok {
-		return nil, types.NewControlProtocolError("hook callback must return map[string]interface{}")
+		data, err := json.Marshal(output)
+		if err != nil {
+			return nil, types.NewControlProtocolErrorWithCause("cannot encode hook output", err)
+		}
+		if json.Unmarshal(data, &response) != nil || response == nil {
+			return nil, types.NewControlProtocolError(fmt.Sprintf("hook callback must return map[string]interface{} or a hook output struct, got %T", output))
+		}
 	}
 
-	return response, nil
+	raw, ok := response["hookSpecificOutput"]
+	if !ok {
+		return response, nil
+	}
+	specific := hookSpecificOutput(response)
+	if specific == nil {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, types.NewControlProtocolErrorWithCause("cannot encode hookSpecificOutput", err)
+		}
+		if string(data) != "null" {
+			return nil, types.NewControlProtocolError("hookSpecificOutput must be a JSON object, got " + string(data))
+		}
+	}
+
+	converted := make(map[string]interface{}, len(response))
+	for k, v := range response {
+		converted[k] = v
+	}
+	if specific == nil {
+		delete(converted, "hookSpecificOutput")
+		return converted, nil
+	}
+	if name, _ := specific["hookEventName"].(string); name == "" && event != "" {
+		named := make(map[string]interface{}, len(specific)+1)
+		for k, v := range specific {
+			named[k] = v
+		}
+		named["hookEventName"] = event
+		specific = named
+	}
+	converted["hookSpecificOutput"] = specific
+	return converted, nil
 }
 
 // handleMCPMessage handles an MCP message request.
@@ -505,8 +829,78 @@ func (q *Query) handleMCPMessage(requestData map[string]interface{}) (map[string
 	}, nil
 }
 
+// ListMCPTools asks each in-process MCP server for its tools with a
+// tools/list message, routed like the CLI's mcp_message requests. Tools are
+// keyed by server name and named as the model calls them. Servers that fail
+// to answer are left out, and their errors joined into the returned error.
+func (q *Query) ListMCPTools() (map[string][]types.ToolInfo, error) {
+	q.mu.Lock()
+	names := make([]string, 0, len(q.mcpServers))
+	for name := range q.mcpServers {
+		names = append(names, name)
+	}
+	q.mu.Unlock()
+	sort.Strings(names)
+
+	tools := make(map[string][]types.ToolInfo, len(names))
+	var errs []error
+	for _, name := range names {
+		id := atomic.AddInt64(&q.nextMCPListID, 1)
+		response, err := q.handleMCPMessage(map[string]interface{}{
+			"server_name": name,
+			"message": map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      fmt.Sprintf("sdk_tools_list_%d", id),
+				"method":  "tools/list",
+			},
+		})
+		var list []types.ToolInfo
+		if err == nil {
+			list, err = decodeToolsList(name, response["mcp_response"])
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("MCP server %q: %w", name, err))
+			continue
+		}
+		tools[name] = list
+	}
+	return tools, errors.Join(errs...)
+}
+
+// decodeToolsList extracts the tools from a JSON-RPC response to tools/list.
+func decodeToolsList(server string, response interface{}) ([]types.ToolInfo, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var msg struct {
+		Result *struct {
+			Tools []types.ToolInfo `json:"tools"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, types.NewJSONDecodeErrorWithCause("invalid tools/list response", string(data), err)
+	}
+	switch {
+	case msg.Error != nil:
+		return nil, types.NewControlProtocolError("tools/list failed: " + msg.Error.Message)
+	case msg.Result == nil:
+		return nil, types.NewControlProtocolError("tools/list response has no result")
+	}
+
+	tools := msg.Result.Tools
+	for i := range tools {
+		tools[i].Name = "mcp__" + server + "__" + tools[i].Name
+		tools[i].Server = server
+	}
+	return tools, nil
+}
+
 // sendControlRequest sends a control request to CLI and waits for response.
-func (q *Query) sendControlRequest(ctx context.Context, request map[string]interface{}) (map[string]interface{}, error) {
+func (q *Query) sendControlRequest(ctx context.Context, request map[string]interface{}) (response map[string]interface{}, err error) {
 	if !q.isStreamingMode {
 		return nil, types.NewControlProtocolError("control requests require streaming mode")
 	}
@@ -514,6 +908,17 @@ func (q *Query) sendControlRequest(ctx context.Context, request map[string]inter
 	// Generate unique request ID
 	requestID := q.generateRequestID()
 
+	subtype, _ := request["subtype"].(string)
+	start := time.Now()
+	q.logger.Info("claude: control request to CLI", "subtype", subtype, "request_id", requestID)
+	defer func() {
+		if err != nil {
+			q.logger.Info("claude: control request to CLI failed", "subtype", subtype, "request_id", requestID, "duration", time.Since(start), "error", err)
+		} else {
+			q.logger.Info("claude: control response from CLI", "subtype", subtype, "request_id", requestID, "duration", time.Since(start))
+		}
+	}()
+
 	// Create response channel
 	responseChan := make(chan responseResult, 1)
 	q.mu.Lock()
@@ -522,7 +927,7 @@ func (q *Query) sendControlRequest(ctx context.Context, request map[string]inter
 
 	// Build control request
 	controlRequest := map[string]interface{}{
-		"type":       "control_request",
+		"type":       types.MessageTypeControlRequest,
 		"request_id": requestID,
 		"request":    request,
 	}
@@ -555,13 +960,32 @@ func (q *Query) sendControlRequest(ctx context.Context, request map[string]inter
 		delete(q.requestMap, requestID)
 		q.mu.Unlock()
 		return nil, ctx.Err()
+	case <-q.ctx.Done():
+		q.mu.Lock()
+		delete(q.requestMap, requestID)
+		q.mu.Unlock()
+		return nil, types.NewControlProtocolError("query stopped before the CLI responded")
+	case <-q.readLoopDone:
+		// The CLI's output ended; take a response routed just before that
+		q.mu.Lock()
+		delete(q.requestMap, requestID)
+		q.mu.Unlock()
+		select {
+		case result := <-responseChan:
+			if result.err != nil {
+				return nil, result.err
+			}
+			return result.response, nil
+		default:
+		}
+		return nil, types.NewTransportBrokenErrorWithCause("CLI output ended before it responded", q.transport.GetError())
 	}
 }
 
 // sendSuccessResponse sends a success control response.
 func (q *Query) sendSuccessResponse(requestID string, response map[string]interface{}) {
 	controlResponse := map[string]interface{}{
-		"type": "control_response",
+		"type": types.MessageTypeControlResponse,
 		"response": map[string]interface{}{
 			"subtype":    "success",
 			"request_id": requestID,
@@ -574,13 +998,18 @@ func (q *Query) sendSuccessResponse(requestID string, response map[string]interf
 		return
 	}
 
-	_ = q.transport.Write(q.ctx, string(data))
+	// A response too large for the CLI's input is replaced by an error, so
+	// that the CLI is not left waiting for it
+	if err := q.transport.Write(q.ctx, string(data)); types.IsOutboundTooLargeError(err) {
+		q.logger.Warn("claude: control response too large for the CLI", "request_id", requestID, "error", err)
+		q.sendErrorResponse(requestID, err.Error())
+	}
 }
 
 // sendErrorResponse sends an error control response.
 func (q *Query) sendErrorResponse(requestID string, errorMsg string) {
 	controlResponse := map[string]interface{}{
-		"type": "control_response",
+		"type": types.MessageTypeControlResponse,
 		"response": map[string]interface{}{
 			"subtype":    "error",
 			"request_id": requestID,
@@ -613,6 +1042,32 @@ func (q *Query) registerHookCallback(callback types.HookCallbackFunc) string {
 	return callbackID
 }
 
+// markHookEnforced exempts the hook callback id from permission precedence
+// stripping.
+func (q *Query) markHookEnforced(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.enforcedHooks == nil {
+		q.enforcedHooks = make(map[string]bool)
+	}
+	q.enforcedHooks[id] = true
+}
+
+// AddHook adds a hook matcher for event, after those configured in the
+// options. It must be called before Initialize. The options' hooks map is not
+// modified.
+func (q *Query) AddHook(event types.HookEvent, matcher types.HookMatcher) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	hooks := make(map[types.HookEvent][]types.HookMatcher, len(q.hooks)+1)
+	for e, matchers := range q.hooks {
+		hooks[e] = matchers
+	}
+	hooks[event] = append(append([]types.HookMatcher(nil), hooks[event]...), matcher)
+	q.hooks = hooks
+}
+
 // AddMCPServer adds an MCP server for handling MCP messages.
 func (q *Query) AddMCPServer(name string, server types.MCPServer) {
 	q.mu.Lock()
@@ -3,10 +3,13 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
@@ -53,6 +56,25 @@ func (m *mockTransport) Write(ctx context.Context, data string) error {
 	return nil
 }
 
+func (m *mockTransport) WriteBatch(ctx context.Context, lines []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writtenData = append(m.writtenData, lines...)
+	return nil
+}
+
+func (m *mockTransport) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (m *mockTransport) GetError() error {
+	return nil
+}
+
+func (m *mockTransport) EndInput(ctx context.Context) error {
+	return nil
+}
+
 func (m *mockTransport) ReadMessages(ctx context.Context) <-chan types.Message {
 	return m.messagesChan
 }
@@ -83,6 +105,18 @@ func (m *mockTransport) getWrittenData() []string {
 	return append([]string{}, m.writtenData...)
 }
 
+// newTestQuery is NewQuery with strict protocol validation, which the SDK's
+// own tests run with unless they set StrictProtocol themselves.
+func newTestQuery(ctx context.Context, tr transport.Transport, opts *types.ClaudeAgentOptions, isStreamingMode bool) *Query {
+	if opts == nil {
+		opts = types.NewClaudeAgentOptions()
+	}
+	if opts.StrictProtocol == nil {
+		opts.WithStrictProtocol(true)
+	}
+	return NewQuery(ctx, tr, opts, isStreamingMode)
+}
+
 // TestNewQuery tests Query construction.
 func TestNewQuery(t *testing.T) {
 	ctx := context.Background()
@@ -130,7 +164,7 @@ func TestInitialize(t *testing.T) {
 		},
 	)
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	if err := query.Start(ctx); err != nil {
 		t.Fatalf("Start failed: %v", err)
@@ -212,13 +246,57 @@ func TestInitialize(t *testing.T) {
 	}
 }
 
+// TestInterrupt tests that Interrupt sends an interrupt control request.
+func TestInterrupt(t *testing.T) {
+	ctx := context.Background()
+	transport := newMockTransport()
+
+	query := newTestQuery(ctx, transport, nil, true)
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer func() {
+		_ = query.Stop(ctx)
+	}()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		for _, data := range transport.getWrittenData() {
+			var sent map[string]interface{}
+			if err := json.Unmarshal([]byte(data), &sent); err != nil {
+				continue
+			}
+			request, _ := sent["request"].(map[string]interface{})
+			if request["subtype"] != "interrupt" {
+				continue
+			}
+			transport.sendMessage(&types.SystemMessage{
+				Type: "control_response",
+				Data: map[string]interface{}{
+					"response": map[string]interface{}{
+						"subtype":    "success",
+						"request_id": sent["request_id"],
+					},
+				},
+			})
+			return
+		}
+	}()
+
+	interruptCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if err := query.Interrupt(interruptCtx); err != nil {
+		t.Fatalf("Interrupt failed: %v", err)
+	}
+}
+
 // TestErrorResponse tests error response handling.
 func TestErrorResponse(t *testing.T) {
 	ctx := context.Background()
 	transport := newMockTransport()
 	opts := types.NewClaudeAgentOptions()
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	if err := query.Start(ctx); err != nil {
 		t.Fatalf("Start failed: %v", err)
@@ -292,7 +370,7 @@ func TestQueryStartStop(t *testing.T) {
 	transport := newMockTransport()
 	opts := types.NewClaudeAgentOptions()
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	// Start the query
 	if err := query.Start(ctx); err != nil {
@@ -323,12 +401,71 @@ func TestQueryStartStop(t *testing.T) {
 	}
 }
 
+// TestHandlePermissionRequest_Context tests that the permission context
+// carries the IDs that match the request to the assistant message that made
+// the tool call, and the blocked path.
+func TestHandlePermissionRequest_Context(t *testing.T) {
+	msg, err := ParseMessage(assistantMessageSubagentToolUse)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	assistant := msg.(*types.AssistantMessage)
+	block := assistant.Content[0].(*types.ToolUseBlock)
+
+	var got []types.ToolPermissionContext
+	opts := types.NewClaudeAgentOptions().WithCanUseTool(
+		func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			got = append(got, permCtx)
+			return &types.PermissionResultDeny{Behavior: "deny"}, nil
+		},
+	)
+	query := newTestQuery(context.Background(), newMockTransport(), opts, true)
+
+	requests := []map[string]interface{}{
+		{
+			"subtype":            "can_use_tool",
+			"tool_name":          block.Name,
+			"input":              block.Input,
+			"tool_use_id":        block.ID,
+			"parent_tool_use_id": *assistant.ParentToolUseID,
+			"blocked_path":       "/etc/hosts",
+		},
+		// Older CLIs send none of them
+		{
+			"subtype":   "can_use_tool",
+			"tool_name": block.Name,
+			"input":     block.Input,
+		},
+	}
+	for _, request := range requests {
+		if _, err := query.handlePermissionRequest(request); err != nil {
+			t.Fatalf("handlePermissionRequest failed: %v", err)
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("callback called %d times, want 2", len(got))
+	}
+	if got[0].ToolUseID != "toolu_write_7" || got[0].ToolUseID != block.ID {
+		t.Errorf("ToolUseID = %q, want the tool use block's %q", got[0].ToolUseID, block.ID)
+	}
+	if got[0].ParentToolUseID != "toolu_task_3" {
+		t.Errorf("ParentToolUseID = %q, want the message's toolu_task_3", got[0].ParentToolUseID)
+	}
+	if got[0].BlockedPath != "/etc/hosts" {
+		t.Errorf("BlockedPath = %q, want /etc/hosts", got[0].BlockedPath)
+	}
+	if got[1].ToolUseID != "" || got[1].ParentToolUseID != "" || got[1].BlockedPath != "" {
+		t.Errorf("context without IDs = %+v, want them empty", got[1])
+	}
+}
+
 // TestHandlePermissionRequest tests permission callback handling.
 func TestHandlePermissionRequest(t *testing.T) {
 	tests := []struct {
 		name           string
 		requestData    map[string]interface{}
-		callbackResult interface{}
+		callbackResult types.PermissionResult
 		callbackError  error
 		expectedError  bool
 		expectedResult map[string]interface{}
@@ -384,6 +521,16 @@ func TestHandlePermissionRequest(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "nil result",
+			requestData: map[string]interface{}{
+				"subtype":   "can_use_tool",
+				"tool_name": "Bash",
+				"input":     map[string]interface{}{"command": "ls"},
+			},
+			callbackResult: (*types.PermissionResultDeny)(nil),
+			expectedError:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -392,7 +539,7 @@ func TestHandlePermissionRequest(t *testing.T) {
 			transport := newMockTransport()
 
 			opts := types.NewClaudeAgentOptions().WithCanUseTool(
-				func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+				func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
 					if tt.callbackError != nil {
 						return nil, tt.callbackError
 					}
@@ -400,7 +547,7 @@ func TestHandlePermissionRequest(t *testing.T) {
 				},
 			)
 
-			query := NewQuery(ctx, transport, opts, true)
+			query := newTestQuery(ctx, transport, opts, true)
 
 			result, err := query.handlePermissionRequest(tt.requestData)
 			if tt.expectedError && err == nil {
@@ -428,6 +575,13 @@ func TestHandlePermissionRequest(t *testing.T) {
 						}
 					}
 				}
+
+				// Check updated input for allow
+				if expectedInput, ok := tt.expectedResult["updatedInput"]; ok {
+					if !reflect.DeepEqual(result["updatedInput"], expectedInput) {
+						t.Errorf("updatedInput mismatch: got %v, want %v", result["updatedInput"], expectedInput)
+					}
+				}
 			}
 		})
 	}
@@ -445,7 +599,7 @@ func TestHandleHookCallback(t *testing.T) {
 	}
 
 	opts := types.NewClaudeAgentOptions()
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	// Register a hook callback
 	callback := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
@@ -479,13 +633,264 @@ func TestHandleHookCallback(t *testing.T) {
 	}
 }
 
+// TestHandleHookCallbackFieldAliases tests that camelCase field names from
+// some CLI versions reach callbacks under the snake_case names.
+func TestHandleHookCallbackFieldAliases(t *testing.T) {
+	for _, casing := range []string{"snake_case", "camelCase"} {
+		t.Run(casing, func(t *testing.T) {
+			query := newTestQuery(context.Background(), newMockTransport(), types.NewClaudeAgentOptions(), true)
+
+			var gotInput map[string]interface{}
+			var gotToolUseID *string
+			callbackID := query.registerHookCallback(func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+				gotInput, _ = input.(map[string]interface{})
+				gotToolUseID = toolUseID
+				return map[string]interface{}{}, nil
+			})
+
+			requestData := map[string]interface{}{
+				"subtype":     "hook_callback",
+				"callback_id": callbackID,
+				"tool_use_id": "toolu_1",
+				"input": map[string]interface{}{
+					"hook_event_name": "PreToolUse",
+					"tool_name":       "Bash",
+				},
+			}
+			if casing == "camelCase" {
+				delete(requestData, "tool_use_id")
+				requestData["toolUseId"] = "toolu_1"
+				requestData["input"] = map[string]interface{}{
+					"hookEventName": "PreToolUse",
+					"tool_name":     "Bash",
+				}
+			}
+
+			if _, err := query.handleHookCallback(requestData); err != nil {
+				t.Fatalf("handleHookCallback failed: %v", err)
+			}
+			if gotInput["hook_event_name"] != "PreToolUse" {
+				t.Errorf("hook_event_name = %v, want PreToolUse", gotInput["hook_event_name"])
+			}
+			if _, ok := gotInput["hookEventName"]; ok {
+				t.Error("alternate name still present in input")
+			}
+			if gotToolUseID == nil || *gotToolUseID != "toolu_1" {
+				t.Errorf("toolUseID = %v, want toolu_1", gotToolUseID)
+			}
+		})
+	}
+}
+
+// TestHandleHookCallbackLifecycleEvents tests that lifecycle hook events
+// reach callbacks with their typed input, and that an event the SDK does not
+// know is passed through as a generic input.
+func TestHandleHookCallbackLifecycleEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		check   func(t *testing.T, input interface{})
+	}{
+		{
+			name:    "Notification",
+			request: hookCallbackNotification,
+			check: func(t *testing.T, input interface{}) {
+				n, ok := input.(*types.NotificationHookInput)
+				if !ok {
+					t.Fatalf("input = %T, want *types.NotificationHookInput", input)
+				}
+				if n.Message != "Claude needs your permission to use Bash" || n.Title == nil || *n.Title != "Claude Code" {
+					t.Errorf("input = %+v, want the message and title", n)
+				}
+				if n.SessionID != "session_hooks" || n.CWD != "/home/user/app" {
+					t.Errorf("base input = %+v, want the session and cwd", n.BaseHookInput)
+				}
+			},
+		},
+		{
+			name:    "SessionStart",
+			request: hookCallbackSessionStart,
+			check: func(t *testing.T, input interface{}) {
+				s, ok := input.(*types.SessionStartHookInput)
+				if !ok {
+					t.Fatalf("input = %T, want *types.SessionStartHookInput", input)
+				}
+				if s.Source != "resume" {
+					t.Errorf("Source = %q, want resume", s.Source)
+				}
+			},
+		},
+		{
+			name:    "SessionEnd",
+			request: hookCallbackSessionEnd,
+			check: func(t *testing.T, input interface{}) {
+				s, ok := input.(*types.SessionEndHookInput)
+				if !ok {
+					t.Fatalf("input = %T, want *types.SessionEndHookInput", input)
+				}
+				if s.HookEventName != "SessionEnd" || s.Reason != "prompt_input_exit" {
+					t.Errorf("input = %+v, want SessionEnd for prompt_input_exit", s)
+				}
+			},
+		},
+		{
+			name:    "unknown event",
+			request: hookCallbackUnknownEvent,
+			check: func(t *testing.T, input interface{}) {
+				g, ok := input.(*types.GenericHookInput)
+				if !ok {
+					t.Fatalf("input = %T, want *types.GenericHookInput", input)
+				}
+				if g.HookEventName != "PostCompact" || g.SessionID != "session_hooks" || g.Fields["summary_tokens"] != float64(1200) {
+					t.Errorf("input = %+v, want the event's name, session and fields", g)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := newTestQuery(context.Background(), newMockTransport(), types.NewClaudeAgentOptions(), true)
+
+			var gotCtx *types.HookContext
+			var gotInput map[string]interface{}
+			callbackID := query.registerHookCallback(func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+				gotCtx = &hookCtx
+				gotInput, _ = input.(map[string]interface{})
+				return map[string]interface{}{}, nil
+			})
+
+			var requestData map[string]interface{}
+			if err := json.Unmarshal(tt.request, &requestData); err != nil {
+				t.Fatalf("bad fixture: %v", err)
+			}
+			requestData["callback_id"] = callbackID
+			if _, err := query.handleHookCallback(requestData); err != nil {
+				t.Fatalf("handleHookCallback failed: %v", err)
+			}
+
+			if gotCtx == nil {
+				t.Fatal("hook callback was not called")
+			}
+			// Callbacks still get the input as a map
+			if gotInput == nil {
+				t.Error("callback input is not a map")
+			}
+			tt.check(t, gotCtx.Input)
+		})
+	}
+}
+
+// TestHandleHookCallbackOutputs tests that hook output structs and typed
+// hookSpecificOutput values are sent as their JSON form, with the
+// hookEventName of the event that fired when the output names none.
+func TestHandleHookCallbackOutputs(t *testing.T) {
+	deny := "deny"
+	reason := "no network"
+	updated := map[string]interface{}{"command": "ls -la", "options": map[string]interface{}{"timeout": 5}}
+
+	tests := []struct {
+		name    string
+		output  interface{}
+		want    string
+		wantErr string
+	}{
+		{
+			name: "sync output struct",
+			output: &types.SyncHookJSONOutput{
+				HookSpecificOutput: &types.PreToolUseHookSpecificOutput{
+					HookEventName: "PreToolUse",
+					UpdatedInput:  &updated,
+				},
+			},
+			want: `{"hookSpecificOutput":{"hookEventName":"PreToolUse","updatedInput":{"command":"ls -la","options":{"timeout":5}}}}`,
+		},
+		{
+			name: "sync output value",
+			output: types.SyncHookJSONOutput{
+				HookSpecificOutput: types.PreToolUseHookSpecificOutput{
+					PermissionDecision:       &deny,
+					PermissionDecisionReason: &reason,
+				},
+			},
+			want: `{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"deny","permissionDecisionReason":"no network"}}`,
+		},
+		{
+			name: "typed output in a map",
+			output: map[string]interface{}{
+				"continue":           true,
+				"hookSpecificOutput": &types.PreToolUseHookSpecificOutput{UpdatedInput: &updated},
+			},
+			want: `{"continue":true,"hookSpecificOutput":{"hookEventName":"PreToolUse","updatedInput":{"command":"ls -la","options":{"timeout":5}}}}`,
+		},
+		{
+			name:   "map unchanged",
+			output: map[string]interface{}{"hookSpecificOutput": map[string]interface{}{"hookEventName": "PreToolUse", "permissionDecision": "allow"}},
+			want:   `{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"allow"}}`,
+		},
+		{
+			name:   "async output",
+			output: types.AsyncHookJSONOutput{Async: true},
+			want:   `{"async":true}`,
+		},
+		{
+			name:   "nil hookSpecificOutput dropped",
+			output: types.SyncHookJSONOutput{HookSpecificOutput: (*types.PreToolUseHookSpecificOutput)(nil)},
+			want:   `{}`,
+		},
+		{
+			name:    "not an object",
+			output:  "allow",
+			wantErr: "got string",
+		},
+		{
+			name:    "hookSpecificOutput not an object",
+			output:  map[string]interface{}{"hookSpecificOutput": []string{"deny"}},
+			wantErr: "hookSpecificOutput must be a JSON object",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := newTestQuery(context.Background(), newMockTransport(), types.NewClaudeAgentOptions(), true)
+			callbackID := query.registerHookCallback(func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+				return tt.output, nil
+			})
+
+			response, err := query.handleHookCallback(map[string]interface{}{
+				"subtype":     "hook_callback",
+				"callback_id": callbackID,
+				"input": map[string]interface{}{
+					"hook_event_name": "PreToolUse",
+					"tool_name":       "Bash",
+					"tool_input":      map[string]interface{}{"command": "ls"},
+				},
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("handleHookCallback error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleHookCallback failed: %v", err)
+			}
+			data, err := json.Marshal(response)
+			if err != nil {
+				t.Fatalf("marshal response: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("response = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
 // TestHandleMCPMessage tests MCP message routing.
 func TestHandleMCPMessage(t *testing.T) {
 	ctx := context.Background()
 	transport := newMockTransport()
 	opts := types.NewClaudeAgentOptions()
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	// Add a mock MCP server
 	mockServer := &mockMCPServer{
@@ -548,7 +953,7 @@ func TestRequestResponseCorrelation(t *testing.T) {
 	transport := newMockTransport()
 	opts := types.NewClaudeAgentOptions()
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	if err := query.Start(ctx); err != nil {
 		t.Fatalf("Start failed: %v", err)
@@ -631,7 +1036,7 @@ func TestMessageRouting(t *testing.T) {
 	transport := newMockTransport()
 	opts := types.NewClaudeAgentOptions()
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	if err := query.Start(ctx); err != nil {
 		t.Fatalf("Start failed: %v", err)
@@ -669,7 +1074,7 @@ func TestControlMessageFiltering(t *testing.T) {
 	transport := newMockTransport()
 	opts := types.NewClaudeAgentOptions()
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	if err := query.Start(ctx); err != nil {
 		t.Fatalf("Start failed: %v", err)
@@ -721,7 +1126,7 @@ func TestConcurrentRequests(t *testing.T) {
 	transport := newMockTransport()
 	opts := types.NewClaudeAgentOptions()
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	if err := query.Start(ctx); err != nil {
 		t.Fatalf("Start failed: %v", err)
@@ -826,7 +1231,7 @@ func TestContextCancellation(t *testing.T) {
 	transport := newMockTransport()
 	opts := types.NewClaudeAgentOptions()
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	if err := query.Start(ctx); err != nil {
 		t.Fatalf("Start failed: %v", err)
@@ -849,6 +1254,38 @@ func TestContextCancellation(t *testing.T) {
 	}
 }
 
+// TestControlRequestOutputEnded tests that a pending control request fails
+// once the CLI's output ends instead of waiting for its context.
+func TestControlRequestOutputEnded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	transport := newMockTransport()
+	query := newTestQuery(ctx, transport, types.NewClaudeAgentOptions(), true)
+	if err := query.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := query.Initialize(ctx)
+		done <- err
+	}()
+
+	// The CLI dies before answering
+	time.Sleep(20 * time.Millisecond)
+	_ = transport.Close(ctx)
+
+	select {
+	case err := <-done:
+		if !types.IsControlProtocolError(err) {
+			t.Errorf("Initialize error = %v, want ControlProtocolError", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Initialize did not return after the CLI output ended")
+	}
+}
+
 // TestCallbackTimeouts tests timeout handling for callbacks.
 func TestCallbackTimeouts(t *testing.T) {
 	ctx := context.Background()
@@ -856,7 +1293,7 @@ func TestCallbackTimeouts(t *testing.T) {
 
 	// Create a callback that times out
 	opts := types.NewClaudeAgentOptions().WithCanUseTool(
-		func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+		func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
 			// Simulate slow callback
 			select {
 			case <-time.After(5 * time.Second):
@@ -867,7 +1304,7 @@ func TestCallbackTimeouts(t *testing.T) {
 		},
 	)
 
-	query := NewQuery(ctx, transport, opts, true)
+	query := newTestQuery(ctx, transport, opts, true)
 
 	requestData := map[string]interface{}{
 		"subtype":   "can_use_tool",
@@ -910,3 +1347,86 @@ func (m *mockMCPServer) Name() string {
 func (m *mockMCPServer) Version() string {
 	return m.version
 }
+
+// toolsMCPServer answers tools/list with fixed tools, or with an error.
+type toolsMCPServer struct {
+	mockMCPServer
+	tools []interface{}
+	err   string
+}
+
+func (m *toolsMCPServer) HandleMessage(message map[string]interface{}) (map[string]interface{}, error) {
+	if message["method"] != "tools/list" {
+		return m.mockMCPServer.HandleMessage(message)
+	}
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": message["id"]}
+	if m.err != "" {
+		response["error"] = map[string]interface{}{"code": -32603, "message": m.err}
+	} else {
+		response["result"] = map[string]interface{}{"tools": m.tools}
+	}
+	return response, nil
+}
+
+// TestListMCPTools tests that in-process servers configured in the options
+// are registered and asked for their tools.
+func TestListMCPTools(t *testing.T) {
+	calc := &toolsMCPServer{tools: []interface{}{
+		map[string]interface{}{
+			"name":        "add",
+			"description": "Add two numbers",
+			"inputSchema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"a": map[string]interface{}{"type": "number"}},
+			},
+		},
+		map[string]interface{}{"name": "sub"},
+	}}
+	broken := &toolsMCPServer{err: "boom"}
+
+	opts := types.NewClaudeAgentOptions().WithMcpServers(map[string]interface{}{
+		"calc":   types.McpSdkServerConfig{Type: "sdk", Name: "calc", Instance: calc},
+		"broken": &types.McpSdkServerConfig{Type: "sdk", Name: "broken", Instance: broken},
+		"opaque": types.McpSdkServerConfig{Type: "sdk", Name: "opaque", Instance: "not a server"},
+		"remote": types.McpHTTPServerConfig{Type: "http", URL: "http://localhost:1"},
+	})
+	q := newTestQuery(context.Background(), newMockTransport(), opts, true)
+
+	tools, err := q.ListMCPTools()
+	if err == nil || !strings.Contains(err.Error(), `MCP server "broken"`) || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("error = %v, want the broken server's failure", err)
+	}
+	if _, ok := tools["broken"]; ok {
+		t.Error("failed server has an entry")
+	}
+	if len(tools) != 1 {
+		t.Fatalf("listed servers %v, want only calc", tools)
+	}
+
+	calcTools := tools["calc"]
+	if len(calcTools) != 2 {
+		t.Fatalf("calc tools = %+v, want 2", calcTools)
+	}
+	add := calcTools[0]
+	if add.Name != "mcp__calc__add" || add.Server != "calc" || add.Description != "Add two numbers" {
+		t.Errorf("add = %+v", add)
+	}
+	if add.InputSchema["type"] != "object" || add.InputSchema["properties"] == nil {
+		t.Errorf("add schema = %v", add.InputSchema)
+	}
+	if sub := calcTools[1]; sub.Name != "mcp__calc__sub" || sub.InputSchema != nil {
+		t.Errorf("sub = %+v", sub)
+	}
+
+	// The registered server also answers the CLI's mcp_message requests
+	result, err := q.handleMCPMessage(map[string]interface{}{
+		"server_name": "calc",
+		"message":     map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "tools/list"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := result["mcp_response"].(map[string]interface{}); resp["error"] != nil {
+		t.Errorf("mcp_message for calc failed: %v", resp)
+	}
+}
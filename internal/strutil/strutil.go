@@ -0,0 +1,117 @@
+// Package strutil truncates strings for error messages and logs without
+// producing invalid UTF-8 or broken JSON escapes.
+package strutil
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ellipsis is appended by Truncate when it shortens a string.
+const Ellipsis = "..."
+
+// replacement stands in for invalid UTF-8.
+const replacement = "\uFFFD"
+
+// Truncate shortens s to at most maxBytes bytes followed by Ellipsis. The cut
+// never splits a multi-byte rune, and invalid UTF-8 in s is replaced with
+// U+FFFD, so the result is always valid UTF-8.
+func Truncate(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return strings.ToValidUTF8(s, replacement)
+	}
+	return strings.ToValidUTF8(s[:runeBoundary(s, maxBytes)], replacement) + Ellipsis
+}
+
+// TruncateJSON shortens a raw JSON preview to at most maxBytes bytes of the
+// original, followed by a "...(N bytes)" marker giving the full size. Besides
+// keeping runes whole, the cut never splits a backslash escape or a \u
+// surrogate pair, and a string literal left open by the cut is closed with a
+// quote so log pipelines do not see an unbalanced quote. The result is always
+// valid UTF-8.
+func TruncateJSON(raw string, maxBytes int) string {
+	if len(raw) <= maxBytes {
+		return strings.ToValidUTF8(raw, replacement)
+	}
+
+	cut, inString := jsonBoundary(raw, runeBoundary(raw, maxBytes))
+	var b strings.Builder
+	b.WriteString(strings.ToValidUTF8(raw[:cut], replacement))
+	if inString {
+		b.WriteByte('"')
+	}
+	b.WriteString(Ellipsis + "(" + strconv.Itoa(len(raw)) + " bytes)")
+	return b.String()
+}
+
+// runeBoundary moves n back to the start of the rune it falls in. For
+// invalid UTF-8 it backs off at most utf8.UTFMax-1 bytes.
+func runeBoundary(s string, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if n >= len(s) {
+		return len(s)
+	}
+	for i := 0; i < utf8.UTFMax-1 && n > 0 && !utf8.RuneStart(s[n]); i++ {
+		n--
+	}
+	return n
+}
+
+// jsonBoundary moves cut back so it does not split an escape sequence in a
+// string literal, and reports whether the cut falls inside a string.
+func jsonBoundary(raw string, cut int) (int, bool) {
+	inString := false
+	for i := 0; i < cut; {
+		c := raw[i]
+		if !inString {
+			if c == '"' {
+				inString = true
+			}
+			i++
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = false
+			i++
+		case '\\':
+			n := escapeLen(raw, i)
+			if i+n > cut {
+				return i, true
+			}
+			i += n
+		default:
+			i++
+		}
+	}
+	return cut, inString
+}
+
+// escapeLen returns the length of the escape sequence starting at raw[i],
+// counting a \u high surrogate and the low surrogate that follows it as one.
+func escapeLen(raw string, i int) int {
+	if i+1 >= len(raw) || raw[i+1] != 'u' {
+		return 2
+	}
+	if !isSurrogate(raw, i, 0xD800, 0xDBFF) {
+		return 6
+	}
+	if isSurrogate(raw, i+6, 0xDC00, 0xDFFF) {
+		return 12
+	}
+	return 6
+}
+
+// isSurrogate reports whether raw[i:] starts with a \uXXXX escape whose code
+// unit lies in [lo, hi].
+func isSurrogate(raw string, i int, lo, hi uint64) bool {
+	if i+6 > len(raw) || raw[i] != '\\' || raw[i+1] != 'u' {
+		return false
+	}
+	unit, err := strconv.ParseUint(raw[i+2:i+6], 16, 16)
+	return err == nil && unit >= lo && unit <= hi
+}
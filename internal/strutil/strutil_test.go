@@ -0,0 +1,152 @@
+package strutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		maxBytes int
+		want     string
+	}{
+		{"short", "short", 10, "short"},
+		{"exact length", "exact", 5, "exact"},
+		{"ascii", "this is a very long string", 10, "this is a ..."},
+		{"empty", "", 10, ""},
+		{"zero limit", "abc", 0, "..."},
+		{"keeps whole rune", "héllo", 2, "h..."},
+		{"cut after rune", "héllo", 3, "hé..."},
+		{"emoji", "a😀b", 3, "a..."},
+		{"invalid input", "ab\xffcd", 10, "ab�cd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Truncate(tt.input, tt.maxBytes); got != tt.want {
+				t.Errorf("Truncate(%q, %d) = %q, want %q", tt.input, tt.maxBytes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		maxBytes int
+		want     string
+	}{
+		{"short", `{"a":1}`, 20, `{"a":1}`},
+		{"outside string", `{"a":1,"b":2}`, 6, `{"a":1...(13 bytes)`},
+		{"inside string", `{"a":"hello"}`, 8, `{"a":"he"...(13 bytes)`},
+		{"simple escape", `{"a":"x\ny"}`, 8, `{"a":"x"...(12 bytes)`},
+		{"unicode escape", `{"a":"\u00e9"}`, 10, `{"a":""...(14 bytes)`},
+		{"surrogate pair", `{"a":"\ud83d\ude00"}`, 14, `{"a":""...(20 bytes)`},
+		{"after surrogate pair", `{"a":"\ud83d\ude00b"}`, 18, `{"a":"\ud83d\ude00"...(21 bytes)`},
+		{"escaped quote", `{"a":"\"x"}`, 9, `{"a":"\"x"...(11 bytes)`},
+		{"multibyte", `{"a":"é"}`, 7, `{"a":""...(10 bytes)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TruncateJSON(tt.input, tt.maxBytes); got != tt.want {
+				t.Errorf("TruncateJSON(%q, %d) = %q, want %q", tt.input, tt.maxBytes, got, tt.want)
+			}
+		})
+	}
+}
+
+// alphabet mixes ASCII, JSON metacharacters, and 2-, 3- and 4-byte runes.
+var alphabet = []rune("ab \"\\/\n\té€中😀🎉 ")
+
+// randomString returns a random string of up to 40 runes from alphabet,
+// sometimes with an invalid byte mixed in.
+func randomString(r *rand.Rand) string {
+	var b strings.Builder
+	for i := r.Intn(40); i > 0; i-- {
+		if r.Intn(20) == 0 {
+			b.WriteByte(byte(0x80 + r.Intn(0x40)))
+			continue
+		}
+		b.WriteRune(alphabet[r.Intn(len(alphabet))])
+	}
+	return b.String()
+}
+
+// randomJSONString encodes s as a JSON string literal, writing each rune
+// either raw or as a \u escape (a surrogate pair outside the BMP).
+func randomJSONString(r *rand.Rand, s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c < 0x20 || r.Intn(2) == 0:
+			if c > 0xFFFF {
+				hi, lo := utf16.EncodeRune(c)
+				fmt.Fprintf(&b, `\u%04x\u%04x`, hi, lo)
+			} else {
+				fmt.Fprintf(&b, `\u%04x`, c)
+			}
+		default:
+			b.WriteRune(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func TestTruncate_AlwaysValidUTF8(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		s := randomString(r)
+		max := r.Intn(len(s) + 2)
+		got := Truncate(s, max)
+		if !utf8.ValidString(got) {
+			t.Fatalf("Truncate(%q, %d) = %q is not valid UTF-8", s, max, got)
+		}
+		if utf8.ValidString(s) && len(strings.TrimSuffix(got, Ellipsis)) > max {
+			t.Fatalf("Truncate(%q, %d) = %q is too long", s, max, got)
+		}
+	}
+}
+
+func TestTruncateJSON_AlwaysValid(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		// Valid UTF-8 only, so the literal round-trips through encoding/json
+		literal := randomJSONString(r, strings.ToValidUTF8(randomString(r), ""))
+		raw := `{"text":` + literal + `}`
+		max := r.Intn(len(raw) + 2)
+
+		got := TruncateJSON(raw, max)
+		if !utf8.ValidString(got) {
+			t.Fatalf("TruncateJSON(%q, %d) = %q is not valid UTF-8", raw, max, got)
+		}
+		if len(raw) <= max {
+			continue
+		}
+
+		// The truncated prefix of the literal must itself be a valid literal
+		prefix := strings.TrimSuffix(got, fmt.Sprintf("%s(%d bytes)", Ellipsis, len(raw)))
+		if prefix == got {
+			t.Fatalf("TruncateJSON(%q, %d) = %q has no size marker", raw, max, got)
+		}
+		if start := len(`{"text":`); len(prefix) > start {
+			var s string
+			if err := json.Unmarshal([]byte(prefix[start:]), &s); err != nil {
+				t.Fatalf("TruncateJSON(%q, %d) = %q leaves an invalid string literal: %v", raw, max, got, err)
+			}
+		}
+	}
+}
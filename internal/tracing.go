@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// SetTracer sets the tracer that permission round trips are traced with,
+// and parent, which returns the context to start their spans under. It must
+// be called before Start.
+func (q *Query) SetTracer(tracer types.Tracer, parent func() context.Context) {
+	q.tracer = tracer
+	q.traceParent = parent
+}
+
+// startPermissionSpan starts the span of a can_use_tool round trip, or
+// returns nil without a tracer.
+func (q *Query) startPermissionSpan(toolName, toolUseID string) types.Span {
+	if q.tracer == nil {
+		return nil
+	}
+	ctx := q.ctx
+	if q.traceParent != nil {
+		ctx = q.traceParent()
+	}
+	attrs := map[string]interface{}{types.AttrToolName: toolName}
+	if toolUseID != "" {
+		attrs[types.AttrToolUseID] = toolUseID
+	}
+	_, span := q.tracer.Start(ctx, types.SpanPermission, attrs)
+	return span
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"context"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// withTranscriptHook returns hooks with a no-op UserPromptSubmit hook added,
+// so the CLI sends a hook callback carrying the transcript path on the first
+// prompt. The caller's map is not modified, and nothing is added if a
+// UserPromptSubmit hook is already registered.
+func withTranscriptHook(hooks map[types.HookEvent][]types.HookMatcher) map[types.HookEvent][]types.HookMatcher {
+	if len(hooks[types.HookEventUserPromptSubmit]) > 0 {
+		return hooks
+	}
+
+	out := make(map[types.HookEvent][]types.HookMatcher, len(hooks)+1)
+	for event, matchers := range hooks {
+		out[event] = matchers
+	}
+	out[types.HookEventUserPromptSubmit] = []types.HookMatcher{{
+		Hooks: []types.HookCallbackFunc{
+			func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+				return map[string]interface{}{}, nil
+			},
+		},
+	}}
+	return out
+}
+
+// captureTranscriptPath records the transcript_path field of a hook input or
+// init message the first time one is seen.
+func (q *Query) captureTranscriptPath(data interface{}) {
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	path, _ := fields["transcript_path"].(string)
+	if path == "" {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.transcriptPath == "" {
+		q.transcriptPath = path
+	}
+}
+
+// TranscriptPath returns the path of the CLI's session transcript, or "" if
+// the CLI has not reported it yet.
+func (q *Query) TranscriptPath() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.transcriptPath
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestWithTranscriptHook(t *testing.T) {
+	noop := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return map[string]interface{}{}, nil
+	}
+
+	hooks := map[types.HookEvent][]types.HookMatcher{
+		types.HookEventPreToolUse: {{Hooks: []types.HookCallbackFunc{noop}}},
+	}
+	got := withTranscriptHook(hooks)
+	if len(got[types.HookEventUserPromptSubmit]) != 1 {
+		t.Errorf("expected one UserPromptSubmit matcher, got %d", len(got[types.HookEventUserPromptSubmit]))
+	}
+	if len(got[types.HookEventPreToolUse]) != 1 {
+		t.Error("existing hooks were dropped")
+	}
+	if _, ok := hooks[types.HookEventUserPromptSubmit]; ok {
+		t.Error("caller's hooks map was modified")
+	}
+
+	// An application UserPromptSubmit hook already reports the path
+	hooks[types.HookEventUserPromptSubmit] = []types.HookMatcher{{Hooks: []types.HookCallbackFunc{noop}}}
+	if got := withTranscriptHook(hooks); len(got[types.HookEventUserPromptSubmit]) != 1 {
+		t.Errorf("expected the application matcher only, got %d", len(got[types.HookEventUserPromptSubmit]))
+	}
+
+	if got := withTranscriptHook(nil); len(got[types.HookEventUserPromptSubmit]) != 1 {
+		t.Error("expected a matcher for nil hooks")
+	}
+}
+
+func TestQuery_CaptureTranscriptPath(t *testing.T) {
+	q := newTestQuery(context.Background(), newMockTransport(), nil, true)
+
+	q.captureTranscriptPath("not a map")
+	q.captureTranscriptPath(map[string]interface{}{"session_id": "s1"})
+	if got := q.TranscriptPath(); got != "" {
+		t.Errorf("TranscriptPath = %q, want empty", got)
+	}
+
+	q.captureTranscriptPath(map[string]interface{}{"transcript_path": "/tmp/first.jsonl"})
+	q.captureTranscriptPath(map[string]interface{}{"transcript_path": "/tmp/second.jsonl"})
+	if got := q.TranscriptPath(); got != "/tmp/first.jsonl" {
+		t.Errorf("TranscriptPath = %q, want the first reported path", got)
+	}
+}
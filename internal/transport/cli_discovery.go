@@ -5,6 +5,8 @@ import (
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/schlunsen/claude-agent-sdk-go/types"
@@ -19,41 +21,158 @@ import (
 //     - ~/.local/bin/claude
 //     - ~/node_modules/.bin/claude
 //     - ~/.yarn/bin/claude
+//  3. Node version managers and other package managers:
+//     - ~/.nvm/versions/node/*/bin/claude (newest Node version first)
+//     - ~/.fnm/aliases/default/bin/claude, then fnm's node-versions, under
+//     ~/.fnm and ~/.local/share/fnm
+//     - ~/.volta/bin/claude
+//     - ~/.bun/bin/claude
+//     - /opt/homebrew/bin/claude, /home/linuxbrew/.linuxbrew/bin/claude,
+//     and the node formula's bin under /opt/homebrew/opt and /usr/local/opt
 //
-// Returns the path to the CLI binary or a CLINotFoundError if not found.
+// A location matches only if it resolves, following symlinks, to an
+// executable file. The path returned is the location itself, not the symlink
+// target, since shims such as Volta's dispatch on the name they are run as.
+//
+// Returns the path to the CLI binary or a CLINotFoundError listing every path
+// that was checked.
 func FindCLI() (string, error) {
 	// First, try to find in PATH
 	if cliPath, err := exec.LookPath("claude"); err == nil {
 		return cliPath, nil
 	}
 
-	// Try common install locations
-	locations := []string{
-		"~/.npm-global/bin/claude",
-		"/usr/local/bin/claude",
-		"~/.local/bin/claude",
-		"~/node_modules/.bin/claude",
-		"~/.yarn/bin/claude",
-	}
-
-	for _, location := range locations {
-		expandedPath := expandHome(location)
-		if _, err := os.Stat(expandedPath); err == nil {
-			return expandedPath, nil
-		}
+	cliPath, searched := findCLIIn(cliLocations(homeDir()))
+	if cliPath != "" {
+		return cliPath, nil
 	}
 
 	// Not found anywhere
-	return "", types.NewCLINotFoundError(
+	return "", cliNotFoundError(searched)
+}
+
+// cliNotFoundError reports a failed search that checked the given paths
+// after PATH.
+func cliNotFoundError(searched []string) *types.CLINotFoundError {
+	err := types.NewCLINotFoundError(
 		"Claude Code not found. Install with:\n" +
 			"  npm install -g @anthropic-ai/claude-code\n" +
 			"\nIf already installed locally, try:\n" +
 			"  export PATH=\"$HOME/node_modules/.bin:$PATH\"\n" +
 			"\nOr provide the path via ClaudeAgentOptions:\n" +
-			"  ClaudeAgentOptions{CLIPath: \"/path/to/claude\"}",
+			"  ClaudeAgentOptions{CLIPath: \"/path/to/claude\"}\n" +
+			"\nSearched $PATH and:\n  " + strings.Join(searched, "\n  "),
+	)
+	err.Searched = searched
+	return err
+}
+
+// cliLocations returns the locations FindCLI checks after PATH, in order.
+// Entries may contain glob patterns. Home-relative entries are omitted when
+// home is empty.
+func cliLocations(home string) []string {
+	var locations []string
+	inHome := func(paths ...string) {
+		if home == "" {
+			return
+		}
+		for _, p := range paths {
+			locations = append(locations, filepath.Join(home, p))
+		}
+	}
+
+	inHome(".npm-global/bin/claude")
+	locations = append(locations, "/usr/local/bin/claude")
+	inHome(
+		".local/bin/claude",
+		"node_modules/.bin/claude",
+		".yarn/bin/claude",
+		".nvm/versions/node/*/bin/claude",
+		".fnm/aliases/default/bin/claude",
+		".fnm/node-versions/*/installation/bin/claude",
+		".local/share/fnm/aliases/default/bin/claude",
+		".local/share/fnm/node-versions/*/installation/bin/claude",
+		".volta/bin/claude",
+		".bun/bin/claude",
+	)
+	return append(locations,
+		"/opt/homebrew/bin/claude",
+		"/opt/homebrew/opt/node/bin/claude",
+		"/usr/local/opt/node/bin/claude",
+		"/home/linuxbrew/.linuxbrew/bin/claude",
 	)
 }
 
+// findCLIIn returns the first of locations that is an executable file, and
+// the paths it checked. A glob pattern is expanded with its matches ordered
+// newest version first, or is listed itself when nothing matches.
+func findCLIIn(locations []string) (found string, searched []string) {
+	for _, location := range locations {
+		candidates := []string{location}
+		if i := strings.IndexAny(location, "*?["); i >= 0 {
+			matches, _ := filepath.Glob(location)
+			if len(matches) == 0 {
+				searched = append(searched, location)
+				continue
+			}
+			sortNewestFirst(matches, len(location[:i]))
+			candidates = matches
+		}
+		for _, candidate := range candidates {
+			searched = append(searched, candidate)
+			if isExecutableFile(candidate) {
+				return candidate, searched
+			}
+		}
+	}
+	return "", searched
+}
+
+// isExecutableFile reports whether path resolves, following symlinks, to a
+// regular file that is executable. Windows has no executable bit, so any
+// regular file counts there.
+func isExecutableFile(path string) bool {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(resolved)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0o111 != 0
+}
+
+// sortNewestFirst orders glob matches that differ in a version directory,
+// such as ~/.nvm/versions/node/v20.11.0/bin/claude, by that version, newest
+// first. Only the part of each path after the pattern's fixed prefix of
+// length prefix is parsed. Paths without a version sort last, in their
+// original order.
+func sortNewestFirst(paths []string, prefix int) {
+	version := func(path string) (types.CLIVersion, bool) {
+		v, err := types.ParseCLIVersion(path[prefix:])
+		return v, err == nil
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		vi, oki := version(paths[i])
+		vj, okj := version(paths[j])
+		if oki != okj {
+			return oki
+		}
+		return oki && vj.Less(vi)
+	})
+}
+
+// homeDir returns the current user's home directory, or "" if it cannot be
+// determined.
+func homeDir() string {
+	usr, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return usr.HomeDir
+}
+
 // expandHome expands the ~ prefix in a path to the user's home directory.
 // If the path does not start with ~, it is returned unchanged.
 // If the home directory cannot be determined, the path is returned unchanged.
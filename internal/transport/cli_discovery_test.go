@@ -0,0 +1,213 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// writeFakeCLI creates an empty file at home/rel with the given mode,
+// creating its directories, and returns its path.
+func writeFakeCLI(t *testing.T, home, rel string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(home, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// homeOnly keeps the locations under home, so tests do not find a CLI
+// installed on the machine running them.
+func homeOnly(home string) []string {
+	var locations []string
+	for _, l := range cliLocations(home) {
+		if strings.HasPrefix(l, home) {
+			locations = append(locations, l)
+		}
+	}
+	return locations
+}
+
+func TestFindCLIIn_Layouts(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout []string // executables to create, relative to home
+		want   string
+	}{
+		{
+			name:   "nvm picks the newest Node version",
+			layout: []string{".nvm/versions/node/v9.11.2/bin/claude", ".nvm/versions/node/v20.11.0/bin/claude", ".nvm/versions/node/v18.19.1/bin/claude"},
+			want:   ".nvm/versions/node/v20.11.0/bin/claude",
+		},
+		{
+			name:   "fnm default alias before installed versions",
+			layout: []string{".fnm/node-versions/v22.1.0/installation/bin/claude", ".fnm/aliases/default/bin/claude"},
+			want:   ".fnm/aliases/default/bin/claude",
+		},
+		{
+			name:   "fnm under XDG data dir",
+			layout: []string{".local/share/fnm/node-versions/v20.0.0/installation/bin/claude"},
+			want:   ".local/share/fnm/node-versions/v20.0.0/installation/bin/claude",
+		},
+		{
+			name:   "volta",
+			layout: []string{".volta/bin/claude"},
+			want:   ".volta/bin/claude",
+		},
+		{
+			name:   "bun",
+			layout: []string{".bun/bin/claude"},
+			want:   ".bun/bin/claude",
+		},
+		{
+			name:   "npm global before version managers",
+			layout: []string{".bun/bin/claude", ".npm-global/bin/claude"},
+			want:   ".npm-global/bin/claude",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			for _, rel := range tt.layout {
+				writeFakeCLI(t, home, rel, 0o755)
+			}
+
+			got, _ := findCLIIn(homeOnly(home))
+			if want := filepath.Join(home, tt.want); got != want {
+				t.Errorf("findCLIIn() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFindCLIIn_SkipsNonExecutable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no executable bit on Windows")
+	}
+	home := t.TempDir()
+	writeFakeCLI(t, home, ".npm-global/bin/claude", 0o644)
+	want := writeFakeCLI(t, home, ".volta/bin/claude", 0o755)
+
+	if got, _ := findCLIIn(homeOnly(home)); got != want {
+		t.Errorf("findCLIIn() = %q, want %q", got, want)
+	}
+}
+
+func TestFindCLIIn_Symlinks(t *testing.T) {
+	home := t.TempDir()
+	target := writeFakeCLI(t, home, ".volta/tools/image/volta-shim", 0o755)
+
+	// A dangling link is skipped
+	bunLink := filepath.Join(home, ".bun/bin/claude")
+	if err := os.MkdirAll(filepath.Dir(bunLink), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(home, "missing"), bunLink); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+
+	// A link to an executable is returned as the link, not its target
+	voltaLink := filepath.Join(home, ".volta/bin/claude")
+	if err := os.MkdirAll(filepath.Dir(voltaLink), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, voltaLink); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := findCLIIn(homeOnly(home)); got != voltaLink {
+		t.Errorf("findCLIIn() = %q, want %q", got, voltaLink)
+	}
+
+	if err := os.Remove(voltaLink); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := findCLIIn(homeOnly(home)); got != "" {
+		t.Errorf("findCLIIn() = %q, want no match for a dangling link", got)
+	}
+}
+
+func TestFindCLIIn_ListsSearchedPaths(t *testing.T) {
+	home := t.TempDir()
+	writeFakeCLI(t, home, ".nvm/versions/node/v20.11.0/bin/claude", 0o644)
+	writeFakeCLI(t, home, ".nvm/versions/node/v18.0.0/bin/claude", 0o644)
+
+	got, searched := findCLIIn(homeOnly(home))
+	if runtime.GOOS != "windows" && got != "" {
+		t.Fatalf("findCLIIn() = %q, want no match", got)
+	}
+
+	for _, want := range []string{
+		filepath.Join(home, ".npm-global/bin/claude"),
+		filepath.Join(home, ".nvm/versions/node/v20.11.0/bin/claude"),
+		filepath.Join(home, ".nvm/versions/node/v18.0.0/bin/claude"),
+		filepath.Join(home, ".fnm/node-versions/*/installation/bin/claude"),
+		filepath.Join(home, ".volta/bin/claude"),
+		filepath.Join(home, ".bun/bin/claude"),
+	} {
+		found := false
+		for _, s := range searched {
+			if s == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("searched paths %q do not include %q", searched, want)
+		}
+	}
+}
+
+func TestCLILocations(t *testing.T) {
+	locations := cliLocations("/home/u")
+	for _, want := range []string{
+		"/usr/local/bin/claude",
+		"/home/u/.nvm/versions/node/*/bin/claude",
+		"/home/u/.volta/bin/claude",
+		"/home/u/.bun/bin/claude",
+		"/opt/homebrew/bin/claude",
+		"/usr/local/opt/node/bin/claude",
+	} {
+		found := false
+		for _, l := range locations {
+			if filepath.ToSlash(l) == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("cliLocations() missing %q", want)
+		}
+	}
+
+	for _, l := range cliLocations("") {
+		if !filepath.IsAbs(l) {
+			t.Errorf("cliLocations(\"\") returned relative path %q", l)
+		}
+	}
+}
+
+func TestCLINotFoundErrorListsPaths(t *testing.T) {
+	home := t.TempDir()
+	_, searched := findCLIIn(homeOnly(home))
+
+	err := cliNotFoundError(searched)
+	if !types.IsCLINotFoundError(err) {
+		t.Fatalf("error type = %T, want *types.CLINotFoundError", err)
+	}
+	if len(err.Searched) != len(searched) {
+		t.Errorf("Searched has %d paths, want %d", len(err.Searched), len(searched))
+	}
+	for _, p := range searched {
+		if !strings.Contains(err.Error(), "\n  "+p+"\n") && !strings.HasSuffix(err.Error(), "\n  "+p) {
+			t.Errorf("error message does not list %q", p)
+		}
+	}
+}
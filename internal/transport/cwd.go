@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ResolveCWD validates the working directory for the CLI subprocess.
+// It expands a leading ~, resolves relative paths against the caller's current
+// directory, and checks that the result is an existing directory. If create is
+// true, a missing directory is created along with any missing parents.
+//
+// An empty cwd is returned unchanged, meaning the subprocess inherits the
+// caller's working directory. Failures are reported as WorkingDirectoryError.
+func ResolveCWD(cwd string, create bool) (string, error) {
+	if cwd == "" {
+		return "", nil
+	}
+
+	resolved, err := AbsPath(cwd)
+	if err != nil {
+		return "", types.NewWorkingDirectoryErrorWithCause("failed to resolve working directory", cwd, err)
+	}
+
+	info, err := os.Stat(resolved)
+	if os.IsNotExist(err) && create {
+		if err := os.MkdirAll(resolved, 0755); err != nil {
+			return "", types.NewWorkingDirectoryErrorWithCause("failed to create working directory", resolved, err)
+		}
+		info, err = os.Stat(resolved)
+	}
+	if os.IsNotExist(err) {
+		return "", types.NewWorkingDirectoryError("working directory does not exist", resolved)
+	}
+	if err != nil {
+		return "", types.NewWorkingDirectoryErrorWithCause("failed to access working directory", resolved, err)
+	}
+	if !info.IsDir() {
+		return "", types.NewWorkingDirectoryError("working directory is not a directory", resolved)
+	}
+
+	return resolved, nil
+}
+
+// AbsPath expands a leading ~ in path and makes it absolute, resolving
+// relative paths against the caller's current directory. Symlinks are kept.
+func AbsPath(path string) (string, error) {
+	return filepath.Abs(expandHome(path))
+}
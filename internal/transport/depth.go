@@ -0,0 +1,35 @@
+package transport
+
+import "bytes"
+
+// exceedsDepth reports whether objects and arrays in line nest more than max
+// levels deep. It counts brackets outside strings without validating the
+// JSON, so it is cheap enough to run on every line before it is decoded.
+func exceedsDepth(line []byte, max int) bool {
+	depth := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"':
+			// Skip the string, jumping between quotes and backslashes
+			for i++; i < len(line); i++ {
+				j := bytes.IndexAny(line[i:], `"\`)
+				if j < 0 {
+					return false
+				}
+				i += j
+				if line[i] == '"' {
+					break
+				}
+				i++ // the escaped character
+			}
+		case '{', '[':
+			depth++
+			if depth > max {
+				return true
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// nested returns a JSON array nested depth levels deep.
+func nested(depth int) string {
+	return strings.Repeat("[", depth) + strings.Repeat("]", depth)
+}
+
+// jsonDepth returns the maximum nesting of valid JSON, as the decoder sees it.
+func jsonDepth(data []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	depth, max := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return max, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+func TestExceedsDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		max   int
+		want  bool
+	}{
+		{"flat object", `{"type":"user"}`, 1, false},
+		{"at the limit", nested(3), 3, false},
+		{"over the limit", nested(4), 3, true},
+		{"siblings do not add up", `[[1],[2],[3],{"a":{}}]`, 3, false},
+		{"brackets in strings", `{"text":"[[[[{{{{"}`, 1, false},
+		{"escaped quote in string", `{"text":"\"[[[[","a":[]}`, 1, true},
+		{"escaped backslash ends string", `{"text":"\\","a":[[]]}`, 2, true},
+		{"unterminated string", `{"text":"[[[[`, 1, false},
+		{"deep nesting", `{"x":` + nested(100000) + `}`, types.DefaultMaxMessageDepth, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exceedsDepth([]byte(tt.input), tt.max); got != tt.want {
+				t.Errorf("exceedsDepth(%.40s, %d) = %v, want %v", tt.input, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+// FuzzExceedsDepth checks the bracket count against the decoder's nesting.
+func FuzzExceedsDepth(f *testing.F) {
+	for _, seed := range []string{
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"[{"}]}}`,
+		`{"a":"\"","b":[["\\"]]}`,
+		nested(64),
+		`{"x":` + nested(2000) + `}`,
+		strings.Repeat(`{"a":`, 500) + `1` + strings.Repeat(`}`, 500),
+		strings.Repeat("[", 10000),
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if !json.Valid(data) {
+			exceedsDepth(data, 8) // must not panic
+			return
+		}
+		depth, err := jsonDepth(data)
+		if err != nil {
+			t.Skip()
+		}
+		for _, max := range []int{1, 8, depth - 1, depth} {
+			if max < 0 {
+				continue
+			}
+			if got, want := exceedsDepth(data, max), depth > max; got != want {
+				t.Fatalf("exceedsDepth(%q, %d) = %v, but the depth is %d", data, max, got, depth)
+			}
+		}
+	})
+}
+
+// benchmarkLine is a typical assistant message with a tool call.
+var benchmarkLine = []byte(`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Let me look at the failing test first; it checks that [brackets] in \"strings\" are handled."},{"type":"tool_use","id":"toolu_01","name":"Bash","input":{"command":"go test ./... -run TestParse","description":"Run the parser tests"}}]},"parent_tool_use_id":null,"session_id":"0b2c5a9e-1f7d-4c2a-9d0e-6b1f2a3c4d5e"}`)
+
+// BenchmarkExceedsDepth measures the depth scan run on every line; compare
+// with BenchmarkUnmarshalLine, the decode it guards.
+func BenchmarkExceedsDepth(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkLine)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if exceedsDepth(benchmarkLine, types.DefaultMaxMessageDepth) {
+			b.Fatal("unexpected depth")
+		}
+	}
+}
+
+// BenchmarkUnmarshalLine measures decoding the same line as BenchmarkExceedsDepth.
+func BenchmarkUnmarshalLine(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkLine)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := types.UnmarshalMessage(benchmarkLine); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestJSONLineReaderSizeLimit(t *testing.T) {
+	reader := NewJSONLineReaderWithSize(strings.NewReader(strings.Repeat("x", 100)+"\n"), 64)
+	_, err := reader.ReadLine()
+	var limitErr *types.MessageLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != types.MessageLimitSize || limitErr.Max != 64 {
+		t.Fatalf("ReadLine error = %v, want a size MessageLimitError", err)
+	}
+}
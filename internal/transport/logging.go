@@ -0,0 +1,113 @@
+package transport
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/strutil"
+)
+
+// maxLoggedPayload is the number of bytes of a JSON line included in debug logs.
+const maxLoggedPayload = 512
+
+// redacted replaces secret values in logged payloads.
+const redacted = "[REDACTED]"
+
+// apiKeyPattern matches Anthropic API keys wherever they appear in a payload.
+var apiKeyPattern = regexp.MustCompile(`sk-ant-[A-Za-z0-9_\-]+`)
+
+// secretEnvMarkers identify environment variables whose values are never logged.
+var secretEnvMarkers = []string{"KEY", "TOKEN", "SECRET", "PASSWORD", "CREDENTIAL"}
+
+// IsSecretEnv reports whether the named environment variable holds a secret.
+func IsSecretEnv(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, marker := range secretEnvMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor scrubs secrets from strings before they are logged.
+type redactor struct {
+	secrets []string
+}
+
+// newRedactor returns a redactor for the secret values in env.
+func newRedactor(env map[string]string) *redactor {
+	r := &redactor{}
+	for name, value := range env {
+		if value != "" && IsSecretEnv(name) {
+			r.secrets = append(r.secrets, value)
+		}
+	}
+	return r
+}
+
+// redact replaces secret env values and API keys in s.
+func (r *redactor) redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return apiKeyPattern.ReplaceAllString(s, redacted)
+}
+
+// SecretRedactor returns a function that replaces the secret values in env,
+// and API keys, wherever they appear in a string, as they are in logged payloads.
+func SecretRedactor(env map[string]string) func(string) string {
+	return newRedactor(env).redact
+}
+
+// envForLog returns env with secret values replaced, for logging the subprocess setup.
+func (r *redactor) envForLog(env map[string]string) map[string]string {
+	out := make(map[string]string, len(env))
+	for name, value := range env {
+		if IsSecretEnv(name) {
+			out[name] = redacted
+		} else {
+			out[name] = r.redact(value)
+		}
+	}
+	return out
+}
+
+// payload prepares a JSON line for a debug log: redacted, then truncated.
+func (r *redactor) payload(line string) string {
+	return strutil.TruncateJSON(r.redact(line), maxLoggedPayload)
+}
+
+// SetLogger sets the logger for subprocess lifecycle and stdin/stdout traffic,
+// logged at debug level. A nil logger disables logging. It must be called before Connect.
+func (t *SubprocessCLITransport) SetLogger(logger *slog.Logger) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.logger = logger
+}
+
+// debugEnabled reports whether traffic should be logged.
+func (t *SubprocessCLITransport) debugEnabled() bool {
+	return t.logger != nil && t.logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// logLines logs each line written to stdin.
+func (t *SubprocessCLITransport) logLines(lines []string) {
+	if !t.debugEnabled() {
+		return
+	}
+	for _, line := range lines {
+		t.logger.Debug("claude: wrote line", "bytes", len(line), "payload", t.redactor.payload(line))
+	}
+}
+
+// logMessage logs a message read from stdout.
+func (t *SubprocessCLITransport) logMessage(msgType string, line []byte) {
+	if !t.debugEnabled() {
+		return
+	}
+	t.logger.Debug("claude: received message", "type", msgType, "bytes", len(line), "payload", t.redactor.payload(string(line)))
+}
@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureHandler is a slog.Handler that keeps every record it handles.
+type captureHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *captureHandler) WithGroup(string) slog.Handler      { return h }
+
+// text renders each record as "message key=value ..." for assertions.
+func (h *captureHandler) text() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	lines := make([]string, 0, len(h.records))
+	for _, r := range h.records {
+		var b strings.Builder
+		b.WriteString(r.Level.String() + " " + r.Message)
+		r.Attrs(func(a slog.Attr) bool {
+			fmt.Fprintf(&b, " %s=%v", a.Key, a.Value.Any())
+			return true
+		})
+		lines = append(lines, b.String())
+	}
+	return lines
+}
+
+func TestSubprocessCLITransportLogging(t *testing.T) {
+	catPath, err := FindMockCLI()
+	if err != nil || !strings.HasSuffix(catPath, "cat") {
+		t.Skip("No cat command available for testing")
+	}
+
+	// Echo stdin back regardless of CLI flags
+	script := filepath.Join(t.TempDir(), "mock-cli")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexec "+catPath+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"ANTHROPIC_API_KEY": "sk-ant-api03-secretvalue",
+		"GITHUB_TOKEN":      "ghp_tokenvalue",
+		"APP_REGION":        "eu-west-1",
+	}
+	handler := &captureHandler{}
+	transport := NewSubprocessCLITransport(script, "", env)
+	transport.SetLogger(slog.New(handler))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+
+	line := `{"type":"system","subtype":"note","data":{"token":"ghp_tokenvalue","key":"sk-ant-other-key"}}`
+	if err := transport.Write(ctx, line); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+	select {
+	case <-transport.ReadMessages(ctx):
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for echoed message")
+	}
+	_ = transport.Close(ctx)
+
+	logs := handler.text()
+	all := strings.Join(logs, "\n")
+	for _, want := range []string{
+		"DEBUG claude: started CLI",
+		"DEBUG claude: wrote line",
+		"DEBUG claude: received message type=system",
+		"DEBUG claude: closing CLI",
+		"DEBUG claude: CLI exited",
+		"APP_REGION:eu-west-1",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("logs missing %q:\n%s", want, all)
+		}
+	}
+	for _, secret := range []string{"sk-ant-api03-secretvalue", "ghp_tokenvalue", "sk-ant-other-key"} {
+		if strings.Contains(all, secret) {
+			t.Errorf("logs contain secret %q:\n%s", secret, all)
+		}
+	}
+}
+
+func TestRedactorPayload(t *testing.T) {
+	r := newRedactor(map[string]string{"DB_PASSWORD": "hunter2", "EMPTY_SECRET": ""})
+
+	if got := r.payload(`{"pw":"hunter2"}`); got != `{"pw":"[REDACTED]"}` {
+		t.Errorf("payload = %q", got)
+	}
+
+	long := strings.Repeat("x", maxLoggedPayload+100)
+	got := r.payload(long)
+	if !strings.HasPrefix(got, strings.Repeat("x", maxLoggedPayload)+"...") {
+		t.Errorf("payload not truncated: %q", got[maxLoggedPayload:])
+	}
+	if !strings.Contains(got, fmt.Sprintf("(%d bytes)", len(long))) {
+		t.Errorf("payload missing original size: %q", got[maxLoggedPayload:])
+	}
+}
+
+func TestSubprocessCLITransportNoLogger(t *testing.T) {
+	transport := NewSubprocessCLITransport("/nonexistent/claude", "", nil)
+	if transport.debugEnabled() {
+		t.Error("debug logging enabled without a logger")
+	}
+
+	// Logging helpers are no-ops without a logger
+	transport.logLines([]string{"{}"})
+	transport.logMessage("system", []byte("{}"))
+}
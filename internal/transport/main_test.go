@@ -0,0 +1,11 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+)
+
+func TestMain(m *testing.M) {
+	mockcli.Main(m)
+}
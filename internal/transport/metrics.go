@@ -0,0 +1,53 @@
+package transport
+
+import "github.com/schlunsen/claude-agent-sdk-go/types"
+
+// SetMetricsSink sets where bytes read and written and subprocess starts and
+// exits are reported. A nil sink disables metrics. It must be called before Connect.
+func (t *SubprocessCLITransport) SetMetricsSink(sink types.MetricsSink) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.metrics = sink
+}
+
+// countWritten reports the bytes of lines written to stdin, newlines included.
+func (t *SubprocessCLITransport) countWritten(lines []string) {
+	if t.metrics == nil {
+		return
+	}
+	n := 0
+	for _, line := range lines {
+		n += len(line) + 1
+	}
+	t.metrics.IncCounter(types.MetricBytesWritten, float64(n), nil)
+}
+
+// countOversized reports a line of input over the named outbound limit.
+func (t *SubprocessCLITransport) countOversized(limit string) {
+	if t.metrics != nil {
+		t.metrics.IncCounter(types.MetricOversizedWrites, 1, map[string]string{"limit": limit})
+	}
+}
+
+// countRead reports the bytes of a line read from stdout, newline included.
+func (t *SubprocessCLITransport) countRead(line []byte) {
+	if t.metrics != nil {
+		t.metrics.IncCounter(types.MetricBytesRead, float64(len(line)+1), nil)
+	}
+}
+
+// countStarted reports a subprocess that has started.
+func (t *SubprocessCLITransport) countStarted() {
+	if t.metrics != nil {
+		t.metrics.IncCounter(types.MetricSubprocessStarts, 1, nil)
+		t.metrics.AddGauge(types.MetricSubprocesses, 1, nil)
+	}
+}
+
+// countExited reports a subprocess that has exited and been reaped.
+func (t *SubprocessCLITransport) countExited() {
+	if t.metrics != nil {
+		t.metrics.AddGauge(types.MetricSubprocesses, -1, nil)
+	}
+}
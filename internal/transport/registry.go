@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// processes holds the PIDs of CLI subprocesses that have been started and
+// not yet reaped.
+var processes = struct {
+	mu   sync.Mutex
+	pids map[int]struct{}
+}{pids: make(map[int]struct{})}
+
+// trackProcess records a started subprocess.
+func trackProcess(pid int) {
+	processes.mu.Lock()
+	defer processes.mu.Unlock()
+	processes.pids[pid] = struct{}{}
+}
+
+// untrackProcess forgets a subprocess once it has been waited for.
+func untrackProcess(pid int) {
+	processes.mu.Lock()
+	defer processes.mu.Unlock()
+	delete(processes.pids, pid)
+}
+
+// ActivePIDs returns the PIDs of CLI subprocesses started by any
+// SubprocessCLITransport that have not yet exited and been reaped, in
+// ascending order.
+func ActivePIDs() []int {
+	processes.mu.Lock()
+	defer processes.mu.Unlock()
+
+	pids := make([]int, 0, len(processes.pids))
+	for pid := range processes.pids {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+// slotLimiter bounds how many CLI subprocesses may run at once. A slot is
+// taken before a subprocess starts and given back once it has been reaped.
+type slotLimiter struct {
+	mu      sync.Mutex
+	max     int           // 0 means unlimited
+	inUse   int           // slots taken, including subprocesses still starting
+	changed chan struct{} // closed and replaced whenever a slot may have freed up
+}
+
+// slots is the process-wide subprocess limiter.
+var slots = &slotLimiter{changed: make(chan struct{})}
+
+// SetMaxProcesses limits the number of CLI subprocesses running at once
+// across all transports. A non-positive n removes the limit. Subprocesses
+// already running are not affected.
+func SetMaxProcesses(n int) {
+	if n < 0 {
+		n = 0
+	}
+	slots.mu.Lock()
+	defer slots.mu.Unlock()
+	slots.max = n
+	slots.notifyLocked()
+}
+
+// ProcessUsage returns the number of subprocess slots in use and the limit,
+// which is 0 when unlimited.
+func ProcessUsage() (inUse, limit int) {
+	slots.mu.Lock()
+	defer slots.mu.Unlock()
+	return slots.inUse, slots.max
+}
+
+// acquire takes a subprocess slot. When none is free it waits until one is
+// released or ctx ends, or fails with TooManyProcessesError under the
+// SubprocessWaitFail policy.
+func (l *slotLimiter) acquire(ctx context.Context, policy types.SubprocessWaitPolicy) error {
+	for {
+		l.mu.Lock()
+		if l.max == 0 || l.inUse < l.max {
+			l.inUse++
+			l.mu.Unlock()
+			return nil
+		}
+		if policy == types.SubprocessWaitFail {
+			limit := l.max
+			l.mu.Unlock()
+			return types.NewTooManyProcessesError(limit)
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// release gives back a slot taken with acquire.
+func (l *slotLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inUse--
+	l.notifyLocked()
+}
+
+// notifyLocked wakes goroutines waiting for a slot. The caller must hold l.mu.
+func (l *slotLimiter) notifyLocked() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
@@ -0,0 +1,368 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestSlotLimiter tests acquiring and releasing subprocess slots
+func TestSlotLimiter(t *testing.T) {
+	l := &slotLimiter{max: 2, changed: make(chan struct{})}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := l.acquire(ctx, types.SubprocessWaitBlock); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+
+	if err := l.acquire(ctx, types.SubprocessWaitFail); !types.IsTooManyProcessesError(err) {
+		t.Errorf("acquire with fail policy = %v, want TooManyProcessesError", err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(short, types.SubprocessWaitBlock); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("blocked acquire = %v, want context.DeadlineExceeded", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- l.acquire(ctx, types.SubprocessWaitBlock)
+	}()
+	select {
+	case err := <-acquired:
+		t.Fatalf("acquire returned %v before a slot was released", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("acquire after release: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting acquire did not get the released slot")
+	}
+
+	if l.inUse != 2 {
+		t.Errorf("inUse = %d, want 2", l.inUse)
+	}
+}
+
+// TestSlotLimiterUnlimited tests that a zero limit never blocks
+func TestSlotLimiterUnlimited(t *testing.T) {
+	l := &slotLimiter{changed: make(chan struct{})}
+	for i := 0; i < 100; i++ {
+		if err := l.acquire(context.Background(), types.SubprocessWaitFail); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+}
+
+// waitForUsage waits until the number of subprocess slots in use is want.
+func waitForUsage(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		inUse, _ := ProcessUsage()
+		if inUse == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slots in use = %d, want %d", inUse, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestSubprocessCLITransportMaxProcesses tests the limit at Connect and slot
+// release on every way a subprocess can end
+func TestSubprocessCLITransportMaxProcesses(t *testing.T) {
+	SetMaxProcesses(1)
+	defer SetMaxProcesses(0)
+
+	dir := t.TempDir()
+	idle := filepath.Join(dir, "idle-cli")
+	if err := os.WriteFile(idle, []byte("#!/bin/sh\ncat >/dev/null\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	crash := filepath.Join(dir, "crash-cli")
+	if err := os.WriteFile(crash, []byte("#!/bin/sh\nexit 3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("limit enforced", func(t *testing.T) {
+		first := NewSubprocessCLITransport(idle, "", nil)
+		if err := first.Connect(ctx); err != nil {
+			t.Fatalf("Connect() unexpected error: %v", err)
+		}
+		if inUse, limit := ProcessUsage(); inUse != 1 || limit != 1 {
+			t.Errorf("ProcessUsage() = %d, %d, want 1, 1", inUse, limit)
+		}
+
+		failing := NewSubprocessCLITransport(idle, "", nil)
+		failing.SetSubprocessWaitPolicy(types.SubprocessWaitFail)
+		if err := failing.Connect(ctx); !types.IsTooManyProcessesError(err) {
+			t.Errorf("Connect() with fail policy = %v, want TooManyProcessesError", err)
+		}
+
+		short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancelShort()
+		blocked := NewSubprocessCLITransport(idle, "", nil)
+		if err := blocked.Connect(short); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("blocked Connect() = %v, want context.DeadlineExceeded", err)
+		}
+
+		// A waiting Connect proceeds once the first subprocess is closed
+		waiting := NewSubprocessCLITransport(idle, "", nil)
+		connected := make(chan error, 1)
+		go func() {
+			connected <- waiting.Connect(ctx)
+		}()
+		_ = first.Close(ctx)
+		if err := <-connected; err != nil {
+			t.Fatalf("waiting Connect() unexpected error: %v", err)
+		}
+		_ = waiting.Close(ctx)
+		waitForUsage(t, 0)
+	})
+
+	t.Run("released after crash without Close", func(t *testing.T) {
+		tr := NewSubprocessCLITransport(crash, "", nil)
+		if err := tr.Connect(ctx); err != nil {
+			t.Fatalf("Connect() unexpected error: %v", err)
+		}
+		for range tr.ReadMessages(ctx) {
+		}
+		waitForUsage(t, 0)
+	})
+
+	t.Run("released after context cancel without Close", func(t *testing.T) {
+		connectCtx, cancelConnect := context.WithCancel(ctx)
+		tr := NewSubprocessCLITransport(idle, "", nil)
+		if err := tr.Connect(connectCtx); err != nil {
+			t.Fatalf("Connect() unexpected error: %v", err)
+		}
+		cancelConnect()
+		waitForUsage(t, 0)
+	})
+
+	t.Run("released when start fails", func(t *testing.T) {
+		tr := NewSubprocessCLITransport(filepath.Join(dir, "missing"), "", nil)
+		if err := tr.Connect(ctx); err == nil {
+			t.Fatal("Connect() expected error for a missing CLI")
+		}
+		waitForUsage(t, 0)
+	})
+}
+
+// TestSubprocessCLITransportChurnChaos churns Connect and Close on several
+// goroutines while killing subprocesses at random, and checks that the limit
+// holds throughout and that every slot and registry entry is released.
+func TestSubprocessCLITransportChurnChaos(t *testing.T) {
+	const (
+		limit   = 3
+		workers = 8
+		rounds  = 12
+	)
+	SetMaxProcesses(limit)
+	defer SetMaxProcesses(0)
+
+	script := filepath.Join(t.TempDir(), "idle-cli")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat >/dev/null\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// Check the limit while the churn runs
+	stop := make(chan struct{})
+	var monitor sync.WaitGroup
+	var over atomic.Int32
+	monitor.Add(2)
+	go func() {
+		defer monitor.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if inUse, _ := ProcessUsage(); inUse > limit || len(ActivePIDs()) > limit {
+				over.Add(1)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	// Kill running subprocesses behind their transports' backs
+	go func() {
+		defer monitor.Done()
+		rng := rand.New(rand.NewSource(1))
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Duration(rng.Intn(5)) * time.Millisecond):
+			}
+			if pids := ActivePIDs(); len(pids) > 0 {
+				if p, err := os.FindProcess(pids[rng.Intn(len(pids))]); err == nil {
+					_ = p.Kill()
+				}
+			}
+		}
+	}()
+
+	var churn sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		churn.Add(1)
+		go func(seed int64) {
+			defer churn.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for i := 0; i < rounds; i++ {
+				tr := NewSubprocessCLITransport(script, "", nil)
+				if err := tr.Connect(ctx); err != nil {
+					t.Errorf("Connect() unexpected error: %v", err)
+					return
+				}
+				switch rng.Intn(3) {
+				case 0:
+					// Close at once
+				case 1:
+					time.Sleep(time.Duration(rng.Intn(10)) * time.Millisecond)
+				case 2:
+					// Kill it here and read until the transport notices
+					if pid, ok := tr.PID(); ok {
+						if p, err := os.FindProcess(pid); err == nil {
+							_ = p.Kill()
+						}
+					}
+					for range tr.ReadMessages(ctx) {
+					}
+				}
+				_ = tr.Close(ctx)
+			}
+		}(int64(w + 2))
+	}
+	churn.Wait()
+	close(stop)
+	monitor.Wait()
+
+	if n := over.Load(); n > 0 {
+		t.Errorf("limit of %d exceeded in %d checks", limit, n)
+	}
+	waitForUsage(t, 0)
+	if pids := ActivePIDs(); len(pids) != 0 {
+		t.Errorf("ActivePIDs() after churn = %v, want none", pids)
+	}
+}
+
+// TestSubprocessCLITransportProcessState tests that the PID is reported while
+// the subprocess runs and that the state flips to exited after Close
+func TestSubprocessCLITransportProcessState(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "idle-cli")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat >/dev/null\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tr := NewSubprocessCLITransport(script, "", nil)
+	if pid, ok := tr.PID(); ok || pid != 0 {
+		t.Errorf("PID() before Connect = %d, %t, want 0, false", pid, ok)
+	}
+	if state := tr.ProcessState(); state.Status != types.ProcessNotStarted {
+		t.Errorf("ProcessState() before Connect = %+v, want not started", state)
+	}
+
+	if err := tr.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	pid, ok := tr.PID()
+	if !ok || pid <= 0 {
+		t.Fatalf("PID() while running = %d, %t, want a PID and true", pid, ok)
+	}
+	if state := tr.ProcessState(); state.Status != types.ProcessRunning || state.PID != pid {
+		t.Errorf("ProcessState() while running = %+v, want running with PID %d", state, pid)
+	}
+
+	// Readers must not block on Close, which holds the transport's lock while
+	// waiting for the process
+	stop := make(chan struct{})
+	reads := make(chan int, 1)
+	go func() {
+		n := 0
+		for {
+			select {
+			case <-stop:
+				reads <- n
+				return
+			default:
+				tr.PID()
+				tr.ProcessState()
+				n++
+			}
+		}
+	}()
+	_ = tr.Close(ctx)
+	close(stop)
+	if n := <-reads; n == 0 {
+		t.Error("PID and ProcessState were never read during Close")
+	}
+
+	if got, ok := tr.PID(); ok || got != pid {
+		t.Errorf("PID() after Close = %d, %t, want %d, false", got, ok, pid)
+	}
+	if state := tr.ProcessState(); state.Status != types.ProcessExited || state.PID != pid {
+		t.Errorf("ProcessState() after Close = %+v, want exited with PID %d", state, pid)
+	}
+}
+
+// TestSubprocessCLITransportProcessStateExitCode tests that the exit code of a
+// subprocess that exits on its own is reported once it has been reaped
+func TestSubprocessCLITransportProcessStateExitCode(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "crash-cli")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexit 3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tr := NewSubprocessCLITransport(script, "", nil)
+	if err := tr.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	defer func() {
+		_ = tr.Close(ctx)
+	}()
+	for range tr.ReadMessages(ctx) {
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tr.ProcessState().Status != types.ProcessExited {
+		if time.Now().After(deadline) {
+			t.Fatalf("ProcessState() = %+v, want exited", tr.ProcessState())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if state := tr.ProcessState(); state.ExitCode != 3 {
+		t.Errorf("ExitCode = %d, want 3", state.ExitCode)
+	}
+	if _, ok := tr.PID(); ok {
+		t.Error("PID() reported a running process after it exited")
+	}
+}
@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxStderrLineBytes caps a stderr line. Longer lines keep their first
+	// and last halves around a marker.
+	maxStderrLineBytes = 64 * 1024
+
+	// stderrTailLines is how many of the last stderr lines are kept for
+	// StderrTail and for the ProcessError of a failed CLI.
+	stderrTailLines = 100
+
+	// stderrCallbackQueue is how many stderr lines may wait for a slow
+	// callback. Further lines are dropped so that the CLI never blocks
+	// writing to stderr.
+	stderrCallbackQueue = 256
+)
+
+// stderrDrainTimeout is how long reaping the process waits for the rest of
+// stderr to be read, in case a child process holds the pipe open.
+var stderrDrainTimeout = time.Second
+
+// stderrLineReader splits the CLI's plain-text stderr into lines. A line
+// longer than maxLine bytes keeps its first and last maxLine/2 bytes around
+// a marker counting the bytes dropped, so both the start and the end of a
+// giant stack trace survive. Memory use is bounded by maxLine.
+type stderrLineReader struct {
+	r       *bufio.Reader
+	maxLine int
+}
+
+// newStderrLineReader creates a reader that caps lines at maxLine bytes.
+func newStderrLineReader(r io.Reader, maxLine int) *stderrLineReader {
+	return &stderrLineReader{r: bufio.NewReader(r), maxLine: maxLine}
+}
+
+// ReadLine returns the next line without its line ending. A final line
+// without a newline is returned before io.EOF.
+func (l *stderrLineReader) ReadLine() (string, error) {
+	half := l.maxLine / 2
+	var head, buf []byte
+	dropped := 0
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		if err == nil {
+			chunk = chunk[:len(chunk)-1]
+			if n := len(chunk); n > 0 && chunk[n-1] == '\r' {
+				chunk = chunk[:n-1]
+			}
+		}
+		buf = append(buf, chunk...)
+		if head != nil || len(buf) > l.maxLine {
+			if head == nil {
+				head = append([]byte(nil), buf[:half]...)
+				buf = buf[half:]
+			}
+			if excess := len(buf) - half; excess > 0 {
+				dropped += excess
+				buf = append(buf[:0], buf[excess:]...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && head == nil && len(buf) == 0 {
+			return "", err
+		}
+		break
+	}
+
+	tail := string(buf)
+	if head == nil {
+		return tail, nil
+	}
+	// The cuts may split multi-byte characters
+	return fmt.Sprintf("%s ... [%d bytes truncated] ... %s",
+		strings.ToValidUTF8(string(head), ""), dropped, strings.ToValidUTF8(tail, "")), nil
+}
+
+// stderrRing keeps the last lines the CLI wrote to stderr.
+type stderrRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int // Index of the oldest line once the ring is full
+}
+
+// add records a line, dropping the oldest once stderrTailLines are kept.
+func (r *stderrRing) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.lines) < stderrTailLines {
+		r.lines = append(r.lines, line)
+		return
+	}
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+}
+
+// snapshot returns the kept lines, oldest first.
+func (r *stderrRing) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]string, 0, len(r.lines))
+	out = append(out, r.lines[r.next:]...)
+	return append(out, r.lines[:r.next]...)
+}
+
+// readStderr reads the CLI's stderr until it closes, recording each line in
+// the ring and passing it to the stderr callback, if any. Stderr is always
+// drained promptly: lines a slow callback cannot keep up with are dropped and
+// reported to it with a single marker line. done is closed once stderr has
+// been read to the end.
+func (t *SubprocessCLITransport) readStderr(stderr io.Reader, done chan<- struct{}) {
+	defer close(done)
+
+	var queue chan string
+	if t.stderrCallback != nil {
+		queue = make(chan string, stderrCallbackQueue)
+		defer close(queue)
+		go func(callback func(string)) {
+			for line := range queue {
+				callback(line)
+			}
+		}(t.stderrCallback)
+	}
+
+	// flushDropped reports lines dropped since the last delivery, returning
+	// false if the callback has still not caught up
+	dropped := 0
+	flushDropped := func() bool {
+		if dropped == 0 {
+			return true
+		}
+		select {
+		case queue <- fmt.Sprintf("[%d stderr lines dropped: callback too slow]", dropped):
+			dropped = 0
+			return true
+		default:
+			return false
+		}
+	}
+
+	reader := newStderrLineReader(stderr, maxStderrLineBytes)
+	for {
+		line, err := reader.ReadLine()
+		if err != nil {
+			if queue != nil {
+				flushDropped()
+			}
+			return
+		}
+		t.stderrRing.add(line)
+		if queue == nil {
+			continue
+		}
+		if flushDropped() {
+			select {
+			case queue <- line:
+				continue
+			default:
+			}
+		}
+		dropped++
+	}
+}
+
+// StderrTail returns the last lines the CLI wrote to stderr, oldest first.
+// They remain available after Close, for diagnosing a CLI that failed.
+func (t *SubprocessCLITransport) StderrTail() []string {
+	return t.stderrRing.snapshot()
+}
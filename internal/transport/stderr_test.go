@@ -0,0 +1,289 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestStderrLineReader tests line splitting and the head/tail cap
+func TestStderrLineReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"lines", "one\ntwo\n", []string{"one", "two"}},
+		{"crlf", "one\r\ntwo\r\n", []string{"one", "two"}},
+		{"empty lines", "\n\nthree\n", []string{"", "", "three"}},
+		{"no final newline", "one\ntwo", []string{"one", "two"}},
+		{"at cap", "0123456789abcdef\n", []string{"0123456789abcdef"}},
+		{"crlf at cap", "0123456789abcdef\r\n", []string{"0123456789abcdef"}},
+		{"over cap", "0123456789abcdefXYZ\nnext\n", []string{"01234567 ... [3 bytes truncated] ... bcdefXYZ", "next"}},
+		{"over cap without newline", "0123456789abcdefXYZ", []string{"01234567 ... [3 bytes truncated] ... bcdefXYZ"}},
+		{"split characters", "héééééééé€€€€€€\n", []string{"hééé ... [19 bytes truncated] ... €€"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readAllStderr(t, newStderrLineReader(strings.NewReader(tt.input), 16))
+			if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStderrLineReaderHugeLine tests that a multi-megabyte line keeps its
+// head and tail and that reading continues after it
+func TestStderrLineReaderHugeLine(t *testing.T) {
+	const size = 5 << 20
+	huge := "panic: boom" + strings.Repeat("x", size) + "at main.go:42"
+	input := huge + "\nafter\n"
+
+	lines := readAllStderr(t, newStderrLineReader(strings.NewReader(input), maxStderrLineBytes))
+	if len(lines) != 2 || lines[1] != "after" {
+		t.Fatalf("got %d lines, want the huge line then %q", len(lines), "after")
+	}
+	line := lines[0]
+	if len(line) > maxStderrLineBytes+100 {
+		t.Errorf("line is %d bytes, want at most about %d", len(line), maxStderrLineBytes)
+	}
+	if !strings.HasPrefix(line, "panic: boom") || !strings.HasSuffix(line, "at main.go:42") {
+		t.Errorf("line lost its head or tail: %.20q ... %.20q", line, line[len(line)-20:])
+	}
+	marker := fmt.Sprintf(" ... [%d bytes truncated] ... ", len(huge)-maxStderrLineBytes)
+	if !strings.Contains(line, marker) {
+		t.Errorf("line missing marker %q", marker)
+	}
+}
+
+func readAllStderr(t *testing.T, r *stderrLineReader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return lines
+		}
+		if err != nil {
+			t.Fatalf("ReadLine() unexpected error: %v", err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+// TestStderrRing tests that the ring keeps the last lines in order
+func TestStderrRing(t *testing.T) {
+	var r stderrRing
+	if got := r.snapshot(); len(got) != 0 {
+		t.Errorf("empty snapshot = %q", got)
+	}
+	for i := 0; i < stderrTailLines+5; i++ {
+		r.add(fmt.Sprint(i))
+	}
+	got := r.snapshot()
+	if len(got) != stderrTailLines || got[0] != "5" || got[len(got)-1] != fmt.Sprint(stderrTailLines+4) {
+		t.Errorf("snapshot = %d lines from %q to %q, want %d lines from 5 to %d",
+			len(got), got[0], got[len(got)-1], stderrTailLines, stderrTailLines+4)
+	}
+}
+
+// writeStderrCLI writes a CLI script that writes to stderr and then prints a
+// message on stdout, which can only be read if stderr is being drained.
+func writeStderrCLI(t *testing.T, stderr string) string {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "stderr-cli")
+	body := "#!/bin/sh\n" + stderr + "\n" +
+		`echo '{"type":"system","subtype":"done","data":{}}'` + "\n" +
+		"cat >/dev/null\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+// readDone reads messages until the CLI's "done" message
+func readDone(t *testing.T, ctx context.Context, tr *SubprocessCLITransport) {
+	t.Helper()
+	for msg := range tr.ReadMessages(ctx) {
+		if sys, ok := msg.(*types.SystemMessage); ok && sys.Subtype == "done" {
+			return
+		}
+	}
+	t.Fatalf("CLI output ended without the done message (error: %v)", tr.GetError())
+}
+
+// TestSubprocessCLITransportStderrHugeLine tests that a multi-megabyte
+// stderr line neither blocks the CLI nor is lost
+func TestSubprocessCLITransportStderrHugeLine(t *testing.T) {
+	script := writeStderrCLI(t, `head -c 3000000 /dev/zero | tr '\0' x >&2; echo ' END' >&2; echo second >&2`)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var lines []string
+	second := make(chan struct{})
+	tr := NewSubprocessCLITransport(script, "", nil)
+	tr.SetStderrCallback(func(line string) {
+		mu.Lock()
+		lines = append(lines, line)
+		mu.Unlock()
+		if line == "second" {
+			close(second)
+		}
+	})
+	if err := tr.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	defer tr.Close(ctx)
+
+	readDone(t, ctx, tr)
+	select {
+	case <-second:
+	case <-ctx.Done():
+		t.Fatal("stderr callback never received the line after the huge one")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 2 {
+		t.Fatalf("callback got %d lines, want 2", len(lines))
+	}
+	if huge := lines[0]; !strings.HasPrefix(huge, "xxx") || !strings.HasSuffix(huge, "x END") ||
+		!strings.Contains(huge, "bytes truncated") || len(huge) > maxStderrLineBytes+100 {
+		t.Errorf("huge line not capped with head and tail: %d bytes", len(huge))
+	}
+	if tail := tr.StderrTail(); len(tail) != 2 || tail[1] != "second" {
+		t.Errorf("StderrTail() = %d lines, want the same 2 lines", len(tail))
+	}
+}
+
+// TestSubprocessCLITransportStderrSlowCallback tests that a blocked callback
+// does not block the CLI and is told how many lines it missed
+func TestSubprocessCLITransportStderrSlowCallback(t *testing.T) {
+	const total = 2000
+	script := writeStderrCLI(t, fmt.Sprintf(`i=0; while [ $i -lt %d ]; do echo "line $i" >&2; i=$((i+1)); done`, total))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var lines []string
+	tr := NewSubprocessCLITransport(script, "", nil)
+	tr.SetStderrCallback(func(line string) {
+		<-release
+		mu.Lock()
+		lines = append(lines, line)
+		mu.Unlock()
+	})
+	if err := tr.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+
+	// The CLI gets past its stderr output while the callback is blocked
+	readDone(t, ctx, tr)
+	close(release)
+	_ = tr.Close(ctx)
+
+	if tail := tr.StderrTail(); len(tail) != stderrTailLines || tail[len(tail)-1] != fmt.Sprintf("line %d", total-1) {
+		t.Errorf("StderrTail() = %d lines ending %q, want %d ending with the last line",
+			len(tail), tail[len(tail)-1], stderrTailLines)
+	}
+
+	waitDelivered := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(lines)
+		var dropped string
+		if n > 0 {
+			dropped = lines[n-1]
+		}
+		mu.Unlock()
+		if strings.Contains(dropped, "stderr lines dropped") {
+			break
+		}
+		if time.Now().After(waitDelivered) {
+			t.Fatalf("callback got %d lines without a dropped-lines marker at the end (last %q)", n, dropped)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestSubprocessCLITransportStderrInProcessError tests that the error of a
+// failed CLI carries its last stderr lines
+func TestSubprocessCLITransportStderrInProcessError(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "failing-cli")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho 'loading config' >&2\necho 'fatal: bad API key' >&2\nexit 3\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tr := NewSubprocessCLITransport(script, "", nil)
+	if err := tr.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	for range tr.ReadMessages(ctx) {
+	}
+	for tr.ProcessState().Status != types.ProcessExited {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	err := tr.Close(ctx)
+	var procErr *types.ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("Close() = %v, want a ProcessError", err)
+	}
+	if procErr.ExitCode != 3 || procErr.Stderr != "loading config\nfatal: bad API key" {
+		t.Errorf("ProcessError = exit code %d, stderr %q", procErr.ExitCode, procErr.Stderr)
+	}
+}
+
+func TestSubprocessCLITransportExitBetweenMessages(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "crashing-cli")
+	body := "#!/bin/sh\n" +
+		`echo '{"type":"system","subtype":"init","session_id":"s"}'` + "\n" +
+		"echo 'panic: connection reset' >&2\nexit 3\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tr := NewSubprocessCLITransport(script, "", nil)
+	if err := tr.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	var received int
+	for range tr.ReadMessages(ctx) {
+		received++
+	}
+	if received != 1 {
+		t.Errorf("received %d messages, want 1", received)
+	}
+
+	// The exit is recorded by the time the channel closes, without Close
+	err := tr.GetError()
+	var procErr *types.ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("GetError() = %v, want a ProcessError", err)
+	}
+	if procErr.ExitCode != 3 || procErr.Stderr != "panic: connection reset" {
+		t.Errorf("ProcessError = exit code %d, stderr %q", procErr.ExitCode, procErr.Stderr)
+	}
+
+	// Close reports the same exit rather than waiting for the process again
+	err = tr.Close(ctx)
+	if !errors.As(err, &procErr) || procErr.ExitCode != 3 {
+		t.Errorf("Close() = %v, want the ProcessError with exit code 3", err)
+	}
+}
@@ -3,6 +3,8 @@ package transport
 import (
 	"bufio"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
@@ -10,6 +12,12 @@ import (
 const (
 	// DefaultMaxBufferSize is the default maximum size for JSON line buffer (1MB)
 	DefaultMaxBufferSize = 1024 * 1024
+
+	// DefaultWriteBatchMaxBytes is the default flush threshold in batched write mode (64KB)
+	DefaultWriteBatchMaxBytes = 64 * 1024
+
+	// DefaultWriteBatchMaxDelay is the default flush delay in batched write mode
+	DefaultWriteBatchMaxDelay = time.Millisecond
 )
 
 // JSONLineReader reads JSON lines from an input stream with buffering.
@@ -28,8 +36,9 @@ func NewJSONLineReader(r io.Reader) *JSONLineReader {
 func NewJSONLineReaderWithSize(r io.Reader, maxSize int) *JSONLineReader {
 	scanner := bufio.NewScanner(r)
 
-	// Set up buffer with max size
-	buf := make([]byte, 0, 64*1024) // Initial 64KB buffer
+	// Set up buffer with max size; the scanner never limits lines to less
+	// than the initial buffer, so it must not exceed maxSize
+	buf := make([]byte, 0, min(64*1024, maxSize)) // Initial 64KB buffer
 	scanner.Buffer(buf, maxSize)
 
 	return &JSONLineReader{
@@ -46,10 +55,7 @@ func (r *JSONLineReader) ReadLine() ([]byte, error) {
 		if err := r.scanner.Err(); err != nil {
 			// Check if it's a buffer overflow error
 			if err == bufio.ErrTooLong {
-				return nil, types.NewJSONDecodeErrorWithRaw(
-					"JSON line exceeded maximum buffer size",
-					"",
-				)
+				return nil, types.NewMessageLimitError(types.MessageLimitSize, r.maxSize, "")
 			}
 			return nil, err
 		}
@@ -61,9 +67,25 @@ func (r *JSONLineReader) ReadLine() ([]byte, error) {
 }
 
 // JSONLineWriter writes JSON lines to an output stream with buffering.
-// Each call to WriteLine writes the data followed by a newline and flushes.
+//
+// By default each call to WriteLine writes the data followed by a newline and
+// flushes. In batched mode (see NewBatchedJSONLineWriter) lines are coalesced
+// and flushed when the buffered size reaches maxBytes, when maxDelay has
+// elapsed since the first unflushed line, or on an explicit Flush.
+//
+// JSONLineWriter is safe for concurrent use; lines are written in the order
+// the calls acquire the writer, and the lines of one WriteLines call are
+// never interleaved with other writes.
 type JSONLineWriter struct {
+	mu     sync.Mutex
 	writer *bufio.Writer
+
+	// Batched mode
+	batched  bool
+	maxDelay time.Duration
+	maxBytes int
+	timer    *time.Timer
+	err      error // Sticky error from a timer-driven flush
 }
 
 // NewJSONLineWriter creates a new JSONLineWriter with default buffer size.
@@ -73,21 +95,91 @@ func NewJSONLineWriter(w io.Writer) *JSONLineWriter {
 	}
 }
 
+// NewBatchedJSONLineWriter creates a JSONLineWriter in batched mode.
+// Buffered lines are flushed once they reach maxBytes or maxDelay after the
+// first unflushed line was written, whichever comes first.
+func NewBatchedJSONLineWriter(w io.Writer, maxDelay time.Duration, maxBytes int) *JSONLineWriter {
+	if maxBytes <= 0 {
+		maxBytes = DefaultWriteBatchMaxBytes
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultWriteBatchMaxDelay
+	}
+	// Leave headroom so a line crossing the threshold is flushed whole by us
+	// rather than split by bufio's automatic flush.
+	return &JSONLineWriter{
+		writer:   bufio.NewWriterSize(w, 2*maxBytes),
+		batched:  true,
+		maxDelay: maxDelay,
+		maxBytes: maxBytes,
+	}
+}
+
 // WriteLine writes a JSON line to the stream with a trailing newline.
-// The data is written to the buffer and then immediately flushed.
+// In unbatched mode the data is flushed immediately.
 func (w *JSONLineWriter) WriteLine(data string) error {
-	if _, err := w.writer.WriteString(data); err != nil {
-		return err
+	return w.WriteLines([]string{data})
+}
+
+// WriteLines writes several JSON lines contiguously.
+// In unbatched mode they are flushed together with a single flush.
+func (w *JSONLineWriter) WriteLines(lines []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	for _, line := range lines {
+		if _, err := w.writer.WriteString(line); err != nil {
+			return err
+		}
+		if err := w.writer.WriteByte('\n'); err != nil {
+			return err
+		}
 	}
 
-	if _, err := w.writer.WriteString("\n"); err != nil {
-		return err
+	if !w.batched || w.writer.Buffered() >= w.maxBytes {
+		return w.flushLocked()
 	}
 
-	return w.writer.Flush()
+	if w.timer == nil && w.writer.Buffered() > 0 {
+		w.timer = time.AfterFunc(w.maxDelay, w.flushFromTimer)
+	}
+	return nil
 }
 
 // Flush flushes any buffered data to the underlying writer.
 func (w *JSONLineWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.flushLocked()
+}
+
+// flushLocked stops any pending timer and flushes. The caller must hold w.mu.
+func (w *JSONLineWriter) flushLocked() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
 	return w.writer.Flush()
 }
+
+// flushFromTimer flushes a batch when its delay expires.
+func (w *JSONLineWriter) flushFromTimer() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timer = nil
+	if w.err != nil {
+		return
+	}
+	if err := w.writer.Flush(); err != nil {
+		w.err = err
+	}
+}
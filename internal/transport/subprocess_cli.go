@@ -2,11 +2,17 @@ package transport
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
@@ -16,6 +22,10 @@ const (
 	SDKVersion = "0.1.0"
 )
 
+// stdoutEOFGracePeriod is how long the process may keep running after closing
+// stdout before the transport is considered broken.
+var stdoutEOFGracePeriod = time.Second
+
 // SubprocessCLITransport implements Transport using a Claude Code CLI subprocess.
 // It manages the subprocess lifecycle, stdin/stdout/stderr pipes, and message streaming.
 type SubprocessCLITransport struct {
@@ -31,16 +41,86 @@ type SubprocessCLITransport struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
+	// Close gives the CLI closeTimeout to exit before killing it. closing is
+	// closed when Close begins, and readerDone once stdout has been read to
+	// the end.
+	closeTimeout time.Duration
+	closing      chan struct{}
+	readerDone   chan struct{}
+
 	// Message streaming
 	messages chan types.Message
 
 	// Writer for stdin
-	writer *JSONLineWriter
+	writer     *JSONLineWriter
+	batchWrite bool
+	batchDelay time.Duration
+	batchBytes int
+
+	// Keep the original JSON line on each message, and decode unknown
+	// message and block types instead of reporting parse errors
+	rawMessages    bool
+	lenientParsing bool
+
+	// Control requests longer than this keep their input undecoded (0 decodes all)
+	maxControlInput int
+
+	// Limits on each line of output; zero uses the defaults
+	maxMessageSize  int
+	maxMessageDepth int
+
+	// Limits on each line of input; zero disables them
+	maxWriteSize  int
+	warnWriteSize int
+
+	// What Connect does when the subprocess limit is reached
+	waitPolicy types.SubprocessWaitPolicy
+
+	// Tool filters and subagents passed to the CLI as flags
+	allowedTools    []string
+	disallowedTools []string
+	agents          string
+
+	// Settings passed to the CLI. JSON settings are written to settingsFile
+	// on Connect, which is removed on Close.
+	settings       string
+	settingSources []string // nil leaves the CLI's default
+	settingsFile   string
+
+	// Extended thinking budget (nil leaves the CLI's default)
+	maxThinkingTokens *int
+
+	// Caller-supplied flags appended after the SDK's own
+	extraArgs []string
+
+	// Debug logging of lifecycle and traffic (nil disables)
+	logger   *slog.Logger
+	redactor *redactor
+
+	// Byte and subprocess metrics (nil disables)
+	metrics types.MetricsSink
+
+	// Process exit tracking; cmd.Wait is called exactly once
+	waitOnce sync.Once
+	exited   chan struct{}
+	waitErr  error
+
+	// Stderr lines go to the ring and to the callback (nil disables); stderrDone
+	// is closed once stderr has been read to the end
+	stderrCallback func(string)
+	stderrRing     stderrRing
+	stderrDone     chan struct{}
+
+	// Subprocess state for monitoring, under its own lock since Close holds
+	// mu while waiting for the process to exit
+	procMu    sync.Mutex
+	procState types.ProcessState
 
 	// Error tracking
-	mu    sync.Mutex
-	err   error
-	ready bool
+	mu          sync.Mutex
+	err         error
+	ready       bool
+	inputClosed bool
 }
 
 // NewSubprocessCLITransport creates a new transport instance.
@@ -49,11 +129,233 @@ type SubprocessCLITransport struct {
 // The env map contains additional environment variables to set for the subprocess.
 func NewSubprocessCLITransport(cliPath, cwd string, env map[string]string) *SubprocessCLITransport {
 	return &SubprocessCLITransport{
-		cliPath:  cliPath,
-		cwd:      cwd,
-		env:      env,
-		messages: make(chan types.Message, 10), // Buffered channel for smooth streaming
+		cliPath:       cliPath,
+		cwd:           cwd,
+		env:           env,
+		messages:      make(chan types.Message, 10), // Buffered channel for smooth streaming
+		redactor:      newRedactor(env),
+		closeTimeout:  types.DefaultCloseTimeout,
+		maxWriteSize:  types.DefaultMaxOutboundSize,
+		warnWriteSize: types.DefaultOutboundWarnSize,
+		closing:       make(chan struct{}),
+		readerDone:    make(chan struct{}),
+	}
+}
+
+// SetWriteBatching enables batched writes to stdin. Lines are coalesced and
+// flushed when maxBytes are buffered, maxDelay after the first unflushed line,
+// or on Flush. Non-positive values use the defaults. It must be called before Connect.
+func (t *SubprocessCLITransport) SetWriteBatching(maxDelay time.Duration, maxBytes int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.batchWrite = true
+	t.batchDelay = maxDelay
+	t.batchBytes = maxBytes
+}
+
+// SetRawMessages sets whether parsed messages keep a copy of the JSON line
+// they were decoded from. It must be called before Connect.
+func (t *SubprocessCLITransport) SetRawMessages(enabled bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rawMessages = enabled
+}
+
+// SetMessageLimits sets the maximum size in bytes and nesting depth of a line
+// of output. Non-positive values use DefaultMaxBufferSize and
+// types.DefaultMaxMessageDepth. It must be called before Connect.
+func (t *SubprocessCLITransport) SetMessageLimits(maxSize, maxDepth int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.maxMessageSize = maxSize
+	t.maxMessageDepth = maxDepth
+}
+
+// SetOutboundLimits sets the size in bytes above which a line of input is
+// written with a warning, and above which it is not written at all but
+// rejected with a types.OutboundTooLargeError. Non-positive values disable
+// the limit; both default to the types package defaults.
+func (t *SubprocessCLITransport) SetOutboundLimits(warnSize, maxSize int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.warnWriteSize = warnSize
+	t.maxWriteSize = maxSize
+}
+
+// SetLenientParsing sets whether messages and content blocks of unknown type
+// are delivered as types.UnknownMessage and types.UnknownBlock instead of
+// parse_error messages.
+func (t *SubprocessCLITransport) SetLenientParsing(enabled bool) {
+	t.lenientParsing = enabled
+}
+
+// SetMaxControlInput sets the size in bytes above which a control request
+// from the CLI is delivered with its input undecoded, as a json.RawMessage
+// (see types.DecodeOptions). A non-positive size decodes every input.
+func (t *SubprocessCLITransport) SetMaxControlInput(size int) {
+	t.maxControlInput = size
+}
+
+// SetCloseTimeout sets how long Close waits for the CLI to exit after closing
+// its input before killing it, regardless of whether Close's context is
+// already done. A non-positive duration waits only as long as the context
+// allows. It must be called before Close.
+func (t *SubprocessCLITransport) SetCloseTimeout(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closeTimeout = d
+}
+
+// SetSubprocessWaitPolicy sets whether Connect waits for a free subprocess
+// slot or fails when the limit set with SetMaxProcesses is reached. It must
+// be called before Connect.
+func (t *SubprocessCLITransport) SetSubprocessWaitPolicy(policy types.SubprocessWaitPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.waitPolicy = policy
+}
+
+// SetToolFilter sets the tools the CLI may use without asking and the tools
+// it must not use at all, passed as --allowedTools and --disallowedTools.
+// Empty lists leave the CLI's defaults. It must be called before Connect.
+func (t *SubprocessCLITransport) SetToolFilter(allowed, disallowed []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.allowedTools = allowed
+	t.disallowedTools = disallowed
+}
+
+// SetAgents sets the JSON object of custom subagent definitions passed as
+// --agents. An empty string passes none. It must be called before Connect.
+func (t *SubprocessCLITransport) SetAgents(agentsJSON string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.agents = agentsJSON
+}
+
+// SetSettings sets the settings passed as --settings: a file path, or a JSON
+// object that Connect writes to a temporary file. An empty string passes
+// none. It must be called before Connect.
+func (t *SubprocessCLITransport) SetSettings(settings string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.settings = settings
+}
+
+// SetSettingSources sets the setting sources passed as --setting-sources. A
+// nil slice leaves the CLI's default; an empty one loads no settings files.
+// It must be called before Connect.
+func (t *SubprocessCLITransport) SetSettingSources(sources []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.settingSources = sources
+}
+
+// IsSettingsJSON reports whether a --settings value is inline JSON rather
+// than a file path.
+func IsSettingsJSON(settings string) bool {
+	return strings.HasPrefix(strings.TrimSpace(settings), "{")
+}
+
+// SetStderrCallback sets a function called with each line the CLI writes to
+// stderr. It is called from its own goroutine; lines it cannot keep up with
+// are dropped rather than blocking the CLI. It must be set before Connect.
+func (t *SubprocessCLITransport) SetStderrCallback(callback func(line string)) {
+	t.stderrCallback = callback
+}
+
+// SetMaxThinkingTokens sets the thinking budget passed as
+// --max-thinking-tokens; 0 disables thinking. Unless it is called the CLI's
+// default applies. It must be called before Connect.
+func (t *SubprocessCLITransport) SetMaxThinkingTokens(tokens int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.maxThinkingTokens = &tokens
+}
+
+// SetExtraArgs sets arguments appended verbatim after the flags the
+// transport generates. It must be called before Connect.
+func (t *SubprocessCLITransport) SetExtraArgs(args []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.extraArgs = args
+}
+
+// args returns the CLI arguments for the subprocess. The input and output
+// format flags are always passed, since without them the CLI writes plain
+// text that the transport cannot parse.
+func (t *SubprocessCLITransport) args() []string {
+	args := []string{
+		"--print",
+		"--input-format=stream-json",
+		"--output-format=stream-json",
+		"--verbose",
+	}
+	if len(t.allowedTools) > 0 {
+		args = append(args, "--allowedTools", strings.Join(t.allowedTools, ","))
+	}
+	if len(t.disallowedTools) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(t.disallowedTools, ","))
+	}
+	if t.agents != "" {
+		args = append(args, "--agents", t.agents)
+	}
+	if t.settingSources != nil {
+		args = append(args, "--setting-sources", strings.Join(t.settingSources, ","))
+	}
+	if t.maxThinkingTokens != nil {
+		args = append(args, "--max-thinking-tokens", strconv.Itoa(*t.maxThinkingTokens))
+	}
+	if t.settingsFile != "" {
+		args = append(args, "--settings", t.settingsFile)
+	} else if t.settings != "" && !IsSettingsJSON(t.settings) {
+		args = append(args, "--settings", t.settings)
 	}
+	return append(args, t.extraArgs...)
+}
+
+// writeSettingsFile writes JSON settings to the temporary file passed to the
+// CLI. Path settings need no file.
+func (t *SubprocessCLITransport) writeSettingsFile() error {
+	if !IsSettingsJSON(t.settings) {
+		return nil
+	}
+	f, err := os.CreateTemp("", "claude-settings-*.json")
+	if err != nil {
+		return types.NewCLIConnectionErrorWithCause("failed to create settings file", err)
+	}
+	t.settingsFile = f.Name()
+	if _, err := f.WriteString(t.settings); err != nil {
+		_ = f.Close()
+		t.removeSettingsFile()
+		return types.NewCLIConnectionErrorWithCause("failed to write settings file", err)
+	}
+	if err := f.Close(); err != nil {
+		t.removeSettingsFile()
+		return types.NewCLIConnectionErrorWithCause("failed to write settings file", err)
+	}
+	return nil
+}
+
+// removeSettingsFile removes the temporary settings file, if any.
+func (t *SubprocessCLITransport) removeSettingsFile() {
+	if t.settingsFile == "" {
+		return
+	}
+	_ = os.Remove(t.settingsFile)
+	t.settingsFile = ""
 }
 
 // Connect starts the Claude Code CLI subprocess and establishes communication pipes.
@@ -66,15 +368,27 @@ func (t *SubprocessCLITransport) Connect(ctx context.Context) error {
 		return nil // Already connected
 	}
 
+	// Take a subprocess slot; it is released once the process is reaped
+	if err := slots.acquire(ctx, t.waitPolicy); err != nil {
+		return err
+	}
+	started := false
+	defer func() {
+		if !started {
+			slots.release()
+			t.removeSettingsFile()
+		}
+	}()
+
+	if err := t.writeSettingsFile(); err != nil {
+		return err
+	}
+
 	// Create cancellable context
 	t.ctx, t.cancel = context.WithCancel(ctx)
 
-	// Build command: claude --print --input-format=stream-json --output-format=stream-json --verbose
-	t.cmd = exec.CommandContext(t.ctx, t.cliPath,
-		"--print",
-		"--input-format=stream-json",
-		"--output-format=stream-json",
-		"--verbose")
+	// Build command: claude --print --input-format=stream-json --output-format=stream-json --verbose [flags]
+	t.cmd = exec.CommandContext(t.ctx, t.cliPath, t.args()...)
 
 	// Set working directory if provided
 	if t.cwd != "" {
@@ -114,11 +428,33 @@ func (t *SubprocessCLITransport) Connect(ctx context.Context) error {
 
 	// Start the process
 	if err := t.cmd.Start(); err != nil {
+		if t.logger != nil {
+			t.logger.Debug("claude: failed to start CLI", "cli_path", t.cliPath, "error", err)
+		}
 		return types.NewCLIConnectionErrorWithCause("failed to start subprocess", err)
 	}
+	started = true
+	trackProcess(t.cmd.Process.Pid)
+	t.setProcessState(types.ProcessState{Status: types.ProcessRunning, PID: t.cmd.Process.Pid})
+	t.countStarted()
+	if t.logger != nil {
+		t.logger.Debug("claude: started CLI",
+			"cli_path", t.cliPath,
+			"cwd", t.cwd,
+			"pid", t.cmd.Process.Pid,
+			"env", t.redactor.envForLog(t.env))
+	}
 
 	// Create JSON line writer for stdin
-	t.writer = NewJSONLineWriter(t.stdin)
+	if t.batchWrite {
+		t.writer = NewBatchedJSONLineWriter(t.stdin, t.batchDelay, t.batchBytes)
+	} else {
+		t.writer = NewJSONLineWriter(t.stdin)
+	}
+
+	// Drain stderr so that the CLI never blocks on a full pipe
+	t.stderrDone = make(chan struct{})
+	go t.readStderr(t.stderr, t.stderrDone)
 
 	// Launch message reader loop in goroutine
 	go t.messageReaderLoop(t.ctx)
@@ -133,9 +469,27 @@ func (t *SubprocessCLITransport) Connect(ctx context.Context) error {
 // It runs in a goroutine and sends messages to the messages channel.
 // It respects context cancellation and closes the messages channel when done.
 func (t *SubprocessCLITransport) messageReaderLoop(ctx context.Context) {
+	defer close(t.readerDone)
 	defer close(t.messages)
+	defer func() {
+		// A cancelled context kills the process; reap it so its slot is
+		// released even if Close is never called
+		if ctx.Err() != nil {
+			t.waitForExit()
+		}
+	}()
 
-	reader := NewJSONLineReader(t.stdout)
+	maxSize, maxDepth := t.maxMessageSize, t.maxMessageDepth
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBufferSize
+	}
+	if maxDepth <= 0 {
+		maxDepth = types.DefaultMaxMessageDepth
+	}
+
+	reader := NewJSONLineReaderWithSize(t.stdout, maxSize)
+	lineNum := 0 // 1-based number of the last line read, reported in decode errors
+	handshaken := false
 
 	for {
 		// Check for context cancellation
@@ -149,48 +503,256 @@ func (t *SubprocessCLITransport) messageReaderLoop(ctx context.Context) {
 		line, err := reader.ReadLine()
 		if err != nil {
 			if err == io.EOF {
-				// Normal end of stream
+				// End of stream - normally the process is exiting
+				t.checkExitAfterEOF(ctx)
 				return
 			}
+			if t.isClosing() {
+				return // Close holds mu and reports how the CLI exited
+			}
 
 			// Store error and return
-			t.OnError(types.NewJSONDecodeErrorWithCause(
+			readErr := types.NewJSONDecodeErrorWithCause(
 				"failed to read JSON line from subprocess",
 				string(line),
 				err,
-			))
+			)
+			readErr.Line = lineNum + 1
+			t.OnError(readErr)
 			return
 		}
 
+		lineNum++
+		t.countRead(line)
+
 		// Skip empty lines
 		if len(line) == 0 {
 			continue
 		}
 
-		// Parse JSON into message
-		msg, err := types.UnmarshalMessage(line)
+		// A first line that is not JSON means the CLI is not writing
+		// stream-json, so no line after it will parse either
+		if !handshaken {
+			handshaken = true
+			if !json.Valid(line) {
+				t.logMessage("invalid", line)
+				t.OnError(types.NewHandshakeError(string(line)))
+				return
+			}
+		}
+
+		// Parse JSON into message; the line buffer is reused, so raw capture
+		// copies it. Pathologically nested lines never reach the decoder.
+		var msg types.Message
+		if exceedsDepth(line, maxDepth) {
+			err = types.NewMessageLimitError(types.MessageLimitDepth, maxDepth, string(line))
+		} else {
+			msg, err = types.UnmarshalMessageWithOptions(line, types.DecodeOptions{
+				KeepRaw:         t.rawMessages,
+				Lenient:         t.lenientParsing,
+				MaxControlInput: t.maxControlInput,
+				Logger:          t.logger,
+			})
+		}
 		if err != nil {
-			// Store parse error but continue reading
-			t.OnError(err)
-			continue
+			// Report the bad line in-band and keep reading
+			t.logMessage("invalid", line)
+			setErrorLine(err, lineNum)
+			msg = parseErrorMessage(err)
+		} else {
+			t.logMessage(msg.GetMessageType(), line)
 		}
 
-		// Send message to channel (respect context cancellation)
+		// Send message to channel (respect context cancellation). Once Close
+		// has begun, messages nobody reads are dropped so that the CLI is not
+		// blocked writing its final output.
 		select {
 		case <-ctx.Done():
 			return
 		case t.messages <- msg:
 			// Message sent successfully
+		case <-t.closing:
+			select {
+			case t.messages <- msg:
+			default:
+			}
+		}
+	}
+}
+
+// isClosing reports whether Close has begun.
+func (t *SubprocessCLITransport) isClosing() bool {
+	select {
+	case <-t.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseErrorMessage builds the SystemMessage sent in place of a line that
+// could not be parsed.
+func parseErrorMessage(err error) *types.SystemMessage {
+	return &types.SystemMessage{
+		Type:    types.MessageTypeSystem,
+		Subtype: "parse_error",
+		Data: map[string]interface{}{
+			"error": err.Error(),
+		},
+		Err: err,
+	}
+}
+
+// setErrorLine records the output line a decode error was found on.
+func setErrorLine(err error, line int) {
+	var decodeErr *types.JSONDecodeError
+	if errors.As(err, &decodeErr) {
+		decodeErr.Line = line
+	}
+	var parseErr *types.MessageParseError
+	if errors.As(err, &parseErr) {
+		parseErr.Line = line
+	}
+	var limitErr *types.MessageLimitError
+	if errors.As(err, &limitErr) {
+		limitErr.Line = line
+	}
+}
+
+// checkExitAfterEOF waits briefly for the process to exit after stdout closed.
+// A process that exited with an error is recorded as a ProcessError. If it
+// keeps running, the transport is marked broken since no more output can arrive.
+func (t *SubprocessCLITransport) checkExitAfterEOF(ctx context.Context) {
+	if t.cmd == nil {
+		return
+	}
+
+	timer := time.NewTimer(stdoutEOFGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-t.waitForExit():
+		// A CLI that crashed between messages is reported by GetError, as
+		// nobody may call Close to learn how it exited
+		if err := t.exitError(); err != nil && !t.isClosing() && ctx.Err() == nil {
+			t.OnError(err)
 		}
+	case <-ctx.Done():
+	case <-t.closing:
+		// Close waits for the exit itself, holding mu
+	case <-timer.C:
+		t.mu.Lock()
+		t.ready = false
+		t.err = types.NewTransportBrokenError("CLI closed stdout but the process is still running")
+		t.mu.Unlock()
+	}
+}
+
+// waitForExit starts cmd.Wait once and returns a channel closed when the process has exited.
+// Wait must only be called after stdout has been fully read or the process is being torn down.
+// Wait closes the stderr pipe, so it first waits for the rest of stderr to be read.
+func (t *SubprocessCLITransport) waitForExit() <-chan struct{} {
+	t.waitOnce.Do(func() {
+		t.exited = make(chan struct{})
+		go func() {
+			timer := time.NewTimer(stderrDrainTimeout)
+			select {
+			case <-t.stderrDone:
+			case <-timer.C:
+			}
+			timer.Stop()
+
+			t.waitErr = t.cmd.Wait()
+			untrackProcess(t.cmd.Process.Pid)
+			exitCode := -1
+			if t.cmd.ProcessState != nil {
+				exitCode = t.cmd.ProcessState.ExitCode()
+			}
+			t.setProcessState(types.ProcessState{Status: types.ProcessExited, PID: t.cmd.Process.Pid, ExitCode: exitCode})
+			slots.release()
+			t.countExited()
+			close(t.exited)
+		}()
+	})
+	return t.exited
+}
+
+// setProcessState records the subprocess's state for PID and ProcessState.
+func (t *SubprocessCLITransport) setProcessState(state types.ProcessState) {
+	t.procMu.Lock()
+	defer t.procMu.Unlock()
+	t.procState = state
+}
+
+// PID returns the process ID of the CLI subprocess and true while it is
+// running. It returns false before Connect and once the process has exited.
+func (t *SubprocessCLITransport) PID() (int, bool) {
+	state := t.ProcessState()
+	return state.PID, state.Running()
+}
+
+// ProcessState returns the state of the CLI subprocess. A process that has
+// exited is reported once it has been reaped, which Close always does.
+func (t *SubprocessCLITransport) ProcessState() types.ProcessState {
+	t.procMu.Lock()
+	defer t.procMu.Unlock()
+
+	if t.procState.Status == "" {
+		return types.ProcessState{Status: types.ProcessNotStarted}
 	}
+	return t.procState
 }
 
 // Write sends a JSON message to the subprocess stdin.
 // The data should be a complete JSON string (newline will be added automatically).
 func (t *SubprocessCLITransport) Write(ctx context.Context, data string) error {
+	return t.WriteBatch(ctx, []string{data})
+}
+
+// WriteBatch sends several JSON messages to the subprocess stdin contiguously.
+// Unless batched writes are enabled, the lines are flushed together.
+func (t *SubprocessCLITransport) WriteBatch(ctx context.Context, lines []string) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
+	if err := t.checkWritableLocked(); err != nil {
+		return err
+	}
+	if err := t.checkWriteSizeLocked(lines); err != nil {
+		return err
+	}
+
+	t.logLines(lines)
+	if err := t.writer.WriteLines(lines); err != nil {
+		return t.writeFailedLocked(err)
+	}
+	t.countWritten(lines)
+
+	return nil
+}
+
+// Flush writes any batched stdin data to the subprocess.
+func (t *SubprocessCLITransport) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkWritableLocked(); err != nil {
+		return err
+	}
+
+	if err := t.writer.Flush(); err != nil {
+		return t.writeFailedLocked(err)
+	}
+
+	return nil
+}
+
+// checkWritableLocked reports why stdin cannot be written, if it can't. The caller must hold t.mu.
+func (t *SubprocessCLITransport) checkWritableLocked() error {
+	if t.inputClosed {
+		return types.NewInputClosedError("cannot write after input was closed")
+	}
+
 	if !t.ready {
 		return types.NewCLIConnectionError("transport is not ready for writing")
 	}
@@ -199,13 +761,68 @@ func (t *SubprocessCLITransport) Write(ctx context.Context, data string) error {
 		return types.NewCLIConnectionError("stdin writer not initialized")
 	}
 
-	// Write JSON line (includes newline and flush)
-	if err := t.writer.WriteLine(data); err != nil {
-		t.ready = false
-		t.err = types.NewCLIConnectionErrorWithCause("failed to write to subprocess stdin", err)
-		return t.err
+	return nil
+}
+
+// checkWriteSizeLocked rejects lines if any is over the maximum size, writing
+// none of them, and otherwise warns of those over the warning size. The caller
+// must hold t.mu.
+func (t *SubprocessCLITransport) checkWriteSizeLocked(lines []string) error {
+	if t.maxWriteSize > 0 {
+		for _, line := range lines {
+			if len(line) > t.maxWriteSize {
+				t.countOversized("max")
+				if t.logger != nil {
+					t.logger.Warn("claude: line for CLI over the maximum size, not written",
+						"bytes", len(line), "max", t.maxWriteSize)
+				}
+				return types.NewOutboundTooLargeError(line, t.maxWriteSize)
+			}
+		}
+	}
+	if t.warnWriteSize > 0 {
+		for _, line := range lines {
+			if len(line) > t.warnWriteSize {
+				t.countOversized("warn")
+				if t.logger != nil {
+					t.logger.Warn("claude: large line for CLI",
+						"bytes", len(line), "warn_size", t.warnWriteSize, "max", t.maxWriteSize)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeFailedLocked marks the transport unusable after a write error. The caller must hold t.mu.
+func (t *SubprocessCLITransport) writeFailedLocked(err error) error {
+	t.ready = false
+	t.err = types.NewCLIConnectionErrorWithCause("failed to write to subprocess stdin", err)
+	return t.err
+}
+
+// EndInput closes stdin so the subprocess sees EOF, leaving stdout consumption running.
+func (t *SubprocessCLITransport) EndInput(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.inputClosed {
+		return nil
 	}
 
+	if t.cmd == nil || t.stdin == nil {
+		return types.NewCLIConnectionError("transport is not connected")
+	}
+
+	t.inputClosed = true
+	_ = t.writer.Flush()
+	t.writer = nil
+
+	if err := t.stdin.Close(); err != nil {
+		return types.NewCLIConnectionErrorWithCause("failed to close subprocess stdin", err)
+	}
+	t.stdin = nil
+
 	return nil
 }
 
@@ -216,7 +833,12 @@ func (t *SubprocessCLITransport) ReadMessages(ctx context.Context) <-chan types.
 }
 
 // Close terminates the subprocess and cleans up all resources.
-// It attempts to gracefully shut down the subprocess with a timeout.
+//
+// It closes the CLI's input and waits for the CLI to finish writing and exit,
+// killing it after the close timeout (see SetCloseTimeout). The timeout
+// applies even if ctx is already done, as it commonly is when Close is
+// deferred after a timeout; a ctx that is still alive can only shorten the
+// wait. A killed CLI is reported as a ProcessError.
 func (t *SubprocessCLITransport) Close(ctx context.Context) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -224,49 +846,111 @@ func (t *SubprocessCLITransport) Close(ctx context.Context) error {
 	if t.cmd == nil {
 		return nil // Not connected
 	}
+	defer t.removeSettingsFile() // Once the CLI has exited
 
 	t.ready = false
+	if t.logger != nil {
+		t.logger.Debug("claude: closing CLI", "cli_path", t.cliPath)
+	}
 
-	// Cancel the context to stop goroutines
-	if t.cancel != nil {
-		t.cancel()
-		t.cancel = nil
+	// Stop delivering messages nobody may read, so the CLI can exit
+	if !t.isClosing() {
+		close(t.closing)
+	}
+
+	// A cancelled context kills the CLI, but not synchronously: kill it now
+	// so that it cannot exit on its own once its input is closed
+	if t.ctx.Err() != nil && t.cmd.Process != nil {
+		_ = t.cmd.Process.Kill()
 	}
 
-	// Close stdin to signal end of input
+	// Flush batched input, then close stdin to signal end of input
+	if t.writer != nil {
+		_ = t.writer.Flush()
+	}
 	if t.stdin != nil {
 		_ = t.stdin.Close()
 		t.stdin = nil
 	}
 
-	// Wait for process to exit (with context timeout)
-	done := make(chan error, 1)
+	// The CLI has exited once its output has been read and it has been reaped
+	exited := make(chan struct{})
 	go func() {
-		done <- t.cmd.Wait()
+		<-t.readerDone
+		<-t.waitForExit()
+		close(exited)
 	}()
 
-	select {
-	case <-ctx.Done():
-		// Timeout - kill the process
+	var expired <-chan time.Time
+	if t.closeTimeout > 0 {
+		timer := time.NewTimer(t.closeTimeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var ctxDone <-chan struct{}
+	if ctx.Err() == nil || expired == nil {
+		ctxDone = ctx.Done()
+	}
+
+	// A process that has already exited is reaped at once, whatever the error
+	var killed bool
+	if t.err != nil && t.ProcessState().Status != types.ProcessExited {
+		// The transport has failed, so the CLI is not given time to finish
+		select {
+		case <-exited:
+		default:
+			killed = true
+		}
+	} else {
+		select {
+		case <-exited:
+		case <-expired:
+			killed = true
+		case <-ctxDone:
+			killed = true
+		}
+	}
+
+	// Cancel the context to stop goroutines, killing the CLI if it is still running
+	if t.cancel != nil {
+		t.cancel()
+		t.cancel = nil
+	}
+
+	if killed {
 		if t.cmd.Process != nil {
 			_ = t.cmd.Process.Kill()
 		}
-		<-done // Wait for Wait() to return
+		<-t.waitForExit() // Wait for Wait() to return
+		if t.logger != nil {
+			t.logger.Debug("claude: killed CLI after close timeout", "cli_path", t.cliPath)
+		}
 		return types.NewProcessError("subprocess did not exit gracefully, killed")
+	}
 
-	case err := <-done:
-		// Process exited
-		if err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				return types.NewProcessErrorWithCode(
-					"subprocess exited with error",
-					exitErr.ExitCode(),
-				)
-			}
-			return types.NewProcessErrorWithCause("subprocess exited with error", err)
-		}
+	// Process exited
+	if t.logger != nil {
+		t.logger.Debug("claude: CLI exited", "cli_path", t.cliPath, "error", t.waitErr)
+	}
+	return t.exitError()
+}
+
+// exitError returns a ProcessError with the exit code and stderr tail of a
+// process that exited with an error, or nil. It must only be called once the
+// process has been reaped.
+func (t *SubprocessCLITransport) exitError() error {
+	err := t.waitErr
+	if err == nil {
 		return nil
 	}
+	var procErr *types.ProcessError
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		procErr = types.NewProcessErrorWithCode("subprocess exited with error", exitErr.ExitCode())
+	} else {
+		procErr = types.NewProcessErrorWithCause("subprocess exited with error", err)
+	}
+	procErr.Stderr = strings.Join(t.StderrTail(), "\n")
+	return procErr
 }
 
 // OnError stores an error that occurred during transport operation.
@@ -296,30 +980,3 @@ func (t *SubprocessCLITransport) GetError() error {
 
 	return t.err
 }
-
-// readStderr reads stderr output in a goroutine for debugging.
-// This is a helper function for monitoring subprocess errors.
-// nolint:unused
-func (t *SubprocessCLITransport) readStderr(ctx context.Context) {
-	if t.stderr == nil {
-		return
-	}
-
-	reader := NewJSONLineReader(t.stderr)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-
-		line, err := reader.ReadLine()
-		if err != nil {
-			return
-		}
-
-		// Could log or handle stderr here
-		// For now, we just read and discard
-		_ = line
-	}
-}
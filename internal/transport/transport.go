@@ -22,6 +22,19 @@ type Transport interface {
 	// The data should be a complete JSON line (without the trailing newline - it will be added).
 	Write(ctx context.Context, data string) error
 
+	// WriteBatch sends several JSON messages to the subprocess stdin, in order and
+	// without interleaving other writes. Ordering is preserved across Write and WriteBatch.
+	WriteBatch(ctx context.Context, lines []string) error
+
+	// Flush forces any batched writes out to the subprocess.
+	// It is a no-op when write batching is disabled.
+	Flush(ctx context.Context) error
+
+	// EndInput closes the subprocess stdin to signal that no more input will be sent.
+	// Reading from stdout continues until the subprocess closes it. Subsequent Write
+	// calls return an InputClosedError. Calling EndInput more than once is a no-op.
+	EndInput(ctx context.Context) error
+
 	// ReadMessages returns a channel of incoming messages from subprocess stdout.
 	// The channel is closed when the subprocess exits or an error occurs.
 	// Messages are parsed from JSON lines and returned as Message interface types.
@@ -31,7 +44,24 @@ type Transport interface {
 	// Implementations can use this to store errors for later retrieval.
 	OnError(err error)
 
+	// GetError returns the first error recorded by the transport, if any.
+	// A TransportBrokenError means the CLI stopped producing output while still running.
+	GetError() error
+
 	// IsReady checks if the transport is ready for communication.
 	// Returns true if the subprocess is running and ready to send/receive messages.
 	IsReady() bool
 }
+
+// ProcessReporter is implemented by transports that run the CLI as a local
+// subprocess, so that operators can correlate it with system metrics. Both
+// methods are safe to call concurrently with Close.
+type ProcessReporter interface {
+	// PID returns the subprocess's process ID and true while it is running.
+	// Once it has exited the PID may be reused, so it returns false.
+	PID() (int, bool)
+
+	// ProcessState returns whether the subprocess is running or has exited,
+	// with its exit code once known.
+	ProcessState() types.ProcessState
+}
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -145,6 +149,76 @@ func TestExpandHome(t *testing.T) {
 	}
 }
 
+// TestResolveCWD tests working directory validation and resolution
+func TestResolveCWD(t *testing.T) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatalf("Failed to get home directory: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(filePath, []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		cwd       string
+		create    bool
+		want      string
+		wantError bool
+	}{
+		{name: "empty", cwd: "", want: ""},
+		{name: "existing directory", cwd: tmpDir, want: tmpDir},
+		{name: "tilde expansion", cwd: "~", want: homeDir},
+		{name: "missing directory", cwd: filepath.Join(tmpDir, "missing"), wantError: true},
+		{name: "file instead of directory", cwd: filePath, wantError: true},
+		{name: "file instead of directory with create", cwd: filePath, create: true, wantError: true},
+		{name: "create missing directory", cwd: filepath.Join(tmpDir, "a", "b"), create: true, want: filepath.Join(tmpDir, "a", "b")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveCWD(tt.cwd, tt.create)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("ResolveCWD(%q) expected error, got %q", tt.cwd, got)
+				}
+				if !types.IsWorkingDirectoryError(err) {
+					t.Errorf("ResolveCWD() error type = %T, want *types.WorkingDirectoryError", err)
+				}
+				if !strings.Contains(err.Error(), tt.cwd) {
+					t.Errorf("ResolveCWD() error %q does not name path %q", err, tt.cwd)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveCWD(%q) unexpected error: %v", tt.cwd, err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveCWD(%q) = %q, want %q", tt.cwd, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestResolveCWDRelative tests that relative paths resolve against the current directory
+func TestResolveCWDRelative(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+
+	got, err := ResolveCWD(".", false)
+	if err != nil {
+		t.Fatalf("ResolveCWD(\".\") unexpected error: %v", err)
+	}
+	if got != wd {
+		t.Errorf("ResolveCWD(\".\") = %q, want %q", got, wd)
+	}
+}
+
 // TestJSONLineReader tests buffered JSON line reading
 func TestJSONLineReader(t *testing.T) {
 	tests := []struct {
@@ -283,6 +357,262 @@ func TestJSONLineWriter(t *testing.T) {
 	}
 }
 
+// countingWriter records each Write call, standing in for a write syscall.
+type countingWriter struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes int
+	err    error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.writes++
+	return w.buf.Write(p)
+}
+
+func (w *countingWriter) snapshot() (string, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String(), w.writes
+}
+
+// TestJSONLineWriterWriteLines tests that unbatched WriteLines flushes once
+func TestJSONLineWriterWriteLines(t *testing.T) {
+	var out countingWriter
+	writer := NewJSONLineWriter(&out)
+
+	if err := writer.WriteLines([]string{`{"n":1}`, `{"n":2}`, `{"n":3}`}); err != nil {
+		t.Fatalf("WriteLines() unexpected error: %v", err)
+	}
+
+	got, writes := out.snapshot()
+	if got != "{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n" {
+		t.Errorf("WriteLines() wrote %q", got)
+	}
+	if writes != 1 {
+		t.Errorf("WriteLines() made %d writes, want 1", writes)
+	}
+}
+
+// TestBatchedJSONLineWriter tests flushing on size, timer, and explicit Flush
+func TestBatchedJSONLineWriter(t *testing.T) {
+	t.Run("explicit flush", func(t *testing.T) {
+		var out countingWriter
+		writer := NewBatchedJSONLineWriter(&out, time.Hour, 1024)
+
+		for i := 0; i < 5; i++ {
+			if err := writer.WriteLine(`{"type":"test"}`); err != nil {
+				t.Fatalf("WriteLine() unexpected error: %v", err)
+			}
+		}
+		if _, writes := out.snapshot(); writes != 0 {
+			t.Fatalf("expected no writes before flush, got %d", writes)
+		}
+
+		if err := writer.Flush(); err != nil {
+			t.Fatalf("Flush() unexpected error: %v", err)
+		}
+		got, writes := out.snapshot()
+		if writes != 1 || strings.Count(got, "\n") != 5 {
+			t.Errorf("Flush() made %d writes with %q", writes, got)
+		}
+	})
+
+	t.Run("size threshold", func(t *testing.T) {
+		var out countingWriter
+		line := strings.Repeat("x", 30)
+		writer := NewBatchedJSONLineWriter(&out, time.Hour, 64)
+
+		for i := 0; i < 2; i++ {
+			if err := writer.WriteLine(line); err != nil {
+				t.Fatalf("WriteLine() unexpected error: %v", err)
+			}
+		}
+		if _, writes := out.snapshot(); writes != 0 {
+			t.Fatalf("expected no writes below threshold, got %d", writes)
+		}
+
+		if err := writer.WriteLine(line); err != nil {
+			t.Fatalf("WriteLine() unexpected error: %v", err)
+		}
+		if got, _ := out.snapshot(); strings.Count(got, "\n") != 3 {
+			t.Errorf("expected 3 lines flushed at threshold, got %q", got)
+		}
+	})
+
+	t.Run("timer", func(t *testing.T) {
+		var out countingWriter
+		writer := NewBatchedJSONLineWriter(&out, 10*time.Millisecond, 1024)
+
+		if err := writer.WriteLines([]string{`{"n":1}`, `{"n":2}`}); err != nil {
+			t.Fatalf("WriteLines() unexpected error: %v", err)
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if got, writes := out.snapshot(); writes > 0 {
+				if writes != 1 || got != "{\"n\":1}\n{\"n\":2}\n" {
+					t.Errorf("timer flush made %d writes with %q", writes, got)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("timer did not flush the batch")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("timer flush error is sticky", func(t *testing.T) {
+		out := countingWriter{err: io.ErrClosedPipe}
+		writer := NewBatchedJSONLineWriter(&out, time.Millisecond, 1024)
+
+		if err := writer.WriteLine(`{"n":1}`); err != nil {
+			t.Fatalf("WriteLine() unexpected error: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		if err := writer.WriteLine(`{"n":2}`); err != io.ErrClosedPipe {
+			t.Errorf("WriteLine() after failed flush = %v, want %v", err, io.ErrClosedPipe)
+		}
+	})
+}
+
+// TestBatchedJSONLineWriterOrdering tests that concurrent WriteLine and WriteLines
+// calls keep per-caller order and never interleave a batch
+func TestBatchedJSONLineWriterOrdering(t *testing.T) {
+	var out countingWriter
+	writer := NewBatchedJSONLineWriter(&out, time.Millisecond, 256)
+
+	const writers = 8
+	const perWriter = 50
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if i%5 == 0 {
+					batch := []string{
+						fmt.Sprintf(`{"w":%d,"i":%d,"part":0}`, w, i),
+						fmt.Sprintf(`{"w":%d,"i":%d,"part":1}`, w, i),
+					}
+					if err := writer.WriteLines(batch); err != nil {
+						t.Errorf("WriteLines() unexpected error: %v", err)
+					}
+					continue
+				}
+				if err := writer.WriteLine(fmt.Sprintf(`{"w":%d,"i":%d}`, w, i)); err != nil {
+					t.Errorf("WriteLine() unexpected error: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush() unexpected error: %v", err)
+	}
+
+	got, _ := out.snapshot()
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+
+	next := make([]int, writers)
+	for idx, line := range lines {
+		var entry struct {
+			W    int  `json:"w"`
+			I    int  `json:"i"`
+			Part *int `json:"part"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %d is not valid JSON: %q", idx, line)
+		}
+		if entry.I != next[entry.W] {
+			t.Fatalf("writer %d: got item %d, want %d", entry.W, entry.I, next[entry.W])
+		}
+		if entry.Part != nil && *entry.Part == 0 {
+			if idx+1 >= len(lines) || lines[idx+1] != fmt.Sprintf(`{"w":%d,"i":%d,"part":1}`, entry.W, entry.I) {
+				t.Fatalf("batch for writer %d item %d was interleaved", entry.W, entry.I)
+			}
+			continue
+		}
+		next[entry.W]++
+	}
+
+	for w, n := range next {
+		if n != perWriter {
+			t.Errorf("writer %d: got %d items, want %d", w, n, perWriter)
+		}
+	}
+}
+
+// TestSubprocessCLITransportWriteBatch tests ordered batched writes through a subprocess
+func TestSubprocessCLITransportWriteBatch(t *testing.T) {
+	catPath, err := FindMockCLI()
+	if err != nil || !strings.HasSuffix(catPath, "cat") {
+		t.Skip("No cat command available for testing")
+	}
+
+	// Echo stdin back regardless of CLI flags
+	script := filepath.Join(t.TempDir(), "mock-cli")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexec "+catPath+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := NewSubprocessCLITransport(script, "", nil)
+	transport.SetWriteBatching(time.Hour, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	defer func() {
+		_ = transport.Close(ctx)
+	}()
+
+	msg := func(subtype string) string {
+		return `{"type":"system","subtype":"` + subtype + `","data":{}}`
+	}
+	if err := transport.Write(ctx, msg("a")); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+	if err := transport.WriteBatch(ctx, []string{msg("b"), msg("c")}); err != nil {
+		t.Fatalf("WriteBatch() unexpected error: %v", err)
+	}
+	if err := transport.Write(ctx, msg("d")); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+	if err := transport.Flush(ctx); err != nil {
+		t.Fatalf("Flush() unexpected error: %v", err)
+	}
+
+	var subtypes []string
+	messages := transport.ReadMessages(ctx)
+	for len(subtypes) < 4 {
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				t.Fatalf("channel closed after %v", subtypes)
+			}
+			subtypes = append(subtypes, m.(*types.SystemMessage).Subtype)
+		case <-ctx.Done():
+			t.Fatalf("timed out after %v", subtypes)
+		}
+	}
+
+	if got := strings.Join(subtypes, ""); got != "abcd" {
+		t.Errorf("received order %q, want %q", got, "abcd")
+	}
+}
+
 // TestSubprocessCLITransportConnect tests subprocess connection
 func TestSubprocessCLITransportConnect(t *testing.T) {
 	// Skip if no echo command available
@@ -312,6 +642,107 @@ func TestSubprocessCLITransportConnect(t *testing.T) {
 	}
 }
 
+// TestSubprocessCLITransportArgs tests the CLI arguments built from the tool filter
+func TestSubprocessCLITransportArgs(t *testing.T) {
+	base := "--print --input-format=stream-json --output-format=stream-json --verbose"
+	tests := []struct {
+		name       string
+		allowed    []string
+		disallowed []string
+		want       string
+	}{
+		{"no filter", nil, nil, base},
+		{"allowed only", []string{"Read", "Grep"}, nil, base + " --allowedTools Read,Grep"},
+		{"disallowed only", nil, []string{"Bash"}, base + " --disallowedTools Bash"},
+		{"both", []string{"Read"}, []string{"Bash", "Write"}, base + " --allowedTools Read --disallowedTools Bash,Write"},
+		{"empty lists", []string{}, []string{}, base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewSubprocessCLITransport("claude", "", nil)
+			transport.SetToolFilter(tt.allowed, tt.disallowed)
+			if got := strings.Join(transport.args(), " "); got != tt.want {
+				t.Errorf("args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSubprocessCLITransportArgsAgents tests that agents are passed as one --agents argument
+func TestSubprocessCLITransportArgsAgents(t *testing.T) {
+	agents := `{"reviewer":{"description":"Reviews code","prompt":"Review it"}}`
+	transport := NewSubprocessCLITransport("claude", "", nil)
+	transport.SetAgents(agents)
+
+	args := transport.args()
+	if len(args) < 2 || args[len(args)-2] != "--agents" || args[len(args)-1] != agents {
+		t.Errorf("args() = %q, want to end with --agents %s", args, agents)
+	}
+}
+
+// TestSubprocessCLITransportArgsSettings tests the setting flags
+func TestSubprocessCLITransportArgsSettings(t *testing.T) {
+	base := "--print --input-format=stream-json --output-format=stream-json --verbose"
+	tests := []struct {
+		name     string
+		sources  []string
+		settings string
+		want     string
+	}{
+		{"default", nil, "", base},
+		{"sources", []string{"user", "project"}, "", base + " --setting-sources user,project"},
+		{"no sources", []string{}, "", base + " --setting-sources "},
+		{"settings path", nil, "/etc/claude/settings.json", base + " --settings /etc/claude/settings.json"},
+		{"both", []string{"local"}, "team.json", base + " --setting-sources local --settings team.json"},
+		{"settings JSON before Connect", nil, `{"model":"m"}`, base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := NewSubprocessCLITransport("claude", "", nil)
+			transport.SetSettingSources(tt.sources)
+			transport.SetSettings(tt.settings)
+			if got := strings.Join(transport.args(), " "); got != tt.want {
+				t.Errorf("args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSubprocessCLITransportSettingsFileOnStartFailure tests that the
+// temporary settings file is removed when the CLI fails to start
+func TestSubprocessCLITransportSettingsFileOnStartFailure(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	transport := NewSubprocessCLITransport(filepath.Join(tmp, "missing-claude"), "", nil)
+	transport.SetSettings(`{"model":"m"}`)
+	if err := transport.Connect(context.Background()); err == nil {
+		t.Fatal("Connect() succeeded, want an error for a missing CLI")
+	}
+
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("temporary directory holds %v, want the settings file removed", entries)
+	}
+}
+
+// TestSubprocessCLITransportArgsExtra tests that extra arguments come last
+func TestSubprocessCLITransportArgsExtra(t *testing.T) {
+	transport := NewSubprocessCLITransport("claude", "", nil)
+	transport.SetToolFilter([]string{"Read"}, nil)
+	transport.SetExtraArgs([]string{"--debug", "api"})
+
+	want := "--print --input-format=stream-json --output-format=stream-json --verbose --allowedTools Read --debug api"
+	if got := strings.Join(transport.args(), " "); got != want {
+		t.Errorf("args() = %q, want %q", got, want)
+	}
+}
+
 // TestSubprocessCLITransportWrite tests writing to subprocess
 func TestSubprocessCLITransportWrite(t *testing.T) {
 	// Use cat command as a simple echo subprocess
@@ -340,6 +771,475 @@ func TestSubprocessCLITransportWrite(t *testing.T) {
 	}
 }
 
+// TestSubprocessCLITransportEndInput tests that output keeps flowing after stdin is closed
+func TestSubprocessCLITransportEndInput(t *testing.T) {
+	catPath, err := FindMockCLI()
+	if err != nil || !strings.HasSuffix(catPath, "cat") {
+		t.Skip("No cat command available for testing")
+	}
+
+	// Echo stdin back, then emit a final message once stdin reaches EOF
+	script := filepath.Join(t.TempDir(), "mock-cli")
+	body := "#!/bin/sh\n" + catPath + "\n" + `echo '{"type":"system","subtype":"done","data":{}}'` + "\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := NewSubprocessCLITransport(script, "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	defer func() {
+		_ = transport.Close(ctx)
+	}()
+
+	if err := transport.Write(ctx, `{"type":"system","subtype":"echo","data":{}}`); err != nil {
+		t.Fatalf("Write() unexpected error: %v", err)
+	}
+
+	if err := transport.EndInput(ctx); err != nil {
+		t.Fatalf("EndInput() unexpected error: %v", err)
+	}
+	if err := transport.EndInput(ctx); err != nil {
+		t.Errorf("second EndInput() unexpected error: %v", err)
+	}
+
+	if err := transport.Write(ctx, `{"type":"system","subtype":"late","data":{}}`); !types.IsInputClosedError(err) {
+		t.Errorf("Write() after EndInput error = %v, want InputClosedError", err)
+	}
+
+	var subtypes []string
+	for msg := range transport.ReadMessages(ctx) {
+		if sys, ok := msg.(*types.SystemMessage); ok {
+			subtypes = append(subtypes, sys.Subtype)
+		}
+	}
+
+	if want := []string{"echo", "done"}; strings.Join(subtypes, ",") != strings.Join(want, ",") {
+		t.Errorf("received subtypes %v, want %v", subtypes, want)
+	}
+}
+
+// TestSubprocessCLITransportStdoutClosed tests detection of a CLI that closes stdout but keeps running
+func TestSubprocessCLITransportStdoutClosed(t *testing.T) {
+	orig := stdoutEOFGracePeriod
+	stdoutEOFGracePeriod = 100 * time.Millisecond
+	defer func() { stdoutEOFGracePeriod = orig }()
+
+	tests := []struct {
+		name       string
+		script     string
+		wantBroken bool
+	}{
+		{
+			name:       "stdout closed, process alive",
+			script:     "#!/bin/sh\necho '{\"type\":\"system\",\"subtype\":\"init\",\"data\":{}}'\nexec 1>&-\nexec sleep 30\n",
+			wantBroken: true,
+		},
+		{
+			name:       "normal exit",
+			script:     "#!/bin/sh\necho '{\"type\":\"system\",\"subtype\":\"init\",\"data\":{}}'\n",
+			wantBroken: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := filepath.Join(t.TempDir(), "mock-cli")
+			if err := os.WriteFile(script, []byte(tt.script), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			transport := NewSubprocessCLITransport(script, "", nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := transport.Connect(ctx); err != nil {
+				t.Fatalf("Connect() unexpected error: %v", err)
+			}
+			defer func() {
+				_ = transport.Close(ctx)
+			}()
+
+			count := 0
+			for range transport.ReadMessages(ctx) {
+				count++
+			}
+			if count != 1 {
+				t.Errorf("received %d messages, want 1", count)
+			}
+
+			err := transport.GetError()
+			if got := types.IsTransportBrokenError(err); got != tt.wantBroken {
+				t.Errorf("GetError() = %v, want broken = %v", err, tt.wantBroken)
+			}
+			if tt.wantBroken && transport.IsReady() {
+				t.Error("IsReady() = true for broken transport")
+			}
+		})
+	}
+}
+
+// TestSubprocessCLITransportParseError tests that an unparsable line is reported in-band
+func TestSubprocessCLITransportParseError(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "mock-cli")
+	body := "#!/bin/sh\n" +
+		"echo '{\"type\":\"system\",\"subtype\":\"init\",\"data\":{}}'\n" +
+		"echo '{not json'\n" +
+		"echo '{\"type\":\"system\",\"subtype\":\"status\",\"data\":{}}'\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := NewSubprocessCLITransport(script, "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	defer func() {
+		_ = transport.Close(ctx)
+	}()
+
+	var subtypes []string
+	for msg := range transport.ReadMessages(ctx) {
+		sys, ok := msg.(*types.SystemMessage)
+		if !ok {
+			t.Fatalf("unexpected message %T", msg)
+		}
+		subtypes = append(subtypes, sys.Subtype)
+		if sys.Subtype == "parse_error" && sys.Err == nil {
+			t.Error("parse_error message has no Err")
+		}
+	}
+
+	if want := []string{"init", "parse_error", "status"}; strings.Join(subtypes, ",") != strings.Join(want, ",") {
+		t.Errorf("received subtypes %v, want %v", subtypes, want)
+	}
+	if err := transport.GetError(); err != nil {
+		t.Errorf("GetError() = %v, want nil for a recoverable parse error", err)
+	}
+}
+
+// TestSubprocessCLITransportHandshakeError tests that a first line of output
+// that is not JSON fails the transport instead of being reported in-band
+func TestSubprocessCLITransportHandshakeError(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "mock-cli")
+	body := "#!/bin/sh\n" +
+		"echo 'Invalid API key. Please run /login'\n" +
+		"echo '{\"type\":\"system\",\"subtype\":\"init\",\"data\":{}}'\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := NewSubprocessCLITransport(script, "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	defer func() {
+		_ = transport.Close(ctx)
+	}()
+
+	for msg := range transport.ReadMessages(ctx) {
+		t.Errorf("unexpected message %T after a handshake failure", msg)
+	}
+
+	err := transport.GetError()
+	var handshakeErr *types.HandshakeError
+	if !errors.As(err, &handshakeErr) {
+		t.Fatalf("GetError() = %v, want HandshakeError", err)
+	}
+	if handshakeErr.FirstLine != "Invalid API key. Please run /login" {
+		t.Errorf("FirstLine = %q, want the CLI's first line", handshakeErr.FirstLine)
+	}
+}
+
+// TestSubprocessCLITransportParseErrorLine tests that a parse error reports
+// the line it was found on, counting every line of output
+func TestSubprocessCLITransportParseErrorLine(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "mock-cli")
+	body := "#!/bin/sh\n" +
+		"for i in 1 2 3 4; do echo '{\"type\":\"system\",\"subtype\":\"status\",\"data\":{}}'; done\n" +
+		"echo\n" +
+		"echo '{\"type\":\"result\",\"subtype\":\"success\",\"num_turns\":\"many\"}'\n" +
+		"echo '{\"type\":\"bogus\"}'\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := NewSubprocessCLITransport(script, "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	defer func() {
+		_ = transport.Close(ctx)
+	}()
+
+	var errs []error
+	for msg := range transport.ReadMessages(ctx) {
+		if sys, ok := msg.(*types.SystemMessage); ok && sys.Subtype == "parse_error" {
+			errs = append(errs, sys.Err)
+		}
+	}
+	if len(errs) != 2 {
+		t.Fatalf("received %d parse errors, want 2", len(errs))
+	}
+
+	var decodeErr *types.JSONDecodeError
+	if !errors.As(errs[0], &decodeErr) {
+		t.Fatalf("expected JSONDecodeError, got %v", errs[0])
+	}
+	if decodeErr.Line != 6 {
+		t.Errorf("Line = %d, want 6", decodeErr.Line)
+	}
+	if decodeErr.Offset == 0 {
+		t.Error("expected the offset of the bad field")
+	}
+	if !strings.Contains(decodeErr.Snippet, `"num_turns":"many"`) {
+		t.Errorf("unexpected snippet %q", decodeErr.Snippet)
+	}
+
+	var parseErr *types.MessageParseError
+	if !errors.As(errs[1], &parseErr) {
+		t.Fatalf("expected MessageParseError, got %v", errs[1])
+	}
+	if parseErr.Line != 7 || parseErr.MessageType != "bogus" {
+		t.Errorf("Line = %d, MessageType = %q, want 7 and bogus", parseErr.Line, parseErr.MessageType)
+	}
+	if !strings.Contains(parseErr.Error(), "line 7") {
+		t.Errorf("expected the message to name the line, got %q", parseErr.Error())
+	}
+}
+
+// TestSubprocessCLITransportMessageLimits tests that lines over the depth
+// limit are rejected in-band and lines over the size limit stop the session.
+func TestSubprocessCLITransportMessageLimits(t *testing.T) {
+	deep := `{"type":"system","subtype":"status","data":{"x":` + nested(20) + `}}`
+	script := filepath.Join(t.TempDir(), "mock-cli")
+	body := "#!/bin/sh\n" +
+		"echo '" + deep + "'\n" +
+		"echo '{\"type\":\"system\",\"subtype\":\"status\",\"data\":{\"x\":" + nested(5) + "}}'\n" +
+		"printf '%0200d\\n' 0\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := NewSubprocessCLITransport(script, "", nil)
+	transport.SetMessageLimits(128, 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	defer func() {
+		_ = transport.Close(ctx)
+	}()
+
+	var msgs []types.Message
+	for msg := range transport.ReadMessages(ctx) {
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("received %d messages, want 2", len(msgs))
+	}
+
+	sys, ok := msgs[0].(*types.SystemMessage)
+	var limitErr *types.MessageLimitError
+	if !ok || sys.Subtype != "parse_error" || !errors.As(sys.Err, &limitErr) {
+		t.Fatalf("first message = %+v, want a parse_error with a MessageLimitError", msgs[0])
+	}
+	if limitErr.Limit != types.MessageLimitDepth || limitErr.Max != 10 || limitErr.Line != 1 {
+		t.Errorf("depth error = %+v, want depth 10 on line 1", limitErr)
+	}
+	if sys, ok := msgs[1].(*types.SystemMessage); !ok || sys.Subtype != "status" {
+		t.Errorf("second message = %+v, want the status message", msgs[1])
+	}
+
+	err := transport.GetError()
+	var decodeErr *types.JSONDecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Line != 3 {
+		t.Fatalf("transport error = %v, want a JSONDecodeError on line 3", err)
+	}
+	if !errors.As(err, &limitErr) || limitErr.Limit != types.MessageLimitSize || limitErr.Max != 128 {
+		t.Errorf("transport error = %v, want a size MessageLimitError", err)
+	}
+}
+
+// counterSink is a types.MetricsSink keeping the counters it is given,
+// keyed by name and the "limit" label.
+type counterSink struct {
+	mu       sync.Mutex
+	counters map[string]float64
+}
+
+func (s *counterSink) IncCounter(name string, delta float64, labels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counters == nil {
+		s.counters = make(map[string]float64)
+	}
+	s.counters[name+"/"+labels["limit"]] += delta
+}
+
+func (s *counterSink) AddGauge(string, float64, map[string]string)              {}
+func (s *counterSink) ObserveDuration(string, time.Duration, map[string]string) {}
+
+func (s *counterSink) counter(name, limit string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[name+"/"+limit]
+}
+
+// TestSubprocessCLITransportOutboundLimits tests that lines over the warning
+// size are written with a warning and lines over the maximum are rejected,
+// with lines exactly at either limit written as usual.
+func TestSubprocessCLITransportOutboundLimits(t *testing.T) {
+	catPath, err := FindMockCLI()
+	if err != nil || !strings.HasSuffix(catPath, "cat") {
+		t.Skip("No cat command available for testing")
+	}
+
+	// Record stdin regardless of CLI flags
+	dir := t.TempDir()
+	received := filepath.Join(dir, "stdin")
+	script := filepath.Join(dir, "mock-cli")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexec "+catPath+" > "+received+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := NewSubprocessCLITransport(script, "", nil)
+	transport.SetOutboundLimits(10, 20)
+	logs := &captureHandler{}
+	transport.SetLogger(slog.New(logs))
+	metrics := &counterSink{}
+	transport.SetMetricsSink(metrics)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+
+	line := func(n int) string { return strings.Repeat("x", n) }
+	tests := []struct {
+		size     int
+		wantWarn bool
+		wantErr  bool
+	}{
+		{10, false, false},
+		{11, true, false},
+		{20, true, false},
+		{21, true, true},
+	}
+	var want []string
+	for _, tt := range tests {
+		before := len(logs.text())
+		err := transport.Write(ctx, line(tt.size))
+
+		var tooLarge *types.OutboundTooLargeError
+		if tt.wantErr {
+			if !errors.As(err, &tooLarge) || tooLarge.Size != tt.size || tooLarge.Max != 20 {
+				t.Errorf("Write(%d bytes) error = %v, want an OutboundTooLargeError of %d bytes over 20", tt.size, err, tt.size)
+			}
+		} else {
+			if err != nil {
+				t.Errorf("Write(%d bytes) unexpected error: %v", tt.size, err)
+			}
+			want = append(want, line(tt.size))
+		}
+
+		var warned bool
+		for _, text := range logs.text()[before:] {
+			warned = warned || strings.HasPrefix(text, "WARN ")
+		}
+		if warned != (tt.wantWarn || tt.wantErr) {
+			t.Errorf("Write(%d bytes) warned = %v, want %v", tt.size, warned, tt.wantWarn || tt.wantErr)
+		}
+	}
+
+	// A rejected line fails the batch it is in, and the transport stays usable
+	if err := transport.WriteBatch(ctx, []string{line(5), line(21)}); !types.IsOutboundTooLargeError(err) {
+		t.Errorf("WriteBatch() error = %v, want an OutboundTooLargeError", err)
+	}
+	if err := transport.Write(ctx, line(1)); err != nil {
+		t.Errorf("Write() after a rejected line: %v", err)
+	}
+	want = append(want, line(1))
+
+	if err := transport.Close(ctx); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("CLI received %q, want %q", got, want)
+	}
+
+	if got := metrics.counter(types.MetricOversizedWrites, "warn"); got != 2 {
+		t.Errorf("warn counter = %v, want 2", got)
+	}
+	if got := metrics.counter(types.MetricOversizedWrites, "max"); got != 2 {
+		t.Errorf("max counter = %v, want 2", got)
+	}
+}
+
+// TestSubprocessCLITransportOutboundLimitsDisabled tests that non-positive
+// limits let lines of any size through.
+func TestSubprocessCLITransportOutboundLimitsDisabled(t *testing.T) {
+	catPath, err := FindMockCLI()
+	if err != nil || !strings.HasSuffix(catPath, "cat") {
+		t.Skip("No cat command available for testing")
+	}
+
+	// Discard stdin regardless of CLI flags
+	script := filepath.Join(t.TempDir(), "mock-cli")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexec "+catPath+" > /dev/null\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := NewSubprocessCLITransport(script, "", nil)
+	transport.SetOutboundLimits(0, -1)
+	logs := &captureHandler{}
+	transport.SetLogger(slog.New(logs))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := transport.Connect(ctx); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+	defer func() {
+		_ = transport.Close(ctx)
+	}()
+
+	if err := transport.Write(ctx, strings.Repeat("x", types.DefaultMaxOutboundSize+1)); err != nil {
+		t.Errorf("Write() unexpected error: %v", err)
+	}
+	for _, text := range logs.text() {
+		if strings.HasPrefix(text, "WARN ") {
+			t.Errorf("logged %q, want no warning", text)
+		}
+	}
+}
+
 // TestSubprocessCLITransportClose tests subprocess cleanup
 func TestSubprocessCLITransportClose(t *testing.T) {
 	echoPath, err := FindMockCLI()
@@ -367,6 +1267,93 @@ func TestSubprocessCLITransportClose(t *testing.T) {
 	}
 }
 
+// TestSubprocessCLITransportCloseCancelledContext tests that Close with an
+// already-cancelled context lets the CLI finish instead of killing it
+func TestSubprocessCLITransportCloseCancelledContext(t *testing.T) {
+	// The CLI keeps working for a moment after its input closes, then exits cleanly
+	script := filepath.Join(t.TempDir(), "mock-cli")
+	body := "#!/bin/sh\ncat >/dev/null\nsleep 0.2\necho '{\"type\":\"system\",\"subtype\":\"done\",\"data\":{}}'\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transport := NewSubprocessCLITransport(script, "", nil)
+	if err := transport.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := transport.Close(ctx); err != nil {
+		t.Fatalf("Close() with a cancelled context = %v, want a graceful exit", err)
+	}
+	if state := transport.ProcessState(); state.Status != types.ProcessExited || state.ExitCode != 0 {
+		t.Errorf("ProcessState() = %+v, want exited with code 0", state)
+	}
+	if err := transport.GetError(); err != nil {
+		t.Errorf("GetError() = %v, want nil", err)
+	}
+}
+
+// TestSubprocessCLITransportCloseTimeout tests that a CLI that does not exit
+// is killed after the close timeout, or sooner if a live context expires
+func TestSubprocessCLITransportCloseTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		closeTimeout time.Duration
+		ctx          func() (context.Context, context.CancelFunc)
+	}{
+		{
+			name:         "cancelled context",
+			closeTimeout: 200 * time.Millisecond,
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+		},
+		{
+			name:         "live context shortens the wait",
+			closeTimeout: time.Minute,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 200*time.Millisecond)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := filepath.Join(t.TempDir(), "mock-cli")
+			if err := os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 30\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			transport := NewSubprocessCLITransport(script, "", nil)
+			transport.SetCloseTimeout(tt.closeTimeout)
+			if err := transport.Connect(context.Background()); err != nil {
+				t.Fatalf("Connect() unexpected error: %v", err)
+			}
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			err := transport.Close(ctx)
+			elapsed := time.Since(start)
+
+			var procErr *types.ProcessError
+			if !errors.As(err, &procErr) {
+				t.Errorf("Close() = %v, want a ProcessError for the killed CLI", err)
+			}
+			if elapsed < 150*time.Millisecond || elapsed > 5*time.Second {
+				t.Errorf("Close() took %s, want about 200ms", elapsed)
+			}
+			if state := transport.ProcessState(); state.Status != types.ProcessExited {
+				t.Errorf("ProcessState() = %+v, want exited", state)
+			}
+		})
+	}
+}
+
 // TestMessageReaderLoop tests message reading and parsing
 func TestMessageReaderLoop(t *testing.T) {
 	// Create a mock JSON stream
@@ -387,8 +1374,9 @@ func TestMessageReaderLoop(t *testing.T) {
 
 	// Create transport with custom stdout
 	transport := &SubprocessCLITransport{
-		messages: make(chan types.Message, 10),
-		ready:    true,
+		messages:   make(chan types.Message, 10),
+		readerDone: make(chan struct{}),
+		ready:      true,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -511,6 +1499,40 @@ func BenchmarkJSONLineWriter(b *testing.B) {
 	}
 }
 
+// BenchmarkJSONLineWriterSyscalls compares underlying writes for 100 small
+// control-response-sized lines with and without batching
+func BenchmarkJSONLineWriterSyscalls(b *testing.B) {
+	line := `{"type":"control_response","response":{"subtype":"success","request_id":"req_1","response":{}}}`
+
+	run := func(b *testing.B, newWriter func(io.Writer) *JSONLineWriter) {
+		totalWrites := 0
+		for i := 0; i < b.N; i++ {
+			var out countingWriter
+			writer := newWriter(&out)
+			for j := 0; j < 100; j++ {
+				if err := writer.WriteLine(line); err != nil {
+					b.Fatalf("WriteLine() error: %v", err)
+				}
+			}
+			if err := writer.Flush(); err != nil {
+				b.Fatalf("Flush() error: %v", err)
+			}
+			_, writes := out.snapshot()
+			totalWrites += writes
+		}
+		b.ReportMetric(float64(totalWrites)/float64(b.N), "writes/op")
+	}
+
+	b.Run("unbatched", func(b *testing.B) {
+		run(b, NewJSONLineWriter)
+	})
+	b.Run("batched", func(b *testing.B) {
+		run(b, func(w io.Writer) *JSONLineWriter {
+			return NewBatchedJSONLineWriter(w, time.Millisecond, DefaultWriteBatchMaxBytes)
+		})
+	})
+}
+
 // TestIntegrationSubprocessCLI tests end-to-end subprocess communication
 // This test requires the actual Claude CLI to be installed
 func TestIntegrationSubprocessCLI(t *testing.T) {
@@ -572,3 +1594,25 @@ func TestIntegrationSubprocessCLI(t *testing.T) {
 		t.Logf("Timeout waiting for response (may be expected for this test)")
 	}
 }
+
+// TestProbeCLIVersion tests running the CLI with --version
+func TestProbeCLIVersion(t *testing.T) {
+	useTempVersionCache(t)
+	script := filepath.Join(t.TempDir(), "claude")
+	body := "#!/bin/sh\n[ \"$1\" = \"--version\" ] || exit 2\necho '1.0.100 (Claude Code)'\necho 'extra line'\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := NewSubprocessCLITransport(script, "", nil).CLIVersion(context.Background())
+	if err != nil {
+		t.Fatalf("CLIVersion() unexpected error: %v", err)
+	}
+	if version != "1.0.100 (Claude Code)" {
+		t.Errorf("CLIVersion() = %q, want first output line", version)
+	}
+
+	if _, err := ProbeCLIVersion(context.Background(), filepath.Join(t.TempDir(), "missing")); !types.IsProcessError(err) {
+		t.Errorf("expected ProcessError for missing binary, got %v", err)
+	}
+}
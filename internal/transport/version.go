@@ -0,0 +1,39 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// versionProbeTimeout bounds how long "claude --version" may run.
+var versionProbeTimeout = 10 * time.Second
+
+// ProbeCLIVersion runs the CLI with --version and returns the first line of
+// its output, trimmed. The output is not validated; see types.ParseCLIVersion.
+func ProbeCLIVersion(ctx context.Context, cliPath string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, versionProbeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, cliPath, "--version")
+	cmd.WaitDelay = time.Second // Don't hang on children holding stdout open
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", types.NewProcessErrorWithCause("failed to run claude --version", err)
+	}
+
+	line, _, _ := bufio.NewReader(bytes.NewReader(out)).ReadLine()
+	return strings.TrimSpace(string(line)), nil
+}
+
+// CLIVersion reports the version of the transport's CLI binary, probing it
+// unless CachedCLIVersion has a result for the same binary.
+func (t *SubprocessCLITransport) CLIVersion(ctx context.Context) (string, error) {
+	return CachedCLIVersion(ctx, t.cliPath)
+}
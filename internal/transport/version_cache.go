@@ -0,0 +1,217 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// NoVersionCacheEnv disables the on-disk CLI version cache when set to a non-empty value.
+const NoVersionCacheEnv = "CLAUDE_AGENT_SDK_NO_VERSION_CACHE"
+
+// VersionCacheDirEnv, when set, names the directory of the CLI version cache
+// in place of the one under os.UserCacheDir(). Test binaries set it so that
+// the scripted CLIs they start stay out of the user's cache.
+const VersionCacheDirEnv = "CLAUDE_AGENT_SDK_VERSION_CACHE_DIR"
+
+// versionCacheFileName is the cache file inside the cache directory.
+const versionCacheFileName = "cli-version.json"
+
+// maxVersionCacheEntries bounds the cache; the least recently probed entries are dropped.
+const maxVersionCacheEntries = 32
+
+// maxVersionCacheAge is how long an entry is kept after its probe. Entries
+// of binaries that are never run again, such as temporary ones, expire.
+const maxVersionCacheAge = 30 * 24 * time.Hour
+
+// Lock file handling for processes updating the cache at the same time
+var (
+	versionCacheLockWait  = 2 * time.Second
+	versionCacheLockStale = 10 * time.Second
+)
+
+// versionCacheDir returns the directory holding the version cache. Tests
+// point it at a temporary directory.
+var versionCacheDir = func() (string, error) {
+	if dir := os.Getenv(VersionCacheDirEnv); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "claude-agent-sdk-go"), nil
+}
+
+// versionCacheEntry is the cached probe result for one CLI binary. The entry
+// is valid while the binary's modification time and size are unchanged.
+type versionCacheEntry struct {
+	Version  string    `json:"version"`
+	ModTime  time.Time `json:"mtime"`
+	Size     int64     `json:"size"`
+	ProbedAt time.Time `json:"probed_at"`
+}
+
+// versionCache is the cache file's contents, keyed by the binary's resolved path.
+type versionCache struct {
+	Entries map[string]versionCacheEntry `json:"entries"`
+}
+
+// CachedCLIVersion is like ProbeCLIVersion but reuses the result of an
+// earlier probe of the same binary, even one made by another process. Results
+// are kept in a JSON file under os.UserCacheDir(), or in the directory named
+// by CLAUDE_AGENT_SDK_VERSION_CACHE_DIR, and are invalidated when the
+// binary's modification time or size changes, so an upgraded CLI is probed
+// again. Setting CLAUDE_AGENT_SDK_NO_VERSION_CACHE disables the cache.
+//
+// The cache is best effort: if it cannot be read or written, the CLI is
+// probed as if there were no cache. Discovery with FindCLI is not cached; it
+// costs a few stat calls and has to follow changes to PATH.
+func CachedCLIVersion(ctx context.Context, cliPath string) (string, error) {
+	if os.Getenv(NoVersionCacheEnv) != "" {
+		return ProbeCLIVersion(ctx, cliPath)
+	}
+
+	key, info, err := versionCacheKey(cliPath)
+	if err != nil {
+		return ProbeCLIVersion(ctx, cliPath)
+	}
+	dir, err := versionCacheDir()
+	if err != nil {
+		return ProbeCLIVersion(ctx, cliPath)
+	}
+
+	if entry, ok := readVersionCache(dir).Entries[key]; ok && entry.matches(info) {
+		return entry.Version, nil
+	}
+
+	version, err := ProbeCLIVersion(ctx, cliPath)
+	if err != nil {
+		return "", err
+	}
+	_ = storeVersion(dir, key, versionCacheEntry{
+		Version:  version,
+		ModTime:  info.ModTime(),
+		Size:     info.Size(),
+		ProbedAt: time.Now(),
+	})
+	return version, nil
+}
+
+// versionCacheKey resolves cliPath to the binary it runs, following symlinks
+// as package managers install the CLI behind one, and stats it.
+func versionCacheKey(cliPath string) (string, os.FileInfo, error) {
+	path, err := filepath.Abs(cliPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, info, nil
+}
+
+// matches reports whether the entry was probed from a binary with info's
+// modification time and size.
+func (e versionCacheEntry) matches(info os.FileInfo) bool {
+	return e.Version != "" && e.ModTime.Equal(info.ModTime()) && e.Size == info.Size()
+}
+
+// readVersionCache loads the cache file, returning an empty cache if it is
+// missing or unreadable.
+func readVersionCache(dir string) versionCache {
+	cache := versionCache{Entries: make(map[string]versionCacheEntry)}
+	data, err := os.ReadFile(filepath.Join(dir, versionCacheFileName))
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Entries == nil {
+		cache.Entries = make(map[string]versionCacheEntry)
+	}
+	return cache
+}
+
+// storeVersion adds entry to the cache file under the lock, dropping entries
+// for binaries that no longer exist, entries older than maxVersionCacheAge,
+// and the oldest entries beyond the limit.
+// The file is replaced atomically so readers, which do not lock, never see a
+// partial write.
+func storeVersion(dir, key string, entry versionCacheEntry) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	unlock, err := lockVersionCache(dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cache := readVersionCache(dir)
+	cache.Entries[key] = entry
+	for path, e := range cache.Entries {
+		if _, err := os.Stat(path); err != nil || time.Since(e.ProbedAt) > maxVersionCacheAge {
+			delete(cache.Entries, path)
+		}
+	}
+	for len(cache.Entries) > maxVersionCacheEntries {
+		oldest := ""
+		for path, e := range cache.Entries {
+			if oldest == "" || e.ProbedAt.Before(cache.Entries[oldest].ProbedAt) {
+				oldest = path
+			}
+		}
+		delete(cache.Entries, oldest)
+	}
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, versionCacheFileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, versionCacheFileName))
+}
+
+// lockVersionCache takes the cache's lock file, waiting up to
+// versionCacheLockWait for another process to release it. A lock older than
+// versionCacheLockStale is assumed to belong to a process that died and is
+// removed.
+func lockVersionCache(dir string) (func(), error) {
+	path := filepath.Join(dir, versionCacheFileName+".lock")
+	deadline := time.Now().Add(versionCacheLockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > versionCacheLockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,286 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useTempVersionCache points the version cache at a fresh temporary directory
+// for the duration of the test.
+func useTempVersionCache(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	orig := versionCacheDir
+	versionCacheDir = func() (string, error) { return dir, nil }
+	t.Cleanup(func() { versionCacheDir = orig })
+	return dir
+}
+
+// writeCountingCLI writes a CLI that prints version for --version and
+// appends a line to a counter file each time it runs. It returns the CLI path
+// and a function reporting how many times it has run.
+func writeCountingCLI(t *testing.T, dir, version string) (string, func() int) {
+	t.Helper()
+	path := filepath.Join(dir, "claude")
+	counter := filepath.Join(dir, "runs")
+	body := "#!/bin/sh\necho run >> " + counter + "\necho '" + version + "'\n"
+	if err := os.WriteFile(path, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() int {
+		data, _ := os.ReadFile(counter)
+		return strings.Count(string(data), "run")
+	}
+}
+
+func TestCachedCLIVersion(t *testing.T) {
+	cacheDir := useTempVersionCache(t)
+	cliPath, runs := writeCountingCLI(t, t.TempDir(), "2.0.1 (Claude Code)")
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		version, err := CachedCLIVersion(ctx, cliPath)
+		if err != nil {
+			t.Fatalf("CachedCLIVersion() unexpected error: %v", err)
+		}
+		if version != "2.0.1 (Claude Code)" {
+			t.Errorf("CachedCLIVersion() = %q, want 2.0.1 (Claude Code)", version)
+		}
+	}
+	if n := runs(); n != 1 {
+		t.Errorf("CLI ran %d times, want 1", n)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, versionCacheFileName)); err != nil {
+		t.Errorf("cache file not written: %v", err)
+	}
+
+	// A symlink to the same binary shares its entry
+	link := filepath.Join(t.TempDir(), "claude-link")
+	if err := os.Symlink(cliPath, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CachedCLIVersion(ctx, link); err != nil {
+		t.Fatalf("CachedCLIVersion() via symlink unexpected error: %v", err)
+	}
+	if n := runs(); n != 1 {
+		t.Errorf("CLI ran %d times after probing via a symlink, want 1", n)
+	}
+}
+
+func TestCachedCLIVersion_BinaryReplaced(t *testing.T) {
+	useTempVersionCache(t)
+	dir := t.TempDir()
+	cliPath, runs := writeCountingCLI(t, dir, "2.0.1 (Claude Code)")
+	ctx := context.Background()
+
+	if _, err := CachedCLIVersion(ctx, cliPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// An upgrade changes the size
+	writeCountingCLI(t, dir, "2.0.10 (Claude Code)")
+	if version, _ := CachedCLIVersion(ctx, cliPath); version != "2.0.10 (Claude Code)" {
+		t.Errorf("after upgrade CachedCLIVersion() = %q, want 2.0.10 (Claude Code)", version)
+	}
+
+	// A same-size replacement changes the modification time
+	writeCountingCLI(t, dir, "2.0.11 (Claude Code)")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(cliPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if version, _ := CachedCLIVersion(ctx, cliPath); version != "2.0.11 (Claude Code)" {
+		t.Errorf("after same-size replacement CachedCLIVersion() = %q, want 2.0.11 (Claude Code)", version)
+	}
+
+	if n := runs(); n != 3 {
+		t.Errorf("CLI ran %d times, want 3", n)
+	}
+}
+
+func TestCachedCLIVersion_Disabled(t *testing.T) {
+	cacheDir := useTempVersionCache(t)
+	t.Setenv(NoVersionCacheEnv, "1")
+	cliPath, runs := writeCountingCLI(t, t.TempDir(), "2.0.1 (Claude Code)")
+
+	for i := 0; i < 2; i++ {
+		if _, err := CachedCLIVersion(context.Background(), cliPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := runs(); n != 2 {
+		t.Errorf("CLI ran %d times with the cache disabled, want 2", n)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, versionCacheFileName)); !os.IsNotExist(err) {
+		t.Errorf("cache file written with the cache disabled: %v", err)
+	}
+}
+
+func TestCachedCLIVersion_CorruptCache(t *testing.T) {
+	cacheDir := useTempVersionCache(t)
+	cachePath := filepath.Join(cacheDir, versionCacheFileName)
+	if err := os.WriteFile(cachePath, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cliPath, runs := writeCountingCLI(t, t.TempDir(), "2.0.1 (Claude Code)")
+
+	for i := 0; i < 2; i++ {
+		if version, err := CachedCLIVersion(context.Background(), cliPath); err != nil || version != "2.0.1 (Claude Code)" {
+			t.Fatalf("CachedCLIVersion() = %q, %v", version, err)
+		}
+	}
+	if n := runs(); n != 1 {
+		t.Errorf("CLI ran %d times, want 1 after the corrupt cache was replaced", n)
+	}
+}
+
+func TestCachedCLIVersion_PrunesMissingBinaries(t *testing.T) {
+	cacheDir := useTempVersionCache(t)
+	ctx := context.Background()
+
+	goneDir := t.TempDir()
+	gone, _ := writeCountingCLI(t, goneDir, "1.0.0 (Claude Code)")
+	if _, err := CachedCLIVersion(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+	goneKey, _, _ := versionCacheKey(gone)
+	if err := os.Remove(gone); err != nil {
+		t.Fatal(err)
+	}
+
+	kept, _ := writeCountingCLI(t, t.TempDir(), "2.0.0 (Claude Code)")
+	if _, err := CachedCLIVersion(ctx, kept); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readVersionCache(cacheDir).Entries
+	if _, ok := entries[goneKey]; ok {
+		t.Error("entry for a deleted binary was not pruned")
+	}
+	if len(entries) != 1 {
+		t.Errorf("cache has %d entries, want 1", len(entries))
+	}
+}
+
+func TestCachedCLIVersion_PrunesOldEntries(t *testing.T) {
+	cacheDir := useTempVersionCache(t)
+	ctx := context.Background()
+
+	old, _ := writeCountingCLI(t, t.TempDir(), "1.0.0 (Claude Code)")
+	oldKey, info, _ := versionCacheKey(old)
+	if err := storeVersion(cacheDir, oldKey, versionCacheEntry{
+		Version:  "1.0.0",
+		ModTime:  info.ModTime(),
+		Size:     info.Size(),
+		ProbedAt: time.Now().Add(-maxVersionCacheAge - time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	kept, _ := writeCountingCLI(t, t.TempDir(), "2.0.0 (Claude Code)")
+	if _, err := CachedCLIVersion(ctx, kept); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readVersionCache(cacheDir).Entries
+	if _, ok := entries[oldKey]; ok {
+		t.Error("entry probed too long ago was not pruned")
+	}
+	if len(entries) != 1 {
+		t.Errorf("cache has %d entries, want 1", len(entries))
+	}
+}
+
+func TestVersionCacheDir_Env(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(VersionCacheDirEnv, dir)
+	if got, err := versionCacheDir(); err != nil || got != dir {
+		t.Errorf("versionCacheDir() = %q, %v; want %q", got, err, dir)
+	}
+}
+
+// TestVersionCacheDir_MockCLIMain tests that mockcli.Main, the TestMain of
+// this package, moved the version cache out of the user's cache directory.
+func TestVersionCacheDir_MockCLIMain(t *testing.T) {
+	dir, err := versionCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userCache, err := os.UserCacheDir(); err == nil && strings.HasPrefix(dir, userCache) {
+		t.Errorf("versionCacheDir() = %q, want a directory outside the user cache %q", dir, userCache)
+	}
+}
+
+func TestCachedCLIVersion_StaleLock(t *testing.T) {
+	cacheDir := useTempVersionCache(t)
+	lock := filepath.Join(cacheDir, versionCacheFileName+".lock")
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	cliPath, _ := writeCountingCLI(t, t.TempDir(), "2.0.1 (Claude Code)")
+	if _, err := CachedCLIVersion(context.Background(), cliPath); err != nil {
+		t.Fatal(err)
+	}
+	key, _, _ := versionCacheKey(cliPath)
+	if _, ok := readVersionCache(cacheDir).Entries[key]; !ok {
+		t.Error("entry not stored after taking over a stale lock")
+	}
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+// TestCachedCLIVersion_Concurrent tests that concurrent writers, as separate
+// processes would, do not lose each other's entries
+func TestCachedCLIVersion_Concurrent(t *testing.T) {
+	cacheDir := useTempVersionCache(t)
+	const clis = 12
+
+	paths := make([]string, clis)
+	for i := range paths {
+		paths[i], _ = writeCountingCLI(t, t.TempDir(), fmt.Sprintf("2.0.%d (Claude Code)", i))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, clis*2)
+	for round := 0; round < 2; round++ {
+		for i, path := range paths {
+			wg.Add(1)
+			go func(i int, path string) {
+				defer wg.Done()
+				version, err := CachedCLIVersion(context.Background(), path)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if want := fmt.Sprintf("2.0.%d (Claude Code)", i); version != want {
+					errs <- fmt.Errorf("CachedCLIVersion(%s) = %q, want %q", path, version, want)
+				}
+			}(i, path)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	entries := readVersionCache(cacheDir).Entries
+	if len(entries) != clis {
+		t.Errorf("cache has %d entries, want %d", len(entries), clis)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(cacheDir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
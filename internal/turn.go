@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// turnCallbacks are the permission callback and hooks of the current turn,
+// set with SetTurnCallbacks.
+type turnCallbacks struct {
+	canUseTool types.CanUseToolFunc
+	hooks      map[types.HookEvent][]types.HookMatcher
+}
+
+// withTurnHooks returns hooks with a matcher added for each event that runs
+// the current turn's hooks for that event.
+func (q *Query) withTurnHooks(hooks map[types.HookEvent][]types.HookMatcher, events []types.HookEvent) map[types.HookEvent][]types.HookMatcher {
+	if len(events) == 0 {
+		return hooks
+	}
+
+	out := make(map[types.HookEvent][]types.HookMatcher, len(hooks)+len(events))
+	for event, matchers := range hooks {
+		out[event] = matchers
+	}
+	q.turnHookEvents = make(map[types.HookEvent]bool, len(events))
+	for _, event := range events {
+		if q.turnHookEvents[event] {
+			continue
+		}
+		q.turnHookEvents[event] = true
+		out[event] = append(append([]types.HookMatcher(nil), out[event]...), types.HookMatcher{
+			Hooks: []types.HookCallbackFunc{q.turnHook(event)},
+		})
+	}
+	return out
+}
+
+// SetTurnCallbacks sets the permission callback and hooks used until it is
+// called again; a nil canUseTool keeps the session's callback. Hooks are
+// only accepted for events enabled with WithTurnHookEvents.
+func (q *Query) SetTurnCallbacks(canUseTool types.CanUseToolFunc, hooks map[types.HookEvent][]types.HookMatcher) error {
+	for event, matchers := range hooks {
+		if len(matchers) > 0 && !q.turnHookEvents[event] {
+			return fmt.Errorf("per-turn %s hooks need WithTurnHookEvents(%q) when the client connects", event, event)
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.turn = turnCallbacks{canUseTool: canUseTool, hooks: hooks}
+	return nil
+}
+
+// permissionCallback returns the current turn's permission callback, or the
+// session's if the turn has none.
+func (q *Query) permissionCallback() types.CanUseToolFunc {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.turn.canUseTool != nil {
+		return q.turn.canUseTool
+	}
+	return q.canUseTool
+}
+
+// turnHook returns the hook registered for event by withTurnHooks. It runs
+// the current turn's matching hooks in order and merges their outputs, later
+// fields replacing earlier ones, until one denies, blocks, or stops the turn.
+func (q *Query) turnHook(event types.HookEvent) types.HookCallbackFunc {
+	return func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		q.mu.Lock()
+		matchers := q.turn.hooks[event]
+		q.mu.Unlock()
+
+		fields, _ := input.(map[string]interface{})
+		toolName, _ := fields["tool_name"].(string)
+
+		merged := map[string]interface{}{}
+		for _, matcher := range matchers {
+			if !matchesTool(matcher.Matcher, toolName) {
+				continue
+			}
+			for _, hook := range matcher.Hooks {
+				output, err := hook(ctx, input, toolUseID, hookCtx)
+				if err != nil {
+					return nil, err
+				}
+				response, ok := output.(map[string]interface{})
+				if !ok {
+					return nil, types.NewControlProtocolError("hook callback must return map[string]interface{}")
+				}
+				for k, v := range response {
+					merged[k] = v
+				}
+				if stopsTurnHooks(response) {
+					return merged, nil
+				}
+			}
+		}
+		return merged, nil
+	}
+}
+
+// matchesTool reports whether a hook matcher applies to toolName. Like the
+// CLI, it treats the matcher as a regular expression over the whole name,
+// falling back to an exact match when it is not one; nil, "" and "*" match
+// everything, including events without a tool.
+func matchesTool(matcher *string, toolName string) bool {
+	if matcher == nil || *matcher == "" || *matcher == "*" {
+		return true
+	}
+	re, err := regexp.Compile("^(?:" + *matcher + ")$")
+	if err != nil {
+		return *matcher == toolName
+	}
+	return re.MatchString(toolName)
+}
+
+// stopsTurnHooks reports whether a hook response denies the tool use,
+// blocks, or stops the turn, so that later hooks cannot override it.
+func stopsTurnHooks(response map[string]interface{}) bool {
+	if response["decision"] == "block" || response["continue"] == false {
+		return true
+	}
+	output := hookSpecificOutput(response)
+	return output != nil && output["permissionDecision"] == string(types.PermissionBehaviorDeny)
+}
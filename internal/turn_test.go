@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestMatchesTool(t *testing.T) {
+	tests := []struct {
+		matcher  *string
+		toolName string
+		want     bool
+	}{
+		{nil, "Bash", true},
+		{strPtr(""), "", true},
+		{strPtr("*"), "Read", true},
+		{strPtr("Bash"), "Bash", true},
+		{strPtr("Bash"), "BashOutput", false},
+		{strPtr("Edit|Write"), "Write", true},
+		{strPtr("mcp__.*"), "mcp__fs__read", true},
+		{strPtr("Edit|Write"), "Read", false},
+		{strPtr("("), "(", true},
+	}
+	for _, tt := range tests {
+		if got := matchesTool(tt.matcher, tt.toolName); got != tt.want {
+			t.Errorf("matchesTool(%v, %q) = %v, want %v", tt.matcher, tt.toolName, got, tt.want)
+		}
+	}
+}
+
+func TestQuery_TurnHooks(t *testing.T) {
+	q := newTestQuery(context.Background(), nil, types.NewClaudeAgentOptions().WithTurnHookEvents(types.HookEventPreToolUse, types.HookEventPreToolUse), true)
+	defer q.cancel()
+
+	if n := len(q.hooks[types.HookEventPreToolUse]); n != 1 {
+		t.Fatalf("expected one dispatching matcher, got %d", n)
+	}
+	dispatch := q.hooks[types.HookEventPreToolUse][0].Hooks[0]
+	input := map[string]interface{}{"tool_name": "Bash"}
+
+	// Between turns the dispatcher has no opinion
+	out, err := dispatch(context.Background(), input, nil, types.HookContext{})
+	if err != nil || !reflect.DeepEqual(out, map[string]interface{}{}) {
+		t.Fatalf("dispatch without a turn = %v, %v", out, err)
+	}
+
+	returning := func(response map[string]interface{}) types.HookCallbackFunc {
+		return func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+			return response, nil
+		}
+	}
+	deny := map[string]interface{}{"hookSpecificOutput": map[string]interface{}{
+		"hookEventName":      "PreToolUse",
+		"permissionDecision": "deny",
+	}}
+	err = q.SetTurnCallbacks(nil, map[types.HookEvent][]types.HookMatcher{
+		types.HookEventPreToolUse: {
+			{Hooks: []types.HookCallbackFunc{returning(map[string]interface{}{"systemMessage": "first", "suppressOutput": true})}},
+			{Matcher: strPtr("Read"), Hooks: []types.HookCallbackFunc{returning(map[string]interface{}{"systemMessage": "read only"})}},
+			{Matcher: strPtr("Bash"), Hooks: []types.HookCallbackFunc{returning(deny), returning(map[string]interface{}{"systemMessage": "after deny"})}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetTurnCallbacks failed: %v", err)
+	}
+
+	out, err = dispatch(context.Background(), input, nil, types.HookContext{})
+	if err != nil {
+		t.Fatalf("dispatch failed: %v", err)
+	}
+	want := map[string]interface{}{"systemMessage": "first", "suppressOutput": true, "hookSpecificOutput": deny["hookSpecificOutput"]}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("merged output = %v, want %v", out, want)
+	}
+
+	if err := q.SetTurnCallbacks(nil, map[types.HookEvent][]types.HookMatcher{
+		types.HookEventStop: {{Hooks: []types.HookCallbackFunc{returning(nil)}}},
+	}); err == nil {
+		t.Error("expected an error for hooks on an event not enabled")
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,178 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+)
+
+// goroutineLabel is the pprof label carried by goroutines a Client starts,
+// set to the client's ID. It also shows up in goroutine profiles, so SDK
+// goroutines can be told apart from the application's.
+const goroutineLabel = "claude_client"
+
+// clients is the registry of Clients created and not yet closed.
+var clients = struct {
+	mu     sync.Mutex
+	nextID uint64
+	byID   map[uint64]*Client
+}{byID: make(map[uint64]*Client)}
+
+// registerClient assigns c an ID and records it as active.
+func registerClient(c *Client) {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	clients.nextID++
+	c.id = clients.nextID
+	c.labels = pprof.Labels(goroutineLabel, strconv.FormatUint(c.id, 10))
+	clients.byID[c.id] = c
+}
+
+// untrackClient removes c from the registry.
+func untrackClient(c *Client) {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+	delete(clients.byID, c.id)
+}
+
+// activeClients returns the registered clients ordered by ID.
+func activeClients() []*Client {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	list := make([]*Client, 0, len(clients.byID))
+	for _, c := range clients.byID {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// goLabeled runs f in a new goroutine carrying the client's pprof labels.
+func (c *Client) goLabeled(f func()) {
+	pprof.Do(context.Background(), c.labels, func(context.Context) {
+		go f()
+	})
+}
+
+// ActiveClients returns the number of Clients that have been created and not
+// yet closed. A Client counts from NewClient until Close, whether or not it
+// ever connected, so a steadily growing count means Close is being skipped.
+func ActiveClients() int {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+	return len(clients.byID)
+}
+
+// ActiveSubprocesses returns the PIDs of CLI subprocesses started by the SDK
+// (by Clients and one-shot queries alike) that have not yet exited, in
+// ascending order.
+func ActiveSubprocesses() []int {
+	return transport.ActivePIDs()
+}
+
+// SubprocessUsage returns how many subprocess slots are in use and the limit
+// set with SetMaxSubprocesses (0 when unlimited). A slot is in use from the
+// moment Connect starts a CLI until that process has exited and been reaped.
+func SubprocessUsage() (inUse, limit int) {
+	return transport.ProcessUsage()
+}
+
+// DebugDump writes a human-readable report of the SDK's live resources to w:
+// each active Client's connection state, subprocess, pending control
+// requests, message queue depth, and goroutines, followed by all active CLI
+// subprocesses and the slot usage against SetMaxSubprocesses. The format is
+// meant for people and may change.
+//
+// Goroutines are attributed through the "claude_client" pprof label, which
+// goroutines started by a Client carry.
+func DebugDump(w io.Writer) error {
+	list := activeClients()
+	goroutines := labeledGoroutines()
+	pids := ActiveSubprocesses()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "claude: %d active clients, %d active subprocesses\n", len(list), len(pids))
+	for _, c := range list {
+		c.dumpState(bw, goroutines[strconv.FormatUint(c.id, 10)])
+	}
+	inUse, limit := SubprocessUsage()
+	fmt.Fprintf(bw, "subprocesses: %v (slots in use %d, limit %d)\n", pids, inUse, limit)
+	return bw.Flush()
+}
+
+// dumpState writes one line describing c.
+func (c *Client) dumpState(w io.Writer, goroutines int) {
+	c.mu.Lock()
+	connected := c.connected
+	version := c.cliVersion
+	query := c.query
+	c.mu.Unlock()
+
+	pid, _ := c.PID()
+
+	fmt.Fprintf(w, "client %d: connected=%t cli_version=%q pid=%d goroutines=%d",
+		c.id, connected, version, pid, goroutines)
+	if query != nil {
+		stats := query.Stats()
+		fmt.Fprintf(w, " pending_control_requests=%d queued_messages=%d/%d pending_hook_decisions=%d",
+			stats.PendingControlRequests, stats.QueuedMessages, stats.QueueCapacity, stats.PendingHookDecisions)
+		if stats.Paused || stats.HeldControlRequests > 0 {
+			fmt.Fprintf(w, " paused=%t held_control_requests=%d", stats.Paused, stats.HeldControlRequests)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// goroutineCount returns the number of live goroutines started by the
+// client, as attributed by the "claude_client" pprof label.
+func (c *Client) goroutineCount() int {
+	return labeledGoroutines()[strconv.FormatUint(c.id, 10)]
+}
+
+// labeledGoroutines counts live goroutines by their claude_client label,
+// parsed from the debug=1 goroutine profile.
+func labeledGoroutines() map[string]int {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	records := 0
+	scanner := bufio.NewScanner(&buf)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Each record starts with "<count> @ <pcs>" and may be followed by
+		// "# labels: {...}"
+		if n, _, ok := strings.Cut(line, " @ "); ok {
+			records, _ = strconv.Atoi(n)
+			continue
+		}
+		labels, ok := strings.CutPrefix(line, "# labels: ")
+		if !ok {
+			continue
+		}
+		var m map[string]string
+		if json.Unmarshal([]byte(labels), &m) != nil {
+			continue
+		}
+		if id, ok := m[goroutineLabel]; ok {
+			counts[id] += records
+		}
+	}
+	return counts
+}
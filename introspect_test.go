@@ -0,0 +1,179 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// waitFor polls cond until it holds or the deadline passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestActiveClients_CreateAndClose(t *testing.T) {
+	baseline := ActiveClients()
+
+	created := make([]*Client, 0, 100)
+	for i := 0; i < 100; i++ {
+		client, err := NewClientWithTransport(context.Background(), nil, &unusedTransport{})
+		if err != nil {
+			t.Fatalf("NewClientWithTransport failed: %v", err)
+		}
+		created = append(created, client)
+	}
+	if got := ActiveClients(); got != baseline+100 {
+		t.Fatalf("ActiveClients = %d after creating 100, want %d", got, baseline+100)
+	}
+
+	for _, client := range created {
+		if err := client.Close(context.Background()); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+	if got := ActiveClients(); got != baseline {
+		t.Errorf("ActiveClients = %d after closing, want %d", got, baseline)
+	}
+	for _, c := range activeClients() {
+		if slices.Contains(created, c) {
+			t.Errorf("closed client %d still registered", c.id)
+		}
+	}
+}
+
+func TestActiveClients_ConnectedCleanup(t *testing.T) {
+	cliPath := writeScriptedCLI(t)
+	baseline := ActiveClients()
+
+	for i := 0; i < 100; i++ {
+		client, err := NewClient(context.Background(), types.NewClaudeAgentOptions().WithCLIPath(cliPath))
+		if err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+		if err := client.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+
+		pid, _ := client.PID()
+		if !slices.Contains(ActiveSubprocesses(), pid) {
+			t.Fatalf("ActiveSubprocesses missing connected CLI pid %d", pid)
+		}
+
+		_ = client.Close(context.Background())
+		if slices.Contains(ActiveSubprocesses(), pid) {
+			t.Fatalf("pid %d still active after Close", pid)
+		}
+		waitFor(t, fmt.Sprintf("client %d goroutines to exit", client.id), func() bool {
+			return client.goroutineCount() == 0
+		})
+	}
+
+	if got := ActiveClients(); got != baseline {
+		t.Errorf("ActiveClients = %d after closing, want %d", got, baseline)
+	}
+}
+
+func TestClient_ProcessState(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx)
+	pid, ok := client.PID()
+	if !ok || pid <= 0 {
+		t.Fatalf("PID() = %d, %t while connected, want a PID and true", pid, ok)
+	}
+	if state := client.ProcessState(); !state.Running() || state.PID != pid {
+		t.Errorf("ProcessState() = %+v while connected, want running with PID %d", state, pid)
+	}
+
+	_ = client.Close(context.Background())
+	if _, ok := client.PID(); ok {
+		t.Error("PID() reported a running process after Close")
+	}
+	if state := client.ProcessState(); state.Status != types.ProcessExited || state.PID != pid {
+		t.Errorf("ProcessState() = %+v after Close, want exited with PID %d", state, pid)
+	}
+
+	// Transports without a subprocess report none
+	custom, err := NewClientWithTransport(ctx, nil, &unusedTransport{})
+	if err != nil {
+		t.Fatalf("NewClientWithTransport failed: %v", err)
+	}
+	defer custom.Close(ctx)
+	if pid, ok := custom.PID(); ok || pid != 0 {
+		t.Errorf("PID() = %d, %t for a custom transport, want 0, false", pid, ok)
+	}
+	if state := custom.ProcessState(); state.Status != types.ProcessNotStarted {
+		t.Errorf("ProcessState() = %+v for a custom transport, want not started", state)
+	}
+}
+
+func TestClient_GoroutinesLabeled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx)
+	if n := client.goroutineCount(); n == 0 {
+		t.Error("connected client has no labeled goroutines")
+	}
+
+	_ = client.Close(context.Background())
+	waitFor(t, "labeled goroutines to exit", func() bool {
+		return client.goroutineCount() == 0
+	})
+}
+
+func TestDebugDump(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx)
+	defer client.Close(context.Background())
+	idle, err := NewClientWithTransport(ctx, nil, &unusedTransport{})
+	if err != nil {
+		t.Fatalf("NewClientWithTransport failed: %v", err)
+	}
+	defer idle.Close(context.Background())
+
+	var buf bytes.Buffer
+	if err := DebugDump(&buf); err != nil {
+		t.Fatalf("DebugDump failed: %v", err)
+	}
+	out := buf.String()
+
+	pid, _ := client.PID()
+	for _, want := range []string{
+		"active clients",
+		fmt.Sprintf("client %d: connected=true cli_version=%q pid=%d goroutines=", client.id, "2.1.0", pid),
+		"pending_control_requests=0 queued_messages=0/100",
+		fmt.Sprintf("client %d: connected=false", idle.id),
+		fmt.Sprint(pid),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("DebugDump output missing %q:\n%s", want, out)
+		}
+	}
+
+	_ = client.Close(context.Background())
+	buf.Reset()
+	if err := DebugDump(&buf); err != nil {
+		t.Fatalf("DebugDump failed: %v", err)
+	}
+	if strings.Contains(buf.String(), fmt.Sprintf("client %d:", client.id)) {
+		t.Errorf("closed client still in dump:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,51 @@
+package claude
+
+import (
+	"context"
+	"sync"
+)
+
+// lockedTransport serializes the writes a Client and its control protocol
+// handler make, so lines from concurrent Query calls and control responses
+// never interleave even over a Transport that does not lock on its own.
+// Lines are recorded to the transcript, if any, in the order they are written.
+type lockedTransport struct {
+	Transport
+	mu         sync.Mutex
+	transcript *TranscriptWriter
+}
+
+func (t *lockedTransport) Write(ctx context.Context, data string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transcript.Record(TranscriptOutbound, []byte(data))
+	return t.Transport.Write(ctx, data)
+}
+
+func (t *lockedTransport) WriteBatch(ctx context.Context, lines []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range lines {
+		t.transcript.Record(TranscriptOutbound, []byte(line))
+	}
+	return t.Transport.WriteBatch(ctx, lines)
+}
+
+func (t *lockedTransport) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Transport.Flush(ctx)
+}
+
+func (t *lockedTransport) EndInput(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Transport.EndInput(ctx)
+}
+
+// setTranscript sets the transcript that written lines are recorded to.
+func (t *lockedTransport) setTranscript(transcript *TranscriptWriter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transcript = transcript
+}
@@ -0,0 +1,34 @@
+package claude
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// loggedDeprecations tracks which deprecation notices have been logged, so
+// each is logged once per process however many clients are created.
+var loggedDeprecations sync.Map
+
+// logDeprecations warns about deprecated option methods used so far.
+func logDeprecations(logger *slog.Logger) {
+	if logger == nil {
+		return
+	}
+	for _, notice := range types.Deprecations() {
+		if _, seen := loggedDeprecations.LoadOrStore(notice.Name, struct{}{}); seen {
+			continue
+		}
+		logger.Warn("claude: "+notice.Message, "deprecated", notice.Name, "replacement", notice.Replacement)
+	}
+}
+
+// logState logs a client state transition such as "connect started" or
+// "query sent". Traces recorded with claudetest.RecordingTransport.Logger
+// interleave these records with the protocol frames.
+func logState(options *types.ClaudeAgentOptions, msg string, args ...any) {
+	if options.Logger != nil {
+		options.Logger.Info("claude: "+msg, args...)
+	}
+}
@@ -0,0 +1,120 @@
+package claude
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// recordingHandler is a slog.Handler that keeps every record at or above level.
+type recordingHandler struct {
+	level   slog.Level
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+// find returns the records with the given message.
+func (h *recordingHandler) find(msg string) []slog.Record {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var out []slog.Record
+	for _, r := range h.records {
+		if r.Message == msg {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func recordAttr(r slog.Record, key string) string {
+	var value string
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == key {
+			value = a.Value.String()
+			return false
+		}
+		return true
+	})
+	return value
+}
+
+func TestClient_LoggerControlProtocol(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	handler := &recordingHandler{level: slog.LevelInfo}
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeScriptedCLI(t)).
+		WithLogger(slog.New(handler))
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	requests := handler.find("claude: control request to CLI")
+	responses := handler.find("claude: control response from CLI")
+	if len(requests) != 1 || len(responses) != 1 {
+		t.Fatalf("expected one request/response pair, got %d requests and %d responses", len(requests), len(responses))
+	}
+	if got := recordAttr(requests[0], "subtype"); got != "initialize" {
+		t.Errorf("request subtype = %q, want initialize", got)
+	}
+	if recordAttr(requests[0], "request_id") != recordAttr(responses[0], "request_id") {
+		t.Error("request and response have different request IDs")
+	}
+
+	// Traffic is logged at Debug, below this handler's level
+	if got := handler.find("claude: wrote line"); len(got) != 0 {
+		t.Errorf("Debug records reached an Info handler: %d", len(got))
+	}
+}
+
+func TestLogDeprecationsOnce(t *testing.T) {
+	handler := &recordingHandler{level: slog.LevelDebug}
+	logger := slog.New(handler)
+
+	opts := types.NewClaudeAgentOptions().WithMaxBufferSize(1 << 20)
+	for i := 0; i < 2; i++ {
+		if _, err := NewClient(context.Background(), opts.WithCLIPath(writeScriptedCLI(t)).WithLogger(logger)); err != nil {
+			t.Fatalf("NewClient failed: %v", err)
+		}
+	}
+
+	var warnings []string
+	for _, r := range handler.records {
+		if r.Level == slog.LevelWarn && recordAttr(r, "deprecated") == "WithMaxBufferSize" {
+			warnings = append(warnings, r.Message)
+		}
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected one deprecation warning, got %d", len(warnings))
+	}
+	if !strings.Contains(warnings[0], "WithMaxMessageSize") {
+		t.Errorf("warning does not name the replacement: %q", warnings[0])
+	}
+}
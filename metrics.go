@@ -0,0 +1,133 @@
+package claude
+
+import (
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// recordQuery reports a prompt sent to the CLI.
+func recordQuery(options *types.ClaudeAgentOptions) {
+	if sink := options.MetricsSink; sink != nil {
+		sink.IncCounter(types.MetricQueries, 1, nil)
+	}
+}
+
+// recordMessage reports a message delivered to the caller. A result message
+// also adds the cost it brought, measured by costs, and its token usage, and
+// ends the response timed from start.
+func recordMessage(options *types.ClaudeAgentOptions, costs *costMeter, msg types.Message, start time.Time) {
+	sink := options.MetricsSink
+	if sink == nil {
+		return
+	}
+	sink.IncCounter(types.MetricMessages, 1, map[string]string{"type": msg.GetMessageType()})
+
+	result, ok := msg.(*types.ResultMessage)
+	if !ok {
+		return
+	}
+	if cost := costs.add(result); cost > 0 {
+		sink.IncCounter(types.MetricCostUSD, cost, nil)
+	}
+	if usage, err := result.ParseUsage(); err == nil && usage != nil {
+		recordUsage(sink, usage)
+	}
+	sink.ObserveDuration(types.MetricResponseDuration, time.Since(start), nil)
+}
+
+// costMeter turns the session cost totals of result messages into the cost
+// each result adds, so that a multi-turn session is not counted again on
+// every turn.
+type costMeter struct {
+	mu   sync.Mutex
+	last map[string]float64 // Latest total_cost_usd by session ID
+}
+
+// add returns the cost result adds to its session since the previous result.
+// A total below the previous one starts the session's count afresh.
+func (m *costMeter) add(result *types.ResultMessage) float64 {
+	if result.TotalCostUSD == nil {
+		return 0
+	}
+	total := *result.TotalCostUSD
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last == nil {
+		m.last = make(map[string]float64)
+	}
+	cost := total - m.last[result.SessionID]
+	if cost < 0 {
+		cost = total
+	}
+	m.last[result.SessionID] = total
+	return cost
+}
+
+// clone returns a meter that starts from the totals m has seen so far.
+func (m *costMeter) clone() *costMeter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := &costMeter{last: make(map[string]float64, len(m.last))}
+	for session, total := range m.last {
+		c.last[session] = total
+	}
+	return c
+}
+
+// recordUsage adds a turn's token usage to the token counters.
+func recordUsage(sink types.MetricsSink, usage *types.Usage) {
+	counters := []struct {
+		name   string
+		tokens int
+	}{
+		{types.MetricInputTokens, usage.InputTokens},
+		{types.MetricCacheReadTokens, usage.CacheReadInputTokens},
+		{types.MetricCacheCreationTokens, usage.CacheCreationInputTokens},
+		{types.MetricOutputTokens, usage.OutputTokens},
+	}
+	for _, c := range counters {
+		if c.tokens > 0 {
+			sink.IncCounter(c.name, float64(c.tokens), nil)
+		}
+	}
+}
+
+// recordConnect reports how long Connect took and, on success, one more
+// connected client.
+func recordConnect(options *types.ClaudeAgentOptions, start time.Time, err error) {
+	sink := options.MetricsSink
+	if sink == nil {
+		return
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	sink.ObserveDuration(types.MetricConnectDuration, time.Since(start), map[string]string{"outcome": outcome})
+	if err == nil {
+		sink.AddGauge(types.MetricClientsConnected, 1, nil)
+	}
+}
+
+// recordWarmup reports how long a pooled client's warmup took.
+func recordWarmup(options *types.ClaudeAgentOptions, start time.Time, err error) {
+	sink := options.MetricsSink
+	if sink == nil {
+		return
+	}
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	sink.ObserveDuration(types.MetricWarmupDuration, time.Since(start), map[string]string{"outcome": outcome})
+}
+
+// recordDisconnect reports a connected client that was closed.
+func recordDisconnect(options *types.ClaudeAgentOptions) {
+	if sink := options.MetricsSink; sink != nil {
+		sink.AddGauge(types.MetricClientsConnected, -1, nil)
+	}
+}
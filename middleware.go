@@ -0,0 +1,419 @@
+package claude
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/storage"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// QueryFunc has the signature of Query. Middleware wraps one QueryFunc in
+// another, so cross-cutting behaviour such as retries, caching, or rate
+// limiting can be layered around Query without changing call sites.
+type QueryFunc func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error)
+
+// Middleware decorates a QueryFunc.
+type Middleware func(next QueryFunc) QueryFunc
+
+// Chain composes middlewares into one. The first middleware is the outermost:
+// Chain(a, b, c)(Query) runs a, then b, then c, then Query, and sees the
+// results in reverse order.
+//
+// Example:
+//
+//	query := claude.Chain(
+//	    claude.RateLimit(time.Second, 5),
+//	    claude.Retry(3, 500*time.Millisecond),
+//	    claude.Cache(10*time.Minute),
+//	)(claude.Query)
+//
+//	messages, err := query(ctx, "What is 2+2?", opts)
+func Chain(mw ...Middleware) Middleware {
+	return func(next QueryFunc) QueryFunc {
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+		return next
+	}
+}
+
+// Retry retries a query whose start fails with an error that
+// types.IsRetryable reports as transient, the policy WithRetry also uses. It
+// makes up to attempts calls in total, waiting backoff before the first retry
+// and doubling the wait after each one. Errors returned once messages are
+// streaming are not retried.
+func Retry(attempts int, backoff time.Duration) Middleware {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+			wait := backoff
+			for attempt := 1; ; attempt++ {
+				messages, err := next(ctx, prompt, opts)
+				if err == nil || attempt >= attempts || !types.IsRetryable(err) {
+					return messages, err
+				}
+
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				case <-timer.C:
+				}
+				wait *= 2
+			}
+		}
+	}
+}
+
+// RateLimit allows at most burst queries to start at once and refills one
+// slot every interval. A query that finds no slot waits for one, or returns
+// the context's error if ctx ends first.
+func RateLimit(every time.Duration, burst int) Middleware {
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := &tokenBucket{
+		tokens: float64(burst),
+		burst:  float64(burst),
+		every:  every,
+		last:   time.Now(),
+	}
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+			if err := limiter.wait(ctx); err != nil {
+				return nil, err
+			}
+			return next(ctx, prompt, opts)
+		}
+	}
+}
+
+// tokenBucket is the limiter behind RateLimit.
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	burst  float64
+	every  time.Duration
+	last   time.Time
+}
+
+// wait takes a token, sleeping until one is available.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		delay := b.take()
+		if delay == 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// take refills the bucket and takes a token, or returns how long to wait for
+// the next one.
+func (b *tokenBucket) take() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.every <= 0 {
+		b.tokens = b.burst
+	} else {
+		b.tokens += float64(now.Sub(b.last)) / float64(b.every)
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(b.every))
+}
+
+// DefaultCacheSize is the most responses Cache keeps.
+const DefaultCacheSize = 1024
+
+// Cache replays the messages of an earlier identical query for ttl instead
+// of starting the CLI again. Queries are identical when the prompt and the
+// JSON form of the options match. Only runs that end in a successful
+// ResultMessage are stored; options that cannot be encoded as JSON bypass
+// the cache. It keeps at most DefaultCacheSize responses; see CacheWithSize.
+//
+// Options that are not encoded as JSON, such as the CanUseTool callback,
+// hooks and the logger, are not part of the key: queries differing only in
+// them share cached responses, and a replayed response calls none of them.
+func Cache(ttl time.Duration) Middleware {
+	return CacheWithSize(ttl, DefaultCacheSize)
+}
+
+// CacheWithSize is like Cache but keeps at most maxEntries responses. Storing
+// a response first drops the expired ones and then, while the cache is
+// full, the oldest. A maxEntries below 1 stores nothing.
+func CacheWithSize(ttl time.Duration, maxEntries int) Middleware {
+	if maxEntries < 1 {
+		return func(next QueryFunc) QueryFunc {
+			return next
+		}
+	}
+	return cacheWith(&responseCache{ttl: ttl, maxEntries: maxEntries, entries: make(map[string]cacheEntry)})
+}
+
+// CacheWithStore is like Cache but keeps the responses in store, under keys
+// starting with CacheKeyPrefix, so that they are shared by every process
+// using the store and outlive the process with a persistent one. The store's
+// expiry limits their age to ttl, which must be positive for anything to be
+// cached; there is no limit on their number. A store
+// that fails to read a response is treated as a miss, and one that fails to
+// write it leaves the response uncached.
+func CacheWithStore(ttl time.Duration, store storage.Store) Middleware {
+	return cacheWith(&storeCache{store: store, ttl: ttl})
+}
+
+// CacheKeyPrefix starts the keys of the responses CacheWithStore stores.
+const CacheKeyPrefix = "claude/cache/"
+
+// cacheBackend holds the responses of a cache middleware.
+type cacheBackend interface {
+	// get returns the unexpired messages stored under key.
+	get(ctx context.Context, key string) ([]types.Message, bool)
+
+	// put stores the messages of a successful run under key.
+	put(ctx context.Context, key string, messages []types.Message)
+}
+
+// cacheWith returns a cache middleware keeping responses in cache.
+func cacheWith(cache cacheBackend) Middleware {
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+			key, ok := cacheKey(prompt, opts)
+			if !ok {
+				return next(ctx, prompt, opts)
+			}
+			if messages, hit := cache.get(ctx, key); hit {
+				return replay(messages), nil
+			}
+
+			messages, err := next(ctx, prompt, opts)
+			if err != nil {
+				return nil, err
+			}
+			return recordResponse(ctx, cache, key, messages), nil
+		}
+	}
+}
+
+// cacheEntry is one stored response.
+type cacheEntry struct {
+	messages []types.Message
+	expires  time.Time
+	seq      uint64 // Insertion number, matching the entry's place in order
+}
+
+// cacheSlot records the insertion of a key in responseCache.order.
+type cacheSlot struct {
+	key string
+	seq uint64
+}
+
+// responseCache is the in-memory cache behind Cache. Entries expire in insertion
+// order, since they all live for ttl, so order doubles as the expiry queue.
+type responseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]cacheEntry
+	order      []cacheSlot // Oldest first; slots of replaced entries are stale
+	seq        uint64
+}
+
+// cacheKey derives the cache key for a query.
+func cacheKey(prompt string, opts *types.ClaudeAgentOptions) (string, bool) {
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		return "", false
+	}
+	return prompt + "\x00" + string(encoded), true
+}
+
+// get returns the unexpired messages stored under key.
+func (c *responseCache) get(_ context.Context, key string) ([]types.Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.messages, true
+}
+
+// recordResponse forwards messages and stores them in cache under key once
+// the run ends with a successful result.
+func recordResponse(ctx context.Context, cache cacheBackend, key string, messages <-chan types.Message) <-chan types.Message {
+	out := make(chan types.Message)
+	go func() {
+		defer close(out)
+
+		var seen []types.Message
+		succeeded := false
+		for msg := range messages {
+			seen = append(seen, msg)
+			if result, ok := msg.(*types.ResultMessage); ok {
+				succeeded = !result.IsError
+			}
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				// Drain so the producer can finish; the run is incomplete
+				for range messages {
+				}
+				return
+			}
+		}
+
+		if succeeded {
+			cache.put(ctx, key, seen)
+		}
+	}()
+	return out
+}
+
+// put stores messages under key, evicting expired entries and then the
+// oldest ones to stay within maxEntries.
+func (c *responseCache) put(_ context.Context, key string, messages []types.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	delete(c.entries, key)
+	for len(c.order) > 0 {
+		slot := c.order[0]
+		if entry, ok := c.entries[slot.key]; ok && entry.seq == slot.seq {
+			if !now.After(entry.expires) && len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, slot.key)
+		}
+		c.order = c.order[1:]
+	}
+
+	c.seq++
+	c.entries[key] = cacheEntry{messages: messages, expires: now.Add(c.ttl), seq: c.seq}
+	c.order = append(c.order, cacheSlot{key: key, seq: c.seq})
+}
+
+// storeCache is the cache behind CacheWithStore. Each response is one entry
+// holding the JSON array of its messages, under CacheKeyPrefix and the hash
+// of the query's key.
+type storeCache struct {
+	store storage.Store
+	ttl   time.Duration
+}
+
+// storeKey returns the store key of a query's cache key.
+func (c *storeCache) storeKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return CacheKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// get returns the messages stored under key. Entries that cannot be read or
+// decoded are misses.
+func (c *storeCache) get(ctx context.Context, key string) ([]types.Message, bool) {
+	data, err := c.store.Get(ctx, c.storeKey(key))
+	if err != nil {
+		return nil, false
+	}
+	var lines []json.RawMessage
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return nil, false
+	}
+	messages := make([]types.Message, 0, len(lines))
+	for _, line := range lines {
+		msg, err := types.UnmarshalMessage(line)
+		if err != nil {
+			return nil, false
+		}
+		messages = append(messages, msg)
+	}
+	return messages, true
+}
+
+// put stores messages under key for ttl. The response stays uncached if it
+// cannot be encoded or written, or if ttl is not positive, since the store
+// would keep it forever.
+func (c *storeCache) put(ctx context.Context, key string, messages []types.Message) {
+	if c.ttl <= 0 {
+		return
+	}
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return
+	}
+	_ = c.store.Put(context.WithoutCancel(ctx), c.storeKey(key), data, c.ttl)
+}
+
+// replay streams stored messages on a new channel.
+func replay(messages []types.Message) <-chan types.Message {
+	out := make(chan types.Message, len(messages))
+	for _, msg := range messages {
+		out <- msg
+	}
+	close(out)
+	return out
+}
+
+// SendFunc sends a user message on a connected Client.
+type SendFunc func(ctx context.Context, msg *types.UserMessage) error
+
+// ClientInterceptor decorates the send path of a Client, the interactive
+// counterpart of Middleware. An interceptor may inspect or rewrite the
+// message, reject it by returning an error, or pass it on to next.
+type ClientInterceptor func(next SendFunc) SendFunc
+
+// ChainInterceptors composes interceptors into one. As with Chain, the first
+// interceptor is the outermost.
+func ChainInterceptors(interceptors ...ClientInterceptor) ClientInterceptor {
+	return func(next SendFunc) SendFunc {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			next = interceptors[i](next)
+		}
+		return next
+	}
+}
+
+// Use adds interceptors to the client's send path. They run, in the order
+// added, for every Query, QueryWithContent, and QueryWithMessage call.
+//
+// Example:
+//
+//	client.Use(func(next claude.SendFunc) claude.SendFunc {
+//	    return func(ctx context.Context, msg *types.UserMessage) error {
+//	        log.Printf("sending prompt")
+//	        return next(ctx, msg)
+//	    }
+//	})
+func (c *Client) Use(interceptors ...ClientInterceptor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interceptors = append(c.interceptors, interceptors...)
+}
@@ -0,0 +1,456 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/storage"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// fakeQuery returns a QueryFunc that answers every prompt with a text reply
+// and a successful result, counting its calls.
+func fakeQuery(calls *int32) QueryFunc {
+	return func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		atomic.AddInt32(calls, 1)
+		out := make(chan types.Message, 2)
+		out <- &types.AssistantMessage{Type: "assistant", Content: []types.ContentBlock{types.NewTextBlock(prompt)}}
+		out <- &types.ResultMessage{Type: "result", Subtype: "success"}
+		close(out)
+		return out, nil
+	}
+}
+
+// recordingMiddleware appends name to log on the way in and out.
+func recordingMiddleware(name string, mu *sync.Mutex, log *[]string) Middleware {
+	return func(next QueryFunc) QueryFunc {
+		return func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+			mu.Lock()
+			*log = append(*log, name+" in")
+			mu.Unlock()
+			messages, err := next(ctx, prompt+" "+name, opts)
+			mu.Lock()
+			*log = append(*log, name+" out")
+			mu.Unlock()
+			return messages, err
+		}
+	}
+}
+
+func drain(messages <-chan types.Message) []types.Message {
+	var all []types.Message
+	for msg := range messages {
+		all = append(all, msg)
+	}
+	return all
+}
+
+func TestChain_Ordering(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		log   []string
+		calls int32
+		sent  string
+	)
+	terminal := func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		sent = prompt
+		return fakeQuery(&calls)(ctx, prompt, opts)
+	}
+
+	query := Chain(
+		recordingMiddleware("a", &mu, &log),
+		recordingMiddleware("b", &mu, &log),
+		recordingMiddleware("c", &mu, &log),
+	)(terminal)
+
+	messages, err := query(context.Background(), "hi", nil)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	drain(messages)
+
+	want := []string{"a in", "b in", "c in", "c out", "b out", "a out"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("order = %v, want %v", log, want)
+	}
+	if sent != "hi a b c" {
+		t.Errorf("terminal saw prompt %q, want %q", sent, "hi a b c")
+	}
+}
+
+func TestChain_Empty(t *testing.T) {
+	var calls int32
+	messages, err := Chain()(fakeQuery(&calls))(context.Background(), "hi", nil)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if got := len(drain(messages)); got != 2 {
+		t.Errorf("got %d messages, want 2", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	flaky := func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return nil, types.NewCLIConnectionError("connect failed")
+		}
+		var ok int32
+		return fakeQuery(&ok)(ctx, prompt, opts)
+	}
+
+	messages, err := Retry(3, time.Millisecond)(flaky)(context.Background(), "hi", nil)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	drain(messages)
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestRetry_GivesUp(t *testing.T) {
+	var calls int32
+	failing := func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, types.NewCLIConnectionError("connect failed")
+	}
+
+	_, err := Retry(2, time.Millisecond)(failing)(context.Background(), "hi", nil)
+	if !types.IsCLIConnectionError(err) {
+		t.Errorf("err = %v, want CLIConnectionError", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestRetry_NotRetryable(t *testing.T) {
+	var calls int32
+	failing := func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, types.NewCLINotFoundError("no cli")
+	}
+
+	if _, err := Retry(3, time.Millisecond)(failing)(context.Background(), "hi", nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetry_WrappedPermanentFailure(t *testing.T) {
+	var calls int32
+	failing := func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.Join(types.NewCLIConnectionError("connect failed"), types.NewUnsupportedCLIVersionError("1.0.0", "2.0.0"))
+	}
+
+	if _, err := Retry(3, time.Millisecond)(failing)(context.Background(), "hi", nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetry_ContextCancelled(t *testing.T) {
+	failing := func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		return nil, types.NewProcessError("exited")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Retry(3, time.Hour)(failing)(ctx, "hi", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var calls int32
+	query := RateLimit(50*time.Millisecond, 2)(fakeQuery(&calls))
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		messages, err := query(context.Background(), "hi", nil)
+		if err != nil {
+			t.Fatalf("query %d failed: %v", i, err)
+		}
+		drain(messages)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("third query started after %v, want it to wait for a token", elapsed)
+	}
+}
+
+func TestRateLimit_ContextCancelled(t *testing.T) {
+	var calls int32
+	query := RateLimit(time.Hour, 1)(fakeQuery(&calls))
+
+	if _, err := query(context.Background(), "hi", nil); err != nil {
+		t.Fatalf("first query failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := query(ctx, "hi", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var calls int32
+	query := Cache(time.Minute)(fakeQuery(&calls))
+	opts := types.NewClaudeAgentOptions().WithModel("claude-sonnet-4-5")
+
+	first, err := query(context.Background(), "hi", opts)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	want := drain(first)
+
+	second, err := query(context.Background(), "hi", opts)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if got := drain(second); !reflect.DeepEqual(got, want) {
+		t.Errorf("cached messages = %v, want %v", got, want)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+
+	// A different prompt or different options miss the cache
+	drainQuery(t, query, "other", opts)
+	drainQuery(t, query, "hi", types.NewClaudeAgentOptions().WithModel("claude-opus-4-1"))
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestCache_SkipsFailedRuns(t *testing.T) {
+	var calls int32
+	failing := func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		atomic.AddInt32(&calls, 1)
+		out := make(chan types.Message, 1)
+		out <- &types.ResultMessage{Type: "result", Subtype: "error_during_execution", IsError: true}
+		close(out)
+		return out, nil
+	}
+	query := Cache(time.Minute)(failing)
+
+	drainQuery(t, query, "hi", nil)
+	drainQuery(t, query, "hi", nil)
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestCache_Expires(t *testing.T) {
+	var calls int32
+	query := Cache(time.Nanosecond)(fakeQuery(&calls))
+
+	drainQuery(t, query, "hi", nil)
+	time.Sleep(time.Millisecond)
+	drainQuery(t, query, "hi", nil)
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestCacheWithSize_EvictsOldest(t *testing.T) {
+	var calls int32
+	query := CacheWithSize(time.Minute, 2)(fakeQuery(&calls))
+
+	drainQuery(t, query, "a", nil)
+	drainQuery(t, query, "b", nil)
+	drainQuery(t, query, "c", nil) // evicts "a"
+	drainQuery(t, query, "c", nil)
+	drainQuery(t, query, "b", nil)
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+	drainQuery(t, query, "a", nil)
+	if calls != 4 {
+		t.Errorf("calls = %d, want the evicted entry to miss", calls)
+	}
+}
+
+// cacheStores returns an empty store of each implementation in package
+// storage.
+func cacheStores(t *testing.T) map[string]storage.Store {
+	files, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]storage.Store{"memory": storage.NewMemoryStore(), "file": files}
+}
+
+// TestCacheWithStore tests that responses kept in a store are replayed by
+// every cache sharing it, as by a process started later, and expire.
+func TestCacheWithStore(t *testing.T) {
+	for name, store := range cacheStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			opts := types.NewClaudeAgentOptions().WithModel("claude-sonnet-4-5")
+			first, err := CacheWithStore(time.Minute, store)(fakeQuery(&calls))(context.Background(), "hi", opts)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			want := drain(first)
+
+			second, err := CacheWithStore(time.Minute, store)(fakeQuery(&calls))(context.Background(), "hi", opts)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if got := drain(second); describeMessages(got) != describeMessages(want) || got[0].(*types.AssistantMessage).Text() != "hi" {
+				t.Errorf("cached messages = %s, want %s", describeMessages(got), describeMessages(want))
+			}
+			if calls != 1 {
+				t.Errorf("calls = %d, want 1", calls)
+			}
+
+			keys, err := store.List(context.Background(), CacheKeyPrefix)
+			if err != nil || len(keys) != 1 {
+				t.Errorf("store keys = %v, %v; want one response", keys, err)
+			}
+
+			// Nothing is stored with a ttl that is not positive
+			uncached := CacheWithStore(0, store)(fakeQuery(&calls))
+			drainQuery(t, uncached, "other", nil)
+			drainQuery(t, uncached, "other", nil)
+			if calls != 3 {
+				t.Errorf("calls = %d, want 3", calls)
+			}
+		})
+	}
+}
+
+// TestCacheWithStore_Expires tests that the store's expiry ends a response.
+func TestCacheWithStore_Expires(t *testing.T) {
+	var calls int32
+	query := CacheWithStore(50*time.Millisecond, storage.NewMemoryStore())(fakeQuery(&calls))
+
+	drainQuery(t, query, "hi", nil)
+	drainQuery(t, query, "hi", nil)
+	time.Sleep(100 * time.Millisecond)
+	drainQuery(t, query, "hi", nil)
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+// TestCache_ExpiredEntriesDroppedOnInsert tests that entries nobody looks up
+// again do not outlive their ttl in memory.
+func TestCache_ExpiredEntriesDroppedOnInsert(t *testing.T) {
+	cache := &responseCache{ttl: time.Nanosecond, maxEntries: DefaultCacheSize, entries: make(map[string]cacheEntry)}
+	for _, key := range []string{"a", "b", "c"} {
+		cache.put(context.Background(), key, nil)
+		time.Sleep(time.Millisecond)
+	}
+	if len(cache.entries) != 1 || len(cache.order) != 1 {
+		t.Errorf("cache holds %d entries in %d slots, want only the newest", len(cache.entries), len(cache.order))
+	}
+}
+
+func drainQuery(t *testing.T, query QueryFunc, prompt string, opts *types.ClaudeAgentOptions) {
+	t.Helper()
+	messages, err := query(context.Background(), prompt, opts)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	drain(messages)
+}
+
+func TestChain_RetryCacheRateLimit(t *testing.T) {
+	var calls int32
+	flaky := func(ctx context.Context, prompt string, opts *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, types.NewProcessError("exited")
+		}
+		var ok int32
+		return fakeQuery(&ok)(ctx, prompt, opts)
+	}
+
+	query := Chain(
+		RateLimit(time.Millisecond, 1),
+		Cache(time.Minute),
+		Retry(2, time.Millisecond),
+	)(flaky)
+
+	drainQuery(t, query, "hi", nil)
+	drainQuery(t, query, "hi", nil)
+
+	// The first run is retried once; the second is served from the cache
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestClient_Use(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectEcho(t, ctx)
+	defer client.Close(ctx)
+
+	var order []string
+	record := func(name string) ClientInterceptor {
+		return func(next SendFunc) SendFunc {
+			return func(ctx context.Context, msg *types.UserMessage) error {
+				order = append(order, name+":"+msg.Content.(string))
+				msg.Content = msg.Content.(string) + " " + name
+				return next(ctx, msg)
+			}
+		}
+	}
+	client.Use(record("a"), record("b"))
+	client.Use(record("c"))
+
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var gotResult bool
+	for msg := range client.ReceiveResponse(ctx) {
+		if _, ok := msg.(*types.ResultMessage); ok {
+			gotResult = true
+		}
+	}
+	if !gotResult {
+		t.Error("expected a ResultMessage")
+	}
+
+	want := []string{"a:hi", "b:hi a", "c:hi a b"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
+
+func TestClient_UseRejects(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectEcho(t, ctx)
+	defer client.Close(ctx)
+
+	errBlocked := errors.New("blocked")
+	client.Use(func(next SendFunc) SendFunc {
+		return func(ctx context.Context, msg *types.UserMessage) error {
+			return errBlocked
+		}
+	})
+
+	if err := client.Query(ctx, "hi"); !errors.Is(err, errBlocked) {
+		t.Errorf("err = %v, want %v", err, errBlocked)
+	}
+}
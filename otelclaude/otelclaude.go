@@ -0,0 +1,96 @@
+// Package otelclaude adapts an OpenTelemetry tracer to the SDK's
+// types.Tracer, so that Claude sessions show up in OpenTelemetry traces:
+//
+//	opts := types.NewClaudeAgentOptions().
+//	    WithTracer(otelclaude.NewTracer(otel.Tracer("my-service")))
+//
+// Connect, each turn and Close become client spans, with the CLI's
+// permission requests as server spans under their turn. Spans ended with an
+// error record it and have an Error status.
+//
+// It is a module of its own so that the SDK does not depend on OpenTelemetry.
+package otelclaude
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Tracer is a types.Tracer creating OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ types.Tracer = (*Tracer)(nil)
+
+// NewTracer returns a types.Tracer that creates its spans with tracer.
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start implements types.Tracer.
+func (t *Tracer) Start(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, types.Span) {
+	kind := trace.SpanKindClient
+	if name == types.SpanPermission {
+		kind = trace.SpanKindServer // the CLI calls the SDK
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes(attrs)...))
+	return ctx, &otelSpan{span: span}
+}
+
+// otelSpan is the types.Span of an OpenTelemetry span.
+type otelSpan struct {
+	span trace.Span
+}
+
+// SetAttributes implements types.Span.
+func (s *otelSpan) SetAttributes(attrs map[string]interface{}) {
+	s.span.SetAttributes(attributes(attrs)...)
+}
+
+// End implements types.Span.
+func (s *otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// attributes converts SDK attributes, sorted by key. Values of types
+// OpenTelemetry has no attribute for are formatted as strings.
+func attributes(attrs map[string]interface{}) []attribute.KeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]attribute.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		switch v := attrs[k].(type) {
+		case string:
+			kvs = append(kvs, attribute.String(k, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(k, v))
+		case int:
+			kvs = append(kvs, attribute.Int(k, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(k, v))
+		case float64:
+			kvs = append(kvs, attribute.Float64(k, v))
+		case []string:
+			kvs = append(kvs, attribute.StringSlice(k, v))
+		default:
+			kvs = append(kvs, attribute.String(k, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,70 @@
+package otelclaude
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewTracer(provider.Tracer("test"))
+
+	ctx, turn := tracer.Start(context.Background(), types.SpanTurn, map[string]interface{}{types.AttrModel: "sonnet"})
+	_, perm := tracer.Start(ctx, types.SpanPermission, map[string]interface{}{types.AttrToolName: "Bash"})
+	perm.SetAttributes(map[string]interface{}{types.AttrPermissionResult: "deny"})
+	perm.End(nil)
+	turn.SetAttributes(map[string]interface{}{
+		types.AttrNumTurns: 2,
+		types.AttrCostUSD:  0.02,
+		types.AttrIsError:  true,
+	})
+	turn.End(errors.New("turn ended with an error result (error_max_turns)"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	permSpan, turnSpan := spans[0], spans[1]
+
+	if permSpan.Name() != types.SpanPermission || permSpan.SpanKind() != trace.SpanKindServer {
+		t.Errorf("permission span = %s (%v)", permSpan.Name(), permSpan.SpanKind())
+	}
+	if permSpan.Parent().SpanID() != turnSpan.SpanContext().SpanID() {
+		t.Error("permission span is not a child of the turn")
+	}
+	if permSpan.Status().Code != codes.Unset {
+		t.Errorf("permission span status = %v, want unset", permSpan.Status())
+	}
+
+	if turnSpan.SpanKind() != trace.SpanKindClient || turnSpan.Status().Code != codes.Error {
+		t.Errorf("turn span kind %v, status %v", turnSpan.SpanKind(), turnSpan.Status())
+	}
+	want := []attribute.KeyValue{
+		attribute.String(types.AttrModel, "sonnet"),
+		attribute.Int(types.AttrNumTurns, 2),
+		attribute.Float64(types.AttrCostUSD, 0.02),
+		attribute.Bool(types.AttrIsError, true),
+	}
+	got := make(map[attribute.Key]attribute.Value)
+	for _, kv := range turnSpan.Attributes() {
+		got[kv.Key] = kv.Value
+	}
+	for _, kv := range want {
+		if v, ok := got[kv.Key]; !ok || v != kv.Value {
+			t.Errorf("turn attribute %s = %v, want %v", kv.Key, v.Emit(), kv.Value.Emit())
+		}
+	}
+	if len(turnSpan.Events()) != 1 || turnSpan.Events()[0].Name != "exception" {
+		t.Errorf("turn span events = %v, want the recorded error", turnSpan.Events())
+	}
+}
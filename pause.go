@@ -0,0 +1,124 @@
+package claude
+
+import (
+	"context"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// heldPrompt is a user message sent while the client was paused.
+type heldPrompt struct {
+	line     string
+	topLevel bool
+}
+
+// Pause holds the session at its next decision point without stopping
+// anything, for an operator who wants to look before the agent goes on.
+// The tool call in progress finishes, but permission requests and hook
+// callbacks that the CLI sends from now on are not answered until Resume,
+// so the CLI waits before its next tool use. Prompts sent with Query and
+// its variants while paused are queued and return nil at once.
+//
+// Permission requests stay held for as long as the pause lasts. The CLI
+// gives up on a hook callback after its hook timeout (60 seconds by
+// default), so one still held after 50 seconds is answered {"async": true}
+// instead: the CLI goes on without its output, and the callback runs on
+// Resume with its output dropped. Pausing a paused client does nothing.
+//
+// Example:
+//
+//	if err := client.Pause(); err != nil {
+//	    return err
+//	}
+//	// ... inspect the workspace ...
+//	if err := client.Resume(ctx); err != nil {
+//	    return err
+//	}
+func (c *Client) Pause() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+	if c.paused {
+		return nil
+	}
+	c.paused = true
+	c.query.Pause()
+	logState(c.options, "session paused")
+	return nil
+}
+
+// Resume ends a Pause: it answers the held permission requests and hook
+// callbacks in the order they arrived, then sends the queued prompts in the
+// order they were sent. Prompts sent while Resume runs are queued behind
+// them. It returns ctx's error if ctx is done before the held requests are
+// answered, and the first error writing a prompt; either leaves the client
+// paused with the unsent prompts still queued, and Resume can be called
+// again.
+// Resuming a client that is not paused does nothing.
+func (c *Client) Resume(ctx context.Context) error {
+	c.resumeMu.Lock()
+	defer c.resumeMu.Unlock()
+
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return nil
+	}
+	query := c.query
+	c.mu.Unlock()
+
+	if err := query.Resume(ctx); err != nil {
+		return err
+	}
+	for {
+		c.mu.Lock()
+		if !c.paused {
+			// Closed while resuming
+			c.mu.Unlock()
+			return types.NewCLIConnectionError("client closed while resuming")
+		}
+		if len(c.heldPrompts) == 0 {
+			c.paused = false
+			c.mu.Unlock()
+			logState(c.options, "session resumed")
+			return nil
+		}
+		prompt := c.heldPrompts[0]
+		c.mu.Unlock()
+
+		if err := c.writePrompt(ctx, prompt.line, prompt.topLevel); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		if len(c.heldPrompts) > 0 {
+			c.heldPrompts = c.heldPrompts[1:]
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Paused reports whether the client is paused: between Pause and the end
+// of Resume.
+func (c *Client) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// queueWhilePaused queues an encoded prompt if the client is paused and
+// reports whether it did.
+func (c *Client) queueWhilePaused(line string, topLevel bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.paused {
+		return false
+	}
+	c.heldPrompts = append(c.heldPrompts, heldPrompt{line: line, topLevel: topLevel})
+	logState(c.options, "query queued while paused", "queued", len(c.heldPrompts))
+	return true
+}
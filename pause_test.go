@@ -0,0 +1,142 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// pauseCLI returns a mock CLI that asks permission once, then sends a hook
+// callback and a second permission request, and finishes two turns once it
+// has read the answers and the next prompt.
+func pauseCLI(t *testing.T) *mockcli.CLI {
+	t.Helper()
+	return mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"control_request","request_id":"perm_1","request":{"subtype":"can_use_tool","tool_name":"Read","input":{"file_path":"/app/main.go"}}}`),
+		mockcli.AwaitResponse("perm_1"),
+		mockcli.Send(
+			`{"type":"control_request","request_id":"req_hook_1","request":{"subtype":"hook_callback","callback_id":"hook_1","tool_use_id":"toolu_2","input":{"session_id":"s1","transcript_path":"/t.jsonl","cwd":"/app","hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}}}}`,
+			`{"type":"control_request","request_id":"perm_2","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"}}}`,
+		),
+		mockcli.AwaitResponse("req_hook_1"),
+		mockcli.AwaitResponse("perm_2"),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(streamResult, streamResult),
+	}})
+}
+
+// TestClient_PauseResume tests that requests arriving while paused are held
+// and answered exactly once on Resume, before the prompts queued meanwhile.
+func TestClient_PauseResume(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := pauseCLI(t)
+	var client *Client
+	paused := make(chan error, 1)
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithStrictProtocol(true).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			// The operator pauses while the first tool is being approved
+			if toolName == "Read" {
+				paused <- client.Pause()
+			}
+			return &types.PermissionResultAllow{Behavior: "allow"}, nil
+		}).
+		WithHook(types.HookEventPreToolUse, types.HookMatcher{
+			Hooks: []types.HookCallbackFunc{
+				func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+					return map[string]interface{}{}, nil
+				},
+			},
+		})
+
+	var err error
+	client, err = NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() { _ = client.Close(context.Background()) }()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "first"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if err := <-paused; err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+
+	// Both later requests are held, and the next prompt is queued
+	waitFor(t, "two held control requests", func() bool {
+		return client.query.Stats().HeldControlRequests == 2
+	})
+	if err := client.Query(ctx, "second"); err != nil {
+		t.Fatalf("Query while paused failed: %v", err)
+	}
+	if !client.Paused() {
+		t.Error("Paused() = false while paused")
+	}
+	if got := cli.Received()[2:]; len(got) != 1 || !strings.Contains(got[0], `"perm_1"`) {
+		t.Fatalf("CLI received %q while paused, want only the first permission response", got)
+	}
+
+	if err := client.Resume(ctx); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if client.Paused() {
+		t.Error("Paused() = true after Resume")
+	}
+	for i := 0; i < 2; i++ {
+		for range client.ReceiveResponse(ctx) {
+		}
+	}
+
+	// After initialize and the first prompt
+	lines := cli.Received()[2:]
+	if len(lines) != 4 {
+		t.Fatalf("CLI received %d lines, want 4: %q", len(lines), lines)
+	}
+	answered := make(map[string]int)
+	for _, line := range lines[:3] {
+		var frame struct {
+			Type     string `json:"type"`
+			Response struct {
+				Subtype   string `json:"subtype"`
+				RequestID string `json:"request_id"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal([]byte(line), &frame); err != nil || frame.Type != "control_response" || frame.Response.Subtype != "success" {
+			t.Fatalf("line %q is not a successful control response", line)
+		}
+		answered[frame.Response.RequestID]++
+	}
+	for _, id := range []string{"perm_1", "req_hook_1", "perm_2"} {
+		if answered[id] != 1 {
+			t.Errorf("request %s answered %d times, want once", id, answered[id])
+		}
+	}
+	if !strings.Contains(lines[3], `"second"`) {
+		t.Errorf("last line = %q, want the queued prompt", lines[3])
+	}
+}
+
+func TestClient_PauseNotConnected(t *testing.T) {
+	client, err := NewClient(context.Background(), types.NewClaudeAgentOptions().WithCLIPath("/bin/echo"))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Pause(); !types.IsCLIConnectionError(err) {
+		t.Errorf("Pause before Connect = %v, want CLIConnectionError", err)
+	}
+	if err := client.Resume(context.Background()); err != nil {
+		t.Errorf("Resume of a client that is not paused = %v, want nil", err)
+	}
+}
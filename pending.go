@@ -0,0 +1,79 @@
+package claude
+
+import (
+	"errors"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// PendingPermissions returns the permission requests from the CLI that are
+// waiting for an answer, oldest first: those whose CanUseTool callback is
+// still running, and those it deferred by returning
+// types.ErrPermissionDeferred. It returns nil when not connected.
+func (c *Client) PendingPermissions() []types.PendingPermission {
+	query := c.connectedQuery()
+	if query == nil {
+		return nil
+	}
+	return query.PendingPermissions()
+}
+
+// ResolvePermission answers the pending permission request id with result,
+// from outside its CanUseTool callback, as an approval UI does once the user
+// decides. The first answer wins: if the callback has already returned, it
+// fails with a types.PermissionNotPendingError, and if the callback is still
+// running, its context is cancelled and what it returns is ignored.
+//
+// Example:
+//
+//	opts := types.NewClaudeAgentOptions().WithCanUseTool(
+//	    func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+//	        ui.Ask(toolName, input) // Answered later with client.ResolvePermission
+//	        return nil, types.ErrPermissionDeferred
+//	    })
+func (c *Client) ResolvePermission(id string, result types.PermissionResult) error {
+	if result == nil {
+		return errors.New("claude: ResolvePermission needs a result")
+	}
+	return c.settlePermission(id, func(q *internal.Query) bool {
+		return q.ResolvePermission(id, result)
+	})
+}
+
+// AbandonPermission withdraws the pending permission request id, as when
+// the user navigates away from the approval UI, leaving the decision to the
+// default rather than waiting. The default is the policy set with
+// WithAbandonedPermissionPolicy if any, and otherwise the permission mode
+// as it applies without a callback: PermissionModeBypassPermissions allows
+// the tool use, PermissionModeAcceptEdits allows file edits, and any other
+// mode denies it, telling the model the request was abandoned. Like
+// ResolvePermission, it fails with a types.PermissionNotPendingError once
+// the request has been answered.
+func (c *Client) AbandonPermission(id string) error {
+	return c.settlePermission(id, func(q *internal.Query) bool {
+		return q.AbandonPermission(id)
+	})
+}
+
+// settlePermission answers a pending permission request with settle.
+func (c *Client) settlePermission(id string, settle func(*internal.Query) bool) error {
+	query := c.connectedQuery()
+	if query == nil {
+		return types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+	if !settle(query) {
+		return types.NewPermissionNotPendingError(id)
+	}
+	return nil
+}
+
+// connectedQuery returns the query of a connected client, or nil.
+func (c *Client) connectedQuery() *internal.Query {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return nil
+	}
+	return c.query
+}
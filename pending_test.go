@@ -0,0 +1,156 @@
+package claude
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// connectDeferring connects a client whose permission callback defers every
+// decision to a CLI that asks for permission to run Bash, returning the
+// client and the CLI.
+func connectDeferring(t *testing.T, ctx context.Context) (*Client, *mockcli.CLI) {
+	t.Helper()
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"control_request","request_id":"req_perm_1","request":{"subtype":"can_use_tool","tool_name":"Bash","tool_use_id":"toolu_1","input":{"command":"ls /srv"}}}`),
+		mockcli.AwaitResponse("req_perm_1"),
+		mockcli.Send(streamResult),
+	}})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithStrictProtocol(true).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return nil, types.ErrPermissionDeferred
+		}))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "list /srv"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	return client, cli
+}
+
+// pendingRequest waits for the client's one pending permission request.
+func pendingRequest(t *testing.T, client *Client) types.PendingPermission {
+	t.Helper()
+	waitFor(t, "a pending permission request", func() bool {
+		return len(client.PendingPermissions()) == 1
+	})
+	return client.PendingPermissions()[0]
+}
+
+func TestClient_ResolvePermission(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, cli := connectDeferring(t, ctx)
+
+	pending := pendingRequest(t, client)
+	if pending.ToolName != "Bash" || pending.Input["command"] != "ls /srv" || pending.Context.ToolUseID != "toolu_1" {
+		t.Errorf("pending = %+v, want the Bash request", pending)
+	}
+	if err := client.ResolvePermission(pending.ID, &types.PermissionResultAllow{}); err != nil {
+		t.Fatalf("ResolvePermission failed: %v", err)
+	}
+	if got := describeMessages(collect(t, ctx, client.ReceiveResponse(ctx))); got != "result" {
+		t.Errorf("got %s, want the result", got)
+	}
+	if answer := permissionAnswer(t, cli); answer["behavior"] != "allow" {
+		t.Errorf("CLI got %v, want allow", answer)
+	}
+
+	// Each request is answered once
+	if err := client.ResolvePermission(pending.ID, &types.PermissionResultDeny{}); !types.IsPermissionNotPending(err) {
+		t.Errorf("second ResolvePermission = %v, want a PermissionNotPendingError", err)
+	}
+	if err := client.AbandonPermission("perm_missing"); !types.IsPermissionNotPending(err) {
+		t.Errorf("AbandonPermission of an unknown ID = %v, want a PermissionNotPendingError", err)
+	}
+}
+
+func TestClient_AbandonPermission(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, cli := connectDeferring(t, ctx)
+
+	if err := client.AbandonPermission(pendingRequest(t, client).ID); err != nil {
+		t.Fatalf("AbandonPermission failed: %v", err)
+	}
+	collect(t, ctx, client.ReceiveResponse(ctx))
+	if answer := permissionAnswer(t, cli); answer["behavior"] != "deny" || answer["message"] == "" {
+		t.Errorf("CLI got %v, want a denial with a message", answer)
+	}
+}
+
+func TestClient_AbandonPermissionPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"control_request","request_id":"req_perm_1","request":{"subtype":"can_use_tool","tool_name":"Bash","tool_use_id":"toolu_1","input":{"command":"ls /srv"}}}`),
+		mockcli.AwaitResponse("req_perm_1"),
+		mockcli.Send(streamResult),
+	}})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return nil, types.ErrPermissionDeferred
+		}).
+		WithAbandonedPermissionPolicy(types.PermissionPolicy{
+			AllowBashPatterns: []string{"ls *"},
+			DefaultBehavior:   types.PermissionBehaviorDeny,
+		}))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "list /srv"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	if err := client.AbandonPermission(pendingRequest(t, client).ID); err != nil {
+		t.Fatalf("AbandonPermission failed: %v", err)
+	}
+	collect(t, ctx, client.ReceiveResponse(ctx))
+	if answer := permissionAnswer(t, cli); answer["behavior"] != "allow" {
+		t.Errorf("CLI got %v, want the policy's allow", answer)
+	}
+}
+
+func TestClient_InvalidAbandonedPermissionPolicy(t *testing.T) {
+	_, err := NewClient(context.Background(), types.NewClaudeAgentOptions().
+		WithCLIPath("/bin/echo").
+		WithAbandonedPermissionPolicy(types.PermissionPolicy{DefaultBehavior: "ask"}))
+	if err == nil {
+		t.Error("NewClient accepted an abandoned permission policy defaulting to ask")
+	}
+}
+
+func TestClient_PendingPermissionsNotConnected(t *testing.T) {
+	client, err := NewClient(context.Background(), types.NewClaudeAgentOptions().WithCLIPath("/bin/echo"))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if pending := client.PendingPermissions(); pending != nil {
+		t.Errorf("PendingPermissions before Connect = %v, want nil", pending)
+	}
+	if err := client.ResolvePermission("perm_1", &types.PermissionResultAllow{}); !types.IsCLIConnectionError(err) {
+		t.Errorf("ResolvePermission before Connect = %v, want CLIConnectionError", err)
+	}
+	if err := client.ResolvePermission("perm_1", nil); err == nil {
+		t.Error("ResolvePermission with a nil result succeeded")
+	}
+}
@@ -0,0 +1,67 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// installPermissionPolicy validates options.PermissionPolicy and installs a
+// CanUseTool callback that evaluates it.
+func installPermissionPolicy(options *types.ClaudeAgentOptions) error {
+	policy := options.PermissionPolicy
+	if options.CanUseTool != nil {
+		return fmt.Errorf("permission_policy cannot be used with a can_use_tool callback")
+	}
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	cwd, err := policyCWD(options, policy)
+	if err != nil {
+		return err
+	}
+
+	options.CanUseTool = func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+		return policy.Evaluate(toolName, input, cwd), nil
+	}
+	return nil
+}
+
+// abandonedPolicy validates options.AbandonedPolicy and returns a function
+// evaluating it, or nil if none is set.
+func abandonedPolicy(options *types.ClaudeAgentOptions) (func(toolName string, input map[string]interface{}) types.PermissionResult, error) {
+	policy := options.AbandonedPolicy
+	if policy == nil {
+		return nil, nil
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("abandoned permission policy: %w", err)
+	}
+	cwd, err := policyCWD(options, policy)
+	if err != nil {
+		return nil, err
+	}
+	return func(toolName string, input map[string]interface{}) types.PermissionResult {
+		return policy.Evaluate(toolName, input, cwd)
+	}, nil
+}
+
+// policyCWD returns the absolute directory DenyPathsOutsideCWD checks against:
+// the configured working directory, or the process's own.
+func policyCWD(options *types.ClaudeAgentOptions, policy *types.PermissionPolicy) (string, error) {
+	if !policy.DenyPathsOutsideCWD {
+		return "", nil
+	}
+	if options.CWD != nil && *options.CWD != "" {
+		return transport.ResolveCWD(*options.CWD, options.CreateCWD)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine working directory for permission policy: %w", err)
+	}
+	return cwd, nil
+}
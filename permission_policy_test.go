@@ -0,0 +1,136 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestNewClient_PermissionPolicyConflict(t *testing.T) {
+	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+		return &types.PermissionResultAllow{}, nil
+	}
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath("/bin/echo").
+		WithCanUseTool(canUseTool).
+		WithPermissionPolicy(types.PermissionPolicy{AllowTools: []string{"Read"}})
+
+	_, err := NewClient(context.Background(), opts)
+	if err == nil || err.Error() != "permission_policy cannot be used with a can_use_tool callback" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewClient_InvalidPermissionPolicy(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath("/bin/echo").
+		WithPermissionPolicy(types.PermissionPolicy{DefaultBehavior: types.PermissionBehaviorAsk})
+
+	if _, err := NewClient(context.Background(), opts); err == nil {
+		t.Error("expected error for ask default behavior")
+	}
+}
+
+func TestNewClient_PermissionPolicyInstalled(t *testing.T) {
+	cwd := t.TempDir()
+	opts := types.NewClaudeAgentOptions().
+		WithCWD(cwd).
+		WithPermissionPolicy(types.PermissionPolicy{
+			AllowTools:          []string{"Read", "Write"},
+			DenyPathsOutsideCWD: true,
+		})
+
+	client, err := NewClientWithTransport(context.Background(), opts, &unusedTransport{})
+	if err != nil {
+		t.Fatalf("NewClientWithTransport failed: %v", err)
+	}
+	if opts.CanUseTool != nil {
+		t.Error("caller's options were modified")
+	}
+
+	canUseTool := client.options.CanUseTool
+	if canUseTool == nil {
+		t.Fatal("policy was not installed as CanUseTool")
+	}
+	if client.options.PermissionPromptToolName == nil || *client.options.PermissionPromptToolName != "stdio" {
+		t.Error("permission prompts not routed over stdio")
+	}
+
+	tests := []struct {
+		tool  string
+		input map[string]interface{}
+		want  string
+	}{
+		{"Read", map[string]interface{}{"file_path": filepath.Join(cwd, "main.go")}, "allow"},
+		{"Write", map[string]interface{}{"file_path": "relative/main.go"}, "allow"},
+		{"Write", map[string]interface{}{"file_path": filepath.Join(filepath.Dir(cwd), "other.go")}, "deny"},
+		{"Bash", map[string]interface{}{"command": "ls"}, "deny"},
+	}
+	for _, tt := range tests {
+		result, err := canUseTool(context.Background(), tt.tool, tt.input, types.ToolPermissionContext{})
+		if err != nil {
+			t.Fatalf("CanUseTool(%s) failed: %v", tt.tool, err)
+		}
+		if got := result.GetBehavior(); got != tt.want {
+			t.Errorf("CanUseTool(%s, %v) = %s, want %s", tt.tool, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestQuery_InvalidPermissionPolicy(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath("/bin/echo").
+		WithPermissionPolicy(types.PermissionPolicy{DefaultBehavior: types.PermissionBehaviorAsk})
+
+	if _, err := Query(context.Background(), "hi", opts); err == nil {
+		t.Error("expected error for ask default behavior")
+	}
+}
+
+// TestQuery_PermissionPolicyApplied tests that a one-shot query answers the
+// CLI's permission requests from the policy.
+func TestQuery_PermissionPolicyApplied(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"control_request","request_id":"perm_1","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"rm -rf /"}}}`),
+		mockcli.AwaitResponse("perm_1"),
+		mockcli.Send(streamResult),
+	}})
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithPermissionPolicy(types.PermissionPolicy{AllowTools: []string{"Read"}}).
+		WithStrictProtocol(true)
+
+	messages, err := Query(ctx, "clean up", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range messages {
+	}
+
+	received := cli.Received()
+	if len(received) == 0 {
+		t.Fatal("CLI received nothing")
+	}
+	data := []byte(received[len(received)-1])
+	var frame struct {
+		Response struct {
+			RequestID string                 `json:"request_id"`
+			Response  map[string]interface{} `json:"response"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(data, &frame); err != nil {
+		t.Fatalf("decode permission response %s: %v", data, err)
+	}
+	if frame.Response.RequestID != "perm_1" || frame.Response.Response["behavior"] != "deny" {
+		t.Errorf("permission response = %s, want perm_1 denied", data)
+	}
+}
@@ -0,0 +1,239 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// WarmupFunc prepares a pooled client right after it connects, for example
+// by running a priming turn that loads an expensive system prompt or project
+// context, so that requests served by the client start warm. It must leave
+// the client between turns: drain every response it starts.
+type WarmupFunc func(ctx context.Context, c *Client) error
+
+// WarmupPrompt returns a WarmupFunc that runs prompt as one turn with
+// RunTurn. A turn ending with an error result fails the warmup.
+func WarmupPrompt(prompt string) WarmupFunc {
+	return func(ctx context.Context, c *Client) error {
+		turn, err := c.RunTurn(ctx, prompt)
+		if err != nil {
+			return err
+		}
+		if turn.IsError() {
+			return fmt.Errorf("priming turn ended with an error result (%s)", turn.Result.Subtype)
+		}
+		return nil
+	}
+}
+
+// PoolConfig configures a Pool.
+type PoolConfig struct {
+	// Size is the most clients the pool holds, checked out or idle. It must
+	// be at least 1.
+	Size int
+
+	// Options are the options every pooled client is created with (nil uses
+	// defaults). They are copied by NewPool.
+	Options *types.ClaudeAgentOptions
+
+	// Warmup, if set, runs once for each client after Connect, before the
+	// client is handed out. It runs again for the new client that replaces
+	// one found unhealthy, so a reconnected session is warm too.
+	Warmup WarmupFunc
+}
+
+// Pool keeps connected, warmed-up clients for reuse, so that a request does
+// not pay for starting the CLI and priming the session. It is safe for
+// concurrent use.
+//
+// Get hands out an idle client, or connects and warms a new one while fewer
+// than Size exist, and otherwise waits for a Put. A client whose warmup
+// failed is closed and never handed out. An idle client that is no longer
+// connected, for example because its CLI exited, is closed on Get and
+// replaced by a newly connected and warmed one.
+//
+// The session's conversation carries over between users of a client: the
+// pool is for sharing a primed context, not for isolating requests.
+//
+// Example:
+//
+//	pool, err := claude.NewPool(ctx, claude.PoolConfig{
+//	    Size:    4,
+//	    Options: opts,
+//	    Warmup:  claude.WarmupPrompt("Read docs/ARCHITECTURE.md. Reply OK."),
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer pool.Close(ctx)
+//
+//	client, err := pool.Get(ctx)
+//	if err != nil {
+//	    return err
+//	}
+//	defer pool.Put(client)
+//	turn, err := client.RunTurn(ctx, userPrompt)
+type Pool struct {
+	ctx    context.Context
+	config PoolConfig
+
+	tokens chan struct{} // one per client a caller may hold
+
+	mu     sync.Mutex
+	idle   []*Client
+	closed bool
+}
+
+// NewPool creates a pool of clients that live until ctx is done or the pool
+// is closed. It does not connect any client; call Fill to warm the pool
+// ahead of the first Get.
+func NewPool(ctx context.Context, config PoolConfig) (*Pool, error) {
+	if config.Size < 1 {
+		return nil, fmt.Errorf("pool size must be at least 1, got %d", config.Size)
+	}
+	if config.Options == nil {
+		config.Options = types.NewClaudeAgentOptions()
+	} else {
+		config.Options = config.Options.Clone()
+	}
+
+	return &Pool{
+		ctx:    ctx,
+		config: config,
+		tokens: make(chan struct{}, config.Size),
+	}, nil
+}
+
+// Get returns a connected, warmed-up client, connecting a new one if no idle
+// client is available and fewer than Size exist. It waits for a Put while
+// Size clients are checked out, until ctx is done.
+//
+// Return the client with Put once its turn has finished. Get returns a
+// WarmupError if a new client's warmup failed, and a CLIConnectionError once
+// the pool is closed.
+func (p *Pool) Get(ctx context.Context) (*Client, error) {
+	select {
+	case p.tokens <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c, err := p.take(ctx)
+	if err != nil {
+		<-p.tokens
+		return nil, err
+	}
+	return c, nil
+}
+
+// take returns a healthy idle client, or a new one.
+func (p *Pool) take(ctx context.Context) (*Client, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, types.NewCLIConnectionError("client pool is closed")
+		}
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			return p.connect(ctx)
+		}
+		c := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if healthy(c) {
+			return c, nil
+		}
+		_ = c.Close(ctx)
+	}
+}
+
+// connect creates, connects, and warms up a new client.
+func (p *Pool) connect(ctx context.Context) (*Client, error) {
+	c, err := NewClient(p.ctx, p.config.Options)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Connect(ctx); err != nil {
+		_ = c.Close(ctx)
+		return nil, err
+	}
+
+	if p.config.Warmup != nil {
+		start := time.Now()
+		err := p.config.Warmup(ctx, c)
+		recordWarmup(p.config.Options, start, err)
+		if err != nil {
+			_ = c.Close(ctx)
+			return nil, types.NewWarmupError(err)
+		}
+	}
+	return c, nil
+}
+
+// healthy reports whether a pooled client can still serve turns.
+func healthy(c *Client) bool {
+	return c.IsConnected() && c.Err() == nil
+}
+
+// Put returns a client obtained from Get to the pool. The client must be
+// between turns. A client that is no longer connected, or that comes back
+// after Close, is closed instead of kept.
+func (p *Pool) Put(c *Client) {
+	defer func() { <-p.tokens }()
+
+	p.mu.Lock()
+	if !p.closed && healthy(c) {
+		p.idle = append(p.idle, c)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	_ = c.Close(context.Background())
+}
+
+// Fill connects and warms up clients until the pool holds Size of them, so
+// that the first requests do not wait for warmup. Call it before handing
+// out clients: it waits for every checked-out client to be returned. Clients
+// warmed before an error are kept.
+func (p *Pool) Fill(ctx context.Context) error {
+	clients := make([]*Client, 0, p.config.Size)
+	defer func() {
+		for _, c := range clients {
+			p.Put(c)
+		}
+	}()
+
+	for i := 0; i < p.config.Size; i++ {
+		c, err := p.Get(ctx)
+		if err != nil {
+			return err
+		}
+		clients = append(clients, c)
+	}
+	return nil
+}
+
+// Close closes the idle clients and stops the pool: Get fails afterwards
+// and clients returned with Put are closed. It returns the first error from
+// closing a client.
+func (p *Pool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	var first error
+	for _, c := range idle {
+		if err := c.Close(ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
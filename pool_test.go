@@ -0,0 +1,224 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// durationSink is a MetricsSink recording only duration observations.
+type durationSink struct {
+	mu       sync.Mutex
+	outcomes map[string][]string // metric name to "outcome" labels
+}
+
+func (s *durationSink) IncCounter(string, float64, map[string]string) {}
+func (s *durationSink) AddGauge(string, float64, map[string]string)   {}
+
+func (s *durationSink) ObserveDuration(name string, _ time.Duration, labels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.outcomes == nil {
+		s.outcomes = make(map[string][]string)
+	}
+	s.outcomes[name] = append(s.outcomes[name], labels["outcome"])
+}
+
+func (s *durationSink) observed(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.outcomes[name]...)
+}
+
+// newEchoPool creates a pool of clients backed by the returned echo CLI.
+func newEchoPool(t *testing.T, ctx context.Context, size int, warmup WarmupFunc, sink types.MetricsSink) (*Pool, *mockcli.CLI) {
+	t.Helper()
+
+	cli := echoCLI(t, "")
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+	if sink != nil {
+		opts = opts.WithMetricsSink(sink)
+	}
+	pool, err := NewPool(ctx, PoolConfig{Size: size, Options: opts, Warmup: warmup})
+	if err != nil {
+		t.Fatalf("NewPool failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = pool.Close(context.Background())
+	})
+	return pool, cli
+}
+
+// loggedPrompts returns the prompts the echo CLI received, in order.
+func loggedPrompts(cli *mockcli.CLI) []string {
+	var prompts []string
+	for _, line := range cli.Received() {
+		if !strings.Contains(line, `"type":"user"`) {
+			continue
+		}
+		switch {
+		case strings.Contains(line, "PRIME"):
+			prompts = append(prompts, "PRIME")
+		case strings.Contains(line, "USER"):
+			prompts = append(prompts, "USER")
+		default:
+			prompts = append(prompts, line)
+		}
+	}
+	return prompts
+}
+
+func TestPool_WarmupBeforeUserPrompt(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sink := &durationSink{}
+	pool, cli := newEchoPool(t, ctx, 1, WarmupPrompt("PRIME the session"), sink)
+
+	client, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if _, err := client.RunTurn(ctx, "USER request"); err != nil {
+		t.Fatalf("RunTurn failed: %v", err)
+	}
+	pool.Put(client)
+
+	// The idle client is reused without another warmup
+	again, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("second Get failed: %v", err)
+	}
+	if again != client {
+		t.Error("expected the idle client to be reused")
+	}
+	if _, err := again.RunTurn(ctx, "USER follow-up"); err != nil {
+		t.Fatalf("RunTurn failed: %v", err)
+	}
+	pool.Put(again)
+
+	if got, want := strings.Join(loggedPrompts(cli), ","), "PRIME,USER,USER"; got != want {
+		t.Errorf("CLI received prompts %s, want %s", got, want)
+	}
+	if got := sink.observed(types.MetricWarmupDuration); len(got) != 1 || got[0] != "success" {
+		t.Errorf("warmup durations = %v, want one success", got)
+	}
+}
+
+func TestPool_WarmupFailureNotHandedOut(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var warmed []*Client
+	failWarmup := errors.New("context files missing")
+	sink := &durationSink{}
+	pool, _ := newEchoPool(t, ctx, 1, func(ctx context.Context, c *Client) error {
+		warmed = append(warmed, c)
+		return failWarmup
+	}, sink)
+
+	client, err := pool.Get(ctx)
+	if client != nil {
+		t.Error("expected no client after a failed warmup")
+	}
+	if !types.IsWarmupError(err) || !errors.Is(err, failWarmup) {
+		t.Fatalf("expected WarmupError wrapping the warmup error, got %v", err)
+	}
+	if len(warmed) != 1 || warmed[0].IsConnected() {
+		t.Error("expected the client that failed warmup to be closed")
+	}
+	if got := sink.observed(types.MetricWarmupDuration); len(got) != 1 || got[0] != "error" {
+		t.Errorf("warmup durations = %v, want one error", got)
+	}
+
+	// The failed attempt gave its slot back
+	if _, err := pool.Get(ctx); !types.IsWarmupError(err) {
+		t.Fatalf("expected a second warmup attempt, got %v", err)
+	}
+	if len(warmed) != 2 {
+		t.Errorf("ran %d warmups, want 2", len(warmed))
+	}
+}
+
+func TestPool_RewarmsReplacementClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var warmups atomic.Int32
+	prime := WarmupPrompt("PRIME the session")
+	pool, cli := newEchoPool(t, ctx, 1, func(ctx context.Context, c *Client) error {
+		warmups.Add(1)
+		return prime(ctx, c)
+	}, nil)
+
+	if err := pool.Fill(ctx); err != nil {
+		t.Fatalf("Fill failed: %v", err)
+	}
+	client, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	// The session breaks while checked out; Put drops it
+	_ = client.Close(ctx)
+	pool.Put(client)
+
+	replacement, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get after reconnect failed: %v", err)
+	}
+	if replacement == client {
+		t.Fatal("expected a new client to replace the closed one")
+	}
+	if _, err := replacement.RunTurn(ctx, "USER request"); err != nil {
+		t.Fatalf("RunTurn failed: %v", err)
+	}
+	pool.Put(replacement)
+
+	if got := warmups.Load(); got != 2 {
+		t.Errorf("ran %d warmups, want 2", got)
+	}
+	if got, want := strings.Join(loggedPrompts(cli), ","), "PRIME,PRIME,USER"; got != want {
+		t.Errorf("CLI received prompts %s, want %s", got, want)
+	}
+}
+
+func TestPool_SizeAndClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := NewPool(ctx, PoolConfig{}); err == nil {
+		t.Error("expected an error for a pool of size 0")
+	}
+
+	pool, _ := newEchoPool(t, ctx, 1, nil, nil)
+	client, err := pool.Get(ctx)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	// The only client is checked out, so Get waits
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer waitCancel()
+	if _, err := pool.Get(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Get to wait for a Put, got %v", err)
+	}
+
+	if err := pool.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	pool.Put(client)
+	if client.IsConnected() {
+		t.Error("expected a client returned after Close to be closed")
+	}
+	if _, err := pool.Get(ctx); !types.IsCLIConnectionError(err) {
+		t.Errorf("expected CLIConnectionError from a closed pool, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Handlers are the callbacks Client.Process invokes while it drives a turn.
+// Any of them may be nil, in which case that kind of content is skipped.
+//
+// Handlers run on the goroutine that called Process, one at a time and in the
+// order the content arrives. A handler that returns an error aborts the turn:
+// Process interrupts the CLI, stops invoking handlers, drains the rest of the
+// turn, and returns the error.
+type Handlers struct {
+	// OnText receives each text block of the assistant's replies.
+	OnText func(text string) error
+
+	// OnThinking receives each thinking block of the assistant's replies.
+	OnThinking func(thinking string) error
+
+	// OnToolUse receives each tool invocation made by the assistant.
+	OnToolUse func(block *types.ToolUseBlock) error
+
+	// OnToolResult receives each tool result reported back to the assistant.
+	OnToolResult func(block *types.ToolResultBlock) error
+
+	// OnSystem receives system messages, including the ones the SDK emits
+	// for parse errors, transport failures, and timeouts.
+	OnSystem func(msg *types.SystemMessage) error
+}
+
+// Process sends prompt and drives the resulting turn to completion, invoking
+// handlers for its content, and returns the ResultMessage that ends it.
+// Process consumes the whole turn, so do not call ReceiveResponse for it.
+//
+// If a handler returns an error, Process interrupts the CLI, waits for the turn
+// to end, and returns the handler's error together with the result, if any.
+// If the turn ends without a ResultMessage, Process returns ctx's error, the
+// transport error, or an error saying the response ended early.
+//
+// Example:
+//
+//	result, err := client.Process(ctx, "Summarize README.md", claude.Handlers{
+//	    OnText: func(text string) error {
+//	        fmt.Print(text)
+//	        return nil
+//	    },
+//	    OnToolUse: func(block *types.ToolUseBlock) error {
+//	        log.Printf("tool: %s", block.Name)
+//	        return nil
+//	    },
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Printf("\nCost: $%.4f\n", *result.TotalCostUSD)
+func (c *Client) Process(ctx context.Context, prompt string, handlers Handlers) (*types.ResultMessage, error) {
+	if err := c.Query(ctx, prompt); err != nil {
+		return nil, err
+	}
+
+	var (
+		result      *types.ResultMessage
+		handlerErr  error
+		interrupted chan struct{}
+	)
+	for msg := range c.ReceiveResponse(ctx) {
+		if m, ok := msg.(*types.ResultMessage); ok {
+			result = m
+			continue
+		}
+		if handlerErr != nil {
+			continue
+		}
+		if handlerErr = handlers.dispatch(msg); handlerErr != nil {
+			// Interrupt in the background: its acknowledgement is read by the
+			// same loop that feeds this channel, which must keep draining
+			interrupted = make(chan struct{})
+			c.goLabeled(func() {
+				defer close(interrupted)
+				// The turn still ends with a result if the interrupt fails
+				if err := c.Interrupt(ctx); err != nil && c.options.Logger != nil {
+					c.options.Logger.Debug("interrupt after handler error failed", "error", err)
+				}
+			})
+		}
+	}
+	if interrupted != nil {
+		select {
+		case <-interrupted:
+		case <-ctx.Done():
+		}
+	}
+
+	if handlerErr != nil {
+		return result, handlerErr
+	}
+	if result != nil {
+		return result, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("response ended without a result message")
+}
+
+// dispatch invokes the handlers for one message's content, in order, stopping
+// at the first error.
+func (h *Handlers) dispatch(msg types.Message) error {
+	switch m := msg.(type) {
+	case *types.AssistantMessage:
+		for _, block := range m.Content {
+			if err := h.block(block); err != nil {
+				return err
+			}
+		}
+	case *types.UserMessage:
+		if h.OnToolResult == nil {
+			return nil
+		}
+		blocks, ok := m.Content.([]types.ContentBlock)
+		if !ok {
+			return nil
+		}
+		for _, block := range blocks {
+			if tr, ok := block.(*types.ToolResultBlock); ok {
+				if err := h.OnToolResult(tr); err != nil {
+					return err
+				}
+			}
+		}
+	case *types.SystemMessage:
+		if h.OnSystem != nil {
+			return h.OnSystem(m)
+		}
+	}
+	return nil
+}
+
+// block invokes the handler for one assistant content block.
+func (h *Handlers) block(block types.ContentBlock) error {
+	switch b := block.(type) {
+	case *types.TextBlock:
+		if h.OnText != nil {
+			return h.OnText(b.Text)
+		}
+	case *types.ThinkingBlock:
+		if h.OnThinking != nil {
+			return h.OnThinking(b.Thinking)
+		}
+	case *types.ToolUseBlock:
+		if h.OnToolUse != nil {
+			return h.OnToolUse(b)
+		}
+	case *types.ToolResultBlock:
+		if h.OnToolResult != nil {
+			return h.OnToolResult(b)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// recordingHandlers returns Handlers that append one entry per call to events.
+func recordingHandlers(events *[]string) Handlers {
+	return Handlers{
+		OnText: func(text string) error {
+			*events = append(*events, "text:"+text)
+			return nil
+		},
+		OnThinking: func(thinking string) error {
+			*events = append(*events, "thinking:"+thinking)
+			return nil
+		},
+		OnToolUse: func(block *types.ToolUseBlock) error {
+			*events = append(*events, "tool_use:"+block.Name)
+			return nil
+		},
+		OnToolResult: func(block *types.ToolResultBlock) error {
+			*events = append(*events, "tool_result:"+block.ToolUseID)
+			return nil
+		},
+		OnSystem: func(msg *types.SystemMessage) error {
+			*events = append(*events, "system:"+msg.Subtype)
+			return nil
+		},
+	}
+}
+
+func TestClient_Process(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx,
+		`{"type":"system","subtype":"init","data":{}}`,
+		`{"type":"assistant","message":{"model":"m","content":[{"type":"thinking","thinking":"hmm","signature":"s"},{"type":"text","text":"Let me look"},{"type":"tool_use","id":"t1","name":"Read","input":{}}]}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok"}]}}`,
+		`{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"Done"}]}}`,
+		streamResult,
+	)
+
+	var events []string
+	result, err := client.Process(ctx, "hi", recordingHandlers(&events))
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if result == nil || result.SessionID != "s" {
+		t.Fatalf("result = %+v, want the ResultMessage", result)
+	}
+
+	want := []string{"system:init", "thinking:hmm", "text:Let me look", "tool_use:Read", "tool_result:t1", "text:Done"}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestClient_ProcessNilHandlers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx, streamAssistant, streamResult)
+
+	var texts []string
+	result, err := client.Process(ctx, "hi", Handlers{
+		OnText: func(text string) error {
+			texts = append(texts, text)
+			return nil
+		},
+	})
+	if err != nil || result == nil {
+		t.Fatalf("Process = %v, %v, want a result", result, err)
+	}
+	if len(texts) != 1 || texts[0] != "ok" {
+		t.Errorf("texts = %v, want [ok]", texts)
+	}
+
+	// The client is ready for the next turn
+	if err := client.Query(ctx, "again"); err != nil {
+		t.Errorf("Query after Process failed: %v", err)
+	}
+}
+
+func TestClient_ProcessHandlerErrorInterrupts(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// After the first message the CLI waits for the interrupt, acknowledges
+	// it, and sends one more message before the result
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"first"},{"type":"tool_use","id":"t1","name":"Bash","input":{}}]}}`),
+		mockcli.AwaitRequest("interrupt"),
+		mockcli.Send(
+			`{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"after"}]}}`,
+			streamResult,
+		),
+	}})
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	errStop := errors.New("stop")
+	var events []string
+	handlers := recordingHandlers(&events)
+	handlers.OnToolUse = func(block *types.ToolUseBlock) error {
+		events = append(events, "tool_use:"+block.Name)
+		return errStop
+	}
+
+	result, err := client.Process(ctx, "hi", handlers)
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Process error = %v, want the handler error", err)
+	}
+	if result == nil {
+		t.Error("Process did not return the result that ended the interrupted turn")
+	}
+
+	// Handlers stop at the error; later content is drained, not delivered
+	if want := []string{"text:first", "tool_use:Bash"}; strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+	// Initialize, the prompt, then the interrupt
+	received := cli.Received()
+	if len(received) != 3 {
+		t.Fatalf("CLI received %q, want 3 lines", received)
+	}
+	if request := received[2]; !strings.Contains(request, `"subtype":"interrupt"`) {
+		t.Errorf("request after the handler error = %s, want an interrupt", request)
+	}
+}
+
+func TestClient_ProcessNoResult(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The CLI exits after one message
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(streamAssistant),
+		mockcli.Exit(0),
+	}})
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	result, err := client.Process(ctx, "hi", Handlers{})
+	if err == nil || result != nil {
+		t.Errorf("Process = %v, %v, want an error and no result", result, err)
+	}
+}
+
+func TestClient_ProcessNotConnected(t *testing.T) {
+	client, err := NewClientWithTransport(context.Background(), nil, &unusedTransport{t: t})
+	if err != nil {
+		t.Fatalf("NewClientWithTransport failed: %v", err)
+	}
+	if _, err := client.Process(context.Background(), "hi", Handlers{}); !types.IsCLIConnectionError(err) {
+		t.Errorf("Process error = %v, want CLIConnectionError", err)
+	}
+}
@@ -0,0 +1,141 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// supportedImageTypes are the media types the CLI accepts for ImageBlock.
+var supportedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// userMessageLine builds the stream-json line for a user message, validating
+// its content and filling in block types. A message without a session ID is
+// sent in sessionID.
+func userMessageLine(msg *types.UserMessage, sessionID string) (string, error) {
+	wireContent, err := wireContent(msg.Content)
+	if err != nil {
+		return "", err
+	}
+
+	wire := *msg
+	wire.Content = wireContent
+	if wire.SessionID == "" {
+		wire.SessionID = sessionID
+	}
+
+	data, err := json.Marshal(wire)
+	if err != nil {
+		return "", types.NewControlProtocolErrorWithCause("failed to marshal query", err)
+	}
+	return string(data), nil
+}
+
+// wireContent validates prompt content and fills in block types that callers
+// may have left empty.
+func wireContent(content interface{}) (interface{}, error) {
+	switch c := content.(type) {
+	case string:
+		if c == "" {
+			return nil, fmt.Errorf("prompt cannot be empty")
+		}
+		return c, nil
+	case []types.ContentBlock:
+		if len(c) == 0 {
+			return nil, fmt.Errorf("prompt content cannot be empty")
+		}
+		blocks := make([]types.ContentBlock, len(c))
+		for i, block := range c {
+			b, err := wireBlock(block)
+			if err != nil {
+				return nil, fmt.Errorf("prompt content block %d: %w", i, err)
+			}
+			blocks[i] = b
+		}
+		return blocks, nil
+	default:
+		return nil, fmt.Errorf("prompt content must be a string or []types.ContentBlock, got %T", content)
+	}
+}
+
+// wireBlock returns block with its type set, rejecting blocks the CLI cannot accept.
+func wireBlock(block types.ContentBlock) (types.ContentBlock, error) {
+	switch b := block.(type) {
+	case *types.TextBlock:
+		if b == nil {
+			break
+		}
+		c := *b
+		c.Type = types.BlockTypeText
+		return &c, nil
+	case *types.ImageBlock:
+		if b == nil {
+			break
+		}
+		if b.Source.Data == "" {
+			return nil, fmt.Errorf("image block has no data")
+		}
+		if !supportedImageTypes[b.Source.MediaType] {
+			return nil, fmt.Errorf("unsupported image media type %q", b.Source.MediaType)
+		}
+		return b, nil
+	case *types.ToolResultBlock:
+		if b == nil {
+			break
+		}
+		c := *b
+		c.Type = types.BlockTypeToolResult
+		return &c, nil
+	case *types.ToolUseBlock:
+		if b == nil {
+			break
+		}
+		c := *b
+		c.Type = types.BlockTypeToolUse
+		return &c, nil
+	case *types.ThinkingBlock:
+		if b == nil {
+			break
+		}
+		c := *b
+		c.Type = types.BlockTypeThinking
+		return &c, nil
+	case nil:
+	default:
+		return block, nil
+	}
+	return nil, fmt.Errorf("nil content block")
+}
+
+// promptText returns the text of prompt content for size estimation. Images
+// and other non-text blocks are not counted.
+func promptText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []types.ContentBlock:
+		var b strings.Builder
+		for _, block := range c {
+			switch blk := block.(type) {
+			case *types.TextBlock:
+				if blk != nil {
+					b.WriteString(blk.Text)
+				}
+			case *types.ToolResultBlock:
+				if blk != nil {
+					text, _ := blk.Text()
+					b.WriteString(text)
+				}
+			}
+		}
+		return b.String()
+	}
+	return ""
+}
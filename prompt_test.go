@@ -0,0 +1,171 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestUserMessageLine_String(t *testing.T) {
+	line, err := userMessageLine(types.NewUserMessage("hello"), "default")
+	if err != nil {
+		t.Fatalf("userMessageLine failed: %v", err)
+	}
+
+	want := `{"type":"user","message":{"role":"user","content":"hello"},"parent_tool_use_id":null,"session_id":"default"}`
+	if line != want {
+		t.Errorf("line = %s\nwant   %s", line, want)
+	}
+}
+
+func TestUserMessageLine_SessionID(t *testing.T) {
+	line, err := userMessageLine(types.NewUserMessage("hello", types.WithSessionID("review-42")), "default")
+	if err != nil {
+		t.Fatalf("userMessageLine failed: %v", err)
+	}
+
+	want := `{"type":"user","message":{"role":"user","content":"hello"},"parent_tool_use_id":null,"session_id":"review-42"}`
+	if line != want {
+		t.Errorf("line = %s\nwant   %s", line, want)
+	}
+}
+
+func TestUserMessageLine_Blocks(t *testing.T) {
+	parent := "toolu_task_1"
+	line, err := userMessageLine(types.NewUserMessage([]types.ContentBlock{
+		&types.TextBlock{Text: "Describe this image"}, // Type filled in
+		types.NewImageBlock("image/png", []byte{0x89, 'P', 'N', 'G'}),
+		&types.ToolResultBlock{ToolUseID: "toolu_1", Content: "done"},
+	}, types.WithParentToolUseID(parent)), "default")
+	if err != nil {
+		t.Fatalf("userMessageLine failed: %v", err)
+	}
+
+	var msg struct {
+		Type    string `json:"type"`
+		Message struct {
+			Role    string                   `json:"role"`
+			Content []map[string]interface{} `json:"content"`
+		} `json:"message"`
+		ParentToolUseID string `json:"parent_tool_use_id"`
+	}
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		t.Fatalf("invalid JSON %s: %v", line, err)
+	}
+
+	if msg.Type != "user" || msg.Message.Role != "user" || msg.ParentToolUseID != parent {
+		t.Errorf("unexpected envelope: %s", line)
+	}
+	if len(msg.Message.Content) != 3 {
+		t.Fatalf("expected 3 content blocks, got %s", line)
+	}
+	if text := msg.Message.Content[0]; text["type"] != "text" || text["text"] != "Describe this image" {
+		t.Errorf("text block = %v", text)
+	}
+	image := msg.Message.Content[1]
+	source, _ := image["source"].(map[string]interface{})
+	if image["type"] != "image" || source["type"] != "base64" || source["media_type"] != "image/png" || source["data"] != "iVBORw==" {
+		t.Errorf("image block = %v", image)
+	}
+	if result := msg.Message.Content[2]; result["type"] != "tool_result" || result["tool_use_id"] != "toolu_1" {
+		t.Errorf("tool result block = %v", result)
+	}
+}
+
+func TestUserMessageLine_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content interface{}
+		wantErr string
+	}{
+		{"empty string", "", "prompt cannot be empty"},
+		{"no blocks", []types.ContentBlock{}, "prompt content cannot be empty"},
+		{"nil block", []types.ContentBlock{nil}, "nil content block"},
+		{"typed nil block", []types.ContentBlock{(*types.TextBlock)(nil)}, "nil content block"},
+		{"unsupported media type", []types.ContentBlock{types.NewImageBlock("image/tiff", []byte{1})}, `unsupported image media type "image/tiff"`},
+		{"empty image", []types.ContentBlock{&types.ImageBlock{Source: types.ImageSource{MediaType: "image/png"}}}, "image block has no data"},
+		{"wrong type", 42, "prompt content must be a string or []types.ContentBlock, got int"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := userMessageLine(types.NewUserMessage(tt.content), "default")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_QueryWithContent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(streamResult),
+	}})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	err = client.QueryWithContent(ctx, []types.ContentBlock{
+		types.NewTextBlock("What is in this picture?"),
+		types.NewImageBlock("image/jpeg", []byte("jpeg-bytes")),
+	})
+	if err != nil {
+		t.Fatalf("QueryWithContent failed: %v", err)
+	}
+	for range client.ReceiveResponse(ctx) {
+	}
+
+	// The prompt follows the initialize request
+	received := cli.Received()
+	if len(received) != 2 {
+		t.Fatalf("CLI received %q, want initialize and the prompt", received)
+	}
+	want := `{"type":"user","message":{"role":"user","content":[{"type":"text","text":"What is in this picture?"},{"type":"image","source":{"type":"base64","media_type":"image/jpeg","data":"anBlZy1ieXRlcw=="}}]},"parent_tool_use_id":null,"session_id":"default"}`
+	if got := received[1]; got != want {
+		t.Errorf("prompt line = %s\nwant          %s", got, want)
+	}
+}
+
+func TestClient_QueryWithMessageNil(t *testing.T) {
+	client, err := NewClient(context.Background(), types.NewClaudeAgentOptions().WithCLIPath(writeScriptedCLI(t)))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.QueryWithMessage(context.Background(), nil); err == nil {
+		t.Error("expected error for nil message")
+	}
+}
+
+func TestQueryWithMessages_Validation(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().WithCLIPath("/nonexistent/claude")
+
+	if _, err := QueryWithMessages(context.Background(), nil, opts); err == nil {
+		t.Error("expected error for no messages")
+	}
+	if _, err := QueryWithMessages(context.Background(), []*types.UserMessage{nil}, opts); err == nil {
+		t.Error("expected error for nil message")
+	}
+
+	// The size limit covers the text of every message, not just the last one
+	messages := []*types.UserMessage{
+		{Content: strings.Repeat("word ", 80)},
+		{Content: []types.ContentBlock{types.NewTextBlock(strings.Repeat("word ", 80))}},
+	}
+	if _, err := QueryWithMessages(context.Background(), messages, opts.WithMaxPromptTokens(150)); !types.IsPromptTooLargeError(err) {
+		t.Errorf("expected PromptTooLargeError, got %v", err)
+	}
+}
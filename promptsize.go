@@ -0,0 +1,20 @@
+package claude
+
+import "github.com/schlunsen/claude-agent-sdk-go/types"
+
+// checkPromptSize enforces options.MaxPromptTokens using the approximate
+// token estimate for the configured model.
+func checkPromptSize(options *types.ClaudeAgentOptions, prompt string) error {
+	if options.MaxPromptTokens == nil {
+		return nil
+	}
+
+	model := ""
+	if options.Model != nil {
+		model = *options.Model
+	}
+	if estimate := types.EstimateTokensForModel(model, prompt); estimate > *options.MaxPromptTokens {
+		return types.NewPromptTooLargeError(estimate, *options.MaxPromptTokens)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// unusedTransport fails the test if the SDK tries to use it.
+type unusedTransport struct {
+	Transport
+	t *testing.T
+}
+
+func (u *unusedTransport) Connect(ctx context.Context) error {
+	u.t.Error("transport connected for an oversized prompt")
+	return nil
+}
+
+func TestQuery_PromptTooLarge(t *testing.T) {
+	prompt := strings.Repeat("word ", 1000) // About 1250 tokens
+
+	// The CLI path does not exist, so reaching the spawn would fail differently
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath("/nonexistent/claude").
+		WithMaxPromptTokens(1000)
+	_, err := Query(context.Background(), prompt, opts)
+	if !types.IsPromptTooLargeError(err) {
+		t.Fatalf("expected PromptTooLargeError, got %v", err)
+	}
+
+	var tooLarge *types.PromptTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.EstimatedTokens != 1250 || tooLarge.MaxTokens != 1000 {
+		t.Errorf("error = %+v, want estimate 1250 and limit 1000", tooLarge)
+	}
+
+	if _, err := QueryWithTransport(context.Background(), prompt, opts, &unusedTransport{t: t}); !types.IsPromptTooLargeError(err) {
+		t.Errorf("QueryWithTransport: expected PromptTooLargeError, got %v", err)
+	}
+}
+
+func TestClient_QueryPromptTooLarge(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The scripted CLI answers the first prompt it reads, so an oversized
+	// prompt that slipped through would show up as a response to the next one
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeScriptedCLI(t,
+			`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":1,"session_id":"s1"}`,
+		)).
+		WithModel("claude-sonnet-4-5").
+		WithMaxPromptTokens(100)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if err := client.Query(ctx, strings.Repeat("word ", 100)); !types.IsPromptTooLargeError(err) {
+		t.Fatalf("expected PromptTooLargeError, got %v", err)
+	}
+
+	// A prompt within the limit still goes through
+	if err := client.Query(ctx, "hello"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range client.ReceiveResponse(ctx) {
+	}
+}
@@ -0,0 +1,44 @@
+package claude
+
+import (
+	"context"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Querier is the conversational surface of Client: send a prompt, then drain
+// the response. Application code that depends on Querier instead of *Client
+// can be tested with claudetest.FakeClaude, without the CLI or network access.
+//
+// Example:
+//
+//	type Support struct {
+//	    Claude claude.Querier
+//	}
+//
+//	func (s *Support) Answer(ctx context.Context, question string) (string, error) {
+//	    if err := s.Claude.Query(ctx, question); err != nil {
+//	        return "", err
+//	    }
+//	    var answer string
+//	    for msg := range s.Claude.ReceiveResponse(ctx) {
+//	        if result, ok := msg.(*types.ResultMessage); ok && result.Result != nil {
+//	            answer = *result.Result
+//	        }
+//	    }
+//	    return answer, nil
+//	}
+type Querier interface {
+	// Query sends a prompt to Claude.
+	Query(ctx context.Context, prompt string) error
+
+	// ReceiveResponse returns the messages for the last prompt. The channel is
+	// closed after the ResultMessage.
+	ReceiveResponse(ctx context.Context) <-chan types.Message
+
+	// Close ends the session and releases its resources.
+	Close(ctx context.Context) error
+}
+
+// Verify Client implements Querier
+var _ Querier = (*Client)(nil)
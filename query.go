@@ -2,20 +2,24 @@ package claude
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/schlunsen/claude-agent-sdk-go/internal"
-	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
-// Query executes a single Claude query in non-streaming mode and returns a channel of messages.
+// Query executes a single Claude query and returns a channel of messages.
 // This is the simplest way to interact with Claude for one-off questions or batch processing.
 //
 // The function:
-//   - Finds and connects to Claude Code CLI
-//   - Sends the prompt in non-streaming mode (--print flag)
+//   - Finds and connects to Claude Code CLI, which always runs with
+//     --input-format=stream-json --output-format=stream-json --verbose
+//   - Uses streaming mode with the control protocol when a permission
+//     callback or policy, hooks, tool result screening or tool interceptors
+//     are set, and registers them with the CLI before the prompt
+//   - Sends the prompt as stream-json user messages on the CLI's stdin
 //   - Streams response messages to the returned channel
 //   - Automatically cleans up resources when done
 //
@@ -23,10 +27,23 @@ import (
 //   - All messages have been received (including the final ResultMessage)
 //   - An error occurs
 //   - The context is cancelled
+//   - A message goes unread for the consumer timeout (see WithConsumerTimeout)
+//
+// To stop reading before the channel closes, cancel ctx: the CLI is stopped and
+// every goroutine started by Query exits. When the query uses the control
+// protocol, the CLI is first interrupted and given time to end the turn, so
+// that its session transcript is saved (see WithCancelTimeout). A channel that
+// is simply abandoned is only cleaned up once the consumer timeout expires.
 //
 // Error handling:
-//   - Connection errors are returned immediately
-//   - Parse errors during message reading are sent to options.OnError callback if provided
+//   - Invalid options (e.g., a missing working directory) are returned immediately
+//   - Connection errors are returned immediately, once the attempts allowed by
+//     WithRetry are used up
+//   - A line that cannot be parsed yields a SystemMessage with subtype "parse_error"
+//     and the stream continues
+//   - If the transport fails mid-stream, a SystemMessage with subtype
+//     "transport_failed" is sent before the channel closes
+//   - For both, the SystemMessage's Err field holds the typed error
 //   - Context cancellation is respected throughout
 //
 // Example usage:
@@ -44,11 +61,7 @@ import (
 //	for msg := range messages {
 //	    switch m := msg.(type) {
 //	    case *types.AssistantMessage:
-//	        for _, block := range m.Content {
-//	            if tb, ok := block.(*types.TextBlock); ok {
-//	                fmt.Println(tb.Text)
-//	            }
-//	        }
+//	        fmt.Println(m.Text())
 //	    case *types.ResultMessage:
 //	        fmt.Printf("Cost: $%.4f\n", *m.TotalCostUSD)
 //	    }
@@ -57,7 +70,7 @@ import (
 // Parameters:
 //   - ctx: Context for cancellation and timeout
 //   - prompt: The text prompt to send to Claude
-//   - options: Configuration options (nil uses defaults)
+//   - options: Configuration options (nil uses defaults); copied on entry and never modified
 //
 // Returns:
 //   - A read-only channel of Message types
@@ -66,118 +79,340 @@ func Query(ctx context.Context, prompt string, options *types.ClaudeAgentOptions
 	// Use default options if not provided
 	if options == nil {
 		options = types.NewClaudeAgentOptions()
+	} else {
+		// Copy on entry so the caller's options can be shared across goroutines
+		options = options.Clone()
 	}
 
 	// Validate prompt
-	if prompt == "" {
-		return nil, fmt.Errorf("prompt cannot be empty")
+	lines, err := promptLines(options, []*types.UserMessage{types.NewUserMessageText(prompt)})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := preparePermissionOptions(options); err != nil {
+		return nil, err
+	}
+
+	return querySubprocess(ctx, lines, options)
+}
+
+// QueryWithTransport is like Query but communicates over the given transport
+// instead of spawning the CLI. CLI discovery and working directory options are
+// ignored. It is mainly useful with the record/replay transports in claudetest.
+func QueryWithTransport(ctx context.Context, prompt string, options *types.ClaudeAgentOptions, t Transport) (<-chan types.Message, error) {
+	if options == nil {
+		options = types.NewClaudeAgentOptions()
+	} else {
+		options = options.Clone()
 	}
 
-	// Find Claude CLI path
-	cliPath := ""
-	if options.CLIPath != nil {
-		cliPath = *options.CLIPath
+	lines, err := promptLines(options, []*types.UserMessage{types.NewUserMessageText(prompt)})
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("transport cannot be nil")
+	}
+	if err := preparePermissionOptions(options); err != nil {
+		return nil, err
+	}
+
+	return runQuery(ctx, lines, options, t, false)
+}
+
+// QueryWithContent is like Query but sends a prompt made of content blocks,
+// such as text alongside an image:
+//
+//	img, _ := os.ReadFile("diagram.png")
+//	messages, err := claude.QueryWithContent(ctx, []types.ContentBlock{
+//	    types.NewTextBlock("What does this diagram show?"),
+//	    types.NewImageBlock("image/png", img),
+//	}, nil)
+func QueryWithContent(ctx context.Context, blocks []types.ContentBlock, options *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+	return QueryWithMessages(ctx, []*types.UserMessage{types.NewUserMessageBlocks(blocks...)}, options)
+}
+
+// QueryWithMessages is like Query but sends each of messages in order, so a
+// conversation can be pre-seeded before the final prompt. Each message's
+// Content is a string or []types.ContentBlock; ParentToolUseID is passed through.
+// WithMaxPromptTokens applies to the combined text of all messages.
+func QueryWithMessages(ctx context.Context, messages []*types.UserMessage, options *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+	if options == nil {
+		options = types.NewClaudeAgentOptions()
 	} else {
-		var err error
-		cliPath, err = transport.FindCLI()
+		options = options.Clone()
+	}
+
+	lines, err := promptLines(options, messages)
+	if err != nil {
+		return nil, err
+	}
+	if err := preparePermissionOptions(options); err != nil {
+		return nil, err
+	}
+
+	return querySubprocess(ctx, lines, options)
+}
+
+// promptLines validates messages against options and encodes them for the CLI.
+func promptLines(options *types.ClaudeAgentOptions, messages []*types.UserMessage) ([]string, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("at least one message is required")
+	}
+
+	lines := make([]string, 0, len(messages))
+	var text strings.Builder
+	for _, msg := range messages {
+		if msg == nil {
+			return nil, fmt.Errorf("message cannot be nil")
+		}
+		line, err := userMessageLine(msg, "default-session")
 		if err != nil {
 			return nil, err
 		}
+		lines = append(lines, line)
+		text.WriteString(promptText(msg.Content))
 	}
 
-	// Determine working directory
-	cwd := ""
-	if options.CWD != nil {
-		cwd = *options.CWD
+	if err := checkPromptSize(options, text.String()); err != nil {
+		return nil, err
 	}
+	return lines, nil
+}
 
-	// Create transport with --print flag for non-streaming mode
-	env := make(map[string]string)
-	if options.Env != nil {
-		for k, v := range options.Env {
-			env[k] = v
+// runQuery connects the transport, sends the prompt, and streams the response.
+// With awaitFirst it returns once the first message has arrived, and fails
+// if the CLI stops before that.
+func runQuery(ctx context.Context, lines []string, options *types.ClaudeAgentOptions, transportInst Transport, awaitFirst bool) (<-chan types.Message, error) {
+	logDeprecations(options.Logger)
+
+	// Only probe the CLI version when a minimum is enforced, to keep one-shot queries fast
+	if options.MinCLIVersion != nil {
+		if _, err := detectCLIVersion(ctx, transportInst, options); err != nil {
+			return nil, err
 		}
 	}
 
-	// Create subprocess transport
-	transportInst := transport.NewSubprocessCLITransport(cliPath, cwd, env)
-
-	// Connect to CLI
-	if err := transportInst.Connect(ctx); err != nil {
-		return nil, types.NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", err)
+	// Screen tool results with a hook, reporting flags in the stream
+	var screening screeningFlags
+	if options.ToolResultScreener != nil {
+		options.WithHook(types.HookEventPostToolUse, screeningHook(options, &screening))
 	}
 
-	// Create query handler (non-streaming mode)
-	queryHandler := internal.NewQuery(ctx, transportInst, options, false)
+	// Run intercepted tools in Go, replacing their results in the stream
+	var intercepted interceptedResults
+	for _, matcher := range interceptorHooks(options, &intercepted) {
+		options.WithHook(types.HookEventPreToolUse, matcher)
+	}
 
-	// Start message processing
-	if err := queryHandler.Start(ctx); err != nil {
-		_ = transportInst.Close(ctx)
+	// Callbacks need the control protocol, which runs in streaming mode.
+	// There the CLI outlives a cancelled ctx once the prompt is sent, so that
+	// the turn can be interrupted; until then cancelling ctx kills it.
+	streaming := needsControlProtocol(options)
+	procCtx, stopProcess := ctx, context.CancelFunc(func() {})
+	detach := func() bool { return true }
+	if streaming {
+		procCtx, stopProcess = context.WithCancel(context.WithoutCancel(ctx))
+		detach = context.AfterFunc(ctx, stopProcess)
+	}
+	fail := func(err error) (<-chan types.Message, error) {
+		stopProcess()
 		return nil, err
 	}
 
-	// Build the query message to send to CLI
-	// Format matches Python SDK: type, message{role,content}, parent_tool_use_id, session_id
-	queryMsg := map[string]interface{}{
-		"type": "user",
-		"message": map[string]interface{}{
-			"role":    "user",
-			"content": prompt,
-		},
-		"parent_tool_use_id": nil,
-		"session_id":         "default-session",
+	// Connect to CLI
+	start := time.Now()
+	if err := transportInst.Connect(procCtx); err != nil {
+		return fail(types.NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", err))
 	}
 
-	// Marshal and send
-	data, err := json.Marshal(queryMsg)
-	if err != nil {
-		_ = queryHandler.Stop(ctx)
+	// Create query handler and start message processing
+	queryHandler := internal.NewQuery(procCtx, transportInst, options, streaming)
+	if err := queryHandler.Start(ctx); err != nil {
 		_ = transportInst.Close(ctx)
-		return nil, types.NewControlProtocolErrorWithCause("failed to marshal query", err)
+		return fail(err)
 	}
 
-	if err := transportInst.Write(ctx, string(data)); err != nil {
+	// Register the callbacks with the CLI before it sees the prompt
+	if streaming {
+		if err := initializeQuery(ctx, queryHandler, options); err != nil {
+			_ = queryHandler.Stop(ctx)
+			_ = transportInst.Close(ctx)
+			return fail(err)
+		}
+	}
+
+	// Send the prompt; the format matches the Python SDK: type, message{role,content}, parent_tool_use_id, session_id
+	if err := transportInst.WriteBatch(ctx, lines); err != nil {
 		_ = queryHandler.Stop(ctx)
 		_ = transportInst.Close(ctx)
-		return nil, err
+		return fail(err)
 	}
+	recordQuery(options)
+	detach() // If ctx is already done the CLI is being killed
 
 	// Create output channel for user
 	outputChan := make(chan types.Message, 10)
 
+	// settle reports the outcome before the first message to runQuery when
+	// it awaits one, returning whether it was a failure handed over
+	var first chan error
+	if awaitFirst {
+		first = make(chan error, 1)
+	}
+	pending := awaitFirst // only used by the goroutine below
+	settle := func(err error) bool {
+		if !pending {
+			return false
+		}
+		pending = false
+		first <- err
+		return err != nil
+	}
+
 	// Start goroutine to read messages and forward to output channel
 	go func() {
 		defer close(outputChan)
-		defer func() {
-			_ = queryHandler.Stop(ctx)
-			_ = transportInst.Close(ctx)
-		}()
 
 		messagesChan := queryHandler.GetMessages(ctx)
+		budget := newCostBudget(options)
+		var costs costMeter
+		var ended bool // The turn's ResultMessage has been read
+		defer func() {
+			// A cancelled ctx kills the CLI, unless it can end the turn once
+			// interrupted; otherwise give it time to exit
+			closeBase := ctx
+			if ctx.Err() != nil && streaming && !ended {
+				record := func(msg types.Message) { recordMessage(options, &costs, msg, start) }
+				if interruptCancelled(queryHandler, messagesChan, cancelTimeout(options), record) {
+					closeBase = context.Background()
+				} else {
+					stopProcess()
+				}
+			}
+			closeCtx, cancel := context.WithTimeout(closeBase, queryCloseTimeout)
+			defer cancel()
+			_ = queryHandler.Stop(closeCtx)
+			_ = transportInst.Close(closeCtx)
+			stopProcess()
+		}()
+		idle := newIdleTimer(options)
+		defer idle.Stop()
+		turn := newTurnTracker(options, start)
+		out := newForwarder(ctx, outputChan, options)
+		defer func() {
+			if out.abandoned && options.Logger != nil {
+				options.Logger.Warn("claude: query channel not read within the consumer timeout; stopping the CLI",
+					"timeout", out.timeout)
+			}
+		}()
 
 		for {
 			select {
 			case <-ctx.Done():
+				settle(ctx.Err())
+				return
+			case <-idle.C():
+				// The deferred Close stops the silent CLI
+				err := idle.Err()
+				transportInst.OnError(err)
+				if settle(err) {
+					return
+				}
+				if out.send(idleTimeoutMessage(err)) {
+					sendSynthetic(out, turn, err)
+				}
 				return
 			case msg, ok := <-messagesChan:
 				if !ok {
-					// Messages channel closed
+					// Messages channel closed - report why, if the transport failed
+					err := transportInst.GetError()
+					if err == nil && pending {
+						err = types.NewProcessError("CLI exited before its first message")
+					}
+					if settle(err) {
+						return
+					}
+					if err != nil && !out.send(transportFailedMessage(err)) {
+						return
+					}
+					sendSynthetic(out, turn, err)
 					return
 				}
+				settle(nil)
+				idle.Reset()
+				turn.observe(msg)
+				intercepted.apply(msg)
+				recordMessage(options, &costs, msg, start)
+				_, ended = msg.(*types.ResultMessage)
+
+				// Report flagged tool results just before the results themselves
+				for _, flag := range screening.take(msg) {
+					if !out.send(flag) {
+						return
+					}
+				}
 
 				// Forward message to output
-				select {
-				case outputChan <- msg:
-					// Check if this is a result message (end of query)
-					if _, isResult := msg.(*types.ResultMessage); isResult {
+				if !out.send(msg) {
+					return
+				}
+
+				// Stop the turn once it runs over the budget
+				if budget.observe(msg) {
+					go func() {
+						interruptCtx, cancel := context.WithTimeout(procCtx, 5*time.Second)
+						defer cancel()
+						_ = queryHandler.Interrupt(interruptCtx)
+					}()
+					if !out.send(budget.message()) {
 						return
 					}
-				case <-ctx.Done():
+				}
+
+				// The CLI reported an error instead of ending the turn
+				if result := turn.failed(msg); result != nil {
+					out.send(result)
+					return
+				}
+
+				// Check if this is a result message (end of query)
+				if ended {
 					return
 				}
 			}
 		}
 	}()
 
+	if first != nil {
+		if err := <-first; err != nil {
+			return nil, err
+		}
+	}
 	return outputChan, nil
 }
+
+// needsControlProtocol reports whether options set callbacks that the CLI
+// can only reach over the control protocol: a permission callback or policy,
+// or hooks, including those installed for WithAllowedRoots. A cost budget
+// needs it too, to interrupt a turn that runs over.
+func needsControlProtocol(options *types.ClaudeAgentOptions) bool {
+	return options.CanUseTool != nil || len(options.Hooks) > 0 || options.MaxCostUSD != nil
+}
+
+// initializeQuery sends the initialize request of a one-shot query, bounded
+// by the connect timeout like the handshake of Client.Connect.
+func initializeQuery(ctx context.Context, queryHandler *internal.Query, options *types.ClaudeAgentOptions) error {
+	timeout := connectTimeout(options)
+	initCtx, cancel := withConnectTimeout(ctx, timeout)
+	defer cancel()
+
+	if _, err := queryHandler.Initialize(initCtx); err != nil {
+		if terr := connectTimeoutError(ctx, initCtx, timeout, connectPhaseInitialize); terr != nil {
+			return terr
+		}
+		return types.NewControlProtocolErrorWithCause("failed to initialize control protocol", err)
+	}
+	return nil
+}
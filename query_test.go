@@ -2,9 +2,15 @@ package claude
 
 import (
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
 	"github.com/schlunsen/claude-agent-sdk-go/types"
 )
 
@@ -54,11 +60,28 @@ func TestQuery_CLINotFound(t *testing.T) {
 	}
 }
 
+func TestQuery_CWDIsFile(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(idleCLI(t)).
+		WithCWD(file)
+
+	_, err := Query(ctx, "test", opts)
+	if !types.IsWorkingDirectoryError(err) {
+		t.Fatalf("expected WorkingDirectoryError, got: %v", err)
+	}
+}
+
 func TestQuery_ContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
 
-	opts := types.NewClaudeAgentOptions().WithCLIPath("/bin/echo") // Use a command that exists
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(t))
 
 	messages, err := Query(ctx, "test", opts)
 	if err != nil {
@@ -154,10 +177,223 @@ func TestQuery_Integration(t *testing.T) {
 // BenchmarkQuery benchmarks the Query function (will fail without CLI installed)
 func BenchmarkQuery(b *testing.B) {
 	ctx := context.Background()
-	opts := types.NewClaudeAgentOptions().WithCLIPath("/bin/echo")
+	opts := types.NewClaudeAgentOptions().WithCLIPath(idleCLI(b))
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		_, _ = Query(ctx, "test", opts)
 	}
 }
+
+// TestQuery_SharedOptionsConcurrent tests that one options value can be shared
+// across many concurrent Query and NewClient calls. Run with -race.
+func TestQuery_SharedOptionsConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	cliPath := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{mockcli.Exit(0)}}).Path
+
+	hook := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return nil, nil
+	}
+	matcher := "Bash"
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cliPath).
+		WithCWD(dir).
+		WithEnvVar("SHARED_VAR", "1").
+		WithEnvVar("OTHER_VAR", "2").
+		WithAllowedTools("Read", "Bash").
+		WithStrictProtocol(true).
+		WithHook(types.HookEventPreToolUse, types.HookMatcher{Matcher: &matcher, Hooks: []types.HookCallbackFunc{hook}}).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return types.PermissionResultAllow{}, nil
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if i%2 == 0 {
+				client, err := NewClient(ctx, opts)
+				if err != nil {
+					t.Errorf("NewClient failed: %v", err)
+					return
+				}
+				_ = client.Close(ctx)
+				return
+			}
+
+			queryCtx, queryCancel := context.WithCancel(ctx)
+			msgs, err := Query(queryCtx, "hello", opts)
+			queryCancel()
+			if err != nil {
+				// The mock CLI exits immediately, so writes may fail; only races matter here.
+				return
+			}
+			for range msgs {
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if opts.PermissionPromptToolName != nil {
+		t.Errorf("shared options were modified: PermissionPromptToolName = %q", *opts.PermissionPromptToolName)
+	}
+	if len(opts.Env) != 2 {
+		t.Errorf("shared options env modified: %v", opts.Env)
+	}
+}
+
+// collect reads messages until the channel closes or ctx is done.
+func collect(t *testing.T, ctx context.Context, messages <-chan types.Message) []types.Message {
+	t.Helper()
+	var got []types.Message
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return got
+			}
+			got = append(got, msg)
+		case <-ctx.Done():
+			t.Fatalf("channel still open after %d messages", len(got))
+		}
+	}
+}
+
+func TestQuery_ScriptedResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Delay(50 * time.Millisecond),
+		mockcli.Send(
+			`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"4"}]}}`,
+			streamResult,
+		),
+	}})
+	messages, err := Query(ctx, "What is 2+2?", types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	got := collect(t, ctx, messages)
+	if len(got) != 2 {
+		t.Fatalf("got %d messages, want the assistant message and the result: %v", len(got), got)
+	}
+	if m, ok := got[0].(*types.AssistantMessage); !ok || m.Text() != "4" {
+		t.Errorf("first message = %+v, want the answer", got[0])
+	}
+	if _, ok := got[1].(*types.ResultMessage); !ok {
+		t.Errorf("last message = %T, want *types.ResultMessage", got[1])
+	}
+	if received := cli.Received(); len(received) != 1 || !strings.Contains(received[0], `"What is 2+2?"`) {
+		t.Errorf("CLI received %q, want the prompt", received)
+	}
+}
+
+func TestQuery_CLIExitsMidStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"partial"}]}}`),
+		mockcli.Stderr("fatal: out of memory"),
+		mockcli.Exit(1),
+	}})
+	messages, err := Query(ctx, "hello", types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	// What arrived before the exit is delivered, then how the CLI exited
+	got := collect(t, ctx, messages)
+	if len(got) != 2 {
+		t.Fatalf("got %d messages, want the one sent before the exit and the failure: %v", len(got), got)
+	}
+	if _, ok := got[0].(*types.AssistantMessage); !ok {
+		t.Errorf("message = %T, want *types.AssistantMessage", got[0])
+	}
+	failed, ok := got[1].(*types.SystemMessage)
+	var procErr *types.ProcessError
+	if !ok || failed.Subtype != "transport_failed" || !errors.As(failed.Err, &procErr) {
+		t.Fatalf("last message = %+v, want a transport_failed message with a ProcessError", got[1])
+	}
+	if procErr.ExitCode != 1 || procErr.Stderr != "fatal: out of memory" {
+		t.Errorf("ProcessError = %+v, want exit code 1 and the stderr", procErr)
+	}
+}
+
+func TestQuery_ScriptedPermissionRequest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"control_request","request_id":"perm_1","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"rm -rf /"}}}`),
+		mockcli.AwaitResponse("perm_1"),
+		mockcli.Send(streamResult),
+	}})
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithStrictProtocol(true).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return &types.PermissionResultDeny{Behavior: "deny", Message: "not here"}, nil
+		})
+	messages, err := Query(ctx, "clean up", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if got := collect(t, ctx, messages); len(got) != 1 {
+		t.Fatalf("got %v, want only the result", got)
+	}
+
+	// Initialize, the prompt, then the answer to the permission request
+	received := cli.Received()
+	if len(received) != 3 {
+		t.Fatalf("CLI received %q, want 3 lines", received)
+	}
+	if !strings.Contains(received[0], `"initialize"`) {
+		t.Errorf("first line = %s, want the initialize request", received[0])
+	}
+	if !strings.Contains(received[2], `"perm_1"`) || !strings.Contains(received[2], `"deny"`) {
+		t.Errorf("last line = %s, want the denial of perm_1", received[2])
+	}
+}
+
+// TestQuery_OversizedControlResponse tests that a control response over the
+// outbound limit is replaced by an error response, so the CLI is not left
+// waiting for it.
+func TestQuery_OversizedControlResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"control_request","request_id":"perm_1","request":{"subtype":"can_use_tool","tool_name":"Write","input":{"file_path":"big.txt"}}}`),
+		mockcli.AwaitResponse("perm_1"),
+		mockcli.Send(streamResult),
+	}})
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithMaxOutboundSize(1024).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			input["content"] = strings.Repeat("x", 2048)
+			return &types.PermissionResultAllow{UpdatedInput: &input}, nil
+		})
+	messages, err := Query(ctx, "write it", opts)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	collect(t, ctx, messages)
+
+	response := string(receivedResponse(t, cli, "perm_1"))
+	if !strings.Contains(response, `"subtype":"error"`) || !strings.Contains(response, "over the maximum of 1024 bytes") {
+		t.Errorf("response to perm_1 = %s, want an error naming the limit", response)
+	}
+}
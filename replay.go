@@ -0,0 +1,462 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ReplayToolPolicy decides what happens when the model calls a tool while a
+// transcript is replayed. Tool results would differ from the recording, and
+// running tools again may have side effects, so tools are disabled by default.
+type ReplayToolPolicy string
+
+const (
+	// ReplayToolsDisabled denies every tool call, telling the model that
+	// tools are unavailable.
+	ReplayToolsDisabled ReplayToolPolicy = "disabled"
+
+	// ReplayToolsStubbed denies every tool call with a stub result: the one
+	// from ReplayOptions.Stub, or else the recorded result of an original call
+	// with the same tool name and input. Calls without a stub are denied as
+	// with ReplayToolsDisabled.
+	ReplayToolsStubbed ReplayToolPolicy = "stubbed"
+
+	// ReplayToolsLive runs tools as configured in ReplayOptions.Options.
+	ReplayToolsLive ReplayToolPolicy = "live"
+)
+
+// replayToolsDisabledReason is the reason given to the model for a tool call
+// denied during a replay.
+const replayToolsDisabledReason = "Tools are disabled while replaying a recorded session. Answer without using tools."
+
+// ReplayOptions configures Replay.
+type ReplayOptions struct {
+	// Model is the model to replay the prompts against. Required.
+	Model string
+
+	// Options configure the replay session, such as the CLI path and working
+	// directory (nil uses defaults). They are copied; Model overrides the
+	// model, and resume and continue settings are cleared so that the replay
+	// starts a fresh session.
+	Options *types.ClaudeAgentOptions
+
+	// Tools decides how tool calls are handled (empty means ReplayToolsDisabled).
+	Tools ReplayToolPolicy
+
+	// Stub returns the result to give the model for a tool call under
+	// ReplayToolsStubbed, or false to use the recorded result. It may be
+	// called from several goroutines.
+	Stub func(toolName string, input map[string]interface{}) (result string, ok bool)
+}
+
+// ReplayTurn pairs the recorded outcome of a prompt with its replay.
+type ReplayTurn struct {
+	// Prompt is the user prompt, as recorded.
+	Prompt *types.UserMessage
+
+	// Original is the recorded assistant text, joined with newlines.
+	Original string
+
+	// OriginalResult is the recorded ResultMessage, or nil if none was recorded.
+	OriginalResult *types.ResultMessage
+
+	// Replayed is the outcome of the prompt on the replay model.
+	Replayed *types.TurnResult
+
+	// Diff is a line diff from Original to the replayed text: unchanged lines
+	// are prefixed with two spaces, removed lines with "- " and added lines
+	// with "+ ". It is empty when the texts are equal.
+	Diff string
+
+	// OriginalCostUSD and ReplayedCostUSD are the cost of the turn, from the
+	// increase of the session's running total. They are zero when no cost
+	// was reported.
+	OriginalCostUSD float64
+	ReplayedCostUSD float64
+}
+
+// ReplayResult is the outcome of Replay.
+type ReplayResult struct {
+	// Model is the model the prompts were replayed against.
+	Model string
+
+	// Turns holds one entry per replayed prompt, in order.
+	Turns []ReplayTurn
+
+	// OriginalCostUSD and ReplayedCostUSD sum the turns' costs.
+	OriginalCostUSD float64
+	ReplayedCostUSD float64
+}
+
+// CostDeltaUSD returns how much more the replay cost than the original, which
+// is negative if it was cheaper.
+func (r *ReplayResult) CostDeltaUSD() float64 {
+	return r.ReplayedCostUSD - r.OriginalCostUSD
+}
+
+// Changed returns the turns whose replayed text differs from the original.
+func (r *ReplayResult) Changed() []ReplayTurn {
+	var changed []ReplayTurn
+	for _, turn := range r.Turns {
+		if turn.Diff != "" {
+			changed = append(changed, turn)
+		}
+	}
+	return changed
+}
+
+// Replay re-runs the user prompts of a recorded session, verbatim and in
+// order, on a fresh session with another model, for comparing models. It
+// returns each recorded answer paired with the new one, with a text diff and
+// the cost of both.
+//
+// The transcript must include the prompts, as the messages of a transcript
+// written with WithTranscript do once decoded with TranscriptMessages. A user
+// message is a prompt unless it carries tool results or belongs to a
+// subagent. Tool calls are handled according to ReplayOptions.Tools.
+//
+// If a turn fails, the turns replayed so far are returned with the error.
+//
+// Example:
+//
+//	entries, err := claude.LoadTranscript(f)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	messages, err := claude.TranscriptMessages(entries)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	res, err := claude.Replay(ctx, messages, &claude.ReplayOptions{Model: "claude-opus-4-1"})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, turn := range res.Changed() {
+//	    fmt.Println(turn.Diff)
+//	}
+//	fmt.Printf("Cost change: $%.4f\n", res.CostDeltaUSD())
+func Replay(ctx context.Context, transcript []types.Message, opts *ReplayOptions) (*ReplayResult, error) {
+	options, err := replayClientOptions(opts, transcript)
+	if err != nil {
+		return nil, err
+	}
+	turns := recordedTurns(transcript)
+	if len(turns) == 0 {
+		return nil, fmt.Errorf("transcript has no user prompts to replay")
+	}
+
+	client, err := NewClient(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = client.Close(ctx) }()
+	if err := client.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	result := &ReplayResult{Model: opts.Model}
+	var originalSpent, replayedSpent float64
+	for _, turn := range turns {
+		replayed, err := client.replayPrompt(ctx, turn.prompt)
+		if replayed == nil {
+			return result, err
+		}
+
+		original := CollectAssistantText(turn.messages)
+		rt := ReplayTurn{
+			Prompt:         turn.prompt,
+			Original:       original,
+			OriginalResult: turn.result(),
+			Replayed:       replayed,
+			Diff:           lineDiff(original, replayed.Text),
+		}
+		rt.OriginalCostUSD = turnCost(rt.OriginalResult, &originalSpent)
+		rt.ReplayedCostUSD = turnCost(replayed.Result, &replayedSpent)
+		result.Turns = append(result.Turns, rt)
+		result.OriginalCostUSD += rt.OriginalCostUSD
+		result.ReplayedCostUSD += rt.ReplayedCostUSD
+
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// replayClientOptions returns the options of the replay session: a copy of
+// opts.Options starting a fresh session on opts.Model, with a PreToolUse hook
+// applying the tool policy unless tools run live.
+func replayClientOptions(opts *ReplayOptions, transcript []types.Message) (*types.ClaudeAgentOptions, error) {
+	if opts == nil || opts.Model == "" {
+		return nil, fmt.Errorf("replay model cannot be empty")
+	}
+	policy := opts.Tools
+	if policy == "" {
+		policy = ReplayToolsDisabled
+	}
+	switch policy {
+	case ReplayToolsDisabled, ReplayToolsStubbed, ReplayToolsLive:
+	default:
+		return nil, fmt.Errorf("invalid replay tool policy %q", policy)
+	}
+
+	options := types.NewClaudeAgentOptions()
+	if opts.Options != nil {
+		options = opts.Options.Clone()
+	}
+	options.WithModel(opts.Model)
+	options.Resume = nil
+	options.ContinueConversation = false
+	options.ForkSession = false
+
+	// The CLI is told the model with a flag, replacing any flags of the
+	// caller's that pick a model or resume a session
+	for key := range options.ExtraArgs {
+		switch strings.TrimLeft(key, "-") {
+		case "model", "resume", "continue", "fork-session", "session-id":
+			delete(options.ExtraArgs, key)
+		}
+	}
+	model := opts.Model
+	options.WithExtraCLIArg("model", &model)
+
+	if policy != ReplayToolsLive {
+		stubs := newReplayStubs(policy, opts.Stub, transcript)
+		options.WithHook(types.HookEventPreToolUse, types.HookMatcher{
+			Hooks:    []types.HookCallbackFunc{stubs.hook},
+			Enforced: true,
+		})
+	}
+	return options, nil
+}
+
+// replayPrompt sends a recorded prompt as it was sent originally and waits
+// for the turn to finish.
+func (c *Client) replayPrompt(ctx context.Context, prompt *types.UserMessage) (*types.TurnResult, error) {
+	var err error
+	switch content := prompt.Content.(type) {
+	case string:
+		err = c.Query(ctx, content)
+	case []types.ContentBlock:
+		err = c.QueryWithContent(ctx, content)
+	default:
+		err = fmt.Errorf("unsupported prompt content %T", prompt.Content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.receiveTurn(ctx)
+}
+
+// turnCost returns the cost of a turn from the session's running total,
+// advancing spent. Results without a cost count as free.
+func turnCost(result *types.ResultMessage, spent *float64) float64 {
+	if result == nil || result.TotalCostUSD == nil || *result.TotalCostUSD <= *spent {
+		return 0
+	}
+	cost := *result.TotalCostUSD - *spent
+	*spent = *result.TotalCostUSD
+	return cost
+}
+
+// recordedTurn is a prompt from a transcript and the messages that followed it.
+type recordedTurn struct {
+	prompt   *types.UserMessage
+	messages []types.Message
+}
+
+// result returns the turn's last ResultMessage, or nil.
+func (t recordedTurn) result() *types.ResultMessage {
+	for i := len(t.messages) - 1; i >= 0; i-- {
+		if result, ok := t.messages[i].(*types.ResultMessage); ok {
+			return result
+		}
+	}
+	return nil
+}
+
+// recordedTurns splits a transcript at its prompts. Messages before the first
+// prompt are dropped.
+func recordedTurns(transcript []types.Message) []recordedTurn {
+	var turns []recordedTurn
+	for _, msg := range transcript {
+		if m, ok := msg.(*types.UserMessage); ok && isPrompt(m) {
+			turns = append(turns, recordedTurn{prompt: m})
+			continue
+		}
+		if len(turns) > 0 {
+			last := &turns[len(turns)-1]
+			last.messages = append(last.messages, msg)
+		}
+	}
+	return turns
+}
+
+// isPrompt reports whether a user message is a prompt rather than tool
+// results or a subagent's message.
+func isPrompt(msg *types.UserMessage) bool {
+	if msg.ParentToolUseID != nil {
+		return false
+	}
+	switch content := msg.Content.(type) {
+	case string:
+		return true
+	case []types.ContentBlock:
+		for _, block := range content {
+			if _, ok := block.(*types.ToolResultBlock); ok {
+				return false
+			}
+		}
+		return len(content) > 0
+	}
+	return false
+}
+
+// replayStubs answers the tool calls of a replay according to its policy.
+type replayStubs struct {
+	policy ReplayToolPolicy
+	stub   func(toolName string, input map[string]interface{}) (string, bool)
+
+	mu       sync.Mutex
+	recorded map[string][]string // Tool call key -> recorded results, in call order
+}
+
+// newReplayStubs indexes the recorded results of the transcript's tool calls
+// by tool name and input.
+func newReplayStubs(policy ReplayToolPolicy, stub func(string, map[string]interface{}) (string, bool), transcript []types.Message) *replayStubs {
+	s := &replayStubs{policy: policy, stub: stub, recorded: make(map[string][]string)}
+	if policy != ReplayToolsStubbed {
+		return s
+	}
+
+	calls := make(map[string]string) // Tool use ID -> call key
+	var order []string
+	results := make(map[string]string)
+	for _, msg := range transcript {
+		switch m := msg.(type) {
+		case *types.AssistantMessage:
+			for _, use := range m.ToolUses() {
+				calls[use.ID] = toolCallKey(use.Name, use.Input)
+				order = append(order, use.ID)
+			}
+		case *types.UserMessage:
+			blocks, _ := m.Content.([]types.ContentBlock)
+			for _, block := range blocks {
+				if tr, ok := block.(*types.ToolResultBlock); ok {
+					results[tr.ToolUseID], _ = tr.Text()
+				}
+			}
+		}
+	}
+	for _, id := range order {
+		if result, ok := results[id]; ok {
+			s.recorded[calls[id]] = append(s.recorded[calls[id]], result)
+		}
+	}
+	return s
+}
+
+// toolCallKey identifies a tool call by its tool name and input. Map keys are
+// encoded in sorted order, so equal inputs give equal keys.
+func toolCallKey(toolName string, input map[string]interface{}) string {
+	data, _ := json.Marshal(input)
+	return toolName + "\x00" + string(data)
+}
+
+// result returns the stub result for a tool call. Recorded results of
+// repeated calls are used in turn, the last one for any further calls.
+func (s *replayStubs) result(toolName string, input map[string]interface{}) (string, bool) {
+	if s.policy != ReplayToolsStubbed {
+		return "", false
+	}
+	if s.stub != nil {
+		if result, ok := s.stub(toolName, input); ok {
+			return result, true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := toolCallKey(toolName, input)
+	results := s.recorded[key]
+	if len(results) == 0 {
+		return "", false
+	}
+	if len(results) > 1 {
+		s.recorded[key] = results[1:]
+	}
+	return results[0], true
+}
+
+// hook is the PreToolUse hook denying tool calls during a replay, with the
+// stub result as the reason given to the model.
+func (s *replayStubs) hook(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+	fields, _ := input.(map[string]interface{})
+	toolName, _ := fields["tool_name"].(string)
+	toolInput, _ := fields["tool_input"].(map[string]interface{})
+
+	reason := replayToolsDisabledReason
+	if result, ok := s.result(toolName, toolInput); ok {
+		reason = result
+	}
+	return map[string]interface{}{
+		"hookSpecificOutput": map[string]interface{}{
+			"hookEventName":            string(types.HookEventPreToolUse),
+			"permissionDecision":       string(types.PermissionBehaviorDeny),
+			"permissionDecisionReason": reason,
+		},
+	}, nil
+}
+
+// lineDiff returns a line diff from a to b in the format of ReplayTurn.Diff,
+// or "" if they are equal.
+func lineDiff(a, b string) string {
+	if a == b {
+		return ""
+	}
+	x, y := splitLines(a), splitLines(b)
+
+	// Lines common to both, from the longest common subsequence; inputs too
+	// large to compare are shown as replacing every line
+	var lcs [][]int
+	if len(x)*len(y) <= maxDiffCells {
+		lcs = make([][]int, len(x)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				switch {
+				case x[i] == y[j]:
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				case lcs[i+1][j] >= lcs[i][j+1]:
+					lcs[i][j] = lcs[i+1][j]
+				default:
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out.WriteString("  " + x[i] + "\n")
+			i, j = i+1, j+1
+		case i < len(x) && (j == len(y) || lcs == nil || lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + x[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + y[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,310 @@
+package claude
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// replayTranscript is a recorded session of two prompts, the second of which
+// used a tool, as written by WithTranscript.
+const replayTranscript = `{"time":"2025-01-01T00:00:00Z","direction":"out","message":{"type":"control_request","request_id":"req_1","request":{"subtype":"initialize"}}}
+{"time":"2025-01-01T00:00:00Z","direction":"in","message":{"type":"system","subtype":"init","data":{"session_id":"s1"}}}
+{"time":"2025-01-01T00:00:01Z","direction":"out","message":{"type":"user","message":{"role":"user","content":"What is 2+2?"},"parent_tool_use_id":null,"session_id":"default"}}
+{"time":"2025-01-01T00:00:02Z","direction":"in","message":{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"4"}]}}}
+{"time":"2025-01-01T00:00:02Z","direction":"in","message":{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":1,"session_id":"s1","total_cost_usd":0.01}}
+{"time":"2025-01-01T00:00:03Z","direction":"out","message":{"type":"user","message":{"role":"user","content":[{"type":"text","text":"Describe main.go"}]},"parent_tool_use_id":null,"session_id":"default"}}
+{"time":"2025-01-01T00:00:04Z","direction":"in","message":{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"main.go"}}]}}}
+{"time":"2025-01-01T00:00:04Z","direction":"in","message":{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"package main"}]}}}
+{"time":"2025-01-01T00:00:05Z","direction":"in","message":{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"main.go declares package main"}]}}}
+{"time":"2025-01-01T00:00:05Z","direction":"in","message":{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":2,"session_id":"s1","total_cost_usd":0.03}}
+`
+
+// loadReplayTranscript decodes replayTranscript.
+func loadReplayTranscript(t *testing.T) []types.Message {
+	t.Helper()
+	entries, err := LoadTranscript(strings.NewReader(replayTranscript))
+	if err != nil {
+		t.Fatalf("LoadTranscript failed: %v", err)
+	}
+	messages, err := TranscriptMessages(entries)
+	if err != nil {
+		t.Fatalf("TranscriptMessages failed: %v", err)
+	}
+	return messages
+}
+
+func TestReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The CLI answers both prompts in turn
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(
+			`{"type":"assistant","message":{"model":"claude-next","content":[{"type":"text","text":"4"}]}}`,
+			`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":1,"session_id":"s2","total_cost_usd":0.02}`,
+		),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(
+			`{"type":"assistant","message":{"model":"claude-next","content":[{"type":"text","text":"main.go declares package main\nIt has no functions"}]}}`,
+			`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":1,"session_id":"s2","total_cost_usd":0.05}`,
+		),
+	}})
+
+	resume := "s1"
+	base := types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithModel("claude-sonnet-4-5").WithExtraCLIArg("--resume", &resume)
+	res, err := Replay(ctx, loadReplayTranscript(t), &ReplayOptions{Model: "claude-next", Options: base})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+
+	if len(res.Turns) != 2 {
+		t.Fatalf("got %d turns, want 2", len(res.Turns))
+	}
+	first, second := res.Turns[0], res.Turns[1]
+	if first.Original != "4" || first.Replayed.Text != "4" || first.Diff != "" {
+		t.Errorf("first turn = original %q, replayed %q, diff %q", first.Original, first.Replayed.Text, first.Diff)
+	}
+	if second.Original != "main.go declares package main" {
+		t.Errorf("second turn original = %q", second.Original)
+	}
+	wantDiff := "  main.go declares package main\n+ It has no functions\n"
+	if second.Diff != wantDiff {
+		t.Errorf("second turn diff = %q, want %q", second.Diff, wantDiff)
+	}
+	if changed := res.Changed(); len(changed) != 1 || changed[0].Prompt != second.Prompt {
+		t.Errorf("Changed() = %d turns, want the second", len(changed))
+	}
+
+	// Costs come from the running totals of each session
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"first original", first.OriginalCostUSD, 0.01},
+		{"first replayed", first.ReplayedCostUSD, 0.02},
+		{"second original", second.OriginalCostUSD, 0.02},
+		{"second replayed", second.ReplayedCostUSD, 0.03},
+		{"original total", res.OriginalCostUSD, 0.03},
+		{"replayed total", res.ReplayedCostUSD, 0.05},
+		{"delta", res.CostDeltaUSD(), 0.02},
+	} {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("%s cost = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	// The prompts were sent verbatim on a fresh session with the new model
+	args := strings.Join(cli.Args(), " ")
+	if !strings.Contains(args, "--model claude-next") || strings.Contains(args, "--resume") {
+		t.Errorf("CLI arguments = %q, want --model claude-next without --resume", args)
+	}
+	var prompts []string
+	for _, line := range cli.Received() {
+		if strings.Contains(line, `"type":"user"`) {
+			prompts = append(prompts, line)
+		}
+	}
+	if len(prompts) != 2 || !strings.Contains(prompts[0], `"content":"What is 2+2?"`) ||
+		!strings.Contains(prompts[1], `"content":[{"type":"text","text":"Describe main.go"}]`) {
+		t.Errorf("prompts sent = %q", prompts)
+	}
+	if *base.Model != "claude-sonnet-4-5" || len(base.ExtraArgs) != 1 {
+		t.Error("Replay modified the caller's options")
+	}
+}
+
+func TestReplay_Errors(t *testing.T) {
+	ctx := context.Background()
+	transcript := loadReplayTranscript(t)
+
+	if _, err := Replay(ctx, transcript, nil); err == nil {
+		t.Error("Replay without options succeeded, want an error")
+	}
+	if _, err := Replay(ctx, transcript, &ReplayOptions{}); err == nil {
+		t.Error("Replay without a model succeeded, want an error")
+	}
+	if _, err := Replay(ctx, transcript, &ReplayOptions{Model: "m", Tools: "sometimes"}); err == nil || !strings.Contains(err.Error(), "sometimes") {
+		t.Errorf("Replay with an invalid policy = %v, want an error naming it", err)
+	}
+	answers := []types.Message{&types.AssistantMessage{Type: types.MessageTypeAssistant}}
+	if _, err := Replay(ctx, answers, &ReplayOptions{Model: "m"}); err == nil || !strings.Contains(err.Error(), "no user prompts") {
+		t.Errorf("Replay without prompts = %v, want a no prompts error", err)
+	}
+}
+
+func TestReplayClientOptions_ToolPolicy(t *testing.T) {
+	transcript := loadReplayTranscript(t)
+	userHook := types.HookMatcher{Hooks: []types.HookCallbackFunc{
+		func(context.Context, interface{}, *string, types.HookContext) (interface{}, error) { return nil, nil },
+	}}
+
+	tests := []struct {
+		policy    ReplayToolPolicy
+		wantHooks int
+	}{
+		{"", 2},
+		{ReplayToolsDisabled, 2},
+		{ReplayToolsStubbed, 2},
+		{ReplayToolsLive, 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			base := types.NewClaudeAgentOptions().
+				WithStrictProtocol(true).
+				WithHook(types.HookEventPreToolUse, userHook).
+				WithContinueConversation(true).
+				WithForkSession(true)
+			options, err := replayClientOptions(&ReplayOptions{Model: "claude-next", Options: base, Tools: tt.policy}, transcript)
+			if err != nil {
+				t.Fatalf("replayClientOptions failed: %v", err)
+			}
+			if got := len(options.Hooks[types.HookEventPreToolUse]); got != tt.wantHooks {
+				t.Errorf("got %d PreToolUse hooks, want %d", got, tt.wantHooks)
+			}
+			if options.ContinueConversation || options.ForkSession || *options.Model != "claude-next" {
+				t.Errorf("options do not start a fresh session on the replay model")
+			}
+			if len(base.Hooks[types.HookEventPreToolUse]) != 1 {
+				t.Error("the caller's hooks were modified")
+			}
+		})
+	}
+}
+
+// replayDenyReason runs the replay hook for a tool call and returns the
+// reason given to the model, failing unless the call is denied.
+func replayDenyReason(t *testing.T, stubs *replayStubs, toolName string, input map[string]interface{}) string {
+	t.Helper()
+	out, err := stubs.hook(context.Background(), map[string]interface{}{
+		"hook_event_name": "PreToolUse",
+		"tool_name":       toolName,
+		"tool_input":      input,
+	}, nil, types.HookContext{})
+	if err != nil {
+		t.Fatalf("hook failed: %v", err)
+	}
+	specific, _ := out.(map[string]interface{})["hookSpecificOutput"].(map[string]interface{})
+	if specific["hookEventName"] != "PreToolUse" || specific["permissionDecision"] != "deny" {
+		t.Fatalf("hook output = %v, want a PreToolUse deny", out)
+	}
+	reason, _ := specific["permissionDecisionReason"].(string)
+	return reason
+}
+
+func TestReplayStubs(t *testing.T) {
+	readMain := map[string]interface{}{"file_path": "main.go"}
+
+	// The same call twice, with different results
+	transcript := append(loadReplayTranscript(t),
+		&types.AssistantMessage{Type: types.MessageTypeAssistant, Content: []types.ContentBlock{
+			&types.ToolUseBlock{Type: "tool_use", ID: "toolu_2", Name: "Read", Input: map[string]interface{}{"file_path": "main.go"}},
+		}},
+		&types.UserMessage{Type: types.MessageTypeUser, Content: []types.ContentBlock{
+			&types.ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_2", Content: "package main // edited"},
+		}},
+	)
+
+	t.Run("disabled", func(t *testing.T) {
+		stubs := newReplayStubs(ReplayToolsDisabled, nil, transcript)
+		if got := replayDenyReason(t, stubs, "Read", readMain); got != replayToolsDisabledReason {
+			t.Errorf("reason = %q, want the disabled reason", got)
+		}
+	})
+
+	t.Run("stubbed with recorded results", func(t *testing.T) {
+		stubs := newReplayStubs(ReplayToolsStubbed, nil, transcript)
+		want := []string{"package main", "package main // edited", "package main // edited"}
+		for i, w := range want {
+			if got := replayDenyReason(t, stubs, "Read", readMain); got != w {
+				t.Errorf("call %d reason = %q, want %q", i+1, got, w)
+			}
+		}
+		if got := replayDenyReason(t, stubs, "Read", map[string]interface{}{"file_path": "other.go"}); got != replayToolsDisabledReason {
+			t.Errorf("unrecorded input reason = %q, want the disabled reason", got)
+		}
+		if got := replayDenyReason(t, stubs, "Bash", map[string]interface{}{"command": "ls"}); got != replayToolsDisabledReason {
+			t.Errorf("unrecorded tool reason = %q, want the disabled reason", got)
+		}
+	})
+
+	t.Run("stubbed with a stub function", func(t *testing.T) {
+		stub := func(toolName string, input map[string]interface{}) (string, bool) {
+			if toolName == "Bash" {
+				return "stubbed output of " + input["command"].(string), true
+			}
+			return "", false
+		}
+		stubs := newReplayStubs(ReplayToolsStubbed, stub, transcript)
+		if got := replayDenyReason(t, stubs, "Bash", map[string]interface{}{"command": "ls"}); got != "stubbed output of ls" {
+			t.Errorf("stubbed reason = %q", got)
+		}
+		if got := replayDenyReason(t, stubs, "Read", readMain); got != "package main" {
+			t.Errorf("fallback reason = %q, want the recorded result", got)
+		}
+	})
+
+	t.Run("stub function ignored when disabled", func(t *testing.T) {
+		stub := func(string, map[string]interface{}) (string, bool) { return "stubbed", true }
+		stubs := newReplayStubs(ReplayToolsDisabled, stub, transcript)
+		if got := replayDenyReason(t, stubs, "Read", readMain); got != replayToolsDisabledReason {
+			t.Errorf("reason = %q, want the disabled reason", got)
+		}
+	})
+}
+
+func TestRecordedTurns(t *testing.T) {
+	parent := "toolu_task"
+	transcript := []types.Message{
+		&types.SystemMessage{Type: types.MessageTypeSystem, Subtype: "init"},
+		types.NewUserMessageText("first"),
+		&types.UserMessage{Type: types.MessageTypeUser, Content: "subagent prompt", ParentToolUseID: &parent},
+		&types.UserMessage{Type: types.MessageTypeUser, Content: []types.ContentBlock{
+			&types.ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_1"},
+		}},
+		types.NewUserMessageBlocks(types.NewTextBlock("second")),
+		&types.ResultMessage{Type: types.MessageTypeResult},
+	}
+
+	turns := recordedTurns(transcript)
+	if len(turns) != 2 {
+		t.Fatalf("got %d turns, want 2", len(turns))
+	}
+	if turns[0].prompt != transcript[1] || len(turns[0].messages) != 2 {
+		t.Errorf("first turn = prompt %v with %d messages, want the first prompt with 2", turns[0].prompt, len(turns[0].messages))
+	}
+	if turns[1].prompt != transcript[4] || turns[1].result() != transcript[5] {
+		t.Errorf("second turn = prompt %v, result %v", turns[1].prompt, turns[1].result())
+	}
+	if turns[0].result() != nil {
+		t.Error("first turn has a result, want none")
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb", "a\nb", ""},
+		{"both empty", "", "", ""},
+		{"added", "", "a", "+ a\n"},
+		{"removed", "a\nb", "a", "  a\n- b\n"},
+		{"changed middle", "a\nb\nc", "a\nx\nc", "  a\n- b\n+ x\n  c\n"},
+		{"reordered", "a\nb", "b\na", "- a\n  b\n+ a\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineDiff(tt.a, tt.b); got != tt.want {
+				t.Errorf("lineDiff(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package claude
+
+import (
+	"context"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// retrier paces the attempts to start the CLI allowed by WithRetry.
+type retrier struct {
+	options  *types.ClaudeAgentOptions
+	attempts int // attempts made so far
+	max      int
+	backoff  time.Duration
+}
+
+// newRetrier returns a retrier for the first attempt under options.
+func newRetrier(options *types.ClaudeAgentOptions) *retrier {
+	r := &retrier{options: options, attempts: 1, max: 1}
+	if options.Retry != nil && options.Retry.MaxAttempts > 1 {
+		r.max = options.Retry.MaxAttempts
+		r.backoff = options.Retry.Backoff
+	}
+	return r
+}
+
+// retries reports whether more than one attempt is allowed.
+func (r *retrier) retries() bool {
+	return r.max > 1
+}
+
+// wait reports whether to make another attempt after one failed with err,
+// and if so waits out the backoff first. It does not when no attempt is
+// left, err is not transient, or ctx is done.
+func (r *retrier) wait(ctx context.Context, what string, err error) bool {
+	if r.attempts >= r.max || !types.IsRetryable(err) || ctx.Err() != nil {
+		return false
+	}
+	logState(r.options, what+" failed; retrying", "attempt", r.attempts, "backoff", r.backoff, "error", err)
+
+	timer := time.NewTimer(r.backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return false
+	}
+	r.attempts++
+	r.backoff *= 2
+	return true
+}
+
+// querySubprocess runs a one-shot query on a new CLI process, starting
+// another after a transient failure as WithRetry allows.
+func querySubprocess(ctx context.Context, lines []string, options *types.ClaudeAgentOptions) (<-chan types.Message, error) {
+	retry := newRetrier(options)
+	for {
+		// Each attempt starts from the caller's options, since starting one
+		// adds hooks to them
+		attempt := options.Clone()
+		transportInst, err := newSubprocessTransport(attempt)
+		if err != nil {
+			return nil, err
+		}
+		messages, err := runQuery(ctx, lines, attempt, transportInst, retry.retries())
+		if err == nil || !retry.wait(ctx, "query", err) {
+			return messages, err
+		}
+	}
+}
+
+// resetTransport replaces the transport of a client whose Connect failed
+// with a new one for the next attempt. c.mu must be held.
+func (c *Client) resetTransport() error {
+	t, err := c.newTransport()
+	if err != nil {
+		return err
+	}
+	c.transport = t
+	c.conn = &lockedTransport{Transport: t}
+	return nil
+}
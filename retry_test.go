@@ -0,0 +1,150 @@
+package claude
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TestQuery_Retry tests that Query starts the CLI again when it exits
+// before its first message, up to the WithRetry limit.
+func TestQuery_Retry(t *testing.T) {
+	tests := []struct {
+		name        string
+		failRuns    int
+		maxAttempts int
+		wantErr     bool
+		wantRuns    int
+	}{
+		{"second attempt succeeds", 1, 2, false, 2},
+		{"attempts exhausted", 3, 2, true, 2},
+		{"one attempt", 1, 1, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cli := mockcli.New(t, mockcli.Scenario{FailRuns: tt.failRuns, EachPrompt: echoAnswer})
+			opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithRetry(tt.maxAttempts, 10*time.Millisecond)
+			messages, err := Query(ctx, "hello", opts)
+			if tt.wantErr {
+				if !types.IsProcessError(err) || !types.IsRetryable(err) {
+					t.Fatalf("Query error = %v, want the ProcessError of the last attempt", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Query failed: %v", err)
+				}
+				var result *types.ResultMessage
+				for msg := range messages {
+					if m, ok := msg.(*types.ResultMessage); ok {
+						result = m
+					}
+				}
+				// Without retries the failed run's empty stream is returned as before
+				if gotResult := result != nil; gotResult != (tt.maxAttempts > 1) {
+					t.Errorf("got result %v", result)
+				}
+			}
+			if got := cli.Runs(); got != tt.wantRuns {
+				t.Errorf("CLI ran %d times, want %d", got, tt.wantRuns)
+			}
+		})
+	}
+}
+
+// TestClient_ConnectRetry tests which Connect failures WithRetry retries.
+func TestClient_ConnectRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario mockcli.Scenario
+		timeout  time.Duration
+		wantErr  string // empty if Connect succeeds
+		wantRuns int
+	}{
+		{
+			name:     "CLI exits before the handshake",
+			scenario: mockcli.Scenario{FailRuns: 1, EachPrompt: echoAnswer},
+			wantRuns: 2,
+		},
+		{
+			name:     "handshake timeout",
+			scenario: mockcli.Scenario{Unanswered: []string{"initialize"}},
+			timeout:  200 * time.Millisecond,
+			wantErr:  "connect timed out",
+			wantRuns: 3,
+		},
+		{
+			name:     "refused handshake is not retried",
+			scenario: mockcli.Scenario{ControlErrors: map[string]string{"initialize": "unknown option"}},
+			wantErr:  "unknown option",
+			wantRuns: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cli := mockcli.New(t, tt.scenario)
+			opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithRetry(3, 10*time.Millisecond)
+			if tt.timeout > 0 {
+				opts.WithConnectTimeout(tt.timeout)
+			}
+			client, err := NewClient(ctx, opts)
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			defer client.Close(ctx)
+
+			err = client.Connect(ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Connect error = %v, want %q", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Connect failed: %v", err)
+				}
+				turn, err := client.RunTurn(ctx, "hello")
+				if err != nil || turn.Text != "ok" {
+					t.Fatalf("RunTurn = %v, %v after a retried Connect", turn, err)
+				}
+			}
+			if got := cli.Runs(); got != tt.wantRuns {
+				t.Errorf("CLI ran %d times, want %d", got, tt.wantRuns)
+			}
+		})
+	}
+}
+
+// TestClient_ConnectRetryCustomTransport tests that a client over a caller's
+// transport is not retried, since the transport cannot be started again.
+func TestClient_ConnectRetryCustomTransport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{FailRuns: 1, EachPrompt: echoAnswer})
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithRetry(3, 0)
+	transportInst, err := newSubprocessTransport(opts.Clone())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClientWithTransport(ctx, opts, transportInst)
+	if err != nil {
+		t.Fatalf("NewClientWithTransport failed: %v", err)
+	}
+	defer client.Close(ctx)
+
+	if err := client.Connect(ctx); !types.IsRetryable(err) {
+		t.Fatalf("Connect error = %v, want a transient failure", err)
+	}
+	if got := cli.Runs(); got != 1 {
+		t.Errorf("CLI ran %d times, want 1", got)
+	}
+}
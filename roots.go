@@ -0,0 +1,154 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/pathutil"
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// jailedPathInputs are the tool input fields that name a file or directory.
+var jailedPathInputs = []string{"file_path", "notebook_path", "path"}
+
+// applyAllowedRoots enforces WithAllowedRoots: it checks the working
+// directory and every added directory against the roots and installs a
+// PreToolUse hook that jails file tools to the roots that matched. It does
+// nothing when no roots are set. Callers pass their own copy of options.
+func applyAllowedRoots(options *types.ClaudeAgentOptions) error {
+	if len(options.AllowedRoots) == 0 {
+		return nil
+	}
+
+	roots := make([]string, 0, len(options.AllowedRoots))
+	for _, root := range options.AllowedRoots {
+		if root == "" {
+			return fmt.Errorf("allowed root cannot be empty")
+		}
+		resolved, err := resolveDir(root)
+		if err != nil {
+			return fmt.Errorf("failed to resolve allowed root %q: %w", root, err)
+		}
+		roots = append(roots, resolved)
+	}
+
+	// An unset CWD resolves to the caller's directory, which the CLI inherits
+	cwd := ""
+	if options.CWD != nil {
+		cwd = *options.CWD
+	}
+	dir, err := resolveDir(cwd)
+	if err != nil {
+		return types.NewWorkingDirectoryErrorWithCause("failed to resolve working directory", cwd, err)
+	}
+
+	jail := &rootJail{cwd: dir, fold: pathutil.FoldCase}
+	if err := jail.admit(dir, roots, "working directory is outside the allowed roots"); err != nil {
+		return err
+	}
+	for _, addDir := range options.AddDirs {
+		resolved, err := resolveDir(addDir)
+		if err != nil {
+			return types.NewWorkingDirectoryErrorWithCause("failed to resolve added directory", addDir, err)
+		}
+		if err := jail.admit(resolved, roots, "added directory is outside the allowed roots"); err != nil {
+			return err
+		}
+	}
+
+	options.WithHook(types.HookEventPreToolUse, types.HookMatcher{
+		Hooks:    []types.HookCallbackFunc{jail.hook},
+		Enforced: true,
+	})
+	return nil
+}
+
+// resolveDir makes path absolute and resolves its symlinks. A path that
+// does not exist yet, such as a WithCreateCWD directory, is resolved as far
+// as it exists.
+func resolveDir(path string) (string, error) {
+	abs, err := transport.AbsPath(path)
+	if err != nil {
+		return "", err
+	}
+	return pathutil.EvalSymlinksExisting(abs), nil
+}
+
+// rootJail confines the paths in file tool inputs to a set of directories.
+type rootJail struct {
+	cwd   string   // Resolved working directory that relative paths are joined to
+	roots []string // Resolved roots that contain the working and added directories
+	fold  bool     // Whether paths are compared case-insensitively
+}
+
+// admit adds the root of roots that contains dir to the jail, or returns an
+// UnsafeWorkingDirectoryError with message if none does.
+func (j *rootJail) admit(dir string, roots []string, message string) error {
+	for _, root := range roots {
+		if !pathutil.Within(dir, root, j.fold) {
+			continue
+		}
+		for _, jailed := range j.roots {
+			if jailed == root {
+				return nil
+			}
+		}
+		j.roots = append(j.roots, root)
+		return nil
+	}
+	return types.NewUnsafeWorkingDirectoryError(message, dir, roots)
+}
+
+// allows reports whether the tool input path, relative to the working
+// directory unless absolute, lies inside one of the jail's roots.
+func (j *rootJail) allows(path string) bool {
+	if !filepath.IsAbs(path) {
+		path = j.cwd + string(filepath.Separator) + path
+	}
+	resolved := pathutil.EvalSymlinksExisting(path)
+	for _, root := range j.roots {
+		if pathutil.Within(resolved, root, j.fold) {
+			return true
+		}
+	}
+	return false
+}
+
+// hook is the PreToolUse hook that denies tool calls naming a path outside
+// the jail. A Glob pattern is checked up to its first wildcard.
+func (j *rootJail) hook(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+	fields, _ := input.(map[string]interface{})
+	toolName, _ := fields["tool_name"].(string)
+	toolInput, _ := fields["tool_input"].(map[string]interface{})
+
+	paths := make([]string, 0, len(jailedPathInputs)+1)
+	for _, key := range jailedPathInputs {
+		if path, ok := stringInput(toolInput, key); ok && path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if toolName == "Glob" {
+		if pattern, ok := stringInput(toolInput, "pattern"); ok && filepath.IsAbs(pattern) {
+			if i := strings.IndexAny(pattern, "*?[{"); i >= 0 {
+				pattern = pattern[:i]
+			}
+			paths = append(paths, pattern)
+		}
+	}
+
+	for _, path := range paths {
+		if !j.allows(path) {
+			return map[string]interface{}{
+				"hookSpecificOutput": map[string]interface{}{
+					"hookEventName":            string(types.HookEventPreToolUse),
+					"permissionDecision":       string(types.PermissionBehaviorDeny),
+					"permissionDecisionReason": fmt.Sprintf("%s is outside the allowed roots (%s)", path, strings.Join(j.roots, ", ")),
+				},
+			}, nil
+		}
+	}
+	return map[string]interface{}{}, nil
+}
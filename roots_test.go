@@ -0,0 +1,242 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// newRootsTree creates a root directory with a project inside it and an
+// outside directory next to it, with symlinks resolved.
+func newRootsTree(t *testing.T) (root, project, outside string) {
+	t.Helper()
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(base, "root")
+	project = filepath.Join(root, "project")
+	outside = filepath.Join(base, "outside")
+	for _, dir := range []string{project, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, project, outside
+}
+
+// TestApplyAllowedRoots tests working and added directory validation.
+func TestApplyAllowedRoots(t *testing.T) {
+	root, project, outside := newRootsTree(t)
+	base := filepath.Dir(root)
+
+	linkToOutside := filepath.Join(root, "escape")
+	if err := os.Symlink(outside, linkToOutside); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	linkToRoot := filepath.Join(base, "link-to-root")
+	if err := os.Symlink(root, linkToRoot); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options *types.ClaudeAgentOptions
+		wantErr bool
+	}{
+		{"cwd inside root", types.NewClaudeAgentOptions().WithCWD(project).WithAllowedRoots(root), false},
+		{"cwd is the root", types.NewClaudeAgentOptions().WithCWD(root).WithAllowedRoots(root), false},
+		{"root with trailing slash", types.NewClaudeAgentOptions().WithCWD(project).WithAllowedRoots(root + string(filepath.Separator)), false},
+		{"cwd outside root", types.NewClaudeAgentOptions().WithCWD(outside).WithAllowedRoots(root), true},
+		{"cwd symlinked out of root", types.NewClaudeAgentOptions().WithCWD(linkToOutside).WithAllowedRoots(root), true},
+		{"root given through symlinked parent", types.NewClaudeAgentOptions().WithCWD(project).WithAllowedRoots(linkToRoot), false},
+		{"cwd given through symlinked parent", types.NewClaudeAgentOptions().WithCWD(filepath.Join(linkToRoot, "project")).WithAllowedRoots(root), false},
+		{"second root matches", types.NewClaudeAgentOptions().WithCWD(outside).WithAllowedRoots(root, outside), false},
+		{"missing cwd inside root", types.NewClaudeAgentOptions().WithCWD(filepath.Join(project, "new", "dir")).WithCreateCWD(true).WithAllowedRoots(root), false},
+		{"added directory inside root", types.NewClaudeAgentOptions().WithCWD(project).WithAddDirs(root).WithAllowedRoots(root), false},
+		{"added directory outside root", types.NewClaudeAgentOptions().WithCWD(project).WithAddDirs(outside).WithAllowedRoots(root), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := applyAllowedRoots(tt.options)
+			if tt.wantErr {
+				if !types.IsUnsafeWorkingDirectoryError(err) {
+					t.Fatalf("expected UnsafeWorkingDirectoryError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tt.options.Hooks[types.HookEventPreToolUse]) != 1 {
+				t.Error("expected the file jail hook to be installed")
+			}
+		})
+	}
+}
+
+// TestApplyAllowedRootsUnset tests that options without roots are left alone.
+func TestApplyAllowedRootsUnset(t *testing.T) {
+	options := types.NewClaudeAgentOptions().WithCWD(t.TempDir())
+	if err := applyAllowedRoots(options); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if options.Hooks != nil {
+		t.Error("expected no hooks without allowed roots")
+	}
+}
+
+// TestApplyAllowedRootsDefaultCWD tests that an unset CWD is checked as the caller's directory.
+func TestApplyAllowedRootsDefaultCWD(t *testing.T) {
+	_, _, outside := newRootsTree(t)
+	err := applyAllowedRoots(types.NewClaudeAgentOptions().WithAllowedRoots(outside))
+	if !types.IsUnsafeWorkingDirectoryError(err) {
+		t.Fatalf("expected UnsafeWorkingDirectoryError, got %v", err)
+	}
+}
+
+// TestRootJailHook tests that file tool paths outside the matched root are denied.
+func TestRootJailHook(t *testing.T) {
+	root, project, outside := newRootsTree(t)
+	other := filepath.Join(filepath.Dir(root), "other")
+	if err := os.Mkdir(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(project, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	// The jail covers the root that matched the working directory, not every root
+	options := types.NewClaudeAgentOptions().WithCWD(project).WithAllowedRoots(root, other)
+	if err := applyAllowedRoots(options); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hook := options.Hooks[types.HookEventPreToolUse][0].Hooks[0]
+
+	tests := []struct {
+		name     string
+		tool     string
+		input    map[string]interface{}
+		wantDeny bool
+	}{
+		{"relative file", "Read", map[string]interface{}{"file_path": "main.go"}, false},
+		{"absolute file in root", "Write", map[string]interface{}{"file_path": filepath.Join(root, "notes.md")}, false},
+		{"root itself", "Grep", map[string]interface{}{"pattern": "TODO", "path": root}, false},
+		{"file outside", "Read", map[string]interface{}{"file_path": filepath.Join(outside, "secret")}, true},
+		{"other root", "Read", map[string]interface{}{"file_path": filepath.Join(other, "file")}, true},
+		{"relative escape", "Edit", map[string]interface{}{"file_path": "../../outside/secret"}, true},
+		{"symlink escape", "Read", map[string]interface{}{"file_path": "escape/secret"}, true},
+		{"dot-dot after symlink", "Read", map[string]interface{}{"file_path": "escape/../../root/x"}, true},
+		{"notebook outside", "NotebookEdit", map[string]interface{}{"notebook_path": filepath.Join(outside, "nb.ipynb")}, true},
+		{"absolute glob outside", "Glob", map[string]interface{}{"pattern": filepath.Join(outside, "**", "*.go")}, true},
+		{"relative glob", "Glob", map[string]interface{}{"pattern": "**/*.go"}, false},
+		{"tool without paths", "Bash", map[string]interface{}{"command": "ls"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := map[string]interface{}{"tool_name": tt.tool, "tool_input": tt.input}
+			out, err := hook(context.Background(), input, nil, types.HookContext{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			specific, _ := out.(map[string]interface{})["hookSpecificOutput"].(map[string]interface{})
+			denied := specific["permissionDecision"] == string(types.PermissionBehaviorDeny)
+			if denied != tt.wantDeny {
+				t.Errorf("denied = %v, want %v (output %v)", denied, tt.wantDeny, out)
+			}
+		})
+	}
+}
+
+// TestNewClientAllowedRoots tests that NewClient rejects a working directory outside the roots.
+func TestNewClientAllowedRoots(t *testing.T) {
+	root, _, outside := newRootsTree(t)
+	cliPath := writeScriptedCLI(t)
+
+	options := types.NewClaudeAgentOptions().WithCLIPath(cliPath).WithCWD(outside).WithAllowedRoots(root)
+	_, err := NewClient(context.Background(), options)
+	if !types.IsUnsafeWorkingDirectoryError(err) {
+		t.Fatalf("expected UnsafeWorkingDirectoryError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), outside) {
+		t.Errorf("expected the error to name %s, got %v", outside, err)
+	}
+
+	_, err = Query(context.Background(), "hello", options)
+	if !types.IsUnsafeWorkingDirectoryError(err) {
+		t.Fatalf("expected UnsafeWorkingDirectoryError from Query, got %v", err)
+	}
+	if options.Hooks != nil {
+		t.Error("expected the caller's options to be left unchanged")
+	}
+}
+
+// TestQuery_AllowedRootsDeniesWriteOutside tests that one-shot queries run
+// the file jail hook, and that its denial stands when the CanUseTool callback
+// has precedence and would allow the write.
+func TestQuery_AllowedRootsDeniesWriteOutside(t *testing.T) {
+	tests := []struct {
+		name string
+		opts func(*types.ClaudeAgentOptions) *types.ClaudeAgentOptions
+	}{
+		{"hook precedence", func(o *types.ClaudeAgentOptions) *types.ClaudeAgentOptions { return o }},
+		{"callback precedence", func(o *types.ClaudeAgentOptions) *types.ClaudeAgentOptions {
+			return o.WithPermissionPrecedence(types.PermissionPrecedenceCallback).
+				WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+					return &types.PermissionResultAllow{}, nil
+				})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			root, project, outside := newRootsTree(t)
+			target := filepath.Join(outside, "stolen.txt")
+			hookCall := `{"type":"control_request","request_id":"req_hook_1","request":{"subtype":"hook_callback","callback_id":"hook_1","tool_use_id":"toolu_1","input":{"session_id":"s1","transcript_path":"/t.jsonl","cwd":"` + project + `","hook_event_name":"PreToolUse","tool_name":"Write","tool_input":{"file_path":"` + target + `","content":"x"}}}}`
+
+			cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+				mockcli.AwaitPrompt(),
+				mockcli.Send(hookCall),
+				mockcli.AwaitResponse("req_hook_1"),
+				mockcli.Send(streamResult),
+			}})
+			opts := tt.opts(types.NewClaudeAgentOptions().
+				WithCLIPath(cli.Path).
+				WithCWD(project).
+				WithAllowedRoots(root).
+				WithStrictProtocol(true))
+
+			messages, err := Query(ctx, "write outside", opts)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			for range messages {
+			}
+
+			data := receivedResponse(t, cli, "req_hook_1")
+			var frame struct {
+				Response struct {
+					RequestID string `json:"request_id"`
+					Response  struct {
+						HookSpecificOutput map[string]interface{} `json:"hookSpecificOutput"`
+					} `json:"response"`
+				} `json:"response"`
+			}
+			if err := json.Unmarshal(data, &frame); err != nil {
+				t.Fatalf("decode hook response %s: %v", data, err)
+			}
+			if frame.Response.RequestID != "req_hook_1" || frame.Response.Response.HookSpecificOutput["permissionDecision"] != "deny" {
+				t.Errorf("hook response = %s, want the Write denied", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+// Package schema defines the versioned format of the event records the SDK
+// writes for consumers outside the process, such as log pipelines reading the
+// session transcript written with WithTranscript or a trace recorded with
+// claudetest.RecordingTransport.
+//
+// Each record is one JSON object per line. Its "schema" field names the
+// version of the format, and its "kind" field what it records:
+//
+//   - message: a message the SDK exchanged with the CLI, in "message"
+//   - control: a control request or response, in "message"
+//   - decision: a permission or hook decision the SDK made, in "decision"
+//   - lifecycle: a change in the session's state, in "lifecycle"
+//   - state: a log record of what the SDK was doing, in "state"
+//
+// Message and control records also carry the "direction" of the message:
+// "out" for lines the SDK wrote to the CLI and "in" for lines it read. Traces
+// add "offset_ns", the time since the recording started from the monotonic
+// clock, to every record.
+//
+//	{"schema":"claude-agent-sdk.event.v1","time":"2026-10-15T09:30:00Z","kind":"message","direction":"in","message":{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Hello"}]}}}
+//
+// Validate checks a record against its version, and JSONSchema returns the
+// JSON Schema of a version for tools written in other languages.
+//
+// # Versions
+//
+// A version only ever gains optional fields. Removing or renaming a field, or
+// changing its meaning, makes a new version, which is announced in the
+// changelog and described below. Consumers should accept unknown kinds and
+// ignore them.
+//
+// Version1 ("claude-agent-sdk.event.v1") is the first version. It later
+// gained the state kind and the optional "offset_ns" field for traces.
+//
+// # Migrating to v1
+//
+// Transcripts written by earlier releases have records without the "schema"
+// and "kind" fields; otherwise their records are v1 records. To migrate one,
+// add "schema":"claude-agent-sdk.event.v1" to each record, and "kind":
+// "control" if the type of its message starts with "control_", or "message"
+// if not. LoadTranscript reads both forms.
+//
+// Traces written by earlier releases hold frames with "time", "offset_ns",
+// "direction" and "data" fields. To migrate a frame with direction "in" or
+// "out", rename "data" to "message" and add "schema" and "kind" as for a
+// transcript record. A frame with direction "state" becomes a state record:
+// drop "direction" and rename "data" to "state". claudetest.ReadFrames reads
+// both forms.
+package schema
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Version1 is the first version of the record format.
+const Version1 = "claude-agent-sdk.event.v1"
+
+// Current is the version the SDK writes.
+const Current = Version1
+
+// Kind is what a record records.
+type Kind string
+
+const (
+	// KindMessage records a message exchanged with the CLI.
+	KindMessage Kind = "message"
+	// KindControl records a control request or response.
+	KindControl Kind = "control"
+	// KindDecision records a permission or hook decision.
+	KindDecision Kind = "decision"
+	// KindLifecycle records a change in the session's state.
+	KindLifecycle Kind = "lifecycle"
+	// KindState records a log record of the SDK.
+	KindState Kind = "state"
+)
+
+// Direction is which side sent the message of a record.
+type Direction string
+
+const (
+	// DirectionOut is a line the SDK wrote to the CLI.
+	DirectionOut Direction = "out"
+	// DirectionIn is a line the SDK read from the CLI.
+	DirectionIn Direction = "in"
+)
+
+// Record is one event record.
+type Record struct {
+	Schema string        `json:"schema"`
+	Time   time.Time     `json:"time"`
+	Offset time.Duration `json:"offset_ns,omitempty"` // Optional; since a trace started, from the monotonic clock
+	Kind   Kind          `json:"kind"`
+
+	// Direction and Message are set for message and control records. Message
+	// is the JSON message, or a JSON string for a line that was not JSON.
+	Direction Direction       `json:"direction,omitempty"`
+	Message   json.RawMessage `json:"message,omitempty"`
+
+	// Decision is set for decision records
+	Decision *Decision `json:"decision,omitempty"`
+
+	// Lifecycle is set for lifecycle records
+	Lifecycle *Lifecycle `json:"lifecycle,omitempty"`
+
+	// State is set for state records
+	State *State `json:"state,omitempty"`
+}
+
+// Decision is a permission or hook decision the SDK made.
+type Decision struct {
+	// Type is "permission" for a can_use_tool request or "hook" for a hook
+	// callback
+	Type string `json:"type"`
+
+	// Behavior is "allow", "deny" or "ask"
+	Behavior string `json:"behavior"`
+
+	RequestID string `json:"request_id,omitempty"`  // Optional
+	ToolName  string `json:"tool_name,omitempty"`   // Optional
+	ToolUseID string `json:"tool_use_id,omitempty"` // Optional
+	Reason    string `json:"reason,omitempty"`      // Optional; shown to the model
+}
+
+// Lifecycle is a change in the session's state.
+type Lifecycle struct {
+	// Event is "connect", "close" or "error"
+	Event string `json:"event"`
+
+	SessionID string `json:"session_id,omitempty"` // Optional
+	Error     string `json:"error,omitempty"`      // Set for "error"
+}
+
+// State is a log record of what the SDK was doing, such as "connect started"
+// or "control request to CLI", with its attributes.
+type State struct {
+	Event string                 `json:"event"`
+	Level string                 `json:"level"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"` // Optional
+}
+
+// ErrUnsupportedVersion is returned by Validate for a record of a version
+// this package does not know.
+var ErrUnsupportedVersion = errors.New("schema: unsupported version")
+
+//go:embed event.v1.schema.json
+var v1Schema []byte
+
+// JSONSchema returns the JSON Schema of version, or nil if the version is
+// unknown.
+func JSONSchema(version string) []byte {
+	if version == Version1 {
+		return append([]byte(nil), v1Schema...)
+	}
+	return nil
+}
+
+// Validate reports whether data is a valid record of its version. Records
+// of an unknown version fail with an error wrapping ErrUnsupportedVersion.
+func Validate(data []byte) error {
+	var head struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return fmt.Errorf("schema: invalid record: %w", err)
+	}
+	if head.Schema != Version1 {
+		return fmt.Errorf("%w %q", ErrUnsupportedVersion, head.Schema)
+	}
+
+	var r Record
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&r); err != nil {
+		return fmt.Errorf("schema: invalid record: %w", err)
+	}
+	if r.Time.IsZero() {
+		return errors.New("schema: record has no time")
+	}
+	return r.validate()
+}
+
+// validate checks the fields of a v1 record for its kind.
+func (r *Record) validate() error {
+	switch r.Kind {
+	case KindMessage, KindControl:
+		if r.Direction != DirectionIn && r.Direction != DirectionOut {
+			return fmt.Errorf("schema: %s record has invalid direction %q", r.Kind, r.Direction)
+		}
+		if r.Decision != nil || r.Lifecycle != nil || r.State != nil {
+			return fmt.Errorf("schema: %s record has a decision, lifecycle or state", r.Kind)
+		}
+		return validateMessage(r.Kind, r.Message)
+	case KindDecision:
+		if r.Decision == nil {
+			return errors.New("schema: decision record has no decision")
+		}
+		if r.Direction != "" || r.Message != nil || r.Lifecycle != nil || r.State != nil {
+			return errors.New("schema: decision record has other fields")
+		}
+		if r.Decision.Type != "permission" && r.Decision.Type != "hook" {
+			return fmt.Errorf("schema: invalid decision type %q", r.Decision.Type)
+		}
+		switch r.Decision.Behavior {
+		case "allow", "deny", "ask":
+		default:
+			return fmt.Errorf("schema: invalid decision behavior %q", r.Decision.Behavior)
+		}
+	case KindLifecycle:
+		if r.Lifecycle == nil {
+			return errors.New("schema: lifecycle record has no lifecycle")
+		}
+		if r.Direction != "" || r.Message != nil || r.Decision != nil || r.State != nil {
+			return errors.New("schema: lifecycle record has other fields")
+		}
+		switch r.Lifecycle.Event {
+		case "connect", "close":
+		case "error":
+			if r.Lifecycle.Error == "" {
+				return errors.New("schema: error lifecycle record has no error")
+			}
+		default:
+			return fmt.Errorf("schema: invalid lifecycle event %q", r.Lifecycle.Event)
+		}
+	case KindState:
+		if r.State == nil {
+			return errors.New("schema: state record has no state")
+		}
+		if r.Direction != "" || r.Message != nil || r.Decision != nil || r.Lifecycle != nil {
+			return errors.New("schema: state record has other fields")
+		}
+		if r.State.Event == "" || r.State.Level == "" {
+			return errors.New("schema: state record has no event or level")
+		}
+	default:
+		return fmt.Errorf("schema: invalid kind %q", r.Kind)
+	}
+	return nil
+}
+
+// validateMessage checks the message of a message or control record: a JSON
+// object with a type, or a string for a line that was not JSON. Only
+// control records hold control messages.
+func validateMessage(kind Kind, message json.RawMessage) error {
+	if len(message) == 0 {
+		return fmt.Errorf("schema: %s record has no message", kind)
+	}
+	var text string
+	if json.Unmarshal(message, &text) == nil {
+		if kind == KindControl {
+			return errors.New("schema: control record has no control message")
+		}
+		return nil
+	}
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil || msg.Type == "" {
+		return fmt.Errorf("schema: %s record message is not an object with a type", kind)
+	}
+	if control := strings.HasPrefix(msg.Type, "control_"); control != (kind == KindControl) {
+		return fmt.Errorf("schema: %s record holds a %s message", kind, msg.Type)
+	}
+	return nil
+}
+
+// KindOf returns the kind of record for a message exchanged with the CLI:
+// KindControl for control messages and KindMessage for the rest.
+func KindOf(message []byte) Kind {
+	var msg struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(message, &msg) == nil && strings.HasPrefix(msg.Type, "control_") {
+		return KindControl
+	}
+	return KindMessage
+}
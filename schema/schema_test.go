@@ -0,0 +1,152 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	const head = `"schema":"claude-agent-sdk.event.v1","time":"2026-10-15T09:30:00Z"`
+	tests := []struct {
+		name    string
+		record  string
+		wantErr string // empty for a valid record
+	}{
+		{"message", `{` + head + `,"kind":"message","direction":"in","message":{"type":"assistant","message":{}}}`, ""},
+		{"unparsed line", `{` + head + `,"kind":"message","direction":"in","message":"{not json"}`, ""},
+		{"control", `{` + head + `,"kind":"control","direction":"out","message":{"type":"control_request","request_id":"req_1"}}`, ""},
+		{"decision", `{` + head + `,"kind":"decision","decision":{"type":"permission","behavior":"deny","tool_name":"Bash","tool_use_id":"toolu_1","reason":"no"}}`, ""},
+		{"lifecycle", `{` + head + `,"kind":"lifecycle","lifecycle":{"event":"connect","session_id":"s1"}}`, ""},
+		{"lifecycle error", `{` + head + `,"kind":"lifecycle","lifecycle":{"event":"error","error":"CLI exited"}}`, ""},
+		{"state", `{` + head + `,"offset_ns":1500,"kind":"state","state":{"event":"connect started","level":"INFO","attrs":{"cli":"claude"}}}`, ""},
+		{"trace message", `{` + head + `,"offset_ns":2000,"kind":"message","direction":"in","message":{"type":"result"}}`, ""},
+
+		{"not JSON", `{`, "invalid record"},
+		{"no time", `{"schema":"claude-agent-sdk.event.v1","kind":"lifecycle","lifecycle":{"event":"close"}}`, "no time"},
+		{"unknown field", `{` + head + `,"kind":"lifecycle","lifecycle":{"event":"close"},"extra":1}`, "unknown field"},
+		{"unknown kind", `{` + head + `,"kind":"metric"}`, "invalid kind"},
+		{"no direction", `{` + head + `,"kind":"message","message":{"type":"user"}}`, "invalid direction"},
+		{"no message", `{` + head + `,"kind":"message","direction":"in"}`, "no message"},
+		{"message without type", `{` + head + `,"kind":"message","direction":"in","message":{}}`, "not an object with a type"},
+		{"control message as message", `{` + head + `,"kind":"message","direction":"in","message":{"type":"control_response"}}`, "holds a control_response"},
+		{"message as control", `{` + head + `,"kind":"control","direction":"in","message":{"type":"result"}}`, "holds a result"},
+		{"decision without decision", `{` + head + `,"kind":"decision"}`, "no decision"},
+		{"decision with message", `{` + head + `,"kind":"decision","message":{"type":"user"},"decision":{"type":"hook","behavior":"allow"}}`, "other fields"},
+		{"decision behavior", `{` + head + `,"kind":"decision","decision":{"type":"hook","behavior":"maybe"}}`, "invalid decision behavior"},
+		{"lifecycle event", `{` + head + `,"kind":"lifecycle","lifecycle":{"event":"restart"}}`, "invalid lifecycle event"},
+		{"lifecycle error without error", `{` + head + `,"kind":"lifecycle","lifecycle":{"event":"error"}}`, "no error"},
+		{"state without state", `{` + head + `,"kind":"state"}`, "no state"},
+		{"state with direction", `{` + head + `,"kind":"state","direction":"in","state":{"event":"e","level":"INFO"}}`, "other fields"},
+		{"state without event", `{` + head + `,"kind":"state","state":{"level":"INFO"}}`, "no event"},
+		{"message with state", `{` + head + `,"kind":"message","direction":"in","message":{"type":"user"},"state":{"event":"e","level":"INFO"}}`, "decision, lifecycle or state"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.record))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_UnsupportedVersion(t *testing.T) {
+	for _, record := range []string{
+		`{"schema":"claude-agent-sdk.event.v2","time":"2026-10-15T09:30:00Z","kind":"message"}`,
+		`{"time":"2026-10-15T09:30:00Z","direction":"in","message":{"type":"user"}}`,
+	} {
+		if err := Validate([]byte(record)); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("Validate(%s) = %v, want ErrUnsupportedVersion", record, err)
+		}
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	for message, want := range map[string]Kind{
+		`{"type":"control_request"}`:        KindControl,
+		`{"type":"control_cancel_request"}`: KindControl,
+		`{"type":"assistant"}`:              KindMessage,
+		`not json`:                          KindMessage,
+	} {
+		if got := KindOf([]byte(message)); got != want {
+			t.Errorf("KindOf(%s) = %q, want %q", message, got, want)
+		}
+	}
+}
+
+// TestJSONSchema_MatchesRecord tests that the published JSON Schema describes
+// the same fields and values as the Go types and Validate.
+func TestJSONSchema_MatchesRecord(t *testing.T) {
+	if JSONSchema("claude-agent-sdk.event.v0") != nil {
+		t.Error("JSONSchema of an unknown version is not nil")
+	}
+
+	type property struct {
+		Const      string              `json:"const"`
+		Enum       []string            `json:"enum"`
+		Required   []string            `json:"required"`
+		Properties map[string]property `json:"properties"`
+	}
+	var doc property
+	if err := json.Unmarshal(JSONSchema(Version1), &doc); err != nil {
+		t.Fatalf("JSON Schema does not parse: %v", err)
+	}
+
+	if got := doc.Properties["schema"].Const; got != Version1 {
+		t.Errorf("schema const = %q, want %q", got, Version1)
+	}
+	kinds := []string{string(KindMessage), string(KindControl), string(KindDecision), string(KindLifecycle), string(KindState)}
+	if got := doc.Properties["kind"].Enum; !sameSet(got, kinds) {
+		t.Errorf("kind enum = %v, want %v", got, kinds)
+	}
+	if got := doc.Properties["direction"].Enum; !sameSet(got, []string{string(DirectionIn), string(DirectionOut)}) {
+		t.Errorf("direction enum = %v", got)
+	}
+
+	for _, tt := range []struct {
+		name string
+		doc  property
+		typ  reflect.Type
+	}{
+		{"record", doc, reflect.TypeOf(Record{})},
+		{"decision", doc.Properties["decision"], reflect.TypeOf(Decision{})},
+		{"lifecycle", doc.Properties["lifecycle"], reflect.TypeOf(Lifecycle{})},
+		{"state", doc.Properties["state"], reflect.TypeOf(State{})},
+	} {
+		var fields, required []string
+		for i := 0; i < tt.typ.NumField(); i++ {
+			name, opts, _ := strings.Cut(tt.typ.Field(i).Tag.Get("json"), ",")
+			fields = append(fields, name)
+			if opts != "omitempty" {
+				required = append(required, name)
+			}
+		}
+		var properties []string
+		for name := range tt.doc.Properties {
+			properties = append(properties, name)
+		}
+		if !sameSet(properties, fields) {
+			t.Errorf("%s properties = %v, want the fields %v", tt.name, properties, fields)
+		}
+		if !sameSet(tt.doc.Required, required) {
+			t.Errorf("%s required = %v, want %v", tt.name, tt.doc.Required, required)
+		}
+	}
+}
+
+func sameSet(a, b []string) bool {
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
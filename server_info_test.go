@@ -0,0 +1,64 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestClient_GetServerInfo(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fixture, err := os.ReadFile("types/testdata/initialize_response.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, fixture); err != nil {
+		t.Fatal(err)
+	}
+
+	cli := mockcli.New(t, mockcli.Scenario{
+		ControlResponses: map[string]json.RawMessage{"initialize": compact.Bytes()},
+	})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(context.Background())
+
+	if _, err := client.GetServerInfo(); !types.IsCLIConnectionError(err) {
+		t.Errorf("GetServerInfo before Connect: expected CLIConnectionError, got %v", err)
+	}
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	info, err := client.GetServerInfo()
+	if err != nil {
+		t.Fatalf("GetServerInfo failed: %v", err)
+	}
+	if len(info.Commands) != 3 || info.Commands[0].Name != "compact" {
+		t.Errorf("Commands = %+v", info.Commands)
+	}
+	if info.OutputStyle != "default" || len(info.AvailableOutputStyles) != 3 {
+		t.Errorf("output styles = %q %v", info.OutputStyle, info.AvailableOutputStyles)
+	}
+	if info.Account == nil || info.Account.Email != "dev@example.com" {
+		t.Errorf("Account = %+v", info.Account)
+	}
+	if info.CLIVersion != "2.1.0" {
+		t.Errorf("CLIVersion = %q, want 2.1.0", info.CLIVersion)
+	}
+	if _, ok := info.Raw["fast_mode"]; !ok {
+		t.Error("Raw is missing undecoded field fast_mode")
+	}
+}
@@ -0,0 +1,141 @@
+package claude
+
+import (
+	"context"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// splitBufferSize is how many chunks each SplitResponse stream holds before
+// a slow reader of that stream holds up the other one.
+const splitBufferSize = 64
+
+// SplitResponse receives the current turn like ReceiveResponse, but delivers
+// the assistant's answer text and its thinking on separate channels, for UIs
+// that show thinking apart from the answer. Call it after Query.
+//
+// With WithIncludePartialMessages the channels carry text and thinking deltas
+// as they stream; otherwise each carries whole text or thinking blocks. Either
+// way every piece of content is delivered once. Tool use, tool results and
+// system messages are not delivered; use ReceiveResponse or Process to see them.
+//
+// Both channels are closed when the turn ends, and then done delivers the
+// turn's ResultMessage and is closed. If the turn ends without a result (ctx
+// is cancelled or the transport fails), done is closed without a value, or
+// delivers the synthetic result with WithSyntheticResults; see Err for the
+// cause. The thinking channel is simply closed empty when the
+// model does not think.
+//
+// Each channel buffers up to 64 chunks, so a reader that falls behind on one
+// does not hold up the other until that buffer is full. Read both channels
+// concurrently, for example in one select loop, or drain one from its own
+// goroutine.
+//
+// Example:
+//
+//	answers, thinking, done := client.SplitResponse(ctx)
+//	for answers != nil || thinking != nil {
+//	    select {
+//	    case s, ok := <-answers:
+//	        if !ok {
+//	            answers = nil
+//	            continue
+//	        }
+//	        ui.AppendAnswer(s)
+//	    case s, ok := <-thinking:
+//	        if !ok {
+//	            thinking = nil
+//	            continue
+//	        }
+//	        ui.AppendThinking(s)
+//	    }
+//	}
+//	if result := <-done; result != nil {
+//	    fmt.Printf("Cost: $%.4f\n", *result.TotalCostUSD)
+//	}
+func (c *Client) SplitResponse(ctx context.Context) (answers <-chan string, thinking <-chan string, done <-chan *types.ResultMessage) {
+	answerCh := make(chan string, splitBufferSize)
+	thinkingCh := make(chan string, splitBufferSize)
+	doneCh := make(chan *types.ResultMessage, 1)
+
+	messages := c.ReceiveResponse(ctx)
+	c.goLabeled(func() {
+		var result *types.ResultMessage
+		defer func() {
+			close(answerCh)
+			close(thinkingCh)
+			if result != nil {
+				doneCh <- result
+			}
+			close(doneCh)
+		}()
+
+		s := &splitter{ctx: ctx, answers: answerCh, thinking: thinkingCh}
+		for msg := range messages {
+			if m, ok := msg.(*types.ResultMessage); ok {
+				result = m
+				continue
+			}
+			s.message(msg)
+		}
+	})
+	return answerCh, thinkingCh, doneCh
+}
+
+// splitter routes a turn's content to the answer and thinking channels.
+type splitter struct {
+	ctx      context.Context
+	answers  chan<- string
+	thinking chan<- string
+
+	// streamed is set once deltas arrive for the message being streamed, so
+	// the complete AssistantMessage that follows them is not delivered again
+	streamed bool
+}
+
+// message delivers the text and thinking of one message.
+func (s *splitter) message(msg types.Message) {
+	switch m := msg.(type) {
+	case *types.StreamEvent:
+		event, err := m.Decode()
+		if err != nil {
+			return
+		}
+		delta, ok := event.(*types.ContentBlockDeltaEvent)
+		if !ok {
+			return
+		}
+		switch d := delta.Delta.(type) {
+		case *types.TextDelta:
+			s.streamed = true
+			s.send(s.answers, d.Text)
+		case *types.ThinkingDelta:
+			s.streamed = true
+			s.send(s.thinking, d.Thinking)
+		}
+	case *types.AssistantMessage:
+		if s.streamed {
+			s.streamed = false
+			return
+		}
+		for _, block := range m.Content {
+			switch b := block.(type) {
+			case *types.TextBlock:
+				s.send(s.answers, b.Text)
+			case *types.ThinkingBlock:
+				s.send(s.thinking, b.Thinking)
+			}
+		}
+	}
+}
+
+// send delivers one chunk unless it is empty or ctx is done.
+func (s *splitter) send(ch chan<- string, chunk string) {
+	if chunk == "" {
+		return
+	}
+	select {
+	case ch <- chunk:
+	case <-s.ctx.Done():
+	}
+}
@@ -0,0 +1,196 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Assistant messages mirroring the parser's thinking fixtures
+const (
+	splitThinkingAssistant = `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[` +
+		`{"type":"thinking","thinking":"Let me analyze this problem step by step...","signature":"sig_abc123"},` +
+		`{"type":"text","text":"Based on my analysis, the answer is 42."}]}}`
+	splitToolAssistant = `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[` +
+		`{"type":"thinking","thinking":"I need to use the bash tool","signature":"sig_def456"},` +
+		`{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"ls"}}]}}`
+)
+
+// splitStreamEvent returns a stream_event line carrying one delta.
+func splitStreamEvent(delta string) string {
+	return `{"type":"stream_event","uuid":"u","session_id":"s","event":{"type":"content_block_delta","index":0,"delta":` + delta + `}}`
+}
+
+// collectSplit reads both streams concurrently until they close and returns
+// what each delivered, and the result.
+func collectSplit(t *testing.T, client *Client, ctx context.Context) (answers, thinking []string, resultOK bool) {
+	t.Helper()
+	a, th, done := client.SplitResponse(ctx)
+	for a != nil || th != nil {
+		select {
+		case s, ok := <-a:
+			if !ok {
+				a = nil
+				continue
+			}
+			answers = append(answers, s)
+		case s, ok := <-th:
+			if !ok {
+				th = nil
+				continue
+			}
+			thinking = append(thinking, s)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out reading SplitResponse")
+		}
+	}
+	result := <-done
+	return answers, thinking, result != nil
+}
+
+func TestSplitResponse_Blocks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx, splitToolAssistant, splitThinkingAssistant, streamResult)
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	answers, thinking, ok := collectSplit(t, client, ctx)
+	if !ok {
+		t.Error("done delivered no result")
+	}
+	if want := []string{"Based on my analysis, the answer is 42."}; fmt.Sprint(answers) != fmt.Sprint(want) {
+		t.Errorf("answers = %q, want %q", answers, want)
+	}
+	if want := []string{"I need to use the bash tool", "Let me analyze this problem step by step..."}; fmt.Sprint(thinking) != fmt.Sprint(want) {
+		t.Errorf("thinking = %q, want %q", thinking, want)
+	}
+}
+
+func TestSplitResponse_NoThinking(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx, streamAssistant, streamResult)
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	answers, thinking, ok := collectSplit(t, client, ctx)
+	if !ok || len(answers) != 1 || answers[0] != "ok" {
+		t.Errorf("answers = %q, result %v; want [ok] and a result", answers, ok)
+	}
+	if len(thinking) != 0 {
+		t.Errorf("thinking = %q, want none", thinking)
+	}
+}
+
+// TestSplitResponse_Deltas tests a synthetic delta stream followed by the
+// complete message, which must not be delivered a second time.
+func TestSplitResponse_Deltas(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx,
+		splitStreamEvent(`{"type":"thinking_delta","thinking":"First, consider"}`),
+		splitStreamEvent(`{"type":"thinking_delta","thinking":" the input."}`),
+		splitStreamEvent(`{"type":"signature_delta","signature":"sig"}`),
+		splitStreamEvent(`{"type":"text_delta","text":"The answer"}`),
+		splitStreamEvent(`{"type":"input_json_delta","partial_json":"{\"a\":"}`),
+		splitStreamEvent(`{"type":"text_delta","text":" is 42."}`),
+		`{"type":"assistant","message":{"model":"m","content":[{"type":"thinking","thinking":"First, consider the input.","signature":"sig"},{"type":"text","text":"The answer is 42."}]}}`,
+		splitStreamEvent(`{"type":"text_delta","text":"Second message."}`),
+		`{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"Second message."}]}}`,
+		streamResult,
+	)
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	answers, thinking, ok := collectSplit(t, client, ctx)
+	if !ok {
+		t.Error("done delivered no result")
+	}
+	if got := strings.Join(answers, "|"); got != "The answer| is 42.|Second message." {
+		t.Errorf("answers = %q", answers)
+	}
+	if got := strings.Join(thinking, "|"); got != "First, consider| the input." {
+		t.Errorf("thinking = %q", thinking)
+	}
+}
+
+// TestSplitResponse_Backpressure tests that answers keep flowing while the
+// thinking stream is not read, as long as its buffer has room.
+func TestSplitResponse_Backpressure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lines := make([]string, 0, splitBufferSize+2)
+	for i := 0; i < splitBufferSize; i++ {
+		lines = append(lines, splitStreamEvent(fmt.Sprintf(`{"type":"thinking_delta","thinking":"t%d"}`, i)))
+	}
+	lines = append(lines, splitStreamEvent(`{"type":"text_delta","text":"answer"}`), streamResult)
+	client := connectScripted(t, ctx, lines...)
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	answers, thinking, done := client.SplitResponse(ctx)
+
+	// Read the answer stream to its end without touching thinking
+	var got []string
+	for s := range answers {
+		got = append(got, s)
+	}
+	if len(got) != 1 || got[0] != "answer" {
+		t.Errorf("answers = %q, want [answer]", got)
+	}
+
+	n := 0
+	for range thinking {
+		n++
+	}
+	if n != splitBufferSize {
+		t.Errorf("thinking delivered %d chunks, want %d", n, splitBufferSize)
+	}
+	if <-done == nil {
+		t.Error("done delivered no result")
+	}
+}
+
+func TestSplitResponse_Cancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The CLI never finishes the turn
+	client := connectScripted(t, ctx, streamAssistant)
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	turnCtx, cancelTurn := context.WithCancel(ctx)
+	answers, thinking, done := client.SplitResponse(turnCtx)
+	if s := <-answers; s != "ok" {
+		t.Errorf("first answer = %q, want ok", s)
+	}
+	cancelTurn()
+
+	select {
+	case result, ok := <-done:
+		if ok || result != nil {
+			t.Errorf("done delivered %v, want it closed without a result", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("done was not closed after cancel")
+	}
+	if _, ok := <-answers; ok {
+		t.Error("answers not closed")
+	}
+	if _, ok := <-thinking; ok {
+		t.Error("thinking not closed")
+	}
+}
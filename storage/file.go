@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileSuffix names entry files; temporary files being written lack it.
+const fileSuffix = ".json"
+
+// FileStore is a Store that keeps each entry in its own file in a
+// directory, so that entries survive a restart of the process. Writes
+// replace files atomically, so a reader never sees a partial value, and
+// several processes may share the directory. Expired entries are skipped
+// by Get and List; their files stay until the key is put or deleted again,
+// or until Prune removes them.
+//
+// Files are named by a hash of the key, which is stored in the file, so
+// keys may hold any characters. List reads every entry, which suits the
+// hundreds to thousands of entries the SDK keeps rather than large data sets.
+type FileStore struct {
+	dir string
+	now func() time.Time
+}
+
+// fileEntry is the content of an entry file.
+type fileEntry struct {
+	Key     string    `json:"key"`
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewFileStore returns a FileStore keeping its entries in dir, which is
+// created if it does not exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("storage: create store directory: %w", err)
+	}
+	return &FileStore{dir: dir, now: time.Now}, nil
+}
+
+// path returns the file holding key.
+func (s *FileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+fileSuffix)
+}
+
+// Get implements Store.
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	entry, err := readEntry(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if entry.Key != key {
+		return nil, ErrNotFound
+	}
+	if expired(entry.Expires, s.now()) {
+		return nil, ErrNotFound
+	}
+	return entry.Value, nil
+}
+
+// Put implements Store.
+func (s *FileStore) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return errEmptyKey
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(fileEntry{Key: key, Value: value, Expires: expiry(s.now(), ttl)})
+	if err != nil {
+		return fmt.Errorf("storage: encode entry: %w", err)
+	}
+
+	f, err := os.CreateTemp(s.dir, ".put-*")
+	if err != nil {
+		return fmt.Errorf("storage: write entry: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("storage: write entry: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("storage: write entry: %w", err)
+	}
+	if err := os.Rename(f.Name(), s.path(key)); err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("storage: write entry: %w", err)
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("storage: delete entry: %w", err)
+	}
+	return nil
+}
+
+// List implements Store.
+func (s *FileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	keys := []string{}
+	err := s.walk(func(path string, entry *fileEntry) {
+		if strings.HasPrefix(entry.Key, prefix) && !expired(entry.Expires, now) {
+			keys = append(keys, entry.Key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Prune removes the files of expired entries and returns how many it
+// removed. Run it now and then, for example daily, from one process. An
+// entry put again while Prune runs may be lost if it was expired just
+// before.
+func (s *FileStore) Prune(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	removed := 0
+	err := s.walk(func(path string, entry *fileEntry) {
+		if expired(entry.Expires, now) && os.Remove(path) == nil {
+			removed++
+		}
+	})
+	return removed, err
+}
+
+// walk calls fn for every entry file in the directory.
+func (s *FileStore) walk(fn func(path string, entry *fileEntry)) error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("storage: list entries: %w", err)
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), fileSuffix) {
+			continue
+		}
+		path := filepath.Join(s.dir, file.Name())
+		entry, err := readEntry(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Deleted since the directory was read
+		}
+		if err != nil {
+			return err
+		}
+		fn(path, entry)
+	}
+	return nil
+}
+
+// readEntry reads and decodes an entry file.
+func readEntry(path string) (*fileEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entry fileEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("storage: decode %s: %w", filepath.Base(path), err)
+	}
+	return &entry, nil
+}
@@ -0,0 +1,67 @@
+// Package storage defines Store, the key-value interface behind the SDK's
+// features that keep data between calls or processes, with an in-memory
+// implementation for a single process and a file-backed one for data that
+// must survive a restart.
+//
+// The SDK's CacheWithStore middleware and QueryBatch checkpoints (see
+// BatchOptions.CheckpointStore) take a Store. An application that already
+// runs a shared store, such as Redis, backs every such feature with it by
+// implementing Store once. Package storagetest
+// holds the contract tests an implementation must pass:
+//
+//	func TestRedisStore(t *testing.T) {
+//	    storagetest.Run(t, func(t *testing.T) storage.Store {
+//	        return newRedisStore(t)
+//	    })
+//	}
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Get for a key that is missing or has expired.
+var ErrNotFound = errors.New("storage: key not found")
+
+// Store is a key-value store with optional expiry. Implementations must be
+// safe for concurrent use.
+//
+// Keys are non-empty strings, conventionally made of segments joined by
+// "/" so that List can select them by prefix. Values are opaque bytes; Store
+// never retains the slices passed to Put or returned from Get.
+type Store interface {
+	// Get returns the value stored under key, or ErrNotFound if there is
+	// none or it has expired.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Put stores value under key, replacing any value there. A positive
+	// ttl makes the entry expire after that long; zero or less keeps it
+	// until it is deleted.
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// List returns the keys starting with prefix that have not expired, in
+	// ascending order. An empty prefix lists every key.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// errEmptyKey is returned for an empty key.
+var errEmptyKey = errors.New("storage: empty key")
+
+// expiry returns when an entry put at now with ttl expires, or the zero
+// time if it never does.
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// expired reports whether an entry expiring at expires has expired at now.
+func expired(expires, now time.Time) bool {
+	return !expires.IsZero() && !now.Before(expires)
+}
@@ -0,0 +1,83 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/storage"
+	"github.com/schlunsen/claude-agent-sdk-go/storage/storagetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.NewMemoryStore()
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := storage.NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileStore failed: %v", err)
+		}
+		return s
+	})
+}
+
+func TestFileStore_Persists(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	first, err := storage.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	if err := first.Put(ctx, "sessions/a", []byte("state"), 0); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	second, err := storage.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	got, err := second.Get(ctx, "sessions/a")
+	if err != nil || string(got) != "state" {
+		t.Errorf("Get from a second store = %q, %v, want %q", got, err, "state")
+	}
+}
+
+func TestFileStore_Prune(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := storage.NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	if err := s.Put(ctx, "expiring", []byte("v"), time.Millisecond); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := s.Put(ctx, "lasting", []byte("v"), 0); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	removed, err := s.Prune(ctx)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Prune removed %d entries, want 1", removed)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("%d files left after Prune, want 1", len(files))
+	}
+	if _, err := s.Get(ctx, "lasting"); err != nil {
+		t.Errorf("Get of the unexpired entry failed: %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+// Package storagetest holds the contract tests for implementations of
+// storage.Store. An implementation passes them by calling Run from a test:
+//
+//	func TestRedisStore(t *testing.T) {
+//	    storagetest.Run(t, func(t *testing.T) storage.Store {
+//	        return newRedisStore(t) // empty, and cleaned up with t.Cleanup
+//	    })
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/storage"
+)
+
+// TTL is the expiry used by the tests of expiring entries. They wait a few
+// times TTL, so a store whose expiry is coarser, such as one rounding to
+// whole seconds, should not use this suite for TTL tests as is.
+var TTL = 100 * time.Millisecond
+
+// Run runs the contract tests against stores made by newStore, which must
+// return an empty store for each call.
+func Run(t *testing.T, newStore func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.Store)
+	}{
+		{"GetMissing", testGetMissing},
+		{"PutGet", testPutGet},
+		{"Overwrite", testOverwrite},
+		{"ValuesCopied", testValuesCopied},
+		{"EmptyValue", testEmptyValue},
+		{"EmptyKey", testEmptyKey},
+		{"Delete", testDelete},
+		{"List", testList},
+		{"KeyCharacters", testKeyCharacters},
+		{"TTL", testTTL},
+		{"TTLReplaced", testTTLReplaced},
+		{"CancelledContext", testCancelledContext},
+		{"Concurrent", testConcurrent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func put(t *testing.T, s storage.Store, key, value string, ttl time.Duration) {
+	t.Helper()
+	if err := s.Put(context.Background(), key, []byte(value), ttl); err != nil {
+		t.Fatalf("Put(%q) failed: %v", key, err)
+	}
+}
+
+func wantValue(t *testing.T, s storage.Store, key, want string) {
+	t.Helper()
+	got, err := s.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q) failed: %v", key, err)
+	}
+	if string(got) != want {
+		t.Errorf("Get(%q) = %q, want %q", key, got, want)
+	}
+}
+
+func wantMissing(t *testing.T, s storage.Store, key string) {
+	t.Helper()
+	got, err := s.Get(context.Background(), key)
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get(%q) = %q, %v, want ErrNotFound", key, got, err)
+	}
+}
+
+func wantKeys(t *testing.T, s storage.Store, prefix string, want ...string) {
+	t.Helper()
+	got, err := s.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatalf("List(%q) failed: %v", prefix, err)
+	}
+	if len(got) != 0 || len(want) != 0 {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("List(%q) = %q, want %q", prefix, got, want)
+		}
+	}
+}
+
+func testGetMissing(t *testing.T, s storage.Store) {
+	wantMissing(t, s, "missing")
+}
+
+func testPutGet(t *testing.T, s storage.Store) {
+	put(t, s, "sessions/a", "state a", 0)
+	put(t, s, "sessions/b", "state b", 0)
+	wantValue(t, s, "sessions/a", "state a")
+	wantValue(t, s, "sessions/b", "state b")
+}
+
+func testOverwrite(t *testing.T, s storage.Store) {
+	put(t, s, "k", "first", 0)
+	put(t, s, "k", "second", 0)
+	wantValue(t, s, "k", "second")
+	wantKeys(t, s, "", "k")
+}
+
+func testValuesCopied(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	value := []byte("original")
+	if err := s.Put(ctx, "k", value, 0); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	copy(value, "modified")
+	wantValue(t, s, "k", "original")
+
+	got, err := s.Get(ctx, "k")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	copy(got, "modified")
+	wantValue(t, s, "k", "original")
+}
+
+func testEmptyValue(t *testing.T, s storage.Store) {
+	put(t, s, "empty", "", 0)
+	got, err := s.Get(context.Background(), "empty")
+	if err != nil {
+		t.Fatalf("Get of an empty value failed: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Get = %q, want an empty value", got)
+	}
+}
+
+func testEmptyKey(t *testing.T, s storage.Store) {
+	if err := s.Put(context.Background(), "", []byte("v"), 0); err == nil {
+		t.Error("Put with an empty key succeeded")
+	}
+}
+
+func testDelete(t *testing.T, s storage.Store) {
+	ctx := context.Background()
+	put(t, s, "k", "v", 0)
+	put(t, s, "other", "v", 0)
+	if err := s.Delete(ctx, "k"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	wantMissing(t, s, "k")
+	wantValue(t, s, "other", "v")
+	wantKeys(t, s, "", "other")
+
+	if err := s.Delete(ctx, "k"); err != nil {
+		t.Errorf("Delete of a missing key = %v, want nil", err)
+	}
+}
+
+func testList(t *testing.T, s storage.Store) {
+	wantKeys(t, s, "")
+	for _, key := range []string{"idem/2", "history/s1/2", "history/s1/10", "history/s2/1", "idem/1"} {
+		put(t, s, key, "v", 0)
+	}
+	wantKeys(t, s, "", "history/s1/10", "history/s1/2", "history/s2/1", "idem/1", "idem/2")
+	wantKeys(t, s, "history/s1/", "history/s1/10", "history/s1/2")
+	wantKeys(t, s, "idem", "idem/1", "idem/2")
+	wantKeys(t, s, "nothing/")
+}
+
+func testKeyCharacters(t *testing.T, s storage.Store) {
+	keys := []string{"with space", "../escape", "a/b/../c", "ünïcödé", "colon:and|pipe", "dot."}
+	for i, key := range keys {
+		put(t, s, key, fmt.Sprint(i), 0)
+	}
+	for i, key := range keys {
+		wantValue(t, s, key, fmt.Sprint(i))
+	}
+	got, err := s.List(context.Background(), "")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(got) != len(keys) {
+		t.Errorf("List = %q, want the %d keys", got, len(keys))
+	}
+}
+
+func testTTL(t *testing.T, s storage.Store) {
+	put(t, s, "expiring", "v", TTL)
+	put(t, s, "lasting", "v", 0)
+	wantValue(t, s, "expiring", "v")
+
+	time.Sleep(3 * TTL)
+	wantMissing(t, s, "expiring")
+	wantValue(t, s, "lasting", "v")
+	wantKeys(t, s, "", "lasting")
+}
+
+func testTTLReplaced(t *testing.T, s storage.Store) {
+	// Putting again without a TTL keeps the entry for good
+	put(t, s, "k", "old", TTL)
+	put(t, s, "k", "new", 0)
+	time.Sleep(3 * TTL)
+	wantValue(t, s, "k", "new")
+
+	// and an expired key can be put again
+	put(t, s, "gone", "old", TTL)
+	time.Sleep(3 * TTL)
+	put(t, s, "gone", "back", 0)
+	wantValue(t, s, "gone", "back")
+}
+
+func testCancelledContext(t *testing.T, s storage.Store) {
+	put(t, s, "k", "v", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.Get(ctx, "k"); err == nil {
+		t.Error("Get with a cancelled context succeeded")
+	}
+	if err := s.Put(ctx, "k", []byte("new"), 0); err == nil {
+		t.Error("Put with a cancelled context succeeded")
+	}
+	if _, err := s.List(ctx, ""); err == nil {
+		t.Error("List with a cancelled context succeeded")
+	}
+	wantValue(t, s, "k", "v")
+}
+
+func testConcurrent(t *testing.T, s storage.Store) {
+	const writers = 8
+	const keys = 20
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				key := fmt.Sprintf("w%d/%02d", w, i)
+				value := []byte(key)
+				if err := s.Put(ctx, key, value, 0); err != nil {
+					errs <- err
+					return
+				}
+				got, err := s.Get(ctx, key)
+				if err != nil || !bytes.Equal(got, value) {
+					errs <- fmt.Errorf("Get(%q) = %q, %v right after Put", key, got, err)
+					return
+				}
+				if _, err := s.List(ctx, fmt.Sprintf("w%d/", w)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	all, err := s.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(all) != writers*keys {
+		t.Errorf("List returned %d keys, want %d", len(all), writers*keys)
+	}
+}
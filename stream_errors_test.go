@@ -0,0 +1,212 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+const (
+	streamAssistant = `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"ok"}]}}`
+	streamResult    = `{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s"}`
+)
+
+// systemSubtypes returns the message types seen, using the subtype for
+// SystemMessages, and the SystemMessages themselves.
+func systemSubtypes(messages <-chan types.Message) ([]string, []*types.SystemMessage) {
+	var kinds []string
+	var system []*types.SystemMessage
+	for msg := range messages {
+		if sys, ok := msg.(*types.SystemMessage); ok {
+			kinds = append(kinds, sys.Subtype)
+			system = append(system, sys)
+			continue
+		}
+		kinds = append(kinds, msg.GetMessageType())
+	}
+	return kinds, system
+}
+
+func TestClient_ParseErrorMidStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx, streamAssistant, `{not json`, streamResult)
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	kinds, system := systemSubtypes(client.ReceiveResponse(ctx))
+	if want := []string{"assistant", "parse_error", "result"}; strings.Join(kinds, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v, want %v", kinds, want)
+	}
+	if !types.IsJSONDecodeError(system[0].Err) {
+		t.Errorf("parse_error Err = %v, want JSONDecodeError", system[0].Err)
+	}
+
+	// A bad line does not end the stream or fail the client
+	if err := client.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestClient_LenientParsing(t *testing.T) {
+	const attachment = `{"type":"attachment","path":"notes.txt"}`
+	const citation = `{"type":"assistant","message":{"model":"m","content":[{"type":"citation","url":"https://example.com"}]}}`
+
+	tests := []struct {
+		name    string
+		lenient bool
+		want    []string
+	}{
+		{"strict", false, []string{"parse_error", "parse_error", "result"}},
+		{"lenient", true, []string{"attachment", "assistant", "result"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			cliPath := writeScriptedCLI(t, attachment, citation, streamResult)
+			opts := types.NewClaudeAgentOptions().WithCLIPath(cliPath).WithLenientParsing(tt.lenient)
+			client, err := NewClient(ctx, opts)
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			if err := client.Connect(ctx); err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+			defer client.Close(context.Background())
+			if err := client.Query(ctx, "hi"); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+
+			var kinds []string
+			var unknown *types.UnknownMessage
+			var block *types.UnknownBlock
+			for msg := range client.ReceiveResponse(ctx) {
+				switch m := msg.(type) {
+				case *types.SystemMessage:
+					kinds = append(kinds, m.Subtype)
+					continue
+				case *types.UnknownMessage:
+					unknown = m
+				case *types.AssistantMessage:
+					block, _ = m.Content[0].(*types.UnknownBlock)
+				}
+				kinds = append(kinds, msg.GetMessageType())
+			}
+			if strings.Join(kinds, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("got %v, want %v", kinds, tt.want)
+			}
+			if tt.lenient && (unknown == nil || string(unknown.Raw) != attachment || block == nil || block.Type != "citation") {
+				t.Errorf("unknown message = %+v, block = %+v", unknown, block)
+			}
+		})
+	}
+}
+
+func TestClient_TransportErrorEndsStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A line longer than the reader's buffer ends the stream
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(streamAssistant, `{"type":"assistant","x":"`+strings.Repeat("a", 2000000)+`"}`),
+	}})
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	kinds, system := systemSubtypes(client.ReceiveResponse(ctx))
+	if ctx.Err() != nil {
+		t.Fatal("ReceiveResponse did not finish before the deadline")
+	}
+	if len(kinds) != 2 || kinds[0] != "assistant" || kinds[1] != "transport_failed" {
+		t.Fatalf("got %v, want [assistant transport_failed]", kinds)
+	}
+	if !types.IsJSONDecodeError(system[0].Err) {
+		t.Errorf("transport_failed Err = %v, want JSONDecodeError", system[0].Err)
+	}
+	if err := client.Err(); !types.IsJSONDecodeError(err) {
+		t.Errorf("Err() = %v, want JSONDecodeError", err)
+	}
+}
+
+func TestClient_ErrNil(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectEcho(t, ctx)
+	defer client.Close(ctx)
+
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range client.ReceiveResponse(ctx) {
+	}
+	if err := client.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestQuery_ParseErrorMidStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cliPath := writeScriptedCLI(t, streamAssistant, "{not json", streamResult)
+	messages, err := Query(ctx, "hi", types.NewClaudeAgentOptions().WithCLIPath(cliPath))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	kinds, system := systemSubtypes(messages)
+	if len(kinds) != 3 || kinds[1] != "parse_error" || kinds[2] != "result" {
+		t.Fatalf("got %v, want [assistant parse_error result]", kinds)
+	}
+	if !types.IsJSONDecodeError(system[0].Err) {
+		t.Errorf("parse_error Err = %v, want JSONDecodeError", system[0].Err)
+	}
+}
+
+func TestClient_ConnectHandshakeError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A CLI that prints help text instead of stream-json
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.Send("Usage: claude [options] [command] [prompt]"),
+	}})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+
+	err = client.Connect(ctx)
+	var handshakeErr *types.HandshakeError
+	if !errors.As(err, &handshakeErr) {
+		t.Fatalf("Connect() = %v, want HandshakeError", err)
+	}
+	if handshakeErr.FirstLine != "Usage: claude [options] [command] [prompt]" {
+		t.Errorf("FirstLine = %q, want the CLI's first line", handshakeErr.FirstLine)
+	}
+	if runs := cli.Runs(); runs != 1 {
+		t.Errorf("CLI started %d times, want 1: a handshake error is not retried", runs)
+	}
+}
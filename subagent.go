@@ -0,0 +1,177 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// SubagentResult holds the outcome of a subagent launched with Client.RunSubagent.
+type SubagentResult struct {
+	// AgentName is the subagent that was launched.
+	AgentName string
+
+	// ToolUseID is the ID of the Task tool invocation that ran the subagent.
+	// Messages produced by the subagent carry it as their ParentToolUseID.
+	ToolUseID string
+
+	// Text is the final output the subagent returned to the main agent.
+	Text string
+
+	// ToolCalls lists the tool invocations made by the subagent.
+	ToolCalls []*types.ToolUseBlock
+
+	// Messages holds all messages attributed to the subagent, in order.
+	Messages []types.Message
+
+	// Usage is the token usage summed over the subagent's assistant messages.
+	// The CLI does not report cost per subagent; see Result for the turn total.
+	Usage types.Usage
+
+	// IsError reports whether the subagent finished with an error.
+	IsError bool
+
+	// Result is the ResultMessage ending the enclosing turn, if one was received.
+	Result *types.ResultMessage
+}
+
+// RunSubagent launches the named subagent with the given prompt and waits for it to finish.
+//
+// The subagent is started through the CLI's Task tool, so agentName must be a
+// subagent known to the CLI: one configured with WithAgents/WithAgent, or a
+// built-in such as "general-purpose". Messages are attributed to the subagent
+// via their ParentToolUseID. RunSubagent consumes the whole turn, so do not
+// call ReceiveResponse for it.
+//
+// If the main agent does not launch the subagent, or the subagent reports an
+// error, a SubagentError is returned along with whatever was collected.
+//
+// Example:
+//
+//	res, err := client.RunSubagent(ctx, "code-reviewer", "Review the changes in main.go")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Println(res.Text)
+//	fmt.Printf("Subagent used %d output tokens\n", res.Usage.OutputTokens)
+func (c *Client) RunSubagent(ctx context.Context, agentName, prompt string) (*SubagentResult, error) {
+	if agentName == "" {
+		return nil, fmt.Errorf("agent name cannot be empty")
+	}
+	if prompt == "" {
+		return nil, fmt.Errorf("prompt cannot be empty")
+	}
+
+	if err := c.Query(ctx, subagentPrompt(agentName, prompt)); err != nil {
+		return nil, err
+	}
+
+	result := &SubagentResult{AgentName: agentName}
+	completed := false
+
+	for msg := range c.ReceiveResponse(ctx) {
+		switch m := msg.(type) {
+		case *types.AssistantMessage:
+			if result.ToolUseID != "" && isAttributedTo(m.ParentToolUseID, result.ToolUseID) {
+				result.Messages = append(result.Messages, m)
+				result.addUsage(m.Usage)
+				for _, block := range m.Content {
+					if tu, ok := block.(*types.ToolUseBlock); ok {
+						result.ToolCalls = append(result.ToolCalls, tu)
+					}
+				}
+				continue
+			}
+			if result.ToolUseID == "" && m.ParentToolUseID == nil {
+				result.ToolUseID = findTaskInvocation(m, agentName)
+			}
+
+		case *types.UserMessage:
+			if result.ToolUseID == "" {
+				continue
+			}
+			if isAttributedTo(m.ParentToolUseID, result.ToolUseID) {
+				result.Messages = append(result.Messages, m)
+				continue
+			}
+			if tr := findToolResult(m, result.ToolUseID); tr != nil {
+				completed = true
+				result.Text, _ = tr.Text()
+				result.IsError = tr.IsError != nil && *tr.IsError
+			}
+
+		case *types.ResultMessage:
+			result.Result = m
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if result.ToolUseID == "" {
+		return result, types.NewSubagentError("subagent was not invoked", agentName)
+	}
+	if !completed {
+		return result, types.NewSubagentError("subagent did not complete", agentName)
+	}
+	if result.IsError {
+		return result, types.NewSubagentErrorWithCause("subagent failed", agentName, fmt.Errorf("%s", result.Text))
+	}
+
+	return result, nil
+}
+
+// addUsage adds one message's usage to the running total.
+func (r *SubagentResult) addUsage(u *types.Usage) {
+	if u == nil {
+		return
+	}
+	r.Usage.InputTokens += u.InputTokens
+	r.Usage.OutputTokens += u.OutputTokens
+	r.Usage.CacheCreationInputTokens += u.CacheCreationInputTokens
+	r.Usage.CacheReadInputTokens += u.CacheReadInputTokens
+}
+
+// subagentPrompt builds the instruction asking the main agent to delegate via the Task tool.
+func subagentPrompt(agentName, prompt string) string {
+	return fmt.Sprintf(
+		"Use the Task tool with subagent_type %q to run the following prompt verbatim. "+
+			"Do not perform the task yourself. When the subagent finishes, reply with its result only.\n\n"+
+			"<prompt>\n%s\n</prompt>",
+		agentName, prompt,
+	)
+}
+
+// isAttributedTo reports whether a message's parent tool use ID matches the given ID.
+func isAttributedTo(parentToolUseID *string, toolUseID string) bool {
+	return parentToolUseID != nil && *parentToolUseID == toolUseID
+}
+
+// findTaskInvocation returns the ID of a Task tool use launching agentName, or "".
+func findTaskInvocation(msg *types.AssistantMessage, agentName string) string {
+	for _, block := range msg.Content {
+		tu, ok := block.(*types.ToolUseBlock)
+		if !ok || tu.Name != "Task" {
+			continue
+		}
+		if subagentType, _ := tu.Input["subagent_type"].(string); subagentType == agentName {
+			return tu.ID
+		}
+	}
+	return ""
+}
+
+// findToolResult returns the tool result block for toolUseID in msg, or nil.
+func findToolResult(msg *types.UserMessage, toolUseID string) *types.ToolResultBlock {
+	blocks, ok := msg.Content.([]types.ContentBlock)
+	if !ok {
+		return nil
+	}
+	for _, block := range blocks {
+		if tr, ok := block.(*types.ToolResultBlock); ok && tr.ToolUseID == toolUseID {
+			return tr
+		}
+	}
+	return nil
+}
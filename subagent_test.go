@@ -0,0 +1,145 @@
+package claude
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// writeScriptedCLI writes a mock CLI that waits for the first user message,
+// prints the given JSON lines, and then idles until stdin is closed.
+func writeScriptedCLI(t *testing.T, lines ...string) string {
+	t.Helper()
+	return mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(lines...),
+	}}).Path
+}
+
+// receivedResponse returns the control response the SDK sent mock CLI cli
+// for requestID, failing the test if there is none.
+func receivedResponse(t *testing.T, cli *mockcli.CLI, requestID string) []byte {
+	t.Helper()
+	for _, line := range cli.Received() {
+		if strings.Contains(line, `"type":"control_response"`) && strings.Contains(line, `"request_id":"`+requestID+`"`) {
+			return []byte(line)
+		}
+	}
+	t.Fatalf("no control response to %s was sent", requestID)
+	return nil
+}
+
+// connectScripted creates and connects a client backed by a scripted CLI.
+func connectScripted(t *testing.T, ctx context.Context, lines ...string) *Client {
+	t.Helper()
+
+	opts := types.NewClaudeAgentOptions().WithCLIPath(writeScriptedCLI(t, lines...))
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	return client
+}
+
+const subagentTaskCall = `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"toolu_task_1","name":"Task","input":{"subagent_type":"reviewer","description":"Review","prompt":"Review main.go"}}]}}`
+
+func TestClient_RunSubagent(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx,
+		subagentTaskCall,
+		`{"type":"assistant","parent_tool_use_id":"toolu_task_1","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Reading the file"},{"type":"tool_use","id":"toolu_read_1","name":"Read","input":{"file_path":"main.go"}}],"usage":{"input_tokens":100,"output_tokens":20}}}`,
+		`{"type":"user","parent_tool_use_id":"toolu_task_1","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_read_1","content":"package main"}]}}`,
+		`{"type":"assistant","parent_tool_use_id":"toolu_task_1","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"LGTM"}],"usage":{"input_tokens":150,"output_tokens":10,"cache_read_input_tokens":50}}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_task_1","content":[{"type":"text","text":"Review: LGTM"}]}]}}`,
+		`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Review: LGTM"}]}}`,
+		`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":2,"session_id":"s1","total_cost_usd":0.01}`,
+	)
+
+	res, err := client.RunSubagent(ctx, "reviewer", "Review main.go")
+	if err != nil {
+		t.Fatalf("RunSubagent failed: %v", err)
+	}
+
+	if res.ToolUseID != "toolu_task_1" {
+		t.Errorf("ToolUseID = %q, want toolu_task_1", res.ToolUseID)
+	}
+	if res.Text != "Review: LGTM" {
+		t.Errorf("Text = %q, want %q", res.Text, "Review: LGTM")
+	}
+	if len(res.ToolCalls) != 1 || res.ToolCalls[0].Name != "Read" {
+		t.Errorf("unexpected tool calls: %+v", res.ToolCalls)
+	}
+	if len(res.Messages) != 3 {
+		t.Errorf("expected 3 attributed messages, got %d", len(res.Messages))
+	}
+	if res.Usage.InputTokens != 250 || res.Usage.OutputTokens != 30 || res.Usage.CacheReadInputTokens != 50 {
+		t.Errorf("unexpected usage: %+v", res.Usage)
+	}
+	if res.Result == nil || res.Result.SessionID != "s1" {
+		t.Errorf("expected result message, got %+v", res.Result)
+	}
+}
+
+func TestClient_RunSubagentFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx,
+		subagentTaskCall,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_task_1","content":"Agent type 'reviewer' not found","is_error":true}]}}`,
+		`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":1,"session_id":"s1"}`,
+	)
+
+	res, err := client.RunSubagent(ctx, "reviewer", "Review main.go")
+	if !types.IsSubagentError(err) {
+		t.Fatalf("expected SubagentError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "not found") {
+		t.Errorf("error should include the subagent output: %v", err)
+	}
+	if res == nil || !res.IsError {
+		t.Errorf("expected result marked as error, got %+v", res)
+	}
+}
+
+func TestClient_RunSubagentNotInvoked(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx,
+		`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"I did it myself"}]}}`,
+		`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":1,"session_id":"s1"}`,
+	)
+
+	_, err := client.RunSubagent(ctx, "reviewer", "Review main.go")
+	if !types.IsSubagentError(err) || !strings.Contains(err.Error(), "not invoked") {
+		t.Fatalf("expected not-invoked SubagentError, got %v", err)
+	}
+}
+
+func TestClient_RunSubagentValidation(t *testing.T) {
+	ctx := context.Background()
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath("/bin/echo"))
+	if err != nil {
+		t.Skip("Could not create client")
+	}
+
+	if _, err := client.RunSubagent(ctx, "", "prompt"); err == nil {
+		t.Error("expected error for empty agent name")
+	}
+	if _, err := client.RunSubagent(ctx, "reviewer", ""); err == nil {
+		t.Error("expected error for empty prompt")
+	}
+}
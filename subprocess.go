@@ -0,0 +1,343 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Transport is the low-level connection to the Claude Code CLI used by Query
+// and Client. The default implementation runs the CLI as a subprocess; custom
+// implementations can be supplied with QueryWithTransport and NewClientWithTransport.
+type Transport = transport.Transport
+
+// ProcessReporter is implemented by transports that run the CLI as a local
+// subprocess. Client.PID and Client.ProcessState use it when the transport
+// implements it.
+type ProcessReporter = transport.ProcessReporter
+
+// SetMaxSubprocesses limits how many CLI subprocesses the SDK runs at once,
+// across all Clients and one-shot queries in the process. Once the limit is
+// reached, Connect waits for a subprocess to exit or fails with
+// TooManyProcessesError, as chosen with WithSubprocessWaitPolicy. A slot is
+// freed when its subprocess exits and has been reaped, however it ended.
+//
+// A non-positive n removes the limit, which is the default. Lowering the
+// limit does not stop subprocesses that are already running.
+//
+// Example:
+//
+//	// Never run more than 8 CLIs, however many goroutines fan out
+//	claude.SetMaxSubprocesses(8)
+func SetMaxSubprocesses(n int) {
+	transport.SetMaxProcesses(n)
+}
+
+// newSubprocessTransport creates the CLI subprocess transport configured by options.
+// It locates the CLI, validates the working directory, and applies transport settings.
+// With WithAllowedRoots, it also adds the file jail hook to options.
+func newSubprocessTransport(options *types.ClaudeAgentOptions) (*transport.SubprocessCLITransport, error) {
+	if err := checkToolFilter(options); err != nil {
+		return nil, err
+	}
+	agents, err := agentsJSON(options.Agents)
+	if err != nil {
+		return nil, err
+	}
+	extraArgs, err := extraCLIArgs(options.ExtraArgs)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := settingSources(options.SettingSources)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSettings(options.Settings); err != nil {
+		return nil, err
+	}
+	thinking, err := thinkingTokens(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find CLI path
+	cliPath := ""
+	if options.CLIPath != nil {
+		cliPath = *options.CLIPath
+	} else {
+		var err error
+		cliPath, err = transport.FindCLI()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Determine and validate working directory
+	if err := applyAllowedRoots(options); err != nil {
+		return nil, err
+	}
+	cwd := ""
+	if options.CWD != nil {
+		var err error
+		cwd, err = transport.ResolveCWD(*options.CWD, options.CreateCWD)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Prepare environment: the deterministic variables, overridden by the env
+	// file, overridden by explicit variables. Callers pass their own copy of
+	// options, so the merged map replaces Env and secret redaction sees every
+	// variable the CLI gets.
+	env := make(map[string]string)
+	if options.DeterministicEnv {
+		for k, v := range types.DeterministicEnvVars() {
+			env[k] = v
+		}
+	}
+	if options.EnvFile != "" {
+		fileEnv, err := loadEnvFile(options.EnvFile)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range fileEnv {
+			env[k] = v
+		}
+	}
+	for k, v := range options.Env {
+		env[k] = v
+	}
+	if options.EnvFile != "" || options.DeterministicEnv {
+		options.Env = env
+	}
+
+	t := transport.NewSubprocessCLITransport(cliPath, cwd, env)
+
+	if options.WriteBatching != nil {
+		t.SetWriteBatching(options.WriteBatching.MaxDelay, options.WriteBatching.MaxBytes)
+	}
+	if options.RawMessages || options.Transcript != nil {
+		t.SetRawMessages(true)
+	}
+	if options.LenientParsing {
+		t.SetLenientParsing(true)
+	}
+	if options.MaxCallbackPayloadBytes > 0 {
+		t.SetMaxControlInput(options.MaxCallbackPayloadBytes)
+	}
+	var maxSize, maxDepth int
+	if options.MaxBufferSize != nil {
+		maxSize = *options.MaxBufferSize
+	}
+	if options.MaxMessageDepth != nil {
+		maxDepth = *options.MaxMessageDepth
+	}
+	t.SetMessageLimits(maxSize, maxDepth)
+	if options.Logger != nil {
+		t.SetLogger(options.Logger)
+	}
+	if options.MetricsSink != nil {
+		t.SetMetricsSink(options.MetricsSink)
+	}
+	if options.CloseTimeout != nil {
+		t.SetCloseTimeout(*options.CloseTimeout)
+	}
+	if options.MaxOutboundSize != nil || options.OutboundWarnSize != nil {
+		warnSize, maxSize := types.DefaultOutboundWarnSize, types.DefaultMaxOutboundSize
+		if options.OutboundWarnSize != nil {
+			warnSize = *options.OutboundWarnSize
+		}
+		if options.MaxOutboundSize != nil {
+			maxSize = *options.MaxOutboundSize
+		}
+		t.SetOutboundLimits(warnSize, maxSize)
+	}
+	if options.SubprocessWaitPolicy != "" {
+		t.SetSubprocessWaitPolicy(options.SubprocessWaitPolicy)
+	}
+	t.SetToolFilter(options.AllowedTools, options.DisallowedTools)
+	t.SetAgents(agents)
+	t.SetSettingSources(sources)
+	if options.Settings != nil {
+		t.SetSettings(*options.Settings)
+	}
+	if thinking != nil {
+		t.SetMaxThinkingTokens(*thinking)
+	}
+	t.SetExtraArgs(extraArgs)
+	if options.Stderr != nil {
+		t.SetStderrCallback(options.Stderr)
+	}
+
+	return t, nil
+}
+
+// checkToolFilter reports an error if a tool is both allowed and disallowed,
+// since it is unclear which of the two the caller meant.
+func checkToolFilter(options *types.ClaudeAgentOptions) error {
+	allowed := make(map[string]bool, len(options.AllowedTools))
+	for _, name := range options.AllowedTools {
+		allowed[name] = true
+	}
+	for _, name := range options.DisallowedTools {
+		if allowed[name] {
+			return fmt.Errorf("tool %q is in both allowed_tools and disallowed_tools", name)
+		}
+	}
+	return nil
+}
+
+// agentsJSON validates the agent definitions and encodes them for the CLI's
+// --agents flag. It returns "" when there are none.
+func agentsJSON(agents map[string]types.AgentDefinition) (string, error) {
+	if len(agents) == 0 {
+		return "", nil
+	}
+	for name, agent := range agents {
+		if name == "" {
+			return "", fmt.Errorf("agent name cannot be empty")
+		}
+		if err := agent.Validate(); err != nil {
+			return "", fmt.Errorf("agent %q: %w", name, err)
+		}
+	}
+	data, err := json.Marshal(agents)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode agents: %w", err)
+	}
+	return string(data), nil
+}
+
+// settingSources validates the setting sources and converts them for the
+// CLI's --setting-sources flag. nil is kept, so the CLI's default applies.
+func settingSources(sources []types.SettingSource) ([]string, error) {
+	if sources == nil {
+		return nil, nil
+	}
+	names := make([]string, 0, len(sources))
+	seen := make(map[types.SettingSource]bool, len(sources))
+	for _, source := range sources {
+		switch source {
+		case types.SettingSourceUser, types.SettingSourceProject, types.SettingSourceLocal:
+		default:
+			return nil, fmt.Errorf("unknown setting source %q: want user, project or local", source)
+		}
+		if seen[source] {
+			return nil, fmt.Errorf("setting source %q is given more than once", source)
+		}
+		seen[source] = true
+		names = append(names, string(source))
+	}
+	return names, nil
+}
+
+// checkSettings reports an error if the WithSettings value is empty or is
+// JSON that does not decode to an object.
+func checkSettings(settings *string) error {
+	if settings == nil {
+		return nil
+	}
+	if strings.TrimSpace(*settings) == "" {
+		return fmt.Errorf("settings cannot be empty")
+	}
+	if !transport.IsSettingsJSON(*settings) {
+		return nil
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(*settings), &object); err != nil {
+		return fmt.Errorf("settings are not a valid JSON object: %w", err)
+	}
+	return nil
+}
+
+// thinkingTokens validates the thinking options and returns the budget for
+// the CLI's --max-thinking-tokens flag, or nil to leave the CLI's default.
+func thinkingTokens(options *types.ClaudeAgentOptions) (*int, error) {
+	budget := options.MaxThinkingTokens
+	if budget != nil && *budget < 0 {
+		return nil, fmt.Errorf("max thinking tokens cannot be negative, got %d", *budget)
+	}
+	if options.ThinkingEnabled == nil {
+		return budget, nil
+	}
+
+	if !*options.ThinkingEnabled {
+		if budget != nil && *budget > 0 {
+			return nil, fmt.Errorf("max thinking tokens is %d but thinking is disabled", *budget)
+		}
+		disabled := 0
+		return &disabled, nil
+	}
+	if budget == nil {
+		enabled := types.DefaultMaxThinkingTokens
+		return &enabled, nil
+	}
+	if *budget == 0 {
+		return nil, fmt.Errorf("thinking is enabled but max thinking tokens is 0")
+	}
+	return budget, nil
+}
+
+// managedCLIFlags are the flags the SDK sets itself, mapped to the option
+// that controls them ("" when no option does). Extra arguments may not
+// override them.
+var managedCLIFlags = map[string]string{
+	"print":               "",
+	"input-format":        "",
+	"output-format":       "",
+	"verbose":             "",
+	"allowedTools":        "WithAllowedTools",
+	"allowed-tools":       "WithAllowedTools",
+	"disallowedTools":     "WithDisallowedTools",
+	"disallowed-tools":    "WithDisallowedTools",
+	"agents":              "WithAgents",
+	"settings":            "WithSettings",
+	"setting-sources":     "WithSettingSources",
+	"max-thinking-tokens": "WithMaxThinkingTokens",
+}
+
+// extraCLIArgs converts the WithExtraCLIArgs map into CLI arguments, sorted
+// by flag name so the command line is stable. A nil value is a boolean flag.
+// Flags may be given with or without their leading dashes.
+func extraCLIArgs(extra map[string]*string) ([]string, error) {
+	if len(extra) == 0 {
+		return nil, nil
+	}
+
+	flags := make(map[string]*string, len(extra))
+	for key, value := range extra {
+		name := strings.TrimLeft(key, "-")
+		if name == "" || strings.ContainsAny(name, "= ") {
+			return nil, fmt.Errorf("invalid extra CLI argument %q", key)
+		}
+		if option, ok := managedCLIFlags[name]; ok {
+			if option != "" {
+				return nil, fmt.Errorf("extra CLI argument --%s is managed by the SDK; use %s instead", name, option)
+			}
+			return nil, fmt.Errorf("extra CLI argument --%s is managed by the SDK and cannot be overridden", name)
+		}
+		if _, dup := flags[name]; dup {
+			return nil, fmt.Errorf("extra CLI argument --%s is given more than once", name)
+		}
+		flags[name] = value
+	}
+
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		args = append(args, "--"+name)
+		if value := flags[name]; value != nil {
+			args = append(args, *value)
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,585 @@
+package claude
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestSetMaxSubprocesses_FailPolicy(t *testing.T) {
+	SetMaxSubprocesses(1)
+	defer SetMaxSubprocesses(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	first := connectEcho(t, ctx)
+	defer first.Close(ctx)
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeEchoCLI(t)).
+		WithSubprocessWaitPolicy(types.SubprocessWaitFail)
+	second, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer second.Close(ctx)
+	if err := second.Connect(ctx); !types.IsTooManyProcessesError(err) {
+		t.Errorf("Connect = %v, want TooManyProcessesError", err)
+	}
+
+	if inUse, limit := SubprocessUsage(); inUse != 1 || limit != 1 {
+		t.Errorf("SubprocessUsage() = %d, %d, want 1, 1", inUse, limit)
+	}
+	var dump strings.Builder
+	if err := DebugDump(&dump); err != nil {
+		t.Fatalf("DebugDump failed: %v", err)
+	}
+	if !strings.Contains(dump.String(), "slots in use 1, limit 1") {
+		t.Errorf("DebugDump missing slot usage:\n%s", dump.String())
+	}
+}
+
+// TestSetMaxSubprocesses_Chaos churns connects from many goroutines while
+// subprocesses are killed at random, and checks that the limit always holds
+// and every slot is released in the end.
+func TestSetMaxSubprocesses_Chaos(t *testing.T) {
+	const (
+		limit      = 4
+		workers    = 8
+		iterations = 12
+	)
+	SetMaxSubprocesses(limit)
+	defer SetMaxSubprocesses(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cliPath := writeEchoCLI(t)
+	stop := make(chan struct{})
+	var overLimit atomic.Int32
+
+	// Watch that the limit is never exceeded
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if inUse, _ := SubprocessUsage(); inUse > limit {
+				overLimit.Store(int32(inUse))
+			}
+			if n := len(ActiveSubprocesses()); n > limit {
+				overLimit.Store(int32(n))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	// Kill random CLIs while clients connect and query
+	go func() {
+		defer background.Done()
+		r := rand.New(rand.NewSource(1))
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Duration(r.Intn(10)) * time.Millisecond):
+			}
+			if pids := ActiveSubprocesses(); len(pids) > 0 {
+				_ = syscall.Kill(pids[r.Intn(len(pids))], syscall.SIGKILL)
+			}
+		}
+	}()
+
+	var (
+		mu        sync.Mutex
+		abandoned []*Client
+		workersWG sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		workersWG.Add(1)
+		go func(seed int64) {
+			defer workersWG.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < iterations; i++ {
+				client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cliPath))
+				if err != nil {
+					t.Errorf("NewClient failed: %v", err)
+					return
+				}
+				if err := client.Connect(ctx); err != nil {
+					// Killed mid-handshake; the slot must still come back
+					if types.IsTooManyProcessesError(err) {
+						t.Errorf("Connect with block policy failed: %v", err)
+					}
+					_ = client.Close(ctx)
+					continue
+				}
+				if client.Query(ctx, "hi") == nil {
+					for range client.ReceiveResponse(ctx) {
+					}
+				}
+
+				switch r.Intn(3) {
+				case 0:
+					_ = client.Close(ctx)
+				case 1:
+					if pid, _ := client.PID(); pid > 0 {
+						_ = syscall.Kill(pid, syscall.SIGKILL)
+					}
+					_ = client.Close(ctx)
+				default:
+					// Crash without Close; the slot must be freed by reaping alone
+					if pid, _ := client.PID(); pid > 0 {
+						_ = syscall.Kill(pid, syscall.SIGKILL)
+					}
+					mu.Lock()
+					abandoned = append(abandoned, client)
+					mu.Unlock()
+				}
+			}
+		}(int64(w + 1))
+	}
+	workersWG.Wait()
+
+	waitFor(t, "all subprocess slots to be released", func() bool {
+		inUse, _ := SubprocessUsage()
+		return inUse == 0 && len(ActiveSubprocesses()) == 0
+	})
+	close(stop)
+	background.Wait()
+
+	if n := overLimit.Load(); n != 0 {
+		t.Errorf("observed %d subprocesses, limit is %d", n, limit)
+	}
+	if ctx.Err() != nil {
+		t.Error("chaos run did not finish before the deadline")
+	}
+	for _, client := range abandoned {
+		_ = client.Close(context.Background())
+	}
+}
+
+func TestToolFilter_Conflict(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeEchoCLI(t)).
+		WithAllowedTools("Read", "Bash").
+		WithDisallowedTools("Bash")
+
+	if _, err := NewClient(context.Background(), opts); err == nil || !strings.Contains(err.Error(), `"Bash"`) {
+		t.Errorf("NewClient error = %v, want conflict naming Bash", err)
+	}
+	if _, err := Query(context.Background(), "hi", opts); err == nil || !strings.Contains(err.Error(), "disallowed_tools") {
+		t.Errorf("Query error = %v, want conflict with disallowed_tools", err)
+	}
+}
+
+// recordedCLIArgs connects a client to a mock CLI and returns the arguments
+// it was started with.
+func recordedCLIArgs(t *testing.T, opts *types.ClaudeAgentOptions) []string {
+	t.Helper()
+
+	cli := mockcli.New(t, mockcli.Scenario{})
+	client, err := NewClient(context.Background(), opts.Clone().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close(context.Background())
+	return cli.Args()
+}
+
+func TestToolFilter_PassedToCLI(t *testing.T) {
+	args := recordedCLIArgs(t, types.NewClaudeAgentOptions().WithDisallowedTools("Bash", "WebFetch"))
+	if !strings.Contains(strings.Join(args, " "), "--disallowedTools Bash,WebFetch") {
+		t.Errorf("CLI args = %v, want --disallowedTools Bash,WebFetch", args)
+	}
+	for _, arg := range args {
+		if arg == "--allowedTools" {
+			t.Errorf("CLI args = %v, want no --allowedTools", args)
+		}
+	}
+}
+
+func TestAgents_PassedToCLI(t *testing.T) {
+	opts := types.NewClaudeAgentOptions().WithAgent("reviewer", types.AgentDefinition{
+		Description: "Reviews code",
+		Prompt:      "Review the diff",
+		Tools:       []string{"Read"},
+	})
+	args := recordedCLIArgs(t, opts)
+
+	want := `{"reviewer":{"description":"Reviews code","prompt":"Review the diff","tools":["Read"]}}`
+	for i, arg := range args {
+		if arg == "--agents" && i+1 < len(args) {
+			if args[i+1] != want {
+				t.Errorf("--agents = %s, want %s", args[i+1], want)
+			}
+			return
+		}
+	}
+	t.Errorf("CLI args = %v, want --agents", args)
+}
+
+func TestAgents_Invalid(t *testing.T) {
+	model := ""
+	tests := []struct {
+		name    string
+		agents  map[string]types.AgentDefinition
+		wantErr string
+	}{
+		{"empty name", map[string]types.AgentDefinition{"": {Description: "d", Prompt: "p"}}, "name"},
+		{"no prompt", map[string]types.AgentDefinition{"reviewer": {Description: "d"}}, `agent "reviewer": prompt is required`},
+		{"empty tool", map[string]types.AgentDefinition{"reviewer": {Description: "d", Prompt: "p", Tools: []string{""}}}, "tool 0 is empty"},
+		{"empty model", map[string]types.AgentDefinition{"reviewer": {Description: "d", Prompt: "p", Model: &model}}, "model"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := types.NewClaudeAgentOptions().WithCLIPath(writeEchoCLI(t)).WithAgents(tt.agents)
+			if _, err := NewClient(context.Background(), opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewClient error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := Query(context.Background(), "hi", opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Query error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtraCLIArgs(t *testing.T) {
+	api, empty := "api", ""
+	tests := []struct {
+		name    string
+		extra   map[string]*string
+		want    string
+		wantErr string
+	}{
+		{name: "none", extra: nil, want: ""},
+		{name: "boolean", extra: map[string]*string{"strict-mcp-config": nil}, want: "--strict-mcp-config"},
+		{name: "valued", extra: map[string]*string{"debug": &api}, want: "--debug api"},
+		{name: "empty value is still valued", extra: map[string]*string{"mcp-config": &empty}, want: "--mcp-config "},
+		{
+			name:  "sorted by name",
+			extra: map[string]*string{"zeta": nil, "debug": &api, "--alpha": nil},
+			want:  "--alpha --debug api --zeta",
+		},
+		{name: "managed flag", extra: map[string]*string{"output-format": &api}, wantErr: "--output-format is managed by the SDK"},
+		{name: "managed flag with dashes", extra: map[string]*string{"--verbose": nil}, wantErr: "--verbose is managed by the SDK"},
+		{name: "flag with an option", extra: map[string]*string{"allowedTools": &api}, wantErr: "use WithAllowedTools instead"},
+		{name: "kebab spelling", extra: map[string]*string{"disallowed-tools": &api}, wantErr: "use WithDisallowedTools instead"},
+		{name: "same flag twice", extra: map[string]*string{"debug": nil, "--debug": &api}, wantErr: "more than once"},
+		{name: "empty name", extra: map[string]*string{"--": nil}, wantErr: "invalid extra CLI argument"},
+		{name: "inline value", extra: map[string]*string{"debug=api": nil}, wantErr: "invalid extra CLI argument"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := extraCLIArgs(tt.extra)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("extraCLIArgs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extraCLIArgs() unexpected error: %v", err)
+			}
+			if got := strings.Join(args, " "); got != tt.want {
+				t.Errorf("extraCLIArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtraCLIArgs_PassedToCLI(t *testing.T) {
+	api := "api"
+	opts := types.NewClaudeAgentOptions().
+		WithDisallowedTools("Bash").
+		WithExtraCLIArgs(map[string]*string{"debug": &api, "strict-mcp-config": nil})
+	args := recordedCLIArgs(t, opts)
+
+	// Appended after every flag the SDK generates
+	want := []string{"--disallowedTools", "Bash", "--debug", "api", "--strict-mcp-config"}
+	if len(args) < len(want) {
+		t.Fatalf("CLI args = %v, want to end with %v", args, want)
+	}
+	if got := args[len(args)-len(want):]; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("CLI args = %v, want to end with %v", args, want)
+	}
+}
+
+func TestExtraCLIArgs_Conflict(t *testing.T) {
+	format := "json"
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeEchoCLI(t)).
+		WithExtraCLIArg("output-format", &format)
+
+	if _, err := NewClient(context.Background(), opts); err == nil || !strings.Contains(err.Error(), "--output-format") {
+		t.Errorf("NewClient error = %v, want conflict naming --output-format", err)
+	}
+	if _, err := Query(context.Background(), "hi", opts); err == nil || !strings.Contains(err.Error(), "managed by the SDK") {
+		t.Errorf("Query error = %v, want conflict with a managed flag", err)
+	}
+}
+
+func TestSettingSources_PassedToCLI(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []types.SettingSource // nil leaves WithSettingSources uncalled
+		want    []string
+	}{
+		{"default", nil, nil},
+		{"some", []types.SettingSource{types.SettingSourceUser, types.SettingSourceProject}, []string{"--setting-sources", "user,project"}},
+		{"none", []types.SettingSource{}, []string{"--setting-sources", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := types.NewClaudeAgentOptions()
+			if tt.sources != nil {
+				opts.WithSettingSources(tt.sources...)
+			}
+			args := recordedCLIArgs(t, opts)
+
+			var got []string
+			for i, arg := range args {
+				if arg == "--setting-sources" && i+1 < len(args) {
+					got = args[i : i+2]
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") || (got == nil) != (tt.want == nil) {
+				t.Errorf("CLI args = %q, want %q", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestThinking_PassedToCLI(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*types.ClaudeAgentOptions)
+		want      []string
+	}{
+		{"default", func(*types.ClaudeAgentOptions) {}, nil},
+		{"budget", func(o *types.ClaudeAgentOptions) { o.WithMaxThinkingTokens(16000) }, []string{"--max-thinking-tokens", "16000"}},
+		{"enabled", func(o *types.ClaudeAgentOptions) { o.WithThinkingEnabled(true) }, []string{"--max-thinking-tokens", "10000"}},
+		{"enabled with budget", func(o *types.ClaudeAgentOptions) {
+			o.WithThinkingEnabled(true).WithMaxThinkingTokens(2048)
+		}, []string{"--max-thinking-tokens", "2048"}},
+		{"disabled", func(o *types.ClaudeAgentOptions) { o.WithThinkingEnabled(false) }, []string{"--max-thinking-tokens", "0"}},
+		{"zero budget", func(o *types.ClaudeAgentOptions) { o.WithMaxThinkingTokens(0) }, []string{"--max-thinking-tokens", "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := types.NewClaudeAgentOptions()
+			tt.configure(opts)
+			args := recordedCLIArgs(t, opts)
+
+			var got []string
+			for i, arg := range args {
+				if arg == "--max-thinking-tokens" && i+1 < len(args) {
+					got = args[i : i+2]
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("CLI args = %q, want %q", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestThinking_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*types.ClaudeAgentOptions)
+		wantErr   string
+	}{
+		{"negative budget", func(o *types.ClaudeAgentOptions) { o.WithMaxThinkingTokens(-1) }, "cannot be negative"},
+		{"budget while disabled", func(o *types.ClaudeAgentOptions) {
+			o.WithThinkingEnabled(false).WithMaxThinkingTokens(4096)
+		}, "thinking is disabled"},
+		{"enabled without budget", func(o *types.ClaudeAgentOptions) {
+			o.WithThinkingEnabled(true).WithMaxThinkingTokens(0)
+		}, "thinking is enabled"},
+		{"managed flag", func(o *types.ClaudeAgentOptions) {
+			budget := "4096"
+			o.WithExtraCLIArg("max-thinking-tokens", &budget)
+		}, "use WithMaxThinkingTokens instead"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := types.NewClaudeAgentOptions().WithCLIPath(writeEchoCLI(t))
+			tt.configure(opts)
+			if _, err := NewClient(context.Background(), opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewClient error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := Query(context.Background(), "hi", opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Query error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSettings_PathPassedToCLI(t *testing.T) {
+	args := recordedCLIArgs(t, types.NewClaudeAgentOptions().WithSettings("/etc/claude/team.json"))
+	if !strings.Contains(strings.Join(args, " "), "--settings /etc/claude/team.json") {
+		t.Errorf("CLI args = %v, want --settings /etc/claude/team.json", args)
+	}
+}
+
+func TestSettings_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*types.ClaudeAgentOptions)
+		wantErr   string
+	}{
+		{"unknown source", func(o *types.ClaudeAgentOptions) { o.WithSettingSources("global") }, `unknown setting source "global"`},
+		{"duplicate source", func(o *types.ClaudeAgentOptions) {
+			o.WithSettingSources(types.SettingSourceUser, types.SettingSourceUser)
+		}, "more than once"},
+		{"empty settings", func(o *types.ClaudeAgentOptions) { o.WithSettings(" ") }, "settings cannot be empty"},
+		{"malformed JSON", func(o *types.ClaudeAgentOptions) { o.WithSettings(`{"model":`) }, "not a valid JSON object"},
+		{"managed flag", func(o *types.ClaudeAgentOptions) { o.WithExtraCLIArg("settings", nil) }, "use WithSettings instead"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := types.NewClaudeAgentOptions().WithCLIPath(writeEchoCLI(t))
+			tt.configure(opts)
+			if _, err := NewClient(context.Background(), opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewClient error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := Query(context.Background(), "hi", opts); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Query error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// settingsArg returns the file the mock CLI was passed as --settings.
+func settingsArg(t *testing.T, cli *mockcli.CLI) string {
+	t.Helper()
+	args := cli.Args()
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "--settings" {
+			return args[i+1]
+		}
+	}
+	t.Fatalf("the CLI got no --settings: %q", args)
+	return ""
+}
+
+// TestSettings_JSONFileLifecycle tests that JSON settings reach the CLI as a
+// temporary file that exists while the client is connected and is removed on
+// Close.
+func TestSettings_JSONFileLifecycle(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{})
+	settings := `{"permissions":{"deny":["Bash(rm:*)"]}}`
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithSettings(settings)
+
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	path := settingsArg(t, cli)
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("settings file missing while connected: %v", err)
+	} else if string(got) != settings {
+		t.Errorf("settings file = %q, want %q", got, settings)
+	}
+
+	_ = client.Close(ctx)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("settings file %s still exists after Close (err = %v)", path, err)
+	}
+}
+
+// TestSettings_JSONFileRemovedOnConnectFailure tests that the temporary
+// settings file is removed when Connect fails after the CLI started.
+func TestSettings_JSONFileRemovedOnConnectFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{mockcli.Exit(1)}})
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithSettings(`{"model":"claude-sonnet-4-5"}`)
+
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err == nil {
+		t.Fatal("Connect succeeded, want an error from the exiting CLI")
+	}
+
+	path := settingsArg(t, cli)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("settings file %s still exists after a failed Connect (err = %v)", path, err)
+	}
+}
+
+func TestStderr_CallbackAndTail(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	got := make(chan string, 10)
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Stderr("warning: slow disk"),
+	}})
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path).WithStderr(func(line string) {
+		got <- line
+	})
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	// The scripted CLI writes to stderr once it has read a prompt
+	if err := client.Query(ctx, "hello"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	select {
+	case line := <-got:
+		if line != "warning: slow disk" {
+			t.Errorf("stderr callback got %q", line)
+		}
+	case <-ctx.Done():
+		t.Fatal("stderr callback was never called")
+	}
+
+	_ = client.Close(ctx)
+	if tail := client.StderrTail(); len(tail) != 1 || tail[0] != "warning: slow disk" {
+		t.Errorf("StderrTail() after Close = %q", tail)
+	}
+}
@@ -0,0 +1,244 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// ErrSubscriptionEnded is returned by Subscription.Next and the WaitFor
+// methods once the subscription has been closed, or once the connection it
+// follows has ended and every message read before that has been taken.
+var ErrSubscriptionEnded = errors.New("claude: subscription ended")
+
+// Subscription receives a copy of every message a connected Client reads
+// from the CLI, other than control messages, from when it was created until
+// it is closed or the connection ends. Messages are queued as they are read,
+// whether or not ReceiveResponse or other subscriptions consume them, so a
+// subscription never holds up the session; it must be closed once it is no
+// longer needed, since its queue grows until then.
+type Subscription struct {
+	mu     sync.Mutex
+	queue  []types.Message
+	ended  bool
+	ready  chan struct{} // signalled when a message is queued or the subscription ends
+	remove func()
+}
+
+// newSubscription creates a subscription whose Close calls remove.
+func newSubscription(remove func()) *Subscription {
+	return &Subscription{ready: make(chan struct{}, 1), remove: remove}
+}
+
+// deliver queues msg without blocking.
+func (s *Subscription) deliver(msg types.Message) {
+	s.mu.Lock()
+	if !s.ended {
+		s.queue = append(s.queue, msg)
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+// end stops the subscription receiving messages; queued ones can still be taken.
+func (s *Subscription) end() {
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+// signal wakes a waiting Next.
+func (s *Subscription) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns the oldest message not yet taken, waiting for one if
+// necessary. It returns ErrSubscriptionEnded once the subscription has ended
+// and its queue is empty, or ctx's error if ctx is done first.
+func (s *Subscription) Next(ctx context.Context) (types.Message, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			msg := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return msg, nil
+		}
+		ended := s.ended
+		s.mu.Unlock()
+		if ended {
+			return nil, ErrSubscriptionEnded
+		}
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// WaitFor takes messages until one satisfies pred and returns it. Messages
+// taken before it are discarded from this subscription only. It returns an
+// error under the same conditions as Next.
+func (s *Subscription) WaitFor(ctx context.Context, pred func(types.Message) bool) (types.Message, error) {
+	for {
+		msg, err := s.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if pred(msg) {
+			return msg, nil
+		}
+	}
+}
+
+// Close ends the subscription and discards its queued messages. It is safe
+// to call more than once.
+func (s *Subscription) Close() {
+	s.remove()
+	s.mu.Lock()
+	s.ended = true
+	s.queue = nil
+	s.mu.Unlock()
+	s.signal()
+}
+
+// subscribers fans the messages of one connection out to its subscriptions.
+// It has its own lock, since messages are published from the read loop.
+type subscribers struct {
+	mu    sync.Mutex
+	subs  map[*Subscription]struct{}
+	ended bool
+}
+
+// add creates a subscription, already ended if the connection has.
+func (s *subscribers) add() *Subscription {
+	var sub *Subscription
+	sub = newSubscription(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subs, sub)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		sub.end()
+		return sub
+	}
+	if s.subs == nil {
+		s.subs = make(map[*Subscription]struct{})
+	}
+	s.subs[sub] = struct{}{}
+	return sub
+}
+
+// publish delivers msg to every subscription unless it is a control message.
+// It is the query's message observer, so it never blocks.
+func (s *subscribers) publish(msg types.Message) {
+	switch msg.GetMessageType() {
+	case types.MessageTypeControlRequest, types.MessageTypeControlResponse:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		sub.deliver(msg)
+	}
+}
+
+// endWhenDone ends every subscription once done is closed.
+func (s *subscribers) endWhenDone(done <-chan struct{}) {
+	<-done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+	for sub := range s.subs {
+		sub.end()
+	}
+	s.subs = nil
+}
+
+// Subscribe returns a Subscription to the messages the client reads from the
+// CLI from now on, for as long as the current connection lasts. Subscribers
+// see every message, whatever ReceiveResponse or other subscribers do with
+// it, but as the CLI sent it: stream events are included, intercepted tool
+// results are not yet replaced, and screening flags and other messages the
+// SDK adds to the ReceiveResponse stream are absent. Close the subscription
+// once it is no longer needed.
+//
+// Returns a CLIConnectionError if the client is not connected.
+func (c *Client) Subscribe() (*Subscription, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return nil, types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+	return c.subscribers.add(), nil
+}
+
+// WaitFor blocks until the client reads a message satisfying pred and
+// returns it, without consuming it: ReceiveResponse and other subscribers
+// still receive every message. Only messages read after WaitFor is called
+// are considered; when the awaited message may arrive before then, such as
+// the result of a Query sent just before, call Subscribe first and use
+// Subscription.WaitFor. Canned predicates are WaitForToolUse, WaitForResult
+// and WaitForSystem.
+//
+// It returns ErrSubscriptionEnded if the connection ends first, ctx's error
+// if ctx is done first, and a CLIConnectionError if the client is not
+// connected.
+func (c *Client) WaitFor(ctx context.Context, pred func(types.Message) bool) (types.Message, error) {
+	sub, err := c.Subscribe()
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Close()
+	return sub.WaitFor(ctx, pred)
+}
+
+// WaitForToolUse returns a predicate matching an AssistantMessage that calls
+// the named tool, or any tool if name is empty.
+func WaitForToolUse(name string) func(types.Message) bool {
+	return func(msg types.Message) bool {
+		assistant, ok := msg.(*types.AssistantMessage)
+		if !ok {
+			return false
+		}
+		for _, use := range assistant.ToolUses() {
+			if name == "" || use.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WaitForResult returns a predicate matching the ResultMessage that ends a
+// turn.
+func WaitForResult() func(types.Message) bool {
+	return func(msg types.Message) bool {
+		_, ok := msg.(*types.ResultMessage)
+		return ok
+	}
+}
+
+// WaitForSystem returns a predicate matching a SystemMessage of the given
+// subtype, such as "init" or "compact_boundary", or of any subtype if
+// subtype is empty.
+func WaitForSystem(subtype string) func(types.Message) bool {
+	return func(msg types.Message) bool {
+		sys, ok := msg.(*types.SystemMessage)
+		return ok && sys.Type == types.MessageTypeSystem && (subtype == "" || sys.Subtype == subtype)
+	}
+}
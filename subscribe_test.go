@@ -0,0 +1,211 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// subscribedTurn is a turn calling Bash, with a status message between the
+// tool call and the answer.
+var subscribedTurn = []string{
+	interceptedToolUse,
+	`{"type":"system","subtype":"status","session_id":"s","status":"compacting"}`,
+	streamAssistant,
+	streamResult,
+}
+
+// connectSubscribed connects a client to a CLI answering each prompt with
+// subscribedTurn.
+func connectSubscribed(t *testing.T, ctx context.Context) *Client {
+	t.Helper()
+	cli := mockcli.New(t, mockcli.Scenario{EachPrompt: subscribedTurn})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	return client
+}
+
+// describeMessages returns the type and subtype of each message.
+func describeMessages(messages []types.Message) string {
+	var labels []string
+	for _, msg := range messages {
+		label := msg.GetMessageType()
+		if sys, ok := msg.(*types.SystemMessage); ok {
+			label += ":" + sys.Subtype
+		}
+		labels = append(labels, label)
+	}
+	return strings.Join(labels, ",")
+}
+
+func TestClient_WaitForWithReceiveResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := connectSubscribed(t, ctx)
+
+	// Subscribe before the prompt so that no message can be missed
+	subs := make([]*Subscription, 4)
+	for i := range subs {
+		sub, err := client.Subscribe()
+		if err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+		defer sub.Close()
+		subs[i] = sub
+	}
+	if err := client.Query(ctx, "list /srv"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var received, subscribed []types.Message
+	found := make([]types.Message, 3)
+	errs := make([]error, 3)
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		for msg := range client.ReceiveResponse(ctx) {
+			received = append(received, msg)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			msg, err := subs[3].Next(ctx)
+			if err != nil {
+				t.Errorf("Next failed: %v", err)
+				return
+			}
+			subscribed = append(subscribed, msg)
+			if WaitForResult()(msg) {
+				return
+			}
+		}
+	}()
+	for i, pred := range []func(types.Message) bool{WaitForToolUse("Bash"), WaitForSystem("status"), WaitForResult()} {
+		go func() {
+			defer wg.Done()
+			found[i], errs[i] = subs[i].WaitFor(ctx, pred)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("WaitFor %d failed: %v", i, err)
+		}
+	}
+	if uses := found[0].(*types.AssistantMessage).ToolUses(); len(uses) != 1 || uses[0].Name != "Bash" {
+		t.Errorf("WaitForToolUse found %+v, want the Bash call", found[0])
+	}
+	if sys := found[1].(*types.SystemMessage); sys.Subtype != "status" {
+		t.Errorf("WaitForSystem found %+v, want the status message", sys)
+	}
+	if _, ok := found[2].(*types.ResultMessage); !ok {
+		t.Errorf("WaitForResult found %+v, want the result", found[2])
+	}
+
+	// Waiting consumed nothing from the other consumers
+	want := "assistant,system:status,assistant,result"
+	if got := describeMessages(received); got != want {
+		t.Errorf("ReceiveResponse got %s, want %s", got, want)
+	}
+	if got := describeMessages(subscribed); got != want {
+		t.Errorf("subscriber got %s, want %s", got, want)
+	}
+}
+
+func TestClient_WaitFor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := connectSubscribed(t, ctx)
+
+	type waited struct {
+		msg types.Message
+		err error
+	}
+	done := make(chan waited, 1)
+	go func() {
+		msg, err := client.WaitFor(ctx, WaitForToolUse(""))
+		done <- waited{msg, err}
+	}()
+	waitFor(t, "WaitFor to subscribe", func() bool {
+		client.subscribers.mu.Lock()
+		defer client.subscribers.mu.Unlock()
+		return len(client.subscribers.subs) == 1
+	})
+
+	if err := client.Query(ctx, "list /srv"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	got := <-done
+	if got.err != nil || !WaitForToolUse("Bash")(got.msg) {
+		t.Fatalf("WaitFor = %+v, %v, want the Bash call", got.msg, got.err)
+	}
+
+	// The response is still there to receive in full
+	var received []types.Message
+	for msg := range client.ReceiveResponse(ctx) {
+		received = append(received, msg)
+	}
+	if got, want := describeMessages(received), "assistant,system:status,assistant,result"; got != want {
+		t.Errorf("ReceiveResponse got %s, want %s", got, want)
+	}
+
+	// The subscription was removed once WaitFor returned
+	client.subscribers.mu.Lock()
+	n := len(client.subscribers.subs)
+	client.subscribers.mu.Unlock()
+	if n != 0 {
+		t.Errorf("%d subscriptions left, want none", n)
+	}
+}
+
+func TestClient_WaitForEnded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if _, err := client.WaitFor(ctx, WaitForResult()); !types.IsCLIConnectionError(err) {
+		t.Errorf("WaitFor before Connect = %v, want a CLIConnectionError", err)
+	}
+	_ = client.Close(ctx)
+
+	client = connectSubscribed(t, ctx)
+	sub, err := client.Subscribe()
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.WaitFor(ctx, WaitForResult())
+		done <- err
+	}()
+	if err := client.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := <-done; !errors.Is(err, ErrSubscriptionEnded) && !types.IsCLIConnectionError(err) {
+		t.Errorf("WaitFor during Close = %v, want ErrSubscriptionEnded", err)
+	}
+	if _, err := sub.Next(ctx); !errors.Is(err, ErrSubscriptionEnded) {
+		t.Errorf("Next after Close = %v, want ErrSubscriptionEnded", err)
+	}
+}
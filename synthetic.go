@@ -0,0 +1,86 @@
+package claude
+
+import (
+	"context"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// turnTracker follows a turn's messages for the synthetic ResultMessage
+// emitted, with WithSyntheticResults, when the CLI abandons the turn.
+type turnTracker struct {
+	enabled   bool
+	start     time.Time
+	sessionID string
+}
+
+// newTurnTracker returns a tracker for a turn started at start.
+func newTurnTracker(options *types.ClaudeAgentOptions, start time.Time) *turnTracker {
+	return &turnTracker{enabled: options.SyntheticResults, start: start}
+}
+
+// observe records the session ID of a message read from the CLI.
+func (t *turnTracker) observe(msg types.Message) {
+	switch m := msg.(type) {
+	case *types.ResultMessage:
+		t.sessionID = m.SessionID
+	case *types.StreamEvent:
+		t.sessionID = m.SessionID
+	case *types.SystemMessage:
+		if id, ok := m.Data["session_id"].(string); ok && id != "" {
+			t.sessionID = id
+		}
+	}
+}
+
+// abandoned returns the synthetic result ending a turn abandoned because of
+// err, or because the CLI's output ended if err is nil. It returns nil unless
+// WithSyntheticResults is set.
+func (t *turnTracker) abandoned(err error) *types.ResultMessage {
+	if !t.enabled {
+		return nil
+	}
+	reason := "CLI output ended before the turn's result"
+	if err != nil {
+		reason = err.Error()
+	}
+	return types.NewSyntheticResult(t.sessionID, reason, time.Since(t.start))
+}
+
+// failed returns the synthetic result ending a turn the CLI abandoned with
+// msg, a system message of subtype "error". It returns nil for any other
+// message or unless WithSyntheticResults is set.
+func (t *turnTracker) failed(msg types.Message) *types.ResultMessage {
+	m, ok := msg.(*types.SystemMessage)
+	if !t.enabled || !ok || m.Subtype != "error" {
+		return nil
+	}
+	reason := "CLI reported an error before the turn's result"
+	for _, key := range []string{"error", "message"} {
+		if s, ok := m.Data[key].(string); ok && s != "" {
+			reason = s
+			break
+		}
+	}
+	return types.NewSyntheticResult(t.sessionID, reason, time.Since(t.start))
+}
+
+// sendSynthetic forwards the synthetic result of a Query turn abandoned
+// because of err, if WithSyntheticResults is set.
+func sendSynthetic(out *forwarder, turn *turnTracker, err error) {
+	if result := turn.abandoned(err); result != nil {
+		out.send(result)
+	}
+}
+
+// sendResult sends the synthetic result of a Client turn, if any.
+func sendResult(ctx context.Context, outputChan chan<- types.Message, result *types.ResultMessage) {
+	if result == nil {
+		return
+	}
+	select {
+	case outputChan <- result:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,233 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+const syntheticInit = `{"type":"system","subtype":"init","session_id":"sess_synth","model":"claude-sonnet-4-5"}`
+
+// syntheticResult returns the last message, failing unless it is a
+// synthetic result of session sess_synth.
+func syntheticResult(t *testing.T, got []types.Message) *types.ResultMessage {
+	t.Helper()
+	if len(got) == 0 {
+		t.Fatal("no messages, want a synthetic result last")
+	}
+	result, ok := got[len(got)-1].(*types.ResultMessage)
+	if !ok || !result.IsSynthetic() {
+		t.Fatalf("last message = %+v, want a synthetic result; got %s", got[len(got)-1], describeMessages(got))
+	}
+	if !result.IsError || result.Subtype != types.ResultSubtypeSynthetic || result.SessionID != "sess_synth" {
+		t.Errorf("synthetic result = %+v, want an error result of sess_synth", result)
+	}
+	if result.Usage != nil || result.TotalCostUSD != nil || result.NumTurns != 0 {
+		t.Errorf("synthetic result has usage %v, cost %v, turns %d; want none", result.Usage, result.TotalCostUSD, result.NumTurns)
+	}
+	if result.Result == nil || *result.Result == "" {
+		t.Error("synthetic result has no reason")
+	}
+	return result
+}
+
+func TestQuery_SyntheticResultOnExit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(syntheticInit, streamAssistant),
+		mockcli.Exit(0),
+	}})
+	messages, err := Query(ctx, "hello", types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithSyntheticResults(true))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	got := collect(t, ctx, messages)
+	if want := "system:init,assistant,result"; describeMessages(got) != want {
+		t.Fatalf("got %s, want %s", describeMessages(got), want)
+	}
+	result := syntheticResult(t, got)
+	if !strings.Contains(*result.Result, "output ended") {
+		t.Errorf("reason = %q, want the output ending", *result.Result)
+	}
+}
+
+func TestQuery_SyntheticResultAfterTransportFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(syntheticInit),
+		mockcli.Exit(3),
+	}})
+	messages, err := Query(ctx, "hello", types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithSyntheticResults(true))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	// The error message reports why, then the synthetic result ends the turn
+	got := collect(t, ctx, messages)
+	if want := "system:init,system:transport_failed,result"; describeMessages(got) != want {
+		t.Fatalf("got %s, want %s", describeMessages(got), want)
+	}
+	result := syntheticResult(t, got)
+	if !strings.Contains(*result.Result, "exit code: 3") {
+		t.Errorf("reason = %q, want the exit code", *result.Result)
+	}
+}
+
+func TestQuery_SyntheticResultOnIdleTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(syntheticInit),
+		mockcli.Hang(),
+	}})
+	messages, err := Query(ctx, "hello", types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithIdleTimeout(300*time.Millisecond).
+		WithSyntheticResults(true))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	got := collect(t, ctx, messages)
+	if want := "system:init,system:idle_timeout,result"; describeMessages(got) != want {
+		t.Fatalf("got %s, want %s", describeMessages(got), want)
+	}
+	syntheticResult(t, got)
+}
+
+func TestQuery_SyntheticResultOnErrorMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(syntheticInit, `{"type":"system","subtype":"error","error":"model overloaded"}`),
+	}})
+	messages, err := Query(ctx, "hello", types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithSyntheticResults(true))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	got := collect(t, ctx, messages)
+	if want := "system:init,system:error,result"; describeMessages(got) != want {
+		t.Fatalf("got %s, want %s", describeMessages(got), want)
+	}
+	if result := syntheticResult(t, got); *result.Result != "model overloaded" {
+		t.Errorf("reason = %q, want the CLI's error", *result.Result)
+	}
+}
+
+func TestQuery_NoSyntheticResultByDefault(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(syntheticInit),
+		mockcli.Exit(0),
+	}})
+	messages, err := Query(ctx, "hello", types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if got := describeMessages(collect(t, ctx, messages)); got != "system:init" {
+		t.Errorf("got %s, want only the init message", got)
+	}
+}
+
+func TestClient_SyntheticResult(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(syntheticInit, streamAssistant),
+		mockcli.Exit(3),
+	}})
+	sink := &durationSink{}
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithMetricsSink(sink).
+		WithSyntheticResults(true))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() { _ = client.Close(context.Background()) }()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// RunTurn reports the failure, and the synthetic result is not the turn's
+	turn, err := client.RunTurn(ctx, "hello")
+	var procErr *types.ProcessError
+	if !errors.As(err, &procErr) || procErr.ExitCode != 3 {
+		t.Fatalf("RunTurn error = %v, want a ProcessError with exit code 3", err)
+	}
+	if turn.Result != nil {
+		t.Errorf("turn.Result = %+v, want none", turn.Result)
+	}
+	if want := "system:init,assistant,system:transport_failed,result"; describeMessages(turn.Messages) != want {
+		t.Fatalf("got %s, want %s", describeMessages(turn.Messages), want)
+	}
+	syntheticResult(t, turn.Messages)
+
+	// Accounting ignores the synthetic result
+	if stats := client.Stats(); stats.Turns != 0 {
+		t.Errorf("Stats().Turns = %d, want 0", stats.Turns)
+	}
+	if observed := sink.observed(types.MetricResponseDuration); len(observed) != 0 {
+		t.Errorf("%s observed %d results, want none", types.MetricResponseDuration, len(observed))
+	}
+}
+
+func TestClient_SyntheticResultOnErrorMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(syntheticInit, `{"type":"system","subtype":"error","message":"model overloaded"}`),
+	}})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithSyntheticResults(true))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() { _ = client.Close(context.Background()) }()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "hello"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	// The response ends at the synthetic result although the CLI is still running
+	got := collect(t, ctx, client.ReceiveResponse(ctx))
+	if want := "system:init,system:error,result"; describeMessages(got) != want {
+		t.Fatalf("got %s, want %s", describeMessages(got), want)
+	}
+	if result := syntheticResult(t, got); *result.Result != "model overloaded" {
+		t.Errorf("reason = %q, want the CLI's error", *result.Result)
+	}
+}
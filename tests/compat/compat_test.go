@@ -0,0 +1,126 @@
+package compat
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+)
+
+// scenarioTimeout bounds each scenario against a real CLI.
+const scenarioTimeout = 3 * time.Minute
+
+// TestCompatMatrix runs the scenario suite against every pinned CLI version
+// and writes a compatibility report. It only runs with CLAUDE_COMPAT=1.
+//
+// A version without a pinned SHA-256 fails unless CLAUDE_COMPAT_PIN=1, which
+// records the verified checksum in versions.json instead.
+func TestCompatMatrix(t *testing.T) {
+	if os.Getenv("CLAUDE_COMPAT") != "1" {
+		t.Skip("Set CLAUDE_COMPAT=1 to run the CLI compatibility matrix")
+	}
+	if testing.Short() {
+		t.Skip("Skipping compatibility matrix in short mode")
+	}
+	if os.Getenv("ANTHROPIC_API_KEY") == "" && os.Getenv("CLAUDE_API_KEY") == "" {
+		t.Skip("ANTHROPIC_API_KEY or CLAUDE_API_KEY is required")
+	}
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("Node.js is required to run the downloaded CLI")
+	}
+
+	manifest, err := LoadManifest("versions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := manifest.Filter(os.Getenv("CLAUDE_COMPAT_VERSIONS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheDir := os.Getenv("CLAUDE_COMPAT_CACHE")
+	if cacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			t.Fatalf("no cache directory: %v", err)
+		}
+		cacheDir = filepath.Join(userCache, "claude-agent-sdk-go", "compat")
+	}
+	reportPath := os.Getenv("CLAUDE_COMPAT_REPORT")
+	if reportPath == "" {
+		reportPath = "compat-report.json"
+	}
+
+	downloader := &Downloader{
+		CacheDir: cacheDir,
+		Registry: os.Getenv("CLAUDE_COMPAT_REGISTRY"),
+		Package:  manifest.Package,
+	}
+	report := &Report{
+		SchemaVersion: ReportSchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		SDKVersion:    transport.SDKVersion,
+		Package:       manifest.Package,
+	}
+
+	pin := os.Getenv("CLAUDE_COMPAT_PIN") == "1"
+	pinned := false
+
+	ctx := context.Background()
+	for _, v := range versions {
+		t.Run(v.Version, func(t *testing.T) {
+			result := VersionResult{Version: v.Version}
+			defer func() {
+				report.Add(result)
+			}()
+
+			inst, err := downloader.Fetch(ctx, v)
+			if err != nil {
+				result.Error = err.Error()
+				t.Error(err)
+				return
+			}
+			result.SHA256 = inst.SHA256
+			if v.SHA256 == "" {
+				if !pin {
+					result.Error = fmt.Sprintf("%s is not pinned; sha256 is %s", v.Version, inst.SHA256)
+					t.Errorf("%s (set CLAUDE_COMPAT_PIN=1 to record it)", result.Error)
+					return
+				}
+				manifest.Pin(v.Version, inst.SHA256)
+				pinned = true
+				t.Logf("Pinned %s to sha256 %s", v.Version, inst.SHA256)
+			}
+
+			connected := true
+			for _, s := range Scenarios() {
+				if !connected {
+					result.Scenarios = append(result.Scenarios, ScenarioResult{Name: s.Name, Status: StatusSkip, Error: "connect failed"})
+					continue
+				}
+
+				sr := RunScenario(ctx, s, inst.CLIPath, scenarioTimeout)
+				result.Scenarios = append(result.Scenarios, sr)
+				if sr.Status == StatusFail {
+					t.Errorf("%s: %s", s.Name, sr.Error)
+					connected = s.Name != "connect"
+				}
+			}
+		})
+	}
+
+	if pinned {
+		if err := manifest.WriteFile("versions.json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := report.WriteFile(reportPath); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Wrote compatibility report to %s", reportPath)
+}
@@ -0,0 +1,31 @@
+// Package compat is an opt-in harness that checks the SDK against pinned
+// versions of the Claude Code CLI.
+//
+// The harness downloads each version listed in versions.json from the npm
+// registry into a local cache, verifies the tarball against the registry's
+// integrity digest and the pinned SHA-256, and runs a core scenario
+// suite against it: connect, query, permission callback, hook, interrupt, and
+// resume. The outcome is written as a machine-readable JSON Report. The
+// report is for people and CI tooling; the SDK does not read it, and
+// applications gate on versions with WithMinCLIVersion and the capabilities
+// the CLI reports at initialize.
+//
+// The matrix never runs by default. It requires network access, Node.js, and
+// an API key, and is enabled with environment variables:
+//
+//	CLAUDE_COMPAT=1                  enable the matrix test
+//	CLAUDE_COMPAT_VERSIONS=a,b       run only these versions from versions.json
+//	CLAUDE_COMPAT_CACHE=dir          download cache (default: user cache dir)
+//	CLAUDE_COMPAT_REPORT=file        report path (default: compat-report.json)
+//	CLAUDE_COMPAT_REGISTRY=url       npm registry (default: https://registry.npmjs.org)
+//	CLAUDE_COMPAT_PIN=1              record checksums of unpinned versions
+//
+// Example:
+//
+//	CLAUDE_COMPAT=1 go test -v -timeout 30m ./tests/compat/
+//
+// A download whose SHA-256 differs from its pin fails, and so does a version
+// with an empty sha256. New versions are added with an empty sha256 and
+// pinned by one run with CLAUDE_COMPAT_PIN=1, which verifies them against the
+// registry integrity digest and writes the computed SHA-256 to versions.json.
+package compat
@@ -0,0 +1,454 @@
+package compat
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRegistry is the public npm registry.
+	DefaultRegistry = "https://registry.npmjs.org"
+
+	// defaultMaxSize caps the size of a downloaded tarball.
+	defaultMaxSize = 256 << 20
+
+	// markerFile records the verified tarball digest inside a cached install.
+	markerFile = ".sha256"
+)
+
+// Install is a verified CLI version unpacked in the cache.
+type Install struct {
+	Version string
+	Dir     string
+	CLIPath string // Executable cli.js entry point
+	SHA256  string // Hex SHA-256 of the npm tarball
+}
+
+// Downloader fetches CLI versions from an npm registry into a cache directory.
+type Downloader struct {
+	CacheDir string
+	Registry string       // Defaults to DefaultRegistry
+	Package  string       // Defaults to DefaultPackage
+	Client   *http.Client // Defaults to a client with a 5 minute timeout
+	Attempts int          // Attempts per request for transient failures; defaults to 3
+	Backoff  time.Duration
+	MaxSize  int64 // Maximum tarball size in bytes; defaults to 256 MiB
+}
+
+// statusError is a non-2xx HTTP response.
+type statusError struct {
+	URL  string
+	Code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("GET %s: HTTP %d", e.URL, e.Code)
+}
+
+// retryable reports whether a failed request is worth retrying.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.Code == http.StatusTooManyRequests || se.Code >= 500
+	}
+	var ce *checksumError
+	return !errors.As(err, &ce)
+}
+
+// checksumError is a download that does not match its expected digest.
+type checksumError struct {
+	Kind     string
+	Expected string
+	Actual   string
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("%s mismatch: expected %s, got %s", e.Kind, e.Expected, e.Actual)
+}
+
+// Fetch returns the cached install for v, downloading and verifying it first
+// if needed.
+func (d *Downloader) Fetch(ctx context.Context, v PinnedVersion) (*Install, error) {
+	if !versionPattern.MatchString(v.Version) {
+		return nil, fmt.Errorf("compat: invalid version %q", v.Version)
+	}
+	if err := os.MkdirAll(d.CacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("compat: %w", err)
+	}
+
+	dir := filepath.Join(d.CacheDir, v.Version)
+	if inst, ok := d.cached(dir, v); ok {
+		return inst, nil
+	}
+
+	tarball, integrity, err := d.resolve(ctx, v.Version)
+	if err != nil {
+		return nil, fmt.Errorf("compat: resolve %s: %w", v.Version, err)
+	}
+
+	var archive string
+	var sum string
+	err = d.retry(ctx, func() error {
+		archive, sum, err = d.download(ctx, tarball, integrity)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("compat: download %s: %w", v.Version, err)
+	}
+	defer func() {
+		_ = os.Remove(archive)
+	}()
+
+	if v.SHA256 != "" && !strings.EqualFold(v.SHA256, sum) {
+		return nil, fmt.Errorf("compat: download %s: %w", v.Version, &checksumError{Kind: "pinned sha256", Expected: v.SHA256, Actual: sum})
+	}
+
+	if err := d.unpack(archive, dir, sum); err != nil {
+		return nil, fmt.Errorf("compat: unpack %s: %w", v.Version, err)
+	}
+
+	inst, ok := d.cached(dir, v)
+	if !ok {
+		return nil, fmt.Errorf("compat: %s has no cli.js entry point", v.Version)
+	}
+	return inst, nil
+}
+
+// cached returns a previously verified install in dir, if it matches the pin.
+func (d *Downloader) cached(dir string, v PinnedVersion) (*Install, bool) {
+	marker, err := os.ReadFile(filepath.Join(dir, markerFile))
+	if err != nil {
+		return nil, false
+	}
+	sum := strings.TrimSpace(string(marker))
+	if v.SHA256 != "" && !strings.EqualFold(v.SHA256, sum) {
+		return nil, false
+	}
+
+	cli := filepath.Join(dir, "package", "cli.js")
+	if _, err := os.Stat(cli); err != nil {
+		return nil, false
+	}
+	return &Install{Version: v.Version, Dir: dir, CLIPath: cli, SHA256: sum}, true
+}
+
+// resolve looks up the tarball URL and integrity digest of a version.
+func (d *Downloader) resolve(ctx context.Context, version string) (tarball, integrity string, err error) {
+	metaURL := strings.TrimSuffix(d.registry(), "/") + "/" + url.PathEscape(d.pkg()) + "/" + version
+
+	var meta struct {
+		Dist struct {
+			Tarball   string `json:"tarball"`
+			Integrity string `json:"integrity"`
+			Shasum    string `json:"shasum"`
+		} `json:"dist"`
+	}
+	err = d.retry(ctx, func() error {
+		resp, err := d.get(ctx, metaURL)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		return json.NewDecoder(io.LimitReader(resp.Body, 10<<20)).Decode(&meta)
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if meta.Dist.Tarball == "" {
+		return "", "", fmt.Errorf("registry metadata has no tarball URL")
+	}
+	integrity = meta.Dist.Integrity
+	if integrity == "" && meta.Dist.Shasum != "" {
+		integrity = "sha1-hex-" + meta.Dist.Shasum
+	}
+	if integrity == "" {
+		return "", "", fmt.Errorf("registry metadata has no integrity digest")
+	}
+	return meta.Dist.Tarball, integrity, nil
+}
+
+// download streams the tarball to a temporary file, verifying it against the
+// registry integrity digest. It returns the file path and its hex SHA-256.
+func (d *Downloader) download(ctx context.Context, tarball, integrity string) (string, string, error) {
+	verify, err := newIntegrity(integrity)
+	if err != nil {
+		return "", "", err
+	}
+
+	resp, err := d.get(ctx, tarball)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	f, err := os.CreateTemp(d.CacheDir, "download-*.tgz")
+	if err != nil {
+		return "", "", err
+	}
+	ok := false
+	defer func() {
+		_ = f.Close()
+		if !ok {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	sha := sha256.New()
+	limit := d.maxSize()
+	n, err := io.Copy(io.MultiWriter(f, sha, verify), io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return "", "", err
+	}
+	if n > limit {
+		return "", "", &checksumError{Kind: "size", Expected: fmt.Sprintf("at most %d bytes", limit), Actual: fmt.Sprintf("more than %d bytes", limit)}
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return "", "", fmt.Errorf("truncated download: got %d of %d bytes", n, resp.ContentLength)
+	}
+	if err := verify.check(); err != nil {
+		return "", "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", "", err
+	}
+
+	ok = true
+	return f.Name(), hex.EncodeToString(sha.Sum(nil)), nil
+}
+
+// get issues a GET request and returns the response for 2xx statuses.
+func (d *Downloader) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_ = resp.Body.Close()
+		return nil, &statusError{URL: rawURL, Code: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// retry runs fn until it succeeds, fails permanently, or attempts run out.
+func (d *Downloader) retry(ctx context.Context, fn func() error) error {
+	attempts := d.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	backoff := d.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil || !retryable(err) {
+			return err
+		}
+		if i == attempts-1 {
+			break
+		}
+
+		select {
+		case <-time.After(backoff << i):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+}
+
+// unpack extracts the tarball into dir and records its digest.
+func (d *Downloader) unpack(archive, dir, sum string) error {
+	staging, err := os.MkdirTemp(d.CacheDir, "unpack-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(staging)
+	}()
+
+	if err := extractTarGz(archive, staging); err != nil {
+		return err
+	}
+
+	// npm does not preserve the executable bit on every platform
+	if cli := filepath.Join(staging, "package", "cli.js"); fileExists(cli) {
+		if err := os.Chmod(cli, 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(staging, markerFile), []byte(sum+"\n"), 0644); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(staging, dir)
+}
+
+// extractTarGz extracts regular files and directories from a gzipped tar,
+// rejecting entries that would escape dest.
+func extractTarGz(archive, dest string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = gz.Close()
+	}()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dest, filepath.FromSlash(hdr.Name))
+		if target != dest && !strings.HasPrefix(target, dest+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %q escapes destination", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := writeFile(target, tr, os.FileMode(hdr.Mode).Perm()|0600); err != nil {
+				return err
+			}
+		default:
+			// Links and special files are not needed to run the CLI
+		}
+	}
+}
+
+// writeFile copies r into a new file at path.
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// integrity verifies data against an npm integrity string.
+type integrity struct {
+	hash.Hash
+	kind     string
+	expected string
+	hexSum   bool
+}
+
+// newIntegrity parses an npm "sha512-<base64>" integrity string, or the
+// internal "sha1-hex-<hex>" form used for legacy shasum metadata.
+func newIntegrity(s string) (*integrity, error) {
+	switch {
+	case strings.HasPrefix(s, "sha512-"):
+		return &integrity{Hash: sha512.New(), kind: "sha512 integrity", expected: strings.TrimPrefix(s, "sha512-")}, nil
+	case strings.HasPrefix(s, "sha1-hex-"):
+		return &integrity{Hash: sha1.New(), kind: "sha1 shasum", expected: strings.TrimPrefix(s, "sha1-hex-"), hexSum: true}, nil
+	}
+	return nil, fmt.Errorf("unsupported integrity digest %q", s)
+}
+
+// check compares the accumulated digest with the expected one.
+func (i *integrity) check() error {
+	sum := i.Sum(nil)
+
+	// Base64 digests are case-sensitive; hex digests are not
+	actual := base64.StdEncoding.EncodeToString(sum)
+	match := actual == i.expected
+	if i.hexSum {
+		actual = hex.EncodeToString(sum)
+		match = strings.EqualFold(actual, i.expected)
+	}
+	if !match {
+		return &checksumError{Kind: i.kind, Expected: i.expected, Actual: actual}
+	}
+	return nil
+}
+
+func (d *Downloader) registry() string {
+	if d.Registry == "" {
+		return DefaultRegistry
+	}
+	return d.Registry
+}
+
+func (d *Downloader) pkg() string {
+	if d.Package == "" {
+		return DefaultPackage
+	}
+	return d.Package
+}
+
+func (d *Downloader) client() *http.Client {
+	if d.Client == nil {
+		return &http.Client{Timeout: 5 * time.Minute}
+	}
+	return d.Client
+}
+
+func (d *Downloader) maxSize() int64 {
+	if d.MaxSize <= 0 {
+		return defaultMaxSize
+	}
+	return d.MaxSize
+}
@@ -0,0 +1,260 @@
+package compat
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// buildTarball returns a gzipped tar containing the given files.
+func buildTarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// fakeRegistry serves npm metadata and a tarball for version 1.2.3.
+type fakeRegistry struct {
+	*httptest.Server
+	tarball      []byte
+	integrity    string
+	failTarballs int32 // Number of tarball requests to fail with 503
+	status       int   // If set, every request fails with this status
+	tarballHits  int32
+}
+
+func newFakeRegistry(t *testing.T, tarball []byte) *fakeRegistry {
+	t.Helper()
+
+	sum := sha512.Sum512(tarball)
+	r := &fakeRegistry{
+		tarball:   tarball,
+		integrity: "sha512-" + base64.StdEncoding.EncodeToString(sum[:]),
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.status != 0 {
+			w.WriteHeader(r.status)
+			return
+		}
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/1.2.3"):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"dist": map[string]string{
+					"tarball":   r.URL + "/claude-code-1.2.3.tgz",
+					"integrity": r.integrity,
+				},
+			})
+		case strings.HasSuffix(req.URL.Path, ".tgz"):
+			if atomic.AddInt32(&r.tarballHits, 1) <= atomic.LoadInt32(&r.failTarballs) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write(r.tarball)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func newTestDownloader(t *testing.T, registry string) *Downloader {
+	return &Downloader{CacheDir: t.TempDir(), Registry: registry, Backoff: 1}
+}
+
+var cliFiles = map[string]string{
+	"package/cli.js":       "#!/usr/bin/env node\n",
+	"package/package.json": `{"name":"@anthropic-ai/claude-code","version":"1.2.3"}`,
+}
+
+// TestFetchVerifiesAndCaches tests that a verified download is unpacked and reused.
+func TestFetchVerifiesAndCaches(t *testing.T) {
+	tarball := buildTarball(t, cliFiles)
+	reg := newFakeRegistry(t, tarball)
+	d := newTestDownloader(t, reg.URL)
+
+	inst, err := d.Fetch(context.Background(), PinnedVersion{Version: "1.2.3"})
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+
+	sum := sha256.Sum256(tarball)
+	if inst.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("SHA256 = %s, want %x", inst.SHA256, sum)
+	}
+	info, err := os.Stat(inst.CLIPath)
+	if err != nil {
+		t.Fatalf("cli.js missing: %v", err)
+	}
+	if info.Mode()&0100 == 0 {
+		t.Errorf("cli.js is not executable: %v", info.Mode())
+	}
+
+	// A pinned fetch of the same version must hit the cache
+	if _, err := d.Fetch(context.Background(), PinnedVersion{Version: "1.2.3", SHA256: inst.SHA256}); err != nil {
+		t.Fatalf("cached Fetch failed: %v", err)
+	}
+	if hits := atomic.LoadInt32(&reg.tarballHits); hits != 1 {
+		t.Errorf("tarball downloaded %d times, want 1", hits)
+	}
+}
+
+// TestFetchIntegrityMismatch tests that a tarball not matching the registry digest is rejected.
+func TestFetchIntegrityMismatch(t *testing.T) {
+	reg := newFakeRegistry(t, buildTarball(t, cliFiles))
+	reg.integrity = "sha512-" + base64.StdEncoding.EncodeToString(make([]byte, sha512.Size))
+	d := newTestDownloader(t, reg.URL)
+
+	_, err := d.Fetch(context.Background(), PinnedVersion{Version: "1.2.3"})
+	var ce *checksumError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	if hits := atomic.LoadInt32(&reg.tarballHits); hits != 1 {
+		t.Errorf("checksum failure retried: %d downloads", hits)
+	}
+	if _, err := os.Stat(filepath.Join(d.CacheDir, "1.2.3")); !os.IsNotExist(err) {
+		t.Error("rejected download was cached")
+	}
+	assertNoTempFiles(t, d.CacheDir)
+}
+
+// TestFetchPinnedMismatch tests that a pinned SHA-256 is enforced.
+func TestFetchPinnedMismatch(t *testing.T) {
+	reg := newFakeRegistry(t, buildTarball(t, cliFiles))
+	d := newTestDownloader(t, reg.URL)
+
+	_, err := d.Fetch(context.Background(), PinnedVersion{Version: "1.2.3", SHA256: strings.Repeat("0", 64)})
+	if err == nil || !strings.Contains(err.Error(), "pinned sha256 mismatch") {
+		t.Fatalf("expected pinned checksum error, got %v", err)
+	}
+	assertNoTempFiles(t, d.CacheDir)
+}
+
+// TestFetchRetriesTransientFailures tests that 5xx responses are retried.
+func TestFetchRetriesTransientFailures(t *testing.T) {
+	reg := newFakeRegistry(t, buildTarball(t, cliFiles))
+	reg.failTarballs = 2
+	d := newTestDownloader(t, reg.URL)
+
+	if _, err := d.Fetch(context.Background(), PinnedVersion{Version: "1.2.3"}); err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if hits := atomic.LoadInt32(&reg.tarballHits); hits != 3 {
+		t.Errorf("tarball requested %d times, want 3", hits)
+	}
+
+	reg.failTarballs = 100
+	atomic.StoreInt32(&reg.tarballHits, 0)
+	d = newTestDownloader(t, reg.URL)
+	_, err := d.Fetch(context.Background(), PinnedVersion{Version: "1.2.3"})
+	if err == nil || !strings.Contains(err.Error(), "giving up after 3 attempts") {
+		t.Errorf("expected retries to be exhausted, got %v", err)
+	}
+}
+
+// TestFetchNotFound tests that client errors fail without retrying.
+func TestFetchNotFound(t *testing.T) {
+	reg := newFakeRegistry(t, nil)
+	reg.status = http.StatusNotFound
+	d := newTestDownloader(t, reg.URL)
+
+	_, err := d.Fetch(context.Background(), PinnedVersion{Version: "1.2.3"})
+	var se *statusError
+	if !errors.As(err, &se) || se.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 status error, got %v", err)
+	}
+}
+
+// TestFetchUnreachableRegistry tests that connection failures are reported.
+func TestFetchUnreachableRegistry(t *testing.T) {
+	reg := newFakeRegistry(t, nil)
+	url := reg.URL
+	reg.Close()
+
+	d := newTestDownloader(t, url)
+	if _, err := d.Fetch(context.Background(), PinnedVersion{Version: "1.2.3"}); err == nil {
+		t.Fatal("expected error from unreachable registry")
+	}
+}
+
+// TestFetchMissingEntryPoint tests that a package without cli.js is rejected.
+func TestFetchMissingEntryPoint(t *testing.T) {
+	reg := newFakeRegistry(t, buildTarball(t, map[string]string{"package/package.json": "{}"}))
+	d := newTestDownloader(t, reg.URL)
+
+	_, err := d.Fetch(context.Background(), PinnedVersion{Version: "1.2.3"})
+	if err == nil || !strings.Contains(err.Error(), "no cli.js") {
+		t.Fatalf("expected missing entry point error, got %v", err)
+	}
+}
+
+// TestExtractRejectsTraversal tests that archive entries cannot escape the destination.
+func TestExtractRejectsTraversal(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "evil.tgz")
+	if err := os.WriteFile(archive, buildTarball(t, map[string]string{"../evil.txt": "x"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(dir, "out")
+	err := extractTarGz(archive, dest)
+	if err == nil || !strings.Contains(err.Error(), "escapes destination") {
+		t.Fatalf("expected traversal error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+		t.Error("traversal entry was written")
+	}
+}
+
+// TestInvalidVersion tests that versions are validated before use in paths.
+func TestInvalidVersion(t *testing.T) {
+	d := newTestDownloader(t, "http://127.0.0.1:0")
+	if _, err := d.Fetch(context.Background(), PinnedVersion{Version: "../1.0.0"}); err == nil {
+		t.Fatal("expected invalid version error")
+	}
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("unexpected leftover %s", e.Name())
+	}
+}
@@ -0,0 +1,105 @@
+package compat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultPackage is the npm package that ships the Claude Code CLI.
+const DefaultPackage = "@anthropic-ai/claude-code"
+
+// versionPattern restricts versions to plain semver so they are safe to use
+// in URLs and cache paths.
+var versionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.]+)?$`)
+
+// PinnedVersion is a CLI version to test, optionally pinned to the SHA-256 of
+// its npm tarball.
+type PinnedVersion struct {
+	Version string `json:"version"`
+	SHA256  string `json:"sha256,omitempty"`
+}
+
+// Manifest lists the CLI versions in the support matrix.
+type Manifest struct {
+	Package  string          `json:"package"`
+	Versions []PinnedVersion `json:"versions"`
+}
+
+// LoadManifest reads and validates a manifest file.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("compat: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("compat: invalid manifest %s: %w", path, err)
+	}
+	if m.Package == "" {
+		m.Package = DefaultPackage
+	}
+
+	seen := make(map[string]bool)
+	for _, v := range m.Versions {
+		if !versionPattern.MatchString(v.Version) {
+			return nil, fmt.Errorf("compat: invalid version %q in %s", v.Version, path)
+		}
+		if seen[v.Version] {
+			return nil, fmt.Errorf("compat: duplicate version %q in %s", v.Version, path)
+		}
+		seen[v.Version] = true
+	}
+	return &m, nil
+}
+
+// Pin sets the SHA-256 of version and reports whether the version is in the
+// manifest.
+func (m *Manifest) Pin(version, sha256 string) bool {
+	for i := range m.Versions {
+		if m.Versions[i].Version == version {
+			m.Versions[i].SHA256 = strings.ToLower(sha256)
+			return true
+		}
+	}
+	return false
+}
+
+// WriteFile writes the manifest as indented JSON.
+func (m *Manifest) WriteFile(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("compat: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("compat: %w", err)
+	}
+	return nil
+}
+
+// Filter returns the pinned versions whose version is in the comma-separated
+// list. An empty list returns all versions.
+func (m *Manifest) Filter(list string) ([]PinnedVersion, error) {
+	if strings.TrimSpace(list) == "" {
+		return m.Versions, nil
+	}
+
+	byVersion := make(map[string]PinnedVersion, len(m.Versions))
+	for _, v := range m.Versions {
+		byVersion[v.Version] = v
+	}
+
+	var selected []PinnedVersion
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		v, ok := byVersion[name]
+		if !ok {
+			return nil, fmt.Errorf("compat: version %q is not in the manifest", name)
+		}
+		selected = append(selected, v)
+	}
+	return selected, nil
+}
@@ -0,0 +1,97 @@
+package compat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLoadManifest tests that the checked-in manifest is valid.
+func TestLoadManifest(t *testing.T) {
+	m, err := LoadManifest("versions.json")
+	if err != nil {
+		t.Fatalf("LoadManifest failed: %v", err)
+	}
+	if m.Package != DefaultPackage {
+		t.Errorf("Package = %q, want %q", m.Package, DefaultPackage)
+	}
+	if len(m.Versions) == 0 {
+		t.Fatal("manifest lists no versions")
+	}
+
+	selected, err := m.Filter(m.Versions[0].Version)
+	if err != nil || len(selected) != 1 {
+		t.Errorf("Filter = %v, %v", selected, err)
+	}
+	if _, err := m.Filter("0.0.0"); err == nil {
+		t.Error("expected error filtering for unknown version")
+	}
+}
+
+// TestLoadManifestRejectsInvalid tests manifest validation.
+func TestLoadManifestRejectsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"bad version": `{"versions":[{"version":"latest"}]}`,
+		"duplicate":   `{"versions":[{"version":"1.0.0"},{"version":"1.0.0"}]}`,
+		"bad json":    `{`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "versions.json")
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadManifest(path); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+// TestManifestPin tests that pinned checksums are written back to the manifest.
+func TestManifestPin(t *testing.T) {
+	m := &Manifest{Package: DefaultPackage, Versions: []PinnedVersion{{Version: "1.0.0"}, {Version: "1.0.1", SHA256: "abc"}}}
+	if m.Pin("0.0.0", "def") {
+		t.Error("Pin succeeded for a version not in the manifest")
+	}
+	if !m.Pin("1.0.0", "DEF") {
+		t.Fatal("Pin failed for a listed version")
+	}
+
+	path := filepath.Join(t.TempDir(), "versions.json")
+	if err := m.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Versions[0].SHA256 != "def" || got.Versions[1].SHA256 != "abc" {
+		t.Errorf("Versions = %+v", got.Versions)
+	}
+}
+
+// TestReportRoundTrip tests that reports compute compatibility and round-trip.
+func TestReportRoundTrip(t *testing.T) {
+	r := &Report{SchemaVersion: ReportSchemaVersion, GeneratedAt: time.Now().UTC()}
+	r.Add(VersionResult{Version: "1.0.0", Scenarios: []ScenarioResult{{Name: "connect", Status: StatusPass}}})
+	r.Add(VersionResult{Version: "1.0.1", Scenarios: []ScenarioResult{{Name: "connect", Status: StatusFail}}})
+	r.Add(VersionResult{Version: "1.0.2", Error: "download failed"})
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := r.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []bool{true, false, false}
+	for i, res := range got.Results {
+		if res.Compatible != want[i] {
+			t.Errorf("%s: Compatible = %v, want %v", res.Version, res.Compatible, want[i])
+		}
+	}
+}
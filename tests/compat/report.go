@@ -0,0 +1,85 @@
+package compat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ReportSchemaVersion is the version of the Report JSON format.
+const ReportSchemaVersion = 1
+
+// Scenario outcomes.
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// Report is the machine-readable result of a compatibility run.
+type Report struct {
+	SchemaVersion int             `json:"schema_version"`
+	GeneratedAt   time.Time       `json:"generated_at"`
+	SDKVersion    string          `json:"sdk_version"`
+	Package       string          `json:"package"`
+	Results       []VersionResult `json:"results"`
+}
+
+// VersionResult is the outcome of the scenario suite against one CLI version.
+// Compatible is true when no scenario failed.
+type VersionResult struct {
+	Version    string           `json:"version"`
+	SHA256     string           `json:"sha256,omitempty"`
+	Compatible bool             `json:"compatible"`
+	Error      string           `json:"error,omitempty"` // Download or setup failure
+	Scenarios  []ScenarioResult `json:"scenarios"`
+}
+
+// ScenarioResult is the outcome of one scenario.
+type ScenarioResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Add appends a version result, computing its Compatible flag.
+func (r *Report) Add(result VersionResult) {
+	result.Compatible = result.Error == ""
+	for _, s := range result.Scenarios {
+		if s.Status == StatusFail {
+			result.Compatible = false
+		}
+	}
+	r.Results = append(r.Results, result)
+}
+
+// WriteFile writes the report as indented JSON.
+func (r *Report) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("compat: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("compat: %w", err)
+	}
+	return nil
+}
+
+// ReadReport reads a report written by WriteFile.
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("compat: %w", err)
+	}
+
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("compat: invalid report %s: %w", path, err)
+	}
+	if r.SchemaVersion != ReportSchemaVersion {
+		return nil, fmt.Errorf("compat: unsupported report schema version %d", r.SchemaVersion)
+	}
+	return &r, nil
+}
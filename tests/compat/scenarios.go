@@ -0,0 +1,239 @@
+package compat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	claude "github.com/schlunsen/claude-agent-sdk-go"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// Scenario is one check run against a CLI version.
+type Scenario struct {
+	Name string
+	Run  func(ctx context.Context, cliPath string) error
+}
+
+// Scenarios returns the core scenario suite in execution order.
+func Scenarios() []Scenario {
+	return []Scenario{
+		{Name: "connect", Run: scenarioConnect},
+		{Name: "query", Run: scenarioQuery},
+		{Name: "permission_callback", Run: scenarioPermissionCallback},
+		{Name: "hook", Run: scenarioHook},
+		{Name: "interrupt", Run: scenarioInterrupt},
+		{Name: "resume", Run: scenarioResume},
+	}
+}
+
+// RunScenario runs s with a timeout and reports its outcome.
+func RunScenario(ctx context.Context, s Scenario, cliPath string, timeout time.Duration) ScenarioResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := s.Run(ctx, cliPath)
+	result := ScenarioResult{Name: s.Name, Status: StatusPass, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// baseOptions returns options shared by all scenarios.
+func baseOptions(cliPath string) *types.ClaudeAgentOptions {
+	return types.NewClaudeAgentOptions().
+		WithCLIPath(cliPath).
+		WithMaxTurns(3)
+}
+
+// session is the outcome of one prompt on a client.
+type session struct {
+	result *types.ResultMessage
+	text   string
+}
+
+// ask sends a prompt on a connected client and collects the response.
+// If onAssistant is non-nil it is called for each assistant message.
+func ask(ctx context.Context, client *claude.Client, prompt string, onAssistant func()) (*session, error) {
+	if err := client.Query(ctx, prompt); err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	s := &session{}
+	for msg := range client.ReceiveResponse(ctx) {
+		switch m := msg.(type) {
+		case *types.AssistantMessage:
+			for _, block := range m.Content {
+				if tb, ok := block.(*types.TextBlock); ok {
+					s.text += tb.Text
+				}
+			}
+			if onAssistant != nil {
+				onAssistant()
+			}
+		case *types.ResultMessage:
+			s.result = m
+		}
+	}
+
+	if s.result == nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("no result message received")
+	}
+	return s, nil
+}
+
+// withClient connects a client, runs fn, and closes the client.
+func withClient(ctx context.Context, opts *types.ClaudeAgentOptions, fn func(*claude.Client) error) error {
+	client, err := claude.NewClient(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("new client: %w", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	return fn(client)
+}
+
+func scenarioConnect(ctx context.Context, cliPath string) error {
+	return withClient(ctx, baseOptions(cliPath), func(client *claude.Client) error {
+		if !client.IsConnected() {
+			return errors.New("client not connected after Connect")
+		}
+		return nil
+	})
+}
+
+func scenarioQuery(ctx context.Context, cliPath string) error {
+	msgs, err := claude.Query(ctx, "Reply with the single word: pong", baseOptions(cliPath))
+	if err != nil {
+		return err
+	}
+
+	var result *types.ResultMessage
+	for msg := range msgs {
+		if m, ok := msg.(*types.ResultMessage); ok {
+			result = m
+		}
+	}
+	if result == nil {
+		return errors.New("no result message received")
+	}
+	if result.IsError {
+		return fmt.Errorf("result is an error: %s", result.Subtype)
+	}
+	return nil
+}
+
+const toolPrompt = "Run the shell command `echo compat` with the Bash tool, then reply with its output."
+
+func scenarioPermissionCallback(ctx context.Context, cliPath string) error {
+	var calls int32
+	opts := baseOptions(cliPath).
+		WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			atomic.AddInt32(&calls, 1)
+			return types.PermissionResultAllow{Behavior: "allow"}, nil
+		})
+
+	return withClient(ctx, opts, func(client *claude.Client) error {
+		if _, err := ask(ctx, client, toolPrompt, nil); err != nil {
+			return err
+		}
+		if atomic.LoadInt32(&calls) == 0 {
+			return errors.New("permission callback was not called")
+		}
+		return nil
+	})
+}
+
+func scenarioHook(ctx context.Context, cliPath string) error {
+	var calls int32
+	matcher := "Bash"
+	opts := baseOptions(cliPath).
+		WithPermissionMode(types.PermissionModeBypassPermissions).
+		WithHook(types.HookEventPreToolUse, types.HookMatcher{
+			Matcher: &matcher,
+			Hooks: []types.HookCallbackFunc{
+				func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+					atomic.AddInt32(&calls, 1)
+					return map[string]interface{}{}, nil
+				},
+			},
+		})
+
+	return withClient(ctx, opts, func(client *claude.Client) error {
+		if _, err := ask(ctx, client, toolPrompt, nil); err != nil {
+			return err
+		}
+		if atomic.LoadInt32(&calls) == 0 {
+			return errors.New("PreToolUse hook was not called")
+		}
+		return nil
+	})
+}
+
+func scenarioInterrupt(ctx context.Context, cliPath string) error {
+	return withClient(ctx, baseOptions(cliPath), func(client *claude.Client) error {
+		var interrupted int32
+		interruptErr := make(chan error, 1)
+
+		_, err := ask(ctx, client, "Count from 1 to 500, one number per line.", func() {
+			if atomic.CompareAndSwapInt32(&interrupted, 0, 1) {
+				go func() {
+					interruptErr <- client.Interrupt(ctx)
+				}()
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if atomic.LoadInt32(&interrupted) == 0 {
+			return errors.New("no assistant message to interrupt")
+		}
+		if err := <-interruptErr; err != nil {
+			return fmt.Errorf("interrupt: %w", err)
+		}
+		return nil
+	})
+}
+
+func scenarioResume(ctx context.Context, cliPath string) error {
+	var sessionID string
+	err := withClient(ctx, baseOptions(cliPath), func(client *claude.Client) error {
+		s, err := ask(ctx, client, "Remember the word tangerine. Reply with OK.", nil)
+		if err != nil {
+			return err
+		}
+		sessionID = s.result.SessionID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if sessionID == "" {
+		return errors.New("first result has no session_id")
+	}
+
+	return withClient(ctx, baseOptions(cliPath).WithResume(sessionID), func(client *claude.Client) error {
+		s, err := ask(ctx, client, "Which word did I ask you to remember? Reply with the word only.", nil)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(strings.ToLower(s.text), "tangerine") {
+			return fmt.Errorf("resumed session did not recall context: %q", s.text)
+		}
+		return nil
+	})
+}
@@ -373,7 +373,7 @@ func TestClientIntegration_WithPermissions(t *testing.T) {
 	var permissionCalls []string
 	var mu sync.Mutex
 
-	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
 		mu.Lock()
 		permissionCalls = append(permissionCalls, toolName)
 		mu.Unlock()
@@ -387,6 +387,7 @@ func TestClientIntegration_WithPermissions(t *testing.T) {
 	// Create client with permission callback
 	opts := types.NewClaudeAgentOptions().
 		WithCLIPath(mockCLI.Path).
+		WithStrictProtocol(true).
 		WithCanUseTool(canUseTool)
 
 	client, err := claude.NewClient(ctx, opts)
@@ -444,6 +445,7 @@ func TestClientIntegration_WithHooks(t *testing.T) {
 	opts := types.NewClaudeAgentOptions().
 		WithCLIPath(mockCLI.Path).
 		WithPermissionMode(types.PermissionModeBypassPermissions).
+		WithStrictProtocol(true).
 		WithHook(types.HookEventPreToolUse, hookMatcher)
 
 	client, err := claude.NewClient(ctx, opts)
@@ -477,7 +479,7 @@ func TestControlProtocol_FullFlow(t *testing.T) {
 	permissionRequested := false
 	var mu sync.Mutex
 
-	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (interface{}, error) {
+	canUseTool := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
 		mu.Lock()
 		permissionRequested = true
 		mu.Unlock()
@@ -494,6 +496,7 @@ func TestControlProtocol_FullFlow(t *testing.T) {
 	opts := types.NewClaudeAgentOptions().
 		WithCLIPath(cliPath).
 		WithModel("claude-3-5-sonnet-latest").
+		WithStrictProtocol(true).
 		WithCanUseTool(canUseTool)
 
 	client, err := claude.NewClient(ctx, opts)
@@ -596,6 +599,79 @@ func TestStreamingWithControlMessages(t *testing.T) {
 	}
 }
 
+// floodMessages returns more assistant messages than the Query channel buffers.
+func floodMessages() []string {
+	messages := make([]string, 40)
+	for i := range messages {
+		messages[i] = fmt.Sprintf(`{"type":"assistant","message":{"model":"claude-3","content":[{"type":"text","text":"part %d"}]}}`, i)
+	}
+	return messages
+}
+
+// TestQueryIntegration_AbandonWithCancel tests that cancelling ctx after
+// reading only part of a response leaks no goroutines.
+func TestQueryIntegration_AbandonWithCancel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	checkGoroutines := AssertNoGoroutineLeaks(t)
+	defer checkGoroutines()
+
+	mockCLI, err := CreateMockCLIWithReply(t, floodMessages())
+	if err != nil {
+		t.Fatalf("Failed to create mock CLI: %v", err)
+	}
+	defer mockCLI.Cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(mockCLI.Path).
+		WithConsumerTimeout(0)
+	msgChan, err := claude.Query(ctx, "Hello", opts)
+	if err != nil {
+		cancel()
+		t.Fatalf("Query() failed: %v", err)
+	}
+
+	// Return early on the first message, as a caller looking for one answer would
+	<-msgChan
+	cancel()
+
+	// Let the forwarding goroutine notice the cancellation and shut down
+	time.Sleep(200 * time.Millisecond)
+}
+
+// TestQueryIntegration_AbandonWithoutCancel tests that a channel abandoned
+// without cancelling ctx is cleaned up once the consumer timeout expires.
+func TestQueryIntegration_AbandonWithoutCancel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	checkGoroutines := AssertNoGoroutineLeaks(t)
+	defer checkGoroutines()
+
+	mockCLI, err := CreateMockCLIWithReply(t, floodMessages())
+	if err != nil {
+		t.Fatalf("Failed to create mock CLI: %v", err)
+	}
+	defer mockCLI.Cleanup()
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(mockCLI.Path).
+		WithConsumerTimeout(100 * time.Millisecond)
+	msgChan, err := claude.Query(context.Background(), "Hello", opts)
+	if err != nil {
+		t.Fatalf("Query() failed: %v", err)
+	}
+
+	<-msgChan
+
+	// Wait past the consumer timeout without reading
+	time.Sleep(500 * time.Millisecond)
+}
+
 // TestRealCLIIntegration tests with actual Claude CLI if available.
 func TestRealCLIIntegration(t *testing.T) {
 	if testing.Short() {
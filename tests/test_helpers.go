@@ -137,6 +137,37 @@ func CreateMockCLIWithMessages(t *testing.T, messages []string) (*MockCLI, error
 	}, nil
 }
 
+// CreateMockCLIWithReply creates a mock CLI that reads the prompt, outputs
+// predefined messages, and then keeps running until its stdin is closed.
+// Unlike CreateMockCLIWithMessages, the prompt write can never race the CLI's
+// exit, and a CLI left running is visible to leak checks.
+func CreateMockCLIWithReply(t *testing.T, messages []string) (*MockCLI, error) {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("CreateMockCLIWithReply requires a Unix shell")
+	}
+
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "mock-claude.sh")
+	scriptContent := "#!/bin/sh\nread -r line\n"
+	for _, msg := range messages {
+		escaped := strings.ReplaceAll(msg, "'", "'\\''")
+		scriptContent += fmt.Sprintf("echo '%s'\n", escaped)
+	}
+	scriptContent += "cat >/dev/null\n"
+
+	if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+		return nil, fmt.Errorf("failed to write mock script: %w", err)
+	}
+
+	return &MockCLI{
+		Path:       scriptPath,
+		ScriptPath: scriptPath,
+		Cleanup:    func() { _ = os.RemoveAll(tmpDir) },
+	}, nil
+}
+
 // AssertMessageType checks if a message has the expected type.
 func AssertMessageType(t *testing.T, msg types.Message, expected string) {
 	t.Helper()
@@ -0,0 +1,34 @@
+package claude
+
+import (
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// CollectAssistantText returns the text of every AssistantMessage in
+// messages, in order, joined with newlines. Messages without text, such as
+// those that only call tools, are skipped.
+//
+// Example:
+//
+//	messages, err := claude.Query(ctx, "What is 2+2?", nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	var all []types.Message
+//	for msg := range messages {
+//	    all = append(all, msg)
+//	}
+//	fmt.Println(claude.CollectAssistantText(all))
+func CollectAssistantText(messages []types.Message) string {
+	var texts []string
+	for _, msg := range messages {
+		if m, ok := msg.(*types.AssistantMessage); ok {
+			if text := m.Text(); text != "" {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,41 @@
+package claude
+
+import (
+	"testing"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestCollectAssistantText(t *testing.T) {
+	answer := &types.AssistantMessage{Type: types.MessageTypeAssistant, Content: []types.ContentBlock{
+		types.NewThinkingBlock("the user wants a listing", "sig"),
+		types.NewTextBlock("Here are the files:"),
+	}}
+	toolOnly := &types.AssistantMessage{Type: types.MessageTypeAssistant, Content: []types.ContentBlock{
+		types.NewToolUseBlock("toolu_1", "Bash", map[string]interface{}{"command": "ls"}),
+	}}
+	result := types.NewUserMessageBlocks(types.NewToolResultBlock("toolu_1", "main.go", false))
+	final := &types.AssistantMessage{Type: types.MessageTypeAssistant, Content: []types.ContentBlock{
+		types.NewTextBlock("main.go"),
+		types.NewTextBlock("That's all."),
+	}}
+
+	tests := []struct {
+		name     string
+		messages []types.Message
+		want     string
+	}{
+		{"none", nil, ""},
+		{"one message", []types.Message{answer}, "Here are the files:"},
+		{"a turn", []types.Message{answer, toolOnly, result, final, &types.ResultMessage{Type: types.MessageTypeResult}},
+			"Here are the files:\nmain.go\nThat's all."},
+		{"no assistant text", []types.Message{toolOnly, result}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CollectAssistantText(tt.messages); got != tt.want {
+				t.Errorf("CollectAssistantText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package claude
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// toolCatalog holds what a Client knows about the tools of its session. It
+// has its own lock because it is updated while messages are received.
+type toolCatalog struct {
+	mu    sync.Mutex
+	names []string                    // Tool names reported by the CLI, in its order
+	mcp   map[string][]types.ToolInfo // Tools listed by in-process MCP servers, by server
+}
+
+// AvailableTools returns the tools available to the session, for UIs that
+// show what the agent can use.
+//
+// Tool names come from the CLI: from the initialize response during Connect,
+// and from the init system message at the start of each turn, which replaces
+// them. The CLI reports names only, so built-in tools and tools of MCP
+// servers the CLI runs itself have just a Name (and Server, for MCP tools).
+// In-process MCP servers configured with WithMcpServers are asked for their
+// tools with tools/list during Connect and by RefreshTools, so their entries
+// also carry Description and InputSchema.
+//
+// Tools are in the order the CLI reported them, followed by any in-process
+// MCP tools it did not report. The result is nil before Connect.
+//
+// Example:
+//
+//	for _, tool := range client.AvailableTools() {
+//	    fmt.Printf("%s: %s\n", tool.Name, tool.Description)
+//	}
+func (c *Client) AvailableTools() []types.ToolInfo {
+	return c.tools.list()
+}
+
+// RefreshTools asks the in-process MCP servers for their tools again, so
+// AvailableTools reflects tools they added or removed since Connect. Servers
+// that fail to answer keep their previous tools, and their errors are
+// returned.
+func (c *Client) RefreshTools(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+	query := c.query
+	c.mu.Unlock()
+
+	// MCP servers take no context, so stop waiting for a slow one once ctx is done
+	type listing struct {
+		tools map[string][]types.ToolInfo
+		err   error
+	}
+	done := make(chan listing, 1)
+	c.goLabeled(func() {
+		tools, err := query.ListMCPTools()
+		done <- listing{tools, err}
+	})
+
+	select {
+	case l := <-done:
+		c.tools.setMCP(l.tools)
+		return l.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// setNames replaces the tool names reported by the CLI.
+func (t *toolCatalog) setNames(names []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.names = names
+}
+
+// setMCP records the tools listed by the servers in tools, keeping the
+// previous tools of servers missing from it.
+func (t *toolCatalog) setMCP(tools map[string][]types.ToolInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.mcp == nil {
+		t.mcp = make(map[string][]types.ToolInfo, len(tools))
+	}
+	for server, list := range tools {
+		t.mcp[server] = list
+	}
+}
+
+// observe updates the tool names from an init system message.
+func (t *toolCatalog) observe(msg types.Message) {
+	sys, ok := msg.(*types.SystemMessage)
+	if !ok || sys.Subtype != "init" {
+		return
+	}
+	if names, ok := toolNames(sys.Data["tools"]); ok {
+		t.setNames(names)
+	}
+}
+
+// list merges the reported names with the listed MCP tools.
+func (t *toolCatalog) list() []types.ToolInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.names == nil && t.mcp == nil {
+		return nil
+	}
+
+	listed := make(map[string]types.ToolInfo)
+	servers := make([]string, 0, len(t.mcp))
+	for server, tools := range t.mcp {
+		servers = append(servers, server)
+		for _, tool := range tools {
+			listed[tool.Name] = tool
+		}
+	}
+
+	tools := make([]types.ToolInfo, 0, len(t.names)+len(listed))
+	seen := make(map[string]bool, len(t.names))
+	for _, name := range t.names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if tool, ok := listed[name]; ok {
+			tools = append(tools, tool)
+		} else {
+			tools = append(tools, types.ToolInfo{Name: name, Server: mcpServerOf(name)})
+		}
+	}
+
+	sort.Strings(servers)
+	for _, server := range servers {
+		for _, tool := range t.mcp[server] {
+			if !seen[tool.Name] {
+				seen[tool.Name] = true
+				tools = append(tools, tool)
+			}
+		}
+	}
+	return tools
+}
+
+// toolNames decodes a list of tool names, as found under "tools" in the
+// initialize response and the init system message.
+func toolNames(v interface{}) ([]string, bool) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	names := make([]string, 0, len(list))
+	for _, item := range list {
+		if name, ok := item.(string); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, true
+}
+
+// mcpServerOf returns the server of an MCP tool named "mcp__<server>__<tool>",
+// or "" for other tools.
+func mcpServerOf(name string) string {
+	rest, ok := strings.CutPrefix(name, "mcp__")
+	if !ok {
+		return ""
+	}
+	server, _, ok := strings.Cut(rest, "__")
+	if !ok {
+		return ""
+	}
+	return server
+}
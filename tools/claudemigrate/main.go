@@ -0,0 +1,303 @@
+// Command claudemigrate reports uses of deprecated Claude Agent SDK option
+// methods and optionally rewrites them to their replacements.
+//
+// Usage:
+//
+//	go run github.com/schlunsen/claude-agent-sdk-go/tools/claudemigrate [-fix] [packages or dirs]
+//
+// Paths ending in "/..." are walked recursively. With no arguments the current
+// directory is walked recursively. The exit status is 3 when deprecated calls
+// were found and not fixed, mirroring go vet.
+//
+// Packages are type-checked from source, so only calls whose receiver is a
+// *types.ClaudeAgentOptions are reported; a method of the same name on another
+// type is left alone. Since the deprecated methods are thin wrappers, -fix only
+// renames the selector and is behavior-preserving. Run it from the module
+// being migrated, so that imports resolve: a call whose receiver cannot be
+// resolved, for example because its package does not compile, is listed on
+// stderr and neither reported nor fixed.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// optionsPkg and optionsType name the receiver of the deprecated methods.
+const (
+	optionsPkg  = "github.com/schlunsen/claude-agent-sdk-go/types"
+	optionsType = "ClaudeAgentOptions"
+)
+
+// finding is a single deprecated call site.
+type finding struct {
+	Pos         token.Position
+	Name        string
+	Replacement string
+}
+
+func (f finding) String() string {
+	return fmt.Sprintf("%s: %s is deprecated; use %s instead", f.Pos, f.Name, f.Replacement)
+}
+
+func main() {
+	fix := flag.Bool("fix", false, "rewrite deprecated calls in place")
+	flag.Parse()
+
+	os.Exit(run(flag.Args(), *fix, os.Stdout, os.Stderr))
+}
+
+// run analyzes the given paths and returns the process exit code.
+func run(paths []string, fix bool, stdout, stderr io.Writer) int {
+	if len(paths) == 0 {
+		paths = []string{"./..."}
+	}
+
+	files, err := collectFiles(paths)
+	if err != nil {
+		fmt.Fprintf(stderr, "claudemigrate: %v\n", err)
+		return 1
+	}
+
+	replacements := make(map[string]string)
+	for _, api := range types.DeprecatedAPIs() {
+		replacements[api.Name] = api.Replacement
+	}
+
+	fset := token.NewFileSet()
+	var parsed []*sourceFile
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "claudemigrate: %v\n", err)
+			return 1
+		}
+		file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil {
+			fmt.Fprintf(stderr, "claudemigrate: %v\n", err)
+			return 1
+		}
+		parsed = append(parsed, &sourceFile{path: path, ast: file})
+	}
+
+	// One importer for all packages, so dependencies are checked once
+	imp := importer.ForCompiler(fset, "source", nil)
+
+	unfixed := 0
+	for _, pkg := range groupPackages(parsed) {
+		info := typeCheck(fset, imp, pkg)
+
+		for _, f := range pkg {
+			findings, unresolved := analyzeFile(fset, f.ast, info, replacements, fix)
+			for _, u := range unresolved {
+				fmt.Fprintf(stderr, "claudemigrate: %s\n", u)
+			}
+			for _, found := range findings {
+				fmt.Fprintln(stdout, found)
+			}
+
+			if !fix || len(findings) == 0 {
+				unfixed += len(findings)
+				continue
+			}
+
+			var buf bytes.Buffer
+			if err := format.Node(&buf, fset, f.ast); err != nil {
+				fmt.Fprintf(stderr, "claudemigrate: failed to format %s: %v\n", f.path, err)
+				return 1
+			}
+			if err := os.WriteFile(f.path, buf.Bytes(), 0644); err != nil {
+				fmt.Fprintf(stderr, "claudemigrate: %v\n", err)
+				return 1
+			}
+		}
+	}
+
+	if unfixed > 0 {
+		return 3
+	}
+	return 0
+}
+
+// sourceFile is a parsed Go source file.
+type sourceFile struct {
+	path string
+	ast  *ast.File
+}
+
+// groupPackages groups files into packages by directory and package name, so
+// that a package and its external test package are checked separately.
+func groupPackages(files []*sourceFile) [][]*sourceFile {
+	byPkg := make(map[string][]*sourceFile)
+	var keys []string
+	for _, f := range files {
+		key := filepath.Dir(f.path) + "\x00" + f.ast.Name.Name
+		if _, ok := byPkg[key]; !ok {
+			keys = append(keys, key)
+		}
+		byPkg[key] = append(byPkg[key], f)
+	}
+	sort.Strings(keys)
+
+	pkgs := make([][]*sourceFile, 0, len(keys))
+	for _, key := range keys {
+		pkgs = append(pkgs, byPkg[key])
+	}
+	return pkgs
+}
+
+// typeCheck type-checks a package and returns what was resolved. Type errors
+// are tolerated: calls that could not be resolved have no entry in Uses.
+func typeCheck(fset *token.FileSet, imp gotypes.Importer, pkg []*sourceFile) *gotypes.Info {
+	files := make([]*ast.File, len(pkg))
+	for i, f := range pkg {
+		files[i] = f.ast
+	}
+
+	info := &gotypes.Info{Uses: make(map[*ast.Ident]gotypes.Object)}
+	conf := gotypes.Config{Importer: imp, Error: func(error) {}}
+	_, _ = conf.Check(pkg[0].ast.Name.Name, fset, files, info)
+	return info
+}
+
+// analyzeFile reports calls to deprecated ClaudeAgentOptions methods in file,
+// using the type information in info. When fix is true the selectors are
+// renamed to their replacements in the AST. Calls of a deprecated name whose
+// receiver was not resolved are returned as unresolved.
+func analyzeFile(fset *token.FileSet, file *ast.File, info *gotypes.Info, replacements map[string]string, fix bool) (findings []finding, unresolved []string) {
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		replacement, deprecated := replacements[sel.Sel.Name]
+		if !deprecated {
+			return true
+		}
+
+		obj, resolved := info.Uses[sel.Sel]
+		if !resolved {
+			unresolved = append(unresolved, fmt.Sprintf("%s: cannot resolve the receiver of %s; not checked",
+				fset.Position(sel.Sel.Pos()), sel.Sel.Name))
+			return true
+		}
+		if !isOptionsMethod(obj) {
+			return true
+		}
+
+		findings = append(findings, finding{
+			Pos:         fset.Position(sel.Sel.Pos()),
+			Name:        sel.Sel.Name,
+			Replacement: replacement,
+		})
+		if fix {
+			sel.Sel.Name = replacement
+		}
+		return true
+	})
+
+	return findings, unresolved
+}
+
+// isOptionsMethod reports whether obj is a method of types.ClaudeAgentOptions.
+func isOptionsMethod(obj gotypes.Object) bool {
+	fn, ok := obj.(*gotypes.Func)
+	if !ok {
+		return false
+	}
+	recv := fn.Type().(*gotypes.Signature).Recv()
+	if recv == nil {
+		return false
+	}
+
+	t := recv.Type()
+	if ptr, ok := t.(*gotypes.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*gotypes.Named)
+	if !ok {
+		return false
+	}
+	o := named.Obj()
+	return o.Pkg() != nil && o.Pkg().Path() == optionsPkg && o.Name() == optionsType
+}
+
+// collectFiles expands the given paths into a list of Go source files.
+func collectFiles(paths []string) ([]string, error) {
+	var files []string
+
+	for _, p := range paths {
+		recursive := false
+		if strings.HasSuffix(p, "/...") {
+			recursive = true
+			p = strings.TrimSuffix(p, "/...")
+			if p == "" {
+				p = "."
+			}
+		}
+
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		if !recursive {
+			entries, err := os.ReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				if !e.IsDir() && strings.HasSuffix(e.Name(), ".go") {
+					files = append(files, filepath.Join(p, e.Name()))
+				}
+			}
+			continue
+		}
+
+		err = filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				name := d.Name()
+				if path != p && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(path, ".go") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
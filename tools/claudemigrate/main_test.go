@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeModule writes src as app.go of a module that resolves the SDK to this
+// repository, so claudemigrate can type-check it, and returns its directory.
+func writeModule(t *testing.T, src string) string {
+	t.Helper()
+
+	root, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	mod := "module example.com/app\n\ngo 1.24.0\n\n" +
+		"require github.com/schlunsen/claude-agent-sdk-go v0.0.0\n\n" +
+		"replace github.com/schlunsen/claude-agent-sdk-go => " + root + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+const deprecatedSource = `package app
+
+import "github.com/schlunsen/claude-agent-sdk-go/types"
+
+func options() *types.ClaudeAgentOptions {
+	return types.NewClaudeAgentOptions().
+		WithModel("sonnet").
+		WithMaxBufferSize(4096).
+		WithExtraArg("debug", nil)
+}
+`
+
+// TestRunReportsDeprecatedCalls tests that deprecated calls are reported with positions.
+func TestRunReportsDeprecatedCalls(t *testing.T) {
+	dir := writeModule(t, deprecatedSource)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{dir + "/..."}, false, &stdout, &stderr)
+
+	if code != 3 {
+		t.Fatalf("exit code = %d, want 3 (stderr: %s)", code, stderr.String())
+	}
+
+	out := stdout.String()
+	for _, want := range []string{
+		"app.go:8:3: WithMaxBufferSize is deprecated; use WithMaxMessageSize instead",
+		"app.go:9:3: WithExtraArg is deprecated; use WithExtraCLIArg instead",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "WithModel") {
+		t.Errorf("non-deprecated call reported:\n%s", out)
+	}
+}
+
+// TestRunFix tests that -fix rewrites deprecated calls to their replacements.
+func TestRunFix(t *testing.T) {
+	dir := writeModule(t, deprecatedSource)
+	path := filepath.Join(dir, "app.go")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{dir}, true, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", code, stderr.String())
+	}
+
+	fixed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := string(fixed)
+	if !strings.Contains(src, "WithMaxMessageSize(4096)") || !strings.Contains(src, `WithExtraCLIArg("debug", nil)`) {
+		t.Errorf("deprecated calls not rewritten:\n%s", src)
+	}
+
+	stdout.Reset()
+	if code := run([]string{dir}, false, &stdout, &stderr); code != 0 {
+		t.Errorf("expected clean second run, got code %d:\n%s", code, stdout.String())
+	}
+}
+
+// TestRunCleanTree tests that a tree without deprecated calls exits zero.
+func TestRunCleanTree(t *testing.T) {
+	dir := t.TempDir()
+	src := "package app\n\nfunc f() { g().WithModel(\"x\") }\n"
+	if err := os.WriteFile(filepath.Join(dir, "app.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{dir}, false, &stdout, &stderr); code != 0 {
+		t.Errorf("exit code = %d, want 0: %s", code, stdout.String())
+	}
+}
+
+const sameNameSource = `package app
+
+import "github.com/schlunsen/claude-agent-sdk-go/types"
+
+// builder has methods named like deprecated ClaudeAgentOptions methods.
+type builder struct{}
+
+func (b *builder) WithExtraArg(flag string, value *string) *builder { return b }
+func (b *builder) WithMaxBufferSize(size int) *builder             { return b }
+
+func build() {
+	(&builder{}).WithExtraArg("debug", nil).WithMaxBufferSize(4096)
+	types.NewClaudeAgentOptions().WithMaxBufferSize(4096)
+}
+`
+
+// TestRunIgnoresOtherReceivers tests that methods of other types named like
+// deprecated options are neither reported nor rewritten.
+func TestRunIgnoresOtherReceivers(t *testing.T) {
+	dir := writeModule(t, sameNameSource)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{dir}, true, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", code, stderr.String())
+	}
+	if out := stdout.String(); strings.Count(out, "deprecated") != 1 || !strings.Contains(out, "app.go:13:32: WithMaxBufferSize") {
+		t.Errorf("expected only the ClaudeAgentOptions call to be reported:\n%s", out)
+	}
+
+	fixed, err := os.ReadFile(filepath.Join(dir, "app.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := string(fixed)
+	if !strings.Contains(src, `(&builder{}).WithExtraArg("debug", nil).WithMaxBufferSize(4096)`) {
+		t.Errorf("calls on another type were rewritten:\n%s", src)
+	}
+	if !strings.Contains(src, "types.NewClaudeAgentOptions().WithMaxMessageSize(4096)") {
+		t.Errorf("ClaudeAgentOptions call not rewritten:\n%s", src)
+	}
+}
+
+// TestRunUnresolvedReceiver tests that calls whose receiver cannot be
+// resolved are listed on stderr and left alone.
+func TestRunUnresolvedReceiver(t *testing.T) {
+	dir := t.TempDir()
+	src := "package app\n\nfunc f() { g().WithExtraArg(\"debug\", nil) }\n"
+	path := filepath.Join(dir, "app.go")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{dir}, true, &stdout, &stderr); code != 0 {
+		t.Errorf("exit code = %d, want 0: %s", code, stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "cannot resolve the receiver of WithExtraArg") {
+		t.Errorf("expected the unresolved call on stderr, got %q", stderr.String())
+	}
+	if fixed, _ := os.ReadFile(path); string(fixed) != src {
+		t.Errorf("unresolved call was rewritten:\n%s", fixed)
+	}
+}
@@ -0,0 +1,183 @@
+// Command tracefmt renders a session trace recorded with
+// claudetest.RecordingTransport as readable text.
+//
+// Usage:
+//
+//	go run github.com/schlunsen/claude-agent-sdk-go/tools/tracefmt [-timeline] [-gap 1s] trace.jsonl
+//
+// By default each protocol frame is printed on one line with its offset from
+// the start of the trace, its direction (-> written to the CLI, <- read from
+// it), and its type, subtype and request ID.
+//
+// With -timeline the state records written through
+// claudetest.RecordingTransport.Logger are merged in (marked *), and every
+// stretch longer than -gap without any frame or state change is called out,
+// so a hung session shows both what the SDK was waiting for and for how long.
+//
+// Offsets come from the monotonic clock when the trace records them, and from
+// the wall-clock timestamps otherwise. With no file argument the trace is read
+// from standard input.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/claudetest"
+)
+
+func main() {
+	timeline := flag.Bool("timeline", false, "merge SDK state records and highlight gaps")
+	gap := flag.Duration("gap", time.Second, "with -timeline, highlight pauses longer than this")
+	flag.Parse()
+
+	os.Exit(run(flag.Args(), *timeline, *gap, os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run renders the trace named by args and returns the process exit code.
+func run(args []string, timeline bool, gap time.Duration, stdin io.Reader, stdout, stderr io.Writer) int {
+	var frames []claudetest.Frame
+	var err error
+	switch len(args) {
+	case 0:
+		frames, err = claudetest.ReadFrames(stdin)
+	case 1:
+		frames, err = claudetest.ReadFramesFile(args[0])
+	default:
+		fmt.Fprintln(stderr, "usage: tracefmt [-timeline] [-gap duration] [trace.jsonl]")
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "tracefmt: %v\n", err)
+		return 1
+	}
+
+	render(stdout, frames, timeline, gap)
+	return 0
+}
+
+// render writes one line per frame. Without timeline, state frames are
+// skipped; with it, a marker line precedes any frame that follows a pause
+// longer than gap.
+func render(w io.Writer, frames []claudetest.Frame, timeline bool, gap time.Duration) {
+	offsets := frameOffsets(frames)
+
+	var prev time.Duration
+	first := true
+	for i, f := range frames {
+		if f.Direction == claudetest.DirectionState && !timeline {
+			continue
+		}
+		at := offsets[i]
+		if timeline && !first && gap > 0 && at-prev > gap {
+			fmt.Fprintf(w, "%12s  ---- %s without activity ----\n", "", formatDuration(at-prev))
+		}
+		fmt.Fprintf(w, "%12s  %s  %s\n", "+"+formatDuration(at), marker(f.Direction), summarize(f))
+		prev, first = at, false
+	}
+}
+
+// frameOffsets returns each frame's offset from the start of the trace. The
+// recorded monotonic offsets are used when present, since wall-clock time can
+// jump; older traces only have timestamps.
+func frameOffsets(frames []claudetest.Frame) []time.Duration {
+	offsets := make([]time.Duration, len(frames))
+	monotonic := false
+	for _, f := range frames {
+		if f.Offset != 0 {
+			monotonic = true
+			break
+		}
+	}
+	for i, f := range frames {
+		if monotonic {
+			offsets[i] = f.Offset
+		} else {
+			offsets[i] = f.Time.Sub(frames[0].Time)
+		}
+	}
+	return offsets
+}
+
+// formatDuration prints d in seconds with millisecond precision.
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+// marker shows a frame's direction.
+func marker(dir claudetest.Direction) string {
+	switch dir {
+	case claudetest.DirectionOut:
+		return "->"
+	case claudetest.DirectionIn:
+		return "<-"
+	default:
+		return "* "
+	}
+}
+
+// summarize describes a frame in one line.
+func summarize(f claudetest.Frame) string {
+	if f.Direction == claudetest.DirectionState {
+		return summarizeState(f.Data)
+	}
+
+	var msg struct {
+		Type      string `json:"type"`
+		Subtype   string `json:"subtype"`
+		RequestID string `json:"request_id"`
+		Request   struct {
+			Subtype string `json:"subtype"`
+		} `json:"request"`
+		Response struct {
+			Subtype   string `json:"subtype"`
+			RequestID string `json:"request_id"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(f.Data, &msg); err != nil {
+		return "(unparseable frame)"
+	}
+
+	switch msg.Type {
+	case "control_request":
+		return strings.TrimSpace("control_request " + msg.Request.Subtype + " " + msg.RequestID)
+	case "control_response":
+		return strings.TrimSpace("control_response " + msg.Response.Subtype + " " + msg.Response.RequestID)
+	}
+	if msg.Subtype != "" {
+		return msg.Type + " " + msg.Subtype
+	}
+	return msg.Type
+}
+
+// summarizeState describes a state record: its event followed by its
+// attributes in key order.
+func summarizeState(data json.RawMessage) string {
+	var event claudetest.StateEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "(unparseable state)"
+	}
+
+	keys := make([]string, 0, len(event.Attrs))
+	for k := range event.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(event.Event)
+	for _, k := range keys {
+		v := event.Attrs[k]
+		if s, ok := v.(string); ok && strings.ContainsAny(s, " \t\"") {
+			v = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&b, " %s=%v", k, v)
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// TestRunGolden tests the rendering of a recorded session that stalled on a
+// permission prompt, against golden files.
+func TestRunGolden(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeline bool
+		golden   string
+	}{
+		{"frames", false, "hung_session.golden"},
+		{"timeline", true, "hung_session.timeline.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run([]string{filepath.Join("testdata", "hung_session.jsonl")}, tt.timeline, time.Second, nil, &stdout, &stderr)
+			if code != 0 {
+				t.Fatalf("exit code = %d (stderr: %s)", code, stderr.String())
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, stdout.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := stdout.String(); got != string(want) {
+				t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+			}
+		})
+	}
+}
+
+// TestRunWallClockTrace tests that traces recorded without monotonic offsets
+// fall back to the frame timestamps.
+func TestRunWallClockTrace(t *testing.T) {
+	trace := `{"time":"2026-10-01T12:00:00Z","direction":"out","data":{"type":"user"}}
+{"time":"2026-10-01T12:00:03.5Z","direction":"in","data":{"type":"result","subtype":"success"}}
+`
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, true, time.Second, strings.NewReader(trace), &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code = %d (stderr: %s)", code, stderr.String())
+	}
+	want := "     +0.000s  ->  user\n" +
+		"              ---- 3.500s without activity ----\n" +
+		"     +3.500s  <-  result success\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestRunInvalidTrace tests that a malformed trace is reported.
+func TestRunInvalidTrace(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(nil, false, time.Second, strings.NewReader("not json\n"), &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "tracefmt: ") {
+		t.Errorf("exit code = %d, stderr = %q; want 1 and an error", code, stderr.String())
+	}
+}
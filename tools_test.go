@@ -0,0 +1,137 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// listingMCPServer is an in-process MCP server that only answers tools/list.
+type listingMCPServer struct {
+	mu    sync.Mutex
+	tools []interface{}
+}
+
+func (s *listingMCPServer) HandleMessage(message map[string]interface{}) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if message["method"] != "tools/list" {
+		return nil, errors.New("unexpected method")
+	}
+	return map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      message["id"],
+		"result":  map[string]interface{}{"tools": s.tools},
+	}, nil
+}
+
+func (s *listingMCPServer) Name() string    { return "calc" }
+func (s *listingMCPServer) Version() string { return "1.0.0" }
+
+func (s *listingMCPServer) setTools(tools ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tools = tools
+}
+
+func mcpTool(name, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"inputSchema": map[string]interface{}{"type": "object"},
+	}
+}
+
+func TestClient_AvailableTools(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	calc := &listingMCPServer{}
+	calc.setTools(mcpTool("add", "Add two numbers"))
+
+	cli := mockcli.New(t, mockcli.Scenario{
+		ControlResponses: map[string]json.RawMessage{
+			"initialize": json.RawMessage(`{"tools":["Read","Bash","mcp__calc__add","mcp__remote__fetch"]}`),
+		},
+		Steps: []mockcli.Step{
+			mockcli.AwaitPrompt(),
+			mockcli.Send(
+				`{"type":"system","subtype":"init","data":{"tools":["Read","mcp__calc__add"]}}`,
+				streamResult,
+			),
+		},
+	})
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithMcpServers(map[string]interface{}{
+			"calc": &types.McpSdkServerConfig{Type: "sdk", Name: "calc", Instance: calc},
+		})
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if got := client.AvailableTools(); got != nil {
+		t.Errorf("AvailableTools() before Connect = %v, want nil", got)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Close(ctx)
+
+	schema := map[string]interface{}{"type": "object"}
+	want := []types.ToolInfo{
+		{Name: "Read"},
+		{Name: "Bash"},
+		{Name: "mcp__calc__add", Description: "Add two numbers", InputSchema: schema, Server: "calc"},
+		{Name: "mcp__remote__fetch", Server: "remote"},
+	}
+	if got := client.AvailableTools(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AvailableTools() after Connect = %+v\nwant %+v", got, want)
+	}
+
+	// The init message of a turn replaces the reported names
+	if err := client.Query(ctx, "hi"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range client.ReceiveResponse(ctx) {
+	}
+	want = []types.ToolInfo{
+		{Name: "Read"},
+		{Name: "mcp__calc__add", Description: "Add two numbers", InputSchema: schema, Server: "calc"},
+	}
+	if got := client.AvailableTools(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AvailableTools() after init = %+v\nwant %+v", got, want)
+	}
+
+	// Tools the CLI has not reported yet are listed after the reported ones
+	calc.setTools(mcpTool("add", "Add numbers"), mcpTool("mul", "Multiply numbers"))
+	if err := client.RefreshTools(ctx); err != nil {
+		t.Fatalf("RefreshTools failed: %v", err)
+	}
+	want = []types.ToolInfo{
+		{Name: "Read"},
+		{Name: "mcp__calc__add", Description: "Add numbers", InputSchema: schema, Server: "calc"},
+		{Name: "mcp__calc__mul", Description: "Multiply numbers", InputSchema: schema, Server: "calc"},
+	}
+	if got := client.AvailableTools(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AvailableTools() after RefreshTools = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestClient_RefreshToolsNotConnected(t *testing.T) {
+	client, err := NewClient(context.Background(), types.NewClaudeAgentOptions())
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	err = client.RefreshTools(context.Background())
+	if !types.IsCLIConnectionError(err) {
+		t.Errorf("RefreshTools() error = %v, want CLIConnectionError", err)
+	}
+}
@@ -0,0 +1,132 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// tracedTurn is a turn whose span ends when its result arrives.
+type tracedTurn struct {
+	ctx   context.Context // carries the span, as parent of the turn's permission spans
+	span  types.Span
+	model string // from the turn's assistant messages
+}
+
+// startSpan starts a span with the WithTracer tracer. Without one it returns
+// ctx and a nil span, which endSpan ignores.
+func startSpan(options *types.ClaudeAgentOptions, ctx context.Context, name string, attrs map[string]interface{}) (context.Context, types.Span) {
+	if options.Tracer == nil {
+		return ctx, nil
+	}
+	return options.Tracer.Start(ctx, name, attrs)
+}
+
+// endSpan ends span, if there is one, adding attrs first.
+func endSpan(span types.Span, attrs map[string]interface{}, err error) {
+	if span == nil {
+		return
+	}
+	if len(attrs) > 0 {
+		span.SetAttributes(attrs)
+	}
+	span.End(err)
+}
+
+// connectAttrs returns the attributes known when a connect span starts.
+func connectAttrs(options *types.ClaudeAgentOptions) map[string]interface{} {
+	if options.Model == nil {
+		return nil
+	}
+	return map[string]interface{}{types.AttrModel: *options.Model}
+}
+
+// startTurnSpan starts the span of a turn whose prompt was just sent.
+func (c *Client) startTurnSpan(ctx context.Context) {
+	if c.options.Tracer == nil {
+		return
+	}
+	ctx, span := startSpan(c.options, ctx, types.SpanTurn, connectAttrs(c.options))
+
+	c.traceMu.Lock()
+	defer c.traceMu.Unlock()
+	c.traceTurns = append(c.traceTurns, &tracedTurn{ctx: ctx, span: span})
+}
+
+// traceMessage notes msg on the oldest turn awaiting its result, ending the
+// turn's span at its ResultMessage.
+func (c *Client) traceMessage(msg types.Message) {
+	if c.options.Tracer == nil {
+		return
+	}
+
+	c.traceMu.Lock()
+	if len(c.traceTurns) == 0 {
+		c.traceMu.Unlock()
+		return
+	}
+	turn := c.traceTurns[0]
+	result, isResult := msg.(*types.ResultMessage)
+	if isResult {
+		c.traceTurns = c.traceTurns[1:]
+	} else if m, ok := msg.(*types.AssistantMessage); ok && m.Model != "" {
+		turn.model = m.Model
+	}
+	c.traceMu.Unlock()
+
+	if !isResult {
+		return
+	}
+	attrs := resultAttrs(result)
+	if turn.model != "" {
+		attrs[types.AttrModel] = turn.model
+	}
+	var err error
+	if result.IsError {
+		err = fmt.Errorf("turn ended with an error result (%s)", result.Subtype)
+	}
+	endSpan(turn.span, attrs, err)
+}
+
+// resultAttrs returns the span attributes of a turn's result.
+func resultAttrs(result *types.ResultMessage) map[string]interface{} {
+	attrs := map[string]interface{}{
+		types.AttrSessionID:     result.SessionID,
+		types.AttrNumTurns:      result.NumTurns,
+		types.AttrResultSubtype: result.Subtype,
+		types.AttrIsError:       result.IsError,
+	}
+	if result.TotalCostUSD != nil {
+		attrs[types.AttrCostUSD] = *result.TotalCostUSD
+	}
+	if usage, err := result.ParseUsage(); err == nil && usage != nil {
+		attrs[types.AttrInputTokens] = usage.TotalInputTokens()
+		attrs[types.AttrOutputTokens] = usage.OutputTokens
+	}
+	return attrs
+}
+
+// traceParent returns the context carrying the span of the oldest turn
+// awaiting its result, or the client's context between turns. Permission
+// spans are started under it.
+func (c *Client) traceParent() context.Context {
+	c.traceMu.Lock()
+	defer c.traceMu.Unlock()
+	if len(c.traceTurns) > 0 {
+		return c.traceTurns[0].ctx
+	}
+	return c.ctx
+}
+
+// endTurnSpans ends the spans of turns that will not get a result.
+func (c *Client) endTurnSpans(err error) {
+	c.traceMu.Lock()
+	turns := c.traceTurns
+	c.traceTurns = nil
+	c.traceMu.Unlock()
+
+	for _, turn := range turns {
+		endSpan(turn.span, nil, err)
+	}
+}
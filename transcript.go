@@ -0,0 +1,334 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/transport"
+	"github.com/schlunsen/claude-agent-sdk-go/schema"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// TranscriptDirection identifies which side sent a transcript entry.
+type TranscriptDirection string
+
+const (
+	// TranscriptOutbound is a line the SDK wrote to the CLI.
+	TranscriptOutbound TranscriptDirection = "out"
+	// TranscriptInbound is a message the SDK read from the CLI.
+	TranscriptInbound TranscriptDirection = "in"
+)
+
+// TranscriptEntry is one line of a session transcript, a message or control
+// record of the format defined by package schema.
+type TranscriptEntry struct {
+	// Schema is the version of the record format, schema.Current for
+	// entries written by this release and empty for earlier releases
+	Schema string `json:"schema,omitempty"`
+
+	Time time.Time `json:"time"`
+
+	// Kind is schema.KindControl for control messages and
+	// schema.KindMessage for the rest; empty in earlier releases
+	Kind schema.Kind `json:"kind,omitempty"`
+
+	Direction TranscriptDirection `json:"direction"`
+	Message   json.RawMessage     `json:"message"`
+}
+
+// TranscriptWriter records the messages of a session as JSONL, one
+// TranscriptEntry per line, for an audit trail. Each line is a record of the
+// versioned format defined by package schema. A Client configured with
+// WithTranscript creates one on Connect and closes it on Close.
+//
+// Record only queues an entry; a background goroutine redacts, encodes and
+// writes it, so a slow writer never stalls the message loop. Output is
+// buffered and flushed whenever the queue drains and on Close.
+//
+// Secrets never reach the writer: values of environment variables whose names
+// mark them as secret (containing KEY, TOKEN, SECRET, PASSWORD or CREDENTIAL),
+// both in the env map given to NewTranscriptWriter and in any "env" object of
+// a message, are replaced with "[REDACTED]", as are Anthropic API keys.
+type TranscriptWriter struct {
+	mu      sync.Mutex
+	pending []TranscriptEntry
+	wake    chan struct{} // Signals the writer goroutine; capacity 1
+	closed  bool
+	done    chan struct{} // Closed when the writer goroutine exits
+	err     error         // First error writing the transcript
+
+	out    *bufio.Writer
+	redact func(string) string
+	now    func() time.Time
+}
+
+// NewTranscriptWriter returns a TranscriptWriter that writes to w, redacting
+// the secret values of env. The caller owns w and must close it after closing
+// the TranscriptWriter.
+func NewTranscriptWriter(w io.Writer, env map[string]string) *TranscriptWriter {
+	t := &TranscriptWriter{
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		out:    bufio.NewWriter(w),
+		redact: transport.SecretRedactor(env),
+		now:    time.Now,
+	}
+	go t.run()
+	return t
+}
+
+// Record queues message, a JSON value, as sent in direction. It never blocks
+// on the underlying writer. Messages recorded after Close are dropped.
+func (t *TranscriptWriter) Record(direction TranscriptDirection, message []byte) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.pending = append(t.pending, TranscriptEntry{Time: t.now(), Direction: direction, Message: message})
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Err returns the first error encountered writing the transcript.
+func (t *TranscriptWriter) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// Close writes and flushes every recorded entry, then returns the first error
+// encountered writing the transcript. Calling Close more than once is safe.
+func (t *TranscriptWriter) Close() error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.wake)
+	}
+	t.mu.Unlock()
+
+	<-t.done
+	return t.Err()
+}
+
+// run writes queued entries until Close.
+func (t *TranscriptWriter) run() {
+	defer close(t.done)
+
+	for {
+		_, open := <-t.wake
+
+		t.mu.Lock()
+		batch := t.pending
+		t.pending = nil
+		t.mu.Unlock()
+
+		for _, entry := range batch {
+			t.write(entry)
+		}
+		t.flush()
+
+		if !open {
+			return
+		}
+	}
+}
+
+// write encodes one entry, after redacting its message.
+func (t *TranscriptWriter) write(entry TranscriptEntry) {
+	if t.Err() != nil {
+		return
+	}
+	entry.Schema = schema.Current
+	entry.Kind = schema.KindOf(entry.Message)
+	entry.Message = t.redactMessage(entry.Message)
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = t.out.Write(append(line, '\n'))
+	}
+	t.setErr(err)
+}
+
+func (t *TranscriptWriter) flush() {
+	if t.Err() == nil {
+		t.setErr(t.out.Flush())
+	}
+}
+
+func (t *TranscriptWriter) setErr(err error) {
+	if err == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+// redactMessage scrubs secrets from message. Messages that are not valid
+// JSON are recorded as a JSON string.
+func (t *TranscriptWriter) redactMessage(message []byte) json.RawMessage {
+	if !json.Valid(message) {
+		quoted, _ := json.Marshal(t.redact(string(message)))
+		return quoted
+	}
+	if !bytes.Contains(message, []byte(`"env"`)) {
+		return json.RawMessage(t.redact(string(message)))
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(message, &v); err != nil {
+		return json.RawMessage(t.redact(string(message)))
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(redactValue(v, t.redact)); err != nil {
+		return json.RawMessage(t.redact(string(message)))
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// redactValue scrubs secrets from a decoded JSON value in place. The values
+// of secret variables in "env" objects are replaced outright.
+func redactValue(v interface{}, redact func(string) string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if env, ok := value.(map[string]interface{}); ok && key == "env" {
+				for name, envValue := range env {
+					if transport.IsSecretEnv(name) {
+						env[name] = "[REDACTED]"
+					} else {
+						env[name] = redactValue(envValue, redact)
+					}
+				}
+				continue
+			}
+			v[key] = redactValue(value, redact)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value, redact)
+		}
+	case string:
+		return redact(v)
+	}
+	return v
+}
+
+// LoadTranscript reads a transcript written by a TranscriptWriter, of this
+// or an earlier release. Blank lines are skipped. Records of a later version
+// of the schema fail with an error wrapping schema.ErrUnsupportedVersion.
+//
+// Example:
+//
+//	entries, err := claude.LoadTranscript(f)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, e := range entries {
+//	    fmt.Println(e.Time.Format(time.RFC3339), e.Direction, string(e.Message))
+//	}
+func LoadTranscript(r io.Reader) ([]TranscriptEntry, error) {
+	var entries []TranscriptEntry
+	reader := bufio.NewReader(r)
+
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("transcript line %d: %w", line, err)
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			var entry TranscriptEntry
+			if uerr := json.Unmarshal(data, &entry); uerr != nil {
+				return nil, fmt.Errorf("transcript line %d: %w", line, uerr)
+			}
+			if entry.Schema != "" && entry.Schema != schema.Version1 {
+				return nil, fmt.Errorf("transcript line %d: %w %q", line, schema.ErrUnsupportedVersion, entry.Schema)
+			}
+			if entry.Direction != TranscriptInbound && entry.Direction != TranscriptOutbound {
+				return nil, fmt.Errorf("transcript line %d: invalid direction %q", line, entry.Direction)
+			}
+			entries = append(entries, entry)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+	}
+}
+
+// TranscriptMessages decodes the messages of a transcript, in order, for use
+// with Replay. Both directions are included, so the prompts the SDK sent
+// appear as UserMessages between the CLI's responses. Messages of a type the
+// SDK does not know are decoded as types.UnknownMessage.
+func TranscriptMessages(entries []TranscriptEntry) ([]types.Message, error) {
+	messages := make([]types.Message, 0, len(entries))
+	for i, e := range entries {
+		msg, err := types.UnmarshalMessageWithOptions(e.Message, types.DecodeOptions{Lenient: true})
+		if err != nil {
+			return nil, fmt.Errorf("transcript entry %d: %w", i+1, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// startTranscript starts recording the connection's messages when
+// WithTranscript is set. It must be called before the query starts.
+func (c *Client) startTranscript() {
+	if c.options.Transcript == nil {
+		return
+	}
+	transcript := NewTranscriptWriter(c.options.Transcript, c.options.Env)
+	c.transcript = transcript
+	c.conn.setTranscript(transcript)
+	c.query.AddMessageObserver(func(msg types.Message) {
+		if data := transcriptMessage(msg); data != nil {
+			transcript.Record(TranscriptInbound, data)
+		}
+	})
+}
+
+// closeTranscript stops recording and flushes the transcript, returning the
+// first error writing it.
+func (c *Client) closeTranscript() error {
+	if c.transcript == nil {
+		return nil
+	}
+	c.conn.setTranscript(nil)
+	err := c.transcript.Close()
+	c.transcript = nil
+	return err
+}
+
+// transcriptMessage returns the wire form of a message read from the CLI:
+// its original JSON when raw capture is on, and otherwise its re-encoding.
+// Control messages carry their full payload in SystemMessage.Data.
+func transcriptMessage(msg types.Message) []byte {
+	if raw := msg.GetRaw(); raw != nil {
+		return raw
+	}
+	var data []byte
+	var err error
+	if sys, ok := msg.(*types.SystemMessage); ok && (sys.Type == types.MessageTypeControlRequest || sys.Type == types.MessageTypeControlResponse) {
+		data, err = json.Marshal(sys.Data)
+	} else {
+		data, err = json.Marshal(msg)
+	}
+	if err != nil {
+		return nil
+	}
+	return data
+}
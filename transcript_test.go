@@ -0,0 +1,297 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/schema"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+const transcriptHookCall = `{"type":"control_request","request_id":"req_hook_1","request":{"subtype":"hook_callback","callback_id":"hook_1","input":{"session_id":"s1","transcript_path":"/home/user/.claude/projects/app/s1.jsonl","cwd":"/app","hook_event_name":"UserPromptSubmit","prompt":"hello"}}}`
+
+// runTranscriptSession sends one prompt to a scripted CLI that invokes hook_1
+// and waits for its response before finishing the turn.
+func runTranscriptSession(t *testing.T, opts *types.ClaudeAgentOptions) *Client {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(transcriptHookCall),
+		mockcli.AwaitResponse("req_hook_1"),
+		mockcli.Send(`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":1,"session_id":"s1"}`),
+	}})
+	opts.WithCLIPath(cli.Path)
+
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	if got := client.TranscriptPath(); got != "" {
+		t.Errorf("TranscriptPath before any hook = %q, want empty", got)
+	}
+
+	if err := client.Query(ctx, "hello"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range client.ReceiveResponse(ctx) {
+	}
+	return client
+}
+
+func TestClient_TranscriptPathFromHook(t *testing.T) {
+	called := make(chan struct{}, 1)
+	opts := types.NewClaudeAgentOptions().WithStrictProtocol(true).WithHook(types.HookEventUserPromptSubmit, types.HookMatcher{
+		Hooks: []types.HookCallbackFunc{
+			func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+				called <- struct{}{}
+				return map[string]interface{}{}, nil
+			},
+		},
+	})
+
+	client := runTranscriptSession(t, opts)
+
+	select {
+	case <-called:
+	default:
+		t.Fatal("application hook was not called")
+	}
+	if got, want := client.TranscriptPath(), "/home/user/.claude/projects/app/s1.jsonl"; got != want {
+		t.Errorf("TranscriptPath = %q, want %q", got, want)
+	}
+}
+
+func TestClient_TranscriptPathCaptureWithoutHooks(t *testing.T) {
+	client := runTranscriptSession(t, types.NewClaudeAgentOptions().WithCaptureTranscriptPath(true))
+
+	want := "/home/user/.claude/projects/app/s1.jsonl"
+	if got := client.TranscriptPath(); got != want {
+		t.Errorf("TranscriptPath = %q, want %q", got, want)
+	}
+
+	// The path stays available for logging after the session ends
+	_ = client.Close(context.Background())
+	if got := client.TranscriptPath(); got != want {
+		t.Errorf("TranscriptPath after Close = %q, want %q", got, want)
+	}
+}
+
+func TestClient_TranscriptPathBeforeConnect(t *testing.T) {
+	client, err := NewClient(context.Background(), types.NewClaudeAgentOptions().WithCLIPath(writeScriptedCLI(t)))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if got := client.TranscriptPath(); got != "" {
+		t.Errorf("TranscriptPath = %q, want empty", got)
+	}
+}
+
+// transcriptToolUse is an assistant message whose tool input carries secrets,
+// both as a configured env value and in an "env" object.
+const transcriptToolUse = `{"type":"assistant","message":{"model":"m","content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"curl -H 'x-api-key: sk-ant-api03-secret' -u hunter2-db","env":{"GITHUB_TOKEN":"ghp_leaked","HOME":"/home/u"}}}]}}`
+
+// TestClient_WithTranscript tests that a scripted session round-trips through
+// the transcript in order, with secrets redacted.
+func TestClient_WithTranscript(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var buf bytes.Buffer
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeScriptedCLI(t, transcriptToolUse, streamResult)).
+		WithEnvVar("DB_PASSWORD", "hunter2-db").
+		WithTranscript(&buf)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if err := client.Query(ctx, "hello"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	for range client.ReceiveResponse(ctx) {
+	}
+	_ = client.Close(ctx) // Flushes the transcript
+
+	for _, secret := range []string{"sk-ant-api03-secret", "hunter2-db", "ghp_leaked"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("transcript contains secret %q:\n%s", secret, buf.String())
+		}
+	}
+
+	// Every line is a record of the current schema
+	for i, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if err := schema.Validate([]byte(line)); err != nil {
+			t.Errorf("line %d is not a valid record: %v\n%s", i+1, err, line)
+		}
+	}
+
+	entries, err := LoadTranscript(&buf)
+	if err != nil {
+		t.Fatalf("LoadTranscript failed: %v", err)
+	}
+	type step struct {
+		direction TranscriptDirection
+		kind      string // The message type, or the control request subtype
+	}
+	want := []step{
+		{TranscriptOutbound, "initialize"},
+		{TranscriptInbound, "control_response"},
+		{TranscriptOutbound, "user"},
+		{TranscriptInbound, "assistant"},
+		{TranscriptInbound, "result"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d:\n%s", len(entries), len(want), buf.String())
+	}
+	for i, entry := range entries {
+		var msg struct {
+			Type    string `json:"type"`
+			Request struct {
+				Subtype string `json:"subtype"`
+			} `json:"request"`
+		}
+		if err := json.Unmarshal(entry.Message, &msg); err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+		kind := msg.Type
+		if kind == "control_request" {
+			kind = msg.Request.Subtype
+		}
+		if got := (step{entry.Direction, kind}); got != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got, want[i])
+		}
+		if wantKind := schema.KindOf(entry.Message); entry.Schema != schema.Current || entry.Kind != wantKind {
+			t.Errorf("entry %d is a %s record of %q, want a %s record of %q", i, entry.Kind, entry.Schema, wantKind, schema.Current)
+		}
+		if entry.Time.IsZero() {
+			t.Errorf("entry %d has no time", i)
+		}
+		if i > 0 && entry.Time.Before(entries[i-1].Time) {
+			t.Errorf("entry %d is older than the one before it", i)
+		}
+	}
+
+	// Non-secret values are kept verbatim
+	if got := string(entries[3].Message); !strings.Contains(got, `"HOME":"/home/u"`) || !strings.Contains(got, `"GITHUB_TOKEN":"[REDACTED]"`) {
+		t.Errorf("assistant entry = %s", got)
+	}
+}
+
+// blockingWriter blocks writes until released.
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+// TestTranscriptWriter_DoesNotBlock tests that Record returns while the
+// writer is stuck, and that Close writes everything recorded before it.
+func TestTranscriptWriter_DoesNotBlock(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	transcript := NewTranscriptWriter(w, nil)
+
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		for i := 0; i < 1000; i++ {
+			transcript.Record(TranscriptInbound, []byte(`{"type":"assistant","n":`+strings.Repeat("1", 100)+`}`))
+		}
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record blocked on the writer")
+	}
+
+	close(w.release)
+	if err := transcript.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := transcript.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+	transcript.Record(TranscriptInbound, []byte(`{}`)) // Dropped after Close
+
+	entries, err := LoadTranscript(&w.buf)
+	if err != nil {
+		t.Fatalf("LoadTranscript failed: %v", err)
+	}
+	if len(entries) != 1000 {
+		t.Errorf("got %d entries, want 1000", len(entries))
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestTranscriptWriter_WriteError(t *testing.T) {
+	transcript := NewTranscriptWriter(failingWriter{}, nil)
+	transcript.Record(TranscriptOutbound, []byte(`{"type":"user"}`))
+	if err := transcript.Close(); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("Close() error = %v, want the write error", err)
+	}
+}
+
+func TestLoadTranscript(t *testing.T) {
+	input := `{"time":"2025-01-02T03:04:05Z","direction":"out","message":{"type":"user"}}
+
+{"time":"2025-01-02T03:04:06Z","direction":"in","message":{"type":"result"}}`
+	entries, err := LoadTranscript(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("LoadTranscript failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Direction != TranscriptOutbound || entries[1].Direction != TranscriptInbound {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if got := string(entries[1].Message); got != `{"type":"result"}` {
+		t.Errorf("Message = %s", got)
+	}
+
+	// Records of the current schema load as well
+	v1 := `{"schema":"claude-agent-sdk.event.v1","time":"2025-01-02T03:04:05Z","kind":"message","direction":"in","message":{"type":"result"}}`
+	if entries, err := LoadTranscript(strings.NewReader(v1)); err != nil || len(entries) != 1 || entries[0].Kind != schema.KindMessage {
+		t.Errorf("LoadTranscript(v1) = %+v, %v", entries, err)
+	}
+	v2 := `{"schema":"claude-agent-sdk.event.v2","time":"2025-01-02T03:04:05Z","kind":"message","direction":"in","message":{"type":"result"}}`
+	if _, err := LoadTranscript(strings.NewReader(v2)); !errors.Is(err, schema.ErrUnsupportedVersion) {
+		t.Errorf("LoadTranscript(v2) error = %v, want ErrUnsupportedVersion", err)
+	}
+
+	for name, input := range map[string]string{
+		"invalid JSON":      "{\n",
+		"invalid direction": `{"time":"2025-01-02T03:04:05Z","direction":"sideways","message":{}}`,
+	} {
+		if _, err := LoadTranscript(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("%s: error = %v, want a line 1 error", name, err)
+		}
+	}
+}
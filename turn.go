@@ -0,0 +1,240 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// RunTurn sends prompt and waits for the turn to finish, returning the
+// assembled assistant text, the tool invocations, the ResultMessage and
+// every message received. It consumes exactly the turn's messages, so the
+// client is ready for the next RunTurn or Query; do not call ReceiveResponse
+// for it.
+//
+// A turn that ends with an error result, such as reaching the turn limit, is
+// not an error: check TurnResult.IsError. Errors are returned along with
+// whatever was collected:
+//   - ctx.Err() when ctx is done before the result arrives. The rest of the
+//     turn is left unread; Interrupt the session or Close the client rather
+//     than starting another turn.
+//   - The typed error of a transport failure (see ReceiveResponse) or an
+//     IdleTimeoutError.
+//   - A BudgetExceededError when the turn's cost crossed WithMaxCostUSD; the
+//     result is complete.
+//   - A TransportBrokenError when the CLI's output ends without a result,
+//     even with WithSyntheticResults: a synthetic result is kept in
+//     TurnResult.Messages but not set as TurnResult.Result.
+//
+// Example:
+//
+//	turn, err := client.RunTurn(ctx, "What is 2+2?")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Println(turn.Text)
+func (c *Client) RunTurn(ctx context.Context, prompt string) (*types.TurnResult, error) {
+	if err := c.Query(ctx, prompt); err != nil {
+		return nil, err
+	}
+	return c.receiveTurn(ctx)
+}
+
+// RunTurnWithOptions is like RunTurn but applies opts to this turn only, as
+// QueryWithOptions does. An error putting back the previous settings once
+// the turn is over is returned if the turn itself succeeded.
+//
+// Example:
+//
+//	// Summarize in the background without paying for deltas nobody reads
+//	quiet := false
+//	turn, err := client.RunTurnWithOptions(ctx, "Summarize the log", &types.TurnOptions{Streaming: &quiet})
+func (c *Client) RunTurnWithOptions(ctx context.Context, prompt string, opts *types.TurnOptions) (*types.TurnResult, error) {
+	if err := c.QueryWithOptions(ctx, prompt, opts); err != nil {
+		return nil, err
+	}
+	return c.receiveTurn(ctx)
+}
+
+// QueryWithOptions is like Query but applies per to this turn only: its
+// permission callback, hooks, permission mode and streaming setting replace
+// the session's until the turn's ResultMessage arrives through
+// ReceiveResponse, which puts the previous settings back before delivering
+// it. If that fails, ReceiveResponse follows the result with a
+// turn_restore_failed SystemMessage carrying the error in Err. A nil per is
+// the same as Query.
+//
+// Per-turn hooks need their events enabled with WithTurnHookEvents, and a
+// per-turn CanUseTool needs a session created with WithCanUseTool. The
+// session's own hooks keep running alongside the turn's, so a hook the
+// session relies on for safety cannot be bypassed by a turn.
+//
+// Turns with overrides cannot overlap: until the turn's result has been
+// received, Query, QueryWithOptions and the other prompt methods return a
+// TurnInProgressError. Start the turn once the previous one is over, since
+// the overrides also apply to whatever is still running. If the settings
+// cannot be applied, those already applied are put back and the prompt is
+// not sent.
+//
+// Example:
+//
+//	// Let this one turn edit files, asking a stricter callback first
+//	mode := types.PermissionModeAcceptEdits
+//	err := client.QueryWithOptions(ctx, "Apply the fix", &types.TurnOptions{
+//	    PermissionMode: &mode,
+//	    CanUseTool:     reviewEdits,
+//	})
+func (c *Client) QueryWithOptions(ctx context.Context, prompt string, per *types.TurnOptions) error {
+	if per == nil {
+		return c.Query(ctx, prompt)
+	}
+
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return types.NewCLIConnectionError("not connected - call Connect() first")
+	}
+	if c.turn != nil {
+		c.mu.Unlock()
+		return types.NewTurnInProgressError("cannot start a QueryWithOptions turn while another is in progress")
+	}
+	turn := &turnOverride{}
+	c.turn = turn
+	c.mu.Unlock()
+
+	if err := c.applyTurnOptions(ctx, turn, per); err != nil {
+		return errors.Join(err, c.endTurn(ctx))
+	}
+	if err := c.sendUserMessage(context.WithValue(ctx, turnPromptKey{}, turn), types.NewUserMessage(prompt)); err != nil {
+		return errors.Join(err, c.endTurn(ctx))
+	}
+	return nil
+}
+
+// turnOverride records the settings a QueryWithOptions turn replaced, to be
+// put back by endTurn. nil fields were left alone.
+type turnOverride struct {
+	permissionMode *types.PermissionMode
+	streaming      *bool
+}
+
+// turnPromptKey marks the context of the prompt QueryWithOptions sends, so
+// that writeUserMessage lets it through while the turn is active.
+type turnPromptKey struct{}
+
+// applyTurnOptions switches the session to per, recording in turn what to
+// put back.
+func (c *Client) applyTurnOptions(ctx context.Context, turn *turnOverride, per *types.TurnOptions) error {
+	if per.CanUseTool != nil && c.options.CanUseTool == nil {
+		return fmt.Errorf("a per-turn CanUseTool needs a session created with WithCanUseTool")
+	}
+
+	c.mu.Lock()
+	query := c.query
+	mode := c.permissionMode
+	c.mu.Unlock()
+
+	if err := query.SetTurnCallbacks(per.CanUseTool, per.Hooks); err != nil {
+		return err
+	}
+	if per.PermissionMode != nil && *per.PermissionMode != mode {
+		if err := c.SetPermissionMode(ctx, *per.PermissionMode); err != nil {
+			return err
+		}
+		turn.permissionMode = &mode
+	}
+	if per.Streaming != nil {
+		if previous := c.isStreaming(); *per.Streaming != previous {
+			if err := c.SetStreaming(ctx, *per.Streaming); err != nil {
+				return err
+			}
+			turn.streaming = &previous
+		}
+	}
+	return nil
+}
+
+// endTurn ends the current QueryWithOptions turn, if any, putting back the
+// settings it replaced.
+func (c *Client) endTurn(ctx context.Context) error {
+	c.mu.Lock()
+	turn := c.turn
+	c.turn = nil
+	query := c.query
+	c.mu.Unlock()
+	if turn == nil || query == nil {
+		return nil
+	}
+
+	var errs []error
+	if err := query.SetTurnCallbacks(nil, nil); err != nil {
+		errs = append(errs, err)
+	}
+	if turn.permissionMode != nil {
+		if err := c.SetPermissionMode(ctx, *turn.permissionMode); err != nil {
+			errs = append(errs, fmt.Errorf("restoring permission mode %s: %w", *turn.permissionMode, err))
+		}
+	}
+	if turn.streaming != nil {
+		if err := c.SetStreaming(ctx, *turn.streaming); err != nil {
+			errs = append(errs, fmt.Errorf("restoring streaming: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// turnRestoreFailedMessage builds the SystemMessage emitted when the settings
+// replaced by a QueryWithOptions turn cannot be put back.
+func turnRestoreFailedMessage(err error) *types.SystemMessage {
+	return &types.SystemMessage{
+		Type:    types.MessageTypeSystem,
+		Subtype: "turn_restore_failed",
+		Data: map[string]interface{}{
+			"error": err.Error(),
+		},
+		Err: err,
+	}
+}
+
+// receiveTurn collects the messages of the turn started by the last query,
+// as described for RunTurn.
+func (c *Client) receiveTurn(ctx context.Context) (*types.TurnResult, error) {
+	return collectTurn(ctx, c.ReceiveResponse(ctx))
+}
+
+// collectTurn collects a turn from its messages, as described for RunTurn.
+func collectTurn(ctx context.Context, messages <-chan types.Message) (*types.TurnResult, error) {
+	turn := &types.TurnResult{}
+	var turnErr error
+	for msg := range messages {
+		turn.Messages = append(turn.Messages, msg)
+		switch m := msg.(type) {
+		case *types.AssistantMessage:
+			turn.ToolUses = append(turn.ToolUses, m.ToolUses()...)
+		case *types.ResultMessage:
+			// A synthetic result stands for the one the CLI never sent
+			if !m.IsSynthetic() {
+				turn.Result = m
+			}
+		case *types.SystemMessage:
+			// Parse errors only lose one line; the turn goes on
+			if m.Err != nil && m.Subtype != "parse_error" && turnErr == nil {
+				turnErr = m.Err
+			}
+		}
+	}
+	turn.Text = CollectAssistantText(turn.Messages)
+
+	if turnErr != nil {
+		return turn, turnErr
+	}
+	if turn.Result == nil {
+		if err := ctx.Err(); err != nil {
+			return turn, err
+		}
+		return turn, types.NewTransportBrokenError("CLI output ended before the turn's result")
+	}
+	return turn, nil
+}
@@ -0,0 +1,298 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestClient_RunTurn(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(
+			`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Reading"},{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"main.go"}}]}}`,
+			`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"package main"}]}}`,
+			`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"It is a main package"}]}}`,
+			`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":1,"session_id":"s1","total_cost_usd":0.01}`,
+		),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(
+			`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Second answer"}]}}`,
+			`{"type":"result","subtype":"success","duration_ms":10,"duration_api_ms":8,"is_error":false,"num_turns":2,"session_id":"s1","total_cost_usd":0.02}`,
+		),
+	}})
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() { _ = client.Close(context.Background()) }()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	first, err := client.RunTurn(ctx, "What is main.go?")
+	if err != nil {
+		t.Fatalf("first RunTurn failed: %v", err)
+	}
+	if first.Text != "Reading\nIt is a main package" {
+		t.Errorf("first Text = %q", first.Text)
+	}
+	if len(first.ToolUses) != 1 || first.ToolUses[0].ID != "toolu_1" {
+		t.Errorf("first ToolUses = %v, want the Read call", first.ToolUses)
+	}
+	if first.Result == nil || first.Result.NumTurns != 1 || first.IsError() {
+		t.Errorf("first Result = %+v", first.Result)
+	}
+	if len(first.Messages) != 4 {
+		t.Errorf("first has %d messages, want 4", len(first.Messages))
+	}
+
+	second, err := client.RunTurn(ctx, "Thanks")
+	if err != nil {
+		t.Fatalf("second RunTurn failed: %v", err)
+	}
+	if second.Text != "Second answer" || len(second.ToolUses) != 0 {
+		t.Errorf("second = text %q, %d tool uses", second.Text, len(second.ToolUses))
+	}
+	if second.Result == nil || second.Result.NumTurns != 2 || len(second.Messages) != 2 {
+		t.Errorf("second = result %+v, %d messages", second.Result, len(second.Messages))
+	}
+}
+
+func TestClient_RunTurnContextDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx,
+		`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Thinking..."}]}}`,
+	)
+
+	turnCtx, turnCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer turnCancel()
+	turn, err := client.RunTurn(turnCtx, "Hello")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RunTurn error = %v, want context.DeadlineExceeded", err)
+	}
+	if turn == nil || turn.Result != nil || turn.Text != "Thinking..." {
+		t.Errorf("turn = %+v, want the partial text without a result", turn)
+	}
+}
+
+func TestClient_RunTurnCLIExits(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"Starting"}]}}`),
+		mockcli.Exit(3),
+	}})
+	opts := types.NewClaudeAgentOptions().WithCLIPath(cli.Path)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() { _ = client.Close(context.Background()) }()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	// The CLI's exit is reported with its code
+	turn, err := client.RunTurn(ctx, "Hello")
+	var procErr *types.ProcessError
+	if !errors.As(err, &procErr) || procErr.ExitCode != 3 {
+		t.Fatalf("RunTurn error = %v, want a ProcessError with exit code 3", err)
+	}
+	if turn == nil || turn.Result != nil || turn.Text != "Starting" {
+		t.Errorf("turn = %+v, want the partial text without a result", turn)
+	}
+}
+
+// turnCLI returns a mock CLI that, for each of two prompts, calls the
+// hook_1 PreToolUse hook and asks permission for a Bash command, finishing
+// the turn once both are answered.
+func turnCLI(t *testing.T) *mockcli.CLI {
+	t.Helper()
+
+	var steps []mockcli.Step
+	for _, n := range []string{"1", "2"} {
+		steps = append(steps,
+			mockcli.AwaitPrompt(),
+			mockcli.Send(
+				`{"type":"control_request","request_id":"hook_`+n+`","request":{"subtype":"hook_callback","callback_id":"hook_1","input":{"hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}}}}`,
+				`{"type":"control_request","request_id":"perm_`+n+`","request":{"subtype":"can_use_tool","tool_name":"Bash","input":{"command":"ls"}}}`,
+			),
+			mockcli.AwaitResponse("hook_"+n),
+			mockcli.AwaitResponse("perm_"+n),
+			mockcli.Send(`{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s"}`),
+		)
+	}
+	return mockcli.New(t, mockcli.Scenario{
+		ControlResponses: map[string]json.RawMessage{"initialize": json.RawMessage(`{"output_style":"default"}`)},
+		Steps:            steps,
+	})
+}
+
+// turnFrames reads what the SDK sent turnCLI: the responses by request ID,
+// and the permission modes requested, in order.
+func turnFrames(t *testing.T, cli *mockcli.CLI) (responses map[string]map[string]interface{}, modes []string) {
+	t.Helper()
+
+	responses = make(map[string]map[string]interface{})
+	for _, line := range cli.Received() {
+		var frame struct {
+			Type     string `json:"type"`
+			Response struct {
+				RequestID string                 `json:"request_id"`
+				Response  map[string]interface{} `json:"response"`
+			} `json:"response"`
+			Request struct {
+				Subtype string `json:"subtype"`
+				Mode    string `json:"mode"`
+			} `json:"request"`
+		}
+		if err := json.Unmarshal([]byte(line), &frame); err != nil {
+			t.Fatalf("bad frame %q: %v", line, err)
+		}
+		switch {
+		case frame.Type == "control_response":
+			responses[frame.Response.RequestID] = frame.Response.Response
+		case frame.Request.Subtype == "set_permission_mode":
+			modes = append(modes, frame.Request.Mode)
+		}
+	}
+	return responses, modes
+}
+
+func TestClient_QueryWithOptions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := turnCLI(t)
+	allow := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+		return &types.PermissionResultAllow{Behavior: "allow"}, nil
+	}
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(cli.Path).
+		WithCanUseTool(allow).
+		WithStrictProtocol(true).
+		WithTurnHookEvents(types.HookEventPreToolUse)
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() { _ = client.Close(context.Background()) }()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	plan := types.PermissionModePlan
+	bash := "Bash"
+	per := &types.TurnOptions{
+		PermissionMode: &plan,
+		CanUseTool: func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+			return &types.PermissionResultDeny{Behavior: "deny", Message: "not this turn"}, nil
+		},
+		Hooks: map[types.HookEvent][]types.HookMatcher{
+			types.HookEventPreToolUse: {
+				{Matcher: &bash, Hooks: []types.HookCallbackFunc{
+					func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+						return map[string]interface{}{"systemMessage": "turn hook ran"}, nil
+					},
+				}},
+				{Matcher: &[]string{"Read|Write"}[0], Hooks: []types.HookCallbackFunc{
+					func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+						t.Error("hook for other tools ran for Bash")
+						return map[string]interface{}{}, nil
+					},
+				}},
+			},
+		},
+	}
+	if err := client.QueryWithOptions(ctx, "first", per); err != nil {
+		t.Fatalf("QueryWithOptions failed: %v", err)
+	}
+
+	// Overlapping turns are refused while the first is running
+	if err := client.Query(ctx, "overlap"); !types.IsTurnInProgressError(err) {
+		t.Errorf("Query during the turn = %v, want a TurnInProgressError", err)
+	}
+	if err := client.QueryWithOptions(ctx, "overlap", &types.TurnOptions{}); !types.IsTurnInProgressError(err) {
+		t.Errorf("QueryWithOptions during the turn = %v, want a TurnInProgressError", err)
+	}
+
+	for msg := range client.ReceiveResponse(ctx) {
+		if sys, ok := msg.(*types.SystemMessage); ok && sys.Err != nil {
+			t.Errorf("unexpected %s: %v", sys.Subtype, sys.Err)
+		}
+	}
+
+	// The overrides are gone for the next turn
+	if _, err := client.RunTurn(ctx, "second"); err != nil {
+		t.Fatalf("RunTurn failed: %v", err)
+	}
+
+	responses, modes := turnFrames(t, cli)
+	if got := responses["hook_1"]["systemMessage"]; got != "turn hook ran" {
+		t.Errorf("first turn's hook response = %v, want the turn hook's output", responses["hook_1"])
+	}
+	if got := responses["perm_1"]["behavior"]; got != "deny" {
+		t.Errorf("first turn's permission response = %v, want the turn callback's deny", responses["perm_1"])
+	}
+	if len(responses["hook_2"]) != 0 {
+		t.Errorf("second turn's hook response = %v, want no opinion", responses["hook_2"])
+	}
+	if got := responses["perm_2"]["behavior"]; got != "allow" {
+		t.Errorf("second turn's permission response = %v, want the session callback's allow", responses["perm_2"])
+	}
+	if want := []string{"plan", "default"}; !reflect.DeepEqual(modes, want) {
+		t.Errorf("permission modes set = %v, want %v", modes, want)
+	}
+}
+
+func TestClient_QueryWithOptionsInvalid(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(writeEchoCLIWithInit(t, `{}`)))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() { _ = client.Close(context.Background()) }()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	noop := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
+		return map[string]interface{}{}, nil
+	}
+	deny := func(ctx context.Context, toolName string, input map[string]interface{}, permCtx types.ToolPermissionContext) (types.PermissionResult, error) {
+		return &types.PermissionResultDeny{Behavior: "deny"}, nil
+	}
+	for name, per := range map[string]*types.TurnOptions{
+		"hook event not enabled": {Hooks: map[types.HookEvent][]types.HookMatcher{
+			types.HookEventPostToolUse: {{Hooks: []types.HookCallbackFunc{noop}}},
+		}},
+		"no session callback": {CanUseTool: deny},
+	} {
+		if err := client.QueryWithOptions(ctx, "hi", per); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// A refused turn leaves nothing behind
+	turn, err := client.RunTurn(ctx, "hi")
+	if err != nil || turn.Text != "ok" {
+		t.Fatalf("RunTurn after refused turns = %+v, %v", turn, err)
+	}
+}
@@ -0,0 +1,173 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"sync"
+)
+
+// SchemaAlias is a field the CLI has been seen to send under an alternate
+// casing. Different CLI versions have flip-flopped between snake_case and
+// camelCase for a few fields; the SDK accepts either and rewrites the
+// alternate to the name its types use.
+type SchemaAlias struct {
+	Field string // Name the SDK uses, e.g. "parent_tool_use_id"
+	Alias string // Alternate name the CLI sent, e.g. "parentToolUseId"
+}
+
+// Known drift cases. When both names are present the SDK's name wins.
+var (
+	// Top-level fields of user, assistant, and stream_event messages
+	messageAliases = []SchemaAlias{
+		{Field: "parent_tool_use_id", Alias: "parentToolUseId"},
+	}
+
+	// Fields of hook callback requests and their input
+	hookAliases = []SchemaAlias{
+		{Field: "hook_event_name", Alias: "hookEventName"},
+		{Field: "tool_use_id", Alias: "toolUseId"},
+	}
+)
+
+var (
+	schemaAliasesMu      sync.Mutex
+	schemaAliasesSeen    []SchemaAlias
+	schemaAliasesHandler func(SchemaAlias)
+)
+
+// SetSchemaAliasHandler sets the function called the first time in the
+// process that the CLI is seen using each alternate field name. It exists so
+// applications can track when an alias is still in use and when support for
+// it can be dropped. Without a handler, the default, the SDK logs a warning
+// through the Logger of the options in effect (see DecodeOptions.Logger), or
+// nowhere if they set none. A nil handler restores the default.
+func SetSchemaAliasHandler(handler func(SchemaAlias)) {
+	schemaAliasesMu.Lock()
+	defer schemaAliasesMu.Unlock()
+	schemaAliasesHandler = handler
+}
+
+// ObservedSchemaAliases returns the alternate field names seen so far in
+// this process, in the order they were first seen.
+func ObservedSchemaAliases() []SchemaAlias {
+	schemaAliasesMu.Lock()
+	defer schemaAliasesMu.Unlock()
+	return cloneSlice(schemaAliasesSeen)
+}
+
+// noteSchemaAlias records a. The first time it is seen, it notifies the
+// handler, or warns through logger if there is no handler.
+func noteSchemaAlias(a SchemaAlias, logger *slog.Logger) {
+	schemaAliasesMu.Lock()
+	for _, seen := range schemaAliasesSeen {
+		if seen == a {
+			schemaAliasesMu.Unlock()
+			return
+		}
+	}
+	schemaAliasesSeen = append(schemaAliasesSeen, a)
+	handler := schemaAliasesHandler
+	schemaAliasesMu.Unlock()
+
+	switch {
+	case handler != nil:
+		handler(a)
+	case logger != nil:
+		logger.Warn("claude: CLI sent a field under an alternate name; the SDK accepts both",
+			"field", a.Field, "alias", a.Alias)
+	}
+}
+
+// normalizeMessageAliases rewrites alternate top-level field names in a
+// message to the SDK's names, warning through logger of the first use of
+// each. data is returned unchanged when it holds none.
+func normalizeMessageAliases(data []byte, logger *slog.Logger) []byte {
+	found := false
+	for _, a := range messageAliases {
+		if bytes.Contains(data, []byte(`"`+a.Alias+`"`)) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return data
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data
+	}
+	changed := false
+	for _, a := range messageAliases {
+		value, ok := fields[a.Alias]
+		if !ok {
+			continue
+		}
+		delete(fields, a.Alias)
+		changed = true
+		noteSchemaAlias(a, logger)
+		if _, ok := fields[a.Field]; !ok {
+			fields[a.Field] = value
+		}
+	}
+	if !changed {
+		return data
+	}
+
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return data
+	}
+	return normalized
+}
+
+// NormalizeHookFields returns m with alternate field names used by some CLI
+// versions in hook callback requests and hook input (such as hookEventName)
+// rewritten to the names the hook input types use (hook_event_name). m itself
+// is not modified; it is returned as is when it holds no alternate names.
+// The SDK applies this before hook callbacks see their input.
+func NormalizeHookFields(m map[string]interface{}) map[string]interface{} {
+	return normalizeHookFields(m, nil)
+}
+
+// normalizeHookFields is NormalizeHookFields, warning through logger of the
+// first use of each alternate name.
+func normalizeHookFields(m map[string]interface{}, logger *slog.Logger) map[string]interface{} {
+	var normalized map[string]interface{}
+	for _, a := range hookAliases {
+		value, ok := m[a.Alias]
+		if !ok {
+			continue
+		}
+		if normalized == nil {
+			normalized = make(map[string]interface{}, len(m))
+			for k, v := range m {
+				normalized[k] = v
+			}
+		}
+		delete(normalized, a.Alias)
+		noteSchemaAlias(a, logger)
+		if _, ok := normalized[a.Field]; !ok {
+			normalized[a.Field] = value
+		}
+	}
+	if normalized == nil {
+		return m
+	}
+	return normalized
+}
+
+// unmarshalHookInput decodes hook input JSON into v after rewriting
+// alternate field names.
+func unmarshalHookInput(data []byte, v interface{}) error {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	data, err := json.Marshal(NormalizeHookFields(fields))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,242 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// recordSchemaAliases resets the observed aliases and collects handler calls
+// for the duration of the test.
+func recordSchemaAliases(t *testing.T) *[]SchemaAlias {
+	t.Helper()
+
+	schemaAliasesMu.Lock()
+	savedSeen, savedHandler := schemaAliasesSeen, schemaAliasesHandler
+	schemaAliasesSeen = nil
+	schemaAliasesMu.Unlock()
+
+	var calls []SchemaAlias
+	SetSchemaAliasHandler(func(a SchemaAlias) { calls = append(calls, a) })
+	t.Cleanup(func() {
+		schemaAliasesMu.Lock()
+		schemaAliasesSeen, schemaAliasesHandler = savedSeen, savedHandler
+		schemaAliasesMu.Unlock()
+	})
+	return &calls
+}
+
+func TestUnmarshalMessage_ParentToolUseIDAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"user snake_case", `{"type":"user","message":{"role":"user","content":"hi"},"parent_tool_use_id":"toolu_1"}`},
+		{"user camelCase", `{"type":"user","message":{"role":"user","content":"hi"},"parentToolUseId":"toolu_1"}`},
+		{"assistant snake_case", `{"type":"assistant","message":{"model":"m","content":[]},"parent_tool_use_id":"toolu_1"}`},
+		{"assistant camelCase", `{"type":"assistant","message":{"model":"m","content":[]},"parentToolUseId":"toolu_1"}`},
+		{"stream_event snake_case", `{"type":"stream_event","uuid":"u","session_id":"s","event":{},"parent_tool_use_id":"toolu_1"}`},
+		{"stream_event camelCase", `{"type":"stream_event","uuid":"u","session_id":"s","event":{},"parentToolUseId":"toolu_1"}`},
+		{"both names prefer snake_case", `{"type":"user","message":{"role":"user","content":"hi"},"parentToolUseId":"toolu_other","parent_tool_use_id":"toolu_1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordSchemaAliases(t)
+
+			msg, err := UnmarshalMessage([]byte(tt.json))
+			if err != nil {
+				t.Fatalf("UnmarshalMessage failed: %v", err)
+			}
+
+			var got *string
+			switch m := msg.(type) {
+			case *UserMessage:
+				got = m.ParentToolUseID
+			case *AssistantMessage:
+				got = m.ParentToolUseID
+			case *StreamEvent:
+				got = m.ParentToolUseID
+			}
+			if got == nil || *got != "toolu_1" {
+				t.Errorf("ParentToolUseID = %v, want toolu_1", got)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMessageWithRaw_KeepsOriginalCasing(t *testing.T) {
+	recordSchemaAliases(t)
+
+	line := `{"type":"user","message":{"role":"user","content":"hi"},"parentToolUseId":"toolu_1"}`
+	msg, err := UnmarshalMessageWithRaw([]byte(line))
+	if err != nil {
+		t.Fatalf("UnmarshalMessageWithRaw failed: %v", err)
+	}
+	if string(msg.GetRaw()) != line {
+		t.Errorf("Raw = %s, want the line as sent", msg.GetRaw())
+	}
+}
+
+// TestSchemaAlias_WarnsThroughLogger tests that, without a handler, the first
+// use of an alias is logged through the decoder's logger, and nowhere
+// without one.
+func TestSchemaAlias_WarnsThroughLogger(t *testing.T) {
+	recordSchemaAliases(t)
+	SetSchemaAliasHandler(nil)
+
+	var defaultLog bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&defaultLog, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	var log bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&log, nil))
+	line := []byte(`{"type":"user","message":{"role":"user","content":"hi"},"parentToolUseId":"toolu_1"}`)
+	for i := 0; i < 2; i++ {
+		if _, err := UnmarshalMessageWithOptions(line, DecodeOptions{Logger: logger}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Count(log.String(), "alternate name"); got != 1 {
+		t.Errorf("logged %d warnings, want 1:\n%s", got, log.String())
+	}
+	if !strings.Contains(log.String(), "alias=parentToolUseId") {
+		t.Errorf("warning does not name the alias:\n%s", log.String())
+	}
+
+	// A hook input alias seen first without a logger is only recorded
+	if _, err := ParseHookInput(map[string]interface{}{"hookEventName": "Stop"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseHookInputWithOptions(map[string]interface{}{"hookEventName": "Stop"}, DecodeOptions{Logger: logger}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(log.String(), "alternate name"); got != 1 {
+		t.Errorf("logged %d warnings, want 1:\n%s", got, log.String())
+	}
+	if len(ObservedSchemaAliases()) != 2 {
+		t.Errorf("ObservedSchemaAliases() = %v, want both aliases", ObservedSchemaAliases())
+	}
+	if defaultLog.Len() != 0 {
+		t.Errorf("logged through slog.Default:\n%s", defaultLog.String())
+	}
+}
+
+func TestHookInput_HookEventNameAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"snake_case", `{"session_id":"s","hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}}`},
+		{"camelCase", `{"session_id":"s","hookEventName":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}}`},
+		{"both names prefer snake_case", `{"session_id":"s","hookEventName":"Other","hook_event_name":"PreToolUse","tool_name":"Bash","tool_input":{"command":"ls"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordSchemaAliases(t)
+
+			var input PreToolUseHookInput
+			if err := json.Unmarshal([]byte(tt.json), &input); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if input.HookEventName != "PreToolUse" || input.ToolName != "Bash" || input.SessionID != "s" {
+				t.Errorf("unexpected input: %+v", input)
+			}
+		})
+	}
+}
+
+func TestHookInput_AllTypesAcceptAliases(t *testing.T) {
+	recordSchemaAliases(t)
+
+	data := []byte(`{"hookEventName":"Event"}`)
+
+	var (
+		pre     PreToolUseHookInput
+		post    PostToolUseHookInput
+		prompt  UserPromptSubmitHookInput
+		stop    StopHookInput
+		sub     SubagentStopHookInput
+		compact PreCompactHookInput
+	)
+	targets := []interface{}{&pre, &post, &prompt, &stop, &sub, &compact}
+	for _, target := range targets {
+		if err := json.Unmarshal(data, target); err != nil {
+			t.Fatalf("Unmarshal into %T failed: %v", target, err)
+		}
+	}
+	for i, got := range []string{pre.HookEventName, post.HookEventName, prompt.HookEventName, stop.HookEventName, sub.HookEventName, compact.HookEventName} {
+		if got != "Event" {
+			t.Errorf("%T HookEventName = %q, want Event", targets[i], got)
+		}
+	}
+}
+
+func TestNormalizeHookFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		input map[string]interface{}
+		want  map[string]interface{}
+	}{
+		{
+			name:  "snake_case unchanged",
+			input: map[string]interface{}{"hook_event_name": "Stop", "tool_use_id": "t1"},
+			want:  map[string]interface{}{"hook_event_name": "Stop", "tool_use_id": "t1"},
+		},
+		{
+			name:  "camelCase rewritten",
+			input: map[string]interface{}{"hookEventName": "Stop", "toolUseId": "t1"},
+			want:  map[string]interface{}{"hook_event_name": "Stop", "tool_use_id": "t1"},
+		},
+		{
+			name:  "snake_case wins",
+			input: map[string]interface{}{"hookEventName": "Other", "hook_event_name": "Stop"},
+			want:  map[string]interface{}{"hook_event_name": "Stop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordSchemaAliases(t)
+
+			original, _ := json.Marshal(tt.input)
+			got, _ := json.Marshal(NormalizeHookFields(tt.input))
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("NormalizeHookFields = %s, want %s", got, want)
+			}
+			if after, _ := json.Marshal(tt.input); string(after) != string(original) {
+				t.Errorf("input modified: %s", after)
+			}
+		})
+	}
+}
+
+func TestSchemaAliasWarnedOnce(t *testing.T) {
+	calls := recordSchemaAliases(t)
+
+	for i := 0; i < 3; i++ {
+		if _, err := UnmarshalMessage([]byte(`{"type":"user","message":{"content":"hi"},"parentToolUseId":"t"}`)); err != nil {
+			t.Fatal(err)
+		}
+		NormalizeHookFields(map[string]interface{}{"hookEventName": "Stop"})
+	}
+	if _, err := UnmarshalMessage([]byte(`{"type":"user","message":{"content":"hi"},"parent_tool_use_id":"t"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SchemaAlias{
+		{Field: "parent_tool_use_id", Alias: "parentToolUseId"},
+		{Field: "hook_event_name", Alias: "hookEventName"},
+	}
+	if len(*calls) != len(want) || (*calls)[0] != want[0] || (*calls)[1] != want[1] {
+		t.Errorf("handler calls = %v, want %v", *calls, want)
+	}
+	if observed := ObservedSchemaAliases(); len(observed) != 2 {
+		t.Errorf("ObservedSchemaAliases = %v, want 2 entries", observed)
+	}
+}
@@ -0,0 +1,93 @@
+package types
+
+import "encoding/json"
+
+// Capability names a protocol feature the CLI can report in its initialize
+// response.
+type Capability string
+
+const (
+	CapabilityInterrupt          Capability = "supportsInterrupt"          // Client.Interrupt
+	CapabilityPartialMessages    Capability = "supportsPartialMessages"    // WithIncludePartialMessages
+	CapabilitySetPermissionMode  Capability = "supportsSetPermissionMode"  // Client.SetPermissionMode
+	CapabilityMcpSdkServers      Capability = "supportsMcpSdkServers"      // In-process ("sdk") MCP servers
+	CapabilitySetModel           Capability = "supportsSetModel"           // Client.SetModel
+	CapabilitySetPartialMessages Capability = "supportsSetPartialMessages" // Client.SetStreaming
+)
+
+// Capabilities is the protocol version and feature set the CLI reported in
+// the "capabilities" object of its initialize response.
+//
+// CLIs that predate capability reporting send no such object; ServerInfo's
+// Capabilities is then nil and every feature is assumed to be supported. A
+// reported set is authoritative: a capability it omits is unsupported.
+type Capabilities struct {
+	ProtocolVersion            string `json:"protocolVersion,omitempty"`
+	SupportsInterrupt          bool   `json:"supportsInterrupt,omitempty"`
+	SupportsPartialMessages    bool   `json:"supportsPartialMessages,omitempty"`
+	SupportsSetPermissionMode  bool   `json:"supportsSetPermissionMode,omitempty"`
+	SupportsMcpSdkServers      bool   `json:"supportsMcpSdkServers,omitempty"`
+	SupportsSetModel           bool   `json:"supportsSetModel,omitempty"`
+	SupportsSetPartialMessages bool   `json:"supportsSetPartialMessages,omitempty"`
+
+	// flags holds every boolean capability reported, including ones this SDK
+	// version has no field for.
+	flags map[string]bool
+}
+
+// UnmarshalJSON decodes the known fields and keeps all boolean flags for Supports.
+func (c *Capabilities) UnmarshalJSON(data []byte) error {
+	type plain Capabilities
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	c.flags = make(map[string]bool, len(fields))
+	for name, value := range fields {
+		if b, ok := value.(bool); ok {
+			c.flags[name] = b
+		}
+	}
+	return nil
+}
+
+// Supports reports whether the CLI supports capability. A nil Capabilities
+// (nothing reported) supports everything.
+func (c *Capabilities) Supports(capability Capability) bool {
+	if c == nil {
+		return true
+	}
+	if c.flags != nil {
+		return c.flags[string(capability)]
+	}
+
+	// Built directly rather than decoded
+	switch capability {
+	case CapabilityInterrupt:
+		return c.SupportsInterrupt
+	case CapabilityPartialMessages:
+		return c.SupportsPartialMessages
+	case CapabilitySetPermissionMode:
+		return c.SupportsSetPermissionMode
+	case CapabilityMcpSdkServers:
+		return c.SupportsMcpSdkServers
+	case CapabilitySetModel:
+		return c.SupportsSetModel
+	case CapabilitySetPartialMessages:
+		return c.SupportsSetPartialMessages
+	}
+	return false
+}
+
+// Require returns an UnsupportedFeatureError for feature if the CLI does not
+// support capability.
+func (c *Capabilities) Require(feature string, capability Capability) error {
+	if c.Supports(capability) {
+		return nil
+	}
+	return NewUnsupportedFeatureError(feature, capability)
+}
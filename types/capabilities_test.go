@@ -0,0 +1,79 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCapabilitiesSupports(t *testing.T) {
+	var decoded Capabilities
+	if err := json.Unmarshal([]byte(`{"protocolVersion":"2","supportsInterrupt":true,"supportsPartialMessages":false,"supportsNewThing":true}`), &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		caps       *Capabilities
+		capability Capability
+		want       bool
+	}{
+		{"nil supports everything", nil, CapabilitySetPermissionMode, true},
+		{"decoded true", &decoded, CapabilityInterrupt, true},
+		{"decoded false", &decoded, CapabilityPartialMessages, false},
+		{"decoded omitted", &decoded, CapabilityMcpSdkServers, false},
+		{"decoded unknown flag", &decoded, "supportsNewThing", true},
+		{"literal true", &Capabilities{SupportsSetPermissionMode: true}, CapabilitySetPermissionMode, true},
+		{"literal false", &Capabilities{SupportsSetPermissionMode: true}, CapabilityInterrupt, false},
+		{"literal set model", &Capabilities{SupportsSetModel: true}, CapabilitySetModel, true},
+		{"literal set partial messages", &Capabilities{SupportsSetPartialMessages: true}, CapabilitySetPartialMessages, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.caps.Supports(tt.capability); got != tt.want {
+				t.Errorf("Supports(%s) = %v, want %v", tt.capability, got, tt.want)
+			}
+		})
+	}
+
+	if decoded.ProtocolVersion != "2" || !decoded.SupportsInterrupt {
+		t.Errorf("known fields not decoded: %+v", decoded)
+	}
+}
+
+func TestCapabilitiesRequire(t *testing.T) {
+	caps := &Capabilities{SupportsInterrupt: true}
+	if err := caps.Require("Interrupt", CapabilityInterrupt); err != nil {
+		t.Errorf("Require for supported capability = %v", err)
+	}
+
+	err := caps.Require("SetPermissionMode", CapabilitySetPermissionMode)
+	if !IsUnsupportedFeatureError(err) || !errors.Is(err, &UnsupportedFeatureError{}) {
+		t.Fatalf("expected UnsupportedFeatureError, got %v", err)
+	}
+	want := "feature not supported by the Claude CLI: SetPermissionMode requires the supportsSetPermissionMode capability"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err, want)
+	}
+}
+
+func TestParseServerInfoCapabilities(t *testing.T) {
+	info, err := ParseServerInfo(map[string]interface{}{"output_style": "default"})
+	if err != nil {
+		t.Fatalf("ParseServerInfo failed: %v", err)
+	}
+	if info.Capabilities != nil {
+		t.Errorf("Capabilities = %+v, want nil when not reported", info.Capabilities)
+	}
+
+	info, err = ParseServerInfo(map[string]interface{}{
+		"capabilities": map[string]interface{}{"protocolVersion": "2", "supportsMcpSdkServers": true},
+	})
+	if err != nil {
+		t.Fatalf("ParseServerInfo failed: %v", err)
+	}
+	if !info.Capabilities.Supports(CapabilityMcpSdkServers) || info.Capabilities.Supports(CapabilityInterrupt) {
+		t.Errorf("unexpected capabilities: %+v", info.Capabilities)
+	}
+}
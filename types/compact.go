@@ -0,0 +1,61 @@
+package types
+
+import "encoding/json"
+
+// SystemSubtypeCompactBoundary is the subtype of the SystemMessage the CLI
+// sends when it compacts the conversation. Messages after it belong to a new
+// segment, whose context is the compaction summary rather than the messages
+// before the boundary.
+const SystemSubtypeCompactBoundary = "compact_boundary"
+
+// CompactBoundary describes a compaction reported by a compact_boundary
+// SystemMessage.
+type CompactBoundary struct {
+	Trigger   string `json:"trigger"`    // "manual" for /compact, "auto" when the context filled up
+	PreTokens int    `json:"pre_tokens"` // Tokens in the conversation before compaction
+}
+
+// CompactBoundary returns the compaction a compact_boundary message reports,
+// or nil if m is another kind of message. Fields the CLI leaves out are zero.
+func (m *SystemMessage) CompactBoundary() *CompactBoundary {
+	if m == nil || m.Type != MessageTypeSystem || m.Subtype != SystemSubtypeCompactBoundary {
+		return nil
+	}
+	boundary := &CompactBoundary{}
+	if data, err := json.Marshal(m.Data["compact_metadata"]); err == nil {
+		_ = json.Unmarshal(data, boundary)
+	}
+	return boundary
+}
+
+// IsCompactBoundary reports whether msg is a compact_boundary SystemMessage.
+func IsCompactBoundary(msg Message) bool {
+	sys, ok := msg.(*SystemMessage)
+	return ok && sys.CompactBoundary() != nil
+}
+
+// HistoryEntry is a message of a conversation with the segment it belongs
+// to. Segments are numbered from 0, and each compact boundary starts the
+// next one; the boundary message itself is the first of its segment.
+type HistoryEntry struct {
+	Segment int
+	Message Message
+}
+
+// SplitSegments splits messages at compact boundaries, returning the
+// messages of each segment in order. Each boundary message starts its
+// segment. It returns nil for no messages.
+func SplitSegments(messages []Message) [][]Message {
+	if len(messages) == 0 {
+		return nil
+	}
+	segments := [][]Message{nil}
+	for _, msg := range messages {
+		if IsCompactBoundary(msg) {
+			segments = append(segments, nil)
+		}
+		last := len(segments) - 1
+		segments[last] = append(segments[last], msg)
+	}
+	return segments
+}
@@ -0,0 +1,64 @@
+package types
+
+import "testing"
+
+func TestSystemMessageCompactBoundary(t *testing.T) {
+	msg, err := UnmarshalMessage([]byte(`{"type":"system","subtype":"compact_boundary","session_id":"s","compact_metadata":{"trigger":"manual","pre_tokens":9000}}`))
+	if err != nil {
+		t.Fatalf("UnmarshalMessage failed: %v", err)
+	}
+	boundary := msg.(*SystemMessage).CompactBoundary()
+	if boundary == nil || *boundary != (CompactBoundary{Trigger: "manual", PreTokens: 9000}) {
+		t.Errorf("CompactBoundary() = %+v, want a manual compaction of 9000 tokens", boundary)
+	}
+
+	// Metadata is optional
+	bare := &SystemMessage{Type: MessageTypeSystem, Subtype: SystemSubtypeCompactBoundary}
+	if boundary := bare.CompactBoundary(); boundary == nil || *boundary != (CompactBoundary{}) {
+		t.Errorf("CompactBoundary() of a bare boundary = %+v, want a zero CompactBoundary", boundary)
+	}
+
+	for _, other := range []*SystemMessage{
+		nil,
+		{Type: MessageTypeSystem, Subtype: "init"},
+		{Type: MessageTypeControlRequest, Subtype: SystemSubtypeCompactBoundary},
+	} {
+		if boundary := other.CompactBoundary(); boundary != nil {
+			t.Errorf("CompactBoundary() of %+v = %+v, want nil", other, boundary)
+		}
+	}
+}
+
+func TestSplitSegments(t *testing.T) {
+	boundary := func() Message {
+		return &SystemMessage{Type: MessageTypeSystem, Subtype: SystemSubtypeCompactBoundary}
+	}
+	first := NewUserMessageText("first")
+	answer := &AssistantMessage{Type: MessageTypeAssistant}
+	second := NewUserMessageText("second")
+	b1, b2 := boundary(), boundary()
+
+	segments := SplitSegments([]Message{first, answer, b1, second, b2})
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments, want 3", len(segments))
+	}
+	want := [][]Message{{first, answer}, {b1, second}, {b2}}
+	for i := range want {
+		if len(segments[i]) != len(want[i]) {
+			t.Fatalf("segment %d = %v, want %v", i, segments[i], want[i])
+		}
+		for j := range want[i] {
+			if segments[i][j] != want[i][j] {
+				t.Errorf("segment %d message %d = %v, want %v", i, j, segments[i][j], want[i][j])
+			}
+		}
+	}
+
+	// A leading boundary leaves segment 0 empty
+	if segments := SplitSegments([]Message{b1, second}); len(segments) != 2 || len(segments[0]) != 0 {
+		t.Errorf("SplitSegments with a leading boundary = %v, want an empty first segment", segments)
+	}
+	if segments := SplitSegments(nil); segments != nil {
+		t.Errorf("SplitSegments(nil) = %v, want nil", segments)
+	}
+}
@@ -1,6 +1,12 @@
 package types
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
 
 // PermissionMode represents the permission mode for Claude.
 type PermissionMode string
@@ -21,6 +27,46 @@ const (
 	PermissionBehaviorAsk   PermissionBehavior = "ask"
 )
 
+// PermissionPrecedence decides whether a PreToolUse hook's permissionDecision
+// or the CanUseTool callback settles a tool use when both are configured.
+// Either way, the CLI receives a single decision for each tool use.
+type PermissionPrecedence string
+
+const (
+	// PermissionPrecedenceHook (the default) makes an "allow" or "deny" from a
+	// PreToolUse hook final: CanUseTool is not called for that tool use, and a
+	// later permission request from the CLI is answered with the hook's
+	// decision. An "ask" decision, or none, leaves it to CanUseTool.
+	PermissionPrecedenceHook PermissionPrecedence = "hook"
+
+	// PermissionPrecedenceCallback makes CanUseTool the only source of
+	// permission decisions: permissionDecision is removed from PreToolUse hook
+	// output before it reaches the CLI. Without a CanUseTool callback, hook
+	// decisions are passed through unchanged, as are those of hooks whose
+	// HookMatcher is Enforced, such as the file jail of WithAllowedRoots and
+	// the hooks of WithToolInterceptor.
+	PermissionPrecedenceCallback PermissionPrecedence = "callback"
+)
+
+// CallbackPayloadPolicy decides how a hook or permission callback receives
+// the fields of an input larger than WithMaxCallbackPayloadBytes.
+type CallbackPayloadPolicy string
+
+const (
+	// CallbackPayloadTruncate (the default) decodes each oversized field with
+	// its strings cut short and its arrays cut off, each ending in
+	// TruncatedMarker, so the callback sees the usual types.
+	CallbackPayloadTruncate CallbackPayloadPolicy = "truncate"
+
+	// CallbackPayloadRaw leaves each oversized field undecoded, as a
+	// json.RawMessage the callback may decode if it needs to.
+	CallbackPayloadRaw CallbackPayloadPolicy = "raw"
+)
+
+// TruncatedMarker ends each string cut short, and each array cut off, under
+// CallbackPayloadTruncate.
+const TruncatedMarker = "...[truncated]"
+
 // PermissionUpdateDestination represents where permission updates should be saved.
 type PermissionUpdateDestination string
 
@@ -47,11 +93,44 @@ type PermissionUpdate struct {
 	Destination *PermissionUpdateDestination `json:"destination,omitempty"`
 }
 
+// PermissionResult is the result of a CanUseTool callback.
+// It is implemented by PermissionResultAllow and PermissionResultDeny, both as
+// values and as pointers, so callbacks may return either form.
+type PermissionResult interface {
+	// GetBehavior returns "allow" or "deny".
+	GetBehavior() string
+	isPermissionResult()
+}
+
+// Compile-time checks that both result types satisfy PermissionResult.
+var (
+	_ PermissionResult = PermissionResultAllow{}
+	_ PermissionResult = (*PermissionResultAllow)(nil)
+	_ PermissionResult = PermissionResultDeny{}
+	_ PermissionResult = (*PermissionResultDeny)(nil)
+)
+
 // PermissionResultAllow represents an allow permission result.
 type PermissionResultAllow struct {
 	Behavior           string                  `json:"behavior"` // "allow"
-	UpdatedInput       *map[string]interface{} `json:"updated_input,omitempty"`
-	UpdatedPermissions []PermissionUpdate      `json:"updated_permissions,omitempty"`
+	UpdatedInput       *map[string]interface{} `json:"updatedInput,omitempty"`
+	UpdatedPermissions []PermissionUpdate      `json:"updatedPermissions,omitempty"`
+}
+
+// GetBehavior returns the permission behavior, always "allow".
+func (r PermissionResultAllow) GetBehavior() string {
+	return string(PermissionBehaviorAllow)
+}
+
+func (r PermissionResultAllow) isPermissionResult() {}
+
+// MarshalJSON produces the wire format expected by the CLI. The behavior key is
+// always "allow" regardless of the Behavior field.
+func (r PermissionResultAllow) MarshalJSON() ([]byte, error) {
+	type Alias PermissionResultAllow
+	alias := Alias(r)
+	alias.Behavior = r.GetBehavior()
+	return json.Marshal(alias)
 }
 
 // PermissionResultDeny represents a deny permission result.
@@ -61,10 +140,59 @@ type PermissionResultDeny struct {
 	Interrupt bool   `json:"interrupt,omitempty"`
 }
 
+// GetBehavior returns the permission behavior, always "deny".
+func (r PermissionResultDeny) GetBehavior() string {
+	return string(PermissionBehaviorDeny)
+}
+
+func (r PermissionResultDeny) isPermissionResult() {}
+
+// MarshalJSON produces the wire format expected by the CLI. The behavior key is
+// always "deny" regardless of the Behavior field.
+func (r PermissionResultDeny) MarshalJSON() ([]byte, error) {
+	type Alias PermissionResultDeny
+	alias := Alias(r)
+	alias.Behavior = r.GetBehavior()
+	return json.Marshal(alias)
+}
+
 // ToolPermissionContext provides context for tool permission callbacks.
+//
+// ToolUseID, ParentToolUseID and BlockedPath are copied from the CLI's
+// can_use_tool request. All three are optional and empty when the CLI does
+// not send them.
 type ToolPermissionContext struct {
 	Signal      interface{}        `json:"signal,omitempty"` // Future: abort signal support
 	Suggestions []PermissionUpdate `json:"suggestions,omitempty"`
+
+	// ToolUseID is the ID of the ToolUseBlock asking for permission, for
+	// matching the request with the assistant message that carried it
+	ToolUseID string `json:"tool_use_id,omitempty"`
+
+	// ParentToolUseID is the ID of the Task tool use whose subagent made the
+	// call, as in the message's ParentToolUseID; empty for the main agent
+	ParentToolUseID string `json:"parent_tool_use_id,omitempty"`
+
+	// BlockedPath is the path outside the allowed directories that made the
+	// CLI ask, if that is why it did
+	BlockedPath string `json:"blocked_path,omitempty"`
+}
+
+// ErrPermissionDeferred is returned by a CanUseTool callback to leave the
+// permission request pending, for the application to answer later with
+// Client.ResolvePermission or Client.AbandonPermission.
+var ErrPermissionDeferred = errors.New("claude: permission decision deferred")
+
+// PendingPermission is a permission request from the CLI that has not been
+// answered yet, as listed by Client.PendingPermissions. Its CanUseTool
+// callback may still be running, or may have deferred the decision.
+type PendingPermission struct {
+	ID       string                 // Identifies the request to ResolvePermission and AbandonPermission
+	ToolName string                 // Tool asking for permission
+	Input    map[string]interface{} // Tool input, as the callback received it
+	Context  ToolPermissionContext  // Context the callback received
+	Received time.Time              // When the request arrived
+	Age      time.Duration          // How long it had been pending when listed
 }
 
 // HookEvent represents a hook event type.
@@ -77,6 +205,9 @@ const (
 	HookEventStop             HookEvent = "Stop"
 	HookEventSubagentStop     HookEvent = "SubagentStop"
 	HookEventPreCompact       HookEvent = "PreCompact"
+	HookEventNotification     HookEvent = "Notification"
+	HookEventSessionStart     HookEvent = "SessionStart"
+	HookEventSessionEnd       HookEvent = "SessionEnd"
 )
 
 // BaseHookInput contains common fields for all hook inputs.
@@ -95,6 +226,12 @@ type PreToolUseHookInput struct {
 	ToolInput     map[string]interface{} `json:"tool_input"`
 }
 
+// UnmarshalJSON accepts field names under either casing; see NormalizeHookFields.
+func (h *PreToolUseHookInput) UnmarshalJSON(data []byte) error {
+	type plain PreToolUseHookInput
+	return unmarshalHookInput(data, (*plain)(h))
+}
+
 // PostToolUseHookInput represents input for PostToolUse hook events.
 type PostToolUseHookInput struct {
 	BaseHookInput
@@ -104,6 +241,12 @@ type PostToolUseHookInput struct {
 	ToolResponse  interface{}            `json:"tool_response"`
 }
 
+// UnmarshalJSON accepts field names under either casing; see NormalizeHookFields.
+func (h *PostToolUseHookInput) UnmarshalJSON(data []byte) error {
+	type plain PostToolUseHookInput
+	return unmarshalHookInput(data, (*plain)(h))
+}
+
 // UserPromptSubmitHookInput represents input for UserPromptSubmit hook events.
 type UserPromptSubmitHookInput struct {
 	BaseHookInput
@@ -111,6 +254,12 @@ type UserPromptSubmitHookInput struct {
 	Prompt        string `json:"prompt"`
 }
 
+// UnmarshalJSON accepts field names under either casing; see NormalizeHookFields.
+func (h *UserPromptSubmitHookInput) UnmarshalJSON(data []byte) error {
+	type plain UserPromptSubmitHookInput
+	return unmarshalHookInput(data, (*plain)(h))
+}
+
 // StopHookInput represents input for Stop hook events.
 type StopHookInput struct {
 	BaseHookInput
@@ -118,6 +267,12 @@ type StopHookInput struct {
 	StopHookActive bool   `json:"stop_hook_active"`
 }
 
+// UnmarshalJSON accepts field names under either casing; see NormalizeHookFields.
+func (h *StopHookInput) UnmarshalJSON(data []byte) error {
+	type plain StopHookInput
+	return unmarshalHookInput(data, (*plain)(h))
+}
+
 // SubagentStopHookInput represents input for SubagentStop hook events.
 type SubagentStopHookInput struct {
 	BaseHookInput
@@ -125,6 +280,12 @@ type SubagentStopHookInput struct {
 	StopHookActive bool   `json:"stop_hook_active"`
 }
 
+// UnmarshalJSON accepts field names under either casing; see NormalizeHookFields.
+func (h *SubagentStopHookInput) UnmarshalJSON(data []byte) error {
+	type plain SubagentStopHookInput
+	return unmarshalHookInput(data, (*plain)(h))
+}
+
 // PreCompactHookInput represents input for PreCompact hook events.
 type PreCompactHookInput struct {
 	BaseHookInput
@@ -133,6 +294,127 @@ type PreCompactHookInput struct {
 	CustomInstructions *string `json:"custom_instructions,omitempty"`
 }
 
+// UnmarshalJSON accepts field names under either casing; see NormalizeHookFields.
+func (h *PreCompactHookInput) UnmarshalJSON(data []byte) error {
+	type plain PreCompactHookInput
+	return unmarshalHookInput(data, (*plain)(h))
+}
+
+// NotificationHookInput represents input for Notification hook events, fired
+// when the CLI wants the user's attention, such as to approve a tool.
+type NotificationHookInput struct {
+	BaseHookInput
+	HookEventName string  `json:"hook_event_name"` // "Notification"
+	Message       string  `json:"message"`
+	Title         *string `json:"title,omitempty"`
+}
+
+// UnmarshalJSON accepts field names under either casing; see NormalizeHookFields.
+func (h *NotificationHookInput) UnmarshalJSON(data []byte) error {
+	type plain NotificationHookInput
+	return unmarshalHookInput(data, (*plain)(h))
+}
+
+// SessionStartHookInput represents input for SessionStart hook events.
+type SessionStartHookInput struct {
+	BaseHookInput
+	HookEventName string `json:"hook_event_name"` // "SessionStart"
+	Source        string `json:"source"`          // "startup", "resume", "clear" or "compact"
+}
+
+// UnmarshalJSON accepts field names under either casing; see NormalizeHookFields.
+func (h *SessionStartHookInput) UnmarshalJSON(data []byte) error {
+	type plain SessionStartHookInput
+	return unmarshalHookInput(data, (*plain)(h))
+}
+
+// SessionEndHookInput represents input for SessionEnd hook events.
+type SessionEndHookInput struct {
+	BaseHookInput
+	HookEventName string `json:"hook_event_name"` // "SessionEnd"
+	Reason        string `json:"reason"`          // Such as "clear", "logout" or "prompt_input_exit"
+}
+
+// UnmarshalJSON accepts field names under either casing; see NormalizeHookFields.
+func (h *SessionEndHookInput) UnmarshalJSON(data []byte) error {
+	type plain SessionEndHookInput
+	return unmarshalHookInput(data, (*plain)(h))
+}
+
+// GenericHookInput is the input of a hook event this SDK has no type for,
+// passed through as the CLI sent it.
+type GenericHookInput struct {
+	BaseHookInput
+	HookEventName string                 `json:"hook_event_name"`
+	Fields        map[string]interface{} `json:"-"` // Every field of the input, common ones included
+}
+
+// ParseHookInput decodes the input of a hook callback into the type for its
+// hook_event_name, such as *PreToolUseHookInput or *NotificationHookInput.
+// Input of an event without a type, or with no event name, is returned as a
+// *GenericHookInput. The input may be the map a HookCallbackFunc receives
+// or raw JSON.
+func ParseHookInput(input interface{}) (interface{}, error) {
+	return ParseHookInputWithOptions(input, DecodeOptions{})
+}
+
+// ParseHookInputWithOptions is like ParseHookInput, warning through
+// opts.Logger the first time the input uses an alternate field name. The
+// other options do not apply to hook input.
+func ParseHookInputWithOptions(input interface{}, opts DecodeOptions) (interface{}, error) {
+	var data []byte
+	switch in := input.(type) {
+	case []byte:
+		data = in
+	case json.RawMessage:
+		data = in
+	default:
+		var err error
+		if data, err = json.Marshal(input); err != nil {
+			return nil, err
+		}
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fields = normalizeHookFields(fields, opts.Logger)
+	event, _ := fields["hook_event_name"].(string)
+
+	var typed interface{}
+	switch HookEvent(event) {
+	case HookEventPreToolUse:
+		typed = &PreToolUseHookInput{}
+	case HookEventPostToolUse:
+		typed = &PostToolUseHookInput{}
+	case HookEventUserPromptSubmit:
+		typed = &UserPromptSubmitHookInput{}
+	case HookEventStop:
+		typed = &StopHookInput{}
+	case HookEventSubagentStop:
+		typed = &SubagentStopHookInput{}
+	case HookEventPreCompact:
+		typed = &PreCompactHookInput{}
+	case HookEventNotification:
+		typed = &NotificationHookInput{}
+	case HookEventSessionStart:
+		typed = &SessionStartHookInput{}
+	case HookEventSessionEnd:
+		typed = &SessionEndHookInput{}
+	default:
+		generic := &GenericHookInput{HookEventName: event, Fields: fields}
+		if err := unmarshalHookInput(data, &generic.BaseHookInput); err != nil {
+			return nil, err
+		}
+		return generic, nil
+	}
+	if err := json.Unmarshal(data, typed); err != nil {
+		return nil, err
+	}
+	return typed, nil
+}
+
 // HookSpecificOutput is an interface for all hook-specific outputs.
 type HookSpecificOutput interface {
 	GetHookEventName() string
@@ -173,6 +455,17 @@ func (h *UserPromptSubmitHookSpecificOutput) GetHookEventName() string {
 	return h.HookEventName
 }
 
+// SessionStartHookSpecificOutput represents hook-specific output for SessionStart events.
+type SessionStartHookSpecificOutput struct {
+	HookEventName     string  `json:"hookEventName"` // "SessionStart"
+	AdditionalContext *string `json:"additionalContext,omitempty"`
+}
+
+// GetHookEventName returns the hook event name.
+func (h *SessionStartHookSpecificOutput) GetHookEventName() string {
+	return h.HookEventName
+}
+
 // AsyncHookJSONOutput represents async hook output that defers hook execution.
 type AsyncHookJSONOutput struct {
 	Async        bool `json:"async"`
@@ -191,13 +484,92 @@ type SyncHookJSONOutput struct {
 	SystemMessage *string `json:"systemMessage,omitempty"`
 	Reason        *string `json:"reason,omitempty"`
 
-	// Hook-specific outputs
+	// Hook-specific outputs: one of the *HookSpecificOutput structs, as a
+	// value or pointer, or a map[string]interface{} for other events
 	HookSpecificOutput interface{} `json:"hookSpecificOutput,omitempty"`
 }
 
+// MarshalJSON encodes the output, failing if HookSpecificOutput is neither a
+// known hook-specific output struct nor a map. A nil pointer is omitted.
+func (o SyncHookJSONOutput) MarshalJSON() ([]byte, error) {
+	type Alias SyncHookJSONOutput
+	alias := Alias(o)
+	switch out := o.HookSpecificOutput.(type) {
+	case nil, map[string]interface{},
+		PreToolUseHookSpecificOutput, PostToolUseHookSpecificOutput,
+		UserPromptSubmitHookSpecificOutput, SessionStartHookSpecificOutput:
+	case *PreToolUseHookSpecificOutput, *PostToolUseHookSpecificOutput,
+		*UserPromptSubmitHookSpecificOutput, *SessionStartHookSpecificOutput:
+		if reflect.ValueOf(out).IsNil() {
+			alias.HookSpecificOutput = nil
+		}
+	default:
+		return nil, fmt.Errorf("hookSpecificOutput must be a hook-specific output struct or map[string]interface{}, got %T", out)
+	}
+	return json.Marshal(alias)
+}
+
+// UnmarshalJSON decodes the output, decoding hookSpecificOutput into the
+// struct for its hookEventName, such as *PreToolUseHookSpecificOutput. Output
+// of an event without a struct is kept as a map[string]interface{}.
+func (o *SyncHookJSONOutput) UnmarshalJSON(data []byte) error {
+	type Alias SyncHookJSONOutput
+	var out Alias
+	aux := struct {
+		*Alias
+		HookSpecificOutput json.RawMessage `json:"hookSpecificOutput"`
+	}{Alias: &out}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	specific, err := unmarshalHookSpecificOutput(aux.HookSpecificOutput)
+	if err != nil {
+		return err
+	}
+	out.HookSpecificOutput = specific
+	*o = SyncHookJSONOutput(out)
+	return nil
+}
+
+// unmarshalHookSpecificOutput decodes a hookSpecificOutput object into the
+// struct for its hookEventName, or a map for other events.
+func unmarshalHookSpecificOutput(data json.RawMessage) (interface{}, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("hookSpecificOutput: %w", err)
+	}
+
+	event, _ := fields["hookEventName"].(string)
+	var typed interface{}
+	switch HookEvent(event) {
+	case HookEventPreToolUse:
+		typed = &PreToolUseHookSpecificOutput{}
+	case HookEventPostToolUse:
+		typed = &PostToolUseHookSpecificOutput{}
+	case HookEventUserPromptSubmit:
+		typed = &UserPromptSubmitHookSpecificOutput{}
+	case HookEventSessionStart:
+		typed = &SessionStartHookSpecificOutput{}
+	default:
+		return fields, nil
+	}
+	if err := json.Unmarshal(data, typed); err != nil {
+		return nil, fmt.Errorf("hookSpecificOutput: %w", err)
+	}
+	return typed, nil
+}
+
 // HookContext provides context information for hook callbacks.
 type HookContext struct {
 	Signal interface{} `json:"signal,omitempty"` // Future: abort signal support
+
+	// Input is the callback's input decoded with ParseHookInput, such as a
+	// *NotificationHookInput, or nil if it could not be decoded
+	Input interface{} `json:"-"`
 }
 
 // SDKControlInterruptRequest represents an interrupt request.
@@ -212,6 +584,8 @@ type SDKControlPermissionRequest struct {
 	Input                 map[string]interface{} `json:"input"`
 	PermissionSuggestions []PermissionUpdate     `json:"permission_suggestions,omitempty"`
 	BlockedPath           *string                `json:"blocked_path,omitempty"`
+	ToolUseID             *string                `json:"tool_use_id,omitempty"`
+	ParentToolUseID       *string                `json:"parent_tool_use_id,omitempty"`
 }
 
 // SDKControlInitializeRequest represents an initialization request.
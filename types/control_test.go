@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -76,6 +77,17 @@ func TestSDKControlPermissionRequest(t *testing.T) {
 	if decoded.ToolName != req.ToolName {
 		t.Errorf("tool name doesn't match")
 	}
+
+	// The optional IDs decode from the CLI's field names
+	wire := `{"subtype":"can_use_tool","tool_name":"Bash","input":{},"tool_use_id":"toolu_1","parent_tool_use_id":"toolu_task_1","blocked_path":"/etc"}`
+	if err := json.Unmarshal([]byte(wire), &decoded); err != nil {
+		t.Fatalf("failed to unmarshal SDKControlPermissionRequest: %v", err)
+	}
+	if decoded.ToolUseID == nil || *decoded.ToolUseID != "toolu_1" ||
+		decoded.ParentToolUseID == nil || *decoded.ParentToolUseID != "toolu_task_1" ||
+		decoded.BlockedPath == nil || *decoded.BlockedPath != "/etc" {
+		t.Errorf("decoded = %+v, want the tool use IDs and blocked path", decoded)
+	}
 }
 
 // TestHookEventConstants tests that hook event constants are defined correctly.
@@ -87,6 +99,9 @@ func TestHookEventConstants(t *testing.T) {
 		HookEventStop,
 		HookEventSubagentStop,
 		HookEventPreCompact,
+		HookEventNotification,
+		HookEventSessionStart,
+		HookEventSessionEnd,
 	}
 
 	for _, event := range events {
@@ -96,6 +111,69 @@ func TestHookEventConstants(t *testing.T) {
 	}
 }
 
+// TestParseHookInput tests decoding hook input by its event name.
+func TestParseHookInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input interface{}
+		want  interface{}
+	}{
+		{
+			name:  "PreToolUse",
+			input: map[string]interface{}{"hook_event_name": "PreToolUse", "tool_name": "Bash"},
+			want:  &PreToolUseHookInput{HookEventName: "PreToolUse", ToolName: "Bash"},
+		},
+		{
+			name:  "Notification",
+			input: map[string]interface{}{"session_id": "s1", "hook_event_name": "Notification", "message": "Claude is waiting for your input"},
+			want: &NotificationHookInput{
+				BaseHookInput: BaseHookInput{SessionID: "s1"},
+				HookEventName: "Notification",
+				Message:       "Claude is waiting for your input",
+			},
+		},
+		{
+			name:  "SessionStart from raw JSON",
+			input: []byte(`{"hookEventName":"SessionStart","source":"startup"}`),
+			want:  &SessionStartHookInput{HookEventName: "SessionStart", Source: "startup"},
+		},
+		{
+			name:  "SessionEnd",
+			input: map[string]interface{}{"hook_event_name": "SessionEnd", "reason": "logout"},
+			want:  &SessionEndHookInput{HookEventName: "SessionEnd", Reason: "logout"},
+		},
+		{
+			name:  "unknown event",
+			input: map[string]interface{}{"cwd": "/app", "hook_event_name": "PostCompact", "trigger": "auto"},
+			want: &GenericHookInput{
+				BaseHookInput: BaseHookInput{CWD: "/app"},
+				HookEventName: "PostCompact",
+				Fields:        map[string]interface{}{"cwd": "/app", "hook_event_name": "PostCompact", "trigger": "auto"},
+			},
+		},
+		{
+			name:  "no event name",
+			input: map[string]interface{}{"tool_name": "Bash"},
+			want:  &GenericHookInput{Fields: map[string]interface{}{"tool_name": "Bash"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHookInput(tt.input)
+			if err != nil {
+				t.Fatalf("ParseHookInput failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseHookInput() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseHookInput([]byte(`not json`)); err == nil {
+		t.Error("ParseHookInput accepted invalid JSON")
+	}
+}
+
 // TestPreToolUseHookInput tests JSON marshaling of PreToolUseHookInput.
 func TestPreToolUseHookInput(t *testing.T) {
 	input := &PreToolUseHookInput{
@@ -126,7 +204,165 @@ func TestPreToolUseHookInput(t *testing.T) {
 	}
 }
 
+// TestPermissionResultMarshaling tests the golden wire format of permission results.
+func TestPermissionResultMarshaling(t *testing.T) {
+	behavior := PermissionBehaviorAllow
+	destination := DestinationSession
+
+	tests := []struct {
+		name   string
+		result PermissionResult
+		want   string
+	}{
+		{
+			name: "allow with updated input",
+			result: PermissionResultAllow{
+				UpdatedInput: &map[string]interface{}{"command": "ls -la"},
+				UpdatedPermissions: []PermissionUpdate{
+					{
+						Type:        "addRules",
+						Rules:       []PermissionRuleValue{{ToolName: "Bash", RuleContent: stringPtr("ls:*")}},
+						Behavior:    &behavior,
+						Destination: &destination,
+					},
+				},
+			},
+			want: `{"behavior":"allow","updatedInput":{"command":"ls -la"},"updatedPermissions":[{"type":"addRules","rules":[{"toolName":"Bash","ruleContent":"ls:*"}],"behavior":"allow","destination":"session"}]}`,
+		},
+		{
+			name:   "allow pointer without input",
+			result: &PermissionResultAllow{Behavior: "allow"},
+			want:   `{"behavior":"allow"}`,
+		},
+		{
+			name:   "deny with interrupt",
+			result: PermissionResultDeny{Message: "not allowed", Interrupt: true},
+			want:   `{"behavior":"deny","message":"not allowed","interrupt":true}`,
+		},
+		{
+			name:   "deny ignores wrong behavior field",
+			result: &PermissionResultDeny{Behavior: "allow"},
+			want:   `{"behavior":"deny"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.result)
+			if err != nil {
+				t.Fatalf("failed to marshal permission result: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("marshal = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+// TestSyncHookJSONOutputRoundTrip tests that a stored hook output decodes
+// back into the typed hook-specific output for its event.
+func TestSyncHookJSONOutputRoundTrip(t *testing.T) {
+	block := "block"
+	tests := []struct {
+		name   string
+		output SyncHookJSONOutput
+		want   string
+	}{
+		{
+			name: "PreToolUse",
+			output: SyncHookJSONOutput{HookSpecificOutput: &PreToolUseHookSpecificOutput{
+				HookEventName:            "PreToolUse",
+				PermissionDecision:       stringPtr("deny"),
+				PermissionDecisionReason: stringPtr("no network"),
+				UpdatedInput:             &map[string]interface{}{"command": "ls -la"},
+			}},
+			want: `{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"deny","permissionDecisionReason":"no network","updatedInput":{"command":"ls -la"}}}`,
+		},
+		{
+			name: "PostToolUse",
+			output: SyncHookJSONOutput{Decision: &block, HookSpecificOutput: &PostToolUseHookSpecificOutput{
+				HookEventName:     "PostToolUse",
+				AdditionalContext: stringPtr("exit code 1"),
+			}},
+			want: `{"decision":"block","hookSpecificOutput":{"hookEventName":"PostToolUse","additionalContext":"exit code 1"}}`,
+		},
+		{
+			name: "UserPromptSubmit",
+			output: SyncHookJSONOutput{HookSpecificOutput: &UserPromptSubmitHookSpecificOutput{
+				HookEventName:     "UserPromptSubmit",
+				AdditionalContext: stringPtr("today is Tuesday"),
+			}},
+			want: `{"hookSpecificOutput":{"hookEventName":"UserPromptSubmit","additionalContext":"today is Tuesday"}}`,
+		},
+		{
+			name: "SessionStart",
+			output: SyncHookJSONOutput{HookSpecificOutput: &SessionStartHookSpecificOutput{
+				HookEventName:     "SessionStart",
+				AdditionalContext: stringPtr("on branch main"),
+			}},
+			want: `{"hookSpecificOutput":{"hookEventName":"SessionStart","additionalContext":"on branch main"}}`,
+		},
+		{
+			name: "unknown event kept raw",
+			output: SyncHookJSONOutput{HookSpecificOutput: map[string]interface{}{
+				"hookEventName": "FutureEvent",
+				"extra":         map[string]interface{}{"n": float64(1)},
+			}},
+			want: `{"hookSpecificOutput":{"extra":{"n":1},"hookEventName":"FutureEvent"}}`,
+		},
+		{
+			name:   "no hook-specific output",
+			output: SyncHookJSONOutput{Continue: boolPtr(false), StopReason: stringPtr("done")},
+			want:   `{"continue":false,"stopReason":"done"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.output)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal = %s, want %s", data, tt.want)
+			}
+
+			var decoded SyncHookJSONOutput
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.output) {
+				t.Errorf("Unmarshal = %#v, want %#v", decoded.HookSpecificOutput, tt.output.HookSpecificOutput)
+			}
+		})
+	}
+}
+
+// TestSyncHookJSONOutputMarshalValidates tests which hookSpecificOutput
+// values marshal.
+func TestSyncHookJSONOutputMarshalValidates(t *testing.T) {
+	data, err := json.Marshal(SyncHookJSONOutput{HookSpecificOutput: PreToolUseHookSpecificOutput{HookEventName: "PreToolUse"}})
+	if err != nil || string(data) != `{"hookSpecificOutput":{"hookEventName":"PreToolUse"}}` {
+		t.Errorf("Marshal of a value = %s, %v", data, err)
+	}
+	data, err = json.Marshal(SyncHookJSONOutput{HookSpecificOutput: (*PreToolUseHookSpecificOutput)(nil)})
+	if err != nil || string(data) != `{}` {
+		t.Errorf("Marshal of a nil pointer = %s, %v, want {}", data, err)
+	}
+	if _, err := json.Marshal(SyncHookJSONOutput{HookSpecificOutput: "deny"}); err == nil {
+		t.Error("Marshal of a string succeeded, want an error")
+	}
+	if _, err := json.Marshal(&SyncHookJSONOutput{HookSpecificOutput: struct{ Decision string }{"deny"}}); err == nil {
+		t.Error("Marshal of an unknown struct succeeded, want an error")
+	}
+}
+
 // Helper function to create a string pointer.
 func stringPtr(s string) *string {
 	return &s
 }
+
+// Helper function to create a bool pointer.
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"sort"
+	"sync"
+)
+
+// DeprecatedAPI describes an option builder method that has been renamed.
+// The old method is kept as a thin wrapper around Replacement so existing code
+// keeps compiling while users migrate.
+type DeprecatedAPI struct {
+	Name        string // Deprecated method name (e.g., "WithExtraArgs")
+	Replacement string // Method to use instead (e.g., "WithExtraCLIArgs")
+	Since       string // SDK version that deprecated the method
+}
+
+// DeprecationNotice records that a deprecated API was used at runtime.
+type DeprecationNotice struct {
+	DeprecatedAPI
+	Message string
+}
+
+// deprecatedAPIs is the single source of truth for renamed option methods.
+// It is consumed by the wrappers below and by tools/claudemigrate.
+var deprecatedAPIs = []DeprecatedAPI{
+	{Name: "WithExtraArgs", Replacement: "WithExtraCLIArgs", Since: "0.2.0"},
+	{Name: "WithExtraArg", Replacement: "WithExtraCLIArg", Since: "0.2.0"},
+	{Name: "WithMaxBufferSize", Replacement: "WithMaxMessageSize", Since: "0.2.0"},
+}
+
+var (
+	deprecationsMu sync.Mutex
+	deprecations   = make(map[string]DeprecationNotice)
+)
+
+// DeprecatedAPIs returns the table of deprecated option methods and their replacements.
+func DeprecatedAPIs() []DeprecatedAPI {
+	return append([]DeprecatedAPI(nil), deprecatedAPIs...)
+}
+
+// Deprecations returns the deprecation notices recorded so far in this process,
+// sorted by method name. Each deprecated API is recorded at most once.
+func Deprecations() []DeprecationNotice {
+	deprecationsMu.Lock()
+	defer deprecationsMu.Unlock()
+
+	notices := make([]DeprecationNotice, 0, len(deprecations))
+	for _, n := range deprecations {
+		notices = append(notices, n)
+	}
+	sort.Slice(notices, func(i, j int) bool {
+		return notices[i].Name < notices[j].Name
+	})
+	return notices
+}
+
+// recordDeprecation records a use of the named deprecated API.
+func recordDeprecation(name string) {
+	deprecationsMu.Lock()
+	defer deprecationsMu.Unlock()
+
+	if _, seen := deprecations[name]; seen {
+		return
+	}
+	for _, api := range deprecatedAPIs {
+		if api.Name == name {
+			deprecations[name] = DeprecationNotice{
+				DeprecatedAPI: api,
+				Message:       "ClaudeAgentOptions." + api.Name + " is deprecated since " + api.Since + "; use " + api.Replacement + " instead",
+			}
+			return
+		}
+	}
+}
+
+// resetDeprecations clears recorded notices. Used by tests.
+func resetDeprecations() {
+	deprecationsMu.Lock()
+	defer deprecationsMu.Unlock()
+	deprecations = make(map[string]DeprecationNotice)
+}
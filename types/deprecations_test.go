@@ -0,0 +1,96 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDeprecatedWrappersMatchReplacements tests that deprecated option methods
+// produce exactly the same options as their replacements.
+func TestDeprecatedWrappersMatchReplacements(t *testing.T) {
+	value := "json"
+
+	tests := []struct {
+		name       string
+		deprecated func(*ClaudeAgentOptions) *ClaudeAgentOptions
+		current    func(*ClaudeAgentOptions) *ClaudeAgentOptions
+	}{
+		{
+			name: "WithExtraArgs",
+			deprecated: func(o *ClaudeAgentOptions) *ClaudeAgentOptions {
+				return o.WithExtraArgs(map[string]*string{"debug": nil, "format": &value})
+			},
+			current: func(o *ClaudeAgentOptions) *ClaudeAgentOptions {
+				return o.WithExtraCLIArgs(map[string]*string{"debug": nil, "format": &value})
+			},
+		},
+		{
+			name: "WithExtraArg",
+			deprecated: func(o *ClaudeAgentOptions) *ClaudeAgentOptions {
+				return o.WithExtraArg("format", &value)
+			},
+			current: func(o *ClaudeAgentOptions) *ClaudeAgentOptions {
+				return o.WithExtraCLIArg("format", &value)
+			},
+		},
+		{
+			name: "WithMaxBufferSize",
+			deprecated: func(o *ClaudeAgentOptions) *ClaudeAgentOptions {
+				return o.WithMaxBufferSize(4096)
+			},
+			current: func(o *ClaudeAgentOptions) *ClaudeAgentOptions {
+				return o.WithMaxMessageSize(4096)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.deprecated(NewClaudeAgentOptions())
+			want := tt.current(NewClaudeAgentOptions())
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s produced %+v, want %+v", tt.name, got, want)
+			}
+		})
+	}
+}
+
+// TestDeprecationsRecorded tests that using a deprecated method records a notice once.
+func TestDeprecationsRecorded(t *testing.T) {
+	resetDeprecations()
+	defer resetDeprecations()
+
+	if got := Deprecations(); len(got) != 0 {
+		t.Fatalf("expected no deprecations, got %v", got)
+	}
+
+	NewClaudeAgentOptions().WithMaxBufferSize(1024).WithMaxBufferSize(2048)
+	NewClaudeAgentOptions().WithExtraArgs(nil)
+
+	notices := Deprecations()
+	if len(notices) != 2 {
+		t.Fatalf("expected 2 notices, got %d: %v", len(notices), notices)
+	}
+	if notices[0].Name != "WithExtraArgs" || notices[0].Replacement != "WithExtraCLIArgs" {
+		t.Errorf("unexpected first notice: %+v", notices[0])
+	}
+	if notices[1].Name != "WithMaxBufferSize" || notices[1].Replacement != "WithMaxMessageSize" {
+		t.Errorf("unexpected second notice: %+v", notices[1])
+	}
+	if notices[1].Message == "" {
+		t.Error("expected notice message to be set")
+	}
+}
+
+// TestDeprecatedAPIsHaveReplacements tests that every deprecated API names an existing replacement.
+func TestDeprecatedAPIsHaveReplacements(t *testing.T) {
+	optsType := reflect.TypeOf(&ClaudeAgentOptions{})
+	for _, api := range DeprecatedAPIs() {
+		if _, ok := optsType.MethodByName(api.Name); !ok {
+			t.Errorf("deprecated method %s does not exist", api.Name)
+		}
+		if _, ok := optsType.MethodByName(api.Replacement); !ok {
+			t.Errorf("replacement method %s does not exist", api.Replacement)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// maxScanDepth bounds the nesting scanTypeField follows, matching the limit
+// encoding/json applies.
+const maxScanDepth = 10000
+
+// typeKey is the discriminator field of messages and content blocks.
+var typeKey = []byte("type")
+
+// knownTypes holds the message and content block types, so that scanning
+// one does not allocate a copy of its name.
+var knownTypes = map[string]string{
+	MessageTypeUser:            MessageTypeUser,
+	MessageTypeAssistant:       MessageTypeAssistant,
+	MessageTypeSystem:          MessageTypeSystem,
+	MessageTypeResult:          MessageTypeResult,
+	MessageTypeStreamEvent:     MessageTypeStreamEvent,
+	MessageTypeControlRequest:  MessageTypeControlRequest,
+	MessageTypeControlResponse: MessageTypeControlResponse,
+	BlockTypeText:              BlockTypeText,
+	BlockTypeThinking:          BlockTypeThinking,
+	BlockTypeToolUse:           BlockTypeToolUse,
+	BlockTypeToolResult:        BlockTypeToolResult,
+	BlockTypeImage:             BlockTypeImage,
+}
+
+// discriminator returns the top-level "type" field of the JSON object in
+// data, or "" if it has none. The object is scanned once without decoding
+// its other fields; encoding/json is used only when the scan fails, so that
+// its error describes the problem.
+func discriminator(data []byte) (string, error) {
+	if typ, ok := scanTypeField(data); ok {
+		return typ, nil
+	}
+	var typeCheck struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &typeCheck); err != nil {
+		return "", err
+	}
+	return typeCheck.Type, nil
+}
+
+// scanTypeField validates that data is a single JSON object and returns its
+// "type" field. ok is false for invalid JSON and for anything the scan leaves
+// to encoding/json: a key with escapes or in another case, or a type that is
+// not a plain, valid UTF-8 string. Like encoding/json, the last "type" field wins.
+func scanTypeField(data []byte) (typ string, ok bool) {
+	s := typeScanner{data: data}
+	s.space()
+	if !s.consume('{') {
+		return "", false
+	}
+	s.space()
+	if s.consume('}') {
+		return "", s.end()
+	}
+	for {
+		s.space()
+		key, ok := s.str()
+		if !ok || bytes.IndexByte(key, '\\') >= 0 {
+			return "", false
+		}
+		s.space()
+		if !s.consume(':') {
+			return "", false
+		}
+		s.space()
+		if bytes.EqualFold(key, typeKey) {
+			if !bytes.Equal(key, typeKey) {
+				return "", false
+			}
+			value, ok := s.str()
+			if !ok || bytes.IndexByte(value, '\\') >= 0 || !utf8.Valid(value) {
+				return "", false
+			}
+			if known, ok := knownTypes[string(value)]; ok {
+				typ = known
+			} else {
+				typ = string(value)
+			}
+		} else if !s.value(1) {
+			return "", false
+		}
+		s.space()
+		if s.consume(',') {
+			continue
+		}
+		if s.consume('}') && s.end() {
+			return typ, true
+		}
+		return "", false
+	}
+}
+
+// typeScanner is a validating JSON scanner that skips values without
+// decoding them.
+type typeScanner struct {
+	data []byte
+	i    int
+}
+
+// space skips insignificant whitespace.
+func (s *typeScanner) space() {
+	for s.i < len(s.data) {
+		switch s.data[s.i] {
+		case ' ', '\t', '\n', '\r':
+			s.i++
+		default:
+			return
+		}
+	}
+}
+
+// consume skips c if it is the next byte.
+func (s *typeScanner) consume(c byte) bool {
+	if s.i < len(s.data) && s.data[s.i] == c {
+		s.i++
+		return true
+	}
+	return false
+}
+
+// end reports whether only whitespace remains.
+func (s *typeScanner) end() bool {
+	s.space()
+	return s.i == len(s.data)
+}
+
+// str scans a string and returns its contents without the quotes and with
+// escapes left as they are.
+func (s *typeScanner) str() ([]byte, bool) {
+	if !s.consume('"') {
+		return nil, false
+	}
+	start := s.i
+	for s.i < len(s.data) {
+		c := s.data[s.i]
+		switch {
+		case c == '"':
+			s.i++
+			return s.data[start : s.i-1], true
+		case c == '\\':
+			if !s.escape() {
+				return nil, false
+			}
+		case c < 0x20:
+			return nil, false
+		default:
+			s.i++
+		}
+	}
+	return nil, false
+}
+
+// escape scans a backslash escape.
+func (s *typeScanner) escape() bool {
+	s.i++
+	if s.i >= len(s.data) {
+		return false
+	}
+	switch s.data[s.i] {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		s.i++
+		return true
+	case 'u':
+		s.i++
+		for n := 0; n < 4; n++ {
+			if s.i >= len(s.data) || !isHex(s.data[s.i]) {
+				return false
+			}
+			s.i++
+		}
+		return true
+	}
+	return false
+}
+
+// value scans any JSON value at the given nesting depth.
+func (s *typeScanner) value(depth int) bool {
+	if s.i >= len(s.data) || depth > maxScanDepth {
+		return false
+	}
+	switch c := s.data[s.i]; {
+	case c == '"':
+		_, ok := s.str()
+		return ok
+	case c == '{':
+		return s.object(depth)
+	case c == '[':
+		return s.array(depth)
+	case c == 't':
+		return s.literal("true")
+	case c == 'f':
+		return s.literal("false")
+	case c == 'n':
+		return s.literal("null")
+	case c == '-' || (c >= '0' && c <= '9'):
+		return s.number()
+	}
+	return false
+}
+
+// object scans an object.
+func (s *typeScanner) object(depth int) bool {
+	s.i++
+	s.space()
+	if s.consume('}') {
+		return true
+	}
+	for {
+		s.space()
+		if _, ok := s.str(); !ok {
+			return false
+		}
+		s.space()
+		if !s.consume(':') {
+			return false
+		}
+		s.space()
+		if !s.value(depth + 1) {
+			return false
+		}
+		s.space()
+		if s.consume(',') {
+			continue
+		}
+		return s.consume('}')
+	}
+}
+
+// array scans an array.
+func (s *typeScanner) array(depth int) bool {
+	s.i++
+	s.space()
+	if s.consume(']') {
+		return true
+	}
+	for {
+		s.space()
+		if !s.value(depth + 1) {
+			return false
+		}
+		s.space()
+		if s.consume(',') {
+			continue
+		}
+		return s.consume(']')
+	}
+}
+
+// literal scans true, false or null.
+func (s *typeScanner) literal(word string) bool {
+	if !bytes.HasPrefix(s.data[s.i:], []byte(word)) {
+		return false
+	}
+	s.i += len(word)
+	return true
+}
+
+// number scans a number.
+func (s *typeScanner) number() bool {
+	s.consume('-')
+	switch {
+	case s.consume('0'):
+	case s.digits():
+	default:
+		return false
+	}
+	if s.consume('.') && !s.digits() {
+		return false
+	}
+	if s.consume('e') || s.consume('E') {
+		if !s.consume('+') {
+			s.consume('-')
+		}
+		if !s.digits() {
+			return false
+		}
+	}
+	return true
+}
+
+// digits scans one or more decimal digits.
+func (s *typeScanner) digits() bool {
+	start := s.i
+	for s.i < len(s.data) && s.data[s.i] >= '0' && s.data[s.i] <= '9' {
+		s.i++
+	}
+	return s.i > start
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
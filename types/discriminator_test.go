@@ -0,0 +1,99 @@
+package types
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// referenceType decodes the "type" field the way UnmarshalMessage used to.
+func referenceType(data []byte) (string, error) {
+	var typeCheck struct {
+		Type string `json:"type"`
+	}
+	err := json.Unmarshal(data, &typeCheck)
+	return typeCheck.Type, err
+}
+
+// TestScanTypeField tests the scan against encoding/json.
+func TestScanTypeField(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   string
+		wantOK bool
+	}{
+		{"type first", `{"type":"user","content":"hi"}`, "user", true},
+		{"type last", `{"content":[{"type":"text","text":"a"}],"type":"assistant"}`, "assistant", true},
+		{"nested type ignored", `{"message":{"type":"message"},"type":"assistant"}`, "assistant", true},
+		{"no type", `{"content":"hi"}`, "", true},
+		{"empty object", ` { } `, "", true},
+		{"last type wins", `{"type":"user","type":"result"}`, "result", true},
+		{"all value kinds", `{"a":[1,-2.5e+3,0,true,false,null,"é\n"],"b":{},"c":[],"type":"result"}`, "result", true},
+		{"invalid JSON", `{not json`, "", false},
+		{"trailing data", `{"type":"user"} x`, "", false},
+		{"trailing comma", `{"type":"user",}`, "", false},
+		{"bad nested value", `{"type":"user","x":[tru]}`, "", false},
+		{"leading zero", `{"x":01,"type":"user"}`, "", false},
+		{"bad escape", `{"x":"\q","type":"user"}`, "", false},
+		{"control character", "{\"x\":\"a\tb\",\"type\":\"user\"}", "", false},
+		{"key in other case", `{"Type":"user"}`, "", false},
+		{"escaped key", `{"\u0074ype":"user"}`, "", false},
+		{"escaped type", `{"type":"\u0075ser"}`, "", false},
+		{"invalid UTF-8 type", "{\"type\":\"\x83\"}", "", false},
+		{"type is a number", `{"type":1}`, "", false},
+		{"type is null", `{"type":null}`, "", false},
+		{"not an object", `[]`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := scanTypeField([]byte(tt.input))
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("scanTypeField(%s) = %q, %v, want %q, %v", tt.input, got, ok, tt.want, tt.wantOK)
+			}
+
+			// discriminator must agree with encoding/json either way
+			want, wantErr := referenceType([]byte(tt.input))
+			got, err := discriminator([]byte(tt.input))
+			if got != want || (err != nil) != (wantErr != nil) {
+				t.Errorf("discriminator(%s) = %q, %v, want %q, %v", tt.input, got, err, want, wantErr)
+			}
+		})
+	}
+}
+
+// TestScanTypeFieldDepth tests that deeply nested input is left to encoding/json.
+func TestScanTypeFieldDepth(t *testing.T) {
+	deep := `{"x":` + strings.Repeat("[", maxScanDepth+1) + strings.Repeat("]", maxScanDepth+1) + `,"type":"user"}`
+	if _, ok := scanTypeField([]byte(deep)); ok {
+		t.Error("expected the scan to give up on deeply nested input")
+	}
+}
+
+// FuzzDiscriminator checks that the scan never disagrees with encoding/json.
+func FuzzDiscriminator(f *testing.F) {
+	for _, seed := range []string{
+		`{"type":"user","content":"hi"}`,
+		`{"a":[1,-2.5e+3,0,true,false,null,"é"],"b":{},"type":"result"}`,
+		`{"Type":"user"}`,
+		`{"type":"a","type":"b"}`,
+		`{"x":01}`,
+		`null`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		got, ok := scanTypeField(data)
+		if !ok {
+			return
+		}
+		if !json.Valid(data) {
+			t.Fatalf("scan accepted invalid JSON %q", data)
+		}
+		want, err := referenceType(data)
+		if err != nil || got != want {
+			t.Fatalf("scan found %q in %q, encoding/json %q (%v)", got, data, want, err)
+		}
+	})
+}
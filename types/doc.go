@@ -12,30 +12,49 @@
 //   - SystemMessage: System notifications and metadata
 //   - ResultMessage: Final result with cost/usage info
 //   - StreamEvent: Partial message updates during streaming
+//   - UnknownMessage: A message type added by a newer CLI, with lenient parsing
 //
 // Example:
 //
 //	for msg := range messages {
 //	    switch m := msg.(type) {
 //	    case *types.AssistantMessage:
-//	        for _, block := range m.Content {
-//	            if tb, ok := block.(*types.TextBlock); ok {
-//	                fmt.Println("Claude:", tb.Text)
-//	            }
+//	        fmt.Println("Claude:", m.Text())
+//	        for _, tu := range m.ToolUses() {
+//	            fmt.Println("Calling", tu.Name)
 //	        }
 //	    case *types.ResultMessage:
 //	        fmt.Printf("Done. Cost: $%.4f\n", *m.TotalCostUSD)
+//	        for _, d := range m.PermissionDenials {
+//	            fmt.Printf("Denied: %s (%s)\n", d.ToolName, d.ToolUseID)
+//	        }
 //	    }
 //	}
 //
 // # Content Blocks
 //
-// Content blocks represent different types of content in messages:
+// Content blocks represent different types of content in messages. Prompts
+// can be built from them with Client.QueryWithContent:
 //
 //   - TextBlock: Plain text content
 //   - ThinkingBlock: Claude's internal reasoning
 //   - ToolUseBlock: Tool invocation requests
 //   - ToolResultBlock: Results from tool execution
+//   - ImageBlock: Base64-encoded image, usually sent in a prompt
+//
+// AssistantMessage has accessors for its content: Text joins its text
+// blocks, and ToolUses, Thinking and HasToolUse pick out the other blocks.
+//
+// A ToolResultBlock's content is a string or a list of parts; its Text and
+// Parts methods (returning ToolResultPart values) read either form.
+//
+// # Stream Events
+//
+// With partial messages enabled, StreamEvent carries raw API streaming events.
+// StreamEvent.Decode returns them typed: MessageStartEvent,
+// ContentBlockStartEvent, ContentBlockDeltaEvent (whose Delta is a TextDelta,
+// InputJSONDelta, ThinkingDelta, or SignatureDelta), ContentBlockStopEvent,
+// MessageDeltaEvent, and MessageStopEvent, with RawEvent for anything else.
 //
 // # Error Types
 //
@@ -48,6 +67,21 @@
 //   - MessageParseError: Valid JSON but invalid message structure
 //   - ControlProtocolError: Control protocol violations
 //   - PermissionDeniedError: Permission request denied
+//   - WorkingDirectoryError: Configured working directory is missing or invalid
+//   - InputClosedError: Write attempted after input was closed with EndInput
+//   - SubagentError: Subagent launched with RunSubagent failed or was not invoked
+//   - BudgetExceededError: Session cost exceeded the WithMaxCostUSD limit
+//   - TransportBrokenError: CLI closed its output but kept running
+//   - UnsupportedCLIVersionError: CLI is older than the WithMinCLIVersion minimum
+//   - PromptTooLargeError: Prompt's estimated size exceeds the WithMaxPromptTokens limit
+//   - UnsupportedFeatureError: CLI did not report a capability the feature needs
+//   - IdleTimeoutError: CLI produced no output for longer than the WithIdleTimeout limit
+//   - TooManyProcessesError: Subprocess limit from SetMaxSubprocesses reached under SubprocessWaitFail
+//   - WarmupError: A Pool's WarmupFunc failed for a newly connected client
+//   - UnsafeWorkingDirectoryError: Working directory or added directory outside the WithAllowedRoots roots
+//   - TurnInProgressError: Prompt sent while a QueryWithOptions turn is still running
+//   - MessageLimitError: Line of CLI output over the WithMaxMessageSize or WithMaxMessageDepth limit
+//   - HandshakeError: CLI's first line of output was not JSON
 //
 // Use the Is* helper functions for error checking:
 //
@@ -55,6 +89,9 @@
 //	    log.Fatal("Please install Claude Code CLI: npm install -g @anthropic-ai/claude-code")
 //	}
 //
+// IsRetryable reports whether an error is a transient failure to start the
+// CLI, the kind WithRetry retries.
+//
 // # Configuration
 //
 // ClaudeAgentOptions provides a fluent builder API for configuration:
@@ -63,7 +100,7 @@
 //	    WithModel("claude-3-5-sonnet-latest").
 //	    WithAllowedTools("Bash", "Write", "Read").
 //	    WithPermissionMode(types.PermissionModeAcceptEdits).
-//	    WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx ToolPermissionContext) (interface{}, error) {
+//	    WithCanUseTool(func(ctx context.Context, toolName string, input map[string]interface{}, permCtx ToolPermissionContext) (PermissionResult, error) {
 //	        // Custom permission logic
 //	        return &PermissionResultAllow{Behavior: "allow"}, nil
 //	    })
@@ -72,7 +109,8 @@
 //
 // The control protocol enables bidirectional communication with the CLI:
 //
-//   - Permission callbacks: Control which tools Claude can use
+//   - Permission callbacks: Control which tools Claude can use, or declare
+//     rules with PermissionPolicy
 //   - Hook system: React to lifecycle events (PreToolUse, PostToolUse, etc.)
 //   - MCP servers: Define custom tools via Model Context Protocol
 //
@@ -86,15 +124,22 @@
 //   - HookEventStop: When session stops
 //   - HookEventSubagentStop: When a subagent stops
 //   - HookEventPreCompact: Before context compaction
+//   - HookEventNotification: When the CLI wants the user's attention
+//   - HookEventSessionStart: When a session starts or resumes
+//   - HookEventSessionEnd: When a session ends
+//
+// Callbacks receive their input as a map; HookContext.Input holds it decoded
+// by ParseHookInput, such as a *NotificationHookInput, with a
+// *GenericHookInput for events the SDK has no type for.
 //
 // Example hook:
 //
 //	opts.WithHook(types.HookEventPreToolUse, types.HookMatcher{
 //	    Hooks: []types.HookCallbackFunc{
 //	        func(ctx context.Context, input interface{}, toolUseID *string, hookCtx types.HookContext) (interface{}, error) {
-//	            preToolInput := input.(*types.PreToolUseHookInput)
+//	            preToolInput := hookCtx.Input.(*types.PreToolUseHookInput)
 //	            log.Printf("Tool %s about to execute", preToolInput.ToolName)
-//	            return &types.SyncHookJSONOutput{}, nil
+//	            return map[string]interface{}{}, nil
 //	        },
 //	    },
 //	})
@@ -1,8 +1,14 @@
 package types
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/strutil"
 )
 
 // CLINotFoundError indicates that the Claude Code CLI binary could not be found.
@@ -10,6 +16,10 @@ import (
 type CLINotFoundError struct {
 	Message string
 	Cause   error
+
+	// Searched lists the paths checked during CLI discovery, in order. It is
+	// empty when the error did not come from discovery.
+	Searched []string
 }
 
 // Error returns the error message, implementing the error interface.
@@ -84,6 +94,7 @@ type ProcessError struct {
 	Message  string
 	ExitCode int
 	Cause    error
+	Stderr   string // Last lines the CLI wrote to stderr, if any, newline-separated
 }
 
 // Error returns the error message, implementing the error interface.
@@ -124,26 +135,29 @@ func NewProcessErrorWithCause(message string, cause error) *ProcessError {
 	return &ProcessError{Message: message, Cause: cause}
 }
 
+// ErrorSnippetLen is the most bytes of the offending data kept in the
+// Snippet of a JSONDecodeError or MessageParseError.
+const ErrorSnippetLen = 200
+
 // JSONDecodeError indicates a failure to parse JSON data from the CLI.
 // This can occur when the CLI sends malformed JSON or when the JSON structure
 // doesn't match the expected schema.
 type JSONDecodeError struct {
 	Message string
 	Raw     string // The raw JSON that failed to parse
+	Snippet string // Raw truncated to ErrorSnippetLen bytes, for logs
+	Line    int    // 1-based line of the CLI's output the data was read from, or 0 if unknown
+	Offset  int64  // Byte offset in Raw where decoding failed, or 0 if unknown
 	Cause   error
 }
 
 // Error returns the error message, implementing the error interface.
 func (e *JSONDecodeError) Error() string {
-	msg := e.Message
-	if e.Raw != "" {
-		// Truncate raw data if too long
-		rawSnippet := e.Raw
-		if len(rawSnippet) > 100 {
-			rawSnippet = rawSnippet[:100] + "..."
-		}
-		msg = fmt.Sprintf("%s (raw: %s)", msg, rawSnippet)
+	snippet := e.Snippet
+	if snippet == "" && e.Raw != "" {
+		snippet = strutil.TruncateJSON(e.Raw, ErrorSnippetLen)
 	}
+	msg := e.Message + errorLocation(e.Line, e.Offset, snippet)
 	if e.Cause != nil {
 		msg = msg + ": " + e.Cause.Error()
 	}
@@ -168,12 +182,13 @@ func NewJSONDecodeError(message string) *JSONDecodeError {
 
 // NewJSONDecodeErrorWithRaw creates a new JSONDecodeError with the given message and raw JSON.
 func NewJSONDecodeErrorWithRaw(message string, raw string) *JSONDecodeError {
-	return &JSONDecodeError{Message: message, Raw: raw}
+	return &JSONDecodeError{Message: message, Raw: raw, Snippet: errorSnippet(raw)}
 }
 
 // NewJSONDecodeErrorWithCause creates a new JSONDecodeError with the given message, raw JSON, and cause.
+// Offset is taken from a *json.SyntaxError or *json.UnmarshalTypeError cause.
 func NewJSONDecodeErrorWithCause(message string, raw string, cause error) *JSONDecodeError {
-	return &JSONDecodeError{Message: message, Raw: raw, Cause: cause}
+	return &JSONDecodeError{Message: message, Raw: raw, Snippet: errorSnippet(raw), Offset: decodeOffset(cause), Cause: cause}
 }
 
 // MessageParseError indicates a failure to parse a message from the CLI.
@@ -182,6 +197,9 @@ func NewJSONDecodeErrorWithCause(message string, raw string, cause error) *JSOND
 type MessageParseError struct {
 	Message     string
 	MessageType string // The type of message that failed to parse
+	Snippet     string // The offending data truncated to ErrorSnippetLen bytes, if known
+	Line        int    // 1-based line of the CLI's output the data was read from, or 0 if unknown
+	Offset      int64  // Byte offset in the data where decoding failed, or 0 if unknown
 	Cause       error
 }
 
@@ -191,6 +209,7 @@ func (e *MessageParseError) Error() string {
 	if e.MessageType != "" {
 		msg = fmt.Sprintf("%s (type: %s)", msg, e.MessageType)
 	}
+	msg += errorLocation(e.Line, e.Offset, e.Snippet)
 	if e.Cause != nil {
 		msg = msg + ": " + e.Cause.Error()
 	}
@@ -218,9 +237,128 @@ func NewMessageParseErrorWithType(message string, messageType string) *MessagePa
 	return &MessageParseError{Message: message, MessageType: messageType}
 }
 
+// NewMessageParseErrorWithRaw creates a new MessageParseError with the given message, message type, and offending data.
+func NewMessageParseErrorWithRaw(message string, messageType string, raw string) *MessageParseError {
+	return &MessageParseError{Message: message, MessageType: messageType, Snippet: errorSnippet(raw)}
+}
+
 // NewMessageParseErrorWithCause creates a new MessageParseError with the given message, message type, and cause.
+// Offset is taken from a *json.SyntaxError or *json.UnmarshalTypeError cause.
 func NewMessageParseErrorWithCause(message string, messageType string, cause error) *MessageParseError {
-	return &MessageParseError{Message: message, MessageType: messageType, Cause: cause}
+	return &MessageParseError{Message: message, MessageType: messageType, Offset: decodeOffset(cause), Cause: cause}
+}
+
+// errorSnippet truncates raw data for the Snippet of a decode error.
+func errorSnippet(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	return strutil.TruncateJSON(raw, ErrorSnippetLen)
+}
+
+// decodeOffset returns the byte offset reported by a JSON decoding error.
+// Offsets from a nested decode error describe other data and are ignored.
+func decodeOffset(err error) int64 {
+	var nested *JSONDecodeError
+	if errors.As(err, &nested) {
+		return 0
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Offset
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Offset
+	}
+	return 0
+}
+
+// errorLocation formats the line, offset and snippet of a decode error as a
+// parenthesized suffix, or "" if none is known.
+func errorLocation(line int, offset int64, snippet string) string {
+	var parts []string
+	if line > 0 {
+		parts = append(parts, fmt.Sprintf("line %d", line))
+	}
+	if offset > 0 {
+		parts = append(parts, fmt.Sprintf("offset %d", offset))
+	}
+	if snippet != "" {
+		parts = append(parts, "raw: "+snippet)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// MessageLimit names a limit on the lines of CLI output.
+type MessageLimit string
+
+const (
+	MessageLimitSize  MessageLimit = "size"  // WithMaxMessageSize, in bytes
+	MessageLimitDepth MessageLimit = "depth" // WithMaxMessageDepth, in levels of nesting
+)
+
+// MessageLimitError indicates a line of CLI output that was rejected without
+// being decoded because it exceeds WithMaxMessageSize or WithMaxMessageDepth.
+type MessageLimitError struct {
+	Limit   MessageLimit
+	Max     int    // The limit in effect
+	Line    int    // 1-based line of CLI output, 0 if unknown
+	Snippet string // Start of the line, up to ErrorSnippetLen bytes
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *MessageLimitError) Error() string {
+	unit := "bytes"
+	if e.Limit == MessageLimitDepth {
+		unit = "levels"
+	}
+	return fmt.Sprintf("CLI output exceeds the maximum message %s of %d %s", e.Limit, e.Max, unit) +
+		errorLocation(e.Line, 0, e.Snippet)
+}
+
+// Is checks if the target error is a MessageLimitError.
+func (e *MessageLimitError) Is(target error) bool {
+	_, ok := target.(*MessageLimitError)
+	return ok
+}
+
+// NewMessageLimitError creates a new MessageLimitError for a line exceeding
+// limit, keeping a snippet of raw, which may be empty.
+func NewMessageLimitError(limit MessageLimit, max int, raw string) *MessageLimitError {
+	return &MessageLimitError{Limit: limit, Max: max, Snippet: errorSnippet(raw)}
+}
+
+// OutboundTooLargeError indicates a line for the CLI's input, such as a prompt
+// or the response to a control request, that was not written because it
+// exceeds WithMaxOutboundSize. The transport remains usable. Rather than
+// raising the limit, which the CLI may not accept, return large tool results
+// in pages or write them to a file and return its path.
+type OutboundTooLargeError struct {
+	Size    int    // Bytes in the line, without its newline
+	Max     int    // The limit in effect
+	Snippet string // Start of the line, up to ErrorSnippetLen bytes
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *OutboundTooLargeError) Error() string {
+	return fmt.Sprintf("message to the CLI is %d bytes, over the maximum of %d bytes; send large tool results in pages or as a file path",
+		e.Size, e.Max) + errorLocation(0, 0, e.Snippet)
+}
+
+// Is checks if the target error is an OutboundTooLargeError.
+func (e *OutboundTooLargeError) Is(target error) bool {
+	_, ok := target.(*OutboundTooLargeError)
+	return ok
+}
+
+// NewOutboundTooLargeError creates a new OutboundTooLargeError for line,
+// which is over max bytes.
+func NewOutboundTooLargeError(line string, max int) *OutboundTooLargeError {
+	return &OutboundTooLargeError{Size: len(line), Max: max, Snippet: errorSnippet(line)}
 }
 
 // ControlProtocolError indicates a violation of the control protocol between
@@ -228,6 +366,7 @@ func NewMessageParseErrorWithCause(message string, messageType string, cause err
 // control messages, or protocol version mismatches.
 type ControlProtocolError struct {
 	Message string
+	Field   string // Offending field of a rejected control response, if any (e.g. "hookSpecificOutput.permissionDecision")
 	Cause   error
 }
 
@@ -316,6 +455,431 @@ func NewPermissionDeniedErrorWithCause(message string, cause error) *PermissionD
 	return &PermissionDeniedError{Message: message, Cause: cause}
 }
 
+// WorkingDirectoryError indicates that the configured working directory is unusable.
+// This occurs when the directory does not exist, is not a directory, or cannot be created.
+type WorkingDirectoryError struct {
+	Message string
+	Path    string // The resolved path that failed validation
+	Cause   error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *WorkingDirectoryError) Error() string {
+	msg := e.Message
+	if e.Path != "" {
+		msg = fmt.Sprintf("%s (path: %s)", msg, e.Path)
+	}
+	if e.Cause != nil {
+		msg = msg + ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is checks if the target error is a WorkingDirectoryError.
+func (e *WorkingDirectoryError) Is(target error) bool {
+	_, ok := target.(*WorkingDirectoryError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *WorkingDirectoryError) Unwrap() error {
+	return e.Cause
+}
+
+// NewWorkingDirectoryError creates a new WorkingDirectoryError with the given message and path.
+func NewWorkingDirectoryError(message string, path string) *WorkingDirectoryError {
+	return &WorkingDirectoryError{Message: message, Path: path}
+}
+
+// NewWorkingDirectoryErrorWithCause creates a new WorkingDirectoryError with the given message, path, and cause.
+func NewWorkingDirectoryErrorWithCause(message string, path string, cause error) *WorkingDirectoryError {
+	return &WorkingDirectoryError{Message: message, Path: path, Cause: cause}
+}
+
+// InputClosedError indicates a write after the transport's input was closed with EndInput.
+type InputClosedError struct {
+	Message string
+	Cause   error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *InputClosedError) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+// Is checks if the target error is an InputClosedError.
+func (e *InputClosedError) Is(target error) bool {
+	_, ok := target.(*InputClosedError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *InputClosedError) Unwrap() error {
+	return e.Cause
+}
+
+// NewInputClosedError creates a new InputClosedError with the given message.
+func NewInputClosedError(message string) *InputClosedError {
+	return &InputClosedError{Message: message}
+}
+
+// NewInputClosedErrorWithCause creates a new InputClosedError with the given message and cause.
+func NewInputClosedErrorWithCause(message string, cause error) *InputClosedError {
+	return &InputClosedError{Message: message, Cause: cause}
+}
+
+// TurnInProgressError indicates a prompt sent while a turn started by
+// Client.QueryWithOptions is still running with its overrides.
+type TurnInProgressError struct {
+	Message string
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *TurnInProgressError) Error() string {
+	return e.Message
+}
+
+// Is checks if the target error is a TurnInProgressError.
+func (e *TurnInProgressError) Is(target error) bool {
+	_, ok := target.(*TurnInProgressError)
+	return ok
+}
+
+// NewTurnInProgressError creates a new TurnInProgressError with the given message.
+func NewTurnInProgressError(message string) *TurnInProgressError {
+	return &TurnInProgressError{Message: message}
+}
+
+// PermissionNotPendingError indicates that Client.ResolvePermission or
+// Client.AbandonPermission was given a permission request that is not
+// pending: it was answered already, by its callback or otherwise, or never
+// existed.
+type PermissionNotPendingError struct {
+	Message string
+	ID      string // The permission request ID
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *PermissionNotPendingError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Message, e.ID)
+}
+
+// Is checks if the target error is a PermissionNotPendingError.
+func (e *PermissionNotPendingError) Is(target error) bool {
+	_, ok := target.(*PermissionNotPendingError)
+	return ok
+}
+
+// NewPermissionNotPendingError creates a new PermissionNotPendingError for the request ID.
+func NewPermissionNotPendingError(id string) *PermissionNotPendingError {
+	return &PermissionNotPendingError{Message: "permission request is not pending", ID: id}
+}
+
+// SubagentError indicates that a subagent launched with RunSubagent failed or was not invoked.
+type SubagentError struct {
+	Message   string
+	AgentName string // Name of the subagent
+	Cause     error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *SubagentError) Error() string {
+	msg := e.Message
+	if e.AgentName != "" {
+		msg = fmt.Sprintf("%s (agent: %s)", msg, e.AgentName)
+	}
+	if e.Cause != nil {
+		msg = msg + ": " + e.Cause.Error()
+	}
+	return msg
+}
+
+// Is checks if the target error is a SubagentError.
+func (e *SubagentError) Is(target error) bool {
+	_, ok := target.(*SubagentError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *SubagentError) Unwrap() error {
+	return e.Cause
+}
+
+// NewSubagentError creates a new SubagentError with the given message and agent name.
+func NewSubagentError(message string, agentName string) *SubagentError {
+	return &SubagentError{Message: message, AgentName: agentName}
+}
+
+// NewSubagentErrorWithCause creates a new SubagentError with the given message, agent name, and cause.
+func NewSubagentErrorWithCause(message string, agentName string, cause error) *SubagentError {
+	return &SubagentError{Message: message, AgentName: agentName, Cause: cause}
+}
+
+// BudgetExceededError indicates that the session cost exceeded the limit set with WithMaxCostUSD.
+type BudgetExceededError struct {
+	Message  string
+	LimitUSD float64 // The configured cost ceiling
+	SpentUSD float64 // The session cost reported by the CLI
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("%s (spent $%.4f of $%.4f)", e.Message, e.SpentUSD, e.LimitUSD)
+}
+
+// Is checks if the target error is a BudgetExceededError.
+func (e *BudgetExceededError) Is(target error) bool {
+	_, ok := target.(*BudgetExceededError)
+	return ok
+}
+
+// NewBudgetExceededError creates a new BudgetExceededError with the given limit and spend.
+func NewBudgetExceededError(limitUSD, spentUSD float64) *BudgetExceededError {
+	return &BudgetExceededError{Message: "session cost budget exceeded", LimitUSD: limitUSD, SpentUSD: spentUSD}
+}
+
+// TransportBrokenError indicates that the connection to the CLI is unusable even
+// though the process may still be running, for example when the CLI closed its
+// stdout but did not exit.
+type TransportBrokenError struct {
+	Message string
+	Cause   error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *TransportBrokenError) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+// Is checks if the target error is a TransportBrokenError.
+func (e *TransportBrokenError) Is(target error) bool {
+	_, ok := target.(*TransportBrokenError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *TransportBrokenError) Unwrap() error {
+	return e.Cause
+}
+
+// NewTransportBrokenError creates a new TransportBrokenError with the given message.
+func NewTransportBrokenError(message string) *TransportBrokenError {
+	return &TransportBrokenError{Message: message}
+}
+
+// NewTransportBrokenErrorWithCause creates a new TransportBrokenError with the given message and cause.
+func NewTransportBrokenErrorWithCause(message string, cause error) *TransportBrokenError {
+	return &TransportBrokenError{Message: message, Cause: cause}
+}
+
+// UnsupportedCLIVersionError indicates that the detected CLI is older than the
+// minimum version set with WithMinCLIVersion.
+type UnsupportedCLIVersionError struct {
+	Message    string
+	Version    string // The detected CLI version
+	MinVersion string // The configured minimum version
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *UnsupportedCLIVersionError) Error() string {
+	return fmt.Sprintf("%s (found %s, need %s or newer)", e.Message, e.Version, e.MinVersion)
+}
+
+// Is checks if the target error is an UnsupportedCLIVersionError.
+func (e *UnsupportedCLIVersionError) Is(target error) bool {
+	_, ok := target.(*UnsupportedCLIVersionError)
+	return ok
+}
+
+// NewUnsupportedCLIVersionError creates a new UnsupportedCLIVersionError for the detected and minimum versions.
+func NewUnsupportedCLIVersionError(version, minVersion string) *UnsupportedCLIVersionError {
+	return &UnsupportedCLIVersionError{Message: "Claude CLI version is not supported", Version: version, MinVersion: minVersion}
+}
+
+// PromptTooLargeError indicates that a prompt's estimated token count exceeds
+// the limit set with WithMaxPromptTokens. It is returned before anything is
+// sent to the CLI.
+type PromptTooLargeError struct {
+	Message         string
+	EstimatedTokens int // Approximate prompt size from EstimateTokensForModel
+	MaxTokens       int // The configured limit
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *PromptTooLargeError) Error() string {
+	return fmt.Sprintf("%s (estimated %d tokens, limit %d)", e.Message, e.EstimatedTokens, e.MaxTokens)
+}
+
+// Is checks if the target error is a PromptTooLargeError.
+func (e *PromptTooLargeError) Is(target error) bool {
+	_, ok := target.(*PromptTooLargeError)
+	return ok
+}
+
+// NewPromptTooLargeError creates a new PromptTooLargeError for the estimated size and limit.
+func NewPromptTooLargeError(estimatedTokens, maxTokens int) *PromptTooLargeError {
+	return &PromptTooLargeError{Message: "prompt exceeds the maximum prompt size", EstimatedTokens: estimatedTokens, MaxTokens: maxTokens}
+}
+
+// UnsupportedFeatureError indicates that the connected CLI did not report a
+// capability an SDK feature needs. It is returned instead of sending a
+// request the CLI would not answer.
+type UnsupportedFeatureError struct {
+	Message    string
+	Feature    string     // The SDK feature, e.g. "Interrupt"
+	Capability Capability // The missing capability, e.g. "supportsInterrupt"
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("%s: %s requires the %s capability", e.Message, e.Feature, e.Capability)
+}
+
+// Is checks if the target error is an UnsupportedFeatureError.
+func (e *UnsupportedFeatureError) Is(target error) bool {
+	_, ok := target.(*UnsupportedFeatureError)
+	return ok
+}
+
+// NewUnsupportedFeatureError creates a new UnsupportedFeatureError for a feature and the capability it needs.
+func NewUnsupportedFeatureError(feature string, capability Capability) *UnsupportedFeatureError {
+	return &UnsupportedFeatureError{Message: "feature not supported by the Claude CLI", Feature: feature, Capability: capability}
+}
+
+// IdleTimeoutError indicates that the CLI produced no output for longer than
+// the WithIdleTimeout limit while a response was awaited. The CLI process is
+// stopped when it occurs.
+type IdleTimeoutError struct {
+	Message string
+	Timeout time.Duration // The configured idle limit
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *IdleTimeoutError) Error() string {
+	return fmt.Sprintf("%s (no output for %v)", e.Message, e.Timeout)
+}
+
+// Is checks if the target error is an IdleTimeoutError.
+func (e *IdleTimeoutError) Is(target error) bool {
+	_, ok := target.(*IdleTimeoutError)
+	return ok
+}
+
+// NewIdleTimeoutError creates a new IdleTimeoutError for the configured idle limit.
+func NewIdleTimeoutError(timeout time.Duration) *IdleTimeoutError {
+	return &IdleTimeoutError{Message: "Claude CLI went idle", Timeout: timeout}
+}
+
+// TooManyProcessesError indicates that Connect could not start the CLI
+// because the process-wide limit set with claude.SetMaxSubprocesses was
+// reached and the SubprocessWaitFail policy is in effect.
+type TooManyProcessesError struct {
+	Message string
+	Limit   int // The configured subprocess limit
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *TooManyProcessesError) Error() string {
+	return fmt.Sprintf("%s (limit %d)", e.Message, e.Limit)
+}
+
+// Is checks if the target error is a TooManyProcessesError.
+func (e *TooManyProcessesError) Is(target error) bool {
+	_, ok := target.(*TooManyProcessesError)
+	return ok
+}
+
+// NewTooManyProcessesError creates a new TooManyProcessesError for the configured limit.
+func NewTooManyProcessesError(limit int) *TooManyProcessesError {
+	return &TooManyProcessesError{Message: "too many Claude CLI subprocesses", Limit: limit}
+}
+
+// WarmupError indicates that a Pool's WarmupFunc failed for a newly connected
+// client. The pool closes such a client instead of handing it out.
+type WarmupError struct {
+	Message string
+	Cause   error
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *WarmupError) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+// Is checks if the target error is a WarmupError.
+func (e *WarmupError) Is(target error) bool {
+	_, ok := target.(*WarmupError)
+	return ok
+}
+
+// Unwrap returns the wrapped error.
+func (e *WarmupError) Unwrap() error {
+	return e.Cause
+}
+
+// NewWarmupError creates a new WarmupError wrapping the warmup function's error.
+func NewWarmupError(cause error) *WarmupError {
+	return &WarmupError{Message: "pooled client warmup failed", Cause: cause}
+}
+
+// UnsafeWorkingDirectoryError indicates that the working directory or a
+// WithAddDirs directory lies outside every root given with WithAllowedRoots.
+// Containment is checked after symlinks are resolved.
+type UnsafeWorkingDirectoryError struct {
+	Message      string
+	Path         string   // The offending directory, with symlinks resolved
+	AllowedRoots []string // The allowed roots, with symlinks resolved
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *UnsafeWorkingDirectoryError) Error() string {
+	return fmt.Sprintf("%s: %s is not inside any of %s", e.Message, e.Path, strings.Join(e.AllowedRoots, ", "))
+}
+
+// Is checks if the target error is an UnsafeWorkingDirectoryError.
+func (e *UnsafeWorkingDirectoryError) Is(target error) bool {
+	_, ok := target.(*UnsafeWorkingDirectoryError)
+	return ok
+}
+
+// NewUnsafeWorkingDirectoryError creates a new UnsafeWorkingDirectoryError for a directory and the allowed roots.
+func NewUnsafeWorkingDirectoryError(message, path string, allowedRoots []string) *UnsafeWorkingDirectoryError {
+	return &UnsafeWorkingDirectoryError{Message: message, Path: path, AllowedRoots: allowedRoots}
+}
+
+// HandshakeError indicates that the CLI's first line of output was not JSON,
+// as when the binary is not the Claude Code CLI or prints a human-readable
+// message, such as a login prompt, instead of stream-json output.
+type HandshakeError struct {
+	Message   string
+	FirstLine string // The CLI's first line of output
+}
+
+// Error returns the error message, implementing the error interface.
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("%s: first line of output was %q", e.Message, strutil.Truncate(e.FirstLine, ErrorSnippetLen))
+}
+
+// Is checks if the target error is a HandshakeError.
+func (e *HandshakeError) Is(target error) bool {
+	_, ok := target.(*HandshakeError)
+	return ok
+}
+
+// NewHandshakeError creates a new HandshakeError for the CLI's first line of output.
+func NewHandshakeError(firstLine string) *HandshakeError {
+	return &HandshakeError{Message: "CLI output is not stream-json", FirstLine: firstLine}
+}
+
 // Helper functions for error checking
 
 // IsCLINotFoundError checks if an error is or wraps a CLINotFoundError.
@@ -359,3 +923,131 @@ func IsPermissionDeniedError(err error) bool {
 	var e *PermissionDeniedError
 	return errors.As(err, &e)
 }
+
+// IsWorkingDirectoryError checks if an error is or wraps a WorkingDirectoryError.
+func IsWorkingDirectoryError(err error) bool {
+	var e *WorkingDirectoryError
+	return errors.As(err, &e)
+}
+
+// IsInputClosedError checks if an error is or wraps an InputClosedError.
+func IsInputClosedError(err error) bool {
+	var e *InputClosedError
+	return errors.As(err, &e)
+}
+
+// IsSubagentError checks if an error is or wraps a SubagentError.
+func IsSubagentError(err error) bool {
+	var e *SubagentError
+	return errors.As(err, &e)
+}
+
+// IsBudgetExceededError checks if an error is or wraps a BudgetExceededError.
+func IsBudgetExceededError(err error) bool {
+	var e *BudgetExceededError
+	return errors.As(err, &e)
+}
+
+// IsTransportBrokenError checks if an error is or wraps a TransportBrokenError.
+func IsTransportBrokenError(err error) bool {
+	var e *TransportBrokenError
+	return errors.As(err, &e)
+}
+
+// IsUnsupportedCLIVersionError checks if an error is or wraps an UnsupportedCLIVersionError.
+func IsUnsupportedCLIVersionError(err error) bool {
+	var e *UnsupportedCLIVersionError
+	return errors.As(err, &e)
+}
+
+// IsPromptTooLargeError checks if an error is or wraps a PromptTooLargeError.
+func IsPromptTooLargeError(err error) bool {
+	var e *PromptTooLargeError
+	return errors.As(err, &e)
+}
+
+// IsUnsupportedFeatureError checks if an error is or wraps an UnsupportedFeatureError.
+func IsUnsupportedFeatureError(err error) bool {
+	var e *UnsupportedFeatureError
+	return errors.As(err, &e)
+}
+
+// IsIdleTimeoutError checks if an error is or wraps an IdleTimeoutError.
+func IsIdleTimeoutError(err error) bool {
+	var e *IdleTimeoutError
+	return errors.As(err, &e)
+}
+
+// IsTooManyProcessesError checks if an error is or wraps a TooManyProcessesError.
+func IsTooManyProcessesError(err error) bool {
+	var e *TooManyProcessesError
+	return errors.As(err, &e)
+}
+
+// IsWarmupError checks if an error is or wraps a WarmupError.
+func IsWarmupError(err error) bool {
+	var e *WarmupError
+	return errors.As(err, &e)
+}
+
+// IsUnsafeWorkingDirectoryError checks if an error is or wraps an UnsafeWorkingDirectoryError.
+func IsUnsafeWorkingDirectoryError(err error) bool {
+	var e *UnsafeWorkingDirectoryError
+	return errors.As(err, &e)
+}
+
+// IsTurnInProgressError checks if an error is or wraps a TurnInProgressError.
+func IsTurnInProgressError(err error) bool {
+	var e *TurnInProgressError
+	return errors.As(err, &e)
+}
+
+// IsPermissionNotPending checks if an error is or wraps a PermissionNotPendingError.
+func IsPermissionNotPending(err error) bool {
+	var e *PermissionNotPendingError
+	return errors.As(err, &e)
+}
+
+// IsMessageLimitError checks if an error is or wraps a MessageLimitError.
+func IsMessageLimitError(err error) bool {
+	var e *MessageLimitError
+	return errors.As(err, &e)
+}
+
+// IsOutboundTooLargeError checks if an error is or wraps an OutboundTooLargeError.
+func IsOutboundTooLargeError(err error) bool {
+	var e *OutboundTooLargeError
+	return errors.As(err, &e)
+}
+
+// IsHandshakeError checks if an error is or wraps a HandshakeError.
+func IsHandshakeError(err error) bool {
+	var e *HandshakeError
+	return errors.As(err, &e)
+}
+
+// IsRetryable reports whether err is a transient failure to start a session,
+// one that may not recur if the CLI is started again: a CLIConnectionError,
+// such as the CLI failing to start or the connect timeout expiring during the
+// handshake, or a ProcessError or TransportBrokenError from a CLI that exited
+// or stopped answering. Failures that would recur are not retryable, even
+// when wrapped in one of these: permission, parse and configuration errors,
+// a missing or unsupported CLI, output that is not stream-json, and a
+// cancelled context.
+//
+// Only failures before the session produced output are retried by
+// WithRetry, whatever IsRetryable reports for a later error.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch {
+	case IsPermissionDeniedError(err), IsJSONDecodeError(err), IsMessageParseError(err),
+		IsMessageLimitError(err), IsCLINotFoundError(err), IsUnsupportedCLIVersionError(err),
+		IsUnsupportedFeatureError(err), IsWorkingDirectoryError(err),
+		IsUnsafeWorkingDirectoryError(err), IsPromptTooLargeError(err), IsBudgetExceededError(err),
+		IsHandshakeError(err):
+		return false
+	}
+	return IsCLIConnectionError(err) || IsProcessError(err) || IsTransportBrokenError(err)
+}
@@ -1,8 +1,14 @@
 package types
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 // TestCLINotFoundError tests CLINotFoundError creation and methods.
@@ -67,6 +73,45 @@ func TestJSONDecodeError(t *testing.T) {
 			t.Error("expected error message to contain raw data")
 		}
 	})
+
+	t.Run("long raw data stays valid UTF-8", func(t *testing.T) {
+		raw := `{"text":"` + strings.Repeat("é", 100) + `"}`
+		msg := NewJSONDecodeErrorWithRaw("invalid JSON", raw).Error()
+		if !utf8.ValidString(msg) {
+			t.Errorf("error message is not valid UTF-8: %q", msg)
+		}
+		if !strings.Contains(msg, fmt.Sprintf("(%d bytes)", len(raw))) {
+			t.Errorf("expected truncation marker with the raw size, got %q", msg)
+		}
+	})
+}
+
+// TestJSONDecodeErrorLocation tests the snippet, offset and line of a JSONDecodeError.
+func TestJSONDecodeErrorLocation(t *testing.T) {
+	raw := `{"type":"assistant",` + strings.Repeat(" ", 300) + `oops}`
+	var payload map[string]interface{}
+	cause := json.Unmarshal([]byte(raw), &payload)
+
+	err := NewJSONDecodeErrorWithCause("failed to unmarshal assistant message", raw, cause)
+	var syntaxErr *json.SyntaxError
+	if !errors.As(cause, &syntaxErr) {
+		t.Fatalf("expected a syntax error, got %v", cause)
+	}
+	if err.Offset != syntaxErr.Offset || err.Offset == 0 {
+		t.Errorf("Offset = %d, want %d", err.Offset, syntaxErr.Offset)
+	}
+	if !strings.HasPrefix(err.Snippet, `{"type":"assistant",`) || !strings.HasSuffix(err.Snippet, fmt.Sprintf("...(%d bytes)", len(raw))) {
+		t.Errorf("unexpected snippet %q", err.Snippet)
+	}
+	if err.Raw != raw {
+		t.Error("expected Raw to keep the full data")
+	}
+
+	err.Line = 7
+	msg := err.Error()
+	if want := fmt.Sprintf("failed to unmarshal assistant message (line 7, offset %d, raw: ", err.Offset); !strings.HasPrefix(msg, want) {
+		t.Errorf("expected message to start with %q, got %q", want, msg)
+	}
 }
 
 // TestMessageParseError tests MessageParseError creation and methods.
@@ -84,6 +129,14 @@ func TestMessageParseError(t *testing.T) {
 			t.Error("expected error message to contain message type")
 		}
 	})
+
+	t.Run("error with raw data and line", func(t *testing.T) {
+		err := NewMessageParseErrorWithRaw("unknown message type", "bogus", `{"type":"bogus"}`)
+		err.Line = 3
+		if want := `unknown message type (type: bogus) (line 3, raw: {"type":"bogus"})`; err.Error() != want {
+			t.Errorf("expected %q, got %q", want, err.Error())
+		}
+	})
 }
 
 // TestPermissionDeniedError tests PermissionDeniedError creation and methods.
@@ -110,6 +163,171 @@ func TestPermissionDeniedError(t *testing.T) {
 	})
 }
 
+// TestWorkingDirectoryError tests WorkingDirectoryError creation and methods.
+func TestWorkingDirectoryError(t *testing.T) {
+	err := NewWorkingDirectoryError("working directory does not exist", "/missing/dir")
+	if err.Error() != "working directory does not exist (path: /missing/dir)" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !IsWorkingDirectoryError(err) {
+		t.Error("expected IsWorkingDirectoryError to return true")
+	}
+	if IsWorkingDirectoryError(NewProcessError("other")) {
+		t.Error("expected IsWorkingDirectoryError to return false for other errors")
+	}
+}
+
+// TestIdleTimeoutError tests IdleTimeoutError creation and methods.
+func TestIdleTimeoutError(t *testing.T) {
+	err := NewIdleTimeoutError(2 * time.Second)
+	if err.Error() != "Claude CLI went idle (no output for 2s)" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !IsIdleTimeoutError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsIdleTimeoutError to return true for a wrapped error")
+	}
+	if IsIdleTimeoutError(NewProcessError("other")) {
+		t.Error("expected IsIdleTimeoutError to return false for other errors")
+	}
+}
+
+// TestTooManyProcessesError tests TooManyProcessesError creation and methods.
+func TestTooManyProcessesError(t *testing.T) {
+	err := NewTooManyProcessesError(4)
+	if err.Error() != "too many Claude CLI subprocesses (limit 4)" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !IsTooManyProcessesError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsTooManyProcessesError to return true for a wrapped error")
+	}
+	if IsTooManyProcessesError(NewProcessError("other")) {
+		t.Error("expected IsTooManyProcessesError to return false for other errors")
+	}
+}
+
+// TestWarmupError tests WarmupError creation and methods.
+func TestWarmupError(t *testing.T) {
+	cause := errors.New("priming turn failed")
+	err := NewWarmupError(cause)
+	if err.Error() != "pooled client warmup failed: priming turn failed" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !errors.Is(err, cause) {
+		t.Error("expected WarmupError to unwrap to its cause")
+	}
+	if !IsWarmupError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsWarmupError to return true for a wrapped error")
+	}
+	if IsWarmupError(cause) {
+		t.Error("expected IsWarmupError to return false for other errors")
+	}
+}
+
+// TestUnsafeWorkingDirectoryError tests UnsafeWorkingDirectoryError creation and methods.
+func TestUnsafeWorkingDirectoryError(t *testing.T) {
+	err := NewUnsafeWorkingDirectoryError("working directory is outside the allowed roots", "/tmp", []string{"/srv/a", "/srv/b"})
+	if err.Error() != "working directory is outside the allowed roots: /tmp is not inside any of /srv/a, /srv/b" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !IsUnsafeWorkingDirectoryError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsUnsafeWorkingDirectoryError to return true for a wrapped error")
+	}
+	if IsUnsafeWorkingDirectoryError(NewWorkingDirectoryError("other", "/tmp")) {
+		t.Error("expected IsUnsafeWorkingDirectoryError to return false for other errors")
+	}
+}
+
+// TestHandshakeError tests HandshakeError creation and methods.
+func TestHandshakeError(t *testing.T) {
+	err := NewHandshakeError("Invalid API key. Please run /login")
+	if err.Error() != `CLI output is not stream-json: first line of output was "Invalid API key. Please run /login"` {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !IsHandshakeError(NewTransportBrokenErrorWithCause("CLI output ended before it responded", err)) {
+		t.Error("expected IsHandshakeError to return true for a wrapped error")
+	}
+	if IsHandshakeError(NewTransportBrokenError("CLI output ended before it responded")) {
+		t.Error("expected IsHandshakeError to return false for other errors")
+	}
+}
+
+// TestTurnInProgressError tests TurnInProgressError creation and methods.
+func TestTurnInProgressError(t *testing.T) {
+	err := NewTurnInProgressError("a QueryWithOptions turn is in progress")
+	if err.Error() != "a QueryWithOptions turn is in progress" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !IsTurnInProgressError(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsTurnInProgressError to return true for a wrapped error")
+	}
+	if IsTurnInProgressError(NewProcessError("other")) {
+		t.Error("expected IsTurnInProgressError to return false for other errors")
+	}
+}
+
+// TestPermissionNotPendingError tests PermissionNotPendingError creation and methods.
+func TestPermissionNotPendingError(t *testing.T) {
+	err := NewPermissionNotPendingError("perm_1")
+	if err.Error() != "permission request is not pending: perm_1" {
+		t.Errorf("unexpected error message: %s", err.Error())
+	}
+	if !IsPermissionNotPending(fmt.Errorf("wrapped: %w", err)) {
+		t.Error("expected IsPermissionNotPending to return true for a wrapped error")
+	}
+	if IsPermissionNotPending(NewProcessError("other")) {
+		t.Error("expected IsPermissionNotPending to return false for other errors")
+	}
+}
+
+// TestMessageLimitError tests MessageLimitError creation and methods.
+func TestMessageLimitError(t *testing.T) {
+	err := NewMessageLimitError(MessageLimitDepth, 1000, `{"a":[[[`)
+	err.Line = 4
+	if want := `CLI output exceeds the maximum message depth of 1000 levels (line 4, raw: {"a":[[[)`; err.Error() != want {
+		t.Errorf("expected %q, got %q", want, err.Error())
+	}
+	if got := NewMessageLimitError(MessageLimitSize, 1024, "").Error(); got != "CLI output exceeds the maximum message size of 1024 bytes" {
+		t.Errorf("unexpected error message: %s", got)
+	}
+	if !IsMessageLimitError(NewJSONDecodeErrorWithCause("failed to read", "", err)) {
+		t.Error("expected IsMessageLimitError to return true for a wrapped error")
+	}
+	if IsMessageLimitError(NewProcessError("other")) {
+		t.Error("expected IsMessageLimitError to return false for other errors")
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"connection error", NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", errors.New("exec: text file busy")), true},
+		{"handshake timeout", NewCLIConnectionErrorWithCause("connect timed out after 30s while initializing control protocol", context.DeadlineExceeded), true},
+		{"process exited", NewProcessError("CLI exited before its first message"), true},
+		{"output ended during handshake", NewControlProtocolErrorWithCause("failed to initialize control protocol",
+			NewControlProtocolErrorWithCause("initialization failed", NewTransportBrokenError("CLI output ended before it responded"))), true},
+		{"output not stream-json", NewControlProtocolErrorWithCause("failed to initialize control protocol",
+			NewTransportBrokenErrorWithCause("CLI output ended before it responded", NewHandshakeError("Usage: claude"))), false},
+		{"refused control request", NewControlProtocolError("initialization failed: unknown option"), false},
+		{"permission denied", NewPermissionDeniedError("denied"), false},
+		{"parse error", NewMessageParseError("bad message"), false},
+		{"decode error in transport failure", NewProcessErrorWithCause("CLI failed", NewJSONDecodeError("bad line")), false},
+		{"CLI not found", NewCLINotFoundError("not found"), false},
+		{"connection cancelled", NewCLIConnectionErrorWithCause("failed to connect to Claude CLI", context.Canceled), false},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
 // Helper function to check if a string contains a substring.
 func containsSubstring(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && stringContains(s, substr))
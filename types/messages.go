@@ -1,10 +1,38 @@
 package types
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 )
 
+// Message types, the "type" field of each message the CLI sends or receives.
+const (
+	MessageTypeUser            = "user"
+	MessageTypeAssistant       = "assistant"
+	MessageTypeSystem          = "system"
+	MessageTypeResult          = "result"
+	MessageTypeStreamEvent     = "stream_event"
+	MessageTypeControlRequest  = "control_request"
+	MessageTypeControlResponse = "control_response"
+)
+
+// Content block types, the "type" field of each block in a message's content.
+// Tool result parts use BlockTypeText and BlockTypeImage.
+const (
+	BlockTypeText       = "text"
+	BlockTypeThinking   = "thinking"
+	BlockTypeToolUse    = "tool_use"
+	BlockTypeToolResult = "tool_result"
+	BlockTypeImage      = "image"
+)
+
+// ImageSourceBase64 is the ImageSource type for inline base64 data.
+const ImageSourceBase64 = "base64"
+
 // ContentBlock is an interface for all content block types.
 // Content blocks can be text, thinking, tool use, or tool result blocks.
 type ContentBlock interface {
@@ -33,6 +61,12 @@ type ThinkingBlock struct {
 	Signature string `json:"signature"`
 }
 
+// NewThinkingBlock creates a ThinkingBlock, for replaying Claude's reasoning
+// in a conversation.
+func NewThinkingBlock(thinking, signature string) *ThinkingBlock {
+	return &ThinkingBlock{Type: BlockTypeThinking, Thinking: thinking, Signature: signature}
+}
+
 // GetType returns the type of the content block.
 func (t *ThinkingBlock) GetType() string {
 	return t.Type
@@ -48,6 +82,11 @@ type ToolUseBlock struct {
 	Input map[string]interface{} `json:"input"`
 }
 
+// NewToolUseBlock creates a ToolUseBlock calling the named tool.
+func NewToolUseBlock(id, name string, input map[string]interface{}) *ToolUseBlock {
+	return &ToolUseBlock{Type: BlockTypeToolUse, ID: id, Name: name, Input: input}
+}
+
 // GetType returns the type of the content block.
 func (t *ToolUseBlock) GetType() string {
 	return t.Type
@@ -56,11 +95,35 @@ func (t *ToolUseBlock) GetType() string {
 func (t *ToolUseBlock) isContentBlock() {}
 
 // ToolResultBlock represents the result of a tool execution.
+//
+// Content is whatever the CLI sent: a string, or a list of parts decoded as
+// []interface{}. Use Text or Parts rather than unwrapping it by hand.
 type ToolResultBlock struct {
 	Type      string      `json:"type"`
 	ToolUseID string      `json:"tool_use_id"`
-	Content   interface{} `json:"content,omitempty"`  // Can be string or []map[string]interface{}
+	Content   interface{} `json:"content,omitempty"`  // string, []interface{} from JSON, or []ToolResultPart
 	IsError   *bool       `json:"is_error,omitempty"` // Pointer to distinguish between false and not set
+
+	// Substituted marks a result produced by a WithToolInterceptor function
+	// in place of the CLI's own, which records the call as denied. The CLI
+	// never sets it.
+	Substituted bool `json:"substituted,omitempty"`
+}
+
+// NewToolResultBlock creates a ToolResultBlock answering the tool use with the
+// given ID. Content is a string or a []ToolResultPart; use NewToolResultText
+// and NewToolResultImage for the parts. IsError is set only when isError is
+// true.
+func NewToolResultBlock(toolUseID string, content interface{}, isError bool) *ToolResultBlock {
+	block := &ToolResultBlock{
+		Type:      BlockTypeToolResult,
+		ToolUseID: toolUseID,
+		Content:   content,
+	}
+	if isError {
+		block.IsError = &isError
+	}
+	return block
 }
 
 // GetType returns the type of the content block.
@@ -70,56 +133,343 @@ func (t *ToolResultBlock) GetType() string {
 
 func (t *ToolResultBlock) isContentBlock() {}
 
+// MarshalJSON produces the wire format expected by the CLI. The block type is
+// always "tool_result"; Content is written as it is, so a block decoded from
+// the CLI marshals back to the same content, including part fields this SDK
+// does not model.
+func (t ToolResultBlock) MarshalJSON() ([]byte, error) {
+	type Alias ToolResultBlock
+	alias := Alias(t)
+	alias.Type = BlockTypeToolResult
+	return json.Marshal(alias)
+}
+
+// Text returns the text of the result: string content as it is, or the text
+// parts joined with newlines. ok is false when the content has no text, such
+// as a result holding only an image.
+func (t *ToolResultBlock) Text() (text string, ok bool) {
+	if s, isString := t.Content.(string); isString {
+		return s, true
+	}
+	var texts []string
+	for _, part := range t.Parts() {
+		if part.Type == BlockTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return "", false
+	}
+	return strings.Join(texts, "\n"), true
+}
+
+// Parts returns the content as typed parts. String content is returned as a
+// single text part; parts that cannot be decoded are skipped.
+func (t *ToolResultBlock) Parts() []ToolResultPart {
+	switch c := t.Content.(type) {
+	case nil:
+		return nil
+	case string:
+		return []ToolResultPart{{Type: BlockTypeText, Text: c}}
+	case []ToolResultPart:
+		return append([]ToolResultPart(nil), c...)
+	case []interface{}:
+		parts := make([]ToolResultPart, 0, len(c))
+		for _, item := range c {
+			if part, ok := decodeToolResultPart(item); ok {
+				parts = append(parts, part)
+			}
+		}
+		return parts
+	case []map[string]interface{}:
+		parts := make([]ToolResultPart, 0, len(c))
+		for _, item := range c {
+			if part, ok := decodeToolResultPart(item); ok {
+				parts = append(parts, part)
+			}
+		}
+		return parts
+	}
+	return nil
+}
+
+// decodeToolResultPart converts one decoded JSON part to a ToolResultPart,
+// keeping its original JSON.
+func decodeToolResultPart(item interface{}) (ToolResultPart, bool) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return ToolResultPart{}, false
+	}
+	var part ToolResultPart
+	if err := json.Unmarshal(data, &part); err != nil || part.Type == "" {
+		return ToolResultPart{}, false
+	}
+	part.Raw = data
+	return part, true
+}
+
+// ToolResultPart is one part of a tool result's content: text, an image, or
+// another part type kept in Raw.
+type ToolResultPart struct {
+	Type   string       `json:"type"`             // "text", "image", or another part type
+	Text   string       `json:"text,omitempty"`   // For text parts
+	Source *ImageSource `json:"source,omitempty"` // For image parts
+
+	// Raw is the part's original JSON when it was decoded from the CLI. It is
+	// what MarshalJSON writes, so fields this SDK does not model survive.
+	Raw json.RawMessage `json:"-"`
+}
+
+// NewToolResultText creates a text part.
+func NewToolResultText(text string) ToolResultPart {
+	return ToolResultPart{Type: BlockTypeText, Text: text}
+}
+
+// NewToolResultImage creates an image part from raw image bytes of the given media type.
+func NewToolResultImage(mediaType string, data []byte) ToolResultPart {
+	return ToolResultPart{Type: BlockTypeImage, Source: &NewImageBlock(mediaType, data).Source}
+}
+
+// MarshalJSON writes Raw when the part was decoded from the CLI, and the
+// typed fields otherwise.
+func (p ToolResultPart) MarshalJSON() ([]byte, error) {
+	if p.Raw != nil {
+		return p.Raw, nil
+	}
+	type Alias ToolResultPart
+	return json.Marshal(Alias(p))
+}
+
+// ImageBlock represents an image in a user prompt.
+type ImageBlock struct {
+	Type   string      `json:"type"` // "image"
+	Source ImageSource `json:"source"`
+}
+
+// ImageSource holds the data of an ImageBlock.
+type ImageSource struct {
+	Type      string `json:"type"`       // "base64"
+	MediaType string `json:"media_type"` // "image/jpeg", "image/png", "image/gif", or "image/webp"
+	Data      string `json:"data"`       // Base64-encoded image bytes
+}
+
+// NewImageBlock creates an ImageBlock from raw image bytes of the given media type.
+func NewImageBlock(mediaType string, data []byte) *ImageBlock {
+	return &ImageBlock{
+		Type: BlockTypeImage,
+		Source: ImageSource{
+			Type:      ImageSourceBase64,
+			MediaType: mediaType,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		},
+	}
+}
+
+// GetType returns the type of the content block.
+func (t *ImageBlock) GetType() string {
+	return t.Type
+}
+
+func (t *ImageBlock) isContentBlock() {}
+
+// MarshalJSON produces the wire format expected by the CLI. The block type is
+// always "image", and the source type defaults to "base64".
+func (t ImageBlock) MarshalJSON() ([]byte, error) {
+	type Alias ImageBlock
+	alias := Alias(t)
+	alias.Type = BlockTypeImage
+	if alias.Source.Type == "" {
+		alias.Source.Type = ImageSourceBase64
+	}
+	return json.Marshal(alias)
+}
+
+// NewTextBlock creates a TextBlock for use in a prompt.
+func NewTextBlock(text string) *TextBlock {
+	return &TextBlock{Type: BlockTypeText, Text: text}
+}
+
+// UnknownBlock is a content block whose type this SDK does not recognize,
+// such as one introduced by a newer CLI. It is produced only by lenient
+// parsing (see WithLenientParsing); Raw holds the block as the CLI sent it.
+type UnknownBlock struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+// GetType returns the type of the content block.
+func (b *UnknownBlock) GetType() string {
+	return b.Type
+}
+
+func (b *UnknownBlock) isContentBlock() {}
+
+// MarshalJSON writes the block as the CLI sent it.
+func (b UnknownBlock) MarshalJSON() ([]byte, error) {
+	if b.Raw == nil {
+		return json.Marshal(map[string]string{"type": b.Type})
+	}
+	return b.Raw, nil
+}
+
 // UnmarshalContentBlock unmarshals a JSON content block into the appropriate type.
 func UnmarshalContentBlock(data []byte) (ContentBlock, error) {
-	var typeCheck struct {
-		Type string `json:"type"`
-	}
-	if err := json.Unmarshal(data, &typeCheck); err != nil {
+	return unmarshalContentBlock(data, false)
+}
+
+// unmarshalContentBlock is UnmarshalContentBlock, decoding blocks of unknown
+// type as UnknownBlock when lenient.
+func unmarshalContentBlock(data []byte, lenient bool) (ContentBlock, error) {
+	blockType, err := discriminator(data)
+	if err != nil {
 		return nil, NewJSONDecodeErrorWithCause("failed to determine content block type", string(data), err)
 	}
 
-	switch typeCheck.Type {
-	case "text":
+	switch blockType {
+	case BlockTypeText:
 		var block TextBlock
 		if err := json.Unmarshal(data, &block); err != nil {
 			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal text block", string(data), err)
 		}
 		return &block, nil
-	case "thinking":
+	case BlockTypeThinking:
 		var block ThinkingBlock
 		if err := json.Unmarshal(data, &block); err != nil {
 			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal thinking block", string(data), err)
 		}
 		return &block, nil
-	case "tool_use":
+	case BlockTypeToolUse:
 		var block ToolUseBlock
 		if err := json.Unmarshal(data, &block); err != nil {
 			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal tool_use block", string(data), err)
 		}
 		return &block, nil
-	case "tool_result":
+	case BlockTypeToolResult:
 		var block ToolResultBlock
 		if err := json.Unmarshal(data, &block); err != nil {
 			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal tool_result block", string(data), err)
 		}
 		return &block, nil
+	case BlockTypeImage:
+		var block ImageBlock
+		if err := json.Unmarshal(data, &block); err != nil {
+			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal image block", string(data), err)
+		}
+		return &block, nil
 	default:
-		return nil, NewMessageParseErrorWithType("unknown content block type", typeCheck.Type)
+		if lenient && blockType != "" {
+			return &UnknownBlock{Type: blockType, Raw: append(json.RawMessage(nil), data...)}, nil
+		}
+		return nil, NewMessageParseErrorWithRaw("unknown content block type", blockType, string(data))
 	}
 }
 
+// unmarshalContentBlocks decodes an array of content blocks.
+func unmarshalContentBlocks(raw []json.RawMessage, lenient bool) ([]ContentBlock, error) {
+	blocks := make([]ContentBlock, len(raw))
+	for i, rawBlock := range raw {
+		block, err := unmarshalContentBlock(rawBlock, lenient)
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = block
+	}
+	return blocks, nil
+}
+
 // Message is an interface for all message types from Claude.
 type Message interface {
 	GetMessageType() string
+
+	// GetRaw returns the exact JSON line the CLI sent for this message, or nil
+	// if raw capture is disabled (see WithRawMessages) or the message was
+	// synthesized by the SDK.
+	GetRaw() json.RawMessage
+
 	isMessage()
 }
 
-// UserMessage represents a message from the user.
+// UserMessage represents a message from the user. It marshals to the
+// stream-json envelope the CLI reads on stdin, with Content nested under
+// message.content; see NewUserMessage.
 type UserMessage struct {
-	Type            string      `json:"type"`
-	Content         interface{} `json:"content"` // Can be string or []ContentBlock
-	ParentToolUseID *string     `json:"parent_tool_use_id,omitempty"`
+	Type            string          `json:"type"`
+	Content         interface{}     `json:"content"` // Can be string or []ContentBlock
+	ParentToolUseID *string         `json:"parent_tool_use_id,omitempty"`
+	SessionID       string          `json:"session_id,omitempty"` // Session the message belongs to, if known
+	Raw             json.RawMessage `json:"-"`                    // Original JSON from the CLI; set only with raw capture
+}
+
+// UserMessageOption configures a UserMessage built with NewUserMessage.
+type UserMessageOption func(*UserMessage)
+
+// WithSessionID sets the session a user message is sent in. Client.Query
+// and Query use a default session when it is empty.
+func WithSessionID(sessionID string) UserMessageOption {
+	return func(m *UserMessage) {
+		m.SessionID = sessionID
+	}
+}
+
+// WithParentToolUseID marks a user message as part of the conversation of
+// the subagent started by the Task tool use with the given ID.
+func WithParentToolUseID(toolUseID string) UserMessageOption {
+	return func(m *UserMessage) {
+		m.ParentToolUseID = &toolUseID
+	}
+}
+
+// NewUserMessage creates a UserMessage to send to the CLI, for
+// Client.QueryWithMessage or a streaming input of your own. Content is a
+// string or []ContentBlock. Marshaled, the message is the line the CLI
+// expects:
+//
+//	{"type":"user","message":{"role":"user","content":"Hi"},"parent_tool_use_id":null,"session_id":"default"}
+func NewUserMessage(content interface{}, opts ...UserMessageOption) *UserMessage {
+	m := &UserMessage{Type: MessageTypeUser, Content: content}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// NewUserMessageText creates a UserMessage with a text prompt.
+func NewUserMessageText(text string) *UserMessage {
+	return NewUserMessage(text)
+}
+
+// NewUserMessageBlocks creates a UserMessage whose content is the given blocks.
+func NewUserMessageBlocks(blocks ...ContentBlock) *UserMessage {
+	return NewUserMessage(blocks)
+}
+
+// userMessageEnvelope is the wire form of a UserMessage.
+type userMessageEnvelope struct {
+	Type            string          `json:"type"`
+	Message         userMessageBody `json:"message"`
+	ParentToolUseID *string         `json:"parent_tool_use_id"`
+	SessionID       string          `json:"session_id"`
+}
+
+type userMessageBody struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+// MarshalJSON encodes the message as the CLI's stream-json user message
+// envelope. parent_tool_use_id and session_id are always present, as the CLI
+// sends and expects them.
+func (m UserMessage) MarshalJSON() ([]byte, error) {
+	msgType := m.Type
+	if msgType == "" {
+		msgType = MessageTypeUser
+	}
+	return json.Marshal(userMessageEnvelope{
+		Type:            msgType,
+		Message:         userMessageBody{Role: "user", Content: m.Content},
+		ParentToolUseID: m.ParentToolUseID,
+		SessionID:       m.SessionID,
+	})
 }
 
 // GetMessageType returns the type of the message.
@@ -127,13 +477,25 @@ func (m *UserMessage) GetMessageType() string {
 	return m.Type
 }
 
+// GetRaw returns the original JSON of the message, if captured.
+func (m *UserMessage) GetRaw() json.RawMessage {
+	return m.Raw
+}
+
 func (m *UserMessage) isMessage() {}
 
 // UnmarshalJSON implements custom unmarshaling for UserMessage to handle content union type.
 func (m *UserMessage) UnmarshalJSON(data []byte) error {
+	return m.decode(data, false)
+}
+
+// decode is UnmarshalJSON, decoding content blocks of unknown type as
+// UnknownBlock when lenient.
+func (m *UserMessage) decode(data []byte, lenient bool) error {
 	type Alias UserMessage
 	aux := &struct {
-		Content json.RawMessage `json:"content"`
+		Content json.RawMessage            `json:"content"`
+		Message map[string]json.RawMessage `json:"message"` // Handle nested message format from CLI
 		*Alias
 	}{
 		Alias: (*Alias)(m),
@@ -143,6 +505,11 @@ func (m *UserMessage) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	// Prefer nested message.content (Claude CLI format)
+	if contentRaw, ok := aux.Message["content"]; ok {
+		aux.Content = contentRaw
+	}
+
 	// Try to unmarshal as string first
 	var contentStr string
 	if err := json.Unmarshal(aux.Content, &contentStr); err == nil {
@@ -153,13 +520,9 @@ func (m *UserMessage) UnmarshalJSON(data []byte) error {
 	// Try to unmarshal as array of content blocks
 	var contentArr []json.RawMessage
 	if err := json.Unmarshal(aux.Content, &contentArr); err == nil {
-		blocks := make([]ContentBlock, len(contentArr))
-		for i, rawBlock := range contentArr {
-			block, err := UnmarshalContentBlock(rawBlock)
-			if err != nil {
-				return err
-			}
-			blocks[i] = block
+		blocks, err := unmarshalContentBlocks(contentArr, lenient)
+		if err != nil {
+			return err
 		}
 		m.Content = blocks
 		return nil
@@ -170,10 +533,13 @@ func (m *UserMessage) UnmarshalJSON(data []byte) error {
 
 // AssistantMessage represents a message from Claude assistant.
 type AssistantMessage struct {
-	Type            string         `json:"type"`
-	Content         []ContentBlock `json:"content"`
-	Model           string         `json:"model"`
-	ParentToolUseID *string        `json:"parent_tool_use_id,omitempty"`
+	Type            string          `json:"type"`
+	Content         []ContentBlock  `json:"content"`
+	Model           string          `json:"model"`
+	ParentToolUseID *string         `json:"parent_tool_use_id,omitempty"`
+	Usage           *Usage          `json:"usage,omitempty"` // Per-message token usage, if reported
+	MessageID       string          `json:"-"`               // API message ID, shared by the messages of one response
+	Raw             json.RawMessage `json:"-"`               // Original JSON from the CLI; set only with raw capture
 }
 
 // GetMessageType returns the type of the message.
@@ -181,10 +547,21 @@ func (m *AssistantMessage) GetMessageType() string {
 	return m.Type
 }
 
+// GetRaw returns the original JSON of the message, if captured.
+func (m *AssistantMessage) GetRaw() json.RawMessage {
+	return m.Raw
+}
+
 func (m *AssistantMessage) isMessage() {}
 
 // UnmarshalJSON implements custom unmarshaling for AssistantMessage to handle content blocks.
 func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
+	return m.decode(data, false)
+}
+
+// decode is UnmarshalJSON, decoding content blocks of unknown type as
+// UnknownBlock when lenient.
+func (m *AssistantMessage) decode(data []byte, lenient bool) error {
 	type Alias AssistantMessage
 	aux := &struct {
 		Content []json.RawMessage          `json:"content"`
@@ -215,6 +592,16 @@ func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
 				m.Model = model
 			}
 		}
+		// And per-message usage
+		if usageRaw, ok := aux.Message["usage"]; ok {
+			var usage Usage
+			if err := json.Unmarshal(usageRaw, &usage); err == nil {
+				m.Usage = &usage
+			}
+		}
+		if idRaw, ok := aux.Message["id"]; ok {
+			_ = json.Unmarshal(idRaw, &m.MessageID)
+		}
 	}
 
 	// Fall back to top-level content if nested not found
@@ -223,14 +610,11 @@ func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
 	}
 
 	// Unmarshal content blocks
-	m.Content = make([]ContentBlock, len(contentBlocks))
-	for i, rawBlock := range contentBlocks {
-		block, err := UnmarshalContentBlock(rawBlock)
-		if err != nil {
-			return err
-		}
-		m.Content[i] = block
+	blocks, err := unmarshalContentBlocks(contentBlocks, lenient)
+	if err != nil {
+		return err
 	}
+	m.Content = blocks
 
 	return nil
 }
@@ -245,11 +629,61 @@ func (m *AssistantMessage) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// Text returns the text of the message's TextBlocks, joined with newlines.
+// It is "" when the message has no text, such as one that only calls tools.
+func (m *AssistantMessage) Text() string {
+	var texts []string
+	for _, block := range m.Content {
+		if tb, ok := block.(*TextBlock); ok {
+			texts = append(texts, tb.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ToolUses returns the message's tool calls, in order.
+func (m *AssistantMessage) ToolUses() []*ToolUseBlock {
+	var uses []*ToolUseBlock
+	for _, block := range m.Content {
+		if tu, ok := block.(*ToolUseBlock); ok {
+			uses = append(uses, tu)
+		}
+	}
+	return uses
+}
+
+// Thinking returns the message's thinking blocks, in order.
+func (m *AssistantMessage) Thinking() []*ThinkingBlock {
+	var thinking []*ThinkingBlock
+	for _, block := range m.Content {
+		if tb, ok := block.(*ThinkingBlock); ok {
+			thinking = append(thinking, tb)
+		}
+	}
+	return thinking
+}
+
+// HasToolUse reports whether the message calls the named tool.
+func (m *AssistantMessage) HasToolUse(name string) bool {
+	for _, tu := range m.ToolUses() {
+		if tu.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // SystemMessage represents a system message with metadata.
+//
+// The SDK emits its own system messages to report conditions in-band, such
+// as transport_failed, parse_error, idle_timeout, and budget_exceeded; for
+// these Err holds the typed error.
 type SystemMessage struct {
 	Type    string                 `json:"type"`
 	Subtype string                 `json:"subtype"`
 	Data    map[string]interface{} `json:"data"`
+	Raw     json.RawMessage        `json:"-"` // Original JSON from the CLI; set only with raw capture
+	Err     error                  `json:"-"` // Error behind an SDK-generated message; nil for CLI messages
 }
 
 // GetMessageType returns the type of the message.
@@ -257,8 +691,39 @@ func (m *SystemMessage) GetMessageType() string {
 	return m.Type
 }
 
+// GetRaw returns the original JSON of the message, if captured.
+func (m *SystemMessage) GetRaw() json.RawMessage {
+	return m.Raw
+}
+
 func (m *SystemMessage) isMessage() {}
 
+// UnmarshalJSON decodes a system message. The CLI sends the fields of most
+// system messages, such as compact_boundary's compact_metadata, beside type
+// and subtype rather than under data; without a data object they are
+// collected into Data.
+func (m *SystemMessage) UnmarshalJSON(data []byte) error {
+	type Alias SystemMessage
+	if err := json.Unmarshal(data, (*Alias)(m)); err != nil {
+		return err
+	}
+	if m.Data != nil {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	delete(fields, "type")
+	delete(fields, "subtype")
+	delete(fields, "data")
+	if len(fields) > 0 {
+		m.Data = fields
+	}
+	return nil
+}
+
 // ResultMessage represents a result message with cost and usage information.
 type ResultMessage struct {
 	Type          string                 `json:"type"`
@@ -271,6 +736,42 @@ type ResultMessage struct {
 	TotalCostUSD  *float64               `json:"total_cost_usd,omitempty"`
 	Usage         map[string]interface{} `json:"usage,omitempty"`
 	Result        *string                `json:"result,omitempty"`
+
+	// PermissionDenials lists the tool invocations that were denied during the run.
+	PermissionDenials []PermissionDenial `json:"permission_denials,omitempty"`
+	Raw               json.RawMessage    `json:"-"` // Original JSON from the CLI; set only with raw capture
+}
+
+// ResultSubtypeSynthetic is the subtype of a ResultMessage the SDK emits, with
+// WithSyntheticResults, for a turn the CLI abandoned without a result.
+const ResultSubtypeSynthetic = "sdk_synthetic"
+
+// NewSyntheticResult returns the ResultMessage emitted for a turn the CLI
+// abandoned without one, for the given reason. It is an error result with no
+// usage or cost, so accounting that sums results is unaffected.
+func NewSyntheticResult(sessionID, reason string, duration time.Duration) *ResultMessage {
+	return &ResultMessage{
+		Type:       MessageTypeResult,
+		Subtype:    ResultSubtypeSynthetic,
+		DurationMs: int(duration.Milliseconds()),
+		IsError:    true,
+		SessionID:  sessionID,
+		Result:     &reason,
+	}
+}
+
+// IsSynthetic reports whether the SDK emitted the result in place of one the
+// CLI never sent (see WithSyntheticResults). Exclude such results from
+// accounting of completed turns.
+func (m *ResultMessage) IsSynthetic() bool {
+	return m.Subtype == ResultSubtypeSynthetic
+}
+
+// PermissionDenial describes a tool invocation that was blocked by the permission system.
+type PermissionDenial struct {
+	ToolName  string                 `json:"tool_name"`
+	ToolUseID string                 `json:"tool_use_id"`
+	ToolInput map[string]interface{} `json:"tool_input"`
 }
 
 // GetMessageType returns the type of the message.
@@ -278,6 +779,11 @@ func (m *ResultMessage) GetMessageType() string {
 	return m.Type
 }
 
+// GetRaw returns the original JSON of the message, if captured.
+func (m *ResultMessage) GetRaw() json.RawMessage {
+	return m.Raw
+}
+
 func (m *ResultMessage) isMessage() {}
 
 // StreamEvent represents a stream event for partial message updates during streaming.
@@ -287,6 +793,7 @@ type StreamEvent struct {
 	SessionID       string                 `json:"session_id"`
 	Event           map[string]interface{} `json:"event"` // The raw Anthropic API stream event
 	ParentToolUseID *string                `json:"parent_tool_use_id,omitempty"`
+	Raw             json.RawMessage        `json:"-"` // Original JSON from the CLI; set only with raw capture
 }
 
 // GetMessageType returns the type of the message.
@@ -294,49 +801,215 @@ func (m *StreamEvent) GetMessageType() string {
 	return m.Type
 }
 
+// GetRaw returns the original JSON of the message, if captured.
+func (m *StreamEvent) GetRaw() json.RawMessage {
+	return m.Raw
+}
+
 func (m *StreamEvent) isMessage() {}
 
+// UnknownMessage is a message whose type this SDK does not recognize, such as
+// one introduced by a newer CLI. It is produced only by lenient parsing (see
+// WithLenientParsing); Raw holds the message as the CLI sent it.
+type UnknownMessage struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+// GetMessageType returns the type of the message.
+func (m *UnknownMessage) GetMessageType() string {
+	return m.Type
+}
+
+// GetRaw returns the message as the CLI sent it.
+func (m *UnknownMessage) GetRaw() json.RawMessage {
+	return m.Raw
+}
+
+func (m *UnknownMessage) isMessage() {}
+
+// MarshalJSON writes the message as the CLI sent it.
+func (m UnknownMessage) MarshalJSON() ([]byte, error) {
+	if m.Raw == nil {
+		return json.Marshal(map[string]string{"type": m.Type})
+	}
+	return m.Raw, nil
+}
+
+// DecodeOptions controls UnmarshalMessageWithOptions.
+type DecodeOptions struct {
+	// KeepRaw keeps a copy of the data in the message's Raw field, so
+	// callers may reuse data afterwards.
+	KeepRaw bool
+
+	// Lenient decodes messages and content blocks of types this SDK does not
+	// know as UnknownMessage and UnknownBlock instead of failing with a
+	// MessageParseError. Messages without a type still fail.
+	Lenient bool
+
+	// MaxControlInput leaves the input of a control request longer than this
+	// many bytes undecoded: its request's "input" is a json.RawMessage. Zero
+	// decodes every input.
+	MaxControlInput int
+
+	// Logger receives the warning logged the first time the CLI is seen
+	// using an alternate field name (see SetSchemaAliasHandler). Nil logs
+	// nothing.
+	Logger *slog.Logger
+}
+
+// UnmarshalMessageWithRaw is like UnmarshalMessage but also keeps a copy of
+// data in the message's Raw field, so callers may reuse data afterwards.
+func UnmarshalMessageWithRaw(data []byte) (Message, error) {
+	return UnmarshalMessageWithOptions(data, DecodeOptions{KeepRaw: true})
+}
+
 // UnmarshalMessage unmarshals a JSON message into the appropriate message type.
+// The returned message does not retain data.
+//
+// Fields some CLI versions send in camelCase rather than snake_case (such as
+// parentToolUseId) are accepted under either name; see SchemaAlias.
 func UnmarshalMessage(data []byte) (Message, error) {
-	var typeCheck struct {
-		Type string `json:"type"`
+	return UnmarshalMessageWithOptions(data, DecodeOptions{})
+}
+
+// UnmarshalMessageWithOptions unmarshals a JSON message like UnmarshalMessage,
+// with raw capture, lenient parsing and control input limits as set in opts.
+func UnmarshalMessageWithOptions(data []byte, opts DecodeOptions) (Message, error) {
+	if !opts.KeepRaw {
+		return unmarshalMessage(data, opts)
 	}
-	if err := json.Unmarshal(data, &typeCheck); err != nil {
+
+	raw := make(json.RawMessage, len(data))
+	copy(raw, data)
+
+	msg, err := unmarshalMessage(raw, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch m := msg.(type) {
+	case *UserMessage:
+		m.Raw = raw
+	case *AssistantMessage:
+		m.Raw = raw
+	case *SystemMessage:
+		m.Raw = raw
+	case *ResultMessage:
+		m.Raw = raw
+	case *StreamEvent:
+		m.Raw = raw
+	}
+	return msg, nil
+}
+
+// unmarshalMessage decodes a message, and messages and content blocks of
+// unknown type as UnknownMessage and UnknownBlock when opts.Lenient.
+func unmarshalMessage(data []byte, opts DecodeOptions) (Message, error) {
+	lenient := opts.Lenient
+	msgType, err := discriminator(data)
+	if err != nil {
 		return nil, NewJSONDecodeErrorWithCause("failed to determine message type", string(data), err)
 	}
 
-	switch typeCheck.Type {
-	case "user":
+	switch msgType {
+	case MessageTypeUser, MessageTypeAssistant, MessageTypeStreamEvent:
+		data = normalizeMessageAliases(data, opts.Logger)
+	}
+
+	switch msgType {
+	case MessageTypeUser:
 		var msg UserMessage
-		if err := json.Unmarshal(data, &msg); err != nil {
+		if err := msg.decode(data, lenient); err != nil {
 			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal user message", string(data), err)
 		}
 		return &msg, nil
-	case "assistant":
+	case MessageTypeAssistant:
 		var msg AssistantMessage
-		if err := json.Unmarshal(data, &msg); err != nil {
+		if err := msg.decode(data, lenient); err != nil {
 			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal assistant message", string(data), err)
 		}
 		return &msg, nil
-	case "system":
+	case MessageTypeSystem:
 		var msg SystemMessage
 		if err := json.Unmarshal(data, &msg); err != nil {
 			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal system message", string(data), err)
 		}
 		return &msg, nil
-	case "result":
+	case MessageTypeResult:
 		var msg ResultMessage
 		if err := json.Unmarshal(data, &msg); err != nil {
 			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal result message", string(data), err)
 		}
 		return &msg, nil
-	case "stream_event":
+	case MessageTypeStreamEvent:
 		var msg StreamEvent
 		if err := json.Unmarshal(data, &msg); err != nil {
 			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal stream event", string(data), err)
 		}
 		return &msg, nil
+	case MessageTypeControlRequest, MessageTypeControlResponse:
+		// Control protocol messages are routed as SystemMessages whose Data holds the full payload
+		if msgType == MessageTypeControlRequest && opts.MaxControlInput > 0 && len(data) > opts.MaxControlInput {
+			return unmarshalLargeControlRequest(data)
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal control message", string(data), err)
+		}
+		return &SystemMessage{Type: msgType, Data: payload}, nil
 	default:
-		return nil, NewMessageParseErrorWithType("unknown message type", typeCheck.Type)
+		if lenient && msgType != "" {
+			return &UnknownMessage{Type: msgType, Raw: append(json.RawMessage(nil), data...)}, nil
+		}
+		return nil, NewMessageParseErrorWithRaw("unknown message type", msgType, string(data))
+	}
+}
+
+// unmarshalLargeControlRequest decodes a control request like
+// unmarshalMessage, except that its request's input is left undecoded as a
+// json.RawMessage.
+func unmarshalLargeControlRequest(data []byte) (Message, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, NewJSONDecodeErrorWithCause("failed to unmarshal control message", string(data), err)
 	}
+
+	payload := make(map[string]interface{}, len(envelope))
+	for key, value := range envelope {
+		if key == "request" {
+			continue
+		}
+		var decoded interface{}
+		if err := json.Unmarshal(value, &decoded); err != nil {
+			return nil, NewJSONDecodeErrorWithCause("failed to unmarshal control message", string(data), err)
+		}
+		payload[key] = decoded
+	}
+
+	if raw, ok := envelope["request"]; ok {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+			// Not an object; decode it as is
+			var decoded interface{}
+			_ = json.Unmarshal(raw, &decoded)
+			payload["request"] = decoded
+		} else {
+			request := make(map[string]interface{}, len(fields))
+			for key, value := range fields {
+				if key == "input" {
+					request[key] = value
+					continue
+				}
+				var decoded interface{}
+				if err := json.Unmarshal(value, &decoded); err != nil {
+					return nil, NewJSONDecodeErrorWithCause("failed to unmarshal control message", string(data), err)
+				}
+				request[key] = decoded
+			}
+			payload["request"] = request
+		}
+	}
+
+	return &SystemMessage{Type: MessageTypeControlRequest, Data: payload}, nil
 }
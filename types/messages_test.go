@@ -2,6 +2,8 @@ package types
 
 import (
 	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -57,6 +59,41 @@ func TestToolUseBlockMarshaling(t *testing.T) {
 	}
 }
 
+// TestImageBlockMarshaling tests the wire format and round trip of ImageBlock.
+func TestImageBlockMarshaling(t *testing.T) {
+	block := NewImageBlock("image/gif", []byte("GIF89a"))
+
+	data, err := json.Marshal(block)
+	if err != nil {
+		t.Fatalf("failed to marshal ImageBlock: %v", err)
+	}
+	want := `{"type":"image","source":{"type":"base64","media_type":"image/gif","data":"R0lGODlh"}}`
+	if string(data) != want {
+		t.Errorf("ImageBlock JSON = %s, want %s", data, want)
+	}
+
+	// Type fields are filled in when left empty, for values and pointers alike
+	data, err = json.Marshal(ImageBlock{Source: ImageSource{MediaType: "image/png", Data: "AA=="}})
+	if err != nil {
+		t.Fatalf("failed to marshal ImageBlock: %v", err)
+	}
+	if !strings.Contains(string(data), `"type":"image"`) || !strings.Contains(string(data), `"type":"base64"`) {
+		t.Errorf("ImageBlock JSON missing default types: %s", data)
+	}
+
+	decoded, err := UnmarshalContentBlock([]byte(want))
+	if err != nil {
+		t.Fatalf("failed to unmarshal image block: %v", err)
+	}
+	image, ok := decoded.(*ImageBlock)
+	if !ok {
+		t.Fatalf("expected *ImageBlock, got %T", decoded)
+	}
+	if image.GetType() != "image" || image.Source.MediaType != "image/gif" || image.Source.Data != "R0lGODlh" {
+		t.Errorf("unmarshaled ImageBlock = %+v", image)
+	}
+}
+
 // TestUnmarshalContentBlock tests unmarshaling of different content block types.
 func TestUnmarshalContentBlock(t *testing.T) {
 	tests := []struct {
@@ -116,6 +153,222 @@ func TestUserMessageMarshaling(t *testing.T) {
 			t.Errorf("content doesn't match: got %v", decoded.Content)
 		}
 	})
+
+	t.Run("nested CLI format", func(t *testing.T) {
+		data := `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"ok"}]},"parent_tool_use_id":"toolu_parent"}`
+
+		var decoded UserMessage
+		if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+			t.Fatalf("failed to unmarshal UserMessage: %v", err)
+		}
+
+		blocks, ok := decoded.Content.([]ContentBlock)
+		if !ok || len(blocks) != 1 {
+			t.Fatalf("expected 1 content block, got %v", decoded.Content)
+		}
+		if tr, ok := blocks[0].(*ToolResultBlock); !ok || tr.ToolUseID != "toolu_1" {
+			t.Errorf("unexpected block: %+v", blocks[0])
+		}
+		if decoded.ParentToolUseID == nil || *decoded.ParentToolUseID != "toolu_parent" {
+			t.Errorf("parent tool use ID not decoded")
+		}
+	})
+}
+
+// TestAssistantMessageNestedUsage tests that per-message usage is read from the CLI format.
+func TestAssistantMessageNestedUsage(t *testing.T) {
+	data := `{"type":"assistant","message":{"model":"claude-sonnet-4-5","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":12,"output_tokens":3,"cache_read_input_tokens":40}}}`
+
+	var decoded AssistantMessage
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatalf("failed to unmarshal AssistantMessage: %v", err)
+	}
+	if decoded.Usage == nil || decoded.Usage.InputTokens != 12 || decoded.Usage.CacheReadInputTokens != 40 {
+		t.Errorf("usage not decoded: %+v", decoded.Usage)
+	}
+}
+
+// TestUnmarshalControlMessages tests that control protocol messages decode to SystemMessages.
+func TestUnmarshalControlMessages(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		key  string
+	}{
+		{
+			name: "control_response",
+			data: `{"type":"control_response","response":{"subtype":"success","request_id":"req_1","response":{}}}`,
+			key:  "response",
+		},
+		{
+			name: "control_request",
+			data: `{"type":"control_request","request_id":"cli_1","request":{"subtype":"can_use_tool","tool_name":"Bash"}}`,
+			key:  "request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := UnmarshalMessage([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("UnmarshalMessage() error = %v", err)
+			}
+			sys, ok := msg.(*SystemMessage)
+			if !ok {
+				t.Fatalf("expected *SystemMessage, got %T", msg)
+			}
+			if sys.GetMessageType() != tt.name {
+				t.Errorf("type = %q, want %q", sys.GetMessageType(), tt.name)
+			}
+			if _, ok := sys.Data[tt.key].(map[string]interface{}); !ok {
+				t.Errorf("expected %q payload in data, got %v", tt.key, sys.Data)
+			}
+		})
+	}
+}
+
+// TestUnmarshalMessageWithRaw tests that raw capture keeps an independent copy of the input.
+func TestUnmarshalMessageWithRaw(t *testing.T) {
+	lines := []string{
+		`{"type":"user","message":{"role":"user","content":"hi"},"extra":1}`,
+		`{"type":"assistant",  "message":{"model":"m","content":[{"type":"text","text":"hello"}]}}`,
+		`{"type":"system","subtype":"init","data":{}}`,
+		`{"type":"result","subtype":"success","session_id":"s","future_field":[1,2]}`,
+		`{"type":"stream_event","uuid":"u","session_id":"s","event":{}}`,
+		`{"type":"control_request","request_id":"cli_1","request":{"subtype":"interrupt"}}`,
+	}
+
+	for _, line := range lines {
+		buf := []byte(line)
+		msg, err := UnmarshalMessageWithRaw(buf)
+		if err != nil {
+			t.Fatalf("UnmarshalMessageWithRaw(%s) error = %v", line, err)
+		}
+
+		// Overwrite the input as a reused read buffer would be
+		for i := range buf {
+			buf[i] = ' '
+		}
+		if got := string(msg.GetRaw()); got != line {
+			t.Errorf("%s: GetRaw() = %s, want %s", msg.GetMessageType(), got, line)
+		}
+
+		plain, err := UnmarshalMessage([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plain.GetRaw() != nil {
+			t.Errorf("%s: UnmarshalMessage retained raw JSON", plain.GetMessageType())
+		}
+	}
+}
+
+// TestUnmarshalMessageLenient tests that lenient parsing keeps unknown message
+// and content block types, which strict parsing rejects.
+func TestUnmarshalMessageLenient(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		check func(t *testing.T, msg Message)
+	}{
+		{
+			name: "unknown message",
+			line: `{"type":"attachment","path":"notes.txt","size":12}`,
+			check: func(t *testing.T, msg Message) {
+				unknown, ok := msg.(*UnknownMessage)
+				if !ok || unknown.Type != "attachment" || msg.GetMessageType() != "attachment" {
+					t.Fatalf("got %#v, want an attachment UnknownMessage", msg)
+				}
+				if string(unknown.GetRaw()) != `{"type":"attachment","path":"notes.txt","size":12}` {
+					t.Errorf("Raw = %s", unknown.Raw)
+				}
+				// Written back as the CLI sent it
+				data, err := json.Marshal(msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertSameJSON(t, data, unknown.Raw)
+			},
+		},
+		{
+			name: "unknown assistant block",
+			line: `{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"see"},{"type":"citation","url":"https://example.com"}]}}`,
+			check: func(t *testing.T, msg Message) {
+				m := msg.(*AssistantMessage)
+				if len(m.Content) != 2 || m.Text() != "see" {
+					t.Fatalf("content = %#v", m.Content)
+				}
+				block, ok := m.Content[1].(*UnknownBlock)
+				if !ok || block.GetType() != "citation" || string(block.Raw) != `{"type":"citation","url":"https://example.com"}` {
+					t.Fatalf("second block = %#v, want a citation UnknownBlock", m.Content[1])
+				}
+				data, err := json.Marshal(m)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(data), `{"type":"citation","url":"https://example.com"}`) {
+					t.Errorf("marshaled message lost the unknown block: %s", data)
+				}
+			},
+		},
+		{
+			name: "unknown user block",
+			line: `{"type":"user","message":{"content":[{"type":"document","id":"d1"}]}}`,
+			check: func(t *testing.T, msg Message) {
+				blocks, _ := msg.(*UserMessage).Content.([]ContentBlock)
+				if len(blocks) != 1 || blocks[0].GetType() != "document" {
+					t.Errorf("content = %#v, want a document UnknownBlock", blocks)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := UnmarshalMessage([]byte(tt.line)); !IsMessageParseError(err) {
+				t.Errorf("strict UnmarshalMessage error = %v, want MessageParseError", err)
+			}
+
+			buf := []byte(tt.line)
+			msg, err := UnmarshalMessageWithOptions(buf, DecodeOptions{Lenient: true})
+			if err != nil {
+				t.Fatalf("lenient UnmarshalMessageWithOptions error = %v", err)
+			}
+			// Unknown types keep their own copy of the data
+			for i := range buf {
+				buf[i] = ' '
+			}
+			tt.check(t, msg)
+		})
+	}
+}
+
+// TestUnmarshalMessageLenientUntyped tests that lenient parsing still rejects
+// messages and blocks without a type.
+func TestUnmarshalMessageLenientUntyped(t *testing.T) {
+	for _, line := range []string{
+		`{"path":"notes.txt"}`,
+		`{"type":"assistant","message":{"content":[{"text":"untyped"}]}}`,
+		`not json`,
+	} {
+		if _, err := UnmarshalMessageWithOptions([]byte(line), DecodeOptions{Lenient: true, KeepRaw: true}); err == nil {
+			t.Errorf("UnmarshalMessageWithOptions(%s) succeeded", line)
+		}
+	}
+}
+
+// TestRawNotMarshaled tests that captured raw JSON is not re-encoded with the message.
+func TestRawNotMarshaled(t *testing.T) {
+	msg, err := UnmarshalMessageWithRaw([]byte(`{"type":"result","subtype":"success","session_id":"s"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Raw") {
+		t.Errorf("raw JSON leaked into marshaled message: %s", data)
+	}
 }
 
 // TestResultMessageMarshaling tests JSON marshaling/unmarshaling of ResultMessage.
@@ -151,3 +404,345 @@ func TestResultMessageMarshaling(t *testing.T) {
 		t.Errorf("total cost doesn't match")
 	}
 }
+
+// TestNewToolResultBlock tests building a tool result from typed parts.
+func TestNewToolResultBlock(t *testing.T) {
+	block := NewToolResultBlock("toolu_1", []ToolResultPart{
+		NewToolResultText("first"),
+		NewToolResultImage("image/png", []byte{0x89, 'P', 'N', 'G'}),
+		NewToolResultText("second"),
+	}, false)
+
+	if text, ok := block.Text(); !ok || text != "first\nsecond" {
+		t.Errorf("Text() = %q, %v; want \"first\\nsecond\", true", text, ok)
+	}
+	parts := block.Parts()
+	if len(parts) != 3 || parts[1].Source == nil || parts[1].Source.MediaType != "image/png" {
+		t.Fatalf("Parts() = %+v", parts)
+	}
+
+	data, err := json.Marshal(block)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"type":"tool_result","tool_use_id":"toolu_1","content":[` +
+		`{"type":"text","text":"first"},` +
+		`{"type":"image","source":{"type":"base64","media_type":"image/png","data":"iVBORw=="}},` +
+		`{"type":"text","text":"second"}]}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s\nwant %s", data, want)
+	}
+
+	// The decoded block reads the same
+	decoded, err := UnmarshalContentBlock(data)
+	if err != nil {
+		t.Fatalf("UnmarshalContentBlock failed: %v", err)
+	}
+	if text, _ := decoded.(*ToolResultBlock).Text(); text != "first\nsecond" {
+		t.Errorf("decoded Text() = %q", text)
+	}
+}
+
+// TestToolResultBlockContentForms tests Text and Parts over each form Content
+// may take, with and without is_error.
+func TestToolResultBlockContentForms(t *testing.T) {
+	isErr, notErr := true, false
+	tests := []struct {
+		name      string
+		block     ToolResultBlock
+		wantText  string
+		wantOK    bool
+		wantParts int
+	}{
+		{"nil", ToolResultBlock{}, "", false, 0},
+		{"string", ToolResultBlock{Content: "done"}, "done", true, 1},
+		{"empty string error", ToolResultBlock{Content: "", IsError: &isErr}, "", true, 1},
+		{"decoded parts", ToolResultBlock{Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": "a"},
+			"not a part",
+			map[string]interface{}{"text": "no type"},
+			map[string]interface{}{"type": "text", "text": "b"},
+		}, IsError: &notErr}, "a\nb", true, 2},
+		{"map parts", ToolResultBlock{Content: []map[string]interface{}{
+			{"type": "text", "text": "c"},
+		}}, "c", true, 1},
+		{"unknown content", ToolResultBlock{Content: 42}, "", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, ok := tt.block.Text()
+			if text != tt.wantText || ok != tt.wantOK {
+				t.Errorf("Text() = %q, %v; want %q, %v", text, ok, tt.wantText, tt.wantOK)
+			}
+			if n := len(tt.block.Parts()); n != tt.wantParts {
+				t.Errorf("len(Parts()) = %d, want %d", n, tt.wantParts)
+			}
+		})
+	}
+}
+
+// assertSameJSON fails the test unless a and b encode the same JSON value.
+func assertSameJSON(t *testing.T, a, b []byte) {
+	t.Helper()
+
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	if !reflect.DeepEqual(va, vb) {
+		t.Errorf("JSON differs:\n%s\n%s", a, b)
+	}
+}
+
+// TestBlockConstructorsRoundTrip tests that each block constructor sets its
+// type and that its JSON decodes back to the same block.
+func TestBlockConstructorsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		block    ContentBlock
+		wantType string
+	}{
+		{"text", NewTextBlock("hello"), BlockTypeText},
+		{"thinking", NewThinkingBlock("let me see", "sig_1"), BlockTypeThinking},
+		{"tool use", NewToolUseBlock("toolu_1", "Bash", map[string]interface{}{"command": "ls"}), BlockTypeToolUse},
+		{"tool result text", NewToolResultBlock("toolu_1", "file.txt", false), BlockTypeToolResult},
+		{"tool result error", NewToolResultBlock("toolu_1", "permission denied", true), BlockTypeToolResult},
+		{"tool result parts", NewToolResultBlock("toolu_1", []ToolResultPart{
+			NewToolResultText("shot"),
+			NewToolResultImage("image/png", []byte{1, 2, 3}),
+		}, false), BlockTypeToolResult},
+		{"image", NewImageBlock("image/png", []byte{1, 2, 3}), BlockTypeImage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.block.GetType(); got != tt.wantType {
+				t.Errorf("GetType() = %q, want %q", got, tt.wantType)
+			}
+
+			data, err := json.Marshal(tt.block)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			decoded, err := UnmarshalContentBlock(data)
+			if err != nil {
+				t.Fatalf("UnmarshalContentBlock(%s) failed: %v", data, err)
+			}
+			if got := decoded.GetType(); got != tt.wantType {
+				t.Errorf("decoded GetType() = %q, want %q", got, tt.wantType)
+			}
+			again, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatalf("Marshal of decoded block failed: %v", err)
+			}
+			assertSameJSON(t, data, again)
+		})
+	}
+}
+
+// TestNewToolResultBlockIsError tests that IsError is set only for errors.
+func TestNewToolResultBlockIsError(t *testing.T) {
+	if block := NewToolResultBlock("toolu_1", "ok", false); block.IsError != nil {
+		t.Errorf("IsError = %v, want nil", *block.IsError)
+	}
+	block := NewToolResultBlock("toolu_1", "failed", true)
+	if block.IsError == nil || !*block.IsError {
+		t.Fatalf("IsError = %v, want true", block.IsError)
+	}
+	data, err := json.Marshal(block)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `{"type":"tool_result","tool_use_id":"toolu_1","content":"failed","is_error":true}`; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+}
+
+// TestUserMessageConstructorsRoundTrip tests that the user message
+// constructors set the type and survive a JSON round trip.
+func TestUserMessageConstructorsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *UserMessage
+	}{
+		{"text", NewUserMessageText("What is 2 + 2?")},
+		{"blocks", NewUserMessageBlocks(
+			NewTextBlock("What is in this image?"),
+			NewImageBlock("image/png", []byte{1, 2, 3}),
+		)},
+		{"tool result", NewUserMessageBlocks(NewToolResultBlock("toolu_1", "done", false))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.msg.Type != MessageTypeUser {
+				t.Errorf("Type = %q, want %q", tt.msg.Type, MessageTypeUser)
+			}
+
+			data, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			decoded, err := UnmarshalMessage(data)
+			if err != nil {
+				t.Fatalf("UnmarshalMessage(%s) failed: %v", data, err)
+			}
+			if got := decoded.GetMessageType(); got != MessageTypeUser {
+				t.Errorf("decoded GetMessageType() = %q, want %q", got, MessageTypeUser)
+			}
+			again, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatalf("Marshal of decoded message failed: %v", err)
+			}
+			assertSameJSON(t, data, again)
+		})
+	}
+}
+
+// TestNewUserMessageMarshal tests that NewUserMessage marshals to the exact
+// envelope the CLI reads on stdin.
+func TestNewUserMessageMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *UserMessage
+		want string
+	}{
+		{
+			name: "string content",
+			msg:  NewUserMessage("What is 2 + 2?"),
+			want: `{"type":"user","message":{"role":"user","content":"What is 2 + 2?"},"parent_tool_use_id":null,"session_id":""}`,
+		},
+		{
+			name: "block content",
+			msg: NewUserMessage([]ContentBlock{
+				NewTextBlock("What is in this image?"),
+				NewImageBlock("image/png", []byte{1, 2, 3}),
+			}),
+			want: `{"type":"user","message":{"role":"user","content":[{"type":"text","text":"What is in this image?"},{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AQID"}}]},"parent_tool_use_id":null,"session_id":""}`,
+		},
+		{
+			name: "custom session ID",
+			msg:  NewUserMessage("Continue the review", WithSessionID("review-42")),
+			want: `{"type":"user","message":{"role":"user","content":"Continue the review"},"parent_tool_use_id":null,"session_id":"review-42"}`,
+		},
+		{
+			name: "parent tool use and session",
+			msg: NewUserMessage([]ContentBlock{NewToolResultBlock("toolu_2", "3 files", false)},
+				WithParentToolUseID("toolu_task_1"), WithSessionID("s1")),
+			want: `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_2","content":"3 files"}]},"parent_tool_use_id":"toolu_task_1","session_id":"s1"}`,
+		},
+		{
+			name: "literal without type",
+			msg:  &UserMessage{Content: "hi"},
+			want: `{"type":"user","message":{"role":"user","content":"hi"},"parent_tool_use_id":null,"session_id":""}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal() =\n%s\nwant\n%s", data, tt.want)
+			}
+
+			// A value marshals the same as a pointer
+			if value, _ := json.Marshal(*tt.msg); string(value) != string(data) {
+				t.Errorf("Marshal of the value = %s, want %s", value, data)
+			}
+
+			var decoded UserMessage
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if decoded.SessionID != tt.msg.SessionID {
+				t.Errorf("decoded SessionID = %q, want %q", decoded.SessionID, tt.msg.SessionID)
+			}
+			if (decoded.ParentToolUseID == nil) != (tt.msg.ParentToolUseID == nil) ||
+				decoded.ParentToolUseID != nil && *decoded.ParentToolUseID != *tt.msg.ParentToolUseID {
+				t.Errorf("decoded ParentToolUseID = %v, want %v", decoded.ParentToolUseID, tt.msg.ParentToolUseID)
+			}
+		})
+	}
+}
+
+// FuzzUnmarshalMessage tests that decoding arbitrary CLI output, strictly or
+// leniently, and then using the message never panics.
+func FuzzUnmarshalMessage(f *testing.F) {
+	seeds := []string{
+		`{"type":"user","message":{"role":"user","content":"hi"}}`,
+		`{"type":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":[{"type":"text","text":"ok"}]}]}`,
+		`{"type":"assistant","message":{"model":"m","content":[{"type":"text","text":"a"},{"type":"tool_use","id":"t","name":"Bash","input":{"command":"ls"}}],"usage":{"input_tokens":1}}}`,
+		`{"type":"assistant","message":{"content":[{"type":"attachment","file":"a.png"}]}}`,
+		`{"type":"system","subtype":"init","data":{"session_id":"s"}}`,
+		`{"type":"result","subtype":"success","duration_ms":1,"num_turns":1,"session_id":"s","total_cost_usd":0.1,"usage":{"input_tokens":3}}`,
+		`{"type":"stream_event","uuid":"u","session_id":"s","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"x"}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_start","content_block":{"type":"tool_use"}}}`,
+		`{"type":"control_request","request_id":"r","request":{"subtype":"can_use_tool"}}`,
+		`{"type":"attachment","path":"a.txt"}`,
+		`{"type":"user","parentToolUseId":"p","message":{"content":null}}`,
+		`{"type":"assistant","message":null,"content":[null]}`,
+		"{\"type\":\"user\",\"content\":\"\xff\xfe\"}",
+		`{"type":"user","content":[[[[[[[[[[[[[[[[[[[[]]]]]]]]]]]]]]]]]]]]}`,
+		`{"type":"result","usage":null,"modelUsage":{"m":null}}`,
+		`{}`,
+		`null`,
+		`[]`,
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, opts := range []DecodeOptions{{}, {KeepRaw: true, Lenient: true}} {
+			msg, err := UnmarshalMessageWithOptions(data, opts)
+			if err != nil {
+				if msg != nil {
+					t.Fatalf("UnmarshalMessageWithOptions returned both a message and error %v", err)
+				}
+				continue
+			}
+			exerciseMessage(t, msg)
+		}
+	})
+}
+
+// exerciseMessage calls the accessors of a decoded message.
+func exerciseMessage(t *testing.T, msg Message) {
+	_ = msg.GetMessageType()
+	_ = msg.GetRaw()
+	if _, err := json.Marshal(msg); err != nil {
+		t.Logf("marshal %T: %v", msg, err)
+	}
+
+	var blocks []ContentBlock
+	switch m := msg.(type) {
+	case *UserMessage:
+		blocks, _ = m.Content.([]ContentBlock)
+	case *AssistantMessage:
+		blocks = m.Content
+		_ = m.Text()
+		_ = m.ToolUses()
+		_ = m.Thinking()
+		_ = m.HasToolUse("Bash")
+	case *ResultMessage:
+		_, _ = m.ParseUsage()
+	case *StreamEvent:
+		_, _ = m.Decode()
+	}
+	for _, block := range blocks {
+		if block == nil {
+			continue
+		}
+		_ = block.GetType()
+		if result, ok := block.(*ToolResultBlock); ok {
+			_, _ = result.Text()
+			_ = result.Parts()
+		}
+	}
+}
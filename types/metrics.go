@@ -0,0 +1,87 @@
+package types
+
+import "time"
+
+// MetricsSink receives the SDK's metrics so they can be exported to
+// Prometheus, StatsD, OpenTelemetry, or similar without the SDK depending on
+// any of them. Set it with WithMetricsSink.
+//
+// Names are the Metric* constants and follow Prometheus conventions; labels
+// may be nil. Methods are called from several goroutines at once and must be
+// safe for concurrent use. They are called inline, so they should not block.
+type MetricsSink interface {
+	// IncCounter adds delta, which is never negative, to a counter.
+	IncCounter(name string, delta float64, labels map[string]string)
+
+	// ObserveDuration records one observation for a histogram or summary.
+	ObserveDuration(name string, d time.Duration, labels map[string]string)
+
+	// AddGauge adds delta, which may be negative, to a gauge.
+	AddGauge(name string, delta float64, labels map[string]string)
+}
+
+// Metrics reported to a MetricsSink.
+const (
+	// MetricQueries counts prompts sent to the CLI by Client.Query and the
+	// one-shot Query functions.
+	MetricQueries = "claude_queries_total"
+
+	// MetricMessages counts messages delivered to the caller, labelled with
+	// the message "type" (assistant, user, system, result, stream_event).
+	MetricMessages = "claude_messages_total"
+
+	// MetricCostUSD accumulates the cost of each turn: the increase in the
+	// session's TotalCostUSD from one result message to the next.
+	MetricCostUSD = "claude_cost_usd_total"
+
+	// MetricInputTokens counts uncached input tokens reported by result
+	// messages.
+	MetricInputTokens = "claude_input_tokens_total"
+
+	// MetricCacheReadTokens counts input tokens served from the prompt
+	// cache. The cache hit rate is MetricCacheReadTokens divided by the sum
+	// of MetricInputTokens, MetricCacheReadTokens and
+	// MetricCacheCreationTokens.
+	MetricCacheReadTokens = "claude_cache_read_tokens_total"
+
+	// MetricCacheCreationTokens counts input tokens written to the prompt
+	// cache.
+	MetricCacheCreationTokens = "claude_cache_creation_tokens_total"
+
+	// MetricOutputTokens counts output tokens reported by result messages.
+	MetricOutputTokens = "claude_output_tokens_total"
+
+	// MetricResponseDuration observes how long ReceiveResponse took to reach
+	// the result message, and a one-shot Query from connect to result.
+	MetricResponseDuration = "claude_response_duration_seconds"
+
+	// MetricConnectDuration observes how long Client.Connect took, labelled
+	// with "outcome" success or error.
+	MetricConnectDuration = "claude_connect_duration_seconds"
+
+	// MetricClientsConnected is a gauge of connected Clients.
+	MetricClientsConnected = "claude_clients_connected"
+
+	// MetricBytesWritten counts bytes written to the CLI's stdin.
+	MetricBytesWritten = "claude_transport_written_bytes_total"
+
+	// MetricBytesRead counts bytes read from the CLI's stdout.
+	MetricBytesRead = "claude_transport_read_bytes_total"
+
+	// MetricOversizedWrites counts lines for the CLI's stdin over an
+	// outbound limit, labelled with "limit" warn, for lines written with a
+	// warning, or max, for lines rejected with OutboundTooLargeError.
+	MetricOversizedWrites = "claude_transport_oversized_writes_total"
+
+	// MetricSubprocessStarts counts CLI subprocesses started; more starts
+	// than clients means subprocesses were restarted.
+	MetricSubprocessStarts = "claude_subprocess_starts_total"
+
+	// MetricSubprocesses is a gauge of running CLI subprocesses, decreased
+	// once a subprocess has exited and been reaped.
+	MetricSubprocesses = "claude_subprocesses"
+
+	// MetricWarmupDuration observes how long a Pool's WarmupFunc took for a
+	// newly connected client, labelled with "outcome" success or error.
+	MetricWarmupDuration = "claude_pool_warmup_duration_seconds"
+)
@@ -2,15 +2,65 @@ package types
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
 )
 
+// DefaultConnectTimeout is how long Connect waits for the CLI to start and
+// answer the initialize handshake when WithConnectTimeout is not set.
+const DefaultConnectTimeout = 30 * time.Second
+
+// DefaultConsumerTimeout is how long Query waits for the caller to receive a
+// message before treating its channel as abandoned, when WithConsumerTimeout
+// is not set.
+const DefaultConsumerTimeout = 5 * time.Minute
+
+// DefaultCloseTimeout is how long Close lets the CLI exit on its own after
+// closing its input before killing it, when WithCloseTimeout is not set.
+const DefaultCloseTimeout = 5 * time.Second
+
+// DefaultMaxThinkingTokens is the thinking budget of WithThinkingEnabled(true)
+// when WithMaxThinkingTokens is not set.
+const DefaultMaxThinkingTokens = 10000
+
+// DefaultCancelTimeout is how long a cancelled Query waits for the CLI to end
+// its interrupted turn before killing it, when WithCancelTimeout is not set.
+const DefaultCancelTimeout = 5 * time.Second
+
+// DefaultMaxOutboundSize is the largest line, in bytes, written to the CLI's
+// input when WithMaxOutboundSize is not set.
+const DefaultMaxOutboundSize = 10 * 1024 * 1024
+
+// DefaultOutboundWarnSize is the line size, in bytes, above which writes to
+// the CLI's input are logged as warnings when WithOutboundWarnSize is not set.
+const DefaultOutboundWarnSize = 1024 * 1024
+
+// DefaultMaxMessageDepth is how deeply objects and arrays may nest in a line
+// of CLI output, when WithMaxMessageDepth is not set.
+const DefaultMaxMessageDepth = 1000
+
 // SettingSource represents where settings are loaded from.
 type SettingSource string
 
 const (
-	SettingSourceUser    SettingSource = "user"
-	SettingSourceProject SettingSource = "project"
-	SettingSourceLocal   SettingSource = "local"
+	SettingSourceUser    SettingSource = "user"    // ~/.claude/settings.json
+	SettingSourceProject SettingSource = "project" // .claude/settings.json in the working directory
+	SettingSourceLocal   SettingSource = "local"   // .claude/settings.local.json in the working directory
+)
+
+// SubprocessWaitPolicy decides what Connect does when the process-wide limit
+// on CLI subprocesses set with claude.SetMaxSubprocesses is reached.
+type SubprocessWaitPolicy string
+
+const (
+	// SubprocessWaitBlock (the default) waits for another subprocess to exit,
+	// or until the context passed to Connect ends.
+	SubprocessWaitBlock SubprocessWaitPolicy = "block"
+
+	// SubprocessWaitFail fails Connect at once with a TooManyProcessesError.
+	SubprocessWaitFail SubprocessWaitPolicy = "fail"
 )
 
 // SystemPromptPreset represents a preset system prompt configuration.
@@ -28,6 +78,26 @@ type AgentDefinition struct {
 	Model       *string  `json:"model,omitempty"` // "sonnet", "opus", "haiku", "inherit"
 }
 
+// Validate reports whether the definition is complete: the description and
+// prompt are required, and listed tools and the model, if set, must not be empty.
+func (a AgentDefinition) Validate() error {
+	if a.Description == "" {
+		return fmt.Errorf("description is required")
+	}
+	if a.Prompt == "" {
+		return fmt.Errorf("prompt is required")
+	}
+	for i, tool := range a.Tools {
+		if tool == "" {
+			return fmt.Errorf("tool %d is empty", i)
+		}
+	}
+	if a.Model != nil && *a.Model == "" {
+		return fmt.Errorf("model is set but empty")
+	}
+	return nil
+}
+
 // McpStdioServerConfig represents an MCP stdio server configuration.
 type McpStdioServerConfig struct {
 	Type    *string           `json:"type,omitempty"` // "stdio" - optional for backwards compatibility
@@ -59,22 +129,60 @@ type McpSdkServerConfig struct {
 
 // CanUseToolFunc is a callback function for tool permission requests.
 // It receives the tool name, input parameters, and context, and returns a permission result.
-type CanUseToolFunc func(ctx context.Context, toolName string, input map[string]interface{}, permCtx ToolPermissionContext) (interface{}, error)
+//
+// Callbacks written against earlier releases returned interface{}; change the
+// return type to PermissionResult. Existing return statements using
+// PermissionResultAllow or PermissionResultDeny (values or pointers) compile unchanged.
+type CanUseToolFunc func(ctx context.Context, toolName string, input map[string]interface{}, permCtx ToolPermissionContext) (PermissionResult, error)
 
 // HookCallbackFunc is a callback function for hook events.
-// It receives the hook input, optional tool use ID, and context, and returns hook output.
+// It receives the hook input, optional tool use ID, and context, and returns hook output:
+// a map[string]interface{}, or a SyncHookJSONOutput or AsyncHookJSONOutput (value or pointer).
+// A hookSpecificOutput without a hookEventName is sent with the name of the event that fired.
 type HookCallbackFunc func(ctx context.Context, input interface{}, toolUseID *string, hookCtx HookContext) (interface{}, error)
 
+// ToolResultScreener inspects the text of a tool result for prompt
+// injection. It returns the text with any injected instructions removed, or
+// unchanged, and whether the text looks like an injection attempt.
+type ToolResultScreener func(content string) (sanitized string, flagged bool)
+
+// ToolInterceptorFunc runs a tool call in place of the CLI, as set with
+// WithToolInterceptor. It returns the content of the tool's result, a string
+// or a []ToolResultPart, and whether the result is an error. A non-nil error
+// is given to the model as an error result.
+type ToolInterceptorFunc func(ctx context.Context, input map[string]interface{}) (content interface{}, isError bool, err error)
+
 // HookMatcher represents a hook matcher configuration.
 type HookMatcher struct {
-	Matcher *string            `json:"matcher,omitempty"` // Regex pattern for matching (e.g., "Bash", "Write|Edit")
-	Hooks   []HookCallbackFunc `json:"-"`                 // List of hook callback functions (not marshaled)
+	Matcher  *string            `json:"matcher,omitempty"` // Regex pattern for matching (e.g., "Bash", "Write|Edit")
+	Hooks    []HookCallbackFunc `json:"-"`                 // List of hook callback functions (not marshaled)
+	Enforced bool               `json:"-"`                 // Keep the hooks' permissionDecision under PermissionPrecedenceCallback
+}
+
+// WriteBatching configures coalescing of writes to the CLI's stdin.
+// Buffered lines are flushed when MaxBytes are pending or MaxDelay after the
+// first pending line, whichever comes first. Zero values use the SDK defaults.
+type WriteBatching struct {
+	MaxDelay time.Duration `json:"max_delay,omitempty"`
+	MaxBytes int           `json:"max_bytes,omitempty"`
+}
+
+// Retry configures retrying the start of a session after a transient
+// failure, as set with WithRetry.
+type Retry struct {
+	MaxAttempts int           `json:"max_attempts"`      // Attempts in all, the first included
+	Backoff     time.Duration `json:"backoff,omitempty"` // Wait before the second attempt, doubled for each further one
 }
 
 // StderrCallbackFunc is a callback function for stderr output from the CLI.
 type StderrCallbackFunc func(line string)
 
 // ClaudeAgentOptions represents configuration options for the Claude SDK.
+//
+// Query and NewClient copy the options on entry and never modify the caller's
+// value, so a single ClaudeAgentOptions may be shared read-only across any
+// number of concurrent Query and NewClient calls. Mutating it (including via
+// the With* builders) while such calls are in flight is a data race.
 type ClaudeAgentOptions struct {
 	// Tool configuration
 	AllowedTools    []string `json:"allowed_tools,omitempty"`
@@ -87,8 +195,20 @@ type ClaudeAgentOptions struct {
 	McpServers interface{} `json:"mcp_servers,omitempty"`
 
 	// Permission configuration
-	PermissionMode           *PermissionMode `json:"permission_mode,omitempty"`
-	PermissionPromptToolName *string         `json:"permission_prompt_tool_name,omitempty"`
+	PermissionMode           *PermissionMode      `json:"permission_mode,omitempty"`
+	PermissionPromptToolName *string              `json:"permission_prompt_tool_name,omitempty"`
+	PermissionPrecedence     PermissionPrecedence `json:"permission_precedence,omitempty"` // Hook vs CanUseTool decisions (empty means hook)
+	PermissionPolicy         *PermissionPolicy    `json:"permission_policy,omitempty"`     // Declarative rules evaluated in place of CanUseTool
+	AbandonedPolicy          *PermissionPolicy    `json:"abandoned_policy,omitempty"`      // Answers requests withdrawn with Client.AbandonPermission
+
+	// Hook and permission inputs with fields larger than MaxCallbackPayloadBytes
+	// reach callbacks as CallbackPayloadPolicy says (0 passes them whole)
+	MaxCallbackPayloadBytes int                   `json:"max_callback_payload_bytes,omitempty"`
+	CallbackPayloadPolicy   CallbackPayloadPolicy `json:"callback_payload_policy,omitempty"` // Empty means truncate
+
+	// StrictProtocol validates control responses before they are written
+	// (nil disables it)
+	StrictProtocol *bool `json:"strict_protocol,omitempty"`
 
 	// Session configuration
 	ContinueConversation bool    `json:"continue_conversation,omitempty"`
@@ -96,12 +216,59 @@ type ClaudeAgentOptions struct {
 	ForkSession          bool    `json:"fork_session,omitempty"`
 
 	// Model and execution limits
-	Model    *string `json:"model,omitempty"`
-	MaxTurns *int    `json:"max_turns,omitempty"`
+	Model           *string  `json:"model,omitempty"`
+	MaxTurns        *int     `json:"max_turns,omitempty"`
+	MaxCostUSD      *float64 `json:"max_cost_usd,omitempty"`      // Session cost ceiling enforced by the SDK
+	MaxPromptTokens *int     `json:"max_prompt_tokens,omitempty"` // Reject prompts estimated larger than this
+
+	// Extended thinking (nil leaves the CLI's default)
+	MaxThinkingTokens *int  `json:"max_thinking_tokens,omitempty"` // Thinking budget per response
+	ThinkingEnabled   *bool `json:"thinking_enabled,omitempty"`    // false disables thinking
 
 	// Working directory and CLI path
-	CWD     *string `json:"cwd,omitempty"`
-	CLIPath *string `json:"cli_path,omitempty"`
+	CWD       *string `json:"cwd,omitempty"`
+	CreateCWD bool    `json:"create_cwd,omitempty"` // Create CWD (and parents) if it doesn't exist
+	CLIPath   *string `json:"cli_path,omitempty"`
+
+	// AllowedRoots confines CWD, AddDirs and file tool paths to these directories
+	AllowedRoots []string `json:"allowed_roots,omitempty"`
+
+	// MinCLIVersion is the oldest CLI version Connect accepts
+	MinCLIVersion *string `json:"min_cli_version,omitempty"`
+
+	// ConnectTimeout bounds Connect independently of the caller's context
+	// (nil uses DefaultConnectTimeout; non-positive disables it)
+	ConnectTimeout *time.Duration `json:"connect_timeout,omitempty"`
+
+	// Retry retries Query and Connect after transient failures to start the
+	// CLI (nil makes one attempt)
+	Retry *Retry `json:"retry,omitempty"`
+
+	// IdleTimeout stops a response when the CLI is silent for this long
+	// (nil or non-positive disables it)
+	IdleTimeout *time.Duration `json:"idle_timeout,omitempty"`
+
+	// ConsumerTimeout ends a Query whose channel is not read for this long
+	// (nil uses DefaultConsumerTimeout; non-positive disables it)
+	ConsumerTimeout *time.Duration `json:"consumer_timeout,omitempty"`
+
+	// CloseTimeout is how long Close waits for the CLI to exit before killing
+	// it, whatever the state of the caller's context (nil uses
+	// DefaultCloseTimeout; non-positive waits only as long as the context allows)
+	CloseTimeout *time.Duration `json:"close_timeout,omitempty"`
+
+	// CancelTimeout is how long a Query cancelled mid-turn waits for the CLI
+	// to end the turn after interrupting it, before killing it (nil uses
+	// DefaultCancelTimeout; non-positive kills it at once)
+	CancelTimeout *time.Duration `json:"cancel_timeout,omitempty"`
+
+	// DrainOnClose is how long Close keeps reading the CLI's output after
+	// closing its input, before the CloseTimeout starts (nil or non-positive
+	// does not drain)
+	DrainOnClose *time.Duration `json:"drain_on_close,omitempty"`
+
+	// SubprocessWaitPolicy applies when the subprocess limit is reached (empty means block)
+	SubprocessWaitPolicy SubprocessWaitPolicy `json:"subprocess_wait_policy,omitempty"`
 
 	// Settings
 	Settings       *string         `json:"settings,omitempty"`
@@ -109,25 +276,65 @@ type ClaudeAgentOptions struct {
 	AddDirs        []string        `json:"add_dirs,omitempty"`
 
 	// Environment and extra arguments
-	Env       map[string]string  `json:"env,omitempty"`
-	ExtraArgs map[string]*string `json:"extra_args,omitempty"` // Pass arbitrary CLI flags
+	Env              map[string]string  `json:"env,omitempty"`
+	EnvFile          string             `json:"env_file,omitempty"`          // dotenv file merged under Env
+	DeterministicEnv bool               `json:"deterministic_env,omitempty"` // Set DeterministicEnvVars under EnvFile and Env
+	ExtraArgs        map[string]*string `json:"extra_args,omitempty"`        // Pass arbitrary CLI flags
 
 	// Buffer configuration
-	MaxBufferSize *int `json:"max_buffer_size,omitempty"` // Max bytes when buffering CLI stdout
+	MaxBufferSize   *int           `json:"max_buffer_size,omitempty"`   // Max bytes when buffering CLI stdout
+	MaxMessageDepth *int           `json:"max_message_depth,omitempty"` // Max nesting of a line of CLI stdout
+	WriteBatching   *WriteBatching `json:"write_batching,omitempty"`    // Coalesce stdin writes (nil flushes every write)
+
+	// Limits on each line written to the CLI's stdin (nil uses the default;
+	// non-positive disables the limit)
+	MaxOutboundSize  *int `json:"max_outbound_size,omitempty"`  // Larger lines fail with OutboundTooLargeError
+	OutboundWarnSize *int `json:"outbound_warn_size,omitempty"` // Larger lines are written with a warning
 
 	// Streaming configuration
 	IncludePartialMessages bool `json:"include_partial_messages,omitempty"`
+	RawMessages            bool `json:"raw_messages,omitempty"`      // Keep the original JSON of each message (see Message.GetRaw)
+	LenientParsing         bool `json:"lenient_parsing,omitempty"`   // Deliver unknown message and block types instead of parse errors
+	SyntheticResults       bool `json:"synthetic_results,omitempty"` // End a turn abandoned without a result with a synthetic ResultMessage
 
 	// User identifier
 	User *string `json:"user,omitempty"`
 
+	// Transcript tracking
+	CaptureTranscriptPath bool `json:"capture_transcript_path,omitempty"` // Ensure a hook reports the transcript path (see Client.TranscriptPath)
+
+	// MessageHistory is how many recent messages Client.History keeps (0 keeps none)
+	MessageHistory int `json:"message_history,omitempty"`
+
 	// Agent definitions
 	Agents map[string]AgentDefinition `json:"agents,omitempty"`
 
+	// Logging (not marshaled to JSON; nil logs nothing)
+	Logger *slog.Logger `json:"-"`
+
+	// Metrics (not marshaled to JSON; nil records nothing)
+	MetricsSink MetricsSink `json:"-"`
+
+	// Tracing (not marshaled to JSON; nil creates no spans)
+	Tracer Tracer `json:"-"`
+
+	// Session transcript (not marshaled to JSON; nil records nothing)
+	Transcript io.Writer `json:"-"`
+
 	// Callbacks (not marshaled to JSON)
 	CanUseTool CanUseToolFunc              `json:"-"`
 	Hooks      map[HookEvent][]HookMatcher `json:"-"`
 	Stderr     StderrCallbackFunc          `json:"-"`
+
+	// Hook events that TurnOptions.Hooks may use (not marshaled to JSON)
+	TurnHookEvents []HookEvent `json:"-"`
+
+	// Prompt injection screening of tool results (not marshaled to JSON)
+	ToolResultScreener      ToolResultScreener `json:"-"`
+	ToolResultScreeningNote bool               `json:"-"` // Tell the model when a result is flagged
+
+	// Tools the SDK runs in place of the CLI, by name (not marshaled to JSON)
+	ToolInterceptors map[string]ToolInterceptorFunc `json:"-"`
 }
 
 // NewClaudeAgentOptions creates a new ClaudeAgentOptions with sensible defaults.
@@ -143,13 +350,16 @@ func NewClaudeAgentOptions() *ClaudeAgentOptions {
 	}
 }
 
-// WithAllowedTools sets the allowed tools.
+// WithAllowedTools sets the tools the CLI may use without asking for
+// permission, passed as --allowedTools.
 func (o *ClaudeAgentOptions) WithAllowedTools(tools ...string) *ClaudeAgentOptions {
 	o.AllowedTools = tools
 	return o
 }
 
-// WithDisallowedTools sets the disallowed tools.
+// WithDisallowedTools sets tools the CLI must not use, passed as
+// --disallowedTools; other tools keep their default permissions. A tool may
+// not appear in both lists, or NewClient and Query return an error.
 func (o *ClaudeAgentOptions) WithDisallowedTools(tools ...string) *ClaudeAgentOptions {
 	o.DisallowedTools = tools
 	return o
@@ -191,6 +401,66 @@ func (o *ClaudeAgentOptions) WithPermissionPromptToolName(toolName string) *Clau
 	return o
 }
 
+// WithPermissionPrecedence sets which of a PreToolUse hook's
+// permissionDecision and the CanUseTool callback wins when both are
+// configured. The default is PermissionPrecedenceHook.
+func (o *ClaudeAgentOptions) WithPermissionPrecedence(precedence PermissionPrecedence) *ClaudeAgentOptions {
+	o.PermissionPrecedence = precedence
+	return o
+}
+
+// WithMaxCallbackPayloadBytes limits the size in bytes of what hook and
+// permission callbacks receive, such as the tool_response of a PostToolUse
+// hook. A control request from the CLI larger than limit is not decoded
+// whole: each top-level field of its input within the limit is decoded as
+// usual, and each larger one is handled as WithCallbackPayloadPolicy says,
+// truncated to about limit bytes by default. A permission request allowed
+// without an updated input still echoes the CLI's input unchanged. A
+// non-positive limit, the default, decodes every input whole.
+func (o *ClaudeAgentOptions) WithMaxCallbackPayloadBytes(limit int) *ClaudeAgentOptions {
+	o.MaxCallbackPayloadBytes = limit
+	return o
+}
+
+// WithCallbackPayloadPolicy sets how callbacks receive the fields of an
+// input over WithMaxCallbackPayloadBytes: truncated with TruncatedMarker
+// (CallbackPayloadTruncate, the default) or undecoded as a json.RawMessage
+// (CallbackPayloadRaw). HookContext.Input is nil for a hook input with raw
+// fields, since typing it would decode them.
+func (o *ClaudeAgentOptions) WithCallbackPayloadPolicy(policy CallbackPayloadPolicy) *ClaudeAgentOptions {
+	o.CallbackPayloadPolicy = policy
+	return o
+}
+
+// WithStrictProtocol sets whether hook, permission and MCP responses are
+// checked against the control protocol before they are sent to the CLI. A
+// response the CLI would reject or hang on, such as a hook returning
+// "permissionDecision": "Allow" or a permission result without a behavior, is
+// then answered with an error response naming the offending field instead.
+// Strict mode is off by default; turning it on in tests catches such
+// mistakes before they reach a real CLI.
+func (o *ClaudeAgentOptions) WithStrictProtocol(enabled bool) *ClaudeAgentOptions {
+	o.StrictProtocol = &enabled
+	return o
+}
+
+// WithPermissionPolicy answers permission prompts with a declarative policy
+// evaluated in the SDK. It cannot be combined with WithCanUseTool.
+func (o *ClaudeAgentOptions) WithPermissionPolicy(policy PermissionPolicy) *ClaudeAgentOptions {
+	o.PermissionPolicy = policy.Clone()
+	return o
+}
+
+// WithAbandonedPermissionPolicy sets the policy that answers a permission
+// request withdrawn with Client.AbandonPermission. Without one, an abandoned
+// request is answered as the permission mode would answer it without a
+// callback: allowed under PermissionModeBypassPermissions, allowed for file
+// edits under PermissionModeAcceptEdits, and denied otherwise.
+func (o *ClaudeAgentOptions) WithAbandonedPermissionPolicy(policy PermissionPolicy) *ClaudeAgentOptions {
+	o.AbandonedPolicy = policy.Clone()
+	return o
+}
+
 // WithContinueConversation sets whether to continue the conversation.
 func (o *ClaudeAgentOptions) WithContinueConversation(continue_ bool) *ClaudeAgentOptions {
 	o.ContinueConversation = continue_
@@ -221,27 +491,206 @@ func (o *ClaudeAgentOptions) WithMaxTurns(maxTurns int) *ClaudeAgentOptions {
 	return o
 }
 
+// WithMaxThinkingTokens sets the most tokens the model may spend on extended
+// thinking for each response, passed to the CLI as --max-thinking-tokens.
+// 0 disables thinking; a negative budget is rejected by NewClient and Query.
+func (o *ClaudeAgentOptions) WithMaxThinkingTokens(tokens int) *ClaudeAgentOptions {
+	o.MaxThinkingTokens = &tokens
+	return o
+}
+
+// WithThinkingEnabled turns extended thinking on or off. Enabled without
+// WithMaxThinkingTokens, the budget is DefaultMaxThinkingTokens; disabled, it
+// is 0, and setting a positive budget as well is rejected as a conflict.
+func (o *ClaudeAgentOptions) WithThinkingEnabled(enabled bool) *ClaudeAgentOptions {
+	o.ThinkingEnabled = &enabled
+	return o
+}
+
+// WithMaxCostUSD sets a cost ceiling for the session in US dollars.
+// Once the cost exceeds the limit, the SDK interrupts the session and refuses
+// further queries with a BudgetExceededError. A cost exactly at the limit is
+// allowed. The cost is the TotalCostUSD the CLI reports at the end of each
+// turn; while a turn runs, the usage of each AssistantMessage is priced with
+// EstimateCostUSD and added to it, so a turn running over the limit is
+// interrupted before it ends.
+func (o *ClaudeAgentOptions) WithMaxCostUSD(limit float64) *ClaudeAgentOptions {
+	o.MaxCostUSD = &limit
+	return o
+}
+
+// WithMaxPromptTokens rejects prompts whose estimated size exceeds limit
+// tokens with a PromptTooLargeError, before the CLI is started or anything is
+// written to it. The size comes from EstimateTokensForModel and is
+// approximate, so leave some headroom below the model's context window.
+func (o *ClaudeAgentOptions) WithMaxPromptTokens(limit int) *ClaudeAgentOptions {
+	o.MaxPromptTokens = &limit
+	return o
+}
+
 // WithCWD sets the working directory.
+// Relative paths are resolved against the caller's current directory and a
+// leading ~ is expanded to the user's home directory.
 func (o *ClaudeAgentOptions) WithCWD(cwd string) *ClaudeAgentOptions {
 	o.CWD = &cwd
 	return o
 }
 
+// WithCreateCWD sets whether the working directory should be created (including
+// parents) if it does not exist. When false, a missing directory is an error.
+func (o *ClaudeAgentOptions) WithCreateCWD(create bool) *ClaudeAgentOptions {
+	o.CreateCWD = create
+	return o
+}
+
+// WithAllowedRoots turns on hard isolation: the session may only work
+// inside the given directories. NewClient and Query fail with
+// UnsafeWorkingDirectoryError unless the working directory (the caller's
+// current directory when WithCWD is not set) and every WithAddDirs
+// directory lie inside one of the roots, after symlinks are resolved.
+//
+// The file tools (Read, Write, Edit, MultiEdit, NotebookEdit, Glob, Grep and
+// the like) are then jailed by a PreToolUse hook to the roots that matched,
+// and calls naming a path outside them are denied. The hook only sees the
+// paths in tool inputs, so pair it with WithDisallowedTools("Bash") when
+// commands must not reach outside the roots either.
+//
+// Paths are compared case-insensitively on macOS and Windows. Roots may use
+// a leading ~ and relative paths, resolved like WithCWD.
+func (o *ClaudeAgentOptions) WithAllowedRoots(paths ...string) *ClaudeAgentOptions {
+	o.AllowedRoots = paths
+	return o
+}
+
 // WithCLIPath sets the CLI binary path.
 func (o *ClaudeAgentOptions) WithCLIPath(cliPath string) *ClaudeAgentOptions {
 	o.CLIPath = &cliPath
 	return o
 }
 
-// WithSettings sets the settings file path.
+// WithMinCLIVersion makes Connect fail with UnsupportedCLIVersionError when the
+// CLI reports a version older than version, such as "1.0.100". CLIs whose
+// version cannot be determined are accepted.
+func (o *ClaudeAgentOptions) WithMinCLIVersion(version string) *ClaudeAgentOptions {
+	o.MinCLIVersion = &version
+	return o
+}
+
+// WithConnectTimeout bounds how long Connect may take to start the CLI and
+// complete the initialize handshake, even when the caller's context has no
+// deadline. The default is DefaultConnectTimeout; a non-positive duration
+// disables the timeout.
+func (o *ClaudeAgentOptions) WithConnectTimeout(d time.Duration) *ClaudeAgentOptions {
+	o.ConnectTimeout = &d
+	return o
+}
+
+// WithRetry makes Query and Client.Connect try up to maxAttempts times in
+// all to start the CLI, waiting backoff before the second attempt and twice
+// as long before each further one. Only transient failures are retried, as
+// classified by IsRetryable: the CLI failing to start, exiting before its
+// first message, or not completing the handshake within the connect timeout.
+// Each attempt starts a new CLI process, so the caller's context must allow
+// for every attempt. Clients created with NewClientWithTransport, and
+// QueryWithTransport, are not retried.
+//
+// With retries, Query returns once the CLI has sent its first message, so
+// that a CLI that exits before then can be started again.
+func (o *ClaudeAgentOptions) WithRetry(maxAttempts int, backoff time.Duration) *ClaudeAgentOptions {
+	o.Retry = &Retry{MaxAttempts: maxAttempts, Backoff: backoff}
+	return o
+}
+
+// WithIdleTimeout stops a response when no message arrives from the CLI for
+// d, independently of the context deadline. The timer restarts on every
+// message, stream events included. When it fires the CLI process is stopped,
+// an idle_timeout SystemMessage is emitted, and the channel is closed; later
+// Client.Query calls fail with IdleTimeoutError. A non-positive duration
+// disables the timeout.
+func (o *ClaudeAgentOptions) WithIdleTimeout(d time.Duration) *ClaudeAgentOptions {
+	o.IdleTimeout = &d
+	return o
+}
+
+// WithConsumerTimeout bounds how long Query waits for the caller to receive
+// the next message from its channel. A caller that stops reading without
+// cancelling the context would otherwise leave the CLI running and Query's
+// goroutines blocked forever; once d passes with a message pending, the CLI
+// is stopped and the channel is closed. Cancelling the context remains the
+// way to stop reading early. The default is DefaultConsumerTimeout; a
+// non-positive duration disables the timeout.
+func (o *ClaudeAgentOptions) WithConsumerTimeout(d time.Duration) *ClaudeAgentOptions {
+	o.ConsumerTimeout = &d
+	return o
+}
+
+// WithCloseTimeout sets how long Close gives the CLI to finish and exit after
+// its input is closed before killing it. The grace period applies even when
+// Close is called with a context that is already cancelled, such as in a defer
+// after a timeout; a context that is still alive can only shorten it. The
+// default is DefaultCloseTimeout; a non-positive duration waits only as long
+// as the context allows, killing the CLI at once if it is already done.
+func (o *ClaudeAgentOptions) WithCloseTimeout(d time.Duration) *ClaudeAgentOptions {
+	o.CloseTimeout = &d
+	return o
+}
+
+// WithCancelTimeout sets how long a Query whose context is cancelled
+// mid-turn gives the CLI to end the turn before killing it. When the query
+// uses the control protocol, because a permission callback or hooks are set,
+// cancelling its context sends the CLI an interrupt request and waits for
+// the turn's ResultMessage, so that the CLI saves the session transcript;
+// the CLI is then left to exit on its own. Messages read meanwhile are not
+// delivered. Without the control protocol, or if the interrupt fails or no
+// result arrives within d, the CLI is killed. The default is
+// DefaultCancelTimeout; a non-positive duration kills the CLI at once.
+func (o *ClaudeAgentOptions) WithCancelTimeout(d time.Duration) *ClaudeAgentOptions {
+	o.CancelTimeout = &d
+	return o
+}
+
+// WithDrainOnClose makes Client.Close close the CLI's input and keep
+// reading its output for up to d, so that messages the CLI flushes on the
+// way out, such as the final ResultMessage, are recorded rather than dropped.
+// The drain ends early when the CLI closes its output. The WithCloseTimeout
+// grace period starts once it ends, so a CLI that is still running is killed
+// after at most d plus the close timeout. As with the close timeout, the
+// window applies even if Close's context is already cancelled; a live
+// context can only shorten it.
+func (o *ClaudeAgentOptions) WithDrainOnClose(d time.Duration) *ClaudeAgentOptions {
+	o.DrainOnClose = &d
+	return o
+}
+
+// WithSubprocessWaitPolicy sets what Connect does when the process-wide limit
+// set with claude.SetMaxSubprocesses is reached: wait for a subprocess to exit
+// (SubprocessWaitBlock, the default) or fail with TooManyProcessesError
+// (SubprocessWaitFail).
+func (o *ClaudeAgentOptions) WithSubprocessWaitPolicy(policy SubprocessWaitPolicy) *ClaudeAgentOptions {
+	o.SubprocessWaitPolicy = policy
+	return o
+}
+
+// WithSettings sets the settings the CLI loads on top of its setting sources,
+// passed as --settings. pathOrJSON is the path of a settings file, or a JSON
+// object of settings; JSON is written to a temporary file that is removed
+// when the transport closes.
+//
+// Example:
+//
+//	opts := types.NewClaudeAgentOptions().
+//	    WithSettings(`{"permissions":{"deny":["Bash(rm:*)"]}}`)
 func (o *ClaudeAgentOptions) WithSettings(settings string) *ClaudeAgentOptions {
 	o.Settings = &settings
 	return o
 }
 
-// WithSettingSources sets the setting sources to load.
+// WithSettingSources sets which settings files the CLI loads, passed as
+// --setting-sources. By default the CLI loads all of them, so behavior
+// depends on the machine and directory it runs in; calling WithSettingSources
+// with no sources loads none.
 func (o *ClaudeAgentOptions) WithSettingSources(sources ...SettingSource) *ClaudeAgentOptions {
-	o.SettingSources = sources
+	o.SettingSources = append([]SettingSource{}, sources...)
 	return o
 }
 
@@ -266,14 +715,62 @@ func (o *ClaudeAgentOptions) WithEnvVar(key, value string) *ClaudeAgentOptions {
 	return o
 }
 
-// WithExtraArgs sets extra CLI arguments.
-func (o *ClaudeAgentOptions) WithExtraArgs(args map[string]*string) *ClaudeAgentOptions {
+// WithEnvFile loads environment variables for the CLI from a dotenv file,
+// such as a local .env holding API keys. The file is read when the client or
+// query is created, and a relative path is resolved against the current
+// directory. The parent process environment is not changed.
+//
+// Precedence, highest first: variables set with WithEnv or WithEnvVar, then
+// the file, then the environment the CLI inherits.
+//
+// The file holds one KEY=VALUE per line. Blank lines and # comments are
+// ignored, and an "export " prefix is allowed. Values may be single-quoted
+// (literal) or double-quoted (with \n, \t, \" and \\ escapes), and quoted
+// values may span lines; variables are not expanded.
+func (o *ClaudeAgentOptions) WithEnvFile(path string) *ClaudeAgentOptions {
+	o.EnvFile = path
+	return o
+}
+
+// DeterministicEnvVars returns the variables WithDeterministicEnv sets: the C
+// locale, UTC, and a fixed SOURCE_DATE_EPOCH for tools that honor it.
+func DeterministicEnvVars() map[string]string {
+	return map[string]string{
+		"LC_ALL":            "C",
+		"TZ":                "UTC",
+		"SOURCE_DATE_EPOCH": "0",
+	}
+}
+
+// WithDeterministicEnv sets whether the CLI, and so the commands its tools
+// run, gets the variables of DeterministicEnvVars, making locale-dependent
+// output such as dates, sort order and number formats the same on every
+// machine. It is an aid for evaluations that compare tool output across
+// runs. The variables override the inherited environment; set one with
+// WithEnvVar or in WithEnvFile to override it in turn.
+func (o *ClaudeAgentOptions) WithDeterministicEnv(enabled bool) *ClaudeAgentOptions {
+	o.DeterministicEnv = enabled
+	return o
+}
+
+// WithExtraCLIArgs sets flags passed to the CLI as they are, for CLI
+// features that have no builder yet. Keys are flag names with or without
+// their leading dashes; a nil value passes a boolean flag (--name), any other
+// value passes --name value. The flags are appended after the ones the SDK
+// generates, sorted by name. Overriding a flag the SDK manages, such as
+// --output-format or --allowedTools, is rejected by NewClient and Query.
+//
+// Example:
+//
+//	debug := "api"
+//	opts.WithExtraCLIArgs(map[string]*string{"debug": &debug, "strict-mcp-config": nil})
+func (o *ClaudeAgentOptions) WithExtraCLIArgs(args map[string]*string) *ClaudeAgentOptions {
 	o.ExtraArgs = args
 	return o
 }
 
-// WithExtraArg sets a single extra CLI argument.
-func (o *ClaudeAgentOptions) WithExtraArg(key string, value *string) *ClaudeAgentOptions {
+// WithExtraCLIArg sets a single extra CLI argument; see WithExtraCLIArgs.
+func (o *ClaudeAgentOptions) WithExtraCLIArg(key string, value *string) *ClaudeAgentOptions {
 	if o.ExtraArgs == nil {
 		o.ExtraArgs = make(map[string]*string)
 	}
@@ -281,9 +778,165 @@ func (o *ClaudeAgentOptions) WithExtraArg(key string, value *string) *ClaudeAgen
 	return o
 }
 
+// WithExtraArgs sets extra CLI arguments.
+//
+// Deprecated: Use WithExtraCLIArgs instead.
+func (o *ClaudeAgentOptions) WithExtraArgs(args map[string]*string) *ClaudeAgentOptions {
+	recordDeprecation("WithExtraArgs")
+	return o.WithExtraCLIArgs(args)
+}
+
+// WithExtraArg sets a single extra CLI argument.
+//
+// Deprecated: Use WithExtraCLIArg instead.
+func (o *ClaudeAgentOptions) WithExtraArg(key string, value *string) *ClaudeAgentOptions {
+	recordDeprecation("WithExtraArg")
+	return o.WithExtraCLIArg(key, value)
+}
+
+// WithMessageHistory keeps the last limit messages of a Client's
+// conversation, the prompts sent and the messages received, for
+// Client.History, which returns them by compaction segment. Stream events are
+// not kept. A non-positive limit keeps none, the default; Client.Segment
+// counts compactions either way.
+func (o *ClaudeAgentOptions) WithMessageHistory(limit int) *ClaudeAgentOptions {
+	o.MessageHistory = limit
+	return o
+}
+
+// WithMaxMessageSize sets the maximum size in bytes of a single JSON message
+// read from the CLI's stdout (1MB by default; non-positive values use the
+// default). A longer line stops the session: the transport fails with a
+// JSONDecodeError wrapping a MessageLimitError.
+func (o *ClaudeAgentOptions) WithMaxMessageSize(size int) *ClaudeAgentOptions {
+	o.MaxBufferSize = &size
+	return o
+}
+
+// WithMaxMessageDepth sets how deeply objects and arrays may nest in a
+// single JSON message read from the CLI's stdout (DefaultMaxMessageDepth by
+// default; non-positive values use the default). The depth of each line is
+// counted before it is decoded, so a pathological line is rejected cheaply:
+// it is reported as a parse_error SystemMessage whose Err is a
+// MessageLimitError, and the session goes on.
+func (o *ClaudeAgentOptions) WithMaxMessageDepth(depth int) *ClaudeAgentOptions {
+	o.MaxMessageDepth = &depth
+	return o
+}
+
+// WithMaxOutboundSize sets the maximum size in bytes of a single line written
+// to the CLI's stdin (DefaultMaxOutboundSize by default; a non-positive size
+// disables the limit). A longer line is not written: the write fails with an
+// OutboundTooLargeError and the session continues. A control response that is
+// too large, such as a huge tool result from an interceptor, is replaced by
+// an error response, so the CLI reports the failure rather than waiting.
+// Raise the limit only for a CLI known to accept longer lines.
+func (o *ClaudeAgentOptions) WithMaxOutboundSize(size int) *ClaudeAgentOptions {
+	o.MaxOutboundSize = &size
+	return o
+}
+
+// WithOutboundWarnSize sets the size in bytes above which a line written to
+// the CLI's stdin is logged as a warning through WithLogger and counted as
+// MetricOversizedWrites (DefaultOutboundWarnSize by default; a non-positive
+// size disables the warning). Such lines are still written.
+func (o *ClaudeAgentOptions) WithOutboundWarnSize(size int) *ClaudeAgentOptions {
+	o.OutboundWarnSize = &size
+	return o
+}
+
 // WithMaxBufferSize sets the maximum buffer size.
+//
+// Deprecated: Use WithMaxMessageSize instead.
 func (o *ClaudeAgentOptions) WithMaxBufferSize(size int) *ClaudeAgentOptions {
-	o.MaxBufferSize = &size
+	recordDeprecation("WithMaxBufferSize")
+	return o.WithMaxMessageSize(size)
+}
+
+// WithWriteBatching enables coalescing of writes to the CLI's stdin, which
+// reduces syscalls in control-heavy sessions with many hook and permission
+// responses. Non-positive values use the defaults (1ms, 64KB).
+func (o *ClaudeAgentOptions) WithWriteBatching(maxDelay time.Duration, maxBytes int) *ClaudeAgentOptions {
+	o.WriteBatching = &WriteBatching{MaxDelay: maxDelay, MaxBytes: maxBytes}
+	return o
+}
+
+// WithRawMessages sets whether each message keeps the exact JSON line the CLI
+// sent, available from Message.GetRaw. This costs one copy per message and is
+// off by default.
+func (o *ClaudeAgentOptions) WithRawMessages(enabled bool) *ClaudeAgentOptions {
+	o.RawMessages = enabled
+	return o
+}
+
+// WithLenientParsing sets whether messages and content blocks of types this
+// SDK does not know, such as ones added by a newer CLI, are delivered as
+// UnknownMessage and UnknownBlock carrying their JSON. By default such a
+// message is replaced by a parse_error SystemMessage and its data is lost.
+func (o *ClaudeAgentOptions) WithLenientParsing(enabled bool) *ClaudeAgentOptions {
+	o.LenientParsing = enabled
+	return o
+}
+
+// WithSyntheticResults sets whether a turn the CLI abandons without a
+// ResultMessage, because it exited, the transport failed, it went idle past
+// WithIdleTimeout or it sent a SystemMessage of subtype "error", still ends
+// with one: the SDK emits a ResultMessage with subtype ResultSubtypeSynthetic,
+// IsError set and no usage or cost after the SystemMessage reporting why, so
+// that consumers waiting for a result always get one. Off by default. See
+// ResultMessage.IsSynthetic.
+func (o *ClaudeAgentOptions) WithSyntheticResults(enabled bool) *ClaudeAgentOptions {
+	o.SyntheticResults = enabled
+	return o
+}
+
+// WithCaptureTranscriptPath sets whether the SDK registers a no-op
+// UserPromptSubmit hook so the CLI reports its transcript path even when the
+// application has no hooks of its own. The path is then available from
+// Client.TranscriptPath after the first prompt.
+func (o *ClaudeAgentOptions) WithCaptureTranscriptPath(enabled bool) *ClaudeAgentOptions {
+	o.CaptureTranscriptPath = enabled
+	return o
+}
+
+// WithTranscript sets where the Client records every message it exchanges
+// with the CLI, one JSON object per line with its direction and time (see
+// claude.TranscriptWriter). Secret environment values and API keys are
+// redacted. The caller owns w and must close it after closing the Client.
+// A nil writer (the default) records nothing.
+func (o *ClaudeAgentOptions) WithTranscript(w io.Writer) *ClaudeAgentOptions {
+	o.Transcript = w
+	return o
+}
+
+// WithLogger sets the logger for SDK diagnostics. Subprocess lifecycle, every
+// line written to the CLI, and every message received are logged at Debug,
+// with payloads truncated and API keys and secret environment values
+// redacted. Control protocol requests and their responses are logged at Info,
+// as are client state transitions: connect started and finished, each prompt
+// sent (with its turn number), and Close. A nil logger (the default) disables
+// logging.
+func (o *ClaudeAgentOptions) WithLogger(logger *slog.Logger) *ClaudeAgentOptions {
+	o.Logger = logger
+	return o
+}
+
+// WithMetricsSink sets where the SDK reports metrics: queries sent, messages
+// received by type, bytes to and from the CLI, subprocess starts, connect and
+// response durations, and cumulative cost. See the Metric* constants for the
+// names. A nil sink (the default) records nothing.
+func (o *ClaudeAgentOptions) WithMetricsSink(sink MetricsSink) *ClaudeAgentOptions {
+	o.MetricsSink = sink
+	return o
+}
+
+// WithTracer sets the tracer a Client creates spans with: one for Connect
+// with a child for the initialize handshake, one per turn from the prompt
+// to its result carrying the session, cost and token usage, one per
+// permission request under the turn, and one for Close. The one-shot Query
+// functions are not traced. A nil tracer (the default) creates no spans.
+func (o *ClaudeAgentOptions) WithTracer(tracer Tracer) *ClaudeAgentOptions {
+	o.Tracer = tracer
 	return o
 }
 
@@ -299,7 +952,10 @@ func (o *ClaudeAgentOptions) WithUser(user string) *ClaudeAgentOptions {
 	return o
 }
 
-// WithAgents sets the agent definitions.
+// WithAgents sets the custom subagents the CLI can delegate to, keyed by
+// name. They are passed to the CLI as --agents, so the Task tool and
+// Client.RunSubagent can launch them and SubagentStop hooks fire when they
+// finish. NewClient and Query return an error for an invalid definition.
 func (o *ClaudeAgentOptions) WithAgents(agents map[string]AgentDefinition) *ClaudeAgentOptions {
 	o.Agents = agents
 	return o
@@ -315,6 +971,9 @@ func (o *ClaudeAgentOptions) WithAgent(name string, agent AgentDefinition) *Clau
 }
 
 // WithCanUseTool sets the tool permission callback.
+//
+// If a PreToolUse hook also returns a permissionDecision, the precedence set
+// with WithPermissionPrecedence decides which of the two applies.
 func (o *ClaudeAgentOptions) WithCanUseTool(callback CanUseToolFunc) *ClaudeAgentOptions {
 	o.CanUseTool = callback
 	return o
@@ -335,8 +994,201 @@ func (o *ClaudeAgentOptions) WithHook(event HookEvent, matcher HookMatcher) *Cla
 	return o
 }
 
-// WithStderr sets the stderr callback.
+// WithTurnHookEvents enables per-turn hooks for the given events: hooks for
+// them can then be passed in TurnOptions.Hooks to Client.QueryWithOptions.
+//
+// The CLI only learns which hooks a session has when it connects, so for each
+// event the SDK registers a hook at Connect that runs the current turn's
+// hooks, and answers with no opinion between such turns. Each enabled event
+// costs a round trip to the SDK whenever the CLI fires it.
+func (o *ClaudeAgentOptions) WithTurnHookEvents(events ...HookEvent) *ClaudeAgentOptions {
+	o.TurnHookEvents = append(o.TurnHookEvents, events...)
+	return o
+}
+
+// WithStderr sets a callback called with each line the CLI writes to stderr,
+// without its line ending. Lines longer than 64 KiB keep their first and last
+// 32 KiB around a "[N bytes truncated]" marker.
+//
+// The callback runs on its own goroutine, in order. If it falls behind by
+// more than a few hundred lines, further lines are dropped and reported with
+// a single "[N stderr lines dropped: callback too slow]" line, so that a slow
+// callback never blocks the CLI. Lines may still arrive shortly after Close.
 func (o *ClaudeAgentOptions) WithStderr(callback StderrCallbackFunc) *ClaudeAgentOptions {
 	o.Stderr = callback
 	return o
 }
+
+// WithToolResultScreening screens the results of the WebFetch, WebSearch and
+// Read tools for prompt injection, such as fetched pages telling the model to
+// ignore its instructions. The screener runs in a PostToolUse hook on the text
+// of each result; claude.DefaultToolResultScreener is a heuristic one.
+//
+// Each flagged result is reported by a tool_result_flagged SystemMessage from
+// ReceiveResponse or Query, just before the result itself, with the
+// tool_use_id, tool_name and sanitized text in its Data. The CLI keeps the
+// original result in the conversation; use WithToolResultScreeningNote to
+// also warn the model. A nil screener (the default) disables screening.
+func (o *ClaudeAgentOptions) WithToolResultScreening(screener ToolResultScreener) *ClaudeAgentOptions {
+	o.ToolResultScreener = screener
+	return o
+}
+
+// WithToolInterceptor runs calls of the named tool in Go instead of in the
+// CLI, for instance to run Bash commands in a sandbox the application
+// controls. A PreToolUse hook calls fn with the tool's input and stops the
+// CLI from running the tool.
+//
+// The control protocol has no way to hand the CLI a tool result, so the CLI
+// records the call as denied, with the text of fn's result as the reason:
+// the model sees that text, but not images, as the reason for a denial
+// rather than as the tool's output. In place of that denial, Query and
+// ReceiveResponse deliver a ToolResultBlock carrying fn's content and error
+// flag, with Substituted set to tell it from a result the CLI produced.
+// fn runs for every call of the tool, whatever the permission mode, callback
+// and other hooks decide, so it must make its own checks. Its denial reaches
+// the CLI even under PermissionPrecedenceCallback, so the CLI never runs an
+// intercepted call itself. A nil fn removes the interceptor.
+func (o *ClaudeAgentOptions) WithToolInterceptor(toolName string, fn ToolInterceptorFunc) *ClaudeAgentOptions {
+	if fn == nil {
+		delete(o.ToolInterceptors, toolName)
+		return o
+	}
+	if o.ToolInterceptors == nil {
+		o.ToolInterceptors = make(map[string]ToolInterceptorFunc)
+	}
+	o.ToolInterceptors[toolName] = fn
+	return o
+}
+
+// WithToolResultScreeningNote sets whether a result flagged by the
+// WithToolResultScreening screener also gets additionalContext telling the
+// model to treat its content as untrusted data rather than instructions,
+// along with the sanitized text when the screener changed it.
+func (o *ClaudeAgentOptions) WithToolResultScreeningNote(enabled bool) *ClaudeAgentOptions {
+	o.ToolResultScreeningNote = enabled
+	return o
+}
+
+// Clone returns a deep copy of the options.
+//
+// Slices, maps, and pointer fields are copied so that modifying the clone never
+// affects the original. Callback functions are shared, as are the contents of
+// SystemPrompt and McpServers beyond the top-level map of a
+// map[string]interface{} server configuration.
+func (o *ClaudeAgentOptions) Clone() *ClaudeAgentOptions {
+	if o == nil {
+		return nil
+	}
+
+	c := *o
+
+	c.AllowedTools = cloneSlice(o.AllowedTools)
+	c.DisallowedTools = cloneSlice(o.DisallowedTools)
+	c.SettingSources = cloneSlice(o.SettingSources)
+	c.AddDirs = cloneSlice(o.AddDirs)
+	c.AllowedRoots = cloneSlice(o.AllowedRoots)
+	c.TurnHookEvents = cloneSlice(o.TurnHookEvents)
+
+	if servers, ok := o.McpServers.(map[string]interface{}); ok && servers != nil {
+		copied := make(map[string]interface{}, len(servers))
+		for k, v := range servers {
+			copied[k] = v
+		}
+		c.McpServers = copied
+	}
+
+	c.PermissionMode = clonePtr(o.PermissionMode)
+	c.PermissionPromptToolName = clonePtr(o.PermissionPromptToolName)
+	c.PermissionPolicy = o.PermissionPolicy.Clone()
+	c.AbandonedPolicy = o.AbandonedPolicy.Clone()
+	c.Resume = clonePtr(o.Resume)
+	c.Model = clonePtr(o.Model)
+	c.MaxTurns = clonePtr(o.MaxTurns)
+	c.MaxThinkingTokens = clonePtr(o.MaxThinkingTokens)
+	c.ThinkingEnabled = clonePtr(o.ThinkingEnabled)
+	c.MaxCostUSD = clonePtr(o.MaxCostUSD)
+	c.MaxPromptTokens = clonePtr(o.MaxPromptTokens)
+	c.CWD = clonePtr(o.CWD)
+	c.CLIPath = clonePtr(o.CLIPath)
+	c.MinCLIVersion = clonePtr(o.MinCLIVersion)
+	c.ConnectTimeout = clonePtr(o.ConnectTimeout)
+	c.Retry = clonePtr(o.Retry)
+	c.IdleTimeout = clonePtr(o.IdleTimeout)
+	c.ConsumerTimeout = clonePtr(o.ConsumerTimeout)
+	c.CloseTimeout = clonePtr(o.CloseTimeout)
+	c.CancelTimeout = clonePtr(o.CancelTimeout)
+	c.DrainOnClose = clonePtr(o.DrainOnClose)
+	c.StrictProtocol = clonePtr(o.StrictProtocol)
+	c.Settings = clonePtr(o.Settings)
+	c.MaxBufferSize = clonePtr(o.MaxBufferSize)
+	c.MaxMessageDepth = clonePtr(o.MaxMessageDepth)
+	c.WriteBatching = clonePtr(o.WriteBatching)
+	c.MaxOutboundSize = clonePtr(o.MaxOutboundSize)
+	c.OutboundWarnSize = clonePtr(o.OutboundWarnSize)
+	c.User = clonePtr(o.User)
+
+	if o.Env != nil {
+		c.Env = make(map[string]string, len(o.Env))
+		for k, v := range o.Env {
+			c.Env[k] = v
+		}
+	}
+
+	if o.ToolInterceptors != nil {
+		c.ToolInterceptors = make(map[string]ToolInterceptorFunc, len(o.ToolInterceptors))
+		for k, v := range o.ToolInterceptors {
+			c.ToolInterceptors[k] = v
+		}
+	}
+
+	if o.ExtraArgs != nil {
+		c.ExtraArgs = make(map[string]*string, len(o.ExtraArgs))
+		for k, v := range o.ExtraArgs {
+			c.ExtraArgs[k] = clonePtr(v)
+		}
+	}
+
+	if o.Agents != nil {
+		c.Agents = make(map[string]AgentDefinition, len(o.Agents))
+		for k, v := range o.Agents {
+			v.Tools = cloneSlice(v.Tools)
+			v.Model = clonePtr(v.Model)
+			c.Agents[k] = v
+		}
+	}
+
+	if o.Hooks != nil {
+		c.Hooks = make(map[HookEvent][]HookMatcher, len(o.Hooks))
+		for event, matchers := range o.Hooks {
+			copied := make([]HookMatcher, len(matchers))
+			for i, m := range matchers {
+				copied[i] = HookMatcher{
+					Matcher:  clonePtr(m.Matcher),
+					Hooks:    cloneSlice(m.Hooks),
+					Enforced: m.Enforced,
+				}
+			}
+			c.Hooks[event] = copied
+		}
+	}
+
+	return &c
+}
+
+// cloneSlice returns a copy of s, preserving nil.
+func cloneSlice[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(s)), s...)
+}
+
+// clonePtr returns a pointer to a copy of *p, preserving nil.
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,143 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestOptionsClone tests that Clone produces an equal but independent copy.
+func TestOptionsClone(t *testing.T) {
+	model := "haiku"
+	matcher := "Bash"
+	value := "json"
+	hook := func(ctx context.Context, input interface{}, toolUseID *string, hookCtx HookContext) (interface{}, error) {
+		return nil, nil
+	}
+
+	orig := NewClaudeAgentOptions().
+		WithAllowedTools("Read").
+		WithModel("sonnet").
+		WithMaxTurns(3).
+		WithMaxCostUSD(1.5).
+		WithCWD("/tmp").
+		WithEnvVar("A", "1").
+		WithExtraCLIArg("format", &value).
+		WithAgent("reviewer", AgentDefinition{Description: "d", Prompt: "p", Tools: []string{"Read"}, Model: &model}).
+		WithHook(HookEventPreToolUse, HookMatcher{Matcher: &matcher, Hooks: []HookCallbackFunc{hook}}).
+		WithMcpServers(map[string]interface{}{"fs": McpStdioServerConfig{Command: "fs"}})
+
+	clone := orig.Clone()
+
+	// Functions can't be compared with DeepEqual; compare without hooks first.
+	origNoHooks, cloneNoHooks := *orig, *clone
+	origNoHooks.Hooks, cloneNoHooks.Hooks = nil, nil
+	if !reflect.DeepEqual(origNoHooks, cloneNoHooks) {
+		t.Fatalf("clone differs from original:\n%+v\n%+v", cloneNoHooks, origNoHooks)
+	}
+	if len(clone.Hooks[HookEventPreToolUse]) != 1 || len(clone.Hooks[HookEventPreToolUse][0].Hooks) != 1 {
+		t.Fatalf("hooks not cloned: %+v", clone.Hooks)
+	}
+
+	// Mutating the clone must not affect the original.
+	clone.AllowedTools[0] = "Write"
+	*clone.Model = "opus"
+	*clone.MaxTurns = 10
+	clone.Env["A"] = "2"
+	*clone.ExtraArgs["format"] = "text"
+	*clone.Agents["reviewer"].Model = "opus"
+	clone.Agents["reviewer"].Tools[0] = "Write"
+	*clone.Hooks[HookEventPreToolUse][0].Matcher = "Write"
+	clone.Hooks[HookEventPreToolUse] = append(clone.Hooks[HookEventPreToolUse], HookMatcher{})
+	clone.McpServers.(map[string]interface{})["other"] = "x"
+
+	if orig.AllowedTools[0] != "Read" || *orig.Model != "sonnet" || *orig.MaxTurns != 3 || orig.Env["A"] != "1" {
+		t.Errorf("original scalar fields modified: %+v", orig)
+	}
+	if *orig.ExtraArgs["format"] != "json" {
+		t.Errorf("original extra args modified")
+	}
+	if *orig.Agents["reviewer"].Model != "haiku" || orig.Agents["reviewer"].Tools[0] != "Read" {
+		t.Errorf("original agents modified: %+v", orig.Agents)
+	}
+	if *orig.Hooks[HookEventPreToolUse][0].Matcher != "Bash" || len(orig.Hooks[HookEventPreToolUse]) != 1 {
+		t.Errorf("original hooks modified")
+	}
+	if len(orig.McpServers.(map[string]interface{})) != 1 {
+		t.Errorf("original MCP servers modified")
+	}
+}
+
+// TestOptionsCloneNil tests that cloning nil options returns nil.
+func TestOptionsCloneNil(t *testing.T) {
+	var o *ClaudeAgentOptions
+	if o.Clone() != nil {
+		t.Error("expected nil clone of nil options")
+	}
+}
+
+// TestAgentDefinitionValidate tests that incomplete agent definitions are rejected
+func TestAgentDefinitionValidate(t *testing.T) {
+	model := "haiku"
+	empty := ""
+	valid := AgentDefinition{Description: "d", Prompt: "p", Tools: []string{"Read"}, Model: &model}
+
+	tests := []struct {
+		name    string
+		agent   AgentDefinition
+		wantErr string
+	}{
+		{"valid", valid, ""},
+		{"minimal", AgentDefinition{Description: "d", Prompt: "p"}, ""},
+		{"no description", AgentDefinition{Prompt: "p"}, "description"},
+		{"no prompt", AgentDefinition{Description: "d"}, "prompt"},
+		{"empty tool", AgentDefinition{Description: "d", Prompt: "p", Tools: []string{"Read", ""}}, "tool 1"},
+		{"empty model", AgentDefinition{Description: "d", Prompt: "p", Model: &empty}, "model"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.agent.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want error mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestAgentsMarshalGolden tests the agents payload passed to the CLI
+func TestAgentsMarshalGolden(t *testing.T) {
+	model := "sonnet"
+	opts := NewClaudeAgentOptions().
+		WithAgent("code-reviewer", AgentDefinition{
+			Description: "Reviews code for bugs and style",
+			Prompt:      "You are a meticulous code reviewer.",
+			Tools:       []string{"Read", "Grep", "Glob"},
+			Model:       &model,
+		}).
+		WithAgent("summarizer", AgentDefinition{
+			Description: "Summarizes long documents",
+			Prompt:      "Summarize the input in three sentences.",
+		})
+
+	got, err := json.MarshalIndent(opts.Agents, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("testdata/agents.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != strings.TrimSpace(string(want)) {
+		t.Errorf("agents payload does not match testdata/agents.json:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,234 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/pathutil"
+)
+
+// PermissionPolicy is a declarative alternative to a CanUseTool callback for
+// simple allow and deny lists. Install it with WithPermissionPolicy.
+//
+// Rules are evaluated in this order, and the first that applies decides:
+//
+//  1. DenyTools: a matching tool is denied.
+//  2. DenyPathsOutsideCWD: a file path in the tool input (file_path,
+//     notebook_path, or path) that resolves outside the working directory is denied.
+//  3. AllowBashPatterns: a Bash command is allowed if every command in it
+//     matches a pattern (see below).
+//  4. AllowTools: a matching tool is allowed.
+//  5. DefaultBehavior: "allow" or "deny" (the default).
+//
+// Tool names and Bash commands are matched with globs in which * matches any
+// sequence of characters (including / and spaces) and ? matches one
+// character, so "mcp__github__*" matches every tool of that MCP server and
+// "go test *" matches any go test invocation.
+//
+// Bash commands are split on the ;, &, &&, ||, |, and newline operators and
+// each part must match; commands using substitution ($(...) or backticks)
+// never match. Redirections and process substitutions (<, >, >>, <(...),
+// >(...)) match only where a pattern spells them out, since * and ? never
+// match < or >: "go test *" does not allow "go test . > ~/.bashrc", while
+// "go test * > /tmp/test.log" allows that one redirection. Listing "Bash" in
+// AllowTools allows every command regardless of AllowBashPatterns.
+type PermissionPolicy struct {
+	AllowTools          []string           // Tool name globs to allow
+	DenyTools           []string           // Tool name globs to deny; checked first
+	AllowBashPatterns   []string           // Bash command globs to allow
+	DenyPathsOutsideCWD bool               // Deny file paths outside the working directory
+	DefaultBehavior     PermissionBehavior // "allow" or "deny" when no rule applies (empty means deny)
+}
+
+// pathInputKeys are the tool input fields that hold file system paths.
+var pathInputKeys = []string{"file_path", "notebook_path", "path"}
+
+// Validate reports whether the policy is well formed.
+func (p *PermissionPolicy) Validate() error {
+	switch p.DefaultBehavior {
+	case "", PermissionBehaviorAllow, PermissionBehaviorDeny:
+		return nil
+	default:
+		return fmt.Errorf("permission policy default behavior must be %q or %q, got %q",
+			PermissionBehaviorAllow, PermissionBehaviorDeny, p.DefaultBehavior)
+	}
+}
+
+// Evaluate applies the policy to a tool use. cwd is the absolute working
+// directory that DenyPathsOutsideCWD checks against; relative paths in the
+// input are resolved against it.
+func (p *PermissionPolicy) Evaluate(toolName string, input map[string]interface{}, cwd string) PermissionResult {
+	if matchAnyGlob(p.DenyTools, toolName) {
+		return &PermissionResultDeny{Message: fmt.Sprintf("tool %s is denied by the permission policy", toolName)}
+	}
+
+	if p.DenyPathsOutsideCWD {
+		for _, key := range pathInputKeys {
+			path, ok := input[key].(string)
+			if !ok || path == "" {
+				continue
+			}
+			if !PathWithin(cwd, path) {
+				return &PermissionResultDeny{Message: fmt.Sprintf("path %s is outside the working directory", path)}
+			}
+		}
+	}
+
+	if toolName == "Bash" && len(p.AllowBashPatterns) > 0 {
+		if command, ok := input["command"].(string); ok && bashCommandAllowed(p.AllowBashPatterns, command) {
+			return &PermissionResultAllow{}
+		}
+	}
+
+	if matchAnyGlob(p.AllowTools, toolName) {
+		return &PermissionResultAllow{}
+	}
+
+	if p.DefaultBehavior == PermissionBehaviorAllow {
+		return &PermissionResultAllow{}
+	}
+	return &PermissionResultDeny{Message: fmt.Sprintf("tool %s is not allowed by the permission policy", toolName)}
+}
+
+// Clone returns a deep copy of the policy.
+func (p *PermissionPolicy) Clone() *PermissionPolicy {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.AllowTools = cloneSlice(p.AllowTools)
+	c.DenyTools = cloneSlice(p.DenyTools)
+	c.AllowBashPatterns = cloneSlice(p.AllowBashPatterns)
+	return &c
+}
+
+// PathWithin reports whether path, resolved against the absolute directory
+// dir if relative, is dir itself or inside it. Symbolic links are resolved
+// where the path exists before ".." is applied, as the filesystem does, so a
+// link inside dir pointing elsewhere is outside, and so is "link/../x" when
+// the link's target lies outside dir. Paths are compared case-insensitively
+// on macOS and Windows. WithAllowedRoots uses the same check.
+func PathWithin(dir, path string) bool {
+	return pathutil.Contains(dir, path)
+}
+
+// bashCommandAllowed reports whether every command in a shell command line
+// matches one of patterns.
+func bashCommandAllowed(patterns []string, command string) bool {
+	if strings.Contains(command, "$(") || strings.Contains(command, "`") {
+		return false
+	}
+
+	parts := splitShellCommands(command)
+	if len(parts) == 0 {
+		return false
+	}
+	for _, part := range parts {
+		if !matchAnyCommandGlob(patterns, part) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitShellCommands splits a command line on ;, &, &&, ||, |, and newlines,
+// returning the trimmed non-empty commands. An & that is part of a
+// redirection (2>&1, &>file) does not split.
+func splitShellCommands(command string) []string {
+	var parts []string
+	start := 0
+	split := func(end, next int) {
+		if part := strings.TrimSpace(command[start:end]); part != "" {
+			parts = append(parts, part)
+		}
+		start = next
+	}
+	for i := 0; i < len(command); i++ {
+		switch c := command[i]; c {
+		case ';', '\n':
+			split(i, i+1)
+		case '|':
+			if i+1 < len(command) && command[i+1] == '|' {
+				split(i, i+2)
+				i++
+			} else {
+				split(i, i+1)
+			}
+		case '&':
+			switch {
+			case i+1 < len(command) && command[i+1] == '&':
+				split(i, i+2)
+				i++
+			case i > 0 && isRedirection(command[i-1]), i+1 < len(command) && command[i+1] == '>':
+				// Part of a redirection, which the pattern has to spell out
+			default:
+				split(i, i+1)
+			}
+		}
+	}
+	split(len(command), len(command))
+	return parts
+}
+
+// isRedirection reports whether c is a shell redirection or process
+// substitution operator character.
+func isRedirection(c byte) bool {
+	return c == '<' || c == '>'
+}
+
+// matchAnyCommandGlob reports whether the command s matches any of patterns,
+// with wildcards that never match a redirection.
+func matchAnyCommandGlob(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matchGlobFunc(pattern, s, func(r rune) bool { return r < 0x80 && isRedirection(byte(r)) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnyGlob reports whether s matches any of patterns.
+func matchAnyGlob(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches s against a pattern where * matches any sequence of
+// characters and ? matches a single character.
+func matchGlob(pattern, s string) bool {
+	return matchGlobFunc(pattern, s, nil)
+}
+
+// matchGlobFunc is matchGlob where the characters literal reports true for
+// are matched only by themselves, never by * or ?. literal may be nil.
+func matchGlobFunc(pattern, s string, literal func(rune) bool) bool {
+	p, str := []rune(pattern), []rune(s)
+	pi, si := 0, 0
+	star, match := -1, 0
+	wild := func(r rune) bool { return literal == nil || !literal(r) }
+
+	for si < len(str) {
+		switch {
+		case pi < len(p) && (p[pi] == str[si] || (p[pi] == '?' && wild(str[si]))):
+			pi++
+			si++
+		case pi < len(p) && p[pi] == '*':
+			star, match = pi, si
+			pi++
+		case star >= 0 && wild(str[match]):
+			pi = star + 1
+			match++
+			si = match
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"strings"
+	"sync"
+)
+
+// ModelPrice is what a model's tokens cost, in US dollars per million tokens.
+type ModelPrice struct {
+	Input      float64 // Uncached input tokens
+	Output     float64 // Output tokens, including thinking
+	CacheWrite float64 // Input tokens written to the prompt cache
+	CacheRead  float64 // Input tokens read from the prompt cache
+}
+
+var (
+	modelPricesMu sync.RWMutex
+
+	// modelPrices are list prices by model name prefix. Older and pricier
+	// models share the shortest prefixes, so an unlisted model in a family
+	// is overestimated rather than under.
+	modelPrices = map[string]ModelPrice{
+		"claude-opus-4":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+		"claude-opus-4-5":   {Input: 5, Output: 25, CacheWrite: 6.25, CacheRead: 0.50},
+		"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+		"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+		"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+		"claude-haiku-4":    {Input: 1, Output: 5, CacheWrite: 1.25, CacheRead: 0.10},
+		"claude-3-5-haiku":  {Input: 0.80, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+	}
+)
+
+// SetModelPrice registers the price EstimateCostUSD uses for models whose
+// name starts with modelPrefix, replacing the built-in list price, for
+// models the SDK does not know or negotiated rates. The longest matching
+// prefix wins. A zero price removes the entry.
+func SetModelPrice(modelPrefix string, price ModelPrice) {
+	modelPricesMu.Lock()
+	defer modelPricesMu.Unlock()
+
+	if price == (ModelPrice{}) {
+		delete(modelPrices, modelPrefix)
+		return
+	}
+	modelPrices[modelPrefix] = price
+}
+
+// EstimateCostUSD returns what usage costs at the price registered for
+// model, and false if model has no price. It is an estimate for enforcing
+// limits while a turn runs; the TotalCostUSD the CLI reports in a
+// ResultMessage is authoritative.
+func EstimateCostUSD(model string, usage *Usage) (float64, bool) {
+	if usage == nil {
+		return 0, false
+	}
+
+	modelPricesMu.RLock()
+	var price ModelPrice
+	matched := -1
+	for prefix, p := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > matched {
+			price, matched = p, len(prefix)
+		}
+	}
+	modelPricesMu.RUnlock()
+	if matched < 0 {
+		return 0, false
+	}
+
+	cost := float64(usage.InputTokens)*price.Input +
+		float64(usage.OutputTokens)*price.Output +
+		float64(usage.CacheCreationInputTokens)*price.CacheWrite +
+		float64(usage.CacheReadInputTokens)*price.CacheRead
+	return cost / 1e6, true
+}
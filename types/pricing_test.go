@@ -0,0 +1,55 @@
+package types
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestEstimateCostUSD(t *testing.T) {
+	usage := &Usage{InputTokens: 1e6, OutputTokens: 1e6, CacheCreationInputTokens: 1e6, CacheReadInputTokens: 1e6}
+	tests := []struct {
+		model  string
+		want   float64
+		wantOK bool
+	}{
+		{"claude-sonnet-4-5-20250929", 3 + 15 + 3.75 + 0.30, true},
+		{"claude-opus-4-5-20251101", 5 + 25 + 6.25 + 0.50, true},
+		{"claude-opus-4-1-20250805", 15 + 75 + 18.75 + 1.50, true},
+		{"claude-haiku-4-5", 1 + 5 + 1.25 + 0.10, true},
+		{"gpt-4", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := EstimateCostUSD(tt.model, usage)
+		if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("EstimateCostUSD(%q) = %v, %v, want %v, %v", tt.model, got, ok, tt.want, tt.wantOK)
+		}
+	}
+	if _, ok := EstimateCostUSD("claude-sonnet-4-5", nil); ok {
+		t.Error("EstimateCostUSD without usage reported a cost")
+	}
+}
+
+func TestSetModelPrice(t *testing.T) {
+	SetModelPrice("acme-model", ModelPrice{Input: 2, Output: 4})
+	defer SetModelPrice("acme-model", ModelPrice{})
+
+	if got, ok := EstimateCostUSD("acme-model-large", &Usage{InputTokens: 500000, OutputTokens: 250000}); !ok || got != 2 {
+		t.Errorf("EstimateCostUSD = %v, %v, want 2, true", got, ok)
+	}
+	SetModelPrice("acme-model", ModelPrice{})
+	if _, ok := EstimateCostUSD("acme-model-large", &Usage{}); ok {
+		t.Error("removed price still applied")
+	}
+}
+
+func TestAssistantMessageID(t *testing.T) {
+	var msg AssistantMessage
+	data := `{"type":"assistant","message":{"id":"msg_01","model":"claude-sonnet-4-5","content":[],"usage":{"input_tokens":3,"output_tokens":5}}}`
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if msg.MessageID != "msg_01" || msg.Usage == nil || msg.Usage.OutputTokens != 5 {
+		t.Errorf("decoded %+v, want the message ID and usage", msg)
+	}
+}
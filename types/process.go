@@ -0,0 +1,30 @@
+package types
+
+// ProcessStatus is the lifecycle stage of a CLI subprocess.
+type ProcessStatus string
+
+const (
+	ProcessNotStarted ProcessStatus = "not_started" // Before Connect, or the transport runs no subprocess
+	ProcessRunning    ProcessStatus = "running"     // Started and not yet reaped
+	ProcessExited     ProcessStatus = "exited"      // Exited and reaped; ExitCode is set
+)
+
+// ProcessState describes a CLI subprocess for monitoring, as reported by
+// Client.ProcessState.
+type ProcessState struct {
+	Status ProcessStatus
+
+	// PID is the process ID once the subprocess has started, kept after it
+	// exits so that logs can be correlated. It may be reused by the system
+	// once Status is ProcessExited.
+	PID int
+
+	// ExitCode is the exit status once Status is ProcessExited, or -1 if the
+	// process was killed by a signal.
+	ExitCode int
+}
+
+// Running reports whether the subprocess has started and not yet exited.
+func (s ProcessState) Running() bool {
+	return s.Status == ProcessRunning
+}
@@ -0,0 +1,91 @@
+package types
+
+import "encoding/json"
+
+// ServerInfo describes the CLI session as reported in the response to the
+// initialize control request sent during Connect.
+type ServerInfo struct {
+	// Commands lists the slash commands available in the session.
+	Commands []SlashCommand `json:"commands,omitempty"`
+
+	// OutputStyle is the active output style and AvailableOutputStyles the
+	// styles that can be selected.
+	OutputStyle           string   `json:"output_style,omitempty"`
+	AvailableOutputStyles []string `json:"available_output_styles,omitempty"`
+
+	// Models lists the models the CLI offers.
+	Models []ModelInfo `json:"models,omitempty"`
+
+	// Tools lists the tools available to the session, when reported.
+	Tools []string `json:"tools,omitempty"`
+
+	// Account describes the authenticated account, when reported.
+	Account *AccountInfo `json:"account,omitempty"`
+
+	// Capabilities is the protocol version and feature set the CLI
+	// reported, or nil if it reports none (see Capabilities).
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+
+	// CLIVersion is the CLI version detected by Connect (not part of the
+	// initialize response).
+	CLIVersion string `json:"-"`
+
+	// Raw holds the complete initialize response, including fields this
+	// SDK version does not decode.
+	Raw map[string]interface{} `json:"-"`
+}
+
+// SlashCommand describes a slash command available in the session.
+type SlashCommand struct {
+	Name         string `json:"name"`
+	Description  string `json:"description,omitempty"`
+	ArgumentHint string `json:"argumentHint,omitempty"`
+}
+
+// ModelInfo describes a model the CLI offers.
+type ModelInfo struct {
+	Value       string `json:"value"`
+	DisplayName string `json:"displayName,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ToolInfo describes a tool available to the session, as returned by
+// Client.AvailableTools.
+type ToolInfo struct {
+	// Name is the name the model calls the tool by, such as "Read" or, for
+	// MCP tools, "mcp__<server>__<tool>".
+	Name string `json:"name"`
+
+	// Description and InputSchema, a JSON Schema object, are set for tools
+	// whose schema the SDK could list; built-in tools have neither.
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema,omitempty"`
+
+	// Server is the MCP server providing the tool, or empty for built-in tools.
+	Server string `json:"server,omitempty"`
+}
+
+// AccountInfo describes the account the CLI is authenticated as.
+type AccountInfo struct {
+	Email            string `json:"email,omitempty"`
+	Organization     string `json:"organization,omitempty"`
+	SubscriptionType string `json:"subscriptionType,omitempty"`
+	TokenSource      string `json:"tokenSource,omitempty"`
+	APIKeySource     string `json:"apiKeySource,omitempty"`
+}
+
+// ParseServerInfo decodes an initialize response into a ServerInfo. The
+// original map is kept in Raw.
+func ParseServerInfo(response map[string]interface{}) (*ServerInfo, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, NewJSONDecodeErrorWithCause("failed to encode initialize response", "", err)
+	}
+
+	var info ServerInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, NewJSONDecodeErrorWithCause("failed to decode initialize response", string(data), err)
+	}
+	info.Raw = response
+	return &info, nil
+}
@@ -0,0 +1,87 @@
+package types
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func loadInitializeResponse(t *testing.T) map[string]interface{} {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/initialize_response.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestParseServerInfo(t *testing.T) {
+	info, err := ParseServerInfo(loadInitializeResponse(t))
+	if err != nil {
+		t.Fatalf("ParseServerInfo failed: %v", err)
+	}
+
+	wantCommand := SlashCommand{
+		Name:         "compact",
+		Description:  "Clear conversation history but keep a summary in context",
+		ArgumentHint: "<optional custom summarization instructions>",
+	}
+	if len(info.Commands) != 3 || info.Commands[0] != wantCommand {
+		t.Errorf("Commands = %+v", info.Commands)
+	}
+	if info.Commands[2].ArgumentHint != "" {
+		t.Errorf("missing argumentHint decoded as %q", info.Commands[2].ArgumentHint)
+	}
+
+	if info.OutputStyle != "default" {
+		t.Errorf("OutputStyle = %q", info.OutputStyle)
+	}
+	if len(info.AvailableOutputStyles) != 3 || info.AvailableOutputStyles[2] != "Learning" {
+		t.Errorf("AvailableOutputStyles = %v", info.AvailableOutputStyles)
+	}
+
+	wantModel := ModelInfo{Value: "opus", DisplayName: "Opus", Description: "Most capable for complex work"}
+	if len(info.Models) != 3 || info.Models[1] != wantModel {
+		t.Errorf("Models = %+v", info.Models)
+	}
+
+	wantAccount := AccountInfo{
+		Email:            "dev@example.com",
+		Organization:     "Example Org",
+		SubscriptionType: "Claude Max",
+		TokenSource:      "claude.ai",
+		APIKeySource:     "none",
+	}
+	if info.Account == nil || *info.Account != wantAccount {
+		t.Errorf("Account = %+v", info.Account)
+	}
+
+	if info.Tools != nil {
+		t.Errorf("Tools = %v, want nil when not reported", info.Tools)
+	}
+	if _, ok := info.Raw["fast_mode"]; !ok {
+		t.Error("Raw is missing undecoded field fast_mode")
+	}
+}
+
+func TestParseServerInfoEmpty(t *testing.T) {
+	info, err := ParseServerInfo(nil)
+	if err != nil {
+		t.Fatalf("ParseServerInfo(nil) failed: %v", err)
+	}
+	if len(info.Commands) != 0 || info.Account != nil {
+		t.Errorf("unexpected fields for empty response: %+v", info)
+	}
+}
+
+func TestParseServerInfoInvalid(t *testing.T) {
+	_, err := ParseServerInfo(map[string]interface{}{"commands": "not a list"})
+	if !IsJSONDecodeError(err) {
+		t.Errorf("expected JSONDecodeError, got %v", err)
+	}
+}
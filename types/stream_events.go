@@ -0,0 +1,249 @@
+package types
+
+import "encoding/json"
+
+// StreamEventPayload is a decoded Anthropic API streaming event, as returned
+// by StreamEvent.Decode. It is one of MessageStartEvent,
+// ContentBlockStartEvent, ContentBlockDeltaEvent, ContentBlockStopEvent,
+// MessageDeltaEvent, MessageStopEvent, or RawEvent for other event types.
+type StreamEventPayload interface {
+	// EventType returns the event's type, e.g. "content_block_delta".
+	EventType() string
+	isStreamEventPayload()
+}
+
+// StreamMessage is the message snapshot carried by a message_start event.
+type StreamMessage struct {
+	ID           string            `json:"id"`
+	Type         string            `json:"type"` // "message"
+	Role         string            `json:"role"`
+	Model        string            `json:"model"`
+	Content      []json.RawMessage `json:"content"` // Usually empty at message_start
+	StopReason   *string           `json:"stop_reason,omitempty"`
+	StopSequence *string           `json:"stop_sequence,omitempty"`
+	Usage        *Usage            `json:"usage,omitempty"`
+}
+
+// MessageStartEvent begins a streamed message.
+type MessageStartEvent struct {
+	Type    string        `json:"type"` // "message_start"
+	Message StreamMessage `json:"message"`
+}
+
+// ContentBlockStartEvent begins the content block at Index.
+type ContentBlockStartEvent struct {
+	Type  string `json:"type"` // "content_block_start"
+	Index int    `json:"index"`
+
+	// ContentBlock is the initial block, such as an empty TextBlock or a
+	// ToolUseBlock whose input arrives in later InputJSONDelta events. It is
+	// nil for block types this SDK does not know; RawContentBlock always
+	// holds the original JSON.
+	ContentBlock    ContentBlock    `json:"-"`
+	RawContentBlock json.RawMessage `json:"content_block"`
+}
+
+// ContentBlockDeltaEvent carries an incremental update to the content block
+// at Index.
+type ContentBlockDeltaEvent struct {
+	Type  string      `json:"type"` // "content_block_delta"
+	Index int         `json:"index"`
+	Delta StreamDelta `json:"-"` // TextDelta, InputJSONDelta, ThinkingDelta, SignatureDelta, or RawDelta
+}
+
+// ContentBlockStopEvent ends the content block at Index.
+type ContentBlockStopEvent struct {
+	Type  string `json:"type"` // "content_block_stop"
+	Index int    `json:"index"`
+}
+
+// MessageDelta holds the top-level message changes in a message_delta event.
+type MessageDelta struct {
+	StopReason   *string `json:"stop_reason,omitempty"`
+	StopSequence *string `json:"stop_sequence,omitempty"`
+}
+
+// MessageDeltaEvent reports the stop reason and cumulative output usage near
+// the end of a streamed message.
+type MessageDeltaEvent struct {
+	Type  string       `json:"type"` // "message_delta"
+	Delta MessageDelta `json:"delta"`
+	Usage *Usage       `json:"usage,omitempty"`
+}
+
+// MessageStopEvent ends a streamed message.
+type MessageStopEvent struct {
+	Type string `json:"type"` // "message_stop"
+}
+
+// RawEvent is an event whose type this SDK does not decode, such as "ping".
+type RawEvent struct {
+	Type string                 `json:"type"`
+	Data map[string]interface{} `json:"-"` // The complete event
+}
+
+func (e *MessageStartEvent) EventType() string      { return e.Type }
+func (e *ContentBlockStartEvent) EventType() string { return e.Type }
+func (e *ContentBlockDeltaEvent) EventType() string { return e.Type }
+func (e *ContentBlockStopEvent) EventType() string  { return e.Type }
+func (e *MessageDeltaEvent) EventType() string      { return e.Type }
+func (e *MessageStopEvent) EventType() string       { return e.Type }
+func (e *RawEvent) EventType() string               { return e.Type }
+
+func (e *MessageStartEvent) isStreamEventPayload()      {}
+func (e *ContentBlockStartEvent) isStreamEventPayload() {}
+func (e *ContentBlockDeltaEvent) isStreamEventPayload() {}
+func (e *ContentBlockStopEvent) isStreamEventPayload()  {}
+func (e *MessageDeltaEvent) isStreamEventPayload()      {}
+func (e *MessageStopEvent) isStreamEventPayload()       {}
+func (e *RawEvent) isStreamEventPayload()               {}
+
+// StreamDelta is the delta of a ContentBlockDeltaEvent.
+type StreamDelta interface {
+	// DeltaType returns the delta's type, e.g. "text_delta".
+	DeltaType() string
+	isStreamDelta()
+}
+
+// TextDelta appends Text to a text block.
+type TextDelta struct {
+	Type string `json:"type"` // "text_delta"
+	Text string `json:"text"`
+}
+
+// InputJSONDelta appends PartialJSON to a tool use block's input. The
+// fragments only form valid JSON once concatenated.
+type InputJSONDelta struct {
+	Type        string `json:"type"` // "input_json_delta"
+	PartialJSON string `json:"partial_json"`
+}
+
+// ThinkingDelta appends Thinking to a thinking block.
+type ThinkingDelta struct {
+	Type     string `json:"type"` // "thinking_delta"
+	Thinking string `json:"thinking"`
+}
+
+// SignatureDelta sets the signature of a thinking block.
+type SignatureDelta struct {
+	Type      string `json:"type"` // "signature_delta"
+	Signature string `json:"signature"`
+}
+
+// RawDelta is a delta whose type this SDK does not decode.
+type RawDelta struct {
+	Type string                 `json:"type"`
+	Data map[string]interface{} `json:"-"` // The complete delta
+}
+
+func (d *TextDelta) DeltaType() string      { return d.Type }
+func (d *InputJSONDelta) DeltaType() string { return d.Type }
+func (d *ThinkingDelta) DeltaType() string  { return d.Type }
+func (d *SignatureDelta) DeltaType() string { return d.Type }
+func (d *RawDelta) DeltaType() string       { return d.Type }
+
+func (d *TextDelta) isStreamDelta()      {}
+func (d *InputJSONDelta) isStreamDelta() {}
+func (d *ThinkingDelta) isStreamDelta()  {}
+func (d *SignatureDelta) isStreamDelta() {}
+func (d *RawDelta) isStreamDelta()       {}
+
+// Decode returns the typed form of the event, chosen by its "type" field.
+// Event types this SDK does not know decode to a RawEvent.
+//
+// Example:
+//
+//	payload, err := event.Decode()
+//	if err != nil {
+//	    return err
+//	}
+//	if d, ok := payload.(*types.ContentBlockDeltaEvent); ok {
+//	    if text, ok := d.Delta.(*types.TextDelta); ok {
+//	        fmt.Print(text.Text)
+//	    }
+//	}
+func (m *StreamEvent) Decode() (StreamEventPayload, error) {
+	data, err := json.Marshal(m.Event)
+	if err != nil {
+		return nil, NewMessageParseErrorWithCause("failed to encode stream event", MessageTypeStreamEvent, err)
+	}
+
+	eventType, _ := m.Event["type"].(string)
+	var payload StreamEventPayload
+	switch eventType {
+	case "message_start":
+		payload = &MessageStartEvent{}
+	case "content_block_start":
+		payload = &ContentBlockStartEvent{}
+	case "content_block_delta":
+		payload = &ContentBlockDeltaEvent{}
+	case "content_block_stop":
+		payload = &ContentBlockStopEvent{}
+	case "message_delta":
+		payload = &MessageDeltaEvent{}
+	case "message_stop":
+		payload = &MessageStopEvent{}
+	default:
+		return &RawEvent{Type: eventType, Data: m.Event}, nil
+	}
+
+	if err := json.Unmarshal(data, payload); err != nil {
+		return nil, NewMessageParseErrorWithCause("failed to decode "+eventType+" event", MessageTypeStreamEvent, err)
+	}
+	return payload, nil
+}
+
+// UnmarshalJSON decodes the event and its content block.
+func (e *ContentBlockStartEvent) UnmarshalJSON(data []byte) error {
+	type plain ContentBlockStartEvent
+	if err := json.Unmarshal(data, (*plain)(e)); err != nil {
+		return err
+	}
+
+	// Unknown block types are left to RawContentBlock
+	if block, err := UnmarshalContentBlock(e.RawContentBlock); err == nil {
+		e.ContentBlock = block
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes the event and picks the delta type from delta.type.
+func (e *ContentBlockDeltaEvent) UnmarshalJSON(data []byte) error {
+	type plain ContentBlockDeltaEvent
+	aux := struct {
+		*plain
+		Delta json.RawMessage `json:"delta"`
+	}{plain: (*plain)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if len(aux.Delta) == 0 {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(aux.Delta, &fields); err != nil {
+		return err
+	}
+	deltaType, _ := fields["type"].(string)
+
+	var delta StreamDelta
+	switch deltaType {
+	case "text_delta":
+		delta = &TextDelta{}
+	case "input_json_delta":
+		delta = &InputJSONDelta{}
+	case "thinking_delta":
+		delta = &ThinkingDelta{}
+	case "signature_delta":
+		delta = &SignatureDelta{}
+	default:
+		e.Delta = &RawDelta{Type: deltaType, Data: fields}
+		return nil
+	}
+	if err := json.Unmarshal(aux.Delta, delta); err != nil {
+		return err
+	}
+	e.Delta = delta
+	return nil
+}
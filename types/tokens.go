@@ -0,0 +1,85 @@
+package types
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Characters per token assumed by EstimateTokens for each kind of text.
+const (
+	asciiCharsPerToken     = 4.0 // English, code, and other ASCII text
+	alphabetCharsPerToken  = 2.5 // Accented Latin, Cyrillic, Greek, Arabic, Hebrew, Indic scripts
+	ideographCharsPerToken = 1.0 // Chinese, Japanese, and Korean characters
+)
+
+var (
+	tokenAdjustmentsMu sync.RWMutex
+	tokenAdjustments   = make(map[string]float64)
+)
+
+// EstimateTokens returns an approximate token count for text.
+//
+// The estimate is a heuristic, not a tokenizer: ASCII text counts as one
+// token per four bytes, other alphabetic scripts as one token per 2.5
+// characters, and CJK ideographs, kana, hangul, and symbols such as emoji as
+// about one token each. Expect it to be off by as much as 40% from the real
+// count; it is meant for rejecting prompts that are clearly too large, not
+// for billing. Use EstimateTokensForModel to apply a per-model adjustment.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	var ascii, alphabet, ideograph float64
+	for _, r := range text {
+		switch {
+		case r < 0x80:
+			ascii++
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			ideograph++
+		case unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsSpace(r) || unicode.IsPunct(r):
+			alphabet++
+		default:
+			// Emoji and other symbols usually take a token or more each
+			ideograph++
+		}
+	}
+
+	estimate := ascii/asciiCharsPerToken + alphabet/alphabetCharsPerToken + ideograph/ideographCharsPerToken
+	return int(math.Ceil(estimate))
+}
+
+// SetTokenEstimateAdjustment registers a factor applied by
+// EstimateTokensForModel to models whose name starts with modelPrefix, for
+// tokenizers that are consistently denser or sparser than the default
+// heuristic. The longest matching prefix wins. A factor of zero or less
+// removes the adjustment.
+func SetTokenEstimateAdjustment(modelPrefix string, factor float64) {
+	tokenAdjustmentsMu.Lock()
+	defer tokenAdjustmentsMu.Unlock()
+
+	if factor <= 0 {
+		delete(tokenAdjustments, modelPrefix)
+		return
+	}
+	tokenAdjustments[modelPrefix] = factor
+}
+
+// EstimateTokensForModel is EstimateTokens scaled by the adjustment
+// registered for model with SetTokenEstimateAdjustment, if any.
+func EstimateTokensForModel(model, text string) int {
+	estimate := EstimateTokens(text)
+
+	tokenAdjustmentsMu.RLock()
+	defer tokenAdjustmentsMu.RUnlock()
+
+	factor, matched := 1.0, -1
+	for prefix, f := range tokenAdjustments {
+		if strings.HasPrefix(model, prefix) && len(prefix) > matched {
+			factor, matched = f, len(prefix)
+		}
+	}
+	return int(math.Ceil(float64(estimate) * factor))
+}
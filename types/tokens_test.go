@@ -0,0 +1,87 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokensMultilingual(t *testing.T) {
+	// Reference counts are approximate real token counts for each sample; the
+	// estimate only needs to be in the right neighbourhood.
+	tests := []struct {
+		name      string
+		text      string
+		reference int
+	}{
+		{"english", "The quick brown fox jumps over the lazy dog.", 10},
+		{"english paragraph", strings.Repeat("Please summarize the attached quarterly report and list the three biggest risks. ", 10), 150},
+		{"code", `func main() { fmt.Println("hello, world") }`, 13},
+		{"german", "Die Straße führt über die Brücke zum Bahnhof.", 14},
+		{"french", "Où se trouve la bibliothèque la plus proche d'ici ?", 15},
+		{"russian", "Привет, как у тебя дела сегодня?", 13},
+		{"greek", "Καλημέρα, τι κάνεις σήμερα;", 13},
+		{"arabic", "مرحبا بكم في موقعنا الجديد", 12},
+		{"hindi", "आज मौसम बहुत अच्छा है।", 12},
+		{"japanese", "今日はとても良い天気ですね。", 13},
+		{"chinese", "我们明天早上九点在公司开会。", 14},
+		{"korean", "안녕하세요, 만나서 반갑습니다.", 14},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateTokens(tt.text)
+			low, high := float64(tt.reference)*0.6, float64(tt.reference)*1.4
+			if float64(got) < low || float64(got) > high {
+				t.Errorf("EstimateTokens = %d, want within 40%% of %d", got, tt.reference)
+			}
+		})
+	}
+}
+
+func TestEstimateTokensEdgeCases(t *testing.T) {
+	if got := EstimateTokens(""); got != 0 {
+		t.Errorf("EstimateTokens(\"\") = %d, want 0", got)
+	}
+	if got := EstimateTokens("a"); got != 1 {
+		t.Errorf("EstimateTokens(\"a\") = %d, want 1", got)
+	}
+	if got := EstimateTokens("🎉🚀"); got < 2 {
+		t.Errorf("EstimateTokens(emoji) = %d, want at least one token per emoji", got)
+	}
+
+	// Estimates grow linearly with text length
+	one := EstimateTokens(strings.Repeat("word ", 100))
+	two := EstimateTokens(strings.Repeat("word ", 200))
+	if two != 2*one {
+		t.Errorf("doubling the text gave %d and %d tokens", one, two)
+	}
+}
+
+func TestEstimateTokensForModel(t *testing.T) {
+	text := strings.Repeat("abcd", 100) // 100 tokens by the default heuristic
+
+	SetTokenEstimateAdjustment("claude-test", 1.5)
+	SetTokenEstimateAdjustment("claude-test-dense", 2)
+	defer SetTokenEstimateAdjustment("claude-test", 0)
+	defer SetTokenEstimateAdjustment("claude-test-dense", 0)
+
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"", 100},
+		{"claude-other", 100},
+		{"claude-test-1", 150},
+		{"claude-test-dense-1", 200}, // Longest prefix wins
+	}
+	for _, tt := range tests {
+		if got := EstimateTokensForModel(tt.model, text); got != tt.want {
+			t.Errorf("EstimateTokensForModel(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+
+	SetTokenEstimateAdjustment("claude-test-dense", 0)
+	if got := EstimateTokensForModel("claude-test-dense-1", text); got != 150 {
+		t.Errorf("after removing adjustment = %d, want 150", got)
+	}
+}
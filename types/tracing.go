@@ -0,0 +1,67 @@
+package types
+
+import "context"
+
+// Tracer creates spans around the work of a Client, so that sessions show up
+// in distributed traces without the SDK depending on a tracing library. Set
+// it with WithTracer; the otelclaude module adapts an OpenTelemetry tracer.
+//
+// Span names are the Span* constants and attribute keys the Attr*
+// constants. Methods are called from several goroutines at once and must be
+// safe for concurrent use. They are called inline, so they should not block.
+type Tracer interface {
+	// Start begins a span as a child of the span in ctx, if any, and returns
+	// a context carrying the new span. attrs may be nil.
+	Start(ctx context.Context, name string, attrs map[string]interface{}) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttributes adds attributes to the span, replacing those with the
+	// same keys.
+	SetAttributes(attrs map[string]interface{})
+
+	// End finishes the span, recording err, if not nil, as its failure. It
+	// is called exactly once.
+	End(err error)
+}
+
+// Spans created through a Tracer.
+const (
+	// SpanConnect covers Client.Connect, from starting the CLI to the end
+	// of the initialize handshake.
+	SpanConnect = "claude.connect"
+
+	// SpanInitialize covers the initialize control request, as a child of
+	// SpanConnect.
+	SpanInitialize = "claude.initialize"
+
+	// SpanTurn covers one turn, from sending the prompt to receiving its
+	// ResultMessage through ReceiveResponse. Its parent is the span in the
+	// context passed to Query.
+	SpanTurn = "claude.turn"
+
+	// SpanPermission covers one can_use_tool round trip: the CLI asking
+	// for permission and the SDK answering. Its parent is the turn in
+	// progress.
+	SpanPermission = "claude.permission"
+
+	// SpanClose covers Client.Close.
+	SpanClose = "claude.close"
+)
+
+// Span attributes set by the SDK.
+const (
+	AttrModel            = "claude.model"               // Model named by options or by the turn's messages
+	AttrCLIVersion       = "claude.cli_version"         // Version of the CLI (connect)
+	AttrSessionID        = "claude.session_id"          // Session of the turn's result
+	AttrNumTurns         = "claude.num_turns"           // NumTurns of the turn's result
+	AttrCostUSD          = "claude.cost_usd"            // TotalCostUSD of the turn's result
+	AttrInputTokens      = "claude.usage.input_tokens"  // Input tokens of the turn, cached ones included
+	AttrOutputTokens     = "claude.usage.output_tokens" // Output tokens of the turn
+	AttrResultSubtype    = "claude.result.subtype"      // Subtype of the turn's result, such as "success"
+	AttrIsError          = "claude.result.is_error"     // Whether the turn ended with an error result
+	AttrToolName         = "claude.tool.name"           // Tool asking for permission
+	AttrToolUseID        = "claude.tool.use_id"         // Tool use asking for permission, if known
+	AttrPermissionResult = "claude.permission.behavior" // allow or deny
+)
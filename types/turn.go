@@ -0,0 +1,51 @@
+package types
+
+// TurnResult holds the outcome of one conversation turn, as returned by
+// Client.RunTurn.
+type TurnResult struct {
+	// Text is the text of the turn's assistant messages, joined with newlines.
+	Text string
+
+	// ToolUses lists the tool invocations made during the turn, in order,
+	// including those made by subagents.
+	ToolUses []*ToolUseBlock
+
+	// Result is the ResultMessage ending the turn, or nil if the turn did
+	// not finish.
+	Result *ResultMessage
+
+	// Messages holds every message received for the turn, in order.
+	Messages []Message
+}
+
+// IsError reports whether the turn finished with an error result, such as
+// hitting the turn limit.
+func (r *TurnResult) IsError() bool {
+	return r.Result != nil && r.Result.IsError
+}
+
+// TurnOptions adjusts a single turn started with Client.QueryWithOptions or
+// Client.RunTurnWithOptions. The settings in effect before the turn are
+// restored once its ResultMessage arrives. The zero value runs the turn like
+// Client.Query.
+type TurnOptions struct {
+	// Streaming overrides for this turn whether partial messages
+	// (StreamEvents) are delivered, as set with Client.SetStreaming. nil
+	// keeps the session's setting.
+	Streaming *bool
+
+	// PermissionMode switches the permission mode for this turn, as
+	// Client.SetPermissionMode does. nil keeps the session's mode.
+	PermissionMode *PermissionMode
+
+	// CanUseTool answers this turn's permission requests in place of the
+	// session's callback. The session must have been created with
+	// WithCanUseTool, so that the CLI sends permission requests to the SDK.
+	CanUseTool CanUseToolFunc
+
+	// Hooks run during this turn in addition to the session's hooks, for
+	// events enabled with WithTurnHookEvents. A matcher's Matcher is matched
+	// against the tool name of tool events like the CLI does; nil, "" and
+	// "*" match every tool.
+	Hooks map[HookEvent][]HookMatcher
+}
@@ -0,0 +1,102 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Usage represents token usage reported by the CLI in a ResultMessage.
+//
+// As in the Anthropic API, InputTokens counts only uncached input; tokens read
+// from or written to the prompt cache are reported separately.
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// TotalInputTokens returns all input tokens for the turn: uncached input plus
+// cache reads and cache writes.
+func (u *Usage) TotalInputTokens() int {
+	if u == nil {
+		return 0
+	}
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// CacheHitRate returns the fraction of input tokens served from the prompt cache,
+// in the range [0, 1]. It returns 0 when there was no input.
+func (u *Usage) CacheHitRate() float64 {
+	total := u.TotalInputTokens()
+	if total == 0 {
+		return 0
+	}
+	return float64(u.CacheReadInputTokens) / float64(total)
+}
+
+// ParseUsage decodes the raw usage map of a ResultMessage into a typed Usage.
+// It returns nil if the message carries no usage data.
+func (m *ResultMessage) ParseUsage() (*Usage, error) {
+	if m == nil || m.Usage == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(m.Usage)
+	if err != nil {
+		return nil, NewMessageParseErrorWithCause("failed to encode usage", MessageTypeResult, err)
+	}
+
+	var usage Usage
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return nil, NewMessageParseErrorWithCause("failed to decode usage", MessageTypeResult, err)
+	}
+	return &usage, nil
+}
+
+// CacheMetrics accumulates prompt cache statistics across turns.
+// The zero value is ready to use. CacheMetrics is not safe for concurrent use.
+type CacheMetrics struct {
+	Turns               int // Number of turns with usage data
+	InputTokens         int // Uncached input tokens
+	CacheReadTokens     int // Input tokens served from the cache
+	CacheCreationTokens int // Input tokens written to the cache
+}
+
+// Add records one turn's usage. A nil usage is ignored.
+func (c *CacheMetrics) Add(u *Usage) {
+	if u == nil {
+		return
+	}
+	c.Turns++
+	c.InputTokens += u.InputTokens
+	c.CacheReadTokens += u.CacheReadInputTokens
+	c.CacheCreationTokens += u.CacheCreationInputTokens
+}
+
+// TotalInputTokens returns all accumulated input tokens including cache reads and writes.
+func (c CacheMetrics) TotalInputTokens() int {
+	return c.InputTokens + c.CacheReadTokens + c.CacheCreationTokens
+}
+
+// HitRate returns the cumulative fraction of input tokens served from the cache,
+// in the range [0, 1]. It returns 0 when no input has been recorded.
+func (c CacheMetrics) HitRate() float64 {
+	total := c.TotalInputTokens()
+	if total == 0 {
+		return 0
+	}
+	return float64(c.CacheReadTokens) / float64(total)
+}
+
+// SessionStats totals the results of a client's turns, as returned by
+// Client.Stats.
+type SessionStats struct {
+	Turns               int           // Results received
+	TotalCostUSD        float64       // Cost of the turns; results without a cost add nothing
+	InputTokens         int           // Uncached input tokens
+	OutputTokens        int           // Output tokens
+	CacheReadTokens     int           // Input tokens served from the cache
+	CacheCreationTokens int           // Input tokens written to the cache
+	Duration            time.Duration // Sum of the turns' reported durations
+}
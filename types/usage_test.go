@@ -0,0 +1,70 @@
+package types
+
+import "testing"
+
+// TestUsageCacheHitRate tests the cache hit rate helper, including the zero-input case.
+func TestUsageCacheHitRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage *Usage
+		want  float64
+	}{
+		{name: "nil usage", usage: nil, want: 0},
+		{name: "no input", usage: &Usage{OutputTokens: 10}, want: 0},
+		{name: "no cache", usage: &Usage{InputTokens: 100}, want: 0},
+		{name: "all cached", usage: &Usage{CacheReadInputTokens: 50}, want: 1},
+		{name: "mixed", usage: &Usage{InputTokens: 25, CacheCreationInputTokens: 25, CacheReadInputTokens: 50}, want: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.usage.CacheHitRate(); got != tt.want {
+				t.Errorf("CacheHitRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCacheMetrics tests cumulative cache metrics across turns.
+func TestCacheMetrics(t *testing.T) {
+	var m CacheMetrics
+	if m.HitRate() != 0 {
+		t.Errorf("expected zero hit rate for empty metrics, got %v", m.HitRate())
+	}
+
+	m.Add(&Usage{InputTokens: 100, CacheCreationInputTokens: 300})
+	m.Add(nil)
+	m.Add(&Usage{InputTokens: 100, CacheReadInputTokens: 300})
+
+	if m.Turns != 2 {
+		t.Errorf("expected 2 turns, got %d", m.Turns)
+	}
+	if m.TotalInputTokens() != 800 {
+		t.Errorf("expected 800 total input tokens, got %d", m.TotalInputTokens())
+	}
+	if m.HitRate() != 0.375 {
+		t.Errorf("expected hit rate 0.375, got %v", m.HitRate())
+	}
+}
+
+// TestResultMessageParseUsage tests decoding the raw usage map.
+func TestResultMessageParseUsage(t *testing.T) {
+	msg := &ResultMessage{Usage: map[string]interface{}{
+		"input_tokens":            float64(10),
+		"output_tokens":           float64(5),
+		"cache_read_input_tokens": float64(30),
+	}}
+
+	usage, err := msg.ParseUsage()
+	if err != nil {
+		t.Fatalf("ParseUsage() error = %v", err)
+	}
+	if usage.InputTokens != 10 || usage.OutputTokens != 5 || usage.CacheReadInputTokens != 30 {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+
+	usage, err = (&ResultMessage{}).ParseUsage()
+	if err != nil || usage != nil {
+		t.Errorf("expected nil usage without error, got %+v, %v", usage, err)
+	}
+}
@@ -0,0 +1,120 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cliVersionPattern finds a version number anywhere in a string, so output such
+// as "1.0.100 (Claude Code)" or "v2.0.0-beta.1" parses. The patch component is optional.
+var cliVersionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?`)
+
+// CLIVersion is a parsed Claude Code CLI version.
+type CLIVersion struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string // e.g. "beta.1"; empty for releases
+}
+
+// ParseCLIVersion extracts the first version number from s, such as the output
+// of "claude --version". Surrounding text, a leading "v", a missing patch
+// component, and build metadata are tolerated.
+func ParseCLIVersion(s string) (CLIVersion, error) {
+	m := cliVersionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return CLIVersion{}, fmt.Errorf("no version number in %q", strings.TrimSpace(s))
+	}
+
+	var v CLIVersion
+	var err error
+	if v.Major, err = strconv.Atoi(m[1]); err != nil {
+		return CLIVersion{}, fmt.Errorf("invalid major version in %q: %w", s, err)
+	}
+	if v.Minor, err = strconv.Atoi(m[2]); err != nil {
+		return CLIVersion{}, fmt.Errorf("invalid minor version in %q: %w", s, err)
+	}
+	if m[3] != "" {
+		if v.Patch, err = strconv.Atoi(m[3]); err != nil {
+			return CLIVersion{}, fmt.Errorf("invalid patch version in %q: %w", s, err)
+		}
+	}
+	v.Prerelease = m[4]
+	return v, nil
+}
+
+// String returns the version in semver form.
+func (v CLIVersion) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0, or +1 depending on whether v is older than, equal to,
+// or newer than other, following semver precedence: a pre-release is older
+// than the release it precedes.
+func (v CLIVersion) Compare(other CLIVersion) int {
+	if c := compareInt(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+// Less reports whether v is older than other.
+func (v CLIVersion) Less(other CLIVersion) bool {
+	return v.Compare(other) < 0
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease compares dot-separated pre-release identifiers. Numeric
+// identifiers compare numerically and sort before alphanumeric ones.
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInt(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(as), len(bs))
+}
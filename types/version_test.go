@@ -0,0 +1,75 @@
+package types
+
+import "testing"
+
+// TestParseCLIVersion tests version extraction from CLI output.
+func TestParseCLIVersion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1.0.100", "1.0.100"},
+		{"1.0.100 (Claude Code)", "1.0.100"},
+		{"v2.0.0", "2.0.0"},
+		{"claude-code 2.1.3-beta.1", "2.1.3-beta.1"},
+		{"2.0.0-rc.1+build.5", "2.0.0-rc.1"},
+		{"2.1", "2.1.0"},
+		{"  3.4.5\n", "3.4.5"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCLIVersion(tt.input)
+		if err != nil {
+			t.Errorf("ParseCLIVersion(%q) error = %v", tt.input, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseCLIVersion(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "unknown", "version one", "v2"} {
+		if v, err := ParseCLIVersion(bad); err == nil {
+			t.Errorf("ParseCLIVersion(%q) = %s, want error", bad, v)
+		}
+	}
+}
+
+// TestCLIVersionCompare tests semver precedence including pre-releases.
+func TestCLIVersionCompare(t *testing.T) {
+	// Each version is older than the next
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.9",
+		"1.0.10",
+		"1.0.100",
+		"1.2.0",
+		"2.0.0",
+	}
+
+	for i := range ordered {
+		a, err := ParseCLIVersion(ordered[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Compare(a) != 0 {
+			t.Errorf("%s does not equal itself", a)
+		}
+		for j := i + 1; j < len(ordered); j++ {
+			b, err := ParseCLIVersion(ordered[j])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Compare(b) != -1 || b.Compare(a) != 1 || !a.Less(b) {
+				t.Errorf("expected %s < %s", a, b)
+			}
+		}
+	}
+}
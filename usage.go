@@ -0,0 +1,68 @@
+package claude
+
+import (
+	"sync"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// sessionUsage accumulates the token usage and cost of a client's turns. It
+// has its own lock so that reading it never waits for Connect or Close.
+type sessionUsage struct {
+	mu    sync.Mutex
+	cache types.CacheMetrics
+	stats types.SessionStats
+	costs costMeter
+}
+
+// observe adds the usage and cost of a ResultMessage; other messages are
+// ignored.
+func (u *sessionUsage) observe(msg types.Message) {
+	result, ok := msg.(*types.ResultMessage)
+	if !ok {
+		return
+	}
+	usage, err := result.ParseUsage()
+	if err != nil {
+		usage = nil
+	}
+	cost := u.costs.add(result)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.stats.Turns++
+	u.stats.TotalCostUSD += cost
+	u.stats.Duration += time.Duration(result.DurationMs) * time.Millisecond
+	if usage == nil {
+		return
+	}
+	u.cache.Add(usage)
+	u.stats.InputTokens += usage.InputTokens
+	u.stats.OutputTokens += usage.OutputTokens
+	u.stats.CacheReadTokens += usage.CacheReadInputTokens
+	u.stats.CacheCreationTokens += usage.CacheCreationInputTokens
+}
+
+// CacheMetrics returns the prompt cache statistics summed over the turns
+// whose results the client has received through ReceiveResponse, with the
+// cumulative hit rate from HitRate. A turn's own figures are in its
+// ResultMessage: see ParseUsage and Usage.CacheHitRate. It is safe to call
+// concurrently with ReceiveResponse.
+func (c *Client) CacheMetrics() types.CacheMetrics {
+	c.usage.mu.Lock()
+	defer c.usage.mu.Unlock()
+	return c.usage.cache
+}
+
+// Stats returns the turns, cost, token usage and duration summed over the
+// results the client has received, through ReceiveResponse or while
+// draining on Close. The CLI reports each session's cost as a running total,
+// so each result adds what it raised that total by; results without a cost
+// or usage add nothing to those sums. It is safe to call concurrently with
+// ReceiveResponse.
+func (c *Client) Stats() types.SessionStats {
+	c.usage.mu.Lock()
+	defer c.usage.mu.Unlock()
+	return c.usage.stats
+}
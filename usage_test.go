@@ -0,0 +1,91 @@
+package claude
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestClient_CacheMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx,
+		`{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":1,"session_id":"s","usage":{"input_tokens":100,"cache_read_input_tokens":800,"cache_creation_input_tokens":100,"output_tokens":20}}`,
+		`{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":2,"session_id":"s","usage":{"input_tokens":1000,"output_tokens":30}}`,
+		`{"type":"result","subtype":"success","duration_ms":1,"duration_api_ms":1,"is_error":false,"num_turns":3,"session_id":"s"}`,
+	)
+	if got := client.CacheMetrics(); got.Turns != 0 || got.HitRate() != 0 {
+		t.Errorf("CacheMetrics before any result = %+v, want zero", got)
+	}
+
+	if err := client.Query(ctx, "hello"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	// One ReceiveResponse per result
+	for i := 0; i < 3; i++ {
+		for range client.ReceiveResponse(ctx) {
+		}
+		if i == 0 {
+			if got := client.CacheMetrics().HitRate(); got != 0.8 {
+				t.Errorf("hit rate after the cached turn = %v, want 0.8", got)
+			}
+		}
+	}
+
+	got := client.CacheMetrics()
+	if got.Turns != 2 || got.InputTokens != 1100 || got.CacheReadTokens != 800 || got.CacheCreationTokens != 100 {
+		t.Errorf("CacheMetrics = %+v, want 2 turns, 1100 uncached, 800 read, 100 written", got)
+	}
+	if rate := got.HitRate(); rate != 0.4 {
+		t.Errorf("cumulative hit rate = %v, want 0.4", rate)
+	}
+}
+
+func TestClient_Stats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli := mockcli.New(t, mockcli.Scenario{Steps: []mockcli.Step{
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"result","subtype":"success","duration_ms":1200,"duration_api_ms":1000,"is_error":false,"num_turns":1,"session_id":"s","total_cost_usd":0.25,"usage":{"input_tokens":100,"cache_read_input_tokens":800,"cache_creation_input_tokens":100,"output_tokens":20}}`),
+		mockcli.AwaitPrompt(),
+		// No cost or usage reported for this turn
+		mockcli.Send(`{"type":"result","subtype":"success","duration_ms":300,"duration_api_ms":250,"is_error":false,"num_turns":2,"session_id":"s"}`),
+		mockcli.AwaitPrompt(),
+		mockcli.Send(`{"type":"result","subtype":"success","duration_ms":500,"duration_api_ms":400,"is_error":false,"num_turns":3,"session_id":"s","total_cost_usd":0.75,"usage":{"input_tokens":50,"cache_read_input_tokens":900,"output_tokens":40}}`),
+	}})
+	client, err := NewClient(ctx, types.NewClaudeAgentOptions().WithCLIPath(cli.Path))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer client.Close(ctx)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if got := client.Stats(); got != (types.SessionStats{}) {
+		t.Errorf("Stats before any result = %+v, want zero", got)
+	}
+
+	for _, prompt := range []string{"one", "two", "three"} {
+		if _, err := client.RunTurn(ctx, prompt); err != nil {
+			t.Fatalf("RunTurn(%q) failed: %v", prompt, err)
+		}
+	}
+
+	want := types.SessionStats{
+		Turns:               3,
+		TotalCostUSD:        0.75, // The CLI's running total, not 0.25 + 0.75
+		InputTokens:         150,
+		OutputTokens:        60,
+		CacheReadTokens:     1700,
+		CacheCreationTokens: 100,
+		Duration:            2 * time.Second,
+	}
+	if got := client.Stats(); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+// skipVersionCheckEnv disables WithMinCLIVersion enforcement when set to a non-empty value.
+const skipVersionCheckEnv = "CLAUDE_AGENT_SDK_SKIP_VERSION_CHECK"
+
+// versionProber is implemented by transports that can report the CLI version.
+type versionProber interface {
+	CLIVersion(ctx context.Context) (string, error)
+}
+
+// detectCLIVersion asks the transport for the CLI version and enforces
+// options.MinCLIVersion. It returns the version in semver form, or as reported
+// if it cannot be parsed. A version that cannot be determined never fails the
+// check, since the CLI may simply use an unfamiliar format.
+func detectCLIVersion(ctx context.Context, t Transport, options *types.ClaudeAgentOptions) (string, error) {
+	var minVersion *types.CLIVersion
+	if options.MinCLIVersion != nil {
+		v, err := types.ParseCLIVersion(*options.MinCLIVersion)
+		if err != nil {
+			return "", fmt.Errorf("invalid minimum CLI version: %w", err)
+		}
+		minVersion = &v
+	}
+
+	prober, ok := t.(versionProber)
+	if !ok {
+		return "", nil
+	}
+	raw, err := prober.CLIVersion(ctx)
+	if err != nil {
+		return "", nil
+	}
+
+	version, err := types.ParseCLIVersion(raw)
+	if err != nil {
+		return raw, nil
+	}
+
+	if minVersion != nil && version.Less(*minVersion) && os.Getenv(skipVersionCheckEnv) == "" {
+		return version.String(), types.NewUnsupportedCLIVersionError(version.String(), minVersion.String())
+	}
+	return version.String(), nil
+}
@@ -0,0 +1,126 @@
+package claude
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/schlunsen/claude-agent-sdk-go/internal/mockcli"
+	"github.com/schlunsen/claude-agent-sdk-go/types"
+)
+
+func TestClient_CLIVersion(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := connectScripted(t, ctx)
+	if got := client.CLIVersion(); got != "2.1.0" {
+		t.Errorf("CLIVersion() = %q, want 2.1.0", got)
+	}
+}
+
+func TestClient_MinCLIVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		reported    string
+		minVersion  string
+		wantVersion string
+		wantErr     bool
+	}{
+		{name: "newer", reported: "2.1.0 (Claude Code)", minVersion: "2.0.0", wantVersion: "2.1.0"},
+		{name: "equal", reported: "2.1.0 (Claude Code)", minVersion: "2.1.0", wantVersion: "2.1.0"},
+		{name: "newer than pre-release", reported: "2.1.0", minVersion: "2.1.0-beta.2", wantVersion: "2.1.0"},
+		{name: "older", reported: "1.0.99 (Claude Code)", minVersion: "1.0.100", wantVersion: "1.0.99", wantErr: true},
+		{name: "pre-release of minimum", reported: "2.0.0-rc.1", minVersion: "2.0.0", wantVersion: "2.0.0-rc.1", wantErr: true},
+		{name: "unknown format tolerated", reported: "development build", minVersion: "2.0.0", wantVersion: "development build"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			opts := types.NewClaudeAgentOptions().
+				WithCLIPath(mockcli.New(t, mockcli.Scenario{Version: tt.reported}).Path).
+				WithMinCLIVersion(tt.minVersion)
+			client, err := NewClient(ctx, opts)
+			if err != nil {
+				t.Fatalf("NewClient failed: %v", err)
+			}
+			defer func() {
+				_ = client.Close(ctx)
+			}()
+
+			err = client.Connect(ctx)
+			if tt.wantErr {
+				if !types.IsUnsupportedCLIVersionError(err) {
+					t.Fatalf("Connect error = %v, want UnsupportedCLIVersionError", err)
+				}
+				if client.IsConnected() {
+					t.Error("client connected despite unsupported version")
+				}
+			} else if err != nil {
+				t.Fatalf("Connect failed: %v", err)
+			}
+
+			if got := client.CLIVersion(); got != tt.wantVersion {
+				t.Errorf("CLIVersion() = %q, want %q", got, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestClient_MinCLIVersionSkipEnv(t *testing.T) {
+	t.Setenv(skipVersionCheckEnv, "1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(mockcli.New(t, mockcli.Scenario{Version: "1.0.0"}).Path).
+		WithMinCLIVersion("9.0.0")
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect failed with version check disabled: %v", err)
+	}
+}
+
+func TestClient_InvalidMinCLIVersion(t *testing.T) {
+	ctx := context.Background()
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(writeScriptedCLI(t)).
+		WithMinCLIVersion("latest")
+	client, err := NewClient(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	defer func() {
+		_ = client.Close(ctx)
+	}()
+
+	err = client.Connect(ctx)
+	if err == nil || types.IsUnsupportedCLIVersionError(err) {
+		t.Errorf("Connect error = %v, want invalid minimum version error", err)
+	}
+}
+
+func TestQuery_MinCLIVersion(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := types.NewClaudeAgentOptions().
+		WithCLIPath(mockcli.New(t, mockcli.Scenario{Version: "1.0.0"}).Path).
+		WithMinCLIVersion("2.0.0")
+
+	_, err := Query(ctx, "hello", opts)
+	if !types.IsUnsupportedCLIVersionError(err) {
+		t.Errorf("Query error = %v, want UnsupportedCLIVersionError", err)
+	}
+}